@@ -1,10 +1,14 @@
 package api
 
 import (
+	"crypto/subtle"
 	"fmt"
 	"log"
 	"net/http"
 	"nofx/manager"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -14,10 +18,11 @@ type Server struct {
 	router        *gin.Engine
 	traderManager *manager.TraderManager
 	port          int
+	apiToken      string // 管理接口的访问令牌（为空时禁用管理接口）
 }
 
-// NewServer 创建API服务器
-func NewServer(traderManager *manager.TraderManager, port int) *Server {
+// NewServer 创建API服务器（apiToken为管理接口的访问令牌，为空时禁用管理接口）
+func NewServer(traderManager *manager.TraderManager, port int, apiToken string) *Server {
 	// 设置为Release模式（减少日志输出）
 	gin.SetMode(gin.ReleaseMode)
 
@@ -30,6 +35,7 @@ func NewServer(traderManager *manager.TraderManager, port int) *Server {
 		router:        router,
 		traderManager: traderManager,
 		port:          port,
+		apiToken:      apiToken,
 	}
 
 	// 设置路由
@@ -54,6 +60,24 @@ func corsMiddleware() gin.HandlerFunc {
 	}
 }
 
+// authMiddleware 管理接口鉴权：请求头 Authorization: Bearer <api_token>
+func (s *Server) authMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if s.apiToken == "" {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "未配置api_token，管理接口已禁用"})
+			return
+		}
+		header := c.GetHeader("Authorization")
+		if !strings.HasPrefix(header, "Bearer ") ||
+			subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(header, "Bearer ")), []byte(s.apiToken)) != 1 {
+			log.Printf("⚠️ 管理接口鉴权失败: %s %s (来自 %s)", c.Request.Method, c.Request.URL.Path, c.ClientIP())
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+			return
+		}
+		c.Next()
+	}
+}
+
 // setupRoutes 设置路由
 func (s *Server) setupRoutes() {
 	// 健康检查
@@ -77,6 +101,12 @@ func (s *Server) setupRoutes() {
 		api.GET("/statistics", s.handleStatistics)
 		api.GET("/equity-history", s.handleEquityHistory)
 		api.GET("/performance", s.handlePerformance)
+		api.GET("/trades", s.handleTrades)
+		api.GET("/shadows", s.handleShadows)
+
+		// 管理接口（需要api_token）
+		admin := api.Group("/admin", s.authMiddleware())
+		admin.POST("/kill-switch", s.handleKillSwitch)
 	}
 }
 
@@ -174,10 +204,10 @@ func (s *Server) handleAccount(c *gin.Context) {
 
 	log.Printf("✓ 返回账户信息 [%s]: 净值=%.2f, 可用=%.2f, 盈亏=%.2f (%.2f%%)",
 		trader.GetName(),
-		account["total_equity"],
-		account["available_balance"],
-		account["total_pnl"],
-		account["total_pnl_pct"])
+		account.TotalEquity,
+		account.AvailableBalance,
+		account.TotalPnL,
+		account.TotalPnLPct)
 	c.JSON(http.StatusOK, account)
 }
 
@@ -401,6 +431,108 @@ func (s *Server) handlePerformance(c *gin.Context) {
 	c.JSON(http.StatusOK, performance)
 }
 
+// handleTrades 交易所成交记录与资金流水（已实现盈亏、手续费、资金费）
+// 参数: symbol（可选），start/end（毫秒时间戳或RFC3339，默认最近7天）
+func (s *Server) handleTrades(c *gin.Context) {
+	_, traderID, err := s.getTraderFromQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	trader, err := s.traderManager.GetTrader(traderID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	end := time.Now()
+	if v := c.Query("end"); v != "" {
+		if end, err = parseTimeParam(v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("end参数无效: %v", err)})
+			return
+		}
+	}
+	start := end.Add(-7 * 24 * time.Hour)
+	if v := c.Query("start"); v != "" {
+		if start, err = parseTimeParam(v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("start参数无效: %v", err)})
+			return
+		}
+	}
+	if !start.Before(end) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "start必须早于end"})
+		return
+	}
+
+	history, err := trader.GetTradeHistory(c.Query("symbol"), start, end)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": fmt.Sprintf("获取成交记录失败: %v", err),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, history)
+}
+
+// handleShadows 实盘与影子交易器的盈亏对比（参数: limit，每条曲线最多的周期数，默认10000）
+func (s *Server) handleShadows(c *gin.Context) {
+	_, traderID, err := s.getTraderFromQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	limit := 10000
+	if v := c.Query("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit参数无效"})
+			return
+		}
+	}
+
+	comparison, err := s.traderManager.GetShadowComparison(traderID, limit)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, comparison)
+}
+
+// handleKillSwitch 一键清仓：停止所有trader，撤销所有挂单并市价平掉全部持仓
+// 请求体可选 {"reason": "..."}，返回每个币种每项操作的结果；有操作失败时返回500
+func (s *Server) handleKillSwitch(c *gin.Context) {
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("请求格式错误: %v", err)})
+			return
+		}
+	}
+	if req.Reason == "" {
+		req.Reason = "API紧急停止"
+	}
+
+	report := s.traderManager.KillAll("api "+c.ClientIP(), req.Reason)
+	status := http.StatusOK
+	if !report.Success {
+		status = http.StatusInternalServerError
+	}
+	c.JSON(status, report)
+}
+
+// parseTimeParam 解析毫秒时间戳或RFC3339格式的时间参数
+func parseTimeParam(v string) (time.Time, error) {
+	if ms, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return time.UnixMilli(ms), nil
+	}
+	return time.Parse(time.RFC3339, v)
+}
+
 // Start 启动服务器
 func (s *Server) Start() error {
 	addr := fmt.Sprintf(":%d", s.port)
@@ -416,6 +548,8 @@ func (s *Server) Start() error {
 	log.Printf("  • GET  /api/statistics?trader_id=xxx - 指定trader的统计信息")
 	log.Printf("  • GET  /api/equity-history?trader_id=xxx - 指定trader的收益率历史数据")
 	log.Printf("  • GET  /api/performance?trader_id=xxx - 指定trader的AI学习表现分析")
+	log.Printf("  • GET  /api/shadows?trader_id=xxx - 指定trader与影子交易器的盈亏对比")
+	log.Printf("  • POST /api/admin/kill-switch - 一键清仓：停止所有trader，撤单并平掉全部持仓（需要api_token）")
 	log.Printf("  • GET  /health               - 健康检查")
 	log.Println()
 
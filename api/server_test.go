@@ -0,0 +1,40 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"nofx/manager"
+	"testing"
+)
+
+func TestKillSwitchRequiresBearerToken(t *testing.T) {
+	t.Chdir(t.TempDir()) // 一键清仓审计记录写在临时目录
+
+	tests := []struct {
+		name          string
+		apiToken      string
+		authorization string
+		wantStatus    int
+	}{
+		{"未配置令牌", "", "Bearer secret", http.StatusForbidden},
+		{"缺少请求头", "secret", "", http.StatusUnauthorized},
+		{"缺少Bearer前缀", "secret", "secret", http.StatusUnauthorized},
+		{"其他认证方式", "secret", "Basic secret", http.StatusUnauthorized},
+		{"令牌错误", "secret", "Bearer wrong", http.StatusUnauthorized},
+		{"令牌正确", "secret", "Bearer secret", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewServer(manager.NewTraderManager(), 0, tt.apiToken)
+			req := httptest.NewRequest(http.MethodPost, "/api/admin/kill-switch", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			w := httptest.NewRecorder()
+			s.router.ServeHTTP(w, req)
+			if w.Code != tt.wantStatus {
+				t.Errorf("状态码 %d，期望 %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"strings"
 	"time"
 )
 
@@ -19,7 +20,7 @@ type TraderConfig struct {
 	EnableScreenshot bool `json:"enable_screenshot,omitempty"` // 是否启用图表截图功能
 
 	// 交易平台选择
-	Exchange string `json:"exchange"` // "binance", "hyperliquid", or "aster"
+	Exchange string `json:"exchange"` // "binance", "hyperliquid", "aster", "bybit", "okx", or "paper"
 
 	// 币安配置
 	BinanceAPIKey    string `json:"binance_api_key,omitempty"`
@@ -35,6 +36,44 @@ type TraderConfig struct {
 	AsterSigner     string `json:"aster_signer,omitempty"`      // Aster API钱包地址
 	AsterPrivateKey string `json:"aster_private_key,omitempty"` // Aster API钱包私钥
 
+	// Bybit配置
+	BybitAPIKey    string `json:"bybit_api_key,omitempty"`
+	BybitSecretKey string `json:"bybit_secret_key,omitempty"`
+	BybitTestnet   bool   `json:"bybit_testnet,omitempty"`
+
+	// OKX配置
+	OKXAPIKey     string `json:"okx_api_key,omitempty"`
+	OKXSecretKey  string `json:"okx_secret_key,omitempty"`
+	OKXPassphrase string `json:"okx_passphrase,omitempty"` // 创建API时设置的密码
+
+	// 模拟盘配置（exchange为paper时使用，虚拟资金取initial_balance）
+	PaperSlippageBps float64 `json:"paper_slippage_bps,omitempty"` // 市价成交滑点（基点，默认5）
+	PaperFeeRate     float64 `json:"paper_fee_rate,omitempty"`     // 手续费率（默认0.0005）
+
+	// 保证金模式和持仓模式（不填时使用各交易所的默认设置，启动时和每次开仓前生效）
+	MarginMode   string `json:"margin_mode,omitempty"`   // "cross"（全仓）或 "isolated"（逐仓）
+	PositionMode string `json:"position_mode,omitempty"` // "one-way"（单向持仓）或 "hedge"（双向持仓）
+
+	// 开仓方式配置（仅交易机器人模式）
+	EntryOrderType      string `json:"entry_order_type,omitempty"`       // "market"（默认）或 "limit"（按AI给出的入场价挂限价单）
+	EntryTimeInForce    string `json:"entry_time_in_force,omitempty"`    // 限价单时间有效性: "GTC"（默认）, "IOC" 或 "POST_ONLY"
+	EntryOrderMaxCycles int    `json:"entry_order_max_cycles,omitempty"` // 限价单最多等待的周期数，超过后撤单（默认3）
+
+	// 仓位计算方式（仅交易机器人模式）
+	PositionSizing  string  `json:"position_sizing,omitempty"`    // "ai"（默认，使用AI给出的仓位）或 "risk"（按单笔风险和止损距离计算）
+	RiskPerTradePct float64 `json:"risk_per_trade_pct,omitempty"` // 单笔风险占账户净值的百分比（position_sizing为risk时使用，默认1）
+
+	// 下单前滑点检查（仅交易机器人模式，按订单簿估算市价单的成交均价）
+	MaxSlippageBps float64 `json:"max_slippage_bps,omitempty"` // 相对中间价的滑点上限（基点，0表示不检查）
+	SlippageAction string  `json:"slippage_action,omitempty"`  // 超过上限时: "downsize"（默认，缩小数量）或 "reject"（拒绝下单）
+
+	// 拆单执行（开仓、加仓和减仓，平仓始终单笔下单）：大单拆成多笔子订单，减少对盘口的冲击
+	ExecutionAlgo            string  `json:"execution_algo,omitempty"`             // "market"（默认，单笔下单）, "twap"（按时间均匀拆单）或 "iceberg"（每次只下盘口一档的数量）
+	ExecutionThresholdUSD    float64 `json:"execution_threshold_usd,omitempty"`    // 订单价值达到该值才拆单（0表示全部拆单）
+	TWAPSlices               int     `json:"twap_slices,omitempty"`                // TWAP的子订单数（默认5）
+	ExecutionIntervalSeconds int     `json:"execution_interval_seconds,omitempty"` // 子订单的间隔秒数（TWAP默认10，冰山单默认2）
+	IcebergSliceUSD          float64 `json:"iceberg_slice_usd,omitempty"`          // 冰山单每笔的价值（0表示按盘口一档的数量）
+
 	// AI配置
 	QwenKey     string `json:"qwen_key,omitempty"`
 	DeepSeekKey string `json:"deepseek_key,omitempty"`
@@ -47,6 +86,23 @@ type TraderConfig struct {
 
 	InitialBalance      float64 `json:"initial_balance"`
 	ScanIntervalMinutes int     `json:"scan_interval_minutes"`
+
+	// 影子交易器（仅交易机器人模式）：使用相同的上下文请求其他AI，在虚拟账本上执行，用于对比模型/提示词
+	Shadows []ShadowConfig `json:"shadows,omitempty"`
+}
+
+// ShadowConfig 影子交易器配置（只需AI配置，虚拟资金与手续费沿用所属trader）
+type ShadowConfig struct {
+	Name    string `json:"name"`     // 影子名称（同一trader内唯一，用于日志目录）
+	AIModel string `json:"ai_model"` // "qwen", "deepseek", "gemini", or "custom"
+
+	QwenKey     string `json:"qwen_key,omitempty"`
+	DeepSeekKey string `json:"deepseek_key,omitempty"`
+	GeminiKey   string `json:"gemini_key,omitempty"`
+
+	CustomAPIURL    string `json:"custom_api_url,omitempty"`
+	CustomAPIKey    string `json:"custom_api_key,omitempty"`
+	CustomModelName string `json:"custom_model_name,omitempty"`
 }
 
 // LeverageConfig 杠杆配置
@@ -63,10 +119,15 @@ type Config struct {
 	CoinPoolAPIURL     string         `json:"coin_pool_api_url"`
 	OITopAPIURL        string         `json:"oi_top_api_url"`
 	APIServerPort      int            `json:"api_server_port"`
+	APIToken           string         `json:"api_token,omitempty"` // 管理接口（一键清仓）的访问令牌，为空时禁用管理接口
 	MaxDailyLoss       float64        `json:"max_daily_loss"`
 	MaxDrawdown        float64        `json:"max_drawdown"`
 	StopTradingMinutes int            `json:"stop_trading_minutes"`
 	Leverage           LeverageConfig `json:"leverage"` // 杠杆配置
+
+	// 熔断：日亏损超过max_daily_loss%或回撤超过max_drawdown%后暂停开仓和加仓stop_trading_minutes分钟，
+	// 开启后同时撤销所有挂单并平掉全部持仓
+	FlattenOnBreaker bool `json:"flatten_on_circuit_breaker,omitempty"`
 }
 
 // LoadConfig 从文件加载配置
@@ -144,8 +205,8 @@ func (c *Config) Validate() error {
 		if trader.Exchange == "" {
 			trader.Exchange = "binance" // 默认使用币安
 		}
-		if trader.Exchange != "binance" && trader.Exchange != "hyperliquid" && trader.Exchange != "aster" {
-			return fmt.Errorf("trader[%d]: exchange必须是 'binance', 'hyperliquid' 或 'aster'", i)
+		if trader.Exchange != "binance" && trader.Exchange != "hyperliquid" && trader.Exchange != "aster" && trader.Exchange != "bybit" && trader.Exchange != "okx" && trader.Exchange != "paper" {
+			return fmt.Errorf("trader[%d]: exchange必须是 'binance', 'hyperliquid', 'aster', 'bybit', 'okx' 或 'paper'", i)
 		}
 
 		// 根据平台验证对应的密钥
@@ -161,6 +222,71 @@ func (c *Config) Validate() error {
 			if trader.AsterUser == "" || trader.AsterSigner == "" || trader.AsterPrivateKey == "" {
 				return fmt.Errorf("trader[%d]: 使用Aster时必须配置aster_user, aster_signer和aster_private_key", i)
 			}
+		} else if trader.Exchange == "bybit" {
+			if trader.BybitAPIKey == "" || trader.BybitSecretKey == "" {
+				return fmt.Errorf("trader[%d]: 使用Bybit时必须配置bybit_api_key和bybit_secret_key", i)
+			}
+		} else if trader.Exchange == "okx" {
+			if trader.OKXAPIKey == "" || trader.OKXSecretKey == "" || trader.OKXPassphrase == "" {
+				return fmt.Errorf("trader[%d]: 使用OKX时必须配置okx_api_key, okx_secret_key和okx_passphrase", i)
+			}
+		} else if trader.Exchange == "paper" {
+			// 模拟盘无需交易所密钥
+			if trader.PaperSlippageBps < 0 || trader.PaperFeeRate < 0 {
+				return fmt.Errorf("trader[%d]: paper_slippage_bps和paper_fee_rate不能为负数", i)
+			}
+		}
+
+		// 验证保证金模式和持仓模式
+		if trader.MarginMode != "" && trader.MarginMode != "cross" && trader.MarginMode != "isolated" {
+			return fmt.Errorf("trader[%d]: margin_mode必须是 'cross' 或 'isolated'", i)
+		}
+		if trader.PositionMode != "" && trader.PositionMode != "one-way" && trader.PositionMode != "hedge" {
+			return fmt.Errorf("trader[%d]: position_mode必须是 'one-way' 或 'hedge'", i)
+		}
+		if trader.Exchange == "hyperliquid" && trader.PositionMode == "hedge" {
+			return fmt.Errorf("trader[%d]: Hyperliquid不支持双向持仓（position_mode: hedge）", i)
+		}
+
+		// 验证开仓方式配置
+		if trader.EntryOrderType != "" && trader.EntryOrderType != "market" && trader.EntryOrderType != "limit" {
+			return fmt.Errorf("trader[%d]: entry_order_type必须是 'market' 或 'limit'", i)
+		}
+		if trader.EntryTimeInForce != "" && trader.EntryTimeInForce != "GTC" && trader.EntryTimeInForce != "IOC" && trader.EntryTimeInForce != "POST_ONLY" {
+			return fmt.Errorf("trader[%d]: entry_time_in_force必须是 'GTC', 'IOC' 或 'POST_ONLY'", i)
+		}
+		if trader.EntryOrderMaxCycles < 0 {
+			return fmt.Errorf("trader[%d]: entry_order_max_cycles不能为负数", i)
+		}
+
+		// 验证仓位计算方式
+		if trader.PositionSizing != "" && trader.PositionSizing != "ai" && trader.PositionSizing != "risk" {
+			return fmt.Errorf("trader[%d]: position_sizing必须是 'ai' 或 'risk'", i)
+		}
+		if trader.RiskPerTradePct < 0 || trader.RiskPerTradePct > 100 {
+			return fmt.Errorf("trader[%d]: risk_per_trade_pct必须在0-100之间", i)
+		}
+
+		// 验证滑点检查配置
+		if trader.MaxSlippageBps < 0 {
+			return fmt.Errorf("trader[%d]: max_slippage_bps不能为负数", i)
+		}
+		if trader.SlippageAction != "" && trader.SlippageAction != "downsize" && trader.SlippageAction != "reject" {
+			return fmt.Errorf("trader[%d]: slippage_action必须是 'downsize' 或 'reject'", i)
+		}
+
+		// 验证拆单执行配置
+		if trader.ExecutionAlgo != "" && trader.ExecutionAlgo != "market" && trader.ExecutionAlgo != "twap" && trader.ExecutionAlgo != "iceberg" {
+			return fmt.Errorf("trader[%d]: execution_algo必须是 'market', 'twap' 或 'iceberg'", i)
+		}
+		if trader.ExecutionThresholdUSD < 0 || trader.IcebergSliceUSD < 0 {
+			return fmt.Errorf("trader[%d]: execution_threshold_usd和iceberg_slice_usd不能为负数", i)
+		}
+		if trader.TWAPSlices < 0 || trader.TWAPSlices > 50 {
+			return fmt.Errorf("trader[%d]: twap_slices必须在0-50之间", i)
+		}
+		if trader.ExecutionIntervalSeconds < 0 {
+			return fmt.Errorf("trader[%d]: execution_interval_seconds不能为负数", i)
 		}
 
 		if trader.AIModel == "qwen" && trader.QwenKey == "" {
@@ -189,12 +315,41 @@ func (c *Config) Validate() error {
 		if trader.ScanIntervalMinutes <= 0 {
 			trader.ScanIntervalMinutes = 3 // 默认3分钟
 		}
+
+		// 验证影子交易器
+		if len(trader.Shadows) > 0 && trader.Mode == "pm" {
+			return fmt.Errorf("trader[%d]: 影子交易器仅支持交易机器人模式（mode: tm）", i)
+		}
+		shadowNames := make(map[string]bool)
+		for j, shadow := range trader.Shadows {
+			if shadow.Name == "" || strings.ContainsAny(shadow.Name, `/\ `) {
+				return fmt.Errorf("trader[%d].shadows[%d]: name不能为空，且不能包含空格或路径分隔符", i, j)
+			}
+			if shadowNames[shadow.Name] {
+				return fmt.Errorf("trader[%d].shadows[%d]: name '%s' 重复", i, j, shadow.Name)
+			}
+			shadowNames[shadow.Name] = true
+			if err := shadow.validateAI(); err != nil {
+				return fmt.Errorf("trader[%d].shadows[%d]: %w", i, j, err)
+			}
+		}
 	}
 
 	if c.APIServerPort <= 0 {
 		c.APIServerPort = 8080 // 默认8080端口
 	}
 
+	// 熔断配置（百分比）
+	if c.MaxDailyLoss < 0 || c.MaxDailyLoss >= 100 {
+		return fmt.Errorf("max_daily_loss必须在0-100之间（百分比，0表示不限制）")
+	}
+	if c.MaxDrawdown < 0 || c.MaxDrawdown >= 100 {
+		return fmt.Errorf("max_drawdown必须在0-100之间（百分比，0表示不限制）")
+	}
+	if c.StopTradingMinutes < 0 {
+		return fmt.Errorf("stop_trading_minutes不能为负数")
+	}
+
 	// 设置杠杆默认值（适配币安子账户限制，最大5倍）
 	if c.Leverage.BTCETHLeverage <= 0 {
 		c.Leverage.BTCETHLeverage = 5 // 默认5倍（安全值，适配子账户）
@@ -212,6 +367,31 @@ func (c *Config) Validate() error {
 	return nil
 }
 
+// validateAI 验证影子交易器的AI配置
+func (sc *ShadowConfig) validateAI() error {
+	switch sc.AIModel {
+	case "qwen":
+		if sc.QwenKey == "" {
+			return fmt.Errorf("使用Qwen时必须配置qwen_key")
+		}
+	case "deepseek":
+		if sc.DeepSeekKey == "" {
+			return fmt.Errorf("使用DeepSeek时必须配置deepseek_key")
+		}
+	case "gemini":
+		if sc.GeminiKey == "" {
+			return fmt.Errorf("使用Gemini时必须配置gemini_key")
+		}
+	case "custom":
+		if sc.CustomAPIURL == "" || sc.CustomAPIKey == "" || sc.CustomModelName == "" {
+			return fmt.Errorf("使用自定义API时必须配置custom_api_url, custom_api_key和custom_model_name")
+		}
+	default:
+		return fmt.Errorf("ai_model必须是 'qwen', 'deepseek', 'gemini' 或 'custom'")
+	}
+	return nil
+}
+
 // GetScanInterval 获取扫描间隔
 func (tc *TraderConfig) GetScanInterval() time.Duration {
 	return time.Duration(tc.ScanIntervalMinutes) * time.Minute
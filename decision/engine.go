@@ -33,6 +33,8 @@ type PositionInfo struct {
 	DrawdownFromPeakPct   float64 `json:"drawdown_from_peak_pct"`           // 从峰值回撤百分比
 	StopLossPrice         float64 `json:"stop_loss_price"`                  // 止损价格
 	TakeProfitPrice       float64 `json:"take_profit_price"`                // 止盈价格
+	Funding               float64 `json:"funding"`                          // 持仓期间累计资金费（正数为收到，负数为支付）
+	BracketState          string  `json:"bracket_state,omitempty"`          // 止损止盈联动单状态（空表示未使用联动单）
 
 }
 
@@ -77,12 +79,30 @@ type Context struct {
 	BTCETHLeverage      int                     `json:"-"` // BTC/ETH杠杆倍数（从配置读取）
 	AltcoinLeverage     int                     `json:"-"` // 山寨币杠杆倍数（从配置读取）
 	ScanIntervalMinutes int                     `json:"-"` // 扫描间隔分钟数（从配置读取）
+	Capabilities        Capabilities            `json:"-"` // 交易所支持的功能（决定提供给AI的操作）
 }
 
+// Capabilities 交易所支持的功能（与trader.Capabilities对应，零值表示都不支持）
+type Capabilities struct {
+	TrailingStop       bool    // 追踪止损（交易所原生或客户端模拟）
+	ReduceOnly         bool    // 平仓单只减仓
+	SeparateSLTPCancel bool    // 能单独取消止损单或止盈单（可以只更新止损或止盈）
+	HedgeMode          bool    // 同一币种能同时持有多空仓位
+	LimitOrders        bool    // 支持限价开仓
+	AdjustMargin       bool    // 支持调整逐仓仓位保证金
+	MinNotional        float64 // 最小下单名义价值（USDT）
+}
+
+// 追踪止损回调比例范围（%，各交易所都支持的区间）
+const (
+	MinTrailingCallbackRate = 0.1
+	MaxTrailingCallbackRate = 5.0
+)
+
 // Decision AI的交易决策
 type Decision struct {
 	Symbol                string  `json:"symbol"`
-	Action                string  `json:"action"` // "open_long", "open_short", "close_long", "close_short", "increase_long", "increase_short", "decrease_long", "decrease_short", "hold", "wait"
+	Action                string  `json:"action"` // "open_long", "open_short", "close_long", "close_short", "increase_long", "increase_short", "decrease_long", "decrease_short", "update_loss_profit", "set_trailing_stop", "hold", "wait"
 	Leverage              int     `json:"leverage,omitempty"`
 	PositionSizeUSD       float64 `json:"position_size_usd,omitempty"`
 	EntryPrice            float64 `json:"entry_price,omitempty"` // 入场价格（开仓/加仓时必填）
@@ -92,6 +112,9 @@ type Decision struct {
 	RiskUSD               float64 `json:"risk_usd,omitempty"`   // 最大美元风险
 	Reasoning             string  `json:"reasoning"`
 	InvalidationCondition string  `json:"invalidation_condition,omitempty"` // 离场条件
+	MarginUSD             float64 `json:"margin_usd,omitempty"`             // 追加的逐仓保证金（仅仓位管理的add_margin_long/short）
+	CallbackRate          float64 `json:"callback_rate,omitempty"`          // 追踪止损回调比例（%，set_trailing_stop）
+	ActivationPrice       float64 `json:"activation_price,omitempty"`       // 追踪止损激活价（0表示立即开始追踪，set_trailing_stop）
 }
 
 // FullDecision AI的完整决策（包含思维链）
@@ -110,7 +133,7 @@ func GetFullDecision(ctx *Context, mcpClient *mcp.Client, enableScreenshot bool)
 	}
 
 	// 2. 构建 System Prompt（固定规则）和 User Prompt（动态数据）
-	systemPrompt := buildSystemPrompt(ctx.Account.TotalEquity, ctx.BTCETHLeverage, ctx.AltcoinLeverage, ctx.ScanIntervalMinutes)
+	systemPrompt := buildSystemPrompt(ctx.Account.TotalEquity, ctx.BTCETHLeverage, ctx.AltcoinLeverage, ctx.ScanIntervalMinutes, ctx.Capabilities)
 	userPrompt := buildUserPrompt(ctx)
 
 	// 3. 生成图表截图（仅在使用Gemini且启用截图时）
@@ -156,7 +179,7 @@ func GetFullDecision(ctx *Context, mcpClient *mcp.Client, enableScreenshot bool)
 	}
 
 	// 5. 解析AI响应
-	decision, err := parseFullDecisionResponse(aiResponse, ctx.Account.TotalEquity, ctx.BTCETHLeverage, ctx.AltcoinLeverage)
+	decision, err := parseFullDecisionResponse(aiResponse, ctx.Account.TotalEquity, ctx.BTCETHLeverage, ctx.AltcoinLeverage, ctx.Capabilities)
 	if err != nil {
 		// 记录AI响应的前500个字符用于调试
 		responsePreview := aiResponse
@@ -173,9 +196,10 @@ func GetFullDecision(ctx *Context, mcpClient *mcp.Client, enableScreenshot bool)
 }
 
 // fetchMarketDataForContext 为上下文中的所有币种获取市场数据和OI数据
+// 上下文已带有市场数据时（影子交易器复用实盘交易器的数据）直接使用，只为缺少数据的持仓币种补充获取
 func fetchMarketDataForContext(ctx *Context) error {
+	shared := ctx.MarketDataMap
 	ctx.MarketDataMap = make(map[string]*market.Data)
-	ctx.OITopDataMap = make(map[string]*OITopData)
 
 	// 收集所有需要获取数据的币种
 	symbolSet := make(map[string]bool)
@@ -202,6 +226,17 @@ func fetchMarketDataForContext(ctx *Context) error {
 	}
 
 	for symbol := range symbolSet {
+		if shared != nil {
+			if data, ok := shared[symbol]; ok {
+				ctx.MarketDataMap[symbol] = data
+				continue
+			}
+			// 候选币种没有数据说明已被过滤，不再重新获取
+			if !positionSymbols[symbol] {
+				continue
+			}
+		}
+
 		data, err := market.Get(symbol, ctx.ScanIntervalMinutes) // 使用配置的扫描间隔
 		if err != nil {
 			// 单个币种失败不影响整体，只记录错误
@@ -227,7 +262,12 @@ func fetchMarketDataForContext(ctx *Context) error {
 		ctx.MarketDataMap[symbol] = data
 	}
 
+	if ctx.OITopDataMap != nil {
+		return nil
+	}
+
 	// 加载OI Top数据（不影响主流程）
+	ctx.OITopDataMap = make(map[string]*OITopData)
 	oiPositions, err := pool.GetOITopPositions()
 	if err == nil {
 		for _, pos := range oiPositions {
@@ -256,7 +296,7 @@ func calculateMaxCandidates(ctx *Context) int {
 }
 
 // buildSystemPrompt 构建 System Prompt（固定规则，可缓存）
-func buildSystemPrompt(accountEquity float64, btcEthLeverage, altcoinLeverage int, scanIntervalMinutes int) string {
+func buildSystemPrompt(accountEquity float64, btcEthLeverage, altcoinLeverage int, scanIntervalMinutes int, caps Capabilities) string {
 	var sb strings.Builder
 
 	// 计算风险敞口和最大仓位 (基于账户净值)
@@ -274,7 +314,15 @@ func buildSystemPrompt(accountEquity float64, btcEthLeverage, altcoinLeverage in
 	sb.WriteString("1. **盈亏比 (R:R)**: 开仓必须 ≥ 1:2。加仓后，整体 R:R 必须 ≥ 1:2。\n")
 	sb.WriteString(fmt.Sprintf("2. **单笔风险**: 单笔交易风险 (risk_usd) 不得超过净值的 5%%，即 **$%.2f**。\n", accountEquity*0.05))
 	sb.WriteString(fmt.Sprintf("3. **最大仓位**: BTC/ETH ≤ %.0f U; 山寨币 ≤ %.0f U。\n", maxBtcEthPosition, maxAltcoinPosition))
-	sb.WriteString("4. **保证金**: 总使用率 ≤ 90%。\n\n")
+	sb.WriteString("4. **保证金**: 总使用率 ≤ 90%。\n")
+	// 交易所限制：只提供能执行的操作
+	if caps.MinNotional > 0 {
+		sb.WriteString(fmt.Sprintf("- **最小下单**: 开仓/加仓的 position_size_usd 不得低于 %.0f U（交易所最小名义价值）。\n", caps.MinNotional))
+	}
+	if !caps.HedgeMode {
+		sb.WriteString("- **单向持仓**: 同一币种不能同时持有多空仓位，反手必须先给出 close 决策。\n")
+	}
+	sb.WriteString("\n")
 
 	// === 📊 短线狙击评分卡 (核心开仓逻辑) ===
 	sb.WriteString("# 🧮 评分卡 (开仓/加仓依据)\n")
@@ -346,6 +394,16 @@ func buildSystemPrompt(accountEquity float64, btcEthLeverage, altcoinLeverage in
 	sb.WriteString("- 加仓时：`stop_loss`/`take_profit`/`entry_price` 必须是**加仓后整体**的平均价格和新的止损止盈位。\n")
 	sb.WriteString("- 减仓时：`position_size_usd` 填写**需要减少的金额**。\n")
 	sb.WriteString("- `risk_usd`: 仅在 `open` 或 `increase` 时填写，表示本次操作新增的美元风险。\n")
+	if caps.SeparateSLTPCancel {
+		sb.WriteString("- `update_loss_profit`: 可以只更新止损或只更新止盈，不更新的一项填0（保持原订单）。\n")
+	} else {
+		sb.WriteString("- `update_loss_profit`: 必须同时填写 `stop_loss` 和 `take_profit`（该交易所无法单独撤销止损或止盈单）。\n")
+	}
+	if caps.TrailingStop {
+		sb.WriteString(fmt.Sprintf("- `set_trailing_stop`: 把移动止盈交给交易所的追踪止损单，不必每个周期重复 `update_loss_profit`。`callback_rate` 为从最高价(多)/最低价(空)回撤多少%%平仓（%.1f-%.0f），`activation_price` 为开始追踪的价格（多头高于当前价、空头低于当前价，填0立即开始追踪）。原有止损止盈单保持不变。\n",
+			MinTrailingCallbackRate, MaxTrailingCallbackRate))
+		sb.WriteString("  示例: {\"symbol\": \"ETHUSDT\", \"action\": \"set_trailing_stop\", \"callback_rate\": 1.5, \"activation_price\": 3600, \"reasoning\": \"已到达2R，剩余仓位改为1.5%追踪止损\"}\n")
+	}
 
 	return sb.String()
 }
@@ -406,6 +464,17 @@ func buildUserPrompt(ctx *Context) string {
 			// 	sb.WriteString(fmt.Sprintf("**开仓理由**: %s\n", pos.Reasoning))
 			// }
 
+			// 显示累计资金费（未实现盈亏不含资金费）
+			if pos.Funding != 0 {
+				sb.WriteString(fmt.Sprintf("**累计资金费**: %+.2f USDT（正数为收到）| 计入资金费后净盈亏 %+.2f USDT\n",
+					pos.Funding, pos.UnrealizedPnL+pos.Funding))
+			}
+
+			// 联动单缺少一侧时提醒重新设置保护单
+			if pos.BracketState == "broken" {
+				sb.WriteString("**⚠️ 止损止盈不完整**: 只剩一侧保护单，请用update_loss_profit同时重新设置止损和止盈\n")
+			}
+
 			// 显示离场条件（如果有）
 			if pos.InvalidationCondition != "" {
 				sb.WriteString(fmt.Sprintf("**离场条件**: %s\n", pos.InvalidationCondition))
@@ -512,7 +581,7 @@ func buildUserPrompt(ctx *Context) string {
 }
 
 // parseFullDecisionResponse 解析AI的完整决策响应
-func parseFullDecisionResponse(aiResponse string, accountEquity float64, btcEthLeverage, altcoinLeverage int) (*FullDecision, error) {
+func parseFullDecisionResponse(aiResponse string, accountEquity float64, btcEthLeverage, altcoinLeverage int, caps Capabilities) (*FullDecision, error) {
 	// 1. 提取思维链
 	cotTrace := extractCoTTrace(aiResponse)
 
@@ -526,7 +595,7 @@ func parseFullDecisionResponse(aiResponse string, accountEquity float64, btcEthL
 	}
 
 	// 3. 验证决策
-	if err := validateDecisions(decisions, accountEquity, btcEthLeverage, altcoinLeverage); err != nil {
+	if err := validateDecisions(decisions, accountEquity, btcEthLeverage, altcoinLeverage, caps); err != nil {
 		return &FullDecision{
 			CoTTrace:  cotTrace,
 			Decisions: decisions,
@@ -598,10 +667,10 @@ func fixMissingQuotes(jsonStr string) string {
 	return jsonStr
 }
 
-// validateDecisions 验证所有决策（需要账户信息和杠杆配置）
-func validateDecisions(decisions []Decision, accountEquity float64, btcEthLeverage, altcoinLeverage int) error {
+// validateDecisions 验证所有决策（需要账户信息、杠杆配置和交易所支持的功能）
+func validateDecisions(decisions []Decision, accountEquity float64, btcEthLeverage, altcoinLeverage int, caps Capabilities) error {
 	for i, decision := range decisions {
-		if err := validateDecision(&decision, accountEquity, btcEthLeverage, altcoinLeverage); err != nil {
+		if err := validateDecision(&decision, accountEquity, btcEthLeverage, altcoinLeverage, caps); err != nil {
 			return fmt.Errorf("决策 #%d 验证失败: %w", i+1, err)
 		}
 	}
@@ -630,8 +699,16 @@ func findMatchingBracket(s string, start int) int {
 	return -1
 }
 
+// MaxPositionValue 单币种仓位价值上限：BTC/ETH为10倍账户净值，山寨币为5倍账户净值
+func MaxPositionValue(symbol string, accountEquity float64) float64 {
+	if symbol == "BTCUSDT" || symbol == "ETHUSDT" {
+		return accountEquity * 10
+	}
+	return accountEquity * 5
+}
+
 // validateDecision 验证单个决策的有效性
-func validateDecision(d *Decision, accountEquity float64, btcEthLeverage, altcoinLeverage int) error {
+func validateDecision(d *Decision, accountEquity float64, btcEthLeverage, altcoinLeverage int, caps Capabilities) error {
 	// 验证action
 	validActions := map[string]bool{
 		"open_long":          true,
@@ -645,6 +722,7 @@ func validateDecision(d *Decision, accountEquity float64, btcEthLeverage, altcoi
 		"hold":               true,
 		"wait":               true,
 		"update_loss_profit": true,
+		"set_trailing_stop":  true,
 	}
 
 	if !validActions[d.Action] {
@@ -654,12 +732,11 @@ func validateDecision(d *Decision, accountEquity float64, btcEthLeverage, altcoi
 	// 开仓和加仓操作必须提供完整参数
 	if d.Action == "open_long" || d.Action == "open_short" || d.Action == "increase_long" || d.Action == "increase_short" {
 		// 根据币种使用配置的杠杆上限
-		maxLeverage := altcoinLeverage        // 山寨币使用配置的杠杆
-		maxPositionValue := accountEquity * 5 // 山寨币最多1.5倍账户净值
+		maxLeverage := altcoinLeverage // 山寨币使用配置的杠杆
 		if d.Symbol == "BTCUSDT" || d.Symbol == "ETHUSDT" {
-			maxLeverage = btcEthLeverage          // BTC和ETH使用配置的杠杆
-			maxPositionValue = accountEquity * 10 // BTC/ETH最多10倍账户净值
+			maxLeverage = btcEthLeverage // BTC和ETH使用配置的杠杆
 		}
+		maxPositionValue := MaxPositionValue(d.Symbol, accountEquity)
 
 		if d.Leverage <= 0 || d.Leverage > maxLeverage {
 			return fmt.Errorf("杠杆必须在1-%d之间（%s，当前配置上限%d倍）: %d", maxLeverage, d.Symbol, maxLeverage, d.Leverage)
@@ -667,6 +744,9 @@ func validateDecision(d *Decision, accountEquity float64, btcEthLeverage, altcoi
 		if d.PositionSizeUSD <= 0 {
 			return fmt.Errorf("仓位大小必须大于0: %.2f", d.PositionSizeUSD)
 		}
+		if d.PositionSizeUSD < caps.MinNotional {
+			return fmt.Errorf("仓位价值(%.2f)低于交易所最小下单名义价值(%.0f USDT)", d.PositionSizeUSD, caps.MinNotional)
+		}
 		// 验证仓位价值上限（加1%容差以避免浮点数精度问题）
 		tolerance := maxPositionValue * 0.01 // 1%容差
 		if d.PositionSizeUSD > maxPositionValue+tolerance {
@@ -740,16 +820,35 @@ func validateDecision(d *Decision, accountEquity float64, btcEthLeverage, altcoi
 		}
 	}
 
-	// update_loss_profit 操作必须提供止损和止盈价格
+	// update_loss_profit 操作必须提供止损和止盈价格（交易所能单独撤销止损/止盈单时可以只更新一项）
 	if d.Action == "update_loss_profit" {
-		if d.StopLoss <= 0 || d.TakeProfit <= 0 {
-			return fmt.Errorf("更新止盈止损时，止损和止盈价格必须大于0")
+		if d.StopLoss < 0 || d.TakeProfit < 0 || (d.StopLoss == 0 && d.TakeProfit == 0) {
+			return fmt.Errorf("更新止盈止损时，止损或止盈价格必须大于0")
+		}
+		if (d.StopLoss == 0 || d.TakeProfit == 0) && !caps.SeparateSLTPCancel {
+			return fmt.Errorf("该交易所无法单独撤销止损或止盈单，更新时止损和止盈价格都必须大于0")
 		}
 		if strings.TrimSpace(d.Reasoning) == "" {
 			return fmt.Errorf("更新止盈止损时必须提供reasoning说明原因")
 		}
 	}
 
+	// set_trailing_stop 操作需要交易所支持追踪止损，回调比例在各交易所都支持的范围内
+	if d.Action == "set_trailing_stop" {
+		if !caps.TrailingStop {
+			return fmt.Errorf("该交易所不支持追踪止损 (set_trailing_stop)")
+		}
+		if d.CallbackRate < MinTrailingCallbackRate || d.CallbackRate > MaxTrailingCallbackRate {
+			return fmt.Errorf("追踪止损回调比例必须在%.1f%%-%.0f%%之间: %.2f", MinTrailingCallbackRate, MaxTrailingCallbackRate, d.CallbackRate)
+		}
+		if d.ActivationPrice < 0 {
+			return fmt.Errorf("追踪止损激活价不能为负数: %.4f", d.ActivationPrice)
+		}
+		if strings.TrimSpace(d.Reasoning) == "" {
+			return fmt.Errorf("设置追踪止损时必须提供reasoning说明原因")
+		}
+	}
+
 	return nil
 }
 
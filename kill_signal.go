@@ -0,0 +1,14 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// notifyKillSignal 收到SIGUSR1时触发一键清仓（kill -USR1 <pid>）
+func notifyKillSignal(c chan<- os.Signal) {
+	signal.Notify(c, syscall.SIGUSR1)
+}
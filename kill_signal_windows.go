@@ -0,0 +1,6 @@
+package main
+
+import "os"
+
+// notifyKillSignal Windows没有SIGUSR1，只能通过API触发一键清仓
+func notifyKillSignal(c chan<- os.Signal) {}
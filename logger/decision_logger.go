@@ -7,23 +7,45 @@ import (
 	"math"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
 // DecisionRecord 决策记录
 type DecisionRecord struct {
-	Timestamp      time.Time          `json:"timestamp"`       // 决策时间
-	CycleNumber    int                `json:"cycle_number"`    // 周期编号
-	InputPrompt    string             `json:"input_prompt"`    // 发送给AI的输入prompt
-	CoTTrace       string             `json:"cot_trace"`       // AI思维链（输出）
-	DecisionJSON   string             `json:"decision_json"`   // 决策JSON
-	AccountState   AccountSnapshot    `json:"account_state"`   // 账户状态快照
-	Positions      []PositionSnapshot `json:"positions"`       // 持仓快照
-	CandidateCoins []string           `json:"candidate_coins"` // 候选币种列表
-	Decisions      []DecisionAction   `json:"decisions"`       // 执行的决策
-	ExecutionLog   []string           `json:"execution_log"`   // 执行日志
-	Success        bool               `json:"success"`         // 是否成功
-	ErrorMessage   string             `json:"error_message"`   // 错误信息（如果有）
+	Timestamp      time.Time          `json:"timestamp"`          // 决策时间
+	CycleNumber    int                `json:"cycle_number"`       // 周期编号
+	InputPrompt    string             `json:"input_prompt"`       // 发送给AI的输入prompt
+	CoTTrace       string             `json:"cot_trace"`          // AI思维链（输出）
+	DecisionJSON   string             `json:"decision_json"`      // 决策JSON
+	AccountState   AccountSnapshot    `json:"account_state"`      // 账户状态快照
+	Positions      []PositionSnapshot `json:"positions"`          // 持仓快照
+	CandidateCoins []string           `json:"candidate_coins"`    // 候选币种列表
+	Decisions      []DecisionAction   `json:"decisions"`          // 执行的决策
+	ExecutionLog   []string           `json:"execution_log"`      // 执行日志
+	Success        bool               `json:"success"`            // 是否成功
+	ErrorMessage   string             `json:"error_message"`      // 错误信息（如果有）
+	Realtime       bool               `json:"realtime,omitempty"` // 不是AI决策周期生成的记录（交易所实时推送的止损止盈触发、孤儿挂单清理等）
+
+	CircuitBreaker *CircuitBreakerSnapshot `json:"circuit_breaker,omitempty"` // 本周期的熔断状态
+}
+
+// CircuitBreakerSnapshot 熔断状态快照（日亏损和最大回撤）
+type CircuitBreakerSnapshot struct {
+	Equity          float64   `json:"equity"`             // 当前净值
+	DayStartEquity  float64   `json:"day_start_equity"`   // 当日（UTC）开始时的净值
+	DailyPnL        float64   `json:"daily_pnl"`          // 当日盈亏（已实现+未实现，含手续费和资金费）
+	DailyPnLPct     float64   `json:"daily_pnl_pct"`      // 当日盈亏百分比
+	PeakEquity      float64   `json:"peak_equity"`        // 净值峰值
+	DrawdownPct     float64   `json:"drawdown_pct"`       // 相对净值峰值的回撤百分比
+	MaxDailyLossPct float64   `json:"max_daily_loss_pct"` // 日亏损上限（0表示不限制）
+	MaxDrawdownPct  float64   `json:"max_drawdown_pct"`   // 回撤上限（0表示不限制）
+	Tripped         bool      `json:"tripped"`            // 是否处于熔断中（暂停开仓和加仓）
+	Reason          string    `json:"reason,omitempty"`   // 最近一次触发的原因
+	TrippedAt       time.Time `json:"tripped_at"`         // 最近一次触发的时间
+	StopUntil       time.Time `json:"stop_until"`         // 熔断结束时间
 }
 
 // AccountSnapshot 账户状态快照
@@ -45,25 +67,56 @@ type PositionSnapshot struct {
 	UnrealizedProfit float64 `json:"unrealized_profit"`
 	Leverage         float64 `json:"leverage"`
 	LiquidationPrice float64 `json:"liquidation_price"`
+	Funding          float64 `json:"funding,omitempty"` // 持仓期间累计资金费（正数为收到，负数为支付）
 }
 
 // DecisionAction 决策动作
 type DecisionAction struct {
-	Action    string    `json:"action"`    // open_long, open_short, close_long, close_short
-	Symbol    string    `json:"symbol"`    // 币种
-	Quantity  float64   `json:"quantity"`  // 数量
-	Leverage  int       `json:"leverage"`  // 杠杆（开仓时）
-	Price     float64   `json:"price"`     // 执行价格
-	OrderID   int64     `json:"order_id"`  // 订单ID
-	Timestamp time.Time `json:"timestamp"` // 执行时间
-	Success   bool      `json:"success"`   // 是否成功
-	Error     string    `json:"error"`     // 错误信息
+	Action          string    `json:"action"`                      // open_long, open_short, close_long, close_short
+	Symbol          string    `json:"symbol"`                      // 币种
+	Quantity        float64   `json:"quantity"`                    // 数量
+	Leverage        int       `json:"leverage"`                    // 杠杆（开仓时）
+	Price           float64   `json:"price"`                       // 执行价格（有成交时为成交均价）
+	OrderID         int64     `json:"order_id"`                    // 订单ID
+	ClientOrderID   string    `json:"client_order_id,omitempty"`   // 客户端订单ID（编码交易器、周期和决策序号，用于追溯订单和成交）
+	Fee             float64   `json:"fee"`                         // 手续费（正数表示支付）
+	FeeAsset        string    `json:"fee_asset"`                   // 手续费币种
+	Pending         bool      `json:"pending"`                     // 限价单已挂出但尚未成交（成交后另行记录）
+	Margin          float64   `json:"margin,omitempty"`            // 追加的逐仓保证金（add_margin时）
+	ProposedSizeUSD float64   `json:"proposed_size_usd,omitempty"` // AI给出的仓位价值（开仓时）
+	SizeUSD         float64   `json:"size_usd,omitempty"`          // 实际下单的仓位价值（按风险计算仓位时与AI给出的不同）
+	RiskUSD         float64   `json:"risk_usd,omitempty"`          // 按风险计算仓位时，止损触发的预计亏损
+	SlippageBps     float64   `json:"slippage_bps,omitempty"`      // 按订单簿估算的市价单滑点（基点）
+	Timestamp       time.Time `json:"timestamp"`                   // 执行时间
+	Success         bool      `json:"success"`                     // 是否成功
+	Error           string    `json:"error"`                       // 错误信息
+
+	// 拆单执行（TWAP/冰山单）：Quantity、Price和Fee为所有子订单的累计成交，OrderID为最后一笔子订单
+	ExecAlgo          string  `json:"exec_algo,omitempty"`          // 拆单算法（twap或iceberg，为空表示单笔下单）
+	ExecSlices        int     `json:"exec_slices,omitempty"`        // 计划的子订单数
+	ExecFilledSlices  int     `json:"exec_filled_slices,omitempty"` // 已成交的子订单数（小于计划数表示中途失败，只成交了一部分）
+	RequestedQuantity float64 `json:"requested_quantity,omitempty"` // 拆单前的总数量
+	ChildOrderIDs     []int64 `json:"child_order_ids,omitempty"`    // 子订单ID
+
+	// 以FeeAsset以外的币种支付的手续费（币种 -> 金额，如部分成交用BNB抵扣），不计入Fee
+	OtherFees map[string]float64 `json:"other_fees,omitempty"`
+}
+
+// QuoteFee 以USDT计价的手续费（其他币种支付的手续费无法换算，返回0）
+func (a *DecisionAction) QuoteFee() float64 {
+	switch a.FeeAsset {
+	case "", "USDT", "USDC", "USD":
+		return a.Fee
+	default:
+		return 0
+	}
 }
 
 // DecisionLogger 决策日志记录器
 type DecisionLogger struct {
 	logDir      string
 	cycleNumber int
+	mu          sync.Mutex // 决策周期和实时推送可能并发写入
 }
 
 // NewDecisionLogger 创建决策日志记录器
@@ -79,12 +132,49 @@ func NewDecisionLogger(logDir string) *DecisionLogger {
 
 	return &DecisionLogger{
 		logDir:      logDir,
-		cycleNumber: 0,
+		cycleNumber: lastCycleNumber(logDir),
+	}
+}
+
+// lastCycleNumber 目录中已有决策记录的最大周期编号（重启后周期编号接着递增）
+func lastCycleNumber(logDir string) int {
+	files, err := filepath.Glob(filepath.Join(logDir, "decision_*_cycle*.json"))
+	if err != nil {
+		return 0
+	}
+
+	last := 0
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), ".json")
+		n, err := strconv.Atoi(name[strings.LastIndex(name, "_cycle")+len("_cycle"):])
+		if err == nil && n > last {
+			last = n
+		}
+	}
+	return last
+}
+
+// CycleNumber 最近一条决策记录的周期编号
+func (l *DecisionLogger) CycleNumber() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.cycleNumber
+}
+
+// ResumeCycleNumber 从保存的状态恢复周期编号（旧记录已被清理时），只会增大不会回退
+func (l *DecisionLogger) ResumeCycleNumber(n int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if n > l.cycleNumber {
+		l.cycleNumber = n
 	}
 }
 
 // LogDecision 记录决策
 func (l *DecisionLogger) LogDecision(record *DecisionRecord) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
 	l.cycleNumber++
 	record.CycleNumber = l.cycleNumber
 	record.Timestamp = time.Now()
@@ -277,7 +367,9 @@ type TradeOutcome struct {
 	ClosePrice    float64   `json:"close_price"`    // 平仓价
 	PositionValue float64   `json:"position_value"` // 仓位价值（quantity × openPrice）
 	MarginUsed    float64   `json:"margin_used"`    // 保证金使用（positionValue / leverage）
-	PnL           float64   `json:"pn_l"`           // 盈亏（USDT）
+	Fees          float64   `json:"fees"`           // 开平仓手续费（USDT）
+	Funding       float64   `json:"funding"`        // 持仓期间累计资金费（USDT，正数为收到）
+	PnL           float64   `json:"pn_l"`           // 盈亏（USDT，已扣除手续费、计入资金费）
 	PnLPct        float64   `json:"pn_l_pct"`       // 盈亏百分比（相对保证金）
 	Duration      string    `json:"duration"`       // 持仓时长
 	OpenTime      time.Time `json:"open_time"`      // 开仓时间
@@ -296,7 +388,9 @@ type PerformanceAnalysis struct {
 	AvgLoss         float64                       `json:"avg_loss"`          // 平均亏损（USDT）
 	ProfitFactor    float64                       `json:"profit_factor"`     // 盈亏比（总盈利/总亏损）
 	SharpeRatio     float64                       `json:"sharpe_ratio"`      // 夏普比率（风险调整后收益）
-	TotalPnL        float64                       `json:"total_pnl"`         // 总盈亏（USDT）
+	TotalPnL        float64                       `json:"total_pnl"`         // 总盈亏（USDT，已扣除手续费、计入资金费）
+	TotalFees       float64                       `json:"total_fees"`        // 总手续费（USDT）
+	TotalFunding    float64                       `json:"total_funding"`     // 总资金费（USDT，正数为收到）
 	RecentTrades    []TradeOutcome                `json:"recent_trades"`     // 最近N笔交易
 	SymbolStats     map[string]*SymbolPerformance `json:"symbol_stats"`      // 各币种表现
 	BestSymbol      string                        `json:"best_symbol"`       // 表现最好的币种
@@ -343,7 +437,7 @@ func (l *DecisionLogger) AnalyzePerformance(lookbackCycles int) (*PerformanceAna
 		// 先从扩大的窗口中收集所有开仓记录
 		for _, record := range allRecords {
 			for _, action := range record.Decisions {
-				if !action.Success {
+				if !action.Success || action.Pending {
 					continue
 				}
 
@@ -365,6 +459,7 @@ func (l *DecisionLogger) AnalyzePerformance(lookbackCycles int) (*PerformanceAna
 						"openTime":  action.Timestamp,
 						"quantity":  action.Quantity,
 						"leverage":  action.Leverage,
+						"fee":       action.QuoteFee(),
 					}
 				case "close_long", "close_short":
 					// 移除已平仓记录
@@ -374,10 +469,17 @@ func (l *DecisionLogger) AnalyzePerformance(lookbackCycles int) (*PerformanceAna
 		}
 	}
 
+	// 持仓累计资金费：symbol_side -> 最近一次快照中的资金费
+	positionFunding := make(map[string]float64)
+
 	// 遍历分析窗口内的记录，生成交易结果
 	for _, record := range records {
+		for _, pos := range record.Positions {
+			positionFunding[pos.Symbol+"_"+pos.Side] = pos.Funding
+		}
+
 		for _, action := range record.Decisions {
-			if !action.Success {
+			if !action.Success || action.Pending {
 				continue
 			}
 
@@ -393,12 +495,14 @@ func (l *DecisionLogger) AnalyzePerformance(lookbackCycles int) (*PerformanceAna
 			switch action.Action {
 			case "open_long", "open_short":
 				// 更新开仓记录（可能已经在预填充时记录过了）
+				delete(positionFunding, posKey)
 				openPositions[posKey] = map[string]interface{}{
 					"side":      side,
 					"openPrice": action.Price,
 					"openTime":  action.Timestamp,
 					"quantity":  action.Quantity,
 					"leverage":  action.Leverage,
+					"fee":       action.QuoteFee(),
 				}
 
 			case "close_long", "close_short":
@@ -420,6 +524,14 @@ func (l *DecisionLogger) AnalyzePerformance(lookbackCycles int) (*PerformanceAna
 						pnl = quantity * (openPrice - action.Price)
 					}
 
+					// 扣除开平仓手续费
+					fees := openPos["fee"].(float64) + action.QuoteFee()
+					pnl -= fees
+
+					// 计入持仓期间的资金费
+					funding := positionFunding[posKey]
+					pnl += funding
+
 					// 计算盈亏百分比（相对保证金）
 					positionValue := quantity * openPrice
 					marginUsed := positionValue / float64(leverage)
@@ -438,6 +550,8 @@ func (l *DecisionLogger) AnalyzePerformance(lookbackCycles int) (*PerformanceAna
 						ClosePrice:    action.Price,
 						PositionValue: positionValue,
 						MarginUsed:    marginUsed,
+						Fees:          fees,
+						Funding:       funding,
 						PnL:           pnl,
 						PnLPct:        pnlPct,
 						Duration:      action.Timestamp.Sub(openTime).String(),
@@ -447,6 +561,8 @@ func (l *DecisionLogger) AnalyzePerformance(lookbackCycles int) (*PerformanceAna
 
 					analysis.RecentTrades = append(analysis.RecentTrades, outcome)
 					analysis.TotalTrades++
+					analysis.TotalFees += fees
+					analysis.TotalFunding += funding
 
 					// 分类交易：盈利、亏损、持平
 					if pnl > 0 {
@@ -479,6 +595,7 @@ func (l *DecisionLogger) AnalyzePerformance(lookbackCycles int) (*PerformanceAna
 
 					// 移除已平仓记录
 					delete(openPositions, posKey)
+					delete(positionFunding, posKey)
 				}
 			}
 		}
@@ -75,6 +75,7 @@ func main() {
 			cfg.MaxDailyLoss,
 			cfg.MaxDrawdown,
 			cfg.StopTradingMinutes,
+			cfg.FlattenOnBreaker,
 			cfg.Leverage, // 传递杠杆配置
 		)
 		if err != nil {
@@ -113,7 +114,10 @@ func main() {
 	fmt.Println()
 
 	// 创建并启动API服务器
-	apiServer := api.NewServer(traderManager, cfg.APIServerPort)
+	apiServer := api.NewServer(traderManager, cfg.APIServerPort, cfg.APIToken)
+	if cfg.APIToken == "" {
+		log.Printf("⚠️  未配置api_token，一键清仓接口已禁用（仍可通过 kill -USR1 %d 触发）", os.Getpid())
+	}
 	go func() {
 		if err := apiServer.Start(); err != nil {
 			log.Printf("❌ API服务器错误: %v", err)
@@ -127,6 +131,15 @@ func main() {
 	// 启动所有trader
 	traderManager.StartAll()
 
+	// 一键清仓信号：停止所有trader，撤单并平掉全部持仓（进程继续运行，API仍可查询）
+	killChan := make(chan os.Signal, 1)
+	notifyKillSignal(killChan)
+	go func() {
+		for sig := range killChan {
+			traderManager.KillAll("signal "+sig.String(), "收到"+sig.String()+"信号")
+		}
+	}()
+
 	// 等待退出信号
 	<-sigChan
 	fmt.Println()
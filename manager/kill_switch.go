@@ -0,0 +1,105 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"nofx/trader"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// killSwitchAuditDir 一键清仓审计记录的目录（每次触发一个文件）
+const killSwitchAuditDir = "decision_logs/kill_switch"
+
+// KillSwitchReport 一键清仓的审计记录
+type KillSwitchReport struct {
+	TriggeredAt time.Time              `json:"triggered_at"`
+	CompletedAt time.Time              `json:"completed_at"`
+	Source      string                 `json:"source"` // 触发来源（API请求的客户端地址或信号）
+	Reason      string                 `json:"reason"`
+	Traders     []string               `json:"traders"` // 已停止的trader ID
+	Results     []trader.FlattenResult `json:"results"` // 每个币种每项操作（撤单、平仓）的结果
+	Failed      int                    `json:"failed"`  // 失败的操作数（需要人工处理）
+	Success     bool                   `json:"success"`
+	AuditFile   string                 `json:"audit_file,omitempty"`
+}
+
+// KillAll 一键清仓：停止所有交易机器人和仓位管理器，撤销所有挂单并市价平掉所有账户的全部持仓
+// 各trader并行处理，结果写入各自的决策日志和审计文件（decision_logs/kill_switch）
+// 只处理已加载的trader（未启用的trader对应的账户不在其中）；触发后不再执行决策，重启进程后恢复
+func (tm *TraderManager) KillAll(source, reason string) *KillSwitchReport {
+	tm.killMu.Lock()
+	defer tm.killMu.Unlock()
+
+	report := &KillSwitchReport{TriggeredAt: time.Now(), Source: source, Reason: reason}
+	log.Printf("🛑🛑🛑 触发一键清仓 (来源: %s, 原因: %s)", source, reason)
+
+	type killer interface {
+		GetID() string
+		Kill(reason string) []trader.FlattenResult
+	}
+	tm.mu.RLock()
+	killers := make([]killer, 0, len(tm.autoTraders)+len(tm.positionManagers))
+	for _, at := range tm.autoTraders {
+		killers = append(killers, at)
+	}
+	for _, pm := range tm.positionManagers {
+		killers = append(killers, pm)
+	}
+	tm.mu.RUnlock()
+
+	var wg sync.WaitGroup
+	results := make([][]trader.FlattenResult, len(killers))
+	for i, k := range killers {
+		report.Traders = append(report.Traders, k.GetID())
+		wg.Add(1)
+		go func(i int, k killer) {
+			defer wg.Done()
+			results[i] = k.Kill(reason)
+		}(i, k)
+	}
+	wg.Wait()
+
+	for _, r := range results {
+		report.Results = append(report.Results, r...)
+	}
+	for _, result := range report.Results {
+		if !result.Success {
+			report.Failed++
+		}
+	}
+	report.Success = report.Failed == 0
+	report.CompletedAt = time.Now()
+
+	if path, err := saveKillSwitchReport(report); err != nil {
+		log.Printf("⚠️ 保存一键清仓审计记录失败: %v", err)
+	} else {
+		report.AuditFile = path
+	}
+	if report.Success {
+		log.Printf("🛑 一键清仓完成: %d个trader，%d项操作全部成功 (审计记录: %s)", len(report.Traders), len(report.Results), report.AuditFile)
+	} else {
+		log.Printf("❌ 一键清仓完成: %d个trader，%d/%d项操作失败，请人工检查 (审计记录: %s)",
+			len(report.Traders), report.Failed, len(report.Results), report.AuditFile)
+	}
+	return report
+}
+
+// saveKillSwitchReport 保存审计记录，返回文件路径
+func saveKillSwitchReport(report *KillSwitchReport) (string, error) {
+	if err := os.MkdirAll(killSwitchAuditDir, 0755); err != nil {
+		return "", fmt.Errorf("创建审计目录失败: %w", err)
+	}
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("序列化审计记录失败: %w", err)
+	}
+	path := filepath.Join(killSwitchAuditDir, fmt.Sprintf("kill_%s.json", report.TriggeredAt.Format("20060102_150405.000")))
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return "", fmt.Errorf("写入审计记录失败: %w", err)
+	}
+	return path, nil
+}
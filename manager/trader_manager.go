@@ -14,6 +14,7 @@ type TraderManager struct {
 	autoTraders      map[string]*trader.AutoTrader      // key: trader ID (mode=tm)
 	positionManagers map[string]*trader.PositionManager // key: trader ID (mode=pm)
 	mu               sync.RWMutex
+	killMu           sync.Mutex // 一键清仓同一时间只执行一次
 }
 
 // NewTraderManager 创建trader管理器
@@ -24,8 +25,19 @@ func NewTraderManager() *TraderManager {
 	}
 }
 
+// executionConfig 拆单执行配置
+func executionConfig(cfg config.TraderConfig) trader.ExecutionConfig {
+	return trader.ExecutionConfig{
+		Algo:         cfg.ExecutionAlgo,
+		ThresholdUSD: cfg.ExecutionThresholdUSD,
+		Slices:       cfg.TWAPSlices,
+		Interval:     time.Duration(cfg.ExecutionIntervalSeconds) * time.Second,
+		SliceUSD:     cfg.IcebergSliceUSD,
+	}
+}
+
 // AddTrader 添加一个trader（根据mode创建AutoTrader或PositionManager）
-func (tm *TraderManager) AddTrader(cfg config.TraderConfig, coinPoolURL string, maxDailyLoss, maxDrawdown float64, stopTradingMinutes int, leverage config.LeverageConfig) error {
+func (tm *TraderManager) AddTrader(cfg config.TraderConfig, coinPoolURL string, maxDailyLoss, maxDrawdown float64, stopTradingMinutes int, flattenOnBreaker bool, leverage config.LeverageConfig) error {
 	tm.mu.Lock()
 	defer tm.mu.Unlock()
 
@@ -59,6 +71,21 @@ func (tm *TraderManager) AddTrader(cfg config.TraderConfig, coinPoolURL string,
 			AsterUser:             cfg.AsterUser,
 			AsterSigner:           cfg.AsterSigner,
 			AsterPrivateKey:       cfg.AsterPrivateKey,
+			BybitAPIKey:           cfg.BybitAPIKey,
+			BybitSecretKey:        cfg.BybitSecretKey,
+			BybitTestnet:          cfg.BybitTestnet,
+			OKXAPIKey:             cfg.OKXAPIKey,
+			OKXSecretKey:          cfg.OKXSecretKey,
+			OKXPassphrase:         cfg.OKXPassphrase,
+			PaperSlippageBps:      cfg.PaperSlippageBps,
+			PaperFeeRate:          cfg.PaperFeeRate,
+			MarginMode:            cfg.MarginMode,
+			PositionMode:          cfg.PositionMode,
+			Execution:             executionConfig(cfg),
+			MaxDailyLoss:          maxDailyLoss,
+			MaxDrawdown:           maxDrawdown,
+			StopTradingTime:       time.Duration(stopTradingMinutes) * time.Minute,
+			FlattenOnBreaker:      flattenOnBreaker,
 			DeepSeekKey:           cfg.DeepSeekKey,
 			QwenKey:               cfg.QwenKey,
 			GeminiKey:             cfg.GeminiKey,
@@ -89,6 +116,24 @@ func (tm *TraderManager) AddTrader(cfg config.TraderConfig, coinPoolURL string,
 			AsterUser:             cfg.AsterUser,
 			AsterSigner:           cfg.AsterSigner,
 			AsterPrivateKey:       cfg.AsterPrivateKey,
+			BybitAPIKey:           cfg.BybitAPIKey,
+			BybitSecretKey:        cfg.BybitSecretKey,
+			BybitTestnet:          cfg.BybitTestnet,
+			OKXAPIKey:             cfg.OKXAPIKey,
+			OKXSecretKey:          cfg.OKXSecretKey,
+			OKXPassphrase:         cfg.OKXPassphrase,
+			PaperSlippageBps:      cfg.PaperSlippageBps,
+			PaperFeeRate:          cfg.PaperFeeRate,
+			MarginMode:            cfg.MarginMode,
+			PositionMode:          cfg.PositionMode,
+			EntryOrderType:        cfg.EntryOrderType,
+			EntryTimeInForce:      cfg.EntryTimeInForce,
+			EntryOrderMaxCycles:   cfg.EntryOrderMaxCycles,
+			PositionSizing:        cfg.PositionSizing,
+			RiskPerTradePct:       cfg.RiskPerTradePct,
+			MaxSlippageBps:        cfg.MaxSlippageBps,
+			SlippageAction:        cfg.SlippageAction,
+			Execution:             executionConfig(cfg),
 			CoinPoolAPIURL:        coinPoolURL,
 			UseQwen:               cfg.AIModel == "qwen",
 			DeepSeekKey:           cfg.DeepSeekKey,
@@ -106,6 +151,7 @@ func (tm *TraderManager) AddTrader(cfg config.TraderConfig, coinPoolURL string,
 			MaxDailyLoss:          maxDailyLoss,
 			MaxDrawdown:           maxDrawdown,
 			StopTradingTime:       time.Duration(stopTradingMinutes) * time.Minute,
+			FlattenOnBreaker:      flattenOnBreaker,
 		}
 
 		at, err := trader.NewAutoTrader(traderConfig)
@@ -113,6 +159,23 @@ func (tm *TraderManager) AddTrader(cfg config.TraderConfig, coinPoolURL string,
 			return fmt.Errorf("创建交易机器人失败: %w", err)
 		}
 
+		// 影子交易器：同一上下文请求其他AI，在虚拟账本上执行
+		for _, shadow := range cfg.Shadows {
+			shadowConfig := trader.ShadowConfig{
+				Name:            shadow.Name,
+				AIModel:         shadow.AIModel,
+				DeepSeekKey:     shadow.DeepSeekKey,
+				QwenKey:         shadow.QwenKey,
+				GeminiKey:       shadow.GeminiKey,
+				CustomAPIURL:    shadow.CustomAPIURL,
+				CustomAPIKey:    shadow.CustomAPIKey,
+				CustomModelName: shadow.CustomModelName,
+			}
+			if err := at.AttachShadow(shadowConfig); err != nil {
+				return err
+			}
+		}
+
 		tm.autoTraders[cfg.ID] = at
 		log.Printf("✓ 交易机器人 '%s' (%s) 已添加", cfg.Name, cfg.AIModel)
 	}
@@ -261,11 +324,11 @@ func (tm *TraderManager) GetComparisonData() (map[string]interface{}, error) {
 			"trader_name":     t.GetName(),
 			"trader_type":     "tm",
 			"ai_model":        t.GetAIModel(),
-			"total_equity":    account["total_equity"],
-			"total_pnl":       account["total_pnl"],
-			"total_pnl_pct":   account["total_pnl_pct"],
-			"position_count":  account["position_count"],
-			"margin_used_pct": account["margin_used_pct"],
+			"total_equity":    account.TotalEquity,
+			"total_pnl":       account.TotalPnL,
+			"total_pnl_pct":   account.TotalPnLPct,
+			"position_count":  account.PositionCount,
+			"margin_used_pct": account.MarginUsedPct,
 			"call_count":      status["call_count"],
 			"is_running":      status["is_running"],
 		})
@@ -291,3 +354,12 @@ func (tm *TraderManager) GetComparisonData() (map[string]interface{}, error) {
 
 	return comparison, nil
 }
+
+// GetShadowComparison 获取交易机器人与其影子交易器的盈亏对比
+func (tm *TraderManager) GetShadowComparison(id string, limit int) (*trader.ShadowComparison, error) {
+	at, err := tm.GetAutoTrader(id)
+	if err != nil {
+		return nil, err
+	}
+	return at.GetShadowComparison(limit)
+}
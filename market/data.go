@@ -1030,6 +1030,11 @@ func getOpenInterestData(symbol string) (*OIData, error) {
 	}, nil
 }
 
+// GetFundingRate 获取资金费率（Hyperliquid每小时费率，只请求资金费率不拉取K线）
+func GetFundingRate(symbol string) (float64, error) {
+	return getFundingRate(Normalize(symbol))
+}
+
 // getFundingRate 获取资金费率
 func getFundingRate(symbol string) (float64, error) {
 	coin := convertSymbolToHyperliquid(symbol)
@@ -36,6 +36,18 @@ type AsterTrader struct {
 	// 缓存交易对精度信息
 	symbolPrecision map[string]SymbolPrecision
 	mu              sync.RWMutex
+
+	// 保证金模式和持仓模式
+	tradingModes
+
+	// 客户端模拟的追踪止损
+	trailing *trailingStopEmulator
+
+	// 止损止盈联动单监控（一侧成交后撤销另一侧）
+	brackets *bracketMonitor
+
+	// 开平仓订单的客户端订单ID
+	clientOrderIDs
 }
 
 // SymbolPrecision 交易对精度信息
@@ -51,13 +63,22 @@ type SymbolPrecision struct {
 // signer: API钱包地址 (从 https://www.asterdex.com/en/api-wallet 获取)
 // privateKey: API钱包私钥 (从 https://www.asterdex.com/en/api-wallet 获取)
 func NewAsterTrader(user, signer, privateKeyHex string) (*AsterTrader, error) {
+	return NewAsterTraderWithBaseURL(user, signer, privateKeyHex, "")
+}
+
+// NewAsterTraderWithBaseURL 创建连接指定REST地址的Aster交易器（为空时使用默认地址，用于本地模拟服务）
+func NewAsterTraderWithBaseURL(user, signer, privateKeyHex, baseURL string) (*AsterTrader, error) {
+	if baseURL == "" {
+		baseURL = "https://fapi.asterdex.com"
+	}
+
 	// 解析私钥
 	privKey, err := crypto.HexToECDSA(strings.TrimPrefix(privateKeyHex, "0x"))
 	if err != nil {
 		return nil, fmt.Errorf("解析私钥失败: %w", err)
 	}
 
-	return &AsterTrader{
+	t := &AsterTrader{
 		ctx:             context.Background(),
 		user:            user,
 		signer:          signer,
@@ -65,14 +86,26 @@ func NewAsterTrader(user, signer, privateKeyHex string) (*AsterTrader, error) {
 		symbolPrecision: make(map[string]SymbolPrecision),
 		client: &http.Client{
 			Timeout: 30 * time.Second, // 增加到30秒
-			Transport: &http.Transport{
-				TLSHandshakeTimeout:   10 * time.Second,
-				ResponseHeaderTimeout: 10 * time.Second,
-				IdleConnTimeout:       90 * time.Second,
-			},
+			// 同一签名地址的所有交易器共享请求权重额度（Aster权重规则与币安一致）
+			// 签名带nonce，被限流时由request()重新签名重试
+			Transport: newRateLimitedTransport(
+				sharedRateLimiter("aster", signer, binanceWeightLimit),
+				binanceRequestWeight,
+				nil,
+				&http.Transport{
+					TLSHandshakeTimeout:   10 * time.Second,
+					ResponseHeaderTimeout: 10 * time.Second,
+					IdleConnTimeout:       90 * time.Second,
+				},
+			),
 		},
-		baseURL: "https://fapi.asterdex.com",
-	}, nil
+		baseURL: baseURL,
+		// 默认单向持仓，保证金模式沿用账户当前设置
+		tradingModes: tradingModes{positionMode: PositionModeOneWay},
+	}
+	t.trailing = newTrailingStopEmulator(t.GetMarketPrice, closePositionFunc(t))
+	t.brackets = newBracketMonitor(t)
+	return t, nil
 }
 
 // genNonce 生成微秒时间戳
@@ -323,7 +356,11 @@ func (t *AsterTrader) sign(params map[string]interface{}, nonce uint64) error {
 
 // request 发送HTTP请求（带重试机制）
 func (t *AsterTrader) request(method, endpoint string, params map[string]interface{}) ([]byte, error) {
-	const maxRetries = 3
+	maxRetries := 3
+	// 带客户端订单ID的下单由submitOrder按ID查询后决定是否重发，这里不能直接重发
+	if _, ok := params["newClientOrderId"]; ok {
+		maxRetries = 1
+	}
 	var lastErr error
 
 	for attempt := 1; attempt <= maxRetries; attempt++ {
@@ -346,10 +383,12 @@ func (t *AsterTrader) request(method, endpoint string, params map[string]interfa
 
 		lastErr = err
 
-		// 如果是网络超时或临时错误，重试
+		// 如果是网络超时、临时错误或被限流（限流器会暂停到Retry-After之后），重试
 		if strings.Contains(err.Error(), "timeout") ||
 			strings.Contains(err.Error(), "connection reset") ||
-			strings.Contains(err.Error(), "EOF") {
+			strings.Contains(err.Error(), "EOF") ||
+			strings.Contains(err.Error(), "HTTP 429") ||
+			strings.Contains(err.Error(), "HTTP 418") {
 			if attempt < maxRetries {
 				waitTime := time.Duration(attempt) * time.Second
 				time.Sleep(waitTime)
@@ -426,7 +465,7 @@ func (t *AsterTrader) doRequest(method, endpoint string, params map[string]inter
 }
 
 // GetBalance 获取账户余额
-func (t *AsterTrader) GetBalance() (map[string]interface{}, error) {
+func (t *AsterTrader) GetBalance() (*Balance, error) {
 	params := make(map[string]interface{})
 	body, err := t.request("GET", "/fapi/v3/balance", params)
 	if err != nil {
@@ -458,16 +497,15 @@ func (t *AsterTrader) GetBalance() (map[string]interface{}, error) {
 		}
 	}
 
-	// 返回与Binance相同的字段名，确保AutoTrader能正确解析
-	return map[string]interface{}{
-		"totalWalletBalance":    totalBalance,
-		"availableBalance":      availableBalance,
-		"totalUnrealizedProfit": crossUnPnl,
+	return &Balance{
+		TotalWalletBalance:    totalBalance,
+		AvailableBalance:      availableBalance,
+		TotalUnrealizedProfit: crossUnPnl,
 	}, nil
 }
 
 // GetPositions 获取持仓信息
-func (t *AsterTrader) GetPositions() ([]map[string]interface{}, error) {
+func (t *AsterTrader) GetPositions() ([]Position, error) {
 	params := make(map[string]interface{})
 	body, err := t.request("GET", "/fapi/v3/positionRisk", params)
 	if err != nil {
@@ -479,7 +517,7 @@ func (t *AsterTrader) GetPositions() ([]map[string]interface{}, error) {
 		return nil, err
 	}
 
-	result := []map[string]interface{}{}
+	result := []Position{}
 	for _, pos := range positions {
 		posAmtStr, ok := pos["positionAmt"].(string)
 		if !ok {
@@ -494,7 +532,7 @@ func (t *AsterTrader) GetPositions() ([]map[string]interface{}, error) {
 		entryPrice, _ := strconv.ParseFloat(pos["entryPrice"].(string), 64)
 		markPrice, _ := strconv.ParseFloat(pos["markPrice"].(string), 64)
 		unRealizedProfit, _ := strconv.ParseFloat(pos["unRealizedProfit"].(string), 64)
-		leverageVal, _ := strconv.ParseFloat(pos["leverage"].(string), 64)
+		leverageVal, _ := strconv.Atoi(pos["leverage"].(string))
 		liquidationPrice, _ := strconv.ParseFloat(pos["liquidationPrice"].(string), 64)
 
 		// 判断方向（与Binance一致）
@@ -504,16 +542,16 @@ func (t *AsterTrader) GetPositions() ([]map[string]interface{}, error) {
 			posAmt = -posAmt
 		}
 
-		// 返回与Binance相同的字段名
-		result = append(result, map[string]interface{}{
-			"symbol":           pos["symbol"],
-			"side":             side,
-			"positionAmt":      posAmt,
-			"entryPrice":       entryPrice,
-			"markPrice":        markPrice,
-			"unRealizedProfit": unRealizedProfit,
-			"leverage":         leverageVal,
-			"liquidationPrice": liquidationPrice,
+		symbol, _ := pos["symbol"].(string)
+		result = append(result, Position{
+			Symbol:           symbol,
+			Side:             side,
+			PositionAmt:      posAmt,
+			EntryPrice:       entryPrice,
+			MarkPrice:        markPrice,
+			UnRealizedProfit: unRealizedProfit,
+			Leverage:         leverageVal,
+			LiquidationPrice: liquidationPrice,
 		})
 	}
 
@@ -521,7 +559,7 @@ func (t *AsterTrader) GetPositions() ([]map[string]interface{}, error) {
 }
 
 // OpenLong 开多单
-func (t *AsterTrader) OpenLong(symbol string, quantity float64, leverage int) (map[string]interface{}, error) {
+func (t *AsterTrader) OpenLong(symbol string, quantity float64, leverage int) (*OrderResult, error) {
 	// 开仓前先取消所有挂单,防止残留挂单导致仓位叠加
 	if err := t.CancelAllOrders(symbol); err != nil {
 		log.Printf("  ⚠ 取消挂单失败(继续开仓): %v", err)
@@ -532,6 +570,11 @@ func (t *AsterTrader) OpenLong(symbol string, quantity float64, leverage int) (m
 		return nil, fmt.Errorf("设置杠杆失败: %w", err)
 	}
 
+	// 确保持仓模式和保证金模式
+	if err := t.ensureTradingModes(symbol); err != nil {
+		return nil, err
+	}
+
 	// 获取当前价格
 	price, err := t.GetMarketPrice(symbol)
 	if err != nil {
@@ -566,7 +609,7 @@ func (t *AsterTrader) OpenLong(symbol string, quantity float64, leverage int) (m
 
 	params := map[string]interface{}{
 		"symbol":       symbol,
-		"positionSide": "BOTH",
+		"positionSide": t.orderPositionSide("LONG"),
 		"type":         "LIMIT",
 		"side":         "BUY",
 		"timeInForce":  "GTC",
@@ -574,21 +617,17 @@ func (t *AsterTrader) OpenLong(symbol string, quantity float64, leverage int) (m
 		"price":        priceStr,
 	}
 
-	body, err := t.request("POST", "/fapi/v3/order", params)
+	result, err := t.placeOrder(params)
 	if err != nil {
 		return nil, err
 	}
-
-	var result map[string]interface{}
-	if err := json.Unmarshal(body, &result); err != nil {
-		return nil, err
-	}
+	t.withFills(result)
 
 	return result, nil
 }
 
 // OpenShort 开空单
-func (t *AsterTrader) OpenShort(symbol string, quantity float64, leverage int) (map[string]interface{}, error) {
+func (t *AsterTrader) OpenShort(symbol string, quantity float64, leverage int) (*OrderResult, error) {
 	// 开仓前先取消所有挂单,防止残留挂单导致仓位叠加
 	if err := t.CancelAllOrders(symbol); err != nil {
 		log.Printf("  ⚠ 取消挂单失败(继续开仓): %v", err)
@@ -599,6 +638,11 @@ func (t *AsterTrader) OpenShort(symbol string, quantity float64, leverage int) (
 		return nil, fmt.Errorf("设置杠杆失败: %w", err)
 	}
 
+	// 确保持仓模式和保证金模式
+	if err := t.ensureTradingModes(symbol); err != nil {
+		return nil, err
+	}
+
 	// 获取当前价格
 	price, err := t.GetMarketPrice(symbol)
 	if err != nil {
@@ -633,7 +677,7 @@ func (t *AsterTrader) OpenShort(symbol string, quantity float64, leverage int) (
 
 	params := map[string]interface{}{
 		"symbol":       symbol,
-		"positionSide": "BOTH",
+		"positionSide": t.orderPositionSide("SHORT"),
 		"type":         "LIMIT",
 		"side":         "SELL",
 		"timeInForce":  "GTC",
@@ -641,21 +685,132 @@ func (t *AsterTrader) OpenShort(symbol string, quantity float64, leverage int) (
 		"price":        priceStr,
 	}
 
-	body, err := t.request("POST", "/fapi/v3/order", params)
+	result, err := t.placeOrder(params)
 	if err != nil {
 		return nil, err
 	}
+	t.withFills(result)
 
-	var result map[string]interface{}
-	if err := json.Unmarshal(body, &result); err != nil {
+	return result, nil
+}
+
+// OpenLongLimit 限价开多
+func (t *AsterTrader) OpenLongLimit(symbol string, quantity, price float64, leverage int, tif TimeInForce) (*OrderResult, error) {
+	return t.openLimit(symbol, "BUY", quantity, price, leverage, tif)
+}
+
+// OpenShortLimit 限价开空
+func (t *AsterTrader) OpenShortLimit(symbol string, quantity, price float64, leverage int, tif TimeInForce) (*OrderResult, error) {
+	return t.openLimit(symbol, "SELL", quantity, price, leverage, tif)
+}
+
+// openLimit 下限价开仓单
+func (t *AsterTrader) openLimit(symbol, side string, quantity, price float64, leverage int, tif TimeInForce) (*OrderResult, error) {
+	// 开仓前先取消所有挂单,防止残留挂单导致仓位叠加
+	if err := t.CancelAllOrders(symbol); err != nil {
+		log.Printf("  ⚠ 取消挂单失败(继续开仓): %v", err)
+	}
+
+	// 先设置杠杆
+	if err := t.SetLeverage(symbol, leverage); err != nil {
+		return nil, fmt.Errorf("设置杠杆失败: %w", err)
+	}
+
+	// 确保持仓模式和保证金模式
+	if err := t.ensureTradingModes(symbol); err != nil {
+		return nil, err
+	}
+
+	// 格式化价格和数量到正确精度
+	formattedPrice, err := t.formatPrice(symbol, price)
+	if err != nil {
+		return nil, err
+	}
+	formattedQty, err := t.formatQuantity(symbol, quantity)
+	if err != nil {
+		return nil, err
+	}
+
+	prec, err := t.getPrecision(symbol)
+	if err != nil {
 		return nil, err
 	}
 
+	priceStr := t.formatFloatWithPrecision(formattedPrice, prec.PricePrecision)
+	qtyStr := t.formatFloatWithPrecision(formattedQty, prec.QuantityPrecision)
+
+	// 只做Maker对应GTX
+	timeInForce := string(tif)
+	if tif == TimeInForcePostOnly {
+		timeInForce = "GTX"
+	}
+
+	positionSide := "LONG"
+	if side == "SELL" {
+		positionSide = "SHORT"
+	}
+
+	params := map[string]interface{}{
+		"symbol":       symbol,
+		"positionSide": t.orderPositionSide(positionSide),
+		"type":         "LIMIT",
+		"side":         side,
+		"timeInForce":  timeInForce,
+		"quantity":     qtyStr,
+		"price":        priceStr,
+	}
+
+	result, err := t.placeOrder(params)
+	if err != nil {
+		return nil, fmt.Errorf("限价开仓失败: %w", err)
+	}
+	// 挂单中尚无成交时不查询成交明细
+	if result.ExecutedQty > 0 {
+		t.withFills(result)
+	}
+
+	log.Printf("✓ 限价开仓单已提交: %s %s 价格: %s 数量: %s (%s) 状态: %s", symbol, side, priceStr, qtyStr, tif, result.Status)
+
+	return result, nil
+}
+
+// GetOrder 查询订单状态
+func (t *AsterTrader) GetOrder(symbol string, orderID int64) (*OrderResult, error) {
+	params := map[string]interface{}{
+		"symbol":  symbol,
+		"orderId": orderID,
+	}
+
+	body, err := t.request("GET", "/fapi/v3/order", params)
+	if err != nil {
+		return nil, fmt.Errorf("查询订单失败: %w", err)
+	}
+
+	result, err := parseAsterOrderResult(body)
+	if err != nil {
+		return nil, err
+	}
+	t.withFills(result)
 	return result, nil
 }
 
+// CancelOrder 取消指定订单
+func (t *AsterTrader) CancelOrder(symbol string, orderID int64) error {
+	params := map[string]interface{}{
+		"symbol":  symbol,
+		"orderId": orderID,
+	}
+
+	if _, err := t.request("DELETE", "/fapi/v3/order", params); err != nil {
+		return fmt.Errorf("取消订单失败: %w", err)
+	}
+
+	log.Printf("  ✓ 已取消 %s 订单 %d", symbol, orderID)
+	return nil
+}
+
 // CloseLong 平多单
-func (t *AsterTrader) CloseLong(symbol string, quantity float64) (map[string]interface{}, error) {
+func (t *AsterTrader) CloseLong(symbol string, quantity float64) (*OrderResult, error) {
 	// 如果数量为0，获取当前持仓数量
 	if quantity == 0 {
 		positions, err := t.GetPositions()
@@ -664,8 +819,8 @@ func (t *AsterTrader) CloseLong(symbol string, quantity float64) (map[string]int
 		}
 
 		for _, pos := range positions {
-			if pos["symbol"] == symbol && pos["side"] == "long" {
-				quantity = pos["positionAmt"].(float64)
+			if pos.Symbol == symbol && pos.Side == "long" {
+				quantity = pos.PositionAmt
 				break
 			}
 		}
@@ -706,25 +861,20 @@ func (t *AsterTrader) CloseLong(symbol string, quantity float64) (map[string]int
 	log.Printf("  📏 精度处理: 价格 %.8f -> %s (精度=%d), 数量 %.8f -> %s (精度=%d)",
 		limitPrice, priceStr, prec.PricePrecision, quantity, qtyStr, prec.QuantityPrecision)
 
-	params := map[string]interface{}{
-		"symbol":       symbol,
-		"positionSide": "BOTH",
-		"type":         "LIMIT",
-		"side":         "SELL",
-		"timeInForce":  "GTC",
-		"quantity":     qtyStr,
-		"price":        priceStr,
-	}
+	params := t.closeOrderParams("LONG", map[string]interface{}{
+		"symbol":      symbol,
+		"type":        "LIMIT",
+		"side":        "SELL",
+		"timeInForce": "GTC",
+		"quantity":    qtyStr,
+		"price":       priceStr,
+	})
 
-	body, err := t.request("POST", "/fapi/v3/order", params)
+	result, err := t.placeOrder(params)
 	if err != nil {
 		return nil, err
 	}
-
-	var result map[string]interface{}
-	if err := json.Unmarshal(body, &result); err != nil {
-		return nil, err
-	}
+	t.withFills(result)
 
 	log.Printf("✓ 平多仓成功: %s 数量: %s", symbol, qtyStr)
 
@@ -737,7 +887,7 @@ func (t *AsterTrader) CloseLong(symbol string, quantity float64) (map[string]int
 }
 
 // CloseShort 平空单
-func (t *AsterTrader) CloseShort(symbol string, quantity float64) (map[string]interface{}, error) {
+func (t *AsterTrader) CloseShort(symbol string, quantity float64) (*OrderResult, error) {
 	// 如果数量为0，获取当前持仓数量
 	if quantity == 0 {
 		positions, err := t.GetPositions()
@@ -746,9 +896,9 @@ func (t *AsterTrader) CloseShort(symbol string, quantity float64) (map[string]in
 		}
 
 		for _, pos := range positions {
-			if pos["symbol"] == symbol && pos["side"] == "short" {
+			if pos.Symbol == symbol && pos.Side == "short" {
 				// Aster的GetPositions已经将空仓数量转换为正数，直接使用
-				quantity = pos["positionAmt"].(float64)
+				quantity = pos.PositionAmt
 				break
 			}
 		}
@@ -789,25 +939,20 @@ func (t *AsterTrader) CloseShort(symbol string, quantity float64) (map[string]in
 	log.Printf("  📏 精度处理: 价格 %.8f -> %s (精度=%d), 数量 %.8f -> %s (精度=%d)",
 		limitPrice, priceStr, prec.PricePrecision, quantity, qtyStr, prec.QuantityPrecision)
 
-	params := map[string]interface{}{
-		"symbol":       symbol,
-		"positionSide": "BOTH",
-		"type":         "LIMIT",
-		"side":         "BUY",
-		"timeInForce":  "GTC",
-		"quantity":     qtyStr,
-		"price":        priceStr,
-	}
+	params := t.closeOrderParams("SHORT", map[string]interface{}{
+		"symbol":      symbol,
+		"type":        "LIMIT",
+		"side":        "BUY",
+		"timeInForce": "GTC",
+		"quantity":    qtyStr,
+		"price":       priceStr,
+	})
 
-	body, err := t.request("POST", "/fapi/v3/order", params)
+	result, err := t.placeOrder(params)
 	if err != nil {
 		return nil, err
 	}
-
-	var result map[string]interface{}
-	if err := json.Unmarshal(body, &result); err != nil {
-		return nil, err
-	}
+	t.withFills(result)
 
 	log.Printf("✓ 平空仓成功: %s 数量: %s", symbol, qtyStr)
 
@@ -819,6 +964,96 @@ func (t *AsterTrader) CloseShort(symbol string, quantity float64) (map[string]in
 	return result, nil
 }
 
+// placeOrder 发送开平仓订单（附带客户端订单ID，结果不确定时先按ID查询再决定是否重新下单）
+func (t *AsterTrader) placeOrder(params map[string]interface{}) (*OrderResult, error) {
+	clientOrderID := t.nextClientOrderID().String()
+	if clientOrderID != "" {
+		params["newClientOrderId"] = clientOrderID
+	}
+	return submitOrder(clientOrderID, func() (*OrderResult, error) {
+		body, err := t.request("POST", "/fapi/v3/order", params)
+		if err != nil {
+			return nil, err
+		}
+		return parseAsterOrderResult(body)
+	}, func() (*OrderResult, error) {
+		body, err := t.request("GET", "/fapi/v3/order", map[string]interface{}{
+			"symbol":            params["symbol"],
+			"origClientOrderId": clientOrderID,
+		})
+		if err != nil {
+			if strings.Contains(err.Error(), "-2013") {
+				return nil, nil // 订单不存在
+			}
+			return nil, fmt.Errorf("查询订单失败: %w", err)
+		}
+		return parseAsterOrderResult(body)
+	})
+}
+
+// parseAsterOrderResult 解析下单响应
+func parseAsterOrderResult(body []byte) (*OrderResult, error) {
+	var resp struct {
+		OrderID       int64  `json:"orderId"`
+		Symbol        string `json:"symbol"`
+		Status        string `json:"status"`
+		AvgPrice      string `json:"avgPrice"`
+		ExecutedQty   string `json:"executedQty"`
+		ClientOrderID string `json:"clientOrderId"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("解析下单响应失败: %w", err)
+	}
+
+	avgPrice, _ := strconv.ParseFloat(resp.AvgPrice, 64)
+	executedQty, _ := strconv.ParseFloat(resp.ExecutedQty, 64)
+	return &OrderResult{
+		OrderID:       resp.OrderID,
+		Symbol:        resp.Symbol,
+		Status:        resp.Status,
+		AvgPrice:      avgPrice,
+		ExecutedQty:   executedQty,
+		ClientOrderID: resp.ClientOrderID,
+	}, nil
+}
+
+// withFills 查询订单的成交明细，补充成交均价、成交数量和手续费
+// 未成交或查询失败时保持不变
+func (t *AsterTrader) withFills(result *OrderResult) {
+	if result.OrderID == 0 {
+		return
+	}
+
+	body, err := t.request("GET", "/fapi/v3/userTrades", map[string]interface{}{
+		"symbol":  result.Symbol,
+		"orderId": result.OrderID,
+	})
+	if err != nil {
+		log.Printf("  ⚠ 查询订单成交明细失败: %v", err)
+		return
+	}
+
+	var trades []struct {
+		Price           string `json:"price"`
+		Qty             string `json:"qty"`
+		Commission      string `json:"commission"`
+		CommissionAsset string `json:"commissionAsset"`
+	}
+	if err := json.Unmarshal(body, &trades); err != nil {
+		log.Printf("  ⚠ 解析订单成交明细失败: %v", err)
+		return
+	}
+
+	fills := make([]orderFill, 0, len(trades))
+	for _, trade := range trades {
+		price, _ := strconv.ParseFloat(trade.Price, 64)
+		qty, _ := strconv.ParseFloat(trade.Qty, 64)
+		fee, _ := strconv.ParseFloat(trade.Commission, 64)
+		fills = append(fills, orderFill{Price: price, Quantity: qty, Fee: fee, FeeAsset: trade.CommissionAsset})
+	}
+	result.applyFills(fills)
+}
+
 // SetLeverage 设置杠杆倍数
 func (t *AsterTrader) SetLeverage(symbol string, leverage int) error {
 	params := map[string]interface{}{
@@ -830,6 +1065,131 @@ func (t *AsterTrader) SetLeverage(symbol string, leverage int) error {
 	return err
 }
 
+// SetMarginMode 设置保证金模式（symbol为空时设置默认模式，在之后每次开仓前生效）
+func (t *AsterTrader) SetMarginMode(symbol string, mode MarginMode) error {
+	if err := t.setMarginMode(symbol, mode); err != nil {
+		return err
+	}
+	if symbol == "" {
+		return nil
+	}
+	return t.ensureMarginMode(symbol, t.applyMarginMode)
+}
+
+// SetPositionMode 设置持仓模式（有持仓或挂单时交易所会拒绝切换）
+func (t *AsterTrader) SetPositionMode(mode PositionMode) error {
+	if err := t.setPositionMode(mode); err != nil {
+		return err
+	}
+	return t.ensurePositionMode(t.applyPositionMode)
+}
+
+// ensureTradingModes 开仓前确保持仓模式和该币种的保证金模式已生效
+func (t *AsterTrader) ensureTradingModes(symbol string) error {
+	if err := t.ensurePositionMode(t.applyPositionMode); err != nil {
+		return err
+	}
+	return t.ensureMarginMode(symbol, t.applyMarginMode)
+}
+
+// applyMarginMode 切换币种的保证金模式
+func (t *AsterTrader) applyMarginMode(symbol string, mode MarginMode) error {
+	marginType := "CROSSED"
+	if mode == MarginModeIsolated {
+		marginType = "ISOLATED"
+	}
+	_, err := t.request("POST", "/fapi/v3/marginType", map[string]interface{}{
+		"symbol":     symbol,
+		"marginType": marginType,
+	})
+	if err != nil && !strings.Contains(err.Error(), "No need to change") {
+		return fmt.Errorf("设置保证金模式失败: %w", err)
+	}
+	log.Printf("  ✓ %s 保证金模式: %s", symbol, marginType)
+	return nil
+}
+
+// applyPositionMode 切换持仓模式（已是目标模式时不发起切换）
+func (t *AsterTrader) applyPositionMode(mode PositionMode) error {
+	dualSide := mode == PositionModeHedge
+	body, err := t.request("GET", "/fapi/v3/positionSide/dual", map[string]interface{}{})
+	if err != nil {
+		return fmt.Errorf("查询持仓模式失败: %w", err)
+	}
+	var current struct {
+		DualSidePosition bool `json:"dualSidePosition"`
+	}
+	if err := json.Unmarshal(body, &current); err != nil {
+		return fmt.Errorf("解析持仓模式失败: %w", err)
+	}
+	if current.DualSidePosition == dualSide {
+		log.Printf("  ✓ 持仓模式已是 %s", mode)
+		return nil
+	}
+
+	_, err = t.request("POST", "/fapi/v3/positionSide/dual", map[string]interface{}{
+		"dualSidePosition": strconv.FormatBool(dualSide),
+	})
+	if err != nil && !strings.Contains(err.Error(), "No need to change") {
+		return fmt.Errorf("设置持仓模式失败: %w", err)
+	}
+	log.Printf("  ✓ 持仓模式已切换为 %s", mode)
+	return nil
+}
+
+// orderPositionSide 下单使用的positionSide（side为LONG/SHORT，单向持仓模式下为BOTH）
+func (t *AsterTrader) orderPositionSide(side string) string {
+	if t.hedgeMode() {
+		return side
+	}
+	return "BOTH"
+}
+
+// closeOrderParams 补充平仓单的positionSide（单向持仓模式下用reduceOnly防止反向开仓）
+func (t *AsterTrader) closeOrderParams(side string, params map[string]interface{}) map[string]interface{} {
+	params["positionSide"] = t.orderPositionSide(side)
+	if !t.hedgeMode() {
+		params["reduceOnly"] = "true"
+	}
+	return params
+}
+
+// Capabilities Aster支持的功能（接口与币安兼容，但挂单无法区分止损和止盈；追踪止损由客户端模拟）
+func (t *AsterTrader) Capabilities() Capabilities {
+	return Capabilities{
+		TrailingStop: true,
+		ReduceOnly:   true,
+		HedgeMode:    true,
+		LimitOrders:  true,
+		AdjustMargin: true,
+		MinNotional:  5,
+	}
+}
+
+// AdjustIsolatedMargin 调整逐仓仓位保证金（amount>0追加，amount<0减少）
+func (t *AsterTrader) AdjustIsolatedMargin(symbol string, positionSide string, amount float64) error {
+	if amount == 0 {
+		return fmt.Errorf("保证金调整金额不能为0")
+	}
+	actionType := 1
+	if amount < 0 {
+		actionType = 2
+	}
+
+	_, err := t.request("POST", "/fapi/v3/positionMargin", map[string]interface{}{
+		"symbol":       symbol,
+		"positionSide": t.orderPositionSide(strings.ToUpper(positionSide)),
+		"amount":       strconv.FormatFloat(math.Abs(amount), 'f', 4, 64),
+		"type":         actionType,
+	})
+	if err != nil {
+		return fmt.Errorf("调整逐仓保证金失败: %w", err)
+	}
+
+	log.Printf("  ✓ %s %s 逐仓保证金调整 %+.4f USDT", symbol, strings.ToUpper(positionSide), amount)
+	return nil
+}
+
 // GetMarketPrice 获取市场价格
 func (t *AsterTrader) GetMarketPrice(symbol string) (float64, error) {
 	// 使用ticker接口获取当前价格
@@ -857,6 +1217,35 @@ func (t *AsterTrader) GetMarketPrice(symbol string) (float64, error) {
 	return strconv.ParseFloat(priceStr, 64)
 }
 
+// GetOrderBook 获取L2订单簿（公开接口，无需签名）
+func (t *AsterTrader) GetOrderBook(symbol string, depth int) (*OrderBook, error) {
+	resp, err := t.client.Get(fmt.Sprintf("%s/fapi/v3/depth?symbol=%s&limit=%d", t.baseURL, symbol, depth))
+	if err != nil {
+		return nil, fmt.Errorf("获取订单簿失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("获取订单簿失败: HTTP %d: %s", resp.StatusCode, string(body))
+	}
+
+	var result struct {
+		Time int64      `json:"E"`
+		Bids [][]string `json:"bids"`
+		Asks [][]string `json:"asks"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("解析订单簿失败: %w", err)
+	}
+	return &OrderBook{
+		Symbol: symbol,
+		Bids:   parseBookLevels(result.Bids, 1),
+		Asks:   parseBookLevels(result.Asks, 1),
+		Time:   time.UnixMilli(result.Time),
+	}, nil
+}
+
 // SetStopLoss 设置止损
 func (t *AsterTrader) SetStopLoss(symbol string, positionSide string, quantity, stopPrice float64) error {
 	side := "SELL"
@@ -886,7 +1275,7 @@ func (t *AsterTrader) SetStopLoss(symbol string, positionSide string, quantity,
 
 	params := map[string]interface{}{
 		"symbol":       symbol,
-		"positionSide": "BOTH",
+		"positionSide": t.orderPositionSide(strings.ToUpper(positionSide)),
 		"type":         "STOP_MARKET",
 		"side":         side,
 		"stopPrice":    priceStr,
@@ -927,7 +1316,7 @@ func (t *AsterTrader) SetTakeProfit(symbol string, positionSide string, quantity
 
 	params := map[string]interface{}{
 		"symbol":       symbol,
-		"positionSide": "BOTH",
+		"positionSide": t.orderPositionSide(strings.ToUpper(positionSide)),
 		"type":         "TAKE_PROFIT_MARKET",
 		"side":         side,
 		"stopPrice":    priceStr,
@@ -939,8 +1328,30 @@ func (t *AsterTrader) SetTakeProfit(symbol string, positionSide string, quantity
 	return err
 }
 
-// CancelAllOrders 取消所有订单
+// PlaceBracket 下止损止盈联动单（由客户端监控在一侧成交后撤销另一侧）
+func (t *AsterTrader) PlaceBracket(symbol, positionSide string, quantity, stopLoss, takeProfit float64) (*Bracket, error) {
+	return placeMonitoredBracket(t, t.brackets, symbol, positionSide, quantity, stopLoss, takeProfit)
+}
+
+// GetBrackets 跟踪中的联动单状态
+func (t *AsterTrader) GetBrackets() []Bracket {
+	return t.brackets.list()
+}
+
+// SetTrailingStop 设置追踪止损（客户端模拟：轮询价格，回调达到比例时市价平仓）
+func (t *AsterTrader) SetTrailingStop(symbol string, positionSide string, quantity, activationPrice, callbackRate float64) error {
+	if err := t.trailing.set(symbol, positionSide, quantity, activationPrice, callbackRate); err != nil {
+		return fmt.Errorf("设置追踪止损失败: %w", err)
+	}
+
+	log.Printf("  追踪止损设置（客户端模拟）: 回调%.2f%% 激活价%.4f", callbackRate, activationPrice)
+	return nil
+}
+
+// CancelAllOrders 取消所有订单（包括客户端模拟的追踪止损）
 func (t *AsterTrader) CancelAllOrders(symbol string) error {
+	t.trailing.cancel(symbol)
+
 	params := map[string]interface{}{
 		"symbol": symbol,
 	}
@@ -973,8 +1384,169 @@ func (t *AsterTrader) FormatQuantity(symbol string, quantity float64) (string, e
 }
 
 // GetOpenOrders 获取指定币种的所有未完成订单
-func (t *AsterTrader) GetOpenOrders(symbol string) ([]map[string]interface{}, error) {
-	// TODO: Aster暂未实现获取未完成订单功能
-	log.Printf("⚠️  Aster暂不支持获取未完成订单")
-	return []map[string]interface{}{}, nil
+func (t *AsterTrader) GetOpenOrders(symbol string) ([]Order, error) {
+	body, err := t.request("GET", "/fapi/v3/openOrders", map[string]interface{}{
+		"symbol": symbol,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("获取未完成订单失败: %w", err)
+	}
+
+	var orders []struct {
+		OrderID      int64  `json:"orderId"`
+		Symbol       string `json:"symbol"`
+		Type         string `json:"type"`
+		Side         string `json:"side"`
+		PositionSide string `json:"positionSide"`
+		Price        string `json:"price"`
+		StopPrice    string `json:"stopPrice"`
+		OrigQty      string `json:"origQty"`
+		Status       string `json:"status"`
+		ReduceOnly   bool   `json:"reduceOnly"`
+	}
+	if err := json.Unmarshal(body, &orders); err != nil {
+		return nil, fmt.Errorf("解析未完成订单失败: %w", err)
+	}
+
+	result := make([]Order, 0, len(orders))
+	for _, o := range orders {
+		price, _ := strconv.ParseFloat(o.Price, 64)
+		stopPrice, _ := strconv.ParseFloat(o.StopPrice, 64)
+		quantity, _ := strconv.ParseFloat(o.OrigQty, 64)
+		result = append(result, Order{
+			OrderID:      o.OrderID,
+			Symbol:       o.Symbol,
+			Type:         o.Type,
+			Side:         o.Side,
+			PositionSide: o.PositionSide,
+			Price:        price,
+			StopPrice:    stopPrice,
+			Quantity:     quantity,
+			Status:       o.Status,
+			ReduceOnly:   o.ReduceOnly,
+		})
+	}
+	return result, nil
+}
+
+// GetTradeHistory 获取成交记录（接口与币安一致：必须指定币种，单次最多查询7天）
+func (t *AsterTrader) GetTradeHistory(symbol string, start, end time.Time) ([]TradeFill, error) {
+	symbols := []string{symbol}
+	if symbol == "" {
+		income, err := t.GetIncomeHistory("", start, end)
+		if err != nil {
+			return nil, err
+		}
+		symbols = incomeSymbols(income)
+	}
+
+	const limit = 1000
+	fills := make([]TradeFill, 0)
+	for _, sym := range symbols {
+		for _, window := range historyWindows(start, end, 7*24*time.Hour) {
+			from := window[0].UnixMilli()
+			for {
+				body, err := t.request("GET", "/fapi/v3/userTrades", map[string]interface{}{
+					"symbol":    sym,
+					"startTime": from,
+					"endTime":   window[1].UnixMilli(),
+					"limit":     limit,
+				})
+				if err != nil {
+					return nil, fmt.Errorf("获取%s成交记录失败: %w", sym, err)
+				}
+
+				var trades []struct {
+					Symbol          string `json:"symbol"`
+					ID              int64  `json:"id"`
+					OrderID         int64  `json:"orderId"`
+					Side            string `json:"side"`
+					PositionSide    string `json:"positionSide"`
+					Price           string `json:"price"`
+					Qty             string `json:"qty"`
+					RealizedPnl     string `json:"realizedPnl"`
+					Commission      string `json:"commission"`
+					CommissionAsset string `json:"commissionAsset"`
+					Time            int64  `json:"time"`
+				}
+				if err := json.Unmarshal(body, &trades); err != nil {
+					return nil, fmt.Errorf("解析成交记录失败: %w", err)
+				}
+
+				for _, trade := range trades {
+					price, _ := strconv.ParseFloat(trade.Price, 64)
+					qty, _ := strconv.ParseFloat(trade.Qty, 64)
+					pnl, _ := strconv.ParseFloat(trade.RealizedPnl, 64)
+					fee, _ := strconv.ParseFloat(trade.Commission, 64)
+					fills = append(fills, TradeFill{
+						Symbol:       trade.Symbol,
+						TradeID:      trade.ID,
+						OrderID:      trade.OrderID,
+						Side:         trade.Side,
+						PositionSide: binanceTradePositionSide(trade.PositionSide, trade.Side, pnl != 0),
+						Price:        price,
+						Quantity:     qty,
+						RealizedPnL:  pnl,
+						Fee:          fee,
+						FeeAsset:     trade.CommissionAsset,
+						Time:         time.UnixMilli(trade.Time),
+					})
+				}
+				if len(trades) < limit {
+					break
+				}
+				from = trades[len(trades)-1].Time + 1
+			}
+		}
+	}
+
+	sortTradeFills(fills)
+	return fills, nil
+}
+
+// GetIncomeHistory 获取已实现盈亏、手续费和资金费流水
+func (t *AsterTrader) GetIncomeHistory(symbol string, start, end time.Time) ([]IncomeRecord, error) {
+	const limit = 1000
+	records := make([]IncomeRecord, 0)
+	for _, window := range historyWindows(start, end, 30*24*time.Hour) {
+		from := window[0].UnixMilli()
+		for {
+			params := map[string]interface{}{
+				"startTime": from,
+				"endTime":   window[1].UnixMilli(),
+				"limit":     limit,
+			}
+			if symbol != "" {
+				params["symbol"] = symbol
+			}
+			body, err := t.request("GET", "/fapi/v3/income", params)
+			if err != nil {
+				return nil, fmt.Errorf("获取资金流水失败: %w", err)
+			}
+
+			var items []struct {
+				Symbol     string `json:"symbol"`
+				IncomeType string `json:"incomeType"`
+				Income     string `json:"income"`
+				Asset      string `json:"asset"`
+				Time       int64  `json:"time"`
+			}
+			if err := json.Unmarshal(body, &items); err != nil {
+				return nil, fmt.Errorf("解析资金流水失败: %w", err)
+			}
+
+			for _, item := range items {
+				if record, ok := parseBinanceIncome(item.Symbol, item.IncomeType, item.Income, item.Asset, item.Time); ok {
+					records = append(records, record)
+				}
+			}
+			if len(items) < limit {
+				break
+			}
+			from = items[len(items)-1].Time + 1
+		}
+	}
+
+	sortIncome(records)
+	return records, nil
 }
@@ -0,0 +1,97 @@
+package trader
+
+import (
+	"nofx/trader/fakeexchange"
+	"testing"
+)
+
+// testPrivateKey 测试用私钥（只用于本地模拟服务）
+const testPrivateKey = "4c0883a69102937d6231471b5dbb6204fe5129617082792ae468d01a3f362318"
+
+// newFakeAster 连接本地模拟Aster服务的交易器（BTCUSDT 60000，数量步进0.001，价格步进0.1）
+func newFakeAster(t *testing.T) (*fakeexchange.Ledger, *AsterTrader) {
+	ledger := fakeexchange.NewLedger(5000, 0.0005)
+	ledger.AddSymbol(fakeexchange.SymbolSpec{Symbol: "BTCUSDT", StepSize: 0.001, TickSize: 0.1}, 60000)
+
+	// 限流器按签名地址共享，每个测试使用独立的地址
+	signer := "aster-signer-" + t.Name()
+	server := fakeexchange.NewAster(ledger, "aster-user", signer)
+	t.Cleanup(server.Close)
+
+	trader, err := NewAsterTraderWithBaseURL("aster-user", signer, testPrivateKey, server.URL)
+	if err != nil {
+		t.Fatalf("创建Aster交易器失败: %v", err)
+	}
+	return ledger, trader
+}
+
+func TestAsterOpenAndCloseByTakeProfit(t *testing.T) {
+	ledger, trader := newFakeAster(t)
+
+	// 市价单以高于市价1%的限价单模拟，按当前价成交；数量按stepSize四舍五入
+	result, err := trader.OpenLong("BTCUSDT", 0.0456, 5)
+	if err != nil {
+		t.Fatalf("开多仓失败: %v", err)
+	}
+	if !floatEq(result.ExecutedQty, 0.046) || !floatEq(result.AvgPrice, 60000) || !floatEq(result.Fee, 0.046*60000*0.0005) {
+		t.Errorf("成交结果错误: %+v", result)
+	}
+	positions, err := trader.GetPositions()
+	if err != nil || len(positions) != 1 || positions[0].Side != "long" || positions[0].Leverage != 5 {
+		t.Fatalf("持仓错误: %+v, %v", positions, err)
+	}
+
+	if err := trader.SetStopLoss("BTCUSDT", "LONG", 0.046, 58123.456); err != nil {
+		t.Fatalf("设置止损失败: %v", err)
+	}
+	if err := trader.SetTakeProfit("BTCUSDT", "LONG", 0.046, 65000); err != nil {
+		t.Fatalf("设置止盈失败: %v", err)
+	}
+	orders := ledger.OpenOrders("BTCUSDT")
+	if len(orders) != 2 || orders[0].Type != fakeexchange.OrderTypeStopMarket || !floatEq(orders[0].StopPrice, 58123.5) ||
+		orders[0].PositionSide != fakeexchange.PositionSideBoth {
+		t.Fatalf("止损止盈挂单错误: %+v", orders)
+	}
+
+	// Aster无法单独撤销止损单：只替换止损会被拒绝，同时替换时撤销全部后重新设置
+	if err := replaceProtectiveOrders(trader, "BTCUSDT", "long", 0.046, 59000, 0); err == nil {
+		t.Fatal("Aster应拒绝只替换止损")
+	}
+	if err := replaceProtectiveOrders(trader, "BTCUSDT", "long", 0.046, 59000, 64000); err != nil {
+		t.Fatalf("替换止损止盈失败: %v", err)
+	}
+	orders = ledger.OpenOrders("BTCUSDT")
+	if len(orders) != 2 || !floatEq(orders[0].StopPrice, 59000) || !floatEq(orders[1].StopPrice, 64000) {
+		t.Fatalf("替换后挂单错误: %+v", orders)
+	}
+
+	// 价格涨到止盈价，止盈单只减仓平掉持仓
+	ledger.SetPrice("BTCUSDT", 64100)
+	if positions, _ := trader.GetPositions(); len(positions) != 0 {
+		t.Fatalf("止盈触发后应无持仓: %+v", positions)
+	}
+	balance, err := trader.GetBalance()
+	if err != nil {
+		t.Fatalf("GetBalance失败: %v", err)
+	}
+	want := 5000 - 0.046*60000*0.0005 - 0.046*64100*0.0005 + 0.046*(64100-60000)
+	if !floatEq(balance.TotalWalletBalance, want) {
+		t.Errorf("钱包余额 %.6f, 期望 %.6f", balance.TotalWalletBalance, want)
+	}
+
+	if _, err := trader.CloseLong("BTCUSDT", 0); err == nil {
+		t.Error("没有持仓时平仓应返回错误")
+	}
+}
+
+func TestAsterRejectsUnsignedOrders(t *testing.T) {
+	ledger, trader := newFakeAster(t)
+	trader.signer = "someone-else"
+
+	if _, err := trader.OpenShort("BTCUSDT", 0.01, 3); err == nil {
+		t.Fatal("签名地址不匹配的请求应被拒绝")
+	}
+	if positions := ledger.Positions(); len(positions) != 0 {
+		t.Errorf("被拒绝的请求不应产生持仓: %+v", positions)
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"nofx/mcp"
 	"nofx/pool"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -24,7 +25,7 @@ type AutoTraderConfig struct {
 	EnableScreenshot bool // 是否启用图表截图功能
 
 	// 交易平台选择
-	Exchange string // "binance", "hyperliquid" 或 "aster"
+	Exchange string // "binance", "hyperliquid", "aster", "bybit", "okx" 或 "paper"
 
 	// 币安API配置
 	BinanceAPIKey    string
@@ -40,6 +41,40 @@ type AutoTraderConfig struct {
 	AsterSigner     string // Aster API钱包地址
 	AsterPrivateKey string // Aster API钱包私钥
 
+	// Bybit配置
+	BybitAPIKey    string
+	BybitSecretKey string
+	BybitTestnet   bool
+
+	// OKX配置
+	OKXAPIKey     string
+	OKXSecretKey  string
+	OKXPassphrase string
+
+	// 模拟盘配置
+	PaperSlippageBps float64 // 市价成交滑点（基点）
+	PaperFeeRate     float64 // 手续费率
+
+	// 保证金模式和持仓模式（为空时使用交易所默认设置）
+	MarginMode   string // "cross" 或 "isolated"
+	PositionMode string // "one-way" 或 "hedge"
+
+	// 开仓方式配置
+	EntryOrderType      string // "market"（默认）或 "limit"
+	EntryTimeInForce    string // 限价单时间有效性: "GTC"（默认）, "IOC" 或 "POST_ONLY"
+	EntryOrderMaxCycles int    // 限价单最多等待的周期数，超过后撤单（默认3）
+
+	// 仓位计算方式
+	PositionSizing  string  // "ai"（默认）或 "risk"（按单笔风险和止损距离计算开仓价值）
+	RiskPerTradePct float64 // 单笔风险占账户净值的百分比（默认1）
+
+	// 下单前滑点检查（按订单簿估算市价单的成交均价）
+	MaxSlippageBps float64 // 相对中间价的滑点上限（基点，0表示不检查）
+	SlippageAction string  // 超过上限时: "downsize"（默认）或 "reject"
+
+	// 开仓、加仓和减仓的拆单执行（TWAP/冰山单）
+	Execution ExecutionConfig
+
 	CoinPoolAPIURL string
 
 	// AI配置
@@ -64,10 +99,11 @@ type AutoTraderConfig struct {
 	BTCETHLeverage  int // BTC和ETH的杠杆倍数
 	AltcoinLeverage int // 山寨币的杠杆倍数
 
-	// 风险控制（仅作为提示，AI可自主决定）
-	MaxDailyLoss    float64       // 最大日亏损百分比（提示）
-	MaxDrawdown     float64       // 最大回撤百分比（提示）
-	StopTradingTime time.Duration // 触发风控后暂停时长
+	// 风险控制（熔断：超过限制后暂停开仓和加仓，0表示不限制）
+	MaxDailyLoss     float64       // 最大日亏损百分比（相对当日UTC零点后首次检查时的净值）
+	MaxDrawdown      float64       // 最大回撤百分比（相对净值峰值）
+	StopTradingTime  time.Duration // 触发熔断后暂停时长（默认60分钟）
+	FlattenOnBreaker bool          // 触发熔断时撤销所有挂单并平掉全部持仓
 }
 
 // AutoTrader 自动交易器
@@ -83,8 +119,7 @@ type AutoTrader struct {
 	decisionLogger                 *logger.DecisionLogger // 决策日志记录器
 	initialBalance                 float64
 	dailyPnL                       float64
-	lastResetTime                  time.Time
-	stopUntil                      time.Time
+	breaker                        breakerState // 日亏损和回撤熔断状态
 	isRunning                      bool
 	startTime                      time.Time                    // 系统启动时间
 	callCount                      int                          // AI调用次数
@@ -93,6 +128,17 @@ type AutoTrader struct {
 	positionReasonings             map[string]string            // 持仓开仓理由 (symbol -> opening_reason)
 	positionPnLTracking            map[string]*PnLTracking      // 持仓盈亏跟踪 (symbol_side -> PnL tracking)
 	lastPositionSnapshot           map[string]*PositionSnapshot // 上一周期的持仓快照 (symbol_side -> snapshot)
+	restingEntries                 map[string]*RestingEntry     // 未成交的限价开仓单 (symbol_side -> entry)
+	stopTradeEvents                func()                       // 停止交易所实时推送
+	realtimeClosed                 map[string]bool              // 已通过实时推送记录平仓的持仓 (symbol_side)，周期检测时不重复记录
+	realtimeMu                     sync.Mutex
+	funding                        *fundingTracker // 持仓累计资金费
+	shadows                        []*ShadowTrader // 影子交易器（同一上下文，虚拟账本执行）
+	orphans                        *orphanSweeper  // 孤儿挂单清理（持仓已平但仍挂着的保护单）
+	state                          *stateStore     // 跨重启保留的状态（decision_logs/<id>/state）
+	exec                           *executor       // 拆单执行（TWAP/冰山单）
+
+	killSwitch // 一键清仓
 }
 
 // PnLTracking 持仓盈亏跟踪数据
@@ -193,10 +239,63 @@ func NewAutoTrader(config AutoTraderConfig) (*AutoTrader, error) {
 		if err != nil {
 			return nil, fmt.Errorf("初始化Aster交易器失败: %w", err)
 		}
+	case "bybit":
+		log.Printf("🏦 [%s] 使用Bybit合约交易", config.Name)
+		trader = NewBybitTrader(config.BybitAPIKey, config.BybitSecretKey, config.BybitTestnet)
+	case "okx":
+		log.Printf("🏦 [%s] 使用OKX合约交易", config.Name)
+		trader = NewOKXTrader(config.OKXAPIKey, config.OKXSecretKey, config.OKXPassphrase)
+	case "paper":
+		log.Printf("🏦 [%s] 使用模拟盘交易（虚拟资金）", config.Name)
+		trader = NewPaperTrader(config.InitialBalance, config.PaperSlippageBps, config.PaperFeeRate)
 	default:
 		return nil, fmt.Errorf("不支持的交易平台: %s", config.Exchange)
 	}
 
+	caps := trader.Capabilities()
+	log.Printf("🧩 [%s] 交易所功能: %s", config.Name, caps)
+
+	// 开仓方式默认值
+	if config.EntryOrderType == "" {
+		config.EntryOrderType = "market"
+	}
+	if config.EntryOrderType == "limit" && !caps.LimitOrders {
+		log.Printf("⚠️ [%s] %s 不支持限价开仓，改用市价开仓", config.Name, config.Exchange)
+		config.EntryOrderType = "market"
+	}
+	if config.EntryTimeInForce == "" {
+		config.EntryTimeInForce = string(TimeInForceGTC)
+	}
+	if config.EntryOrderMaxCycles <= 0 {
+		config.EntryOrderMaxCycles = 3
+	}
+	if config.EntryOrderType == "limit" {
+		log.Printf("📌 [%s] 使用限价开仓 (%s, 最多等待%d个周期)", config.Name, config.EntryTimeInForce, config.EntryOrderMaxCycles)
+	}
+	if config.PositionSizing == "" {
+		config.PositionSizing = PositionSizingAI
+	}
+	if config.PositionSizing == PositionSizingRisk {
+		if config.RiskPerTradePct <= 0 {
+			config.RiskPerTradePct = 1
+		}
+		log.Printf("📐 [%s] 按风险计算仓位 (单笔风险%.2f%%账户净值)", config.Name, config.RiskPerTradePct)
+	}
+	if config.SlippageAction == "" {
+		config.SlippageAction = SlippageDownsize
+	}
+	if config.MaxSlippageBps > 0 {
+		if _, ok := trader.(OrderBookTrader); ok {
+			log.Printf("📖 [%s] 下单前按订单簿检查滑点 (上限%.0f bps，超限时%s)", config.Name, config.MaxSlippageBps, config.SlippageAction)
+		} else {
+			log.Printf("⚠️ [%s] 交易所不支持订单簿，max_slippage_bps不生效", config.Name)
+		}
+	}
+
+	limits := breakerLimits{MaxDailyLoss: config.MaxDailyLoss, MaxDrawdown: config.MaxDrawdown, StopTradingTime: config.StopTradingTime}
+	applyBreakerDefaults(config.Name, &limits, config.FlattenOnBreaker)
+	config.StopTradingTime = limits.StopTradingTime
+
 	// 验证初始金额配置
 	if config.InitialBalance <= 0 {
 		return nil, fmt.Errorf("初始金额必须大于0，请在配置中设置InitialBalance")
@@ -206,7 +305,7 @@ func NewAutoTrader(config AutoTraderConfig) (*AutoTrader, error) {
 	logDir := fmt.Sprintf("decision_logs/%s", config.ID)
 	decisionLogger := logger.NewDecisionLogger(logDir)
 
-	return &AutoTrader{
+	at := &AutoTrader{
 		id:                             config.ID,
 		name:                           config.Name,
 		aiModel:                        config.AIModel,
@@ -217,7 +316,6 @@ func NewAutoTrader(config AutoTraderConfig) (*AutoTrader, error) {
 		mcpClient:                      mcpClient,
 		decisionLogger:                 decisionLogger,
 		initialBalance:                 config.InitialBalance,
-		lastResetTime:                  time.Now(),
 		startTime:                      time.Now(),
 		callCount:                      0,
 		isRunning:                      false,
@@ -226,7 +324,27 @@ func NewAutoTrader(config AutoTraderConfig) (*AutoTrader, error) {
 		positionReasonings:             make(map[string]string),
 		positionPnLTracking:            make(map[string]*PnLTracking),
 		lastPositionSnapshot:           make(map[string]*PositionSnapshot),
-	}, nil
+		restingEntries:                 make(map[string]*RestingEntry),
+		realtimeClosed:                 make(map[string]bool),
+		funding:                        newFundingTracker(trader),
+		orphans:                        newOrphanSweeper(trader, config.Name, decisionLogger),
+		state:                          newStateStore(logDir),
+		exec:                           newExecutor(trader, config.Name, config.Execution),
+	}
+	at.exec.stopped = at.Killed
+	at.exec.logConfig(config.ScanInterval)
+	// 决策周期之外的下单（手动平仓、限价单成交检查等）周期和决策序号为0
+	setClientOrderRef(trader, at.clientOrderRef(0))
+	return at, nil
+}
+
+// clientOrderRef 当前周期第decision个决策的下单归属（decision为0表示不属于决策周期）
+func (at *AutoTrader) clientOrderRef(decision int) ClientOrderRef {
+	ref := ClientOrderRef{TraderID: at.id, RunID: at.startTime.Unix()}
+	if decision > 0 {
+		ref.Cycle, ref.Decision = at.callCount, decision
+	}
+	return ref
 }
 
 // Run 运行自动交易主循环
@@ -237,6 +355,18 @@ func (at *AutoTrader) Run() error {
 	log.Printf("⚙️  扫描间隔: %v", at.config.ScanInterval)
 	log.Println("🤖 AI将全权决定杠杆、仓位大小、止损止盈等参数")
 
+	// 恢复上次运行的持仓跟踪数据和周期编号（按交易所当前持仓和挂单校正）
+	at.restoreState()
+
+	// 支持推送的交易所：实时获取止损止盈触发的准确成交
+	at.stopTradeEvents = startTradeEvents(at.trader, at.name, at.handleTradeEvent)
+
+	// 后台撤销持仓已不存在的止损止盈单（手动平仓、强平或一侧触发后剩下的另一侧）
+	at.orphans.start()
+
+	// 应用配置的保证金模式和持仓模式
+	applyTradingModes(at.trader, at.name, at.config.MarginMode, at.config.PositionMode)
+
 	ticker := time.NewTicker(at.config.ScanInterval)
 	defer ticker.Stop()
 
@@ -260,12 +390,24 @@ func (at *AutoTrader) Run() error {
 // Stop 停止自动交易
 func (at *AutoTrader) Stop() {
 	at.isRunning = false
+	if at.stopTradeEvents != nil {
+		at.stopTradeEvents()
+	}
+	at.orphans.shutdown()
 	log.Println("⏹ 自动交易系统停止")
 }
 
 // runCycle 运行一个交易周期（使用AI全权决策）
 func (at *AutoTrader) runCycle() error {
+	// 一键清仓等待进行中的周期结束，触发后不再执行新的周期
+	at.cycleMu.Lock()
+	defer at.cycleMu.Unlock()
+	if at.Killed() {
+		return nil
+	}
+
 	at.callCount++
+	defer at.saveState()
 
 	log.Printf("%s", "\n"+strings.Repeat("=", 70))
 	log.Printf("⏰ %s - AI决策周期 #%d", time.Now().Format("2006-01-02 15:04:05"), at.callCount)
@@ -277,24 +419,44 @@ func (at *AutoTrader) runCycle() error {
 		Success:      true,
 	}
 
-	// 1. 检查是否需要停止交易
-	if time.Now().Before(at.stopUntil) {
-		remaining := time.Until(at.stopUntil)
-		log.Printf("⏸ 风险控制：暂停交易中，剩余 %.0f 分钟", remaining.Minutes())
+	// 1. 检查日亏损和回撤熔断（触发后暂停开仓和加仓，未成交的限价开仓单在本周期撤单）
+	tripped := at.checkCircuitBreaker(record)
+
+	// 2. 检查未成交的限价开仓单（成交后设置止损止盈，超时撤单）
+	at.checkRestingEntries(record)
+
+	// 3. 熔断时按配置撤销所有挂单并平掉全部持仓
+	if tripped != "" && at.config.FlattenOnBreaker {
+		at.flattenOnBreaker(record, tripped)
+	}
+
+	// 检测止损止盈触发（在收集上下文之前）
+	at.recordClosedPositions(record)
+
+	// 熔断期间没有持仓需要管理时跳过AI决策
+	if at.breakerActive() && len(at.restingEntries) == 0 {
+		if positions, err := at.trader.GetPositions(); err == nil && len(positions) == 0 {
+			record.Success = false
+			record.ErrorMessage = fmt.Sprintf("熔断暂停中（%s），剩余 %.0f 分钟", at.breaker.Reason, time.Until(at.breaker.StopUntil).Minutes())
+			at.decisionLogger.LogDecision(record)
+			return nil
+		}
+	}
+
+	// 4. 收集交易上下文（熔断期间AI仍可平仓和减仓）
+	ctx, err := at.buildTradingContext()
+	if err != nil {
 		record.Success = false
-		record.ErrorMessage = fmt.Sprintf("风险控制暂停中，剩余 %.0f 分钟", remaining.Minutes())
+		record.ErrorMessage = fmt.Sprintf("构建交易上下文失败: %v", err)
 		at.decisionLogger.LogDecision(record)
-		return nil
+		return fmt.Errorf("构建交易上下文失败: %w", err)
 	}
 
-	// 2. 重置日盈亏（每天重置）
-	if time.Since(at.lastResetTime) > 24*time.Hour {
-		at.dailyPnL = 0
-		at.lastResetTime = time.Now()
-		log.Println("📅 日盈亏已重置")
-	}
+	return at.decideAndExecute(ctx, record)
+}
 
-	// 3. 检测止损止盈触发（在收集上下文之前）
+// recordClosedPositions 检测止损止盈触发的平仓并记录到决策日志
+func (at *AutoTrader) recordClosedPositions(record *logger.DecisionRecord) {
 	closedPositions := at.detectClosedPositions()
 	for _, closedPos := range closedPositions {
 		// 记录到决策日志
@@ -303,6 +465,9 @@ func (at *AutoTrader) runCycle() error {
 			Symbol:    closedPos.Symbol,
 			Quantity:  closedPos.Quantity,
 			Price:     closedPos.ClosePrice,
+			OrderID:   closedPos.OrderID,
+			Fee:       closedPos.Fee,
+			FeeAsset:  closedPos.FeeAsset,
 			Timestamp: time.Now(),
 			Success:   true,
 		}
@@ -314,16 +479,10 @@ func (at *AutoTrader) runCycle() error {
 		log.Println(logMsg)
 		record.ExecutionLog = append(record.ExecutionLog, logMsg)
 	}
+}
 
-	// 4. 收集交易上下文
-	ctx, err := at.buildTradingContext()
-	if err != nil {
-		record.Success = false
-		record.ErrorMessage = fmt.Sprintf("构建交易上下文失败: %v", err)
-		at.decisionLogger.LogDecision(record)
-		return fmt.Errorf("构建交易上下文失败: %w", err)
-	}
-
+// decideAndExecute 用交易上下文请求AI决策，执行决策并保存决策记录
+func (at *AutoTrader) decideAndExecute(ctx *decision.Context, record *logger.DecisionRecord) error {
 	// 保存账户状态快照
 	record.AccountState = logger.AccountSnapshot{
 		TotalBalance:          ctx.Account.TotalEquity,
@@ -344,6 +503,7 @@ func (at *AutoTrader) runCycle() error {
 			UnrealizedProfit: pos.UnrealizedPnL,
 			Leverage:         float64(pos.Leverage),
 			LiquidationPrice: pos.LiquidationPrice,
+			Funding:          pos.Funding,
 		})
 	}
 
@@ -359,6 +519,9 @@ func (at *AutoTrader) runCycle() error {
 	log.Println("🤖 正在请求AI分析并决策...")
 	decision, err := decision.GetFullDecision(ctx, at.mcpClient, at.enableScreenshot)
 
+	// 影子交易器使用同一份上下文和市场数据（在后台运行，不影响实盘执行）
+	at.runShadows(ctx)
+
 	// 即使有错误，也保存思维链、决策和输入prompt（用于debug）
 	if decision != nil {
 		record.InputPrompt = decision.UserPrompt
@@ -413,8 +576,15 @@ func (at *AutoTrader) runCycle() error {
 	}
 	log.Println()
 
-	// 8. 执行决策并记录结果
-	for _, d := range sortedDecisions {
+	// 8. 执行决策并记录结果（订单的客户端订单ID编码周期和决策序号）
+	defer setClientOrderRef(at.trader, at.clientOrderRef(0))
+	for i, d := range sortedDecisions {
+		if at.Killed() {
+			record.ExecutionLog = append(record.ExecutionLog, "🛑 已触发一键清仓，跳过剩余决策")
+			break
+		}
+		setClientOrderRef(at.trader, at.clientOrderRef(i+1))
+		at.orphans.track(d.Symbol)
 		actionRecord := logger.DecisionAction{
 			Action:    d.Action,
 			Symbol:    d.Symbol,
@@ -449,27 +619,52 @@ func (at *AutoTrader) runCycle() error {
 
 // buildTradingContext 构建交易上下文
 func (at *AutoTrader) buildTradingContext() (*decision.Context, error) {
-	// 1. 获取账户信息
-	balance, err := at.trader.GetBalance()
+	ctx, err := at.buildAccountContext()
 	if err != nil {
-		return nil, fmt.Errorf("获取账户余额失败: %w", err)
+		return nil, err
 	}
 
-	// 获取账户字段
-	totalWalletBalance := 0.0
-	totalUnrealizedProfit := 0.0
-	availableBalance := 0.0
+	// 获取合并的候选币种池（AI500 + OI Top，去重）
+	// 无论有没有持仓，都分析相同数量的币种（让AI看到所有好机会）
+	// AI会根据保证金使用率和现有持仓情况，自己决定是否要换仓
+	const ai500Limit = 20 // AI500取前20个评分最高的币种
 
-	if wallet, ok := balance["totalWalletBalance"].(float64); ok {
-		totalWalletBalance = wallet
+	// 获取合并后的币种池（AI500 + OI Top）
+	mergedPool, err := pool.GetMergedCoinPool(ai500Limit)
+	if err != nil {
+		return nil, fmt.Errorf("获取合并币种池失败: %w", err)
 	}
-	if unrealized, ok := balance["totalUnrealizedProfit"].(float64); ok {
-		totalUnrealizedProfit = unrealized
+
+	// 构建候选币种列表（包含来源信息）
+	var candidateCoins []decision.CandidateCoin
+	for _, symbol := range mergedPool.AllSymbols {
+		sources := mergedPool.SymbolSources[symbol]
+		candidateCoins = append(candidateCoins, decision.CandidateCoin{
+			Symbol:  symbol,
+			Sources: sources, // "ai500" 和/或 "oi_top"
+		})
 	}
-	if avail, ok := balance["availableBalance"].(float64); ok {
-		availableBalance = avail
+
+	log.Printf("📋 合并币种池: AI500前%d + OI_Top20 = 总计%d个候选币种",
+		ai500Limit, len(candidateCoins))
+
+	ctx.CandidateCoins = candidateCoins
+	return ctx, nil
+}
+
+// buildAccountContext 构建交易上下文中的账户、持仓和历史表现部分（不含候选币种）
+func (at *AutoTrader) buildAccountContext() (*decision.Context, error) {
+	// 1. 获取账户信息
+	balance, err := at.trader.GetBalance()
+	if err != nil {
+		return nil, fmt.Errorf("获取账户余额失败: %w", err)
 	}
 
+	// 获取账户字段
+	totalWalletBalance := balance.TotalWalletBalance
+	totalUnrealizedProfit := balance.TotalUnrealizedProfit
+	availableBalance := balance.AvailableBalance
+
 	// Total Equity = 钱包余额 + 未实现盈亏
 	totalEquity := totalWalletBalance + totalUnrealizedProfit
 
@@ -486,21 +681,18 @@ func (at *AutoTrader) buildTradingContext() (*decision.Context, error) {
 	currentPositionKeys := make(map[string]bool)
 
 	for _, pos := range positions {
-		symbol := pos["symbol"].(string)
-		side := pos["side"].(string)
-		entryPrice := pos["entryPrice"].(float64)
-		markPrice := pos["markPrice"].(float64)
-		quantity := pos["positionAmt"].(float64)
-		if quantity < 0 {
-			quantity = -quantity // 空仓数量为负，转为正数
-		}
-		unrealizedPnl := pos["unRealizedProfit"].(float64)
-		liquidationPrice := pos["liquidationPrice"].(float64)
+		symbol := pos.Symbol
+		side := pos.Side
+		entryPrice := pos.EntryPrice
+		markPrice := pos.MarkPrice
+		quantity := pos.PositionAmt
+		unrealizedPnl := pos.UnRealizedProfit
+		liquidationPrice := pos.LiquidationPrice
 
 		// 计算占用保证金（估算）
-		leverage := 10 // 默认值，实际应该从持仓信息获取
-		if lev, ok := pos["leverage"].(float64); ok {
-			leverage = int(lev)
+		leverage := 10 // 默认值，交易所未返回杠杆时使用
+		if pos.Leverage > 0 {
+			leverage = pos.Leverage
 		}
 		marginUsed := (quantity * markPrice) / float64(leverage)
 		totalMarginUsed += marginUsed
@@ -574,6 +766,23 @@ func (at *AutoTrader) buildTradingContext() (*decision.Context, error) {
 		})
 	}
 
+	// 累计资金费（多日持仓时对净盈亏影响很大）
+	if at.funding != nil {
+		fundings := at.funding.update(positions, at.positionFirstSeenTime)
+		for i := range positionInfos {
+			positionInfos[i].Funding = fundings[positionInfos[i].Symbol+"_"+positionInfos[i].Side]
+		}
+	}
+
+	// 止损止盈联动单状态
+	if brackets := positionBrackets(at.trader); brackets != nil {
+		for i := range positionInfos {
+			if b, ok := brackets[positionInfos[i].Symbol+"_"+positionInfos[i].Side]; ok {
+				positionInfos[i].BracketState = string(b.State)
+			}
+		}
+	}
+
 	// 清理已平仓的持仓记录
 	for key := range at.positionFirstSeenTime {
 		if !currentPositionKeys[key] {
@@ -585,8 +794,7 @@ func (at *AutoTrader) buildTradingContext() (*decision.Context, error) {
 	// 清理已完全平仓币种的离场条件和开仓理由
 	currentSymbols := make(map[string]bool)
 	for _, pos := range positions {
-		symbol := pos["symbol"].(string)
-		currentSymbols[symbol] = true
+		currentSymbols[pos.Symbol] = true
 	}
 	for symbol := range at.positionInvalidationConditions {
 		if !currentSymbols[symbol] {
@@ -599,30 +807,6 @@ func (at *AutoTrader) buildTradingContext() (*decision.Context, error) {
 		}
 	}
 
-	// 3. 获取合并的候选币种池（AI500 + OI Top，去重）
-	// 无论有没有持仓，都分析相同数量的币种（让AI看到所有好机会）
-	// AI会根据保证金使用率和现有持仓情况，自己决定是否要换仓
-	const ai500Limit = 20 // AI500取前20个评分最高的币种
-
-	// 获取合并后的币种池（AI500 + OI Top）
-	mergedPool, err := pool.GetMergedCoinPool(ai500Limit)
-	if err != nil {
-		return nil, fmt.Errorf("获取合并币种池失败: %w", err)
-	}
-
-	// 构建候选币种列表（包含来源信息）
-	var candidateCoins []decision.CandidateCoin
-	for _, symbol := range mergedPool.AllSymbols {
-		sources := mergedPool.SymbolSources[symbol]
-		candidateCoins = append(candidateCoins, decision.CandidateCoin{
-			Symbol:  symbol,
-			Sources: sources, // "ai500" 和/或 "oi_top"
-		})
-	}
-
-	log.Printf("📋 合并币种池: AI500前%d + OI_Top20 = 总计%d个候选币种",
-		ai500Limit, len(candidateCoins))
-
 	// 4. 计算总盈亏
 	totalPnL := totalEquity - at.initialBalance
 	totalPnLPct := 0.0
@@ -652,6 +836,7 @@ func (at *AutoTrader) buildTradingContext() (*decision.Context, error) {
 		BTCETHLeverage:      at.config.BTCETHLeverage,      // 使用配置的杠杆倍数
 		AltcoinLeverage:     at.config.AltcoinLeverage,     // 使用配置的杠杆倍数
 		ScanIntervalMinutes: at.config.ScanIntervalMinutes, // 使用配置的扫描间隔
+		Capabilities:        effectiveCapabilities(at.trader).forDecision(),
 		Account: decision.AccountInfo{
 			TotalEquity:      totalEquity,
 			AvailableBalance: availableBalance,
@@ -661,9 +846,8 @@ func (at *AutoTrader) buildTradingContext() (*decision.Context, error) {
 			MarginUsedPct:    marginUsedPct,
 			PositionCount:    len(positionInfos),
 		},
-		Positions:      positionInfos,
-		CandidateCoins: candidateCoins,
-		Performance:    performance, // 添加历史表现分析
+		Positions:   positionInfos,
+		Performance: performance, // 添加历史表现分析
 	}
 
 	return ctx, nil
@@ -671,6 +855,9 @@ func (at *AutoTrader) buildTradingContext() (*decision.Context, error) {
 
 // executeDecisionWithRecord 执行AI决策并记录详细信息
 func (at *AutoTrader) executeDecisionWithRecord(decision *decision.Decision, actionRecord *logger.DecisionAction) error {
+	if isOpeningAction(decision.Action) && at.breakerActive() {
+		return at.breaker.blockedError()
+	}
 	switch decision.Action {
 	case "open_long":
 		return at.executeOpenLongWithRecord(decision, actionRecord)
@@ -690,6 +877,8 @@ func (at *AutoTrader) executeDecisionWithRecord(decision *decision.Decision, act
 		return at.executeDecreaseShortWithRecord(decision, actionRecord)
 	case "update_loss_profit":
 		return at.executeUpdateLossProfitWithRecord(decision, actionRecord)
+	case "set_trailing_stop":
+		return at.executeSetTrailingStopWithRecord(decision, actionRecord)
 	case "hold", "wait":
 		// 无需执行，仅记录
 		return nil
@@ -698,6 +887,11 @@ func (at *AutoTrader) executeDecisionWithRecord(decision *decision.Decision, act
 	}
 }
 
+// oneWayMode 交易器是否为单向持仓模式（交易所不支持或未启用双向持仓）
+func (at *AutoTrader) oneWayMode() bool {
+	return !effectiveCapabilities(at.trader).HedgeMode
+}
+
 // executeOpenLongWithRecord 执行开多仓并记录详细信息
 func (at *AutoTrader) executeOpenLongWithRecord(decision *decision.Decision, actionRecord *logger.DecisionAction) error {
 	log.Printf("  📈 开多仓: %s", decision.Symbol)
@@ -706,11 +900,18 @@ func (at *AutoTrader) executeOpenLongWithRecord(decision *decision.Decision, act
 	positions, err := at.trader.GetPositions()
 	if err == nil {
 		for _, pos := range positions {
-			if pos["symbol"] == decision.Symbol && pos["side"] == "long" {
+			if pos.Symbol == decision.Symbol && pos.Side == "long" {
 				return fmt.Errorf("❌ %s 已有多仓，拒绝开仓以防止仓位叠加超限。如需换仓，请先给出 close_long 决策", decision.Symbol)
 			}
+			// 单向持仓模式下开反向仓位会与现有仓位相抵
+			if pos.Symbol == decision.Symbol && pos.Side == "short" && at.oneWayMode() {
+				return fmt.Errorf("❌ %s 已有空仓，单向持仓模式下不能同时持有多空仓位。如需反手，请先给出 close_short 决策", decision.Symbol)
+			}
 		}
 	}
+	if entry, exists := at.restingEntries[decision.Symbol+"_long"]; exists {
+		return fmt.Errorf("❌ %s 已有未成交的限价开多单(订单ID: %d)，拒绝重复开仓", decision.Symbol, entry.OrderID)
+	}
 
 	// 获取当前价格
 	marketData, err := market.Get(decision.Symbol, 3)
@@ -726,46 +927,45 @@ func (at *AutoTrader) executeOpenLongWithRecord(decision *decision.Decision, act
 		return fmt.Errorf("当前价格与AI预期入场价偏差较大(%.2f%%)，请注意风险", priceDiff)
 	}
 
+	// 按配置的方式确定仓位价值（限价单按入场价，市价单按当前价）
+	entryPrice := marketData.CurrentPrice
+	if at.config.EntryOrderType == "limit" {
+		entryPrice = decision.EntryPrice
+	}
+	if err := at.applyPositionSizing(decision, entryPrice, actionRecord); err != nil {
+		return err
+	}
+
+	// 限价开仓：按AI给出的入场价挂单，成交后再设置止损止盈
+	if at.config.EntryOrderType == "limit" {
+		return at.openWithLimitOrder(decision, "long", actionRecord)
+	}
+
 	// 计算数量（使用当前市价）
 	quantity := decision.PositionSizeUSD / marketData.CurrentPrice
 	actionRecord.Quantity = quantity
 	actionRecord.Price = marketData.CurrentPrice
 
-	// 开仓
-	order, err := at.trader.OpenLong(decision.Symbol, quantity, decision.Leverage)
+	// 按订单簿检查滑点（超过上限时缩小数量或拒绝）
+	quantity, err = at.checkSlippage(decision.Symbol, true, quantity, actionRecord)
 	if err != nil {
 		return err
 	}
 
-	// 记录订单ID
-	if orderID, ok := order["orderId"].(int64); ok {
-		actionRecord.OrderID = orderID
+	// 开仓（订单较大时按配置拆单执行）
+	order, err := at.exec.execute(decision.Symbol, true, quantity, marketData.CurrentPrice, func(q float64) (*OrderResult, error) {
+		return at.trader.OpenLong(decision.Symbol, q, decision.Leverage)
+	}, actionRecord)
+	if err != nil {
+		return err
 	}
 
-	log.Printf("  ✓ 开仓成功，订单ID: %v, 数量: %.4f", order["orderId"], quantity)
+	// 记录订单ID和实际成交信息
+	recordOrderFill(actionRecord, order)
 
-	// 记录开仓时间和离场条件
-	posKey := decision.Symbol + "_long"
-	at.positionFirstSeenTime[posKey] = time.Now().UnixMilli()
+	log.Printf("  ✓ 开仓成功，订单ID: %d, 数量: %.4f", order.OrderID, filledQuantity(order, quantity))
 
-	// 设置该币种的离场条件和开仓理由（开仓时清空旧条件，设置新条件）
-	at.positionInvalidationConditions[decision.Symbol] = decision.InvalidationCondition
-	at.positionReasonings[decision.Symbol] = decision.Reasoning
-
-	// 初始化盈亏跟踪（保存止盈价格和止损价格）
-	at.positionPnLTracking[posKey] = &PnLTracking{
-		TakeProfitPrice: decision.TakeProfit,
-		StopLossPrice:   decision.StopLoss,
-		EntryPrice:      marketData.CurrentPrice,
-	}
-
-	// 设置止损和止盈
-	if err := at.trader.SetStopLoss(decision.Symbol, "LONG", quantity, decision.StopLoss); err != nil {
-		log.Printf("  ⚠ 设置止损失败: %v", err)
-	}
-	if err := at.trader.SetTakeProfit(decision.Symbol, "LONG", quantity, decision.TakeProfit); err != nil {
-		log.Printf("  ⚠ 设置止盈失败: %v", err)
-	}
+	at.activatePosition(decision, "long", filledQuantity(order, quantity), fillPrice(order, marketData.CurrentPrice))
 
 	return nil
 }
@@ -778,11 +978,18 @@ func (at *AutoTrader) executeOpenShortWithRecord(decision *decision.Decision, ac
 	positions, err := at.trader.GetPositions()
 	if err == nil {
 		for _, pos := range positions {
-			if pos["symbol"] == decision.Symbol && pos["side"] == "short" {
+			if pos.Symbol == decision.Symbol && pos.Side == "short" {
 				return fmt.Errorf("❌ %s 已有空仓，拒绝开仓以防止仓位叠加超限。如需换仓，请先给出 close_short 决策", decision.Symbol)
 			}
+			// 单向持仓模式下开反向仓位会与现有仓位相抵
+			if pos.Symbol == decision.Symbol && pos.Side == "long" && at.oneWayMode() {
+				return fmt.Errorf("❌ %s 已有多仓，单向持仓模式下不能同时持有多空仓位。如需反手，请先给出 close_long 决策", decision.Symbol)
+			}
 		}
 	}
+	if entry, exists := at.restingEntries[decision.Symbol+"_short"]; exists {
+		return fmt.Errorf("❌ %s 已有未成交的限价开空单(订单ID: %d)，拒绝重复开仓", decision.Symbol, entry.OrderID)
+	}
 
 	// 获取当前价格
 	marketData, err := market.Get(decision.Symbol, 3)
@@ -799,46 +1006,45 @@ func (at *AutoTrader) executeOpenShortWithRecord(decision *decision.Decision, ac
 		return fmt.Errorf("当前价格与AI预期入场价偏差较大(%.2f%%)，请注意风险", priceDiff)
 	}
 
+	// 按配置的方式确定仓位价值（限价单按入场价，市价单按当前价）
+	entryPrice := marketData.CurrentPrice
+	if at.config.EntryOrderType == "limit" {
+		entryPrice = decision.EntryPrice
+	}
+	if err := at.applyPositionSizing(decision, entryPrice, actionRecord); err != nil {
+		return err
+	}
+
+	// 限价开仓：按AI给出的入场价挂单，成交后再设置止损止盈
+	if at.config.EntryOrderType == "limit" {
+		return at.openWithLimitOrder(decision, "short", actionRecord)
+	}
+
 	// 计算数量（使用当前市价）
 	quantity := decision.PositionSizeUSD / marketData.CurrentPrice
 	actionRecord.Quantity = quantity
 	actionRecord.Price = marketData.CurrentPrice
 
-	// 开仓
-	order, err := at.trader.OpenShort(decision.Symbol, quantity, decision.Leverage)
+	// 按订单簿检查滑点（超过上限时缩小数量或拒绝）
+	quantity, err = at.checkSlippage(decision.Symbol, false, quantity, actionRecord)
 	if err != nil {
 		return err
 	}
 
-	// 记录订单ID
-	if orderID, ok := order["orderId"].(int64); ok {
-		actionRecord.OrderID = orderID
+	// 开仓（订单较大时按配置拆单执行）
+	order, err := at.exec.execute(decision.Symbol, false, quantity, marketData.CurrentPrice, func(q float64) (*OrderResult, error) {
+		return at.trader.OpenShort(decision.Symbol, q, decision.Leverage)
+	}, actionRecord)
+	if err != nil {
+		return err
 	}
 
-	log.Printf("  ✓ 开仓成功，订单ID: %v, 数量: %.4f", order["orderId"], quantity)
+	// 记录订单ID和实际成交信息
+	recordOrderFill(actionRecord, order)
 
-	// 记录开仓时间和离场条件
-	posKey := decision.Symbol + "_short"
-	at.positionFirstSeenTime[posKey] = time.Now().UnixMilli()
+	log.Printf("  ✓ 开仓成功，订单ID: %d, 数量: %.4f", order.OrderID, filledQuantity(order, quantity))
 
-	// 设置该币种的离场条件和开仓理由（开仓时清空旧条件，设置新条件）
-	at.positionInvalidationConditions[decision.Symbol] = decision.InvalidationCondition
-	at.positionReasonings[decision.Symbol] = decision.Reasoning
-
-	// 初始化盈亏跟踪（保存止盈价格和止损价格）
-	at.positionPnLTracking[posKey] = &PnLTracking{
-		TakeProfitPrice: decision.TakeProfit,
-		StopLossPrice:   decision.StopLoss,
-		EntryPrice:      marketData.CurrentPrice,
-	}
-
-	// 设置止损和止盈
-	if err := at.trader.SetStopLoss(decision.Symbol, "SHORT", quantity, decision.StopLoss); err != nil {
-		log.Printf("  ⚠ 设置止损失败: %v", err)
-	}
-	if err := at.trader.SetTakeProfit(decision.Symbol, "SHORT", quantity, decision.TakeProfit); err != nil {
-		log.Printf("  ⚠ 设置止盈失败: %v", err)
-	}
+	at.activatePosition(decision, "short", filledQuantity(order, quantity), fillPrice(order, marketData.CurrentPrice))
 
 	return nil
 }
@@ -860,10 +1066,8 @@ func (at *AutoTrader) executeCloseLongWithRecord(decision *decision.Decision, ac
 		return err
 	}
 
-	// 记录订单ID
-	if orderID, ok := order["orderId"].(int64); ok {
-		actionRecord.OrderID = orderID
-	}
+	// 记录订单ID和实际成交信息
+	recordOrderFill(actionRecord, order)
 
 	log.Printf("  ✓ 平仓成功")
 	return nil
@@ -886,10 +1090,8 @@ func (at *AutoTrader) executeCloseShortWithRecord(decision *decision.Decision, a
 		return err
 	}
 
-	// 记录订单ID
-	if orderID, ok := order["orderId"].(int64); ok {
-		actionRecord.OrderID = orderID
-	}
+	// 记录订单ID和实际成交信息
+	recordOrderFill(actionRecord, order)
 
 	log.Printf("  ✓ 平仓成功")
 	return nil
@@ -907,7 +1109,7 @@ func (at *AutoTrader) executeIncreaseLongWithRecord(decision *decision.Decision,
 
 	hasPosition := false
 	for _, pos := range positions {
-		if pos["symbol"] == decision.Symbol && pos["side"] == "long" {
+		if pos.Symbol == decision.Symbol && pos.Side == "long" {
 			hasPosition = true
 			break
 		}
@@ -936,17 +1138,23 @@ func (at *AutoTrader) executeIncreaseLongWithRecord(decision *decision.Decision,
 	actionRecord.Quantity = quantity
 	actionRecord.Price = marketData.CurrentPrice
 
-	// 执行加仓（使用OpenLong，因为是增加多仓）
-	order, err := at.trader.OpenLong(decision.Symbol, quantity, decision.Leverage)
+	// 按订单簿检查滑点（超过上限时缩小数量或拒绝）
+	quantity, err = at.checkSlippage(decision.Symbol, true, quantity, actionRecord)
 	if err != nil {
 		return err
 	}
 
-	if orderID, ok := order["orderId"].(int64); ok {
-		actionRecord.OrderID = orderID
+	// 执行加仓（使用OpenLong，因为是增加多仓；订单较大时按配置拆单执行）
+	order, err := at.exec.execute(decision.Symbol, true, quantity, marketData.CurrentPrice, func(q float64) (*OrderResult, error) {
+		return at.trader.OpenLong(decision.Symbol, q, decision.Leverage)
+	}, actionRecord)
+	if err != nil {
+		return err
 	}
 
-	log.Printf("  ✓ 加仓成功，订单ID: %v, 数量: %.4f", order["orderId"], quantity)
+	recordOrderFill(actionRecord, order)
+
+	log.Printf("  ✓ 加仓成功，订单ID: %d, 数量: %.4f", order.OrderID, filledQuantity(order, quantity))
 
 	// 更新止损止盈（加仓后需要更新整体止损止盈）
 	posKey := decision.Symbol + "_long"
@@ -971,19 +1179,14 @@ func (at *AutoTrader) executeIncreaseLongWithRecord(decision *decision.Decision,
 
 	var totalQuantity float64
 	for _, pos := range positions {
-		if pos["symbol"] == decision.Symbol && pos["side"] == "long" {
-			totalQuantity = pos["positionAmt"].(float64)
+		if pos.Symbol == decision.Symbol && pos.Side == "long" {
+			totalQuantity = pos.PositionAmt
 			break
 		}
 	}
 
 	// 设置新的止损止盈（使用总持仓数量）
-	if err := at.trader.SetStopLoss(decision.Symbol, "LONG", totalQuantity, decision.StopLoss); err != nil {
-		log.Printf("  ⚠ 设置止损失败: %v", err)
-	}
-	if err := at.trader.SetTakeProfit(decision.Symbol, "LONG", totalQuantity, decision.TakeProfit); err != nil {
-		log.Printf("  ⚠ 设置止盈失败: %v", err)
-	}
+	placeProtectiveOrders(at.trader, decision.Symbol, "LONG", totalQuantity, decision.StopLoss, decision.TakeProfit)
 
 	return nil
 }
@@ -1000,7 +1203,7 @@ func (at *AutoTrader) executeIncreaseShortWithRecord(decision *decision.Decision
 
 	hasPosition := false
 	for _, pos := range positions {
-		if pos["symbol"] == decision.Symbol && pos["side"] == "short" {
+		if pos.Symbol == decision.Symbol && pos.Side == "short" {
 			hasPosition = true
 			break
 		}
@@ -1029,17 +1232,23 @@ func (at *AutoTrader) executeIncreaseShortWithRecord(decision *decision.Decision
 	actionRecord.Quantity = quantity
 	actionRecord.Price = marketData.CurrentPrice
 
-	// 执行加仓（使用OpenShort，因为是增加空仓）
-	order, err := at.trader.OpenShort(decision.Symbol, quantity, decision.Leverage)
+	// 按订单簿检查滑点（超过上限时缩小数量或拒绝）
+	quantity, err = at.checkSlippage(decision.Symbol, false, quantity, actionRecord)
 	if err != nil {
 		return err
 	}
 
-	if orderID, ok := order["orderId"].(int64); ok {
-		actionRecord.OrderID = orderID
+	// 执行加仓（使用OpenShort，因为是增加空仓；订单较大时按配置拆单执行）
+	order, err := at.exec.execute(decision.Symbol, false, quantity, marketData.CurrentPrice, func(q float64) (*OrderResult, error) {
+		return at.trader.OpenShort(decision.Symbol, q, decision.Leverage)
+	}, actionRecord)
+	if err != nil {
+		return err
 	}
 
-	log.Printf("  ✓ 加仓成功，订单ID: %v, 数量: %.4f", order["orderId"], quantity)
+	recordOrderFill(actionRecord, order)
+
+	log.Printf("  ✓ 加仓成功，订单ID: %d, 数量: %.4f", order.OrderID, filledQuantity(order, quantity))
 
 	// 更新止损止盈
 	posKey := decision.Symbol + "_short"
@@ -1064,22 +1273,14 @@ func (at *AutoTrader) executeIncreaseShortWithRecord(decision *decision.Decision
 
 	var totalQuantity float64
 	for _, pos := range positions {
-		if pos["symbol"] == decision.Symbol && pos["side"] == "short" {
-			totalQuantity = pos["positionAmt"].(float64)
-			if totalQuantity < 0 {
-				totalQuantity = -totalQuantity
-			}
+		if pos.Symbol == decision.Symbol && pos.Side == "short" {
+			totalQuantity = pos.PositionAmt
 			break
 		}
 	}
 
 	// 设置新的止损止盈（使用总持仓数量）
-	if err := at.trader.SetStopLoss(decision.Symbol, "SHORT", totalQuantity, decision.StopLoss); err != nil {
-		log.Printf("  ⚠ 设置止损失败: %v", err)
-	}
-	if err := at.trader.SetTakeProfit(decision.Symbol, "SHORT", totalQuantity, decision.TakeProfit); err != nil {
-		log.Printf("  ⚠ 设置止盈失败: %v", err)
-	}
+	placeProtectiveOrders(at.trader, decision.Symbol, "SHORT", totalQuantity, decision.StopLoss, decision.TakeProfit)
 
 	return nil
 }
@@ -1097,8 +1298,8 @@ func (at *AutoTrader) executeDecreaseLongWithRecord(decision *decision.Decision,
 	var currentQuantity float64
 	hasPosition := false
 	for _, pos := range positions {
-		if pos["symbol"] == decision.Symbol && pos["side"] == "long" {
-			currentQuantity = pos["positionAmt"].(float64)
+		if pos.Symbol == decision.Symbol && pos.Side == "long" {
+			currentQuantity = pos.PositionAmt
 			hasPosition = true
 			break
 		}
@@ -1125,17 +1326,18 @@ func (at *AutoTrader) executeDecreaseLongWithRecord(decision *decision.Decision,
 	actionRecord.Quantity = decreaseQuantity
 	actionRecord.Price = marketData.CurrentPrice
 
-	// 执行减仓（使用CloseLong的部分平仓功能）
-	order, err := at.trader.CloseLong(decision.Symbol, decreaseQuantity)
+	// 执行减仓（使用CloseLong的部分平仓功能；订单较大时按配置拆单执行）
+	order, err := at.exec.execute(decision.Symbol, false, decreaseQuantity, marketData.CurrentPrice, func(q float64) (*OrderResult, error) {
+		return at.trader.CloseLong(decision.Symbol, q)
+	}, actionRecord)
 	if err != nil {
 		return err
 	}
 
-	if orderID, ok := order["orderId"].(int64); ok {
-		actionRecord.OrderID = orderID
-	}
+	recordOrderFill(actionRecord, order)
 
-	log.Printf("  ✓ 减仓成功，数量: %.4f (剩余: %.4f)", decreaseQuantity, currentQuantity-decreaseQuantity)
+	decreased := filledQuantity(order, decreaseQuantity)
+	log.Printf("  ✓ 减仓成功，数量: %.4f (剩余: %.4f)", decreased, currentQuantity-decreased)
 
 	return nil
 }
@@ -1153,11 +1355,8 @@ func (at *AutoTrader) executeDecreaseShortWithRecord(decision *decision.Decision
 	var currentQuantity float64
 	hasPosition := false
 	for _, pos := range positions {
-		if pos["symbol"] == decision.Symbol && pos["side"] == "short" {
-			currentQuantity = pos["positionAmt"].(float64)
-			if currentQuantity < 0 {
-				currentQuantity = -currentQuantity
-			}
+		if pos.Symbol == decision.Symbol && pos.Side == "short" {
+			currentQuantity = pos.PositionAmt
 			hasPosition = true
 			break
 		}
@@ -1184,17 +1383,18 @@ func (at *AutoTrader) executeDecreaseShortWithRecord(decision *decision.Decision
 	actionRecord.Quantity = decreaseQuantity
 	actionRecord.Price = marketData.CurrentPrice
 
-	// 执行减仓（使用CloseShort的部分平仓功能）
-	order, err := at.trader.CloseShort(decision.Symbol, decreaseQuantity)
+	// 执行减仓（使用CloseShort的部分平仓功能；订单较大时按配置拆单执行）
+	order, err := at.exec.execute(decision.Symbol, true, decreaseQuantity, marketData.CurrentPrice, func(q float64) (*OrderResult, error) {
+		return at.trader.CloseShort(decision.Symbol, q)
+	}, actionRecord)
 	if err != nil {
 		return err
 	}
 
-	if orderID, ok := order["orderId"].(int64); ok {
-		actionRecord.OrderID = orderID
-	}
+	recordOrderFill(actionRecord, order)
 
-	log.Printf("  ✓ 减仓成功，数量: %.4f (剩余: %.4f)", decreaseQuantity, currentQuantity-decreaseQuantity)
+	decreased := filledQuantity(order, decreaseQuantity)
+	log.Printf("  ✓ 减仓成功，数量: %.4f (剩余: %.4f)", decreased, currentQuantity-decreased)
 
 	return nil
 }
@@ -1210,12 +1410,10 @@ func (at *AutoTrader) executeUpdateLossProfitWithRecord(decision *decision.Decis
 	}
 
 	// 查找该币种的持仓
-	var position map[string]interface{}
-	var positionSide string
-	for _, pos := range positions {
-		if pos["symbol"] == decision.Symbol {
-			position = pos
-			positionSide = pos["side"].(string)
+	var position *Position
+	for i := range positions {
+		if positions[i].Symbol == decision.Symbol {
+			position = &positions[i]
 			break
 		}
 	}
@@ -1224,11 +1422,8 @@ func (at *AutoTrader) executeUpdateLossProfitWithRecord(decision *decision.Decis
 		return fmt.Errorf("❌ %s 没有持仓，无法更新止盈止损", decision.Symbol)
 	}
 
-	// 获取持仓数量
-	quantity, ok := position["positionAmt"].(float64)
-	if !ok {
-		return fmt.Errorf("无法获取持仓数量")
-	}
+	positionSide := position.Side
+	quantity := position.PositionAmt
 
 	// 获取当前价格
 	marketData, err := market.Get(decision.Symbol, 3)
@@ -1241,52 +1436,29 @@ func (at *AutoTrader) executeUpdateLossProfitWithRecord(decision *decision.Decis
 	log.Printf("  📊 当前持仓: %s | 当前价格: %.4f | 新止损: %.4f | 新止盈: %.4f",
 		strings.ToUpper(positionSide), marketData.CurrentPrice, decision.StopLoss, decision.TakeProfit)
 
-	if positionSide == "long" {
-		// 多头：止盈价格必须大于止损价格
-		if decision.TakeProfit <= decision.StopLoss {
-			return fmt.Errorf("❌ 多头持仓时，止盈价格(%.4f)必须大于止损价格(%.4f)", decision.TakeProfit, decision.StopLoss)
-		}
-		// 止损价格应该低于当前价格
-		if decision.StopLoss >= marketData.CurrentPrice {
-			return fmt.Errorf("❌ 多头持仓时，止损价格(%.4f)应该低于当前价格(%.4f)", decision.StopLoss, marketData.CurrentPrice)
-		}
-		log.Printf("  ✅ 多头止盈止损验证通过")
-	} else if positionSide == "short" {
-		// 空头：止损价格必须大于止盈价格
-		if decision.StopLoss <= decision.TakeProfit {
-			return fmt.Errorf("❌ 空头持仓时，止损价格(%.4f)必须大于止盈价格(%.4f)", decision.StopLoss, decision.TakeProfit)
-		}
-		// 止损价格应该高于当前价格
-		if decision.StopLoss <= marketData.CurrentPrice {
-			return fmt.Errorf("❌ 空头持仓时，止损价格(%.4f)应该高于当前价格(%.4f)", decision.StopLoss, marketData.CurrentPrice)
-		}
-		log.Printf("  ✅ 空头止盈止损验证通过")
+	// 价格为0表示保持原有订单（仅在交易所能单独撤销止损/止盈单时允许）
+	if err := validateProtectivePrices(positionSide, marketData.CurrentPrice, decision.StopLoss, decision.TakeProfit); err != nil {
+		return err
 	}
+	log.Printf("  ✅ %s止盈止损验证通过", strings.ToUpper(positionSide))
 
-	// 取消现有的止损和止盈订单
+	// 替换现有的止损和止盈订单
 	log.Printf("  🗑️  取消现有止盈止损订单...")
-	if err := at.trader.CancelAllOrders(decision.Symbol); err != nil {
-		log.Printf("  ⚠️  取消全部委托订单失败: %v", err)
-	}
-
-	// 设置新的止损和止盈
-	positionSideUpper := strings.ToUpper(positionSide)
-	if err := at.trader.SetStopLoss(decision.Symbol, positionSideUpper, quantity, decision.StopLoss); err != nil {
-		log.Printf("  ⚠️  设置新止损失败: %v", err)
-		return fmt.Errorf("设置新止损失败: %w", err)
-	}
-
-	if err := at.trader.SetTakeProfit(decision.Symbol, positionSideUpper, quantity, decision.TakeProfit); err != nil {
-		log.Printf("  ⚠️  设置新止盈失败: %v", err)
-		return fmt.Errorf("设置新止盈失败: %w", err)
+	if err := replaceProtectiveOrders(at.trader, decision.Symbol, positionSide, quantity, decision.StopLoss, decision.TakeProfit); err != nil {
+		log.Printf("  ⚠️  %v", err)
+		return err
 	}
 
 	// 更新PnL跟踪信息
 	posKey := decision.Symbol + "_" + strings.ToLower(positionSide)
 	if tracking, exists := at.positionPnLTracking[posKey]; exists {
-		tracking.StopLossPrice = decision.StopLoss
-		tracking.TakeProfitPrice = decision.TakeProfit
-		log.Printf("  ✅ 止盈止损更新成功 - 新止损: %.4f, 新止盈: %.4f", decision.StopLoss, decision.TakeProfit)
+		if decision.StopLoss > 0 {
+			tracking.StopLossPrice = decision.StopLoss
+		}
+		if decision.TakeProfit > 0 {
+			tracking.TakeProfitPrice = decision.TakeProfit
+		}
+		log.Printf("  ✅ 止盈止损更新成功 - 新止损: %.4f, 新止盈: %.4f", tracking.StopLossPrice, tracking.TakeProfitPrice)
 	} else {
 		log.Printf("  ⚠️  未找到PnL跟踪信息，但止盈止损已更新")
 	}
@@ -1298,6 +1470,17 @@ func (at *AutoTrader) executeUpdateLossProfitWithRecord(decision *decision.Decis
 	return nil
 }
 
+// executeSetTrailingStopWithRecord 为持仓设置追踪止损并记录详细信息（原有止损止盈单保持不变）
+func (at *AutoTrader) executeSetTrailingStopWithRecord(decision *decision.Decision, actionRecord *logger.DecisionAction) error {
+	log.Printf("  🔁 设置追踪止损: %s (回调%.2f%%, 激活价%.4f)", decision.Symbol, decision.CallbackRate, decision.ActivationPrice)
+
+	marketData, err := market.Get(decision.Symbol, 3)
+	if err != nil {
+		return err
+	}
+	return applyTrailingStop(at.trader, decision, marketData.CurrentPrice, actionRecord)
+}
+
 // GetID 获取trader ID
 func (at *AutoTrader) GetID() string {
 	return at.id
@@ -1331,38 +1514,70 @@ func (at *AutoTrader) GetStatus() map[string]interface{} {
 		"ai_model":        at.aiModel,
 		"exchange":        at.exchange,
 		"is_running":      at.isRunning,
+		"killed":          at.Killed(),
 		"start_time":      at.startTime.Format(time.RFC3339),
 		"runtime_minutes": int(time.Since(at.startTime).Minutes()),
 		"call_count":      at.callCount,
 		"initial_balance": at.initialBalance,
 		"scan_interval":   at.config.ScanInterval.String(),
-		"stop_until":      at.stopUntil.Format(time.RFC3339),
-		"last_reset_time": at.lastResetTime.Format(time.RFC3339),
+		"stop_until":      at.breaker.StopUntil.Format(time.RFC3339),
+		"last_reset_time": at.breaker.DayStart.Format(time.RFC3339),
+		"circuit_breaker": at.breakerSnapshot(),
 		"ai_provider":     aiProvider,
+		"capabilities":    effectiveCapabilities(at.trader),
+		"brackets":        bracketList(at.trader),
+		"shadows":         at.shadowStatus(),
 	}
 }
 
+// AccountInfo 账户信息（用于API）
+type AccountInfo struct {
+	// 核心字段
+	TotalEquity      float64 `json:"total_equity"`      // 账户净值 = wallet + unrealized
+	WalletBalance    float64 `json:"wallet_balance"`    // 钱包余额（不含未实现盈亏）
+	UnrealizedProfit float64 `json:"unrealized_profit"` // 未实现盈亏（从API）
+	AvailableBalance float64 `json:"available_balance"` // 可用余额
+
+	// 盈亏统计
+	TotalPnL           float64 `json:"total_pnl"`            // 总盈亏 = equity - initial
+	TotalPnLPct        float64 `json:"total_pnl_pct"`        // 总盈亏百分比
+	TotalUnrealizedPnL float64 `json:"total_unrealized_pnl"` // 未实现盈亏（从持仓计算）
+	InitialBalance     float64 `json:"initial_balance"`      // 初始余额
+	DailyPnL           float64 `json:"daily_pnl"`            // 日盈亏
+
+	// 持仓信息
+	PositionCount int     `json:"position_count"`  // 持仓数量
+	MarginUsed    float64 `json:"margin_used"`     // 保证金占用
+	MarginUsedPct float64 `json:"margin_used_pct"` // 保证金使用率
+}
+
+// PositionView 持仓信息（用于API）
+type PositionView struct {
+	Symbol           string   `json:"symbol"`
+	Side             string   `json:"side"`
+	EntryPrice       float64  `json:"entry_price"`
+	MarkPrice        float64  `json:"mark_price"`
+	Quantity         float64  `json:"quantity"`
+	Leverage         int      `json:"leverage"`
+	UnrealizedPnL    float64  `json:"unrealized_pnl"`
+	UnrealizedPnLPct float64  `json:"unrealized_pnl_pct"`
+	LiquidationPrice float64  `json:"liquidation_price"`
+	MarginUsed       float64  `json:"margin_used"`
+	Funding          float64  `json:"funding"`           // 持仓期间累计资金费（正数为收到，负数为支付）
+	Bracket          *Bracket `json:"bracket,omitempty"` // 止损止盈联动单（交易所支持时）
+}
+
 // GetAccountInfo 获取账户信息（用于API）
-func (at *AutoTrader) GetAccountInfo() (map[string]interface{}, error) {
+func (at *AutoTrader) GetAccountInfo() (*AccountInfo, error) {
 	balance, err := at.trader.GetBalance()
 	if err != nil {
 		return nil, fmt.Errorf("获取余额失败: %w", err)
 	}
 
 	// 获取账户字段
-	totalWalletBalance := 0.0
-	totalUnrealizedProfit := 0.0
-	availableBalance := 0.0
-
-	if wallet, ok := balance["totalWalletBalance"].(float64); ok {
-		totalWalletBalance = wallet
-	}
-	if unrealized, ok := balance["totalUnrealizedProfit"].(float64); ok {
-		totalUnrealizedProfit = unrealized
-	}
-	if avail, ok := balance["availableBalance"].(float64); ok {
-		availableBalance = avail
-	}
+	totalWalletBalance := balance.TotalWalletBalance
+	totalUnrealizedProfit := balance.TotalUnrealizedProfit
+	availableBalance := balance.AvailableBalance
 
 	// Total Equity = 钱包余额 + 未实现盈亏
 	totalEquity := totalWalletBalance + totalUnrealizedProfit
@@ -1376,19 +1591,13 @@ func (at *AutoTrader) GetAccountInfo() (map[string]interface{}, error) {
 	totalMarginUsed := 0.0
 	totalUnrealizedPnL := 0.0
 	for _, pos := range positions {
-		markPrice := pos["markPrice"].(float64)
-		quantity := pos["positionAmt"].(float64)
-		if quantity < 0 {
-			quantity = -quantity
-		}
-		unrealizedPnl := pos["unRealizedProfit"].(float64)
-		totalUnrealizedPnL += unrealizedPnl
+		totalUnrealizedPnL += pos.UnRealizedProfit
 
 		leverage := 10
-		if lev, ok := pos["leverage"].(float64); ok {
-			leverage = int(lev)
+		if pos.Leverage > 0 {
+			leverage = pos.Leverage
 		}
-		marginUsed := (quantity * markPrice) / float64(leverage)
+		marginUsed := (pos.PositionAmt * pos.MarkPrice) / float64(leverage)
 		totalMarginUsed += marginUsed
 	}
 
@@ -1403,50 +1612,43 @@ func (at *AutoTrader) GetAccountInfo() (map[string]interface{}, error) {
 		marginUsedPct = (totalMarginUsed / totalEquity) * 100
 	}
 
-	return map[string]interface{}{
-		// 核心字段
-		"total_equity":      totalEquity,           // 账户净值 = wallet + unrealized
-		"wallet_balance":    totalWalletBalance,    // 钱包余额（不含未实现盈亏）
-		"unrealized_profit": totalUnrealizedProfit, // 未实现盈亏（从API）
-		"available_balance": availableBalance,      // 可用余额
-
-		// 盈亏统计
-		"total_pnl":            totalPnL,           // 总盈亏 = equity - initial
-		"total_pnl_pct":        totalPnLPct,        // 总盈亏百分比
-		"total_unrealized_pnl": totalUnrealizedPnL, // 未实现盈亏（从持仓计算）
-		"initial_balance":      at.initialBalance,  // 初始余额
-		"daily_pnl":            at.dailyPnL,        // 日盈亏
-
-		// 持仓信息
-		"position_count":  len(positions),  // 持仓数量
-		"margin_used":     totalMarginUsed, // 保证金占用
-		"margin_used_pct": marginUsedPct,   // 保证金使用率
+	return &AccountInfo{
+		TotalEquity:        totalEquity,
+		WalletBalance:      totalWalletBalance,
+		UnrealizedProfit:   totalUnrealizedProfit,
+		AvailableBalance:   availableBalance,
+		TotalPnL:           totalPnL,
+		TotalPnLPct:        totalPnLPct,
+		TotalUnrealizedPnL: totalUnrealizedPnL,
+		InitialBalance:     at.initialBalance,
+		DailyPnL:           at.dailyPnL,
+		PositionCount:      len(positions),
+		MarginUsed:         totalMarginUsed,
+		MarginUsedPct:      marginUsedPct,
 	}, nil
 }
 
 // GetPositions 获取持仓列表（用于API）
-func (at *AutoTrader) GetPositions() ([]map[string]interface{}, error) {
+func (at *AutoTrader) GetPositions() ([]PositionView, error) {
 	positions, err := at.trader.GetPositions()
 	if err != nil {
 		return nil, fmt.Errorf("获取持仓失败: %w", err)
 	}
 
-	var result []map[string]interface{}
+	brackets := positionBrackets(at.trader)
+	var result []PositionView
 	for _, pos := range positions {
-		symbol := pos["symbol"].(string)
-		side := pos["side"].(string)
-		entryPrice := pos["entryPrice"].(float64)
-		markPrice := pos["markPrice"].(float64)
-		quantity := pos["positionAmt"].(float64)
-		if quantity < 0 {
-			quantity = -quantity
-		}
-		unrealizedPnl := pos["unRealizedProfit"].(float64)
-		liquidationPrice := pos["liquidationPrice"].(float64)
+		symbol := pos.Symbol
+		side := pos.Side
+		entryPrice := pos.EntryPrice
+		markPrice := pos.MarkPrice
+		quantity := pos.PositionAmt
+		unrealizedPnl := pos.UnRealizedProfit
+		liquidationPrice := pos.LiquidationPrice
 
 		leverage := 10
-		if lev, ok := pos["leverage"].(float64); ok {
-			leverage = int(lev)
+		if pos.Leverage > 0 {
+			leverage = pos.Leverage
 		}
 
 		pnlPct := 0.0
@@ -1458,18 +1660,23 @@ func (at *AutoTrader) GetPositions() ([]map[string]interface{}, error) {
 
 		marginUsed := (quantity * markPrice) / float64(leverage)
 
-		result = append(result, map[string]interface{}{
-			"symbol":             symbol,
-			"side":               side,
-			"entry_price":        entryPrice,
-			"mark_price":         markPrice,
-			"quantity":           quantity,
-			"leverage":           leverage,
-			"unrealized_pnl":     unrealizedPnl,
-			"unrealized_pnl_pct": pnlPct,
-			"liquidation_price":  liquidationPrice,
-			"margin_used":        marginUsed,
-		})
+		view := PositionView{
+			Symbol:           symbol,
+			Side:             side,
+			EntryPrice:       entryPrice,
+			MarkPrice:        markPrice,
+			Quantity:         quantity,
+			Leverage:         leverage,
+			UnrealizedPnL:    unrealizedPnl,
+			UnrealizedPnLPct: pnlPct,
+			LiquidationPrice: liquidationPrice,
+			MarginUsed:       marginUsed,
+			Funding:          at.funding.get(pos.Key()),
+		}
+		if b, ok := brackets[pos.Key()]; ok {
+			view.Bracket = &b
+		}
+		result = append(result, view)
 	}
 
 	return result, nil
@@ -1489,8 +1696,8 @@ func sortDecisionsByPriority(decisions []decision.Decision) []decision.Decision
 			return 1 // 最高优先级：先减仓
 		case "close_long", "close_short":
 			return 2 // 次高优先级：平仓
-		case "update_loss_profit":
-			return 3 // 更新止盈止损
+		case "update_loss_profit", "set_trailing_stop":
+			return 3 // 更新止盈止损/追踪止损
 		case "increase_long", "increase_short":
 			return 4 // 加仓
 		case "open_long", "open_short":
@@ -1528,9 +1735,13 @@ type ClosedPositionInfo struct {
 	EntryPrice  float64
 	ClosePrice  float64
 	PnL         float64
+	OrderID     int64   // 平仓订单ID（仅交易所推送时有值）
+	Fee         float64 // 平仓手续费（仅交易所推送时有值）
+	FeeAsset    string
 }
 
 // detectClosedPositions 检测已平仓的持仓（止损止盈触发）
+// 交易器支持成交推送时使用交易所返回的订单类型、成交价和已实现盈亏，否则按当前价格推断
 func (at *AutoTrader) detectClosedPositions() []ClosedPositionInfo {
 	var closedPositions []ClosedPositionInfo
 
@@ -1544,68 +1755,41 @@ func (at *AutoTrader) detectClosedPositions() []ClosedPositionInfo {
 	// 构建当前持仓的key集合
 	currentPosKeys := make(map[string]bool)
 	for _, pos := range currentPositions {
-		symbol := pos["symbol"].(string)
-		side := pos["side"].(string)
-		posKey := symbol + "_" + side
-		currentPosKeys[posKey] = true
+		currentPosKeys[pos.Key()] = true
 	}
 
+	// 交易所推送的平仓成交（按仓位合并）
+	closeFills := at.collectCloseFills()
+	realtimeClosed := at.takeRealtimeClosed()
+
 	// 检查上一周期的持仓是否消失
 	for posKey, lastSnapshot := range at.lastPositionSnapshot {
 		if !currentPosKeys[posKey] {
-			// 持仓消失了，判断是止损还是止盈
-			currentPrice, err := at.trader.GetMarketPrice(lastSnapshot.Symbol)
-			if err != nil {
-				log.Printf("⚠️ 获取%s当前价格失败: %v", lastSnapshot.Symbol, err)
-				continue
-			}
-
-			// 计算盈亏
-			var pnl float64
-			var triggerType string
-			var action string
-
-			if lastSnapshot.Side == "long" {
-				pnl = lastSnapshot.Quantity * (currentPrice - lastSnapshot.EntryPrice)
-				// 判断是止损还是止盈
-				if currentPrice <= lastSnapshot.StopLoss*1.01 { // 1%容差
-					triggerType = "止损"
-					action = "close_long_sl"
-				} else if currentPrice >= lastSnapshot.TakeProfit*0.99 { // 1%容差
-					triggerType = "止盈"
-					action = "close_long_tp"
-				} else {
-					// 无法判断，可能是手动平仓或其他原因
-					triggerType = "平仓"
-					action = "close_long"
-				}
+			if realtimeClosed[posKey] {
+				// 已在推送时实时记录，只清理数据
+				log.Printf("  ✓ %s 已由实时推送记录平仓", posKey)
+			} else if fill, ok := closeFills[posKey]; ok {
+				// 有推送的成交：直接使用交易所的订单类型、成交价和已实现盈亏
+				action, triggerType := closeActionForOrderType(lastSnapshot.Side, fill.OrderType)
+				closedPositions = append(closedPositions, ClosedPositionInfo{
+					Symbol:      lastSnapshot.Symbol,
+					Side:        lastSnapshot.Side,
+					Action:      action,
+					TriggerType: triggerType,
+					Quantity:    fill.Quantity,
+					EntryPrice:  lastSnapshot.EntryPrice,
+					ClosePrice:  fill.Price,
+					PnL:         fill.RealizedPnL,
+					OrderID:     fill.OrderID,
+					Fee:         fill.Fee,
+					FeeAsset:    fill.FeeAsset,
+				})
+			} else if info, ok := at.inferClosedPosition(lastSnapshot); ok {
+				closedPositions = append(closedPositions, info)
 			} else {
-				pnl = lastSnapshot.Quantity * (lastSnapshot.EntryPrice - currentPrice)
-				// 判断是止损还是止盈
-				if currentPrice >= lastSnapshot.StopLoss*0.99 { // 1%容差
-					triggerType = "止损"
-					action = "close_short_sl"
-				} else if currentPrice <= lastSnapshot.TakeProfit*1.01 { // 1%容差
-					triggerType = "止盈"
-					action = "close_short_tp"
-				} else {
-					// 无法判断
-					triggerType = "平仓"
-					action = "close_short"
-				}
+				continue
 			}
 
-			closedPositions = append(closedPositions, ClosedPositionInfo{
-				Symbol:      lastSnapshot.Symbol,
-				Side:        lastSnapshot.Side,
-				Action:      action,
-				TriggerType: triggerType,
-				Quantity:    lastSnapshot.Quantity,
-				EntryPrice:  lastSnapshot.EntryPrice,
-				ClosePrice:  currentPrice,
-				PnL:         pnl,
-			})
-
 			// 清理相关数据
 			delete(at.lastPositionSnapshot, posKey)
 			delete(at.positionFirstSeenTime, posKey)
@@ -1619,21 +1803,150 @@ func (at *AutoTrader) detectClosedPositions() []ClosedPositionInfo {
 	return closedPositions
 }
 
+// handleTradeEvent 处理交易所实时推送（在推送goroutine中调用）
+// 止损、止盈、强平成交立即写入决策日志，不必等到下一个决策周期
+func (at *AutoTrader) handleTradeEvent(event TradeEvent) {
+	switch {
+	case event.Fill != nil && isProtectiveClose(event.Fill):
+		if err := at.decisionLogger.LogDecision(closeRecordForFill(event.Fill)); err != nil {
+			log.Printf("⚠ 保存实时平仓记录失败: %v", err)
+		}
+		if event.Fill.PositionAfter == 0 {
+			at.realtimeMu.Lock()
+			at.realtimeClosed[event.Fill.Symbol+"_"+event.Fill.Side] = true
+			at.realtimeMu.Unlock()
+		}
+	case event.Funding != nil:
+		log.Printf("💸 %s %s 资金费: %+.4f USDT (费率 %.6f)",
+			event.Funding.Symbol, strings.ToUpper(event.Funding.Side), event.Funding.Amount, event.Funding.FundingRate)
+	}
+}
+
+// takeRealtimeClosed 取出并清空已实时记录平仓的持仓
+func (at *AutoTrader) takeRealtimeClosed() map[string]bool {
+	at.realtimeMu.Lock()
+	defer at.realtimeMu.Unlock()
+
+	closed := at.realtimeClosed
+	at.realtimeClosed = make(map[string]bool)
+	return closed
+}
+
+// inferClosedPosition 没有成交推送时，按当前价格与止损止盈价的距离推断平仓原因
+func (at *AutoTrader) inferClosedPosition(lastSnapshot *PositionSnapshot) (ClosedPositionInfo, bool) {
+	// 持仓消失了，判断是止损还是止盈
+	currentPrice, err := at.trader.GetMarketPrice(lastSnapshot.Symbol)
+	if err != nil {
+		log.Printf("⚠️ 获取%s当前价格失败: %v", lastSnapshot.Symbol, err)
+		return ClosedPositionInfo{}, false
+	}
+
+	// 计算盈亏
+	var pnl float64
+	var triggerType string
+	var action string
+
+	if lastSnapshot.Side == "long" {
+		pnl = lastSnapshot.Quantity * (currentPrice - lastSnapshot.EntryPrice)
+		// 判断是止损还是止盈
+		if currentPrice <= lastSnapshot.StopLoss*1.01 { // 1%容差
+			triggerType = "止损"
+			action = "close_long_sl"
+		} else if currentPrice >= lastSnapshot.TakeProfit*0.99 { // 1%容差
+			triggerType = "止盈"
+			action = "close_long_tp"
+		} else {
+			// 无法判断，可能是手动平仓或其他原因
+			triggerType = "平仓"
+			action = "close_long"
+		}
+	} else {
+		pnl = lastSnapshot.Quantity * (lastSnapshot.EntryPrice - currentPrice)
+		// 判断是止损还是止盈
+		if currentPrice >= lastSnapshot.StopLoss*0.99 { // 1%容差
+			triggerType = "止损"
+			action = "close_short_sl"
+		} else if currentPrice <= lastSnapshot.TakeProfit*1.01 { // 1%容差
+			triggerType = "止盈"
+			action = "close_short_tp"
+		} else {
+			// 无法判断
+			triggerType = "平仓"
+			action = "close_short"
+		}
+	}
+
+	return ClosedPositionInfo{
+		Symbol:      lastSnapshot.Symbol,
+		Side:        lastSnapshot.Side,
+		Action:      action,
+		TriggerType: triggerType,
+		Quantity:    lastSnapshot.Quantity,
+		EntryPrice:  lastSnapshot.EntryPrice,
+		ClosePrice:  currentPrice,
+		PnL:         pnl,
+	}, true
+}
+
+// collectCloseFills 取出交易所推送的平仓成交并按仓位合并（交易器不支持推送时返回nil）
+func (at *AutoTrader) collectCloseFills() map[string]CloseFill {
+	streamer, ok := at.trader.(CloseFillStreamer)
+	if !ok {
+		return nil
+	}
+
+	merged := make(map[string]CloseFill)
+	for _, fill := range streamer.DrainCloseFills() {
+		key := fill.Key()
+		m, exists := merged[key]
+		if !exists {
+			merged[key] = fill
+			continue
+		}
+
+		// 多笔平仓订单（如先部分止盈再止损）：成交价加权平均，盈亏和手续费累加
+		total := m.Quantity + fill.Quantity
+		if total > 0 {
+			m.Price = (m.Price*m.Quantity + fill.Price*fill.Quantity) / total
+		}
+		m.Quantity = total
+		m.RealizedPnL += fill.RealizedPnL
+		if fill.FeeAsset == m.FeeAsset {
+			m.Fee += fill.Fee
+		}
+		// 平仓原因以最终平掉仓位的订单为准
+		m.OrderID = fill.OrderID
+		m.OrderType = fill.OrderType
+		m.Time = fill.Time
+		merged[key] = m
+	}
+	return merged
+}
+
+// closeActionForOrderType 按平仓订单类型确定决策记录的动作和触发类型
+func closeActionForOrderType(side, orderType string) (action, triggerType string) {
+	switch orderType {
+	case CloseOrderStopMarket, CloseOrderStop:
+		return "close_" + side + "_sl", "止损"
+	case CloseOrderTrailingStop:
+		return "close_" + side + "_sl", "追踪止损"
+	case CloseOrderTakeProfitMarket, CloseOrderTakeProfit:
+		return "close_" + side + "_tp", "止盈"
+	case CloseOrderLiquidation:
+		return "close_" + side, "强平"
+	default:
+		return "close_" + side, "平仓"
+	}
+}
+
 // updatePositionSnapshot 更新持仓快照
-func (at *AutoTrader) updatePositionSnapshot(positions []map[string]interface{}) {
+func (at *AutoTrader) updatePositionSnapshot(positions []Position) {
 	// 清空旧快照
 	at.lastPositionSnapshot = make(map[string]*PositionSnapshot)
 
 	// 保存当前持仓快照
 	for _, pos := range positions {
-		symbol := pos["symbol"].(string)
-		side := pos["side"].(string)
-		posKey := symbol + "_" + side
-
-		quantity := pos["positionAmt"].(float64)
-		if quantity < 0 {
-			quantity = -quantity
-		}
+		posKey := pos.Key()
 
 		// 获取止损止盈价格
 		var stopLoss, takeProfit float64
@@ -1651,15 +1964,32 @@ func (at *AutoTrader) updatePositionSnapshot(positions []map[string]interface{})
 		}
 
 		at.lastPositionSnapshot[posKey] = &PositionSnapshot{
-			Symbol:     symbol,
-			Side:       side,
-			Quantity:   quantity,
-			EntryPrice: pos["entryPrice"].(float64),
-			MarkPrice:  pos["markPrice"].(float64),
-			Leverage:   int(pos["leverage"].(float64)),
+			Symbol:     pos.Symbol,
+			Side:       pos.Side,
+			Quantity:   pos.PositionAmt,
+			EntryPrice: pos.EntryPrice,
+			MarkPrice:  pos.MarkPrice,
+			Leverage:   pos.Leverage,
 			OpenTime:   openTime,
 			StopLoss:   stopLoss,
 			TakeProfit: takeProfit,
 		}
 	}
 }
+
+// recordOrderFill 用订单的实际成交信息更新决策记录（交易所未返回成交信息时保留按市价估算的值）
+func recordOrderFill(actionRecord *logger.DecisionAction, order *OrderResult) {
+	actionRecord.OrderID = order.OrderID
+	if order.ClientOrderID != "" {
+		actionRecord.ClientOrderID = order.ClientOrderID
+	}
+	if order.ExecutedQty > 0 {
+		actionRecord.Quantity = order.ExecutedQty
+	}
+	if order.AvgPrice > 0 {
+		actionRecord.Price = order.AvgPrice
+	}
+	actionRecord.Fee = order.Fee
+	actionRecord.FeeAsset = order.FeeAsset
+	actionRecord.OtherFees = order.OtherFees
+}
@@ -2,12 +2,17 @@ package trader
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"math"
+	"net/http"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/adshao/go-binance/v2/common"
 	"github.com/adshao/go-binance/v2/futures"
 )
 
@@ -16,30 +21,68 @@ type FuturesTrader struct {
 	client *futures.Client
 
 	// 余额缓存
-	cachedBalance     map[string]interface{}
+	cachedBalance     *Balance
 	balanceCacheTime  time.Time
 	balanceCacheMutex sync.RWMutex
 
 	// 持仓缓存
-	cachedPositions     []map[string]interface{}
+	cachedPositions     []Position
 	positionsCacheTime  time.Time
 	positionsCacheMutex sync.RWMutex
 
 	// 缓存有效期（15秒）
 	cacheDuration time.Duration
+
+	// 切换杠杆/保证金模式后的冷却时间
+	leverageCooldown   time.Duration
+	marginTypeCooldown time.Duration
+
+	// 用户数据流（平仓成交推送）
+	userStream      *binanceUserStream
+	userStreamURL   string
+	userStreamMutex sync.Mutex
+
+	// 保证金模式和持仓模式
+	tradingModes
+
+	// 止损止盈联动单监控（一侧成交后撤销另一侧）
+	brackets *bracketMonitor
+
+	// 开平仓订单的客户端订单ID
+	clientOrderIDs
 }
 
 // NewFuturesTrader 创建合约交易器
 func NewFuturesTrader(apiKey, secretKey string) *FuturesTrader {
+	return NewFuturesTraderWithBaseURL(apiKey, secretKey, "")
+}
+
+// NewFuturesTraderWithBaseURL 创建连接指定REST地址的合约交易器（为空时使用币安默认地址，用于测试网或本地模拟服务）
+func NewFuturesTraderWithBaseURL(apiKey, secretKey, baseURL string) *FuturesTrader {
 	client := futures.NewClient(apiKey, secretKey)
-	return &FuturesTrader{
-		client:        client,
-		cacheDuration: 15 * time.Second, // 15秒缓存
+	if baseURL != "" {
+		client.BaseURL = baseURL
+	}
+	// 同一API Key的所有交易器共享请求权重额度，超额时排队等待
+	limiter := sharedRateLimiter("binance", apiKey, binanceWeightLimit)
+	client.HTTPClient = &http.Client{
+		Transport: newRateLimitedTransport(limiter, binanceRequestWeight, binanceResigner(secretKey), nil),
+	}
+	t := &FuturesTrader{
+		client:             client,
+		cacheDuration:      15 * time.Second, // 15秒缓存
+		leverageCooldown:   5 * time.Second,
+		marginTypeCooldown: 3 * time.Second,
+		userStreamURL:      binanceUserStreamURL,
+		// 默认逐仓+双向持仓
+		tradingModes: tradingModes{marginMode: MarginModeIsolated, positionMode: PositionModeHedge},
 	}
+	t.brackets = newBracketMonitor(t)
+	return t
 }
 
 // GetBalance 获取账户余额（带缓存）
-func (t *FuturesTrader) GetBalance() (map[string]interface{}, error) {
+func (t *FuturesTrader) GetBalance() (*Balance, error) {
 	// 先检查缓存是否有效
 	t.balanceCacheMutex.RLock()
 	if t.cachedBalance != nil && time.Since(t.balanceCacheTime) < t.cacheDuration {
@@ -58,10 +101,10 @@ func (t *FuturesTrader) GetBalance() (map[string]interface{}, error) {
 		return nil, fmt.Errorf("获取账户信息失败: %w", err)
 	}
 
-	result := make(map[string]interface{})
-	result["totalWalletBalance"], _ = strconv.ParseFloat(account.TotalWalletBalance, 64)
-	result["availableBalance"], _ = strconv.ParseFloat(account.AvailableBalance, 64)
-	result["totalUnrealizedProfit"], _ = strconv.ParseFloat(account.TotalUnrealizedProfit, 64)
+	result := &Balance{}
+	result.TotalWalletBalance, _ = strconv.ParseFloat(account.TotalWalletBalance, 64)
+	result.AvailableBalance, _ = strconv.ParseFloat(account.AvailableBalance, 64)
+	result.TotalUnrealizedProfit, _ = strconv.ParseFloat(account.TotalUnrealizedProfit, 64)
 
 	log.Printf("✓ 币安API返回: 总余额=%s, 可用=%s, 未实现盈亏=%s",
 		account.TotalWalletBalance,
@@ -78,7 +121,7 @@ func (t *FuturesTrader) GetBalance() (map[string]interface{}, error) {
 }
 
 // GetPositions 获取所有持仓（带缓存）
-func (t *FuturesTrader) GetPositions() ([]map[string]interface{}, error) {
+func (t *FuturesTrader) GetPositions() ([]Position, error) {
 	// 先检查缓存是否有效
 	t.positionsCacheMutex.RLock()
 	if t.cachedPositions != nil && time.Since(t.positionsCacheTime) < t.cacheDuration {
@@ -96,30 +139,30 @@ func (t *FuturesTrader) GetPositions() ([]map[string]interface{}, error) {
 		return nil, fmt.Errorf("获取持仓失败: %w", err)
 	}
 
-	var result []map[string]interface{}
+	var result []Position
 	for _, pos := range positions {
 		posAmt, _ := strconv.ParseFloat(pos.PositionAmt, 64)
 		if posAmt == 0 {
 			continue // 跳过无持仓的
 		}
 
-		posMap := make(map[string]interface{})
-		posMap["symbol"] = pos.Symbol
-		posMap["positionAmt"], _ = strconv.ParseFloat(pos.PositionAmt, 64)
-		posMap["entryPrice"], _ = strconv.ParseFloat(pos.EntryPrice, 64)
-		posMap["markPrice"], _ = strconv.ParseFloat(pos.MarkPrice, 64)
-		posMap["unRealizedProfit"], _ = strconv.ParseFloat(pos.UnRealizedProfit, 64)
-		posMap["leverage"], _ = strconv.ParseFloat(pos.Leverage, 64)
-		posMap["liquidationPrice"], _ = strconv.ParseFloat(pos.LiquidationPrice, 64)
+		position := Position{Symbol: pos.Symbol}
+		position.EntryPrice, _ = strconv.ParseFloat(pos.EntryPrice, 64)
+		position.MarkPrice, _ = strconv.ParseFloat(pos.MarkPrice, 64)
+		position.UnRealizedProfit, _ = strconv.ParseFloat(pos.UnRealizedProfit, 64)
+		position.Leverage, _ = strconv.Atoi(pos.Leverage)
+		position.LiquidationPrice, _ = strconv.ParseFloat(pos.LiquidationPrice, 64)
 
-		// 判断方向
+		// 判断方向（空仓数量为负，统一转为正数）
 		if posAmt > 0 {
-			posMap["side"] = "long"
+			position.Side = "long"
+			position.PositionAmt = posAmt
 		} else {
-			posMap["side"] = "short"
+			position.Side = "short"
+			position.PositionAmt = -posAmt
 		}
 
-		result = append(result, posMap)
+		result = append(result, position)
 	}
 
 	// 更新缓存
@@ -138,11 +181,9 @@ func (t *FuturesTrader) SetLeverage(symbol string, leverage int) error {
 	positions, err := t.GetPositions()
 	if err == nil {
 		for _, pos := range positions {
-			if pos["symbol"] == symbol {
-				if lev, ok := pos["leverage"].(float64); ok {
-					currentLeverage = int(lev)
-					break
-				}
+			if pos.Symbol == symbol {
+				currentLeverage = pos.Leverage
+				break
 			}
 		}
 	}
@@ -170,9 +211,11 @@ func (t *FuturesTrader) SetLeverage(symbol string, leverage int) error {
 
 	log.Printf("  ✓ %s 杠杆已切换为 %dx", symbol, leverage)
 
-	// 切换杠杆后等待5秒（避免冷却期错误）
-	log.Printf("  ⏱ 等待5秒冷却期...")
-	time.Sleep(5 * time.Second)
+	// 切换杠杆后等待冷却期（避免冷却期错误）
+	if t.leverageCooldown > 0 {
+		log.Printf("  ⏱ 等待%.0f秒冷却期...", t.leverageCooldown.Seconds())
+		time.Sleep(t.leverageCooldown)
+	}
 
 	return nil
 }
@@ -195,15 +238,133 @@ func (t *FuturesTrader) SetMarginType(symbol string, marginType futures.MarginTy
 
 	log.Printf("  ✓ %s 保证金模式已切换为 %s", symbol, marginType)
 
-	// 切换保证金模式后等待3秒（避免冷却期错误）
-	log.Printf("  ⏱ 等待3秒冷却期...")
-	time.Sleep(3 * time.Second)
+	// 切换保证金模式后等待冷却期（避免冷却期错误）
+	if t.marginTypeCooldown > 0 {
+		log.Printf("  ⏱ 等待%.0f秒冷却期...", t.marginTypeCooldown.Seconds())
+		time.Sleep(t.marginTypeCooldown)
+	}
+
+	return nil
+}
+
+// SetMarginMode 设置保证金模式（symbol为空时设置默认模式，在之后每次开仓前生效）
+func (t *FuturesTrader) SetMarginMode(symbol string, mode MarginMode) error {
+	if err := t.setMarginMode(symbol, mode); err != nil {
+		return err
+	}
+	if symbol == "" {
+		return nil
+	}
+	return t.ensureMarginMode(symbol, t.applyMarginMode)
+}
+
+// SetPositionMode 设置持仓模式（有持仓或挂单时币安会拒绝切换）
+func (t *FuturesTrader) SetPositionMode(mode PositionMode) error {
+	if err := t.setPositionMode(mode); err != nil {
+		return err
+	}
+	return t.ensurePositionMode(t.applyPositionMode)
+}
+
+// ensureTradingModes 开仓前确保持仓模式和该币种的保证金模式已生效
+func (t *FuturesTrader) ensureTradingModes(symbol string) error {
+	if err := t.ensurePositionMode(t.applyPositionMode); err != nil {
+		return err
+	}
+	return t.ensureMarginMode(symbol, t.applyMarginMode)
+}
+
+// applyMarginMode 在币安切换币种的保证金模式
+func (t *FuturesTrader) applyMarginMode(symbol string, mode MarginMode) error {
+	marginType := futures.MarginTypeCrossed
+	if mode == MarginModeIsolated {
+		marginType = futures.MarginTypeIsolated
+	}
+	return t.SetMarginType(symbol, marginType)
+}
+
+// applyPositionMode 在币安切换持仓模式（已是目标模式时不发起切换）
+func (t *FuturesTrader) applyPositionMode(mode PositionMode) error {
+	dualSide := mode == PositionModeHedge
+	current, err := t.client.NewGetPositionModeService().Do(context.Background())
+	if err != nil {
+		return fmt.Errorf("查询持仓模式失败: %w", err)
+	}
+	if current.DualSidePosition == dualSide {
+		log.Printf("  ✓ 持仓模式已是 %s", mode)
+		return nil
+	}
 
+	err = t.client.NewChangePositionModeService().DualSide(dualSide).Do(context.Background())
+	if err != nil && !contains(err.Error(), "No need to change") {
+		return fmt.Errorf("设置持仓模式失败: %w", err)
+	}
+	log.Printf("  ✓ 持仓模式已切换为 %s", mode)
+	return nil
+}
+
+// orderPositionSide 下单使用的positionSide（单向持仓模式下为BOTH）
+func (t *FuturesTrader) orderPositionSide(side futures.PositionSideType) futures.PositionSideType {
+	if t.hedgeMode() {
+		return side
+	}
+	return futures.PositionSideTypeBoth
+}
+
+// closeOrderService 平仓订单（单向持仓模式下用reduceOnly防止反向开仓，双向持仓模式下币安不接受该参数）
+func (t *FuturesTrader) closeOrderService(side futures.PositionSideType) *futures.CreateOrderService {
+	service := t.client.NewCreateOrderService().PositionSide(t.orderPositionSide(side))
+	if !t.hedgeMode() {
+		service = service.ReduceOnly(true)
+	}
+	return service
+}
+
+// Capabilities 币安合约支持的功能
+func (t *FuturesTrader) Capabilities() Capabilities {
+	return Capabilities{
+		TrailingStop:       true,
+		ReduceOnly:         true,
+		SeparateSLTPCancel: true,
+		HedgeMode:          true,
+		LimitOrders:        true,
+		AdjustMargin:       true,
+		MinNotional:        5,
+	}
+}
+
+// AdjustIsolatedMargin 调整逐仓仓位保证金（amount>0追加，amount<0减少）
+func (t *FuturesTrader) AdjustIsolatedMargin(symbol string, positionSide string, amount float64) error {
+	if amount == 0 {
+		return fmt.Errorf("保证金调整金额不能为0")
+	}
+	side := futures.PositionSideTypeLong
+	if strings.EqualFold(positionSide, "short") {
+		side = futures.PositionSideTypeShort
+	}
+	actionType := 1
+	if amount < 0 {
+		actionType = 2
+	}
+
+	err := t.client.NewUpdatePositionMarginService().
+		Symbol(symbol).
+		PositionSide(t.orderPositionSide(side)).
+		Amount(strconv.FormatFloat(math.Abs(amount), 'f', 4, 64)).
+		Type(actionType).
+		Do(context.Background())
+	if err != nil {
+		return fmt.Errorf("调整逐仓保证金失败: %w", err)
+	}
+
+	// 保证金变化后强平价随之变化
+	t.invalidateCache()
+	log.Printf("  ✓ %s %s 逐仓保证金调整 %+.4f USDT", symbol, side, amount)
 	return nil
 }
 
 // OpenLong 开多仓
-func (t *FuturesTrader) OpenLong(symbol string, quantity float64, leverage int) (map[string]interface{}, error) {
+func (t *FuturesTrader) OpenLong(symbol string, quantity float64, leverage int) (*OrderResult, error) {
 	// 先取消该币种的所有委托单（清理旧的止损止盈单）
 	if err := t.CancelAllOrders(symbol); err != nil {
 		log.Printf("  ⚠ 取消旧委托单失败（可能没有委托单）: %v", err)
@@ -214,8 +375,8 @@ func (t *FuturesTrader) OpenLong(symbol string, quantity float64, leverage int)
 		return nil, err
 	}
 
-	// 设置逐仓模式
-	if err := t.SetMarginType(symbol, futures.MarginTypeIsolated); err != nil {
+	// 确保持仓模式和保证金模式
+	if err := t.ensureTradingModes(symbol); err != nil {
 		return nil, err
 	}
 
@@ -226,30 +387,25 @@ func (t *FuturesTrader) OpenLong(symbol string, quantity float64, leverage int)
 	}
 
 	// 创建市价买入订单
-	order, err := t.client.NewCreateOrderService().
+	result, err := t.createOrder(symbol, t.client.NewCreateOrderService().
 		Symbol(symbol).
 		Side(futures.SideTypeBuy).
-		PositionSide(futures.PositionSideTypeLong).
+		PositionSide(t.orderPositionSide(futures.PositionSideTypeLong)).
 		Type(futures.OrderTypeMarket).
-		Quantity(quantityStr).
-		Do(context.Background())
+		Quantity(quantityStr))
 
 	if err != nil {
 		return nil, fmt.Errorf("开多仓失败: %w", err)
 	}
 
 	log.Printf("✓ 开多仓成功: %s 数量: %s", symbol, quantityStr)
-	log.Printf("  订单ID: %d", order.OrderID)
+	log.Printf("  订单ID: %d", result.OrderID)
 
-	result := make(map[string]interface{})
-	result["orderId"] = order.OrderID
-	result["symbol"] = order.Symbol
-	result["status"] = order.Status
-	return result, nil
+	return t.withFills(result), nil
 }
 
 // OpenShort 开空仓
-func (t *FuturesTrader) OpenShort(symbol string, quantity float64, leverage int) (map[string]interface{}, error) {
+func (t *FuturesTrader) OpenShort(symbol string, quantity float64, leverage int) (*OrderResult, error) {
 	// 先取消该币种的所有委托单（清理旧的止损止盈单）
 	if err := t.CancelAllOrders(symbol); err != nil {
 		log.Printf("  ⚠ 取消旧委托单失败（可能没有委托单）: %v", err)
@@ -260,8 +416,8 @@ func (t *FuturesTrader) OpenShort(symbol string, quantity float64, leverage int)
 		return nil, err
 	}
 
-	// 设置逐仓模式
-	if err := t.SetMarginType(symbol, futures.MarginTypeIsolated); err != nil {
+	// 确保持仓模式和保证金模式
+	if err := t.ensureTradingModes(symbol); err != nil {
 		return nil, err
 	}
 
@@ -272,30 +428,158 @@ func (t *FuturesTrader) OpenShort(symbol string, quantity float64, leverage int)
 	}
 
 	// 创建市价卖出订单
-	order, err := t.client.NewCreateOrderService().
+	result, err := t.createOrder(symbol, t.client.NewCreateOrderService().
 		Symbol(symbol).
 		Side(futures.SideTypeSell).
-		PositionSide(futures.PositionSideTypeShort).
+		PositionSide(t.orderPositionSide(futures.PositionSideTypeShort)).
 		Type(futures.OrderTypeMarket).
-		Quantity(quantityStr).
-		Do(context.Background())
+		Quantity(quantityStr))
 
 	if err != nil {
 		return nil, fmt.Errorf("开空仓失败: %w", err)
 	}
 
 	log.Printf("✓ 开空仓成功: %s 数量: %s", symbol, quantityStr)
-	log.Printf("  订单ID: %d", order.OrderID)
+	log.Printf("  订单ID: %d", result.OrderID)
 
-	result := make(map[string]interface{})
-	result["orderId"] = order.OrderID
-	result["symbol"] = order.Symbol
-	result["status"] = order.Status
+	return t.withFills(result), nil
+}
+
+// OpenLongLimit 限价开多
+func (t *FuturesTrader) OpenLongLimit(symbol string, quantity, price float64, leverage int, tif TimeInForce) (*OrderResult, error) {
+	return t.openLimit(symbol, futures.SideTypeBuy, futures.PositionSideTypeLong, quantity, price, leverage, tif)
+}
+
+// OpenShortLimit 限价开空
+func (t *FuturesTrader) OpenShortLimit(symbol string, quantity, price float64, leverage int, tif TimeInForce) (*OrderResult, error) {
+	return t.openLimit(symbol, futures.SideTypeSell, futures.PositionSideTypeShort, quantity, price, leverage, tif)
+}
+
+// openLimit 下限价开仓单
+func (t *FuturesTrader) openLimit(symbol string, side futures.SideType, posSide futures.PositionSideType,
+	quantity, price float64, leverage int, tif TimeInForce) (*OrderResult, error) {
+	// 先取消该币种的所有委托单（清理旧的止损止盈单）
+	if err := t.CancelAllOrders(symbol); err != nil {
+		log.Printf("  ⚠ 取消旧委托单失败（可能没有委托单）: %v", err)
+	}
+
+	// 设置杠杆
+	if err := t.SetLeverage(symbol, leverage); err != nil {
+		return nil, err
+	}
+
+	// 确保持仓模式和保证金模式
+	if err := t.ensureTradingModes(symbol); err != nil {
+		return nil, err
+	}
+
+	// 格式化数量和价格到正确精度
+	quantityStr, err := t.FormatQuantity(symbol, quantity)
+	if err != nil {
+		return nil, err
+	}
+	priceStr, err := t.formatPrice(symbol, price)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := t.createOrder(symbol, t.client.NewCreateOrderService().
+		Symbol(symbol).
+		Side(side).
+		PositionSide(t.orderPositionSide(posSide)).
+		Type(futures.OrderTypeLimit).
+		TimeInForce(binanceTimeInForce(tif)).
+		Price(priceStr).
+		Quantity(quantityStr))
+
+	if err != nil {
+		return nil, fmt.Errorf("限价开仓失败: %w", err)
+	}
+
+	log.Printf("✓ 限价开仓单已提交: %s %s 价格: %s 数量: %s (%s)", symbol, posSide, priceStr, quantityStr, tif)
+	log.Printf("  订单ID: %d 状态: %s", result.OrderID, result.Status)
+
+	// 挂单中尚无成交时不查询成交明细
+	if result.ExecutedQty > 0 {
+		result = t.withFills(result)
+	}
 	return result, nil
 }
 
+// binanceTimeInForce 转换为币安的有效方式（只做Maker对应GTX）
+func binanceTimeInForce(tif TimeInForce) futures.TimeInForceType {
+	switch tif {
+	case TimeInForceIOC:
+		return futures.TimeInForceTypeIOC
+	case TimeInForcePostOnly:
+		return futures.TimeInForceTypeGTX
+	default:
+		return futures.TimeInForceTypeGTC
+	}
+}
+
+// GetOrder 查询订单状态
+func (t *FuturesTrader) GetOrder(symbol string, orderID int64) (*OrderResult, error) {
+	order, err := t.client.NewGetOrderService().
+		Symbol(symbol).
+		OrderID(orderID).
+		Do(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("查询订单失败: %w", err)
+	}
+	return t.orderResult(order), nil
+}
+
+// getOrderByClientID 按客户端订单ID查询订单（订单不存在时返回nil）
+func (t *FuturesTrader) getOrderByClientID(symbol, clientOrderID string) (*OrderResult, error) {
+	order, err := t.client.NewGetOrderService().
+		Symbol(symbol).
+		OrigClientOrderID(clientOrderID).
+		Do(context.Background())
+	var apiErr *common.APIError
+	if errors.As(err, &apiErr) && apiErr.Code == -2013 {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("查询订单失败: %w", err)
+	}
+	return t.orderResult(order), nil
+}
+
+// orderResult 将订单查询结果转换为OrderResult（有成交时补充成交明细）
+func (t *FuturesTrader) orderResult(order *futures.Order) *OrderResult {
+	avgPrice, _ := strconv.ParseFloat(order.AvgPrice, 64)
+	executedQty, _ := strconv.ParseFloat(order.ExecutedQuantity, 64)
+	result := &OrderResult{
+		OrderID:       order.OrderID,
+		Symbol:        order.Symbol,
+		Status:        string(order.Status),
+		AvgPrice:      avgPrice,
+		ExecutedQty:   executedQty,
+		ClientOrderID: order.ClientOrderID,
+	}
+	if executedQty > 0 {
+		result = t.withFills(result)
+	}
+	return result
+}
+
+// CancelOrder 取消指定订单
+func (t *FuturesTrader) CancelOrder(symbol string, orderID int64) error {
+	_, err := t.client.NewCancelOrderService().
+		Symbol(symbol).
+		OrderID(orderID).
+		Do(context.Background())
+	if err != nil {
+		return fmt.Errorf("取消订单失败: %w", err)
+	}
+
+	log.Printf("  ✓ 已取消 %s 订单 %d", symbol, orderID)
+	return nil
+}
+
 // CloseLong 平多仓
-func (t *FuturesTrader) CloseLong(symbol string, quantity float64) (map[string]interface{}, error) {
+func (t *FuturesTrader) CloseLong(symbol string, quantity float64) (*OrderResult, error) {
 	// 如果数量为0，获取当前持仓数量
 	if quantity == 0 {
 		positions, err := t.GetPositions()
@@ -304,8 +588,8 @@ func (t *FuturesTrader) CloseLong(symbol string, quantity float64) (map[string]i
 		}
 
 		for _, pos := range positions {
-			if pos["symbol"] == symbol && pos["side"] == "long" {
-				quantity = pos["positionAmt"].(float64)
+			if pos.Symbol == symbol && pos.Side == "long" {
+				quantity = pos.PositionAmt
 				break
 			}
 		}
@@ -322,13 +606,11 @@ func (t *FuturesTrader) CloseLong(symbol string, quantity float64) (map[string]i
 	}
 
 	// 创建市价卖出订单（平多）
-	order, err := t.client.NewCreateOrderService().
+	result, err := t.createOrder(symbol, t.closeOrderService(futures.PositionSideTypeLong).
 		Symbol(symbol).
 		Side(futures.SideTypeSell).
-		PositionSide(futures.PositionSideTypeLong).
 		Type(futures.OrderTypeMarket).
-		Quantity(quantityStr).
-		Do(context.Background())
+		Quantity(quantityStr))
 
 	if err != nil {
 		return nil, fmt.Errorf("平多仓失败: %w", err)
@@ -341,15 +623,11 @@ func (t *FuturesTrader) CloseLong(symbol string, quantity float64) (map[string]i
 		log.Printf("  ⚠ 取消挂单失败: %v", err)
 	}
 
-	result := make(map[string]interface{})
-	result["orderId"] = order.OrderID
-	result["symbol"] = order.Symbol
-	result["status"] = order.Status
-	return result, nil
+	return t.withFills(result), nil
 }
 
 // CloseShort 平空仓
-func (t *FuturesTrader) CloseShort(symbol string, quantity float64) (map[string]interface{}, error) {
+func (t *FuturesTrader) CloseShort(symbol string, quantity float64) (*OrderResult, error) {
 	// 如果数量为0，获取当前持仓数量
 	if quantity == 0 {
 		positions, err := t.GetPositions()
@@ -358,8 +636,8 @@ func (t *FuturesTrader) CloseShort(symbol string, quantity float64) (map[string]
 		}
 
 		for _, pos := range positions {
-			if pos["symbol"] == symbol && pos["side"] == "short" {
-				quantity = -pos["positionAmt"].(float64) // 空仓数量是负的，取绝对值
+			if pos.Symbol == symbol && pos.Side == "short" {
+				quantity = pos.PositionAmt
 				break
 			}
 		}
@@ -376,13 +654,11 @@ func (t *FuturesTrader) CloseShort(symbol string, quantity float64) (map[string]
 	}
 
 	// 创建市价买入订单（平空）
-	order, err := t.client.NewCreateOrderService().
+	result, err := t.createOrder(symbol, t.closeOrderService(futures.PositionSideTypeShort).
 		Symbol(symbol).
 		Side(futures.SideTypeBuy).
-		PositionSide(futures.PositionSideTypeShort).
 		Type(futures.OrderTypeMarket).
-		Quantity(quantityStr).
-		Do(context.Background())
+		Quantity(quantityStr))
 
 	if err != nil {
 		return nil, fmt.Errorf("平空仓失败: %w", err)
@@ -395,11 +671,62 @@ func (t *FuturesTrader) CloseShort(symbol string, quantity float64) (map[string]
 		log.Printf("  ⚠ 取消挂单失败: %v", err)
 	}
 
-	result := make(map[string]interface{})
-	result["orderId"] = order.OrderID
-	result["symbol"] = order.Symbol
-	result["status"] = order.Status
-	return result, nil
+	return t.withFills(result), nil
+}
+
+// createOrder 发送开平仓订单（附带客户端订单ID，结果不确定时先按ID查询再决定是否重新下单）
+// 下单后清空余额和持仓缓存（不等待账户推送），之后的查询能看到这笔订单的结果
+func (t *FuturesTrader) createOrder(symbol string, service *futures.CreateOrderService) (*OrderResult, error) {
+	defer t.invalidateCache()
+	clientOrderID := t.nextClientOrderID().String()
+	if clientOrderID != "" {
+		service = service.NewClientOrderID(clientOrderID)
+	}
+	return submitOrder(clientOrderID, func() (*OrderResult, error) {
+		order, err := service.Do(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		return newBinanceOrderResult(order), nil
+	}, func() (*OrderResult, error) {
+		return t.getOrderByClientID(symbol, clientOrderID)
+	})
+}
+
+// newBinanceOrderResult 将币安下单响应转换为OrderResult
+func newBinanceOrderResult(order *futures.CreateOrderResponse) *OrderResult {
+	avgPrice, _ := strconv.ParseFloat(order.AvgPrice, 64)
+	executedQty, _ := strconv.ParseFloat(order.ExecutedQuantity, 64)
+	return &OrderResult{
+		OrderID:     order.OrderID,
+		Symbol:      order.Symbol,
+		Status:      string(order.Status),
+		AvgPrice:    avgPrice,
+		ExecutedQty: executedQty,
+	}
+}
+
+// withFills 查询订单的成交明细，补充成交均价、成交数量和手续费
+// 查询失败或尚无成交时保留下单响应中的信息
+func (t *FuturesTrader) withFills(result *OrderResult) *OrderResult {
+	trades, err := t.client.NewListAccountTradeService().
+		Symbol(result.Symbol).
+		OrderID(result.OrderID).
+		Do(context.Background())
+	if err != nil {
+		log.Printf("  ⚠ 查询订单成交明细失败: %v", err)
+		return result
+	}
+
+	fills := make([]orderFill, 0, len(trades))
+	for _, trade := range trades {
+		price, _ := strconv.ParseFloat(trade.Price, 64)
+		qty, _ := strconv.ParseFloat(trade.Quantity, 64)
+		fee, _ := strconv.ParseFloat(trade.Commission, 64)
+		fills = append(fills, orderFill{Price: price, Quantity: qty, Fee: fee, FeeAsset: trade.CommissionAsset})
+	}
+	result.applyFills(fills)
+	return result
 }
 
 // CancelAllOrders 取消该币种的所有挂单
@@ -582,6 +909,29 @@ func (t *FuturesTrader) GetMarketPrice(symbol string) (float64, error) {
 	return price, nil
 }
 
+// GetOrderBook 获取L2订单簿
+func (t *FuturesTrader) GetOrderBook(symbol string, depth int) (*OrderBook, error) {
+	res, err := t.client.NewDepthService().Symbol(symbol).Limit(depth).Do(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("获取订单簿失败: %w", err)
+	}
+
+	book := &OrderBook{Symbol: symbol, Time: time.UnixMilli(res.Time)}
+	for _, bid := range res.Bids {
+		price, quantity, err := bid.Parse()
+		if err == nil {
+			book.Bids = append(book.Bids, OrderBookLevel{Price: price, Quantity: quantity})
+		}
+	}
+	for _, ask := range res.Asks {
+		price, quantity, err := ask.Parse()
+		if err == nil {
+			book.Asks = append(book.Asks, OrderBookLevel{Price: price, Quantity: quantity})
+		}
+	}
+	return book, nil
+}
+
 // CalculatePositionSize 计算仓位大小
 func (t *FuturesTrader) CalculatePositionSize(balance, riskPercent, price float64, leverage int) float64 {
 	riskAmount := balance * (riskPercent / 100.0)
@@ -603,18 +953,22 @@ func (t *FuturesTrader) SetStopLoss(symbol string, positionSide string, quantity
 		posSide = futures.PositionSideTypeShort
 	}
 
-	// 格式化数量
+	// 格式化数量和触发价（触发价必须是tickSize的整数倍）
 	quantityStr, err := t.FormatQuantity(symbol, quantity)
 	if err != nil {
 		return err
 	}
+	priceStr, err := t.formatPrice(symbol, stopPrice)
+	if err != nil {
+		return err
+	}
 
 	_, err = t.client.NewCreateOrderService().
 		Symbol(symbol).
 		Side(side).
-		PositionSide(posSide).
+		PositionSide(t.orderPositionSide(posSide)).
 		Type(futures.OrderTypeStopMarket).
-		StopPrice(fmt.Sprintf("%.8f", stopPrice)).
+		StopPrice(priceStr).
 		Quantity(quantityStr).
 		WorkingType(futures.WorkingTypeContractPrice).
 		ClosePosition(true).
@@ -641,18 +995,22 @@ func (t *FuturesTrader) SetTakeProfit(symbol string, positionSide string, quanti
 		posSide = futures.PositionSideTypeShort
 	}
 
-	// 格式化数量
+	// 格式化数量和触发价（触发价必须是tickSize的整数倍）
 	quantityStr, err := t.FormatQuantity(symbol, quantity)
 	if err != nil {
 		return err
 	}
+	priceStr, err := t.formatPrice(symbol, takeProfitPrice)
+	if err != nil {
+		return err
+	}
 
 	_, err = t.client.NewCreateOrderService().
 		Symbol(symbol).
 		Side(side).
-		PositionSide(posSide).
+		PositionSide(t.orderPositionSide(posSide)).
 		Type(futures.OrderTypeTakeProfitMarket).
-		StopPrice(fmt.Sprintf("%.8f", takeProfitPrice)).
+		StopPrice(priceStr).
 		Quantity(quantityStr).
 		WorkingType(futures.WorkingTypeContractPrice).
 		ClosePosition(true).
@@ -666,6 +1024,88 @@ func (t *FuturesTrader) SetTakeProfit(symbol string, positionSide string, quanti
 	return nil
 }
 
+// PlaceBracket 下止损止盈联动单（币安没有持仓级的OCO，由客户端监控在一侧成交后撤销另一侧）
+func (t *FuturesTrader) PlaceBracket(symbol, positionSide string, quantity, stopLoss, takeProfit float64) (*Bracket, error) {
+	return placeMonitoredBracket(t, t.brackets, symbol, positionSide, quantity, stopLoss, takeProfit)
+}
+
+// GetBrackets 跟踪中的联动单状态
+func (t *FuturesTrader) GetBrackets() []Bracket {
+	return t.brackets.list()
+}
+
+// SetTrailingStop 设置追踪止损单（TRAILING_STOP_MARKET，先取消该方向原有的追踪止损单）
+func (t *FuturesTrader) SetTrailingStop(symbol string, positionSide string, quantity, activationPrice, callbackRate float64) error {
+	price, err := t.GetMarketPrice(symbol)
+	if err != nil {
+		return err
+	}
+	if err := validateTrailingStop(positionSide, price, activationPrice, callbackRate); err != nil {
+		return err
+	}
+
+	side := futures.SideTypeSell
+	posSide := futures.PositionSideTypeLong
+	if positionSide == "SHORT" {
+		side = futures.SideTypeBuy
+		posSide = futures.PositionSideTypeShort
+	}
+
+	// 追踪止损不支持closePosition，按数量下单（单向持仓时只减仓）
+	quantityStr, err := t.FormatQuantity(symbol, quantity)
+	if err != nil {
+		return err
+	}
+	service := t.closeOrderService(posSide).
+		Symbol(symbol).
+		Side(side).
+		Type(futures.OrderTypeTrailingStopMarket).
+		Quantity(quantityStr).
+		CallbackRate(strconv.FormatFloat(callbackRate, 'f', 1, 64)). // 回调比例精度为0.1%
+		WorkingType(futures.WorkingTypeContractPrice)
+	if activationPrice > 0 {
+		priceStr, err := t.formatPrice(symbol, activationPrice)
+		if err != nil {
+			return err
+		}
+		service = service.ActivationPrice(priceStr)
+	}
+
+	if err := t.cancelTrailingStopOrders(symbol, side, posSide); err != nil {
+		return err
+	}
+	if _, err := service.Do(context.Background()); err != nil {
+		return fmt.Errorf("设置追踪止损失败: %w", err)
+	}
+
+	log.Printf("  追踪止损设置: 回调%.1f%% 激活价%.4f", callbackRate, activationPrice)
+	return nil
+}
+
+// cancelTrailingStopOrders 取消某方向持仓的追踪止损单
+func (t *FuturesTrader) cancelTrailingStopOrders(symbol string, side futures.SideType, posSide futures.PositionSideType) error {
+	orders, err := t.client.NewListOpenOrdersService().
+		Symbol(symbol).
+		Do(context.Background())
+	if err != nil {
+		return fmt.Errorf("获取未完成订单失败: %w", err)
+	}
+
+	for _, order := range orders {
+		if order.Type != futures.OrderTypeTrailingStopMarket || order.Side != side || order.PositionSide != t.orderPositionSide(posSide) {
+			continue
+		}
+		if _, err := t.client.NewCancelOrderService().
+			Symbol(symbol).
+			OrderID(order.OrderID).
+			Do(context.Background()); err != nil {
+			return fmt.Errorf("取消原追踪止损单 %d 失败: %w", order.OrderID, err)
+		}
+		log.Printf("  ✓ 已取消原追踪止损单 (订单ID: %d)", order.OrderID)
+	}
+	return nil
+}
+
 // GetSymbolPrecision 获取交易对的数量精度
 func (t *FuturesTrader) GetSymbolPrecision(symbol string) (int, error) {
 	exchangeInfo, err := t.client.NewExchangeInfoService().Do(context.Background())
@@ -691,6 +1131,31 @@ func (t *FuturesTrader) GetSymbolPrecision(symbol string) (int, error) {
 	return 3, nil // 默认精度为3
 }
 
+// formatPrice 按PRICE_FILTER的tickSize格式化价格
+func (t *FuturesTrader) formatPrice(symbol string, price float64) (string, error) {
+	exchangeInfo, err := t.client.NewExchangeInfoService().Do(context.Background())
+	if err != nil {
+		return "", fmt.Errorf("获取交易规则失败: %w", err)
+	}
+
+	for _, s := range exchangeInfo.Symbols {
+		if s.Symbol != symbol {
+			continue
+		}
+		for _, filter := range s.Filters {
+			if filter["filterType"] == "PRICE_FILTER" {
+				tickSizeStr, _ := filter["tickSize"].(string)
+				tickSize, _ := strconv.ParseFloat(tickSizeStr, 64)
+				precision := calculatePrecision(tickSizeStr)
+				return strconv.FormatFloat(roundToTickSize(price, tickSize), 'f', precision, 64), nil
+			}
+		}
+	}
+
+	log.Printf("  ⚠ %s 未找到价格精度信息，使用原始价格", symbol)
+	return strconv.FormatFloat(price, 'f', -1, 64), nil
+}
+
 // calculatePrecision 从stepSize计算精度
 func calculatePrecision(stepSize string) int {
 	// 去除尾部的0
@@ -761,7 +1226,7 @@ func stringContains(s, substr string) bool {
 }
 
 // GetOpenOrders 获取指定币种的所有未完成订单
-func (t *FuturesTrader) GetOpenOrders(symbol string) ([]map[string]interface{}, error) {
+func (t *FuturesTrader) GetOpenOrders(symbol string) ([]Order, error) {
 	orders, err := t.client.NewListOpenOrdersService().
 		Symbol(symbol).
 		Do(context.Background())
@@ -770,26 +1235,158 @@ func (t *FuturesTrader) GetOpenOrders(symbol string) ([]map[string]interface{},
 		return nil, fmt.Errorf("获取未完成订单失败: %w", err)
 	}
 
-	result := make([]map[string]interface{}, 0, len(orders))
+	result := make([]Order, 0, len(orders))
 	for _, order := range orders {
 		stopPrice, _ := strconv.ParseFloat(order.StopPrice, 64)
 		price, _ := strconv.ParseFloat(order.Price, 64)
 		origQty, _ := strconv.ParseFloat(order.OrigQuantity, 64)
+		activatePrice, _ := strconv.ParseFloat(order.ActivatePrice, 64)
+		priceRate, _ := strconv.ParseFloat(order.PriceRate, 64)
+
+		result = append(result, Order{
+			OrderID:      order.OrderID,
+			Symbol:       order.Symbol,
+			Type:         string(order.Type),
+			Side:         string(order.Side),
+			PositionSide: string(order.PositionSide),
+			Price:        price,
+			StopPrice:    stopPrice,
+			Quantity:     origQty,
+			Status:       string(order.Status),
+			ReduceOnly:   order.ReduceOnly,
+
+			ActivationPrice: activatePrice,
+			CallbackRate:    priceRate,
+		})
+	}
 
-		orderMap := map[string]interface{}{
-			"orderId":      order.OrderID,
-			"symbol":       order.Symbol,
-			"type":         string(order.Type),
-			"side":         string(order.Side),
-			"positionSide": string(order.PositionSide),
-			"price":        price,
-			"stopPrice":    stopPrice,
-			"origQty":      origQty,
-			"status":       string(order.Status),
-			"workingType":  string(order.WorkingType),
+	return result, nil
+}
+
+// GetTradeHistory 获取成交记录
+// userTrades必须指定币种且单次最多查询7天，未指定币种时按资金流水中出现的币种逐个查询
+func (t *FuturesTrader) GetTradeHistory(symbol string, start, end time.Time) ([]TradeFill, error) {
+	symbols := []string{symbol}
+	if symbol == "" {
+		income, err := t.GetIncomeHistory("", start, end)
+		if err != nil {
+			return nil, err
 		}
-		result = append(result, orderMap)
+		symbols = incomeSymbols(income)
 	}
 
-	return result, nil
+	const limit = 1000
+	fills := make([]TradeFill, 0)
+	for _, sym := range symbols {
+		for _, window := range historyWindows(start, end, 7*24*time.Hour) {
+			from := window[0].UnixMilli()
+			for {
+				trades, err := t.client.NewListAccountTradeService().
+					Symbol(sym).
+					StartTime(from).
+					EndTime(window[1].UnixMilli()).
+					Limit(limit).
+					Do(context.Background())
+				if err != nil {
+					return nil, fmt.Errorf("获取%s成交记录失败: %w", sym, err)
+				}
+				for _, trade := range trades {
+					fills = append(fills, parseBinanceTrade(trade))
+				}
+				if len(trades) < limit {
+					break
+				}
+				from = trades[len(trades)-1].Time + 1
+			}
+		}
+	}
+
+	sortTradeFills(fills)
+	return fills, nil
+}
+
+// GetIncomeHistory 获取已实现盈亏、手续费和资金费流水
+func (t *FuturesTrader) GetIncomeHistory(symbol string, start, end time.Time) ([]IncomeRecord, error) {
+	const limit = 1000
+	records := make([]IncomeRecord, 0)
+	for _, window := range historyWindows(start, end, 30*24*time.Hour) {
+		from := window[0].UnixMilli()
+		for {
+			service := t.client.NewGetIncomeHistoryService().
+				StartTime(from).
+				EndTime(window[1].UnixMilli()).
+				Limit(limit)
+			if symbol != "" {
+				service = service.Symbol(symbol)
+			}
+			items, err := service.Do(context.Background())
+			if err != nil {
+				return nil, fmt.Errorf("获取资金流水失败: %w", err)
+			}
+			for _, item := range items {
+				if record, ok := parseBinanceIncome(item.Symbol, item.IncomeType, item.Income, item.Asset, item.Time); ok {
+					records = append(records, record)
+				}
+			}
+			if len(items) < limit {
+				break
+			}
+			from = items[len(items)-1].Time + 1
+		}
+	}
+
+	sortIncome(records)
+	return records, nil
+}
+
+// parseBinanceTrade 转换币安成交记录
+func parseBinanceTrade(trade *futures.AccountTrade) TradeFill {
+	price, _ := strconv.ParseFloat(trade.Price, 64)
+	qty, _ := strconv.ParseFloat(trade.Quantity, 64)
+	pnl, _ := strconv.ParseFloat(trade.RealizedPnl, 64)
+	fee, _ := strconv.ParseFloat(trade.Commission, 64)
+	return TradeFill{
+		Symbol:       trade.Symbol,
+		TradeID:      trade.ID,
+		OrderID:      trade.OrderID,
+		Side:         string(trade.Side),
+		PositionSide: binanceTradePositionSide(string(trade.PositionSide), string(trade.Side), pnl != 0),
+		Price:        price,
+		Quantity:     qty,
+		RealizedPnL:  pnl,
+		Fee:          fee,
+		FeeAsset:     trade.CommissionAsset,
+		Time:         time.UnixMilli(trade.Time),
+	}
+}
+
+// binanceTradePositionSide 成交所属的仓位方向（单向持仓模式下按买卖方向和是否平仓推断）
+func binanceTradePositionSide(positionSide, side string, isClose bool) string {
+	switch positionSide {
+	case "LONG":
+		return "long"
+	case "SHORT":
+		return "short"
+	}
+	if (side == "BUY") != isClose {
+		return "long"
+	}
+	return "short"
+}
+
+// parseBinanceIncome 转换币安/Aster资金流水，只保留已实现盈亏、手续费和资金费
+func parseBinanceIncome(symbol, incomeType, income, asset string, timestamp int64) (IncomeRecord, bool) {
+	switch IncomeType(incomeType) {
+	case IncomeRealizedPnL, IncomeCommission, IncomeFunding:
+	default:
+		return IncomeRecord{}, false
+	}
+	amount, _ := strconv.ParseFloat(income, 64)
+	return IncomeRecord{
+		Symbol: symbol,
+		Type:   IncomeType(incomeType),
+		Amount: amount,
+		Asset:  asset,
+		Time:   time.UnixMilli(timestamp),
+	}, true
 }
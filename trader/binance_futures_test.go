@@ -0,0 +1,215 @@
+package trader
+
+import (
+	"nofx/trader/fakeexchange"
+	"strings"
+	"testing"
+)
+
+// newFakeBinance 连接本地模拟币安服务的交易器（BTCUSDT 60000，数量步进0.001，价格步进0.1）
+func newFakeBinance(t *testing.T) (*fakeexchange.Ledger, *FuturesTrader) {
+	ledger := fakeexchange.NewLedger(10000, 0.0004)
+	ledger.AddSymbol(fakeexchange.SymbolSpec{Symbol: "BTCUSDT", StepSize: 0.001, TickSize: 0.1}, 60000)
+
+	// 限流器按API Key共享，每个测试使用独立的Key
+	apiKey := "binance-" + t.Name()
+	server := fakeexchange.NewBinance(ledger, apiKey, "binance-secret")
+	t.Cleanup(server.Close)
+
+	trader := NewFuturesTraderWithBaseURL(apiKey, "binance-secret", server.URL)
+	trader.cacheDuration = 0
+	trader.leverageCooldown = 0
+	trader.marginTypeCooldown = 0
+	return ledger, trader
+}
+
+func TestBinanceOpenWithStopLossAndTakeProfit(t *testing.T) {
+	ledger, trader := newFakeBinance(t)
+
+	result, err := trader.OpenLong("BTCUSDT", 0.12345, 10)
+	if err != nil {
+		t.Fatalf("开多仓失败: %v", err)
+	}
+	// 数量按stepSize截为3位小数，手续费来自成交明细
+	if !floatEq(result.ExecutedQty, 0.123) || !floatEq(result.AvgPrice, 60000) || !floatEq(result.Fee, 0.123*60000*0.0004) {
+		t.Errorf("成交结果错误: %+v", result)
+	}
+	// 默认逐仓+双向持仓，开仓前已生效
+	pos, ok := ledger.Position("BTCUSDT", fakeexchange.PositionSideLong)
+	if !ok || !floatEq(pos.Amount, 0.123) || pos.Leverage != 10 || pos.MarginType != fakeexchange.MarginTypeIsolated {
+		t.Fatalf("交易所持仓错误: %+v", pos)
+	}
+
+	// 触发价按tickSize格式化
+	if err := trader.SetStopLoss("BTCUSDT", "LONG", 0.123, 58123.456); err != nil {
+		t.Fatalf("设置止损失败: %v", err)
+	}
+	if err := trader.SetTakeProfit("BTCUSDT", "LONG", 0.123, 66000); err != nil {
+		t.Fatalf("设置止盈失败: %v", err)
+	}
+	orders, err := trader.GetOpenOrders("BTCUSDT")
+	if err != nil || len(orders) != 2 {
+		t.Fatalf("应有止损止盈两个挂单: %+v, %v", orders, err)
+	}
+	if orders[0].Type != "STOP_MARKET" || !floatEq(orders[0].StopPrice, 58123.5) || orders[0].PositionSide != "LONG" {
+		t.Errorf("止损单错误: %+v", orders[0])
+	}
+
+	// 单独替换止损，止盈单保持不变
+	if err := replaceProtectiveOrders(trader, "BTCUSDT", "long", 0.123, 59000, 0); err != nil {
+		t.Fatalf("替换止损失败: %v", err)
+	}
+	orders, _ = trader.GetOpenOrders("BTCUSDT")
+	if len(orders) != 2 || orders[0].Type != "TAKE_PROFIT_MARKET" || !floatEq(orders[1].StopPrice, 59000) {
+		t.Fatalf("替换后挂单错误: %+v", orders)
+	}
+
+	// 价格跌破止损，整个仓位平仓
+	ledger.SetPrice("BTCUSDT", 58900)
+	positions, err := trader.GetPositions()
+	if err != nil || len(positions) != 0 {
+		t.Fatalf("止损触发后应无持仓: %+v, %v", positions, err)
+	}
+	balance, err := trader.GetBalance()
+	if err != nil {
+		t.Fatalf("GetBalance失败: %v", err)
+	}
+	want := 10000 - 0.123*60000*0.0004 - 0.123*58900*0.0004 + 0.123*(58900-60000)
+	if !floatEq(balance.TotalWalletBalance, want) {
+		t.Errorf("钱包余额 %.6f, 期望 %.6f", balance.TotalWalletBalance, want)
+	}
+}
+
+func TestBinanceLimitEntryFillsWhenPriceCrosses(t *testing.T) {
+	ledger, trader := newFakeBinance(t)
+
+	result, err := trader.OpenLongLimit("BTCUSDT", 0.01, 59000.04, 5, TimeInForceGTC)
+	if err != nil {
+		t.Fatalf("限价开多失败: %v", err)
+	}
+	if result.Status != OrderStatusNew {
+		t.Fatalf("低于市价的限价买单应挂单: %+v", result)
+	}
+
+	ledger.SetPrice("BTCUSDT", 58990)
+	order, err := trader.GetOrder("BTCUSDT", result.OrderID)
+	if err != nil {
+		t.Fatalf("GetOrder失败: %v", err)
+	}
+	if order.Status != OrderStatusFilled || !floatEq(order.ExecutedQty, 0.01) || !floatEq(order.AvgPrice, 58990) {
+		t.Errorf("价格穿过限价后应成交: %+v", order)
+	}
+
+	// 只做Maker单会立即成交时被拒绝
+	if _, err := trader.OpenShortLimit("BTCUSDT", 0.01, 58000, 5, TimeInForcePostOnly); err == nil {
+		t.Error("会立即成交的只做Maker单应被拒绝")
+	}
+}
+
+func TestBinanceLimitEntryQueriesFillsOnlyWhenFilled(t *testing.T) {
+	ledger := fakeexchange.NewLedger(10000, 0.0004)
+	ledger.AddSymbol(fakeexchange.SymbolSpec{Symbol: "BTCUSDT", StepSize: 0.001, TickSize: 0.1}, 60000)
+	apiKey := "binance-" + t.Name()
+	server := fakeexchange.NewBinance(ledger, apiKey, "binance-secret")
+	t.Cleanup(server.Close)
+	trader := NewFuturesTraderWithBaseURL(apiKey, "binance-secret", server.URL)
+	trader.cacheDuration, trader.leverageCooldown, trader.marginTypeCooldown = 0, 0, 0
+
+	userTrades := func() int {
+		n := 0
+		for _, r := range server.Requests() {
+			if strings.HasSuffix(r, "/userTrades") {
+				n++
+			}
+		}
+		return n
+	}
+
+	// 挂单中的限价单没有成交，不查询成交明细
+	if _, err := trader.OpenLongLimit("BTCUSDT", 0.01, 59000, 5, TimeInForceGTC); err != nil {
+		t.Fatalf("限价开多失败: %v", err)
+	}
+	if n := userTrades(); n != 0 {
+		t.Errorf("未成交的限价单不应查询成交明细: %d次", n)
+	}
+
+	// 立即成交的限价单按成交明细补充手续费
+	result, err := trader.OpenLongLimit("BTCUSDT", 0.01, 61000, 5, TimeInForceGTC)
+	if err != nil {
+		t.Fatalf("限价开多失败: %v", err)
+	}
+	if n := userTrades(); n != 1 || !floatEq(result.Fee, 0.01*60000*0.0004) || result.FeeAsset != "USDT" {
+		t.Errorf("已成交的限价单应查询成交明细: %d次 %+v", n, result)
+	}
+}
+
+func TestBinanceOneWayCloseIsReduceOnly(t *testing.T) {
+	ledger, trader := newFakeBinance(t)
+	if err := trader.SetPositionMode(PositionModeOneWay); err != nil {
+		t.Fatalf("SetPositionMode失败: %v", err)
+	}
+	if ledger.DualSide() {
+		t.Fatal("交易所应已切换为单向持仓")
+	}
+
+	if _, err := trader.OpenShort("BTCUSDT", 0.05, 10); err != nil {
+		t.Fatalf("开空仓失败: %v", err)
+	}
+	// 平仓数量超过持仓时只减仓单被拒绝，而不是反向开多
+	if _, err := trader.CloseShort("BTCUSDT", 0.08); err == nil {
+		t.Fatal("超过持仓的只减仓平仓单应被拒绝")
+	}
+	if _, err := trader.CloseShort("BTCUSDT", 0); err != nil {
+		t.Fatalf("平空仓失败: %v", err)
+	}
+	if positions := ledger.Positions(); len(positions) != 0 {
+		t.Errorf("平仓后应无持仓: %+v", positions)
+	}
+
+	// 签名错误的请求被拒绝
+	bad := NewFuturesTraderWithBaseURL("binance-"+t.Name(), "wrong-secret", trader.client.BaseURL)
+	if _, err := bad.GetBalance(); err == nil || !strings.Contains(err.Error(), "Signature") {
+		t.Errorf("签名错误应被拒绝: %v", err)
+	}
+}
+
+func TestBinanceTrailingStop(t *testing.T) {
+	ledger, trader := newFakeBinance(t)
+	if _, err := trader.OpenLong("BTCUSDT", 0.1, 10); err != nil {
+		t.Fatalf("开多仓失败: %v", err)
+	}
+
+	if err := trader.SetTrailingStop("BTCUSDT", "LONG", 0.1, 61000, 1); err != nil {
+		t.Fatalf("设置追踪止损失败: %v", err)
+	}
+	// 再次设置替换原有的追踪止损
+	if err := trader.SetTrailingStop("BTCUSDT", "LONG", 0.1, 61000, 1.5); err != nil {
+		t.Fatalf("替换追踪止损失败: %v", err)
+	}
+	orders, err := trader.GetOpenOrders("BTCUSDT")
+	if err != nil || len(orders) != 1 {
+		t.Fatalf("应只有1个追踪止损单: %+v, %v", orders, err)
+	}
+	if o := orders[0]; o.Type != CloseOrderTrailingStop || !floatEq(o.CallbackRate, 1.5) || !floatEq(o.ActivationPrice, 61000) || o.PositionSide != "LONG" {
+		t.Errorf("追踪止损单错误: %+v", o)
+	}
+
+	// 激活后从最高价61500回调1.5%（60577.5）才触发
+	for _, price := range []float64{61500, 61000, 60800} {
+		ledger.SetPrice("BTCUSDT", price)
+		if positions, _ := trader.GetPositions(); len(positions) != 1 {
+			t.Fatalf("价格%.0f不应触发追踪止损", price)
+		}
+	}
+	ledger.SetPrice("BTCUSDT", 60500)
+	if positions, _ := trader.GetPositions(); len(positions) != 0 {
+		t.Fatalf("追踪止损触发后应无持仓: %+v", positions)
+	}
+
+	if _, err := trader.OpenLong("BTCUSDT", 0.1, 10); err != nil {
+		t.Fatalf("开多仓失败: %v", err)
+	}
+	if err := trader.SetTrailingStop("BTCUSDT", "LONG", 0.1, 60000, 1); err == nil {
+		t.Error("多头激活价低于当前价应被拒绝")
+	}
+}
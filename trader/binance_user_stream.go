@@ -0,0 +1,316 @@
+package trader
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adshao/go-binance/v2/futures"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// 币安用户数据流地址（后接listenKey）
+	binanceUserStreamURL = "wss://fstream.binance.com/ws"
+	// listenKey有效期60分钟，每30分钟续期一次
+	binanceListenKeyKeepalive = 30 * time.Minute
+	// 断线后重连间隔
+	binanceUserStreamReconnect = 5 * time.Second
+)
+
+// binanceUserStream 币安用户数据流（ORDER_TRADE_UPDATE / ACCOUNT_UPDATE）
+type binanceUserStream struct {
+	client            *futures.Client
+	wsBaseURL         string
+	keepaliveInterval time.Duration
+	reconnectDelay    time.Duration
+	onAccountUpdate   func() // 账户余额或持仓变化时回调（用于清空缓存）
+
+	mu      sync.Mutex
+	pending map[int64]*CloseFill // 部分成交中的平仓订单
+	fills   []CloseFill          // 已完成、待取走的平仓成交
+
+	stopC chan struct{}
+	doneC chan struct{}
+}
+
+// StartUserDataStream 启动用户数据推送（实现CloseFillStreamer）
+func (t *FuturesTrader) StartUserDataStream() error {
+	t.userStreamMutex.Lock()
+	defer t.userStreamMutex.Unlock()
+
+	if t.userStream != nil {
+		return nil
+	}
+
+	stream := &binanceUserStream{
+		client:            t.client,
+		wsBaseURL:         t.userStreamURL,
+		keepaliveInterval: binanceListenKeyKeepalive,
+		reconnectDelay:    binanceUserStreamReconnect,
+		onAccountUpdate:   t.invalidateCache,
+		pending:           make(map[int64]*CloseFill),
+	}
+	if err := stream.start(); err != nil {
+		return err
+	}
+	t.userStream = stream
+	return nil
+}
+
+// StopUserDataStream 停止用户数据推送
+func (t *FuturesTrader) StopUserDataStream() {
+	t.userStreamMutex.Lock()
+	stream := t.userStream
+	t.userStream = nil
+	t.userStreamMutex.Unlock()
+
+	if stream != nil {
+		stream.stop()
+	}
+}
+
+// DrainCloseFills 取出上次调用以来收到的平仓成交
+func (t *FuturesTrader) DrainCloseFills() []CloseFill {
+	t.userStreamMutex.Lock()
+	stream := t.userStream
+	t.userStreamMutex.Unlock()
+
+	if stream == nil {
+		return nil
+	}
+	return stream.drain()
+}
+
+// invalidateCache 清空余额和持仓缓存（收到账户推送后下次查询走API）
+func (t *FuturesTrader) invalidateCache() {
+	t.balanceCacheMutex.Lock()
+	t.cachedBalance = nil
+	t.balanceCacheMutex.Unlock()
+
+	t.positionsCacheMutex.Lock()
+	t.cachedPositions = nil
+	t.positionsCacheMutex.Unlock()
+}
+
+// start 建立首个连接（失败直接返回错误），之后在后台维持连接
+func (s *binanceUserStream) start() error {
+	conn, listenKey, err := s.connect()
+	if err != nil {
+		return err
+	}
+
+	s.stopC = make(chan struct{})
+	s.doneC = make(chan struct{})
+	go s.run(conn, listenKey)
+
+	log.Printf("📡 币安用户数据流已连接")
+	return nil
+}
+
+// stop 关闭连接并等待后台goroutine退出
+func (s *binanceUserStream) stop() {
+	close(s.stopC)
+	<-s.doneC
+	log.Printf("📡 币安用户数据流已关闭")
+}
+
+// connect 申请listenKey并建立websocket连接
+func (s *binanceUserStream) connect() (*websocket.Conn, string, error) {
+	listenKey, err := s.client.NewStartUserStreamService().Do(context.Background())
+	if err != nil {
+		return nil, "", fmt.Errorf("获取listenKey失败: %w", err)
+	}
+
+	conn, _, err := websocket.DefaultDialer.Dial(s.wsBaseURL+"/"+listenKey, nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("连接用户数据流失败: %w", err)
+	}
+	return conn, listenKey, nil
+}
+
+// run 读取推送，断线或listenKey过期后自动重连
+func (s *binanceUserStream) run(conn *websocket.Conn, listenKey string) {
+	defer close(s.doneC)
+
+	for {
+		err := s.serve(conn, listenKey)
+
+		select {
+		case <-s.stopC:
+			return
+		default:
+		}
+		log.Printf("⚠️ 币安用户数据流断开: %v，%v后重连", err, s.reconnectDelay)
+
+		for {
+			select {
+			case <-s.stopC:
+				return
+			case <-time.After(s.reconnectDelay):
+			}
+
+			conn, listenKey, err = s.connect()
+			if err == nil {
+				log.Printf("📡 币安用户数据流已重连")
+				break
+			}
+			log.Printf("⚠️ 币安用户数据流重连失败: %v", err)
+		}
+	}
+}
+
+// serve 处理单个连接直到断开，期间定时续期listenKey
+func (s *binanceUserStream) serve(conn *websocket.Conn, listenKey string) error {
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		ticker := time.NewTicker(s.keepaliveInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-s.stopC:
+				// 关闭连接以中断ReadMessage
+				conn.Close()
+				return
+			case <-ticker.C:
+				if err := s.client.NewKeepaliveUserStreamService().ListenKey(listenKey).Do(context.Background()); err != nil {
+					log.Printf("⚠️ 续期listenKey失败: %v", err)
+				}
+			}
+		}
+	}()
+	defer conn.Close()
+
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+		if expired := s.handleMessage(message); expired {
+			return fmt.Errorf("listenKey已过期")
+		}
+	}
+}
+
+// handleMessage 处理一条推送，返回listenKey是否已过期
+func (s *binanceUserStream) handleMessage(message []byte) bool {
+	event := new(futures.WsUserDataEvent)
+	if err := json.Unmarshal(message, event); err != nil {
+		// 未关注的事件类型（如新增的事件）直接忽略
+		return false
+	}
+
+	switch event.Event {
+	case futures.UserDataEventTypeOrderTradeUpdate:
+		s.handleOrderUpdate(event.OrderTradeUpdate)
+	case futures.UserDataEventTypeAccountUpdate:
+		if s.onAccountUpdate != nil {
+			s.onAccountUpdate()
+		}
+	case futures.UserDataEventTypeListenKeyExpired:
+		return true
+	}
+	return false
+}
+
+// handleOrderUpdate 按订单累计平仓成交，订单结束时生成CloseFill
+func (s *binanceUserStream) handleOrderUpdate(u futures.WsOrderTradeUpdate) {
+	side := closedPositionSide(u)
+	if side == "" {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fill := s.pending[u.ID]
+	if u.ExecutionType == futures.OrderExecutionTypeTrade {
+		qty, _ := strconv.ParseFloat(u.LastFilledQty, 64)
+		price, _ := strconv.ParseFloat(u.LastFilledPrice, 64)
+		pnl, _ := strconv.ParseFloat(u.RealizedPnL, 64)
+		commission, _ := strconv.ParseFloat(u.Commission, 64)
+
+		if fill == nil {
+			fill = &CloseFill{
+				Symbol:    u.Symbol,
+				Side:      side,
+				OrderID:   u.ID,
+				OrderType: closeOrderType(u),
+				FeeAsset:  u.CommissionAsset,
+			}
+			s.pending[u.ID] = fill
+		}
+		if qty > 0 {
+			fill.Price = (fill.Price*fill.Quantity + price*qty) / (fill.Quantity + qty)
+			fill.Quantity += qty
+		}
+		fill.RealizedPnL += pnl
+		if u.CommissionAsset == fill.FeeAsset {
+			fill.Fee += commission
+		}
+		fill.Time = time.UnixMilli(u.TradeTime)
+	}
+
+	switch u.Status {
+	case futures.OrderStatusTypeFilled, futures.OrderStatusTypeCanceled, futures.OrderStatusTypeExpired:
+		// 订单结束（撤单/过期时保留已成交部分）
+		if fill != nil {
+			delete(s.pending, u.ID)
+			s.fills = append(s.fills, *fill)
+		}
+	}
+}
+
+// drain 取出已完成的平仓成交
+func (s *binanceUserStream) drain() []CloseFill {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fills := s.fills
+	s.fills = nil
+	return fills
+}
+
+// closedPositionSide 判断订单平的是哪个方向的仓位，开仓订单返回""
+func closedPositionSide(u futures.WsOrderTradeUpdate) string {
+	switch u.PositionSide {
+	case futures.PositionSideTypeLong:
+		if u.Side == futures.SideTypeSell {
+			return "long"
+		}
+	case futures.PositionSideTypeShort:
+		if u.Side == futures.SideTypeBuy {
+			return "short"
+		}
+	default:
+		// 单向持仓模式：只有只减仓/平仓单才是平仓
+		if u.IsReduceOnly || u.IsClosingPosition {
+			if u.Side == futures.SideTypeSell {
+				return "long"
+			}
+			return "short"
+		}
+	}
+	return ""
+}
+
+// closeOrderType 平仓订单的原始类型（止损止盈单触发后o会变为MARKET，ot保留原始类型）
+func closeOrderType(u futures.WsOrderTradeUpdate) string {
+	// 强平单clientOrderId以autoclose-开头，自动减仓以adl_autoclose开头
+	if strings.HasPrefix(u.ClientOrderID, "autoclose-") || strings.HasPrefix(u.ClientOrderID, "adl_autoclose") {
+		return CloseOrderLiquidation
+	}
+	if u.OriginalType != "" {
+		return string(u.OriginalType)
+	}
+	return string(u.Type)
+}
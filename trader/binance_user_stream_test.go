@@ -0,0 +1,233 @@
+package trader
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// fakeBinanceUserStream 本地模拟的币安listenKey接口和用户数据流websocket
+type fakeBinanceUserStream struct {
+	t *testing.T
+
+	mu         sync.Mutex
+	listenKeys int                        // 已申请的listenKey数量
+	conns      map[string]*websocket.Conn // listenKey -> 服务端连接
+	connected  chan string
+}
+
+func newFakeBinanceUserStream(t *testing.T) (*fakeBinanceUserStream, *FuturesTrader) {
+	f := &fakeBinanceUserStream{
+		t:         t,
+		conns:     make(map[string]*websocket.Conn),
+		connected: make(chan string, 4),
+	}
+	server := httptest.NewServer(http.HandlerFunc(f.handle))
+	t.Cleanup(server.Close)
+
+	trader := NewFuturesTrader("stream-key", "stream-secret")
+	trader.client.BaseURL = server.URL
+	trader.userStreamURL = "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+	t.Cleanup(trader.StopUserDataStream)
+	return f, trader
+}
+
+func (f *fakeBinanceUserStream) handle(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == "/fapi/v1/listenKey":
+		f.mu.Lock()
+		if r.Method == http.MethodPost {
+			f.listenKeys++
+		}
+		key := fmt.Sprintf("listen-key-%d", f.listenKeys)
+		f.mu.Unlock()
+		fmt.Fprintf(w, `{"listenKey":"%s"}`, key)
+
+	case strings.HasPrefix(r.URL.Path, "/ws/"):
+		upgrader := websocket.Upgrader{}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			f.t.Errorf("websocket升级失败: %v", err)
+			return
+		}
+		key := strings.TrimPrefix(r.URL.Path, "/ws/")
+		f.mu.Lock()
+		f.conns[key] = conn
+		f.mu.Unlock()
+		f.connected <- key
+
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// push 向指定listenKey的连接推送一条事件
+func (f *fakeBinanceUserStream) push(key, message string) {
+	f.mu.Lock()
+	conn := f.conns[key]
+	f.mu.Unlock()
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(message)); err != nil {
+		f.t.Fatalf("推送失败: %v", err)
+	}
+}
+
+func (f *fakeBinanceUserStream) waitConnected() string {
+	select {
+	case key := <-f.connected:
+		return key
+	case <-time.After(5 * time.Second):
+		f.t.Fatal("等待用户数据流连接超时")
+		return ""
+	}
+}
+
+// orderTradeUpdate 构造ORDER_TRADE_UPDATE事件
+func orderTradeUpdate(orderID int64, side, positionSide, origType, status, lastQty, lastPrice, pnl, fee string) string {
+	return fmt.Sprintf(`{"e":"ORDER_TRADE_UPDATE","E":1700000000000,"T":1700000000000,"o":{"s":"BTCUSDT","c":"web_1","S":"%s","o":"MARKET","ot":"%s","x":"TRADE","X":"%s","i":%d,"l":"%s","L":"%s","N":"USDT","n":"%s","T":1700000000000,"ps":"%s","rp":"%s"}}`,
+		side, origType, status, orderID, lastQty, lastPrice, fee, positionSide, pnl)
+}
+
+func waitCloseFills(t *testing.T, trader *FuturesTrader, n int) []CloseFill {
+	var fills []CloseFill
+	deadline := time.Now().Add(5 * time.Second)
+	for len(fills) < n && time.Now().Before(deadline) {
+		fills = append(fills, trader.DrainCloseFills()...)
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(fills) != n {
+		t.Fatalf("应收到%d条平仓成交，实际 %d: %+v", n, len(fills), fills)
+	}
+	return fills
+}
+
+func TestBinanceUserStreamAggregatesStopLossFills(t *testing.T) {
+	fake, trader := newFakeBinanceUserStream(t)
+
+	if err := trader.StartUserDataStream(); err != nil {
+		t.Fatalf("StartUserDataStream失败: %v", err)
+	}
+	key := fake.waitConnected()
+
+	// 开仓成交不是平仓，应忽略
+	fake.push(key, orderTradeUpdate(1, "BUY", "LONG", "MARKET", "FILLED", "0.02", "60000", "0", "0.48"))
+	// 止损单触发后分两笔成交
+	fake.push(key, orderTradeUpdate(2, "SELL", "LONG", "STOP_MARKET", "PARTIALLY_FILLED", "0.01", "58000", "-20", "0.23"))
+	fake.push(key, orderTradeUpdate(2, "SELL", "LONG", "STOP_MARKET", "FILLED", "0.01", "57900", "-21", "0.23"))
+
+	fill := waitCloseFills(t, trader, 1)[0]
+	if fill.Key() != "BTCUSDT_long" || fill.OrderID != 2 || fill.OrderType != CloseOrderStopMarket {
+		t.Errorf("平仓成交识别错误: %+v", fill)
+	}
+	if !floatEq(fill.Quantity, 0.02) || !floatEq(fill.Price, 57950) || !floatEq(fill.RealizedPnL, -41) ||
+		!floatEq(fill.Fee, 0.46) || fill.FeeAsset != "USDT" {
+		t.Errorf("成交汇总错误: %+v", fill)
+	}
+
+	// 账户推送应清空余额缓存
+	trader.balanceCacheMutex.Lock()
+	trader.cachedBalance = &Balance{TotalWalletBalance: 1}
+	trader.balanceCacheMutex.Unlock()
+	fake.push(key, `{"e":"ACCOUNT_UPDATE","E":1700000000000,"T":1700000000000,"a":{"m":"ORDER","B":[],"P":[]}}`)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		trader.balanceCacheMutex.RLock()
+		cleared := trader.cachedBalance == nil
+		trader.balanceCacheMutex.RUnlock()
+		if cleared {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("ACCOUNT_UPDATE后应清空余额缓存")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestBinanceUserStreamReconnectsOnListenKeyExpired(t *testing.T) {
+	fake, trader := newFakeBinanceUserStream(t)
+
+	if err := trader.StartUserDataStream(); err != nil {
+		t.Fatalf("StartUserDataStream失败: %v", err)
+	}
+	trader.userStream.reconnectDelay = 10 * time.Millisecond
+	key := fake.waitConnected()
+
+	fake.push(key, `{"e":"listenKeyExpired","E":1700000000000}`)
+	newKey := fake.waitConnected()
+	if newKey == key {
+		t.Fatalf("过期后应申请新的listenKey")
+	}
+
+	fake.push(newKey, orderTradeUpdate(7, "BUY", "SHORT", "TAKE_PROFIT_MARKET", "FILLED", "0.5", "3000", "50", "0.6"))
+	fill := waitCloseFills(t, trader, 1)[0]
+	if fill.Key() != "BTCUSDT_short" || fill.OrderType != CloseOrderTakeProfitMarket {
+		t.Errorf("重连后平仓成交识别错误: %+v", fill)
+	}
+}
+
+// streamingTrader 带成交推送的测试交易器（未实现的Trader方法会panic）
+type streamingTrader struct {
+	Trader
+	positions []Position
+	price     float64
+	fills     []CloseFill
+}
+
+func (s *streamingTrader) GetPositions() ([]Position, error)             { return s.positions, nil }
+func (s *streamingTrader) GetMarketPrice(symbol string) (float64, error) { return s.price, nil }
+func (s *streamingTrader) StartUserDataStream() error                    { return nil }
+func (s *streamingTrader) StopUserDataStream()                           {}
+func (s *streamingTrader) DrainCloseFills() []CloseFill {
+	fills := s.fills
+	s.fills = nil
+	return fills
+}
+
+func TestDetectClosedPositionsUsesStreamedFills(t *testing.T) {
+	st := &streamingTrader{price: 60500}
+	at := &AutoTrader{
+		trader:                st,
+		lastPositionSnapshot:  make(map[string]*PositionSnapshot),
+		positionFirstSeenTime: make(map[string]int64),
+		positionPnLTracking:   make(map[string]*PnLTracking),
+	}
+	at.lastPositionSnapshot["BTCUSDT_long"] = &PositionSnapshot{
+		Symbol: "BTCUSDT", Side: "long", Quantity: 0.02, EntryPrice: 60000, StopLoss: 58000, TakeProfit: 65000,
+	}
+	at.lastPositionSnapshot["ETHUSDT_short"] = &PositionSnapshot{
+		Symbol: "ETHUSDT", Side: "short", Quantity: 1, EntryPrice: 3000, StopLoss: 3100, TakeProfit: 2800,
+	}
+	// 当前价格离止损很远，按价格推断会误判为普通平仓；推送显示是止损单成交
+	st.fills = []CloseFill{
+		{Symbol: "BTCUSDT", Side: "long", OrderID: 9, OrderType: CloseOrderStopMarket, Quantity: 0.02, Price: 57950, RealizedPnL: -41, Fee: 0.46, FeeAsset: "USDT"},
+	}
+
+	closed := at.detectClosedPositions()
+	if len(closed) != 2 {
+		t.Fatalf("应检测到2个平仓，实际 %d", len(closed))
+	}
+	byKey := make(map[string]ClosedPositionInfo)
+	for _, c := range closed {
+		byKey[c.Symbol+"_"+c.Side] = c
+	}
+
+	btc := byKey["BTCUSDT_long"]
+	if btc.Action != "close_long_sl" || btc.ClosePrice != 57950 || btc.PnL != -41 || btc.OrderID != 9 || btc.Fee != 0.46 {
+		t.Errorf("应使用推送的成交信息: %+v", btc)
+	}
+
+	// 没有推送的仓位仍按价格推断
+	eth := byKey["ETHUSDT_short"]
+	if eth.Action != "close_short_sl" || eth.ClosePrice != 60500 {
+		t.Errorf("无推送时应按市价推断: %+v", eth)
+	}
+	if len(at.lastPositionSnapshot) != 0 {
+		t.Errorf("平仓后应清理快照: %v", at.lastPositionSnapshot)
+	}
+}
@@ -0,0 +1,351 @@
+package trader
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BracketState 止损止盈联动单状态
+type BracketState string
+
+const (
+	BracketActive           BracketState = "active"             // 止损止盈都在挂单
+	BracketBroken           BracketState = "broken"             // 持仓仍在，但缺少止损或止盈单
+	BracketStopLossFilled   BracketState = "stop_loss_filled"   // 止损成交，剩余的止盈单已撤销
+	BracketTakeProfitFilled BracketState = "take_profit_filled" // 止盈成交，剩余的止损单已撤销
+	BracketClosed           BracketState = "closed"             // 持仓以其他方式平掉，剩余保护单已撤销
+)
+
+// 联动方式（Bracket.Linkage）
+const (
+	BracketLinkageNative  = "native"  // 交易所原生分组（Hyperliquid positionTpsl）
+	BracketLinkageMonitor = "monitor" // 客户端监控，一侧成交后撤销另一侧
+)
+
+// Bracket 一个持仓的止损止盈联动单（OCO：一侧成交后另一侧撤销）
+type Bracket struct {
+	Symbol            string       `json:"symbol"`
+	PositionSide      string       `json:"position_side"` // "LONG" 或 "SHORT"
+	Quantity          float64      `json:"quantity"`
+	StopLoss          float64      `json:"stop_loss"`
+	TakeProfit        float64      `json:"take_profit"`
+	StopLossOrderID   int64        `json:"stop_loss_order_id"`
+	TakeProfitOrderID int64        `json:"take_profit_order_id"`
+	Linkage           string       `json:"linkage"`
+	State             BracketState `json:"state"`
+	UpdatedAt         time.Time    `json:"updated_at"`
+}
+
+// Key 对应持仓的唯一标识，与Position.Key()一致
+func (b *Bracket) Key() string {
+	return b.Symbol + "_" + strings.ToLower(b.PositionSide)
+}
+
+// Done 联动单是否已结束（持仓已平）
+func (b *Bracket) Done() bool {
+	return b.State == BracketStopLossFilled || b.State == BracketTakeProfitFilled || b.State == BracketClosed
+}
+
+// placeProtectiveOrders 为新持仓设置止损止盈，支持联动单的交易所作为一对下单
+// 失败时只记录日志（持仓已经建立，不能因保护单失败而中断）
+func placeProtectiveOrders(t Trader, symbol, positionSide string, quantity, stopLoss, takeProfit float64) {
+	if bt, ok := t.(BracketTrader); ok && stopLoss > 0 && takeProfit > 0 {
+		if _, err := bt.PlaceBracket(symbol, positionSide, quantity, stopLoss, takeProfit); err != nil {
+			log.Printf("  ⚠ 设置止损止盈联动单失败: %v", err)
+		}
+		return
+	}
+
+	if err := t.SetStopLoss(symbol, positionSide, quantity, stopLoss); err != nil {
+		log.Printf("  ⚠ 设置止损失败: %v", err)
+	}
+	if err := t.SetTakeProfit(symbol, positionSide, quantity, takeProfit); err != nil {
+		log.Printf("  ⚠ 设置止盈失败: %v", err)
+	}
+}
+
+// positionBrackets 持仓（symbol_side）对应的联动单，交易器不支持联动单时返回nil
+func positionBrackets(t Trader) map[string]Bracket {
+	bt, ok := t.(BracketTrader)
+	if !ok {
+		return nil
+	}
+	brackets := bt.GetBrackets()
+	result := make(map[string]Bracket, len(brackets))
+	for _, b := range brackets {
+		result[b.Key()] = b
+	}
+	return result
+}
+
+// bracketList 交易器跟踪中的联动单（用于状态接口，不支持联动单时为空）
+func bracketList(t Trader) []Bracket {
+	if bt, ok := t.(BracketTrader); ok {
+		return bt.GetBrackets()
+	}
+	return []Bracket{}
+}
+
+// bracketMonitor 跟踪持仓的止损止盈联动单：持仓平掉后撤销剩余的一侧
+// 没有原生联动的交易所（币安、Aster）靠它实现OCO；原生联动的交易所用它获取联动单状态
+type bracketMonitor struct {
+	mu       sync.Mutex
+	brackets map[string]*Bracket     // symbol_side -> 联动单
+	closing  map[string]BracketState // 上次检查时持仓已不存在的联动单 -> 确认后的结束状态
+	running  bool
+	interval time.Duration
+	checkMu  sync.Mutex // 下单后的立即检查与后台轮询串行执行
+
+	trader Trader
+}
+
+// newBracketMonitor 创建联动单监控（通过交易器查询持仓、挂单和撤单）
+func newBracketMonitor(t Trader) *bracketMonitor {
+	return &bracketMonitor{
+		brackets: make(map[string]*Bracket),
+		closing:  make(map[string]BracketState),
+		interval: 5 * time.Second,
+		trader:   t,
+	}
+}
+
+// placeMonitoredBracket 分别下止损止盈单，由监控在一侧成交后撤销另一侧
+func placeMonitoredBracket(t Trader, m *bracketMonitor, symbol, positionSide string, quantity, stopLoss, takeProfit float64) (*Bracket, error) {
+	if err := t.SetStopLoss(symbol, positionSide, quantity, stopLoss); err != nil {
+		return nil, fmt.Errorf("设置止损失败: %w", err)
+	}
+	if err := t.SetTakeProfit(symbol, positionSide, quantity, takeProfit); err != nil {
+		return nil, fmt.Errorf("设置止盈失败: %w", err)
+	}
+
+	b := m.track(&Bracket{
+		Symbol:       symbol,
+		PositionSide: positionSide,
+		Quantity:     quantity,
+		StopLoss:     stopLoss,
+		TakeProfit:   takeProfit,
+		Linkage:      BracketLinkageMonitor,
+	})
+	return &b, nil
+}
+
+// track 开始跟踪联动单（替换该持仓原有的联动单），立即检查一次以获取两侧的订单ID
+func (m *bracketMonitor) track(b *Bracket) Bracket {
+	b.State = BracketActive
+	b.UpdatedAt = time.Now()
+
+	m.mu.Lock()
+	m.brackets[b.Key()] = b
+	delete(m.closing, b.Key())
+	start := !m.running
+	m.running = true
+	m.mu.Unlock()
+
+	m.check()
+	if start {
+		go m.run()
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return *b
+}
+
+// list 所有联动单（包括已结束的）
+func (m *bracketMonitor) list() []Bracket {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	result := make([]Bracket, 0, len(m.brackets))
+	for _, b := range m.brackets {
+		result = append(result, *b)
+	}
+	return result
+}
+
+// run 轮询直到没有未结束的联动单
+func (m *bracketMonitor) run() {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if m.check() {
+			continue
+		}
+		// 检查期间可能又有新的联动单
+		m.mu.Lock()
+		if !m.hasLiveLocked() {
+			m.running = false
+			m.mu.Unlock()
+			return
+		}
+		m.mu.Unlock()
+	}
+}
+
+// hasLiveLocked 是否还有未结束的联动单（调用方需持有锁）
+func (m *bracketMonitor) hasLiveLocked() bool {
+	for _, b := range m.brackets {
+		if !b.Done() {
+			return true
+		}
+	}
+	return false
+}
+
+// bracketCancel 需要撤销的剩余保护单
+type bracketCancel struct {
+	key     string // 所属联动单
+	symbol  string
+	orderID int64
+	label   string
+}
+
+// check 用当前持仓和挂单更新联动单状态，返回是否还有未结束的联动单
+// 连续两次检查都没有持仓时才撤销剩余的保护单（持仓接口可能有缓存，刚下的止损止盈单不能被误撤），
+// 剩余保护单全部撤销成功后联动单才结束，撤单失败时下次检查重试
+func (m *bracketMonitor) check() bool {
+	m.checkMu.Lock()
+	defer m.checkMu.Unlock()
+
+	m.mu.Lock()
+	symbols := make(map[string]bool)
+	for _, b := range m.brackets {
+		if !b.Done() {
+			symbols[b.Symbol] = true
+		}
+	}
+	m.mu.Unlock()
+	if len(symbols) == 0 {
+		return false
+	}
+
+	positions, err := m.trader.GetPositions()
+	if err != nil {
+		log.Printf("  ⚠ 联动单监控获取持仓失败: %v", err)
+		return true
+	}
+	open := make(map[string]bool, len(positions))
+	for _, pos := range positions {
+		open[pos.Key()] = true
+	}
+	orders := make(map[string][]Order, len(symbols))
+	for symbol := range symbols {
+		symbolOrders, err := m.trader.GetOpenOrders(symbol)
+		if err != nil {
+			log.Printf("  ⚠ 联动单监控获取 %s 挂单失败: %v", symbol, err)
+			continue
+		}
+		orders[symbol] = symbolOrders
+	}
+
+	m.mu.Lock()
+	var cancels []bracketCancel
+	closed := make(map[string]bool) // 本次确认持仓已平的联动单 -> 剩余保护单是否全部撤销成功
+	for key, b := range m.brackets {
+		if b.Done() {
+			continue
+		}
+		symbolOrders, ok := orders[b.Symbol]
+		if !ok {
+			continue
+		}
+
+		stopLoss, takeProfit := bracketLegs(symbolOrders, b.PositionSide)
+		prev := b.State
+		if open[key] {
+			if stopLoss != nil && takeProfit != nil {
+				b.State = BracketActive
+				// 止损或止盈被单独替换时跟随新订单
+				b.StopLossOrderID, b.StopLoss = stopLoss.OrderID, stopLoss.StopPrice
+				b.TakeProfitOrderID, b.TakeProfit = takeProfit.OrderID, takeProfit.StopPrice
+			} else {
+				b.State = BracketBroken
+				if prev != BracketBroken {
+					log.Printf("  ⚠️ %s 止损止盈联动单缺少一侧 (止损:%t 止盈:%t)", key, stopLoss != nil, takeProfit != nil)
+				}
+			}
+			delete(m.closing, key)
+		} else {
+			state, confirmed := m.closing[key]
+			if !confirmed {
+				// 持仓已平：原本两侧都在时，消失的一侧就是成交的一侧（第二次检查确认后生效）
+				state = BracketClosed
+				if prev == BracketActive && stopLoss == nil && takeProfit != nil {
+					state = BracketStopLossFilled
+				} else if prev == BracketActive && takeProfit == nil && stopLoss != nil {
+					state = BracketTakeProfitFilled
+				}
+				m.closing[key] = state
+				continue
+			}
+			remaining := 0
+			if stopLoss != nil {
+				cancels = append(cancels, bracketCancel{key, b.Symbol, stopLoss.OrderID, "止损"})
+				remaining++
+			}
+			if takeProfit != nil {
+				cancels = append(cancels, bracketCancel{key, b.Symbol, takeProfit.OrderID, "止盈"})
+				remaining++
+			}
+			log.Printf("  🔗 %s 持仓已平 (%s)，撤销剩余的%d个保护单", key, state, remaining)
+			closed[key] = true
+		}
+		if b.State != prev {
+			b.UpdatedAt = time.Now()
+		}
+	}
+	m.mu.Unlock()
+
+	for _, c := range cancels {
+		if err := m.trader.CancelOrder(c.symbol, c.orderID); err != nil {
+			log.Printf("  ⚠ 撤销剩余%s单失败，下次检查重试 (%s 订单%d): %v", c.label, c.symbol, c.orderID, err)
+			closed[c.key] = false
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key, ok := range closed {
+		// 撤单期间被新的联动单替换时（track会清除closing）不更新
+		state, pending := m.closing[key]
+		if !ok || !pending {
+			continue
+		}
+		b := m.brackets[key]
+		b.State = state
+		b.UpdatedAt = time.Now()
+		delete(m.closing, key)
+	}
+	return m.hasLiveLocked()
+}
+
+// bracketLegs 在挂单中找出该方向持仓的止损单和止盈单
+func bracketLegs(orders []Order, positionSide string) (stopLoss, takeProfit *Order) {
+	closeSide := "SELL"
+	if positionSide == "SHORT" {
+		closeSide = "BUY"
+	}
+	for i := range orders {
+		o := &orders[i]
+		// 单向持仓的订单没有持仓方向，按平仓方向匹配
+		oneWay := o.PositionSide == "" || o.PositionSide == "BOTH"
+		if o.PositionSide != positionSide && !(oneWay && o.Side == closeSide) {
+			continue
+		}
+		switch o.Type {
+		case CloseOrderStopMarket, CloseOrderStop:
+			if stopLoss == nil {
+				stopLoss = o
+			}
+		case CloseOrderTakeProfitMarket, CloseOrderTakeProfit:
+			if takeProfit == nil {
+				takeProfit = o
+			}
+		}
+	}
+	return stopLoss, takeProfit
+}
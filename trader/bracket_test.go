@@ -0,0 +1,208 @@
+package trader
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBinanceBracketCancelsStopLossAfterTakeProfit(t *testing.T) {
+	ledger, trader := newFakeBinance(t)
+	trader.brackets.interval = time.Hour // 测试中手动调用check
+
+	if _, err := trader.OpenLong("BTCUSDT", 0.1, 10); err != nil {
+		t.Fatalf("开多仓失败: %v", err)
+	}
+	b, err := trader.PlaceBracket("BTCUSDT", "LONG", 0.1, 58000, 63000)
+	if err != nil {
+		t.Fatalf("设置联动单失败: %v", err)
+	}
+	if b.State != BracketActive || b.Linkage != BracketLinkageMonitor || b.StopLossOrderID == 0 || b.TakeProfitOrderID == 0 {
+		t.Fatalf("联动单状态错误: %+v", b)
+	}
+
+	// 止盈触发后止损单仍挂着，连续两次检查都没有持仓时撤销
+	ledger.SetPrice("BTCUSDT", 63500)
+	if orders := ledger.OpenOrders("BTCUSDT"); len(orders) != 1 {
+		t.Fatalf("止盈触发后应剩下止损单: %+v", orders)
+	}
+	if !trader.brackets.check() || len(ledger.OpenOrders("BTCUSDT")) != 1 {
+		t.Fatal("首次没有持仓时不应撤单")
+	}
+	if trader.brackets.check() {
+		t.Error("持仓已平，不应再有未结束的联动单")
+	}
+	if orders := ledger.OpenOrders("BTCUSDT"); len(orders) != 0 {
+		t.Errorf("剩余的止损单应被撤销: %+v", orders)
+	}
+	brackets := trader.GetBrackets()
+	if len(brackets) != 1 || brackets[0].State != BracketTakeProfitFilled {
+		t.Errorf("联动单应为止盈成交: %+v", brackets)
+	}
+}
+
+func TestAsterBracketBrokenWhenLegCancelled(t *testing.T) {
+	ledger, trader := newFakeAster(t)
+	trader.brackets.interval = time.Hour
+
+	if _, err := trader.OpenShort("BTCUSDT", 0.05, 5); err != nil {
+		t.Fatalf("开空仓失败: %v", err)
+	}
+	b, err := trader.PlaceBracket("BTCUSDT", "SHORT", 0.05, 62000, 57000)
+	if err != nil {
+		t.Fatalf("设置联动单失败: %v", err)
+	}
+
+	// 止盈单被手动撤掉，持仓只剩止损保护
+	if _, err := ledger.CancelOrder("BTCUSDT", b.TakeProfitOrderID); err != nil {
+		t.Fatalf("撤销止盈单失败: %v", err)
+	}
+	if !trader.brackets.check() {
+		t.Error("持仓仍在，联动单应未结束")
+	}
+	if brackets := positionBrackets(trader); brackets["BTCUSDT_short"].State != BracketBroken {
+		t.Errorf("联动单应为broken: %+v", brackets)
+	}
+
+	// 止损触发后状态为已平（缺少一侧时无法判断是哪一侧成交）
+	ledger.SetPrice("BTCUSDT", 62500)
+	trader.brackets.check()
+	trader.brackets.check()
+	if brackets := positionBrackets(trader); brackets["BTCUSDT_short"].State != BracketClosed {
+		t.Errorf("联动单应为closed: %+v", brackets)
+	}
+}
+
+func TestHyperliquidBracketUsesPositionTpsl(t *testing.T) {
+	server, trader := newFakeHyperliquid(t)
+	trader.brackets.interval = time.Hour
+
+	if _, err := trader.OpenLong("ETHUSDT", 0.2, 5); err != nil {
+		t.Fatalf("开多仓失败: %v", err)
+	}
+	b, err := trader.PlaceBracket("ETHUSDT", "LONG", 0.2, 2900, 3200)
+	if err != nil {
+		t.Fatalf("设置联动单失败: %v", err)
+	}
+	groupings := server.Groupings()
+	if len(groupings) == 0 || groupings[len(groupings)-1] != "positionTpsl" {
+		t.Errorf("止损止盈应作为positionTpsl分组下单: %v", groupings)
+	}
+	if b.Linkage != BracketLinkageNative || b.State != BracketActive || !floatEq(b.StopLoss, 2900) || !floatEq(b.TakeProfit, 3200) {
+		t.Fatalf("联动单状态错误: %+v", b)
+	}
+
+	// 止损成交后交易所撤销同组的止盈单
+	server.Ledger.SetPrice("ETHUSDT", 2890)
+	trader.brackets.check()
+	trader.brackets.check()
+	if orders := server.Ledger.OpenOrders("ETHUSDT"); len(orders) != 0 {
+		t.Errorf("止盈单应随持仓撤销: %+v", orders)
+	}
+	if brackets := trader.GetBrackets(); len(brackets) != 1 || brackets[0].State != BracketClosed {
+		t.Errorf("联动单应为closed: %+v", brackets)
+	}
+}
+
+// flakyBracketTrader 持仓查询前几次读到旧数据、撤单可设置为失败的交易器
+type flakyBracketTrader struct {
+	*FuturesTrader
+	stalePositions int   // 剩余返回空持仓的次数
+	cancelErr      error // 非nil时撤单失败
+}
+
+func (t *flakyBracketTrader) GetPositions() ([]Position, error) {
+	if t.stalePositions > 0 {
+		t.stalePositions--
+		return nil, nil
+	}
+	return t.FuturesTrader.GetPositions()
+}
+
+func (t *flakyBracketTrader) CancelOrder(symbol string, orderID int64) error {
+	if t.cancelErr != nil {
+		return t.cancelErr
+	}
+	return t.FuturesTrader.CancelOrder(symbol, orderID)
+}
+
+func TestBracketMonitorIgnoresStalePositions(t *testing.T) {
+	ledger, trader := newFakeBinance(t)
+	if _, err := trader.OpenLong("BTCUSDT", 0.1, 10); err != nil {
+		t.Fatalf("开多仓失败: %v", err)
+	}
+
+	// 下单后的立即检查读到了旧的持仓数据，刚下的止损止盈单不能被撤销
+	flaky := &flakyBracketTrader{FuturesTrader: trader, stalePositions: 1}
+	monitor := newBracketMonitor(flaky)
+	monitor.interval = time.Hour
+	b, err := placeMonitoredBracket(flaky, monitor, "BTCUSDT", "LONG", 0.1, 58000, 63000)
+	if err != nil {
+		t.Fatalf("设置联动单失败: %v", err)
+	}
+	if b.Done() || len(ledger.OpenOrders("BTCUSDT")) != 2 {
+		t.Fatalf("只有一次没有持仓时不应结束联动单: %+v", b)
+	}
+
+	if !monitor.check() {
+		t.Error("持仓仍在，联动单应未结束")
+	}
+	if brackets := monitor.list(); len(brackets) != 1 || brackets[0].State != BracketActive || len(ledger.OpenOrders("BTCUSDT")) != 2 {
+		t.Errorf("读到持仓后联动单应恢复正常: %+v", brackets)
+	}
+}
+
+func TestBracketMonitorRetriesFailedCancel(t *testing.T) {
+	ledger, trader := newFakeBinance(t)
+	if _, err := trader.OpenLong("BTCUSDT", 0.1, 10); err != nil {
+		t.Fatalf("开多仓失败: %v", err)
+	}
+	flaky := &flakyBracketTrader{FuturesTrader: trader}
+	monitor := newBracketMonitor(flaky)
+	monitor.interval = time.Hour
+	if _, err := placeMonitoredBracket(flaky, monitor, "BTCUSDT", "LONG", 0.1, 58000, 63000); err != nil {
+		t.Fatalf("设置联动单失败: %v", err)
+	}
+
+	// 止盈成交后撤销止损单失败，联动单保持未结束
+	ledger.SetPrice("BTCUSDT", 63500)
+	flaky.cancelErr = errors.New("交易所繁忙")
+	monitor.check()
+	if !monitor.check() {
+		t.Fatal("撤单失败时联动单应未结束")
+	}
+	if brackets := monitor.list(); brackets[0].Done() || len(ledger.OpenOrders("BTCUSDT")) != 1 {
+		t.Fatalf("撤单失败时止损单应仍在: %+v", brackets)
+	}
+
+	// 下次检查重试撤单，成功后按止盈成交结束
+	flaky.cancelErr = nil
+	if monitor.check() {
+		t.Error("撤单成功后不应再有未结束的联动单")
+	}
+	if orders := ledger.OpenOrders("BTCUSDT"); len(orders) != 0 {
+		t.Errorf("剩余的止损单应被撤销: %+v", orders)
+	}
+	if brackets := monitor.list(); brackets[0].State != BracketTakeProfitFilled {
+		t.Errorf("联动单应为止盈成交: %+v", brackets)
+	}
+}
+
+func TestReplaceProtectiveOrdersUsesBracket(t *testing.T) {
+	ledger, trader := newFakeBinance(t)
+	trader.brackets.interval = time.Hour
+
+	if _, err := trader.OpenLong("BTCUSDT", 0.1, 10); err != nil {
+		t.Fatalf("开多仓失败: %v", err)
+	}
+	if err := replaceProtectiveOrders(trader, "BTCUSDT", "LONG", 0.1, 59000, 62000); err != nil {
+		t.Fatalf("替换止损止盈失败: %v", err)
+	}
+	if orders := ledger.OpenOrders("BTCUSDT"); len(orders) != 2 {
+		t.Fatalf("应有止损止盈两个挂单: %+v", orders)
+	}
+	brackets := positionBrackets(trader)
+	if b := brackets["BTCUSDT_long"]; b.State != BracketActive || !floatEq(b.StopLoss, 59000) || !floatEq(b.TakeProfit, 62000) {
+		t.Errorf("联动单状态错误: %+v", brackets)
+	}
+}
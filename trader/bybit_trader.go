@@ -0,0 +1,1256 @@
+package trader
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	bybitMainnetURL = "https://api.bybit.com"
+	bybitTestnetURL = "https://api-testnet.bybit.com"
+
+	// Bybit返回码
+	bybitCodeLeverageNotModified     = 110043 // 杠杆未修改
+	bybitCodePositionModeNotModified = 110025 // 持仓模式未修改
+)
+
+// BybitTrader Bybit V5统一账户 USDT永续合约交易器
+type BybitTrader struct {
+	apiKey     string
+	secretKey  string
+	recvWindow string
+	client     *http.Client
+	baseURL    string
+
+	// 缓存交易对精度信息
+	symbolPrecision map[string]SymbolPrecision
+	mu              sync.RWMutex
+
+	// 保证金模式和持仓模式
+	tradingModes
+
+	// 最近一次生成的orderLinkId（保证递增）
+	lastOrderLinkID int64
+}
+
+// bybitAPIError Bybit接口返回的业务错误（retCode != 0）
+type bybitAPIError struct {
+	Code int
+	Msg  string
+}
+
+func (e *bybitAPIError) Error() string {
+	return fmt.Sprintf("Bybit API错误 %d: %s", e.Code, e.Msg)
+}
+
+// isBybitCode 判断错误是否为指定的Bybit返回码
+func isBybitCode(err error, code int) bool {
+	var apiErr *bybitAPIError
+	return errors.As(err, &apiErr) && apiErr.Code == code
+}
+
+// NewBybitTrader 创建Bybit交易器
+// apiKey/secretKey: 在Bybit API管理页面创建（需开启合约交易权限）
+func NewBybitTrader(apiKey, secretKey string, testnet bool) *BybitTrader {
+	baseURL := bybitMainnetURL
+	if testnet {
+		baseURL = bybitTestnetURL
+	}
+
+	log.Printf("✓ Bybit交易器初始化成功 (testnet=%v)", testnet)
+
+	return &BybitTrader{
+		apiKey:          apiKey,
+		secretKey:       secretKey,
+		recvWindow:      "5000",
+		symbolPrecision: make(map[string]SymbolPrecision),
+		client: &http.Client{
+			Timeout: 30 * time.Second,
+			Transport: &http.Transport{
+				TLSHandshakeTimeout:   10 * time.Second,
+				ResponseHeaderTimeout: 10 * time.Second,
+				IdleConnTimeout:       90 * time.Second,
+			},
+		},
+		baseURL: baseURL,
+		// 默认双向持仓，保证金模式沿用账户当前设置
+		tradingModes: tradingModes{positionMode: PositionModeHedge},
+	}
+}
+
+// sign 生成签名: HMAC_SHA256(timestamp + apiKey + recvWindow + queryString/body)
+func (t *BybitTrader) sign(timestamp, payload string) string {
+	mac := hmac.New(sha256.New, []byte(t.secretKey))
+	mac.Write([]byte(timestamp + t.apiKey + t.recvWindow + payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// request 发送请求并解析返回的result（带重试机制）
+func (t *BybitTrader) request(method, endpoint string, params map[string]interface{}, signed bool) (json.RawMessage, error) {
+	const maxRetries = 3
+	var lastErr error
+
+	for attempt := 1; attempt <= maxRetries; attempt++ {
+		result, err := t.doRequest(method, endpoint, params, signed)
+		if err == nil {
+			return result, nil
+		}
+
+		lastErr = err
+
+		// 如果是网络超时或临时错误，重试
+		if strings.Contains(err.Error(), "timeout") ||
+			strings.Contains(err.Error(), "connection reset") ||
+			strings.Contains(err.Error(), "EOF") {
+			if attempt < maxRetries {
+				time.Sleep(time.Duration(attempt) * time.Second)
+				continue
+			}
+		}
+
+		// 其他错误（业务错误、4xx等）不重试
+		return nil, err
+	}
+
+	return nil, fmt.Errorf("请求失败（已重试%d次）: %w", maxRetries, lastErr)
+}
+
+// doRequest 执行实际的HTTP请求
+// GET请求参数放在querystring中，POST请求参数以JSON放在body中，签名分别基于两者
+func (t *BybitTrader) doRequest(method, endpoint string, params map[string]interface{}, signed bool) (json.RawMessage, error) {
+	method = strings.ToUpper(method)
+
+	var req *http.Request
+	var payload string
+	var err error
+
+	switch method {
+	case "GET":
+		q := url.Values{}
+		for k, v := range params {
+			q.Set(k, fmt.Sprintf("%v", v))
+		}
+		payload = q.Encode()
+		fullURL := t.baseURL + endpoint
+		if payload != "" {
+			fullURL += "?" + payload
+		}
+		req, err = http.NewRequest("GET", fullURL, nil)
+		if err != nil {
+			return nil, err
+		}
+
+	case "POST":
+		body, err := json.Marshal(params)
+		if err != nil {
+			return nil, fmt.Errorf("序列化请求参数失败: %w", err)
+		}
+		payload = string(body)
+		req, err = http.NewRequest("POST", t.baseURL+endpoint, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+	default:
+		return nil, fmt.Errorf("不支持的HTTP方法: %s", method)
+	}
+
+	if signed {
+		timestamp := strconv.FormatInt(time.Now().UnixMilli(), 10)
+		req.Header.Set("X-BAPI-API-KEY", t.apiKey)
+		req.Header.Set("X-BAPI-TIMESTAMP", timestamp)
+		req.Header.Set("X-BAPI-RECV-WINDOW", t.recvWindow)
+		req.Header.Set("X-BAPI-SIGN", t.sign(timestamp, payload))
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(body))
+	}
+
+	var envelope struct {
+		RetCode int             `json:"retCode"`
+		RetMsg  string          `json:"retMsg"`
+		Result  json.RawMessage `json:"result"`
+	}
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return nil, fmt.Errorf("解析响应失败: %w", err)
+	}
+	if envelope.RetCode != 0 {
+		return nil, &bybitAPIError{Code: envelope.RetCode, Msg: envelope.RetMsg}
+	}
+
+	return envelope.Result, nil
+}
+
+// getPrecision 获取交易对精度信息
+func (t *BybitTrader) getPrecision(symbol string) (SymbolPrecision, error) {
+	t.mu.RLock()
+	if prec, ok := t.symbolPrecision[symbol]; ok {
+		t.mu.RUnlock()
+		return prec, nil
+	}
+	t.mu.RUnlock()
+
+	result, err := t.request("GET", "/v5/market/instruments-info", map[string]interface{}{
+		"category": "linear",
+		"symbol":   symbol,
+	}, false)
+	if err != nil {
+		return SymbolPrecision{}, fmt.Errorf("获取交易规则失败: %w", err)
+	}
+
+	var info struct {
+		List []struct {
+			Symbol        string `json:"symbol"`
+			LotSizeFilter struct {
+				QtyStep string `json:"qtyStep"`
+			} `json:"lotSizeFilter"`
+			PriceFilter struct {
+				TickSize string `json:"tickSize"`
+			} `json:"priceFilter"`
+		} `json:"list"`
+	}
+	if err := json.Unmarshal(result, &info); err != nil {
+		return SymbolPrecision{}, err
+	}
+
+	for _, s := range info.List {
+		if s.Symbol != symbol {
+			continue
+		}
+
+		prec := SymbolPrecision{
+			PricePrecision:    calculatePrecision(s.PriceFilter.TickSize),
+			QuantityPrecision: calculatePrecision(s.LotSizeFilter.QtyStep),
+		}
+		prec.TickSize, _ = strconv.ParseFloat(s.PriceFilter.TickSize, 64)
+		prec.StepSize, _ = strconv.ParseFloat(s.LotSizeFilter.QtyStep, 64)
+
+		t.mu.Lock()
+		t.symbolPrecision[symbol] = prec
+		t.mu.Unlock()
+		return prec, nil
+	}
+
+	return SymbolPrecision{}, fmt.Errorf("未找到交易对 %s 的精度信息", symbol)
+}
+
+// formatPrice 按tick size格式化价格为字符串
+func (t *BybitTrader) formatPrice(symbol string, price float64) (string, error) {
+	prec, err := t.getPrecision(symbol)
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatFloat(roundToTickSize(price, prec.TickSize), 'f', prec.PricePrecision, 64), nil
+}
+
+// formatQuantity 按qty step格式化数量为字符串（向下取整，避免超出可用保证金或持仓数量）
+func (t *BybitTrader) formatQuantity(symbol string, quantity float64) (string, error) {
+	prec, err := t.getPrecision(symbol)
+	if err != nil {
+		return "", err
+	}
+	if prec.StepSize > 0 {
+		quantity = math.Floor(quantity/prec.StepSize+1e-9) * prec.StepSize
+	}
+	return strconv.FormatFloat(quantity, 'f', prec.QuantityPrecision, 64), nil
+}
+
+// SetMarginMode 设置保证金模式
+// 统一账户的保证金模式是账户级设置，只能设置默认模式（symbol需为空），立即生效
+func (t *BybitTrader) SetMarginMode(symbol string, mode MarginMode) error {
+	if symbol != "" {
+		return fmt.Errorf("Bybit统一账户不支持按币种设置保证金模式")
+	}
+	if err := t.setMarginMode("", mode); err != nil {
+		return err
+	}
+	return t.ensureMarginMode("", t.applyMarginMode)
+}
+
+// SetPositionMode 设置持仓模式（有持仓或挂单时交易所会拒绝切换）
+func (t *BybitTrader) SetPositionMode(mode PositionMode) error {
+	if err := t.setPositionMode(mode); err != nil {
+		return err
+	}
+	return t.ensurePositionMode(t.applyPositionMode)
+}
+
+// ensureTradingModes 开仓前确保持仓模式和保证金模式已生效
+func (t *BybitTrader) ensureTradingModes() error {
+	if err := t.ensurePositionMode(t.applyPositionMode); err != nil {
+		return err
+	}
+	return t.ensureMarginMode("", t.applyMarginMode)
+}
+
+// applyPositionMode 切换USDT永续的持仓模式（0=单向持仓, 3=双向持仓）
+func (t *BybitTrader) applyPositionMode(mode PositionMode) error {
+	bybitMode := 0
+	if mode == PositionModeHedge {
+		bybitMode = 3
+	}
+	_, err := t.request("POST", "/v5/position/switch-mode", map[string]interface{}{
+		"category": "linear",
+		"coin":     "USDT",
+		"mode":     bybitMode,
+	}, true)
+	if err != nil && !isBybitCode(err, bybitCodePositionModeNotModified) {
+		return fmt.Errorf("切换持仓模式失败: %w", err)
+	}
+	return nil
+}
+
+// applyMarginMode 切换统一账户的保证金模式
+func (t *BybitTrader) applyMarginMode(_ string, mode MarginMode) error {
+	marginMode := "REGULAR_MARGIN"
+	if mode == MarginModeIsolated {
+		marginMode = "ISOLATED_MARGIN"
+	}
+	if _, err := t.request("POST", "/v5/account/set-margin-mode", map[string]interface{}{
+		"setMarginMode": marginMode,
+	}, true); err != nil {
+		return fmt.Errorf("设置保证金模式失败: %w", err)
+	}
+	log.Printf("  ✓ 账户保证金模式: %s", marginMode)
+	return nil
+}
+
+// positionIdx 根据持仓方向返回Bybit的positionIdx（单向持仓为0，双向持仓1=多仓, 2=空仓）
+func (t *BybitTrader) positionIdx(positionSide string) int {
+	if !t.hedgeMode() {
+		return 0
+	}
+	if strings.EqualFold(positionSide, "SHORT") {
+		return 2
+	}
+	return 1
+}
+
+// Capabilities Bybit支持的功能
+func (t *BybitTrader) Capabilities() Capabilities {
+	return Capabilities{
+		TrailingStop:       true,
+		ReduceOnly:         true,
+		SeparateSLTPCancel: true,
+		HedgeMode:          true,
+		LimitOrders:        true,
+		AdjustMargin:       true,
+		MinNotional:        5,
+	}
+}
+
+// AdjustIsolatedMargin 调整逐仓仓位保证金（amount>0追加，amount<0减少）
+func (t *BybitTrader) AdjustIsolatedMargin(symbol string, positionSide string, amount float64) error {
+	if amount == 0 {
+		return fmt.Errorf("保证金调整金额不能为0")
+	}
+	if _, err := t.request("POST", "/v5/position/add-margin", map[string]interface{}{
+		"category":    "linear",
+		"symbol":      symbol,
+		"margin":      strconv.FormatFloat(amount, 'f', 4, 64),
+		"positionIdx": t.positionIdx(positionSide),
+	}, true); err != nil {
+		return fmt.Errorf("调整逐仓保证金失败: %w", err)
+	}
+
+	log.Printf("  ✓ %s %s 逐仓保证金调整 %+.4f USDT", symbol, strings.ToUpper(positionSide), amount)
+	return nil
+}
+
+// GetBalance 获取账户余额
+func (t *BybitTrader) GetBalance() (*Balance, error) {
+	result, err := t.request("GET", "/v5/account/wallet-balance", map[string]interface{}{
+		"accountType": "UNIFIED",
+	}, true)
+	if err != nil {
+		return nil, fmt.Errorf("获取账户信息失败: %w", err)
+	}
+
+	var data struct {
+		List []struct {
+			TotalWalletBalance    string `json:"totalWalletBalance"`
+			TotalAvailableBalance string `json:"totalAvailableBalance"`
+			TotalPerpUPL          string `json:"totalPerpUPL"`
+		} `json:"list"`
+	}
+	if err := json.Unmarshal(result, &data); err != nil {
+		return nil, fmt.Errorf("解析账户信息失败: %w", err)
+	}
+	if len(data.List) == 0 {
+		return nil, errors.New("未找到统一账户信息")
+	}
+
+	account := data.List[0]
+	walletBalance, _ := strconv.ParseFloat(account.TotalWalletBalance, 64)
+	availableBalance, _ := strconv.ParseFloat(account.TotalAvailableBalance, 64)
+	unrealizedPnL, _ := strconv.ParseFloat(account.TotalPerpUPL, 64)
+
+	return &Balance{
+		TotalWalletBalance:    walletBalance,
+		AvailableBalance:      availableBalance,
+		TotalUnrealizedProfit: unrealizedPnL,
+	}, nil
+}
+
+// GetPositions 获取所有持仓
+func (t *BybitTrader) GetPositions() ([]Position, error) {
+	result, err := t.request("GET", "/v5/position/list", map[string]interface{}{
+		"category":   "linear",
+		"settleCoin": "USDT",
+	}, true)
+	if err != nil {
+		return nil, fmt.Errorf("获取持仓失败: %w", err)
+	}
+
+	var data struct {
+		List []struct {
+			Symbol        string `json:"symbol"`
+			Side          string `json:"side"` // "Buy", "Sell" 或 ""（无持仓）
+			Size          string `json:"size"`
+			AvgPrice      string `json:"avgPrice"`
+			MarkPrice     string `json:"markPrice"`
+			UnrealisedPnl string `json:"unrealisedPnl"`
+			Leverage      string `json:"leverage"`
+			LiqPrice      string `json:"liqPrice"`
+		} `json:"list"`
+	}
+	if err := json.Unmarshal(result, &data); err != nil {
+		return nil, fmt.Errorf("解析持仓失败: %w", err)
+	}
+
+	positions := []Position{}
+	for _, pos := range data.List {
+		size, _ := strconv.ParseFloat(pos.Size, 64)
+		if size == 0 {
+			continue // 跳过空仓位
+		}
+
+		side := "long"
+		if pos.Side == "Sell" {
+			side = "short"
+		}
+
+		entryPrice, _ := strconv.ParseFloat(pos.AvgPrice, 64)
+		markPrice, _ := strconv.ParseFloat(pos.MarkPrice, 64)
+		unrealizedPnL, _ := strconv.ParseFloat(pos.UnrealisedPnl, 64)
+		leverage, _ := strconv.ParseFloat(pos.Leverage, 64)
+		liqPrice, _ := strconv.ParseFloat(pos.LiqPrice, 64)
+
+		positions = append(positions, Position{
+			Symbol:           pos.Symbol,
+			Side:             side,
+			PositionAmt:      size,
+			EntryPrice:       entryPrice,
+			MarkPrice:        markPrice,
+			UnRealizedProfit: unrealizedPnL,
+			Leverage:         int(leverage),
+			LiquidationPrice: liqPrice,
+		})
+	}
+
+	return positions, nil
+}
+
+// SetLeverage 设置杠杆（多空同时设置）
+func (t *BybitTrader) SetLeverage(symbol string, leverage int) error {
+	lev := strconv.Itoa(leverage)
+	_, err := t.request("POST", "/v5/position/set-leverage", map[string]interface{}{
+		"category":     "linear",
+		"symbol":       symbol,
+		"buyLeverage":  lev,
+		"sellLeverage": lev,
+	}, true)
+	if err != nil {
+		if isBybitCode(err, bybitCodeLeverageNotModified) {
+			log.Printf("  %s 杠杆已是 %dx", symbol, leverage)
+			return nil
+		}
+		return fmt.Errorf("设置杠杆失败: %w", err)
+	}
+
+	log.Printf("  ✓ %s 杠杆已切换为 %dx", symbol, leverage)
+	return nil
+}
+
+// newOrderLinkID 生成数字形式的自定义订单ID
+// Bybit订单ID为UUID字符串，统一使用orderLinkId作为对外的OrderID
+func (t *BybitTrader) newOrderLinkID() int64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	id := time.Now().UnixMicro()
+	if id <= t.lastOrderLinkID {
+		id = t.lastOrderLinkID + 1
+	}
+	t.lastOrderLinkID = id
+	return id
+}
+
+// placeOrder 下单并查询成交结果
+func (t *BybitTrader) placeOrder(symbol string, params map[string]interface{}) (*OrderResult, error) {
+	linkID := t.newOrderLinkID()
+	params["category"] = "linear"
+	params["symbol"] = symbol
+	params["orderLinkId"] = strconv.FormatInt(linkID, 10)
+
+	// orderLinkId同时作为OrderID（数字），不编码决策信息；结果不确定时同样先按orderLinkId查询再决定是否重发
+	return submitOrder(strconv.FormatInt(linkID, 10), func() (*OrderResult, error) {
+		if _, err := t.doRequest("POST", "/v5/order/create", params, true); err != nil {
+			return nil, err
+		}
+
+		// Bybit下单接口不返回成交信息，查询一次订单获取成交均价（失败不影响下单结果）
+		result, err := t.GetOrder(symbol, linkID)
+		if err != nil {
+			log.Printf("  ⚠ 查询订单成交信息失败: %v", err)
+			return &OrderResult{OrderID: linkID, Symbol: symbol, Status: OrderStatusNew}, nil
+		}
+		return result, nil
+	}, func() (*OrderResult, error) {
+		return t.queryOrder(symbol, linkID)
+	})
+}
+
+// bybitOrderStatus 将Bybit订单状态转换为统一状态
+func bybitOrderStatus(status string) string {
+	switch status {
+	case "New", "Created", "Untriggered", "Triggered", "Active":
+		return OrderStatusNew
+	case "PartiallyFilled":
+		return OrderStatusPartiallyFilled
+	case "Filled":
+		return OrderStatusFilled
+	case "Rejected":
+		return OrderStatusRejected
+	default:
+		// Cancelled、PartiallyFilledCanceled、Deactivated（IOC未成交、只做Maker被撤销也在此列）
+		return OrderStatusCanceled
+	}
+}
+
+// GetOrder 查询订单状态（orderID为下单时的orderLinkId）
+func (t *BybitTrader) GetOrder(symbol string, orderID int64) (*OrderResult, error) {
+	result, err := t.queryOrder(symbol, orderID)
+	if err == nil && result == nil {
+		return nil, fmt.Errorf("订单不存在: %d", orderID)
+	}
+	return result, err
+}
+
+// queryOrder 按orderLinkId查询活动订单和历史订单（订单不存在时返回nil）
+func (t *BybitTrader) queryOrder(symbol string, orderID int64) (*OrderResult, error) {
+	params := map[string]interface{}{
+		"category":    "linear",
+		"symbol":      symbol,
+		"orderLinkId": strconv.FormatInt(orderID, 10),
+	}
+
+	var data struct {
+		List []struct {
+			OrderStatus string `json:"orderStatus"`
+			AvgPrice    string `json:"avgPrice"`
+			CumExecQty  string `json:"cumExecQty"`
+			CumExecFee  string `json:"cumExecFee"`
+		} `json:"list"`
+	}
+
+	// 活动订单查询不到时再查历史订单
+	for _, endpoint := range []string{"/v5/order/realtime", "/v5/order/history"} {
+		result, err := t.request("GET", endpoint, params, true)
+		if err != nil {
+			return nil, fmt.Errorf("查询订单失败: %w", err)
+		}
+		if err := json.Unmarshal(result, &data); err != nil {
+			return nil, fmt.Errorf("解析订单失败: %w", err)
+		}
+		if len(data.List) > 0 {
+			break
+		}
+	}
+	if len(data.List) == 0 {
+		return nil, nil
+	}
+
+	order := data.List[0]
+	avgPrice, _ := strconv.ParseFloat(order.AvgPrice, 64)
+	executedQty, _ := strconv.ParseFloat(order.CumExecQty, 64)
+	fee, _ := strconv.ParseFloat(order.CumExecFee, 64)
+	result := &OrderResult{
+		OrderID:     orderID,
+		Symbol:      symbol,
+		Status:      bybitOrderStatus(order.OrderStatus),
+		AvgPrice:    avgPrice,
+		ExecutedQty: executedQty,
+		Fee:         fee,
+	}
+	if executedQty > 0 {
+		result.FeeAsset = "USDT" // USDT永续合约手续费以USDT结算
+	}
+	return result, nil
+}
+
+// CancelOrder 取消指定订单（orderID为下单时的orderLinkId）
+func (t *BybitTrader) CancelOrder(symbol string, orderID int64) error {
+	_, err := t.request("POST", "/v5/order/cancel", map[string]interface{}{
+		"category":    "linear",
+		"symbol":      symbol,
+		"orderLinkId": strconv.FormatInt(orderID, 10),
+	}, true)
+	if err != nil {
+		return fmt.Errorf("取消订单失败: %w", err)
+	}
+
+	log.Printf("  ✓ 已取消 %s 订单 %d", symbol, orderID)
+	return nil
+}
+
+// openPosition 开仓（limitPrice为0时下市价单）
+func (t *BybitTrader) openPosition(symbol string, quantity float64, leverage int, positionSide string, limitPrice float64, tif TimeInForce) (*OrderResult, error) {
+	// 开仓前先取消所有挂单,防止残留挂单导致仓位叠加
+	if err := t.CancelAllOrders(symbol); err != nil {
+		log.Printf("  ⚠ 取消挂单失败(继续开仓): %v", err)
+	}
+
+	if err := t.ensureTradingModes(); err != nil {
+		return nil, err
+	}
+
+	if err := t.SetLeverage(symbol, leverage); err != nil {
+		return nil, err
+	}
+
+	qtyStr, err := t.formatQuantity(symbol, quantity)
+	if err != nil {
+		return nil, err
+	}
+	if q, _ := strconv.ParseFloat(qtyStr, 64); q <= 0 {
+		return nil, fmt.Errorf("开仓数量过小: %.8f 低于 %s 最小下单单位", quantity, symbol)
+	}
+
+	side := "Buy"
+	if positionSide == "SHORT" {
+		side = "Sell"
+	}
+
+	params := map[string]interface{}{
+		"side":        side,
+		"orderType":   "Market",
+		"qty":         qtyStr,
+		"positionIdx": t.positionIdx(positionSide),
+		"reduceOnly":  false,
+	}
+	if limitPrice > 0 {
+		priceStr, err := t.formatPrice(symbol, limitPrice)
+		if err != nil {
+			return nil, err
+		}
+		timeInForce := string(tif)
+		if tif == TimeInForcePostOnly {
+			timeInForce = "PostOnly"
+		}
+		params["orderType"] = "Limit"
+		params["price"] = priceStr
+		params["timeInForce"] = timeInForce
+	}
+
+	result, err := t.placeOrder(symbol, params)
+	if err != nil {
+		return nil, fmt.Errorf("开仓失败: %w", err)
+	}
+
+	if limitPrice > 0 {
+		log.Printf("✓ 限价开仓单已提交: %s %s 价格: %v 数量: %s (%s) 状态: %s",
+			symbol, positionSide, params["price"], qtyStr, tif, result.Status)
+	} else if positionSide == "SHORT" {
+		log.Printf("✓ 开空仓成功: %s 数量: %s", symbol, qtyStr)
+	} else {
+		log.Printf("✓ 开多仓成功: %s 数量: %s", symbol, qtyStr)
+	}
+
+	return result, nil
+}
+
+// closePosition 平仓（quantity为0时平掉全部持仓）
+func (t *BybitTrader) closePosition(symbol string, quantity float64, positionSide string) (*OrderResult, error) {
+	side := strings.ToLower(positionSide)
+
+	// 如果数量为0，获取当前持仓数量
+	if quantity == 0 {
+		positions, err := t.GetPositions()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, pos := range positions {
+			if pos.Symbol == symbol && pos.Side == side {
+				quantity = pos.PositionAmt
+				break
+			}
+		}
+
+		if quantity == 0 {
+			if side == "short" {
+				return nil, fmt.Errorf("没有找到 %s 的空仓", symbol)
+			}
+			return nil, fmt.Errorf("没有找到 %s 的多仓", symbol)
+		}
+	}
+
+	qtyStr, err := t.formatQuantity(symbol, quantity)
+	if err != nil {
+		return nil, err
+	}
+
+	orderSide := "Sell"
+	if positionSide == "SHORT" {
+		orderSide = "Buy"
+	}
+
+	result, err := t.placeOrder(symbol, map[string]interface{}{
+		"side":        orderSide,
+		"orderType":   "Market",
+		"qty":         qtyStr,
+		"positionIdx": t.positionIdx(positionSide),
+		"reduceOnly":  true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("平仓失败: %w", err)
+	}
+
+	if positionSide == "SHORT" {
+		log.Printf("✓ 平空仓成功: %s 数量: %s", symbol, qtyStr)
+	} else {
+		log.Printf("✓ 平多仓成功: %s 数量: %s", symbol, qtyStr)
+	}
+
+	// 平仓后取消该币种的所有挂单(止损止盈单)
+	if err := t.CancelAllOrders(symbol); err != nil {
+		log.Printf("  ⚠ 取消挂单失败: %v", err)
+	}
+
+	return result, nil
+}
+
+// OpenLong 开多仓
+func (t *BybitTrader) OpenLong(symbol string, quantity float64, leverage int) (*OrderResult, error) {
+	return t.openPosition(symbol, quantity, leverage, "LONG", 0, "")
+}
+
+// OpenShort 开空仓
+func (t *BybitTrader) OpenShort(symbol string, quantity float64, leverage int) (*OrderResult, error) {
+	return t.openPosition(symbol, quantity, leverage, "SHORT", 0, "")
+}
+
+// OpenLongLimit 限价开多
+func (t *BybitTrader) OpenLongLimit(symbol string, quantity, price float64, leverage int, tif TimeInForce) (*OrderResult, error) {
+	return t.openPosition(symbol, quantity, leverage, "LONG", price, tif)
+}
+
+// OpenShortLimit 限价开空
+func (t *BybitTrader) OpenShortLimit(symbol string, quantity, price float64, leverage int, tif TimeInForce) (*OrderResult, error) {
+	return t.openPosition(symbol, quantity, leverage, "SHORT", price, tif)
+}
+
+// CloseLong 平多仓（quantity=0表示全部平仓）
+func (t *BybitTrader) CloseLong(symbol string, quantity float64) (*OrderResult, error) {
+	return t.closePosition(symbol, quantity, "LONG")
+}
+
+// CloseShort 平空仓（quantity=0表示全部平仓）
+func (t *BybitTrader) CloseShort(symbol string, quantity float64) (*OrderResult, error) {
+	return t.closePosition(symbol, quantity, "SHORT")
+}
+
+// GetMarketPrice 获取市场价格
+func (t *BybitTrader) GetMarketPrice(symbol string) (float64, error) {
+	result, err := t.request("GET", "/v5/market/tickers", map[string]interface{}{
+		"category": "linear",
+		"symbol":   symbol,
+	}, false)
+	if err != nil {
+		return 0, fmt.Errorf("获取价格失败: %w", err)
+	}
+
+	var data struct {
+		List []struct {
+			LastPrice string `json:"lastPrice"`
+		} `json:"list"`
+	}
+	if err := json.Unmarshal(result, &data); err != nil {
+		return 0, err
+	}
+	if len(data.List) == 0 {
+		return 0, fmt.Errorf("未找到 %s 的价格", symbol)
+	}
+
+	return strconv.ParseFloat(data.List[0].LastPrice, 64)
+}
+
+// GetOrderBook 获取L2订单簿（线性合约单次最多500档）
+func (t *BybitTrader) GetOrderBook(symbol string, depth int) (*OrderBook, error) {
+	if depth > 500 {
+		depth = 500
+	}
+	result, err := t.request("GET", "/v5/market/orderbook", map[string]interface{}{
+		"category": "linear",
+		"symbol":   symbol,
+		"limit":    depth,
+	}, false)
+	if err != nil {
+		return nil, fmt.Errorf("获取订单簿失败: %w", err)
+	}
+
+	var data struct {
+		Bids [][]string `json:"b"`
+		Asks [][]string `json:"a"`
+		Ts   int64      `json:"ts"`
+	}
+	if err := json.Unmarshal(result, &data); err != nil {
+		return nil, fmt.Errorf("解析订单簿失败: %w", err)
+	}
+	return &OrderBook{
+		Symbol: symbol,
+		Bids:   parseBookLevels(data.Bids, 1),
+		Asks:   parseBookLevels(data.Asks, 1),
+		Time:   time.UnixMilli(data.Ts),
+	}, nil
+}
+
+// placeConditionalOrder 下条件市价单（止损/止盈），触发后只减仓
+// triggerDirection: 1=价格上涨到触发价时触发, 2=价格下跌到触发价时触发
+func (t *BybitTrader) placeConditionalOrder(symbol, positionSide string, quantity, triggerPrice float64, stopLoss bool) error {
+	side := "Sell"
+	if positionSide == "SHORT" {
+		side = "Buy"
+	}
+
+	// 多仓止损/空仓止盈在下跌时触发，多仓止盈/空仓止损在上涨时触发
+	triggerDirection := 1
+	if (positionSide == "LONG") == stopLoss {
+		triggerDirection = 2
+	}
+
+	priceStr, err := t.formatPrice(symbol, triggerPrice)
+	if err != nil {
+		return err
+	}
+	qtyStr, err := t.formatQuantity(symbol, quantity)
+	if err != nil {
+		return err
+	}
+
+	_, err = t.request("POST", "/v5/order/create", map[string]interface{}{
+		"category":         "linear",
+		"symbol":           symbol,
+		"side":             side,
+		"orderType":        "Market",
+		"qty":              qtyStr,
+		"positionIdx":      t.positionIdx(positionSide),
+		"triggerPrice":     priceStr,
+		"triggerDirection": triggerDirection,
+		"triggerBy":        "LastPrice",
+		"reduceOnly":       true,
+		"closeOnTrigger":   true,
+	}, true)
+	return err
+}
+
+// SetStopLoss 设置止损单
+func (t *BybitTrader) SetStopLoss(symbol string, positionSide string, quantity, stopPrice float64) error {
+	if err := t.placeConditionalOrder(symbol, positionSide, quantity, stopPrice, true); err != nil {
+		return fmt.Errorf("设置止损失败: %w", err)
+	}
+
+	log.Printf("  止损价设置: %.4f", stopPrice)
+	return nil
+}
+
+// SetTakeProfit 设置止盈单
+func (t *BybitTrader) SetTakeProfit(symbol string, positionSide string, quantity, takeProfitPrice float64) error {
+	if err := t.placeConditionalOrder(symbol, positionSide, quantity, takeProfitPrice, false); err != nil {
+		return fmt.Errorf("设置止盈失败: %w", err)
+	}
+
+	log.Printf("  止盈价设置: %.4f", takeProfitPrice)
+	return nil
+}
+
+// SetTrailingStop 设置追踪止损（/v5/position/trading-stop，作用于整个仓位，重复设置会覆盖原有的追踪止损）
+// Bybit的追踪距离是价格差，按激活价（未设置时按当前价）把回调比例换算为价格差；quantity不使用
+func (t *BybitTrader) SetTrailingStop(symbol string, positionSide string, quantity, activationPrice, callbackRate float64) error {
+	price, err := t.GetMarketPrice(symbol)
+	if err != nil {
+		return err
+	}
+	if err := validateTrailingStop(positionSide, price, activationPrice, callbackRate); err != nil {
+		return err
+	}
+
+	base := price
+	if activationPrice > 0 {
+		base = activationPrice
+	}
+	distance, err := t.formatPrice(symbol, base*callbackRate/100)
+	if err != nil {
+		return err
+	}
+	// 追踪距离为0表示取消追踪止损
+	if d, _ := strconv.ParseFloat(distance, 64); d <= 0 {
+		return fmt.Errorf("追踪止损距离小于最小价格步进: 回调%.2f%% 价格%.4f", callbackRate, base)
+	}
+
+	params := map[string]interface{}{
+		"category":     "linear",
+		"symbol":       symbol,
+		"tpslMode":     "Full",
+		"positionIdx":  t.positionIdx(positionSide),
+		"trailingStop": distance,
+	}
+	if activationPrice > 0 {
+		activePrice, err := t.formatPrice(symbol, activationPrice)
+		if err != nil {
+			return err
+		}
+		params["activePrice"] = activePrice
+	}
+
+	if _, err := t.request("POST", "/v5/position/trading-stop", params, true); err != nil {
+		return fmt.Errorf("设置追踪止损失败: %w", err)
+	}
+
+	log.Printf("  追踪止损设置: 回调%.2f%% (距离%s) 激活价%.4f", callbackRate, distance, activationPrice)
+	return nil
+}
+
+// CancelAllOrders 取消该币种的所有挂单（包括条件单）
+func (t *BybitTrader) CancelAllOrders(symbol string) error {
+	_, err := t.request("POST", "/v5/order/cancel-all", map[string]interface{}{
+		"category": "linear",
+		"symbol":   symbol,
+	}, true)
+	if err != nil {
+		return fmt.Errorf("取消挂单失败: %w", err)
+	}
+
+	log.Printf("  ✓ 已取消 %s 的所有挂单", symbol)
+	return nil
+}
+
+// bybitOrder Bybit挂单信息
+type bybitOrder struct {
+	OrderID          string `json:"orderId"`
+	OrderLinkID      string `json:"orderLinkId"`
+	Symbol           string `json:"symbol"`
+	Side             string `json:"side"`
+	OrderType        string `json:"orderType"`
+	Price            string `json:"price"`
+	Qty              string `json:"qty"`
+	TriggerPrice     string `json:"triggerPrice"`
+	TriggerDirection int    `json:"triggerDirection"`
+	StopOrderType    string `json:"stopOrderType"`
+	OrderStatus      string `json:"orderStatus"`
+	PositionIdx      int    `json:"positionIdx"`
+	ReduceOnly       bool   `json:"reduceOnly"`
+}
+
+// orderType 将Bybit订单归类为币安风格的订单类型
+func (o *bybitOrder) orderType() string {
+	switch o.StopOrderType {
+	case "StopLoss":
+		return "STOP_MARKET"
+	case "TakeProfit":
+		return "TAKE_PROFIT_MARKET"
+	case "TrailingStop":
+		return CloseOrderTrailingStop
+	}
+
+	if trigger, _ := strconv.ParseFloat(o.TriggerPrice, 64); trigger > 0 {
+		// 卖出下跌触发（多仓止损）或买入上涨触发（空仓止损）为止损单，反之为止盈单
+		if (o.Side == "Sell") == (o.TriggerDirection == 2) {
+			return "STOP_MARKET"
+		}
+		return "TAKE_PROFIT_MARKET"
+	}
+
+	return strings.ToUpper(o.OrderType)
+}
+
+// getRawOpenOrders 获取Bybit原始挂单列表
+func (t *BybitTrader) getRawOpenOrders(symbol string) ([]bybitOrder, error) {
+	result, err := t.request("GET", "/v5/order/realtime", map[string]interface{}{
+		"category": "linear",
+		"symbol":   symbol,
+	}, true)
+	if err != nil {
+		return nil, fmt.Errorf("获取未完成订单失败: %w", err)
+	}
+
+	var data struct {
+		List []bybitOrder `json:"list"`
+	}
+	if err := json.Unmarshal(result, &data); err != nil {
+		return nil, fmt.Errorf("解析未完成订单失败: %w", err)
+	}
+	return data.List, nil
+}
+
+// cancelOrdersByType 取消指定类型的条件单
+func (t *BybitTrader) cancelOrdersByType(symbol, orderType, label string) error {
+	orders, err := t.getRawOpenOrders(symbol)
+	if err != nil {
+		return err
+	}
+
+	canceledCount := 0
+	for _, order := range orders {
+		if order.orderType() != orderType {
+			continue
+		}
+
+		_, err := t.request("POST", "/v5/order/cancel", map[string]interface{}{
+			"category": "linear",
+			"symbol":   symbol,
+			"orderId":  order.OrderID,
+		}, true)
+		if err != nil {
+			log.Printf("  ⚠ 取消%s单 %s 失败: %v", label, order.OrderID, err)
+			continue
+		}
+		canceledCount++
+	}
+
+	if canceledCount == 0 {
+		log.Printf("  ℹ %s 没有%s单需要取消", symbol, label)
+	} else {
+		log.Printf("  ✓ 已取消 %s 的 %d 个%s单", symbol, canceledCount, label)
+	}
+	return nil
+}
+
+// CancelStopLossOrders 仅取消止损单（不影响止盈单）
+func (t *BybitTrader) CancelStopLossOrders(symbol string) error {
+	return t.cancelOrdersByType(symbol, "STOP_MARKET", "止损")
+}
+
+// CancelTakeProfitOrders 仅取消止盈单（不影响止损单）
+func (t *BybitTrader) CancelTakeProfitOrders(symbol string) error {
+	return t.cancelOrdersByType(symbol, "TAKE_PROFIT_MARKET", "止盈")
+}
+
+// GetOpenOrders 获取指定币种的所有未完成订单
+// 注意: OrderID取自orderLinkId，非本程序下的订单（无数字orderLinkId）为0
+func (t *BybitTrader) GetOpenOrders(symbol string) ([]Order, error) {
+	rawOrders, err := t.getRawOpenOrders(symbol)
+	if err != nil {
+		return nil, err
+	}
+
+	orders := make([]Order, 0, len(rawOrders))
+	for _, o := range rawOrders {
+		positionSide := "BOTH"
+		switch o.PositionIdx {
+		case 1:
+			positionSide = "LONG"
+		case 2:
+			positionSide = "SHORT"
+		}
+
+		price, _ := strconv.ParseFloat(o.Price, 64)
+		triggerPrice, _ := strconv.ParseFloat(o.TriggerPrice, 64)
+		qty, _ := strconv.ParseFloat(o.Qty, 64)
+		linkID, _ := strconv.ParseInt(o.OrderLinkID, 10, 64)
+
+		orders = append(orders, Order{
+			OrderID:      linkID,
+			Symbol:       o.Symbol,
+			Type:         o.orderType(),
+			Side:         strings.ToUpper(o.Side),
+			PositionSide: positionSide,
+			Price:        price,
+			StopPrice:    triggerPrice,
+			Quantity:     qty,
+			Status:       o.OrderStatus,
+			ReduceOnly:   o.ReduceOnly,
+		})
+	}
+
+	return orders, nil
+}
+
+// FormatQuantity 格式化数量到正确的精度
+func (t *BybitTrader) FormatQuantity(symbol string, quantity float64) (string, error) {
+	return t.formatQuantity(symbol, quantity)
+}
+
+// GetTradeHistory 获取成交记录（/v5/execution/list，单次最多查询7天，按游标分页）
+func (t *BybitTrader) GetTradeHistory(symbol string, start, end time.Time) ([]TradeFill, error) {
+	fills := make([]TradeFill, 0)
+	for _, window := range historyWindows(start, end, 7*24*time.Hour) {
+		cursor := ""
+		for {
+			params := map[string]interface{}{
+				"category":  "linear",
+				"startTime": window[0].UnixMilli(),
+				"endTime":   window[1].UnixMilli(),
+				"limit":     100,
+			}
+			if symbol != "" {
+				params["symbol"] = symbol
+			}
+			if cursor != "" {
+				params["cursor"] = cursor
+			}
+			result, err := t.request("GET", "/v5/execution/list", params, true)
+			if err != nil {
+				return nil, fmt.Errorf("获取成交记录失败: %w", err)
+			}
+
+			var data struct {
+				List []struct {
+					Symbol      string `json:"symbol"`
+					OrderLinkID string `json:"orderLinkId"`
+					Side        string `json:"side"` // Buy 或 Sell
+					ExecType    string `json:"execType"`
+					ExecPrice   string `json:"execPrice"`
+					ExecQty     string `json:"execQty"`
+					ExecFee     string `json:"execFee"`
+					ExecPnl     string `json:"execPnl"`
+					ClosedSize  string `json:"closedSize"`
+					ExecTime    string `json:"execTime"`
+				} `json:"list"`
+				NextPageCursor string `json:"nextPageCursor"`
+			}
+			if err := json.Unmarshal(result, &data); err != nil {
+				return nil, fmt.Errorf("解析成交记录失败: %w", err)
+			}
+
+			for _, e := range data.List {
+				if e.ExecType != "Trade" {
+					continue
+				}
+				price, _ := strconv.ParseFloat(e.ExecPrice, 64)
+				qty, _ := strconv.ParseFloat(e.ExecQty, 64)
+				fee, _ := strconv.ParseFloat(e.ExecFee, 64)
+				pnl, _ := strconv.ParseFloat(e.ExecPnl, 64)
+				closed, _ := strconv.ParseFloat(e.ClosedSize, 64)
+				orderID, _ := strconv.ParseInt(e.OrderLinkID, 10, 64) // 本程序下单时orderLinkId为数字
+				ts, _ := strconv.ParseInt(e.ExecTime, 10, 64)
+				side := strings.ToUpper(e.Side)
+				fills = append(fills, TradeFill{
+					Symbol:       e.Symbol,
+					OrderID:      orderID,
+					Side:         side,
+					PositionSide: binanceTradePositionSide("", side, closed > 0),
+					Price:        price,
+					Quantity:     qty,
+					RealizedPnL:  pnl,
+					Fee:          fee,
+					FeeAsset:     "USDT",
+					Time:         time.UnixMilli(ts),
+				})
+			}
+			if data.NextPageCursor == "" || len(data.List) == 0 {
+				break
+			}
+			cursor = data.NextPageCursor
+		}
+	}
+
+	sortTradeFills(fills)
+	return fills, nil
+}
+
+// GetIncomeHistory 获取已实现盈亏、手续费和资金费流水（/v5/account/transaction-log）
+// TRADE流水的cashFlow为已实现盈亏，fee为手续费；SETTLEMENT流水的funding为资金费（正数为支付）
+func (t *BybitTrader) GetIncomeHistory(symbol string, start, end time.Time) ([]IncomeRecord, error) {
+	records := make([]IncomeRecord, 0)
+	for _, window := range historyWindows(start, end, 7*24*time.Hour) {
+		cursor := ""
+		for {
+			params := map[string]interface{}{
+				"accountType": "UNIFIED",
+				"category":    "linear",
+				"startTime":   window[0].UnixMilli(),
+				"endTime":     window[1].UnixMilli(),
+				"limit":       50,
+			}
+			if cursor != "" {
+				params["cursor"] = cursor
+			}
+			result, err := t.request("GET", "/v5/account/transaction-log", params, true)
+			if err != nil {
+				return nil, fmt.Errorf("获取资金流水失败: %w", err)
+			}
+
+			var data struct {
+				List []struct {
+					Symbol          string `json:"symbol"`
+					Type            string `json:"type"`
+					CashFlow        string `json:"cashFlow"`
+					Fee             string `json:"fee"`
+					Funding         string `json:"funding"`
+					Currency        string `json:"currency"`
+					TransactionTime string `json:"transactionTime"`
+				} `json:"list"`
+				NextPageCursor string `json:"nextPageCursor"`
+			}
+			if err := json.Unmarshal(result, &data); err != nil {
+				return nil, fmt.Errorf("解析资金流水失败: %w", err)
+			}
+
+			for _, item := range data.List {
+				if symbol != "" && item.Symbol != symbol {
+					continue
+				}
+				ts, _ := strconv.ParseInt(item.TransactionTime, 10, 64)
+				record := IncomeRecord{Symbol: item.Symbol, Asset: item.Currency, Time: time.UnixMilli(ts)}
+				switch item.Type {
+				case "TRADE":
+					if pnl, _ := strconv.ParseFloat(item.CashFlow, 64); pnl != 0 {
+						record.Type, record.Amount = IncomeRealizedPnL, pnl
+						records = append(records, record)
+					}
+					if fee, _ := strconv.ParseFloat(item.Fee, 64); fee != 0 {
+						record.Type, record.Amount = IncomeCommission, -fee
+						records = append(records, record)
+					}
+				case "SETTLEMENT":
+					if funding, _ := strconv.ParseFloat(item.Funding, 64); funding != 0 {
+						record.Type, record.Amount = IncomeFunding, -funding
+						records = append(records, record)
+					}
+				}
+			}
+			if data.NextPageCursor == "" || len(data.List) == 0 {
+				break
+			}
+			cursor = data.NextPageCursor
+		}
+	}
+
+	sortIncome(records)
+	return records, nil
+}
@@ -0,0 +1,354 @@
+package trader
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// fakeBybit 本地模拟的Bybit V5接口
+type fakeBybit struct {
+	t         *testing.T
+	apiKey    string
+	secretKey string
+
+	mu         sync.Mutex
+	posts      map[string][]map[string]interface{} // endpoint -> 请求body
+	openOrders []map[string]interface{}            // /v5/order/realtime 返回的挂单
+	retCode    map[string]int                      // endpoint -> 强制返回的retCode
+}
+
+func newFakeBybit(t *testing.T) (*fakeBybit, *BybitTrader) {
+	f := &fakeBybit{
+		t:         t,
+		apiKey:    "test-key",
+		secretKey: "test-secret",
+		posts:     make(map[string][]map[string]interface{}),
+		retCode:   make(map[string]int),
+	}
+	server := httptest.NewServer(http.HandlerFunc(f.handle))
+	t.Cleanup(server.Close)
+
+	trader := NewBybitTrader(f.apiKey, f.secretKey, false)
+	trader.baseURL = server.URL
+	return f, trader
+}
+
+func (f *fakeBybit) reply(w http.ResponseWriter, endpoint string, result interface{}) {
+	f.mu.Lock()
+	code := f.retCode[endpoint]
+	f.mu.Unlock()
+
+	resp := map[string]interface{}{"retCode": code, "retMsg": "OK", "result": result}
+	if code != 0 {
+		resp["retMsg"] = "forced error"
+		resp["result"] = map[string]interface{}{}
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// verifySign 按Bybit规则校验签名头
+func (f *fakeBybit) verifySign(r *http.Request, payload string) bool {
+	ts := r.Header.Get("X-BAPI-TIMESTAMP")
+	recv := r.Header.Get("X-BAPI-RECV-WINDOW")
+	if r.Header.Get("X-BAPI-API-KEY") != f.apiKey || ts == "" || recv == "" {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(f.secretKey))
+	mac.Write([]byte(ts + f.apiKey + recv + payload))
+	return hex.EncodeToString(mac.Sum(nil)) == r.Header.Get("X-BAPI-SIGN")
+}
+
+func (f *fakeBybit) handle(w http.ResponseWriter, r *http.Request) {
+	endpoint := r.URL.Path
+
+	// 公共接口无需签名
+	switch endpoint {
+	case "/v5/market/instruments-info":
+		f.reply(w, endpoint, map[string]interface{}{
+			"list": []map[string]interface{}{{
+				"symbol":        r.URL.Query().Get("symbol"),
+				"lotSizeFilter": map[string]string{"qtyStep": "0.001"},
+				"priceFilter":   map[string]string{"tickSize": "0.10"},
+			}},
+		})
+		return
+	case "/v5/market/tickers":
+		f.reply(w, endpoint, map[string]interface{}{
+			"list": []map[string]string{{"symbol": "BTCUSDT", "lastPrice": "65000.5"}},
+		})
+		return
+	}
+
+	payload := r.URL.RawQuery
+	var body map[string]interface{}
+	if r.Method == http.MethodPost {
+		raw, _ := io.ReadAll(r.Body)
+		payload = string(raw)
+		json.Unmarshal(raw, &body)
+		f.mu.Lock()
+		f.posts[endpoint] = append(f.posts[endpoint], body)
+		f.mu.Unlock()
+	}
+	if !f.verifySign(r, payload) {
+		f.t.Errorf("%s %s 签名校验失败", r.Method, endpoint)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	switch endpoint {
+	case "/v5/account/wallet-balance":
+		f.reply(w, endpoint, map[string]interface{}{
+			"list": []map[string]string{{
+				"totalWalletBalance":    "1000.5",
+				"totalAvailableBalance": "800",
+				"totalPerpUPL":          "-12.25",
+			}},
+		})
+	case "/v5/position/list":
+		f.reply(w, endpoint, map[string]interface{}{
+			"list": []map[string]string{
+				{"symbol": "BTCUSDT", "side": "Buy", "size": "0.01", "avgPrice": "60000", "markPrice": "61000", "unrealisedPnl": "10", "leverage": "5", "liqPrice": "48000"},
+				{"symbol": "BTCUSDT", "side": "", "size": "0", "avgPrice": "0", "markPrice": "61000", "unrealisedPnl": "0", "leverage": "5", "liqPrice": ""},
+				{"symbol": "ETHUSDT", "side": "Sell", "size": "0.5", "avgPrice": "3000", "markPrice": "2950", "unrealisedPnl": "25", "leverage": "3", "liqPrice": "3900"},
+			},
+		})
+	case "/v5/order/create":
+		f.reply(w, endpoint, map[string]string{"orderId": "uuid-1", "orderLinkId": ""})
+	case "/v5/order/realtime":
+		if r.URL.Query().Get("orderLinkId") != "" {
+			f.reply(w, endpoint, map[string]interface{}{
+				"list": []map[string]string{{"orderStatus": "Filled", "avgPrice": "65010.1", "cumExecQty": "0.123"}},
+			})
+			return
+		}
+		f.mu.Lock()
+		orders := f.openOrders
+		f.mu.Unlock()
+		f.reply(w, endpoint, map[string]interface{}{"list": orders})
+	default:
+		f.reply(w, endpoint, map[string]interface{}{})
+	}
+}
+
+func (f *fakeBybit) postsTo(endpoint string) []map[string]interface{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.posts[endpoint]
+}
+
+func TestBybitGetBalanceAndPositions(t *testing.T) {
+	_, trader := newFakeBybit(t)
+
+	balance, err := trader.GetBalance()
+	if err != nil {
+		t.Fatalf("GetBalance失败: %v", err)
+	}
+	if balance.TotalWalletBalance != 1000.5 || balance.AvailableBalance != 800 || balance.TotalUnrealizedProfit != -12.25 {
+		t.Errorf("余额解析错误: %+v", balance)
+	}
+
+	positions, err := trader.GetPositions()
+	if err != nil {
+		t.Fatalf("GetPositions失败: %v", err)
+	}
+	if len(positions) != 2 {
+		t.Fatalf("应跳过空仓位，得到 %d 个持仓", len(positions))
+	}
+	if positions[0].Key() != "BTCUSDT_long" || positions[0].Leverage != 5 || positions[0].LiquidationPrice != 48000 {
+		t.Errorf("多仓解析错误: %+v", positions[0])
+	}
+	if positions[1].Key() != "ETHUSDT_short" || positions[1].PositionAmt != 0.5 {
+		t.Errorf("空仓解析错误: %+v", positions[1])
+	}
+}
+
+func TestBybitOpenLongUsesHedgeModeAndPrecision(t *testing.T) {
+	fake, trader := newFakeBybit(t)
+	fake.retCode["/v5/position/set-leverage"] = bybitCodeLeverageNotModified
+
+	result, err := trader.OpenLong("BTCUSDT", 0.12345, 5)
+	if err != nil {
+		t.Fatalf("OpenLong失败: %v", err)
+	}
+	if result.AvgPrice != 65010.1 || result.ExecutedQty != 0.123 || result.Status != OrderStatusFilled {
+		t.Errorf("成交结果解析错误: %+v", result)
+	}
+
+	modes := fake.postsTo("/v5/position/switch-mode")
+	if len(modes) != 1 || modes[0]["mode"] != float64(3) {
+		t.Errorf("应切换为双向持仓模式: %v", modes)
+	}
+
+	orders := fake.postsTo("/v5/order/create")
+	if len(orders) != 1 {
+		t.Fatalf("应下1个订单，实际 %d", len(orders))
+	}
+	order := orders[0]
+	if order["side"] != "Buy" || order["positionIdx"] != float64(1) || order["qty"] != "0.123" || order["reduceOnly"] != false {
+		t.Errorf("开多订单参数错误: %v", order)
+	}
+	if order["orderLinkId"] != strconv.FormatInt(result.OrderID, 10) {
+		t.Errorf("OrderID应为orderLinkId: %v vs %d", order["orderLinkId"], result.OrderID)
+	}
+
+	// 第二次开仓不再切换持仓模式
+	if _, err := trader.OpenShort("BTCUSDT", 0.01, 5); err != nil {
+		t.Fatalf("OpenShort失败: %v", err)
+	}
+	if n := len(fake.postsTo("/v5/position/switch-mode")); n != 1 {
+		t.Errorf("持仓模式应只切换一次，实际 %d 次", n)
+	}
+	short := fake.postsTo("/v5/order/create")[1]
+	if short["side"] != "Sell" || short["positionIdx"] != float64(2) {
+		t.Errorf("开空订单参数错误: %v", short)
+	}
+}
+
+func TestBybitOneWayIsolatedModes(t *testing.T) {
+	fake, trader := newFakeBybit(t)
+
+	if err := trader.SetPositionMode(PositionModeOneWay); err != nil {
+		t.Fatalf("SetPositionMode失败: %v", err)
+	}
+	if err := trader.SetMarginMode("", MarginModeIsolated); err != nil {
+		t.Fatalf("SetMarginMode失败: %v", err)
+	}
+	if err := trader.SetMarginMode("BTCUSDT", MarginModeCross); err == nil {
+		t.Error("统一账户按币种设置保证金模式应返回错误")
+	}
+
+	if _, err := trader.OpenLong("BTCUSDT", 0.01, 5); err != nil {
+		t.Fatalf("OpenLong失败: %v", err)
+	}
+	if _, err := trader.CloseLong("BTCUSDT", 0.01); err != nil {
+		t.Fatalf("CloseLong失败: %v", err)
+	}
+	if err := trader.AdjustIsolatedMargin("BTCUSDT", "LONG", 25); err != nil {
+		t.Fatalf("AdjustIsolatedMargin失败: %v", err)
+	}
+
+	// 启动时已生效，开仓前不再重复切换
+	modes := fake.postsTo("/v5/position/switch-mode")
+	if len(modes) != 1 || modes[0]["mode"] != float64(0) {
+		t.Errorf("应切换一次单向持仓模式: %v", modes)
+	}
+	margin := fake.postsTo("/v5/account/set-margin-mode")
+	if len(margin) != 1 || margin[0]["setMarginMode"] != "ISOLATED_MARGIN" {
+		t.Errorf("应切换一次逐仓模式: %v", margin)
+	}
+
+	orders := fake.postsTo("/v5/order/create")
+	if len(orders) != 2 || orders[0]["positionIdx"] != float64(0) || orders[1]["positionIdx"] != float64(0) || orders[1]["reduceOnly"] != true {
+		t.Errorf("单向持仓订单参数错误: %v", orders)
+	}
+	added := fake.postsTo("/v5/position/add-margin")
+	if len(added) != 1 || added[0]["margin"] != "25.0000" || added[0]["positionIdx"] != float64(0) {
+		t.Errorf("追加保证金参数错误: %v", added)
+	}
+}
+
+func TestBybitCloseAllUsesPositionSize(t *testing.T) {
+	fake, trader := newFakeBybit(t)
+
+	if _, err := trader.CloseShort("ETHUSDT", 0); err != nil {
+		t.Fatalf("CloseShort失败: %v", err)
+	}
+	order := fake.postsTo("/v5/order/create")[0]
+	if order["side"] != "Buy" || order["positionIdx"] != float64(2) || order["qty"] != "0.500" || order["reduceOnly"] != true {
+		t.Errorf("平空订单参数错误: %v", order)
+	}
+
+	if _, err := trader.CloseLong("ETHUSDT", 0); err == nil {
+		t.Error("没有多仓时应返回错误")
+	}
+}
+
+func TestBybitStopLossAndTakeProfit(t *testing.T) {
+	cases := []struct {
+		positionSide string
+		stopLoss     bool
+		wantSide     string
+		wantDir      float64
+	}{
+		{"LONG", true, "Sell", 2},
+		{"LONG", false, "Sell", 1},
+		{"SHORT", true, "Buy", 1},
+		{"SHORT", false, "Buy", 2},
+	}
+
+	for _, c := range cases {
+		fake, trader := newFakeBybit(t)
+		var err error
+		if c.stopLoss {
+			err = trader.SetStopLoss("BTCUSDT", c.positionSide, 0.01, 59876.54)
+		} else {
+			err = trader.SetTakeProfit("BTCUSDT", c.positionSide, 0.01, 59876.54)
+		}
+		if err != nil {
+			t.Fatalf("%s stopLoss=%v 失败: %v", c.positionSide, c.stopLoss, err)
+		}
+
+		order := fake.postsTo("/v5/order/create")[0]
+		if order["side"] != c.wantSide || order["triggerDirection"] != c.wantDir ||
+			order["triggerPrice"] != "59876.5" || order["reduceOnly"] != true || order["orderType"] != "Market" {
+			t.Errorf("%s stopLoss=%v 条件单参数错误: %v", c.positionSide, c.stopLoss, order)
+		}
+
+		// 下单参数应被归类回同一订单类型
+		classified := (&bybitOrder{Side: c.wantSide, TriggerPrice: "1", TriggerDirection: int(c.wantDir)}).orderType()
+		want := "TAKE_PROFIT_MARKET"
+		if c.stopLoss {
+			want = "STOP_MARKET"
+		}
+		if classified != want {
+			t.Errorf("%s stopLoss=%v 归类为 %s，期望 %s", c.positionSide, c.stopLoss, classified, want)
+		}
+	}
+}
+
+func TestBybitCancelStopLossOnly(t *testing.T) {
+	fake, trader := newFakeBybit(t)
+	fake.openOrders = []map[string]interface{}{
+		{"orderId": "sl-1", "symbol": "BTCUSDT", "side": "Sell", "orderType": "Market", "qty": "0.01", "triggerPrice": "59000", "triggerDirection": 2, "orderStatus": "Untriggered", "positionIdx": 1},
+		{"orderId": "tp-1", "symbol": "BTCUSDT", "side": "Sell", "orderType": "Market", "qty": "0.01", "triggerPrice": "70000", "triggerDirection": 1, "orderStatus": "Untriggered", "positionIdx": 1},
+	}
+
+	orders, err := trader.GetOpenOrders("BTCUSDT")
+	if err != nil {
+		t.Fatalf("GetOpenOrders失败: %v", err)
+	}
+	if len(orders) != 2 || orders[0].Type != "STOP_MARKET" || orders[1].Type != "TAKE_PROFIT_MARKET" ||
+		orders[0].PositionSide != "LONG" || orders[0].StopPrice != 59000 {
+		t.Errorf("挂单解析错误: %+v", orders)
+	}
+
+	if err := trader.CancelStopLossOrders("BTCUSDT"); err != nil {
+		t.Fatalf("CancelStopLossOrders失败: %v", err)
+	}
+	canceled := fake.postsTo("/v5/order/cancel")
+	if len(canceled) != 1 || canceled[0]["orderId"] != "sl-1" {
+		t.Errorf("应只取消止损单: %v", canceled)
+	}
+}
+
+func TestBybitAPIError(t *testing.T) {
+	fake, trader := newFakeBybit(t)
+	fake.retCode["/v5/account/wallet-balance"] = 10003
+
+	_, err := trader.GetBalance()
+	if err == nil || !isBybitCode(err, 10003) {
+		t.Fatalf("应返回Bybit业务错误，实际: %v", err)
+	}
+	if want := fmt.Sprintf("Bybit API错误 %d", 10003); !contains(err.Error(), want) {
+		t.Errorf("错误信息应包含 %q: %v", want, err)
+	}
+}
@@ -0,0 +1,151 @@
+package trader
+
+import (
+	"fmt"
+	"log"
+	"nofx/decision"
+	"strings"
+)
+
+// Capabilities 交易所（交易器实现）支持的功能
+// AutoTrader、提示词和决策校验据此只提供交易所能执行的操作
+type Capabilities struct {
+	TrailingStop       bool    `json:"trailing_stop"`         // 追踪止损（原生或客户端模拟）
+	ReduceOnly         bool    `json:"reduce_only"`           // 平仓单只减仓（不会反向开仓）
+	SeparateSLTPCancel bool    `json:"separate_sl_tp_cancel"` // 能单独取消止损单或止盈单
+	HedgeMode          bool    `json:"hedge_mode"`            // 支持双向持仓
+	LimitOrders        bool    `json:"limit_orders"`          // 支持限价开仓
+	AdjustMargin       bool    `json:"adjust_margin"`         // 支持调整逐仓仓位保证金
+	MinNotional        float64 `json:"min_notional"`          // 最小下单名义价值（USDT，0表示不限制或按币种校验）
+}
+
+// effectiveCapabilities 结合当前持仓模式的实际可用功能（单向持仓时不能同时持有多空）
+func effectiveCapabilities(t Trader) Capabilities {
+	caps := t.Capabilities()
+	if _, mode := t.GetTradingModes(); mode == PositionModeOneWay {
+		caps.HedgeMode = false
+	}
+	return caps
+}
+
+// forDecision 转换为决策模块使用的能力描述
+func (c Capabilities) forDecision() decision.Capabilities {
+	return decision.Capabilities{
+		TrailingStop:       c.TrailingStop,
+		ReduceOnly:         c.ReduceOnly,
+		SeparateSLTPCancel: c.SeparateSLTPCancel,
+		HedgeMode:          c.HedgeMode,
+		LimitOrders:        c.LimitOrders,
+		AdjustMargin:       c.AdjustMargin,
+		MinNotional:        c.MinNotional,
+	}
+}
+
+// String 日志用的能力摘要
+func (c Capabilities) String() string {
+	mark := func(ok bool) string {
+		if ok {
+			return "✓"
+		}
+		return "✗"
+	}
+	return fmt.Sprintf("追踪止损%s 只减仓%s 单独撤止损/止盈%s 双向持仓%s 限价单%s 调整保证金%s 最小名义价值%.0fU",
+		mark(c.TrailingStop), mark(c.ReduceOnly), mark(c.SeparateSLTPCancel), mark(c.HedgeMode),
+		mark(c.LimitOrders), mark(c.AdjustMargin), c.MinNotional)
+}
+
+// replaceProtectiveOrders 替换持仓的止损/止盈单（价格为0表示保持原有订单）
+// 交易所不能单独撤销止损或止盈单时，撤销全部挂单后重新设置两者；同时替换两者时支持联动单的交易所作为一对下单
+func replaceProtectiveOrders(t Trader, symbol, positionSide string, quantity, stopLoss, takeProfit float64) error {
+	caps := t.Capabilities()
+	if (stopLoss <= 0 || takeProfit <= 0) && !caps.SeparateSLTPCancel {
+		return fmt.Errorf("该交易所无法单独撤销止损或止盈单，必须同时更新止损和止盈")
+	}
+
+	if caps.SeparateSLTPCancel {
+		if stopLoss > 0 {
+			if err := t.CancelStopLossOrders(symbol); err != nil {
+				log.Printf("  ⚠️  取消止损单失败: %v", err)
+			}
+		}
+		if takeProfit > 0 {
+			if err := t.CancelTakeProfitOrders(symbol); err != nil {
+				log.Printf("  ⚠️  取消止盈单失败: %v", err)
+			}
+		}
+	} else if err := t.CancelAllOrders(symbol); err != nil {
+		log.Printf("  ⚠️  取消全部委托订单失败: %v", err)
+	}
+
+	side := strings.ToUpper(positionSide)
+	if bt, ok := t.(BracketTrader); ok && stopLoss > 0 && takeProfit > 0 {
+		if _, err := bt.PlaceBracket(symbol, side, quantity, stopLoss, takeProfit); err != nil {
+			return fmt.Errorf("设置新止损止盈失败: %w", err)
+		}
+		return nil
+	}
+	if stopLoss > 0 {
+		if err := t.SetStopLoss(symbol, side, quantity, stopLoss); err != nil {
+			return fmt.Errorf("设置新止损失败: %w", err)
+		}
+	}
+	if takeProfit > 0 {
+		if err := t.SetTakeProfit(symbol, side, quantity, takeProfit); err != nil {
+			return fmt.Errorf("设置新止盈失败: %w", err)
+		}
+	}
+	return nil
+}
+
+// validateProtectivePrices 校验新的止损/止盈价格（价格为0表示不更新该项）
+func validateProtectivePrices(positionSide string, currentPrice, stopLoss, takeProfit float64) error {
+	if stopLoss <= 0 && takeProfit <= 0 {
+		return fmt.Errorf("❌ 止损和止盈价格不能都为空")
+	}
+
+	if positionSide == "long" {
+		// 多头：止盈价格必须大于止损价格，止损价格应该低于当前价格
+		if stopLoss > 0 && takeProfit > 0 && takeProfit <= stopLoss {
+			return fmt.Errorf("❌ 多头持仓时，止盈价格(%.4f)必须大于止损价格(%.4f)", takeProfit, stopLoss)
+		}
+		if stopLoss >= currentPrice {
+			return fmt.Errorf("❌ 多头持仓时，止损价格(%.4f)应该低于当前价格(%.4f)", stopLoss, currentPrice)
+		}
+	} else if positionSide == "short" {
+		// 空头：止损价格必须大于止盈价格，止损价格应该高于当前价格
+		if stopLoss > 0 && takeProfit > 0 && stopLoss <= takeProfit {
+			return fmt.Errorf("❌ 空头持仓时，止损价格(%.4f)必须大于止盈价格(%.4f)", stopLoss, takeProfit)
+		}
+		if stopLoss > 0 && stopLoss <= currentPrice {
+			return fmt.Errorf("❌ 空头持仓时，止损价格(%.4f)应该高于当前价格(%.4f)", stopLoss, currentPrice)
+		}
+	}
+	return nil
+}
+
+// validateCapabilities 拒绝交易所无法执行的决策（仓位管理AI的决策不经过decision模块的校验）
+func validateCapabilities(d *decision.Decision, caps Capabilities) error {
+	switch d.Action {
+	case "increase_long", "increase_short":
+		if d.PositionSizeUSD < caps.MinNotional {
+			return fmt.Errorf("加仓价值(%.2f)低于交易所最小下单名义价值(%.0f USDT)", d.PositionSizeUSD, caps.MinNotional)
+		}
+	case "update_loss_profit":
+		if (d.StopLoss <= 0 || d.TakeProfit <= 0) && !caps.SeparateSLTPCancel {
+			return fmt.Errorf("该交易所无法单独撤销止损或止盈单，更新时止损和止盈价格都必须大于0")
+		}
+	case "set_trailing_stop":
+		if !caps.TrailingStop {
+			return fmt.Errorf("该交易所不支持追踪止损 (%s)", d.Action)
+		}
+		if d.CallbackRate < decision.MinTrailingCallbackRate || d.CallbackRate > decision.MaxTrailingCallbackRate {
+			return fmt.Errorf("追踪止损回调比例必须在%.1f%%-%.0f%%之间: %.2f",
+				decision.MinTrailingCallbackRate, decision.MaxTrailingCallbackRate, d.CallbackRate)
+		}
+	case "add_margin_long", "add_margin_short":
+		if !caps.AdjustMargin {
+			return fmt.Errorf("该交易所不支持调整逐仓保证金 (%s)", d.Action)
+		}
+	}
+	return nil
+}
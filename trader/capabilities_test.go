@@ -0,0 +1,103 @@
+package trader
+
+import (
+	"fmt"
+	"nofx/decision"
+	"strings"
+	"testing"
+)
+
+// limitedTrader 去掉部分功能的模拟盘（模拟Hyperliquid：无法单独撤销止损/止盈，不能调整保证金）
+type limitedTrader struct {
+	*PaperTrader
+}
+
+func (t *limitedTrader) Capabilities() Capabilities {
+	return Capabilities{ReduceOnly: true, LimitOrders: true, MinNotional: 10}
+}
+
+func protectiveOrders(t *testing.T, trader Trader) string {
+	orders, err := trader.GetOpenOrders("BTCUSDT")
+	if err != nil {
+		t.Fatalf("GetOpenOrders失败: %v", err)
+	}
+	var parts []string
+	for _, o := range orders {
+		parts = append(parts, fmt.Sprintf("%s@%.0f", o.Type, o.StopPrice))
+	}
+	return strings.Join(parts, ",")
+}
+
+func TestReplaceProtectiveOrdersKeepsOtherLeg(t *testing.T) {
+	paper := NewPaperTrader(10000, 0, 0)
+	paper.SetStopLoss("BTCUSDT", "LONG", 0.1, 58000)
+	paper.SetTakeProfit("BTCUSDT", "LONG", 0.1, 66000)
+
+	// 能单独撤销时只替换止损，止盈单保持不变
+	if err := replaceProtectiveOrders(paper, "BTCUSDT", "long", 0.1, 60000, 0); err != nil {
+		t.Fatalf("替换止损失败: %v", err)
+	}
+	if got := protectiveOrders(t, paper); got != "TAKE_PROFIT_MARKET@66000,STOP_MARKET@60000" {
+		t.Errorf("只应替换止损单: %s", got)
+	}
+
+	limited := &limitedTrader{NewPaperTrader(10000, 0, 0)}
+	limited.SetStopLoss("BTCUSDT", "LONG", 0.1, 58000)
+	limited.SetTakeProfit("BTCUSDT", "LONG", 0.1, 66000)
+	if err := replaceProtectiveOrders(limited, "BTCUSDT", "long", 0.1, 60000, 0); err == nil {
+		t.Error("无法单独撤销止损单的交易所应拒绝只更新止损")
+	}
+	if err := replaceProtectiveOrders(limited, "BTCUSDT", "long", 0.1, 60000, 67000); err != nil {
+		t.Fatalf("同时替换止损止盈失败: %v", err)
+	}
+	if got := protectiveOrders(t, limited); got != "STOP_MARKET@60000,TAKE_PROFIT_MARKET@67000" {
+		t.Errorf("应撤销全部挂单后重新设置: %s", got)
+	}
+}
+
+func TestPositionManagerOffersOnlySupportedActions(t *testing.T) {
+	paper := NewPaperTrader(10000, 0, 0)
+	pm := &PositionManager{trader: paper}
+	prompt := pm.buildPositionManagementSystemPrompt(10000)
+	if !strings.Contains(prompt, "add_margin_long/short") || !strings.Contains(prompt, "可以只更新其中一项") {
+		t.Error("模拟盘应提供追加保证金和单独更新止损/止盈")
+	}
+	if !strings.Contains(prompt, "set_trailing_stop") {
+		t.Error("模拟盘应提供追踪止损")
+	}
+
+	pm.trader = &limitedTrader{paper}
+	prompt = pm.buildPositionManagementSystemPrompt(10000)
+	if strings.Contains(prompt, "add_margin") || strings.Contains(prompt, "set_trailing_stop") || !strings.Contains(prompt, "必须同时给出 stop_loss 和 take_profit") {
+		t.Errorf("不应提供交易所无法执行的操作:\n%s", prompt)
+	}
+
+	response := `分析 [{"symbol":"BTCUSDT","action":"add_margin_long","margin_usd":50,"reasoning":"接近强平"}]`
+	if _, err := pm.parsePositionManagementResponse(response, 10000); err == nil {
+		t.Error("不支持调整保证金时应拒绝add_margin决策")
+	}
+	response = `分析 [{"symbol":"BTCUSDT","action":"update_loss_profit","stop_loss":60000,"reasoning":"保本"}]`
+	if _, err := pm.parsePositionManagementResponse(response, 10000); err == nil {
+		t.Error("无法单独撤销止损单时应拒绝只更新止损")
+	}
+	response = `分析 [{"symbol":"BTCUSDT","action":"set_trailing_stop","callback_rate":1,"reasoning":"锁定利润"}]`
+	if _, err := pm.parsePositionManagementResponse(response, 10000); err == nil {
+		t.Error("不支持追踪止损时应拒绝set_trailing_stop决策")
+	}
+	if err := validateCapabilities(&decision.Decision{Action: "increase_long", PositionSizeUSD: 8}, pm.trader.Capabilities()); err == nil {
+		t.Error("低于最小名义价值的加仓应被拒绝")
+	}
+}
+
+func TestEffectiveCapabilitiesFollowsPositionMode(t *testing.T) {
+	paper := NewPaperTrader(10000, 0, 0)
+	if !effectiveCapabilities(paper).HedgeMode {
+		t.Fatal("模拟盘默认双向持仓")
+	}
+	if err := paper.SetPositionMode(PositionModeOneWay); err != nil {
+		t.Fatalf("SetPositionMode失败: %v", err)
+	}
+	if effectiveCapabilities(paper).HedgeMode || !paper.Capabilities().HedgeMode {
+		t.Error("单向持仓时实际不能同时持有多空，但交易所本身仍支持双向持仓")
+	}
+}
@@ -0,0 +1,201 @@
+package trader
+
+import (
+	"fmt"
+	"log"
+	"nofx/logger"
+	"time"
+)
+
+// breakerLimits 熔断限制（百分比，0表示不限制）
+type breakerLimits struct {
+	MaxDailyLoss    float64       // 最大日亏损百分比（相对当日UTC零点后首次检查时的净值）
+	MaxDrawdown     float64       // 最大回撤百分比（相对净值峰值）
+	StopTradingTime time.Duration // 触发后暂停开仓和加仓的时长
+}
+
+// enabled 是否配置了任一限制
+func (l breakerLimits) enabled() bool {
+	return l.MaxDailyLoss > 0 || l.MaxDrawdown > 0
+}
+
+// applyBreakerDefaults 配置了熔断限制时默认暂停60分钟，并打印熔断配置
+func applyBreakerDefaults(name string, limits *breakerLimits, flatten bool) {
+	if !limits.enabled() {
+		return
+	}
+	if limits.StopTradingTime <= 0 {
+		limits.StopTradingTime = 60 * time.Minute
+	}
+	log.Printf("🚨 [%s] 熔断: 日亏损上限%.2f%%，回撤上限%.2f%%，触发后暂停开仓%v (平仓: %v)",
+		name, limits.MaxDailyLoss, limits.MaxDrawdown, limits.StopTradingTime, flatten)
+}
+
+// breakerState 日亏损和最大回撤熔断的状态（跨重启保存，重启不会解除熔断或重置净值峰值）
+type breakerState struct {
+	DayStart       time.Time `json:"day_start"`        // 当日开始时间（UTC零点）
+	DayStartEquity float64   `json:"day_start_equity"` // 当日开始时的净值
+	PeakEquity     float64   `json:"peak_equity"`      // 净值峰值
+	Equity         float64   `json:"equity"`           // 最近一次检查时的净值
+	StopUntil      time.Time `json:"stop_until"`       // 熔断结束时间（之前暂停开仓和加仓）
+	Reason         string    `json:"reason,omitempty"` // 最近一次触发的原因
+	TrippedAt      time.Time `json:"tripped_at"`       // 最近一次触发的时间
+}
+
+// isOpeningAction 是否为增加风险敞口的决策（熔断期间禁止）
+func isOpeningAction(action string) bool {
+	switch action {
+	case "open_long", "open_short", "increase_long", "increase_short":
+		return true
+	}
+	return false
+}
+
+// active 是否处于熔断中
+func (b *breakerState) active() bool {
+	return time.Now().Before(b.StopUntil)
+}
+
+// dailyPnL 日盈亏 = 最近一次检查时的净值 - 当日开始时的净值
+func (b *breakerState) dailyPnL() float64 {
+	return b.Equity - b.DayStartEquity
+}
+
+// blockedError 熔断期间拒绝开仓和加仓的错误
+func (b *breakerState) blockedError() error {
+	return fmt.Errorf("熔断暂停中（%s），%s 前禁止开仓和加仓", b.Reason, b.StopUntil.Format("2006-01-02 15:04:05"))
+}
+
+// update 按当前净值更新日盈亏和净值峰值，超过限制时触发熔断并设置暂停结束时间
+// 日盈亏包含已实现、未实现盈亏、手续费和资金费
+// 返回本次触发的原因（未触发或已在熔断中时为空）；熔断结束时仍超过限制会再次触发
+func (b *breakerState) update(name string, limits breakerLimits, equity float64, now time.Time) string {
+	if day := now.UTC().Truncate(24 * time.Hour); b.DayStart.IsZero() || day.After(b.DayStart) {
+		b.DayStart, b.DayStartEquity = day, equity
+		log.Printf("📅 [%s] 新的交易日，日盈亏从净值 %.2f USDT 开始计算", name, equity)
+	}
+	if equity > b.PeakEquity {
+		b.PeakEquity = equity
+	}
+	b.Equity = equity
+
+	if now.Before(b.StopUntil) {
+		return ""
+	}
+	reason := ""
+	if limits.MaxDailyLoss > 0 && b.DayStartEquity > 0 {
+		if lossPct := -b.dailyPnL() / b.DayStartEquity * 100; lossPct >= limits.MaxDailyLoss {
+			reason = fmt.Sprintf("日亏损 %.2f%% (%.2f USDT) 达到上限 %.2f%%", lossPct, -b.dailyPnL(), limits.MaxDailyLoss)
+		}
+	}
+	if reason == "" && limits.MaxDrawdown > 0 && b.PeakEquity > 0 {
+		if drawdownPct := (b.PeakEquity - equity) / b.PeakEquity * 100; drawdownPct >= limits.MaxDrawdown {
+			reason = fmt.Sprintf("回撤 %.2f%% (净值峰值 %.2f → %.2f USDT) 达到上限 %.2f%%", drawdownPct, b.PeakEquity, equity, limits.MaxDrawdown)
+		}
+	}
+	if reason != "" {
+		b.StopUntil = now.Add(limits.StopTradingTime)
+		b.Reason = reason
+		b.TrippedAt = now
+	}
+	return reason
+}
+
+// snapshot 当前的熔断状态（用于状态接口和决策日志）
+func (b *breakerState) snapshot(limits breakerLimits) *logger.CircuitBreakerSnapshot {
+	snapshot := &logger.CircuitBreakerSnapshot{
+		Equity:          b.Equity,
+		DayStartEquity:  b.DayStartEquity,
+		DailyPnL:        b.dailyPnL(),
+		PeakEquity:      b.PeakEquity,
+		MaxDailyLossPct: limits.MaxDailyLoss,
+		MaxDrawdownPct:  limits.MaxDrawdown,
+		Tripped:         b.active(),
+		Reason:          b.Reason,
+		TrippedAt:       b.TrippedAt,
+		StopUntil:       b.StopUntil,
+	}
+	if b.DayStartEquity > 0 {
+		snapshot.DailyPnLPct = b.dailyPnL() / b.DayStartEquity * 100
+	}
+	if b.PeakEquity > 0 {
+		snapshot.DrawdownPct = (b.PeakEquity - b.Equity) / b.PeakEquity * 100
+	}
+	return snapshot
+}
+
+// check 每个周期开始时按账户净值检查熔断，状态写入决策记录，返回本次触发的原因
+func (b *breakerState) check(t Trader, name string, limits breakerLimits, record *logger.DecisionRecord) string {
+	balance, err := t.GetBalance()
+	if err != nil {
+		log.Printf("  ⚠ [%s] 获取账户余额失败，本周期未更新熔断状态: %v", name, err)
+		record.CircuitBreaker = b.snapshot(limits)
+		return ""
+	}
+	reason := b.update(name, limits, balance.TotalEquity(), time.Now())
+	record.CircuitBreaker = b.snapshot(limits)
+
+	if reason == "" {
+		if b.active() {
+			msg := fmt.Sprintf("⏸ 熔断中（%s），暂停开仓和加仓，剩余 %.0f 分钟", b.Reason, time.Until(b.StopUntil).Minutes())
+			log.Println(msg)
+			record.ExecutionLog = append(record.ExecutionLog, msg)
+		}
+		return ""
+	}
+
+	msg := fmt.Sprintf("🚨 触发熔断: %s，暂停开仓和加仓至 %s", reason, b.StopUntil.Format("2006-01-02 15:04:05"))
+	log.Printf("%s [%s]", msg, name)
+	record.ExecutionLog = append(record.ExecutionLog, msg)
+	return reason
+}
+
+// flattenOnBreaker 触发熔断后撤销所有挂单并市价平掉全部持仓，结果合并到本周期的决策记录
+func flattenOnBreaker(t Trader, traderID, exchange, name, reason string, symbols []string, record *logger.DecisionRecord) {
+	_, flat := flattenAccount(t, traderID, exchange, name, "熔断: "+reason, symbols)
+	record.Decisions = append(record.Decisions, flat.Decisions...)
+	record.ExecutionLog = append(record.ExecutionLog, flat.ExecutionLog...)
+	if !flat.Success {
+		record.Success = false
+		record.ErrorMessage = flat.ErrorMessage
+	}
+}
+
+// breakerLimits 交易机器人的熔断限制
+func (at *AutoTrader) breakerLimits() breakerLimits {
+	return breakerLimits{MaxDailyLoss: at.config.MaxDailyLoss, MaxDrawdown: at.config.MaxDrawdown, StopTradingTime: at.config.StopTradingTime}
+}
+
+// breakerActive 是否处于熔断中
+func (at *AutoTrader) breakerActive() bool {
+	return at.breaker.active()
+}
+
+// breakerSnapshot 当前的熔断状态（用于状态接口和决策日志）
+func (at *AutoTrader) breakerSnapshot() *logger.CircuitBreakerSnapshot {
+	return at.breaker.snapshot(at.breakerLimits())
+}
+
+// checkCircuitBreaker 每个周期开始时检查熔断，返回本次触发的原因
+// 触发时让未成交的限价开仓单在本周期撤单（由checkRestingEntries处理已成交的部分）
+func (at *AutoTrader) checkCircuitBreaker(record *logger.DecisionRecord) string {
+	reason := at.breaker.check(at.trader, at.name, at.breakerLimits(), record)
+	at.dailyPnL = at.breaker.dailyPnL()
+	if reason != "" {
+		for _, entry := range at.restingEntries {
+			entry.CyclesWaited = at.config.EntryOrderMaxCycles // 本周期检查时撤单
+		}
+	}
+	return reason
+}
+
+// flattenOnBreaker 触发熔断后撤销所有挂单并市价平掉全部持仓（配置了FlattenOnBreaker时）
+func (at *AutoTrader) flattenOnBreaker(record *logger.DecisionRecord, reason string) {
+	flattenOnBreaker(at.trader, at.id, at.exchange, at.name, reason, at.orphans.trackedSymbols(), record)
+	at.restingEntries = make(map[string]*RestingEntry)
+}
+
+// breakerLimits 仓位管理器的熔断限制
+func (pm *PositionManager) breakerLimits() breakerLimits {
+	return breakerLimits{MaxDailyLoss: pm.config.MaxDailyLoss, MaxDrawdown: pm.config.MaxDrawdown, StopTradingTime: pm.config.StopTradingTime}
+}
@@ -0,0 +1,214 @@
+package trader
+
+import (
+	"nofx/decision"
+	"nofx/logger"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBreakerStateTripsOnDailyLossAndDrawdown(t *testing.T) {
+	at := &AutoTrader{name: "test", config: AutoTraderConfig{MaxDailyLoss: 5, MaxDrawdown: 10, StopTradingTime: time.Hour}}
+	update := func(equity float64, now time.Time) string {
+		return at.breaker.update(at.name, at.breakerLimits(), equity, now)
+	}
+	day1 := time.Date(2026, 3, 1, 1, 0, 0, 0, time.UTC)
+
+	if reason := update(1000, day1); reason != "" {
+		t.Fatalf("首次检查不应触发: %s", reason)
+	}
+	if reason := update(1100, day1.Add(time.Hour)); reason != "" || !floatEq(at.breaker.dailyPnL(), 100) {
+		t.Fatalf("盈利时不应触发: %s (日盈亏 %.2f)", reason, at.breaker.dailyPnL())
+	}
+
+	// 日亏损 = 940 - 1000 = -6%，超过5%
+	now := day1.Add(2 * time.Hour)
+	reason := update(940, now)
+	if !strings.Contains(reason, "日亏损") || !at.breaker.StopUntil.Equal(now.Add(time.Hour)) || !floatEq(at.breaker.dailyPnL(), -60) {
+		t.Fatalf("日亏损应触发熔断: %q %+v", reason, at.breaker)
+	}
+	// 熔断期间不再重复触发
+	if reason := update(900, now.Add(30*time.Minute)); reason != "" || !at.breaker.TrippedAt.Equal(now) {
+		t.Errorf("熔断期间不应重复触发: %q", reason)
+	}
+
+	// 第二天日盈亏重新计算，但回撤相对净值峰值1100：1100 → 980 = 10.9%
+	day2 := day1.Add(24 * time.Hour)
+	if reason := update(995, day2); reason != "" {
+		t.Errorf("回撤10%%以内不应触发: %q", reason)
+	}
+	if at.breaker.DayStartEquity != 995 || at.breaker.dailyPnL() != 0 {
+		t.Errorf("新的交易日应重置日盈亏: %+v", at.breaker)
+	}
+	if reason := update(980, day2.Add(time.Minute)); !strings.Contains(reason, "回撤") {
+		t.Errorf("回撤超过10%%应触发熔断: %q", reason)
+	}
+	if snapshot := at.breakerSnapshot(); snapshot.PeakEquity != 1100 || snapshot.DrawdownPct < 10.9 || snapshot.DrawdownPct > 10.91 {
+		t.Errorf("熔断快照错误: %+v", snapshot)
+	}
+}
+
+func TestBreakerStateDisabledWithoutLimits(t *testing.T) {
+	at := &AutoTrader{name: "test"}
+	now := time.Now()
+	at.breaker.update(at.name, at.breakerLimits(), 1000, now)
+	if reason := at.breaker.update(at.name, at.breakerLimits(), 100, now); reason != "" || at.breakerActive() {
+		t.Errorf("未配置限制时不应触发: %q", reason)
+	}
+}
+
+func TestBreakerBlocksOpeningDecisions(t *testing.T) {
+	at := &AutoTrader{name: "test"}
+	at.breaker.StopUntil = time.Now().Add(time.Hour)
+	at.breaker.Reason = "日亏损 6.00%"
+
+	for _, action := range []string{"open_long", "open_short", "increase_long", "increase_short"} {
+		err := at.executeDecisionWithRecord(&decision.Decision{Symbol: "BTCUSDT", Action: action}, &logger.DecisionAction{})
+		if err == nil || !strings.Contains(err.Error(), "熔断") {
+			t.Errorf("熔断期间应拒绝%s: %v", action, err)
+		}
+	}
+	if err := at.executeDecisionWithRecord(&decision.Decision{Symbol: "BTCUSDT", Action: "hold"}, &logger.DecisionAction{}); err != nil {
+		t.Errorf("熔断期间应允许观望: %v", err)
+	}
+}
+
+func TestCheckCircuitBreakerFlattensOnTrip(t *testing.T) {
+	ledger, trader := newFakeBinance(t)
+	if _, err := trader.OpenLong("BTCUSDT", 0.1, 5); err != nil {
+		t.Fatalf("开多仓失败: %v", err)
+	}
+	if err := trader.SetStopLoss("BTCUSDT", "LONG", 0.1, 50000); err != nil {
+		t.Fatalf("设置止损失败: %v", err)
+	}
+
+	at := newKillTestTrader(t, trader)
+	at.config = AutoTraderConfig{MaxDailyLoss: 5, StopTradingTime: time.Hour, FlattenOnBreaker: true}
+	record := &logger.DecisionRecord{Success: true}
+	if reason := at.checkCircuitBreaker(record); reason != "" || record.CircuitBreaker == nil {
+		t.Fatalf("首次检查不应触发: %q", reason)
+	}
+	dayStart := at.breaker.DayStartEquity
+
+	// 价格下跌后未实现亏损 0.1 × 6000 = 600 USDT，超过当日净值的5%
+	ledger.SetPrice("BTCUSDT", 54000)
+	record = &logger.DecisionRecord{Success: true}
+	reason := at.checkCircuitBreaker(record)
+	if reason == "" || !at.breakerActive() {
+		t.Fatalf("日亏损超限应触发熔断 (当日净值 %.2f → %.2f)", dayStart, at.breaker.Equity)
+	}
+	if cb := record.CircuitBreaker; cb == nil || !cb.Tripped || cb.DailyPnL > -599 || cb.Reason != reason {
+		t.Errorf("决策记录中的熔断状态错误: %+v", cb)
+	}
+
+	at.flattenOnBreaker(record, reason)
+	if positions := ledger.Positions(); len(positions) != 0 {
+		t.Errorf("熔断后应平掉全部持仓: %+v", positions)
+	}
+	if orders := ledger.OpenOrders("BTCUSDT"); len(orders) != 0 {
+		t.Errorf("熔断后应撤销全部挂单: %+v", orders)
+	}
+	if !record.Success || len(record.Decisions) != 2 {
+		t.Errorf("熔断平仓应写入决策记录: %+v", record)
+	}
+
+	// 熔断状态随交易器状态保存，重启后仍然生效
+	at.saveState()
+	restored := newKillTestTrader(t, trader)
+	restored.state = at.state
+	restored.restoreState()
+	if !restored.breakerActive() || restored.breaker.PeakEquity != at.breaker.PeakEquity {
+		t.Errorf("重启后应恢复熔断状态: %+v", restored.breaker)
+	}
+}
+
+func TestFlattenOnBreakerWithPositionCache(t *testing.T) {
+	ledger, trader := newFakeBinance(t)
+	trader.cacheDuration = 15 * time.Second // 默认缓存时长
+	if _, err := trader.OpenShort("BTCUSDT", 0.1, 5); err != nil {
+		t.Fatalf("开空仓失败: %v", err)
+	}
+	if positions, err := trader.GetPositions(); err != nil || len(positions) != 1 {
+		t.Fatalf("查询持仓失败: %v %+v", err, positions)
+	}
+
+	at := newKillTestTrader(t, trader)
+	at.config = AutoTraderConfig{MaxDrawdown: 5, StopTradingTime: time.Hour, FlattenOnBreaker: true}
+	now := time.Now()
+	at.breaker.update(at.name, at.breakerLimits(), 10000, now)
+	reason := at.breaker.update(at.name, at.breakerLimits(), 9000, now)
+	if reason == "" {
+		t.Fatal("回撤超限应触发熔断")
+	}
+
+	record := &logger.DecisionRecord{Success: true}
+	at.flattenOnBreaker(record, reason)
+	if positions := ledger.Positions(); len(positions) != 0 {
+		t.Errorf("熔断后应平掉全部持仓: %+v", positions)
+	}
+	if !record.Success || record.ErrorMessage != "" {
+		t.Errorf("平仓成功后不应记录为失败: %+v", record)
+	}
+}
+
+// newBreakerTestManager 配置了日亏损熔断（触发时平仓）的仓位管理器
+func newBreakerTestManager(t *testing.T, tr Trader) *PositionManager {
+	dir := t.TempDir()
+	decisionLogger := logger.NewDecisionLogger(dir)
+	return &PositionManager{
+		id:             "pm",
+		name:           "PM",
+		exchange:       "binance",
+		config:         PositionManagerConfig{MaxDailyLoss: 5, StopTradingTime: time.Hour, FlattenOnBreaker: true},
+		trader:         tr,
+		decisionLogger: decisionLogger,
+		orphans:        newOrphanSweeper(tr, "PM", decisionLogger),
+		state:          newStateStore(dir),
+	}
+}
+
+func TestPositionManagerBreakerBlocksIncrease(t *testing.T) {
+	_, trader := newFakeBinance(t)
+	pm := newBreakerTestManager(t, trader)
+	pm.breaker.StopUntil = time.Now().Add(time.Hour)
+	pm.breaker.Reason = "日亏损 6.00%"
+
+	for _, action := range []string{"increase_long", "increase_short"} {
+		err := pm.executeDecisionWithRecord(&decision.Decision{Symbol: "BTCUSDT", Action: action}, &logger.DecisionAction{})
+		if err == nil || !strings.Contains(err.Error(), "熔断") {
+			t.Errorf("熔断期间应拒绝%s: %v", action, err)
+		}
+	}
+}
+
+func TestPositionManagerBreakerFlattensOnTrip(t *testing.T) {
+	ledger, trader := newFakeBinance(t)
+	if _, err := trader.OpenLong("BTCUSDT", 0.1, 5); err != nil {
+		t.Fatalf("开多仓失败: %v", err)
+	}
+
+	// 当日开始时净值为11000，当前约10000：日亏损约9%，超过5%
+	pm := newBreakerTestManager(t, trader)
+	pm.breaker = breakerState{DayStart: time.Now().UTC().Truncate(24 * time.Hour), DayStartEquity: 11000, PeakEquity: 11000}
+	if err := pm.runCycle(); err != nil {
+		t.Fatalf("管理周期失败: %v", err)
+	}
+	if !pm.breaker.active() {
+		t.Fatal("日亏损超限应触发熔断")
+	}
+	if positions := ledger.Positions(); len(positions) != 0 {
+		t.Errorf("熔断后应平掉全部持仓: %+v", positions)
+	}
+
+	records, err := pm.decisionLogger.GetLatestRecords(1)
+	if err != nil || len(records) != 1 {
+		t.Fatalf("读取决策记录失败: %v", err)
+	}
+	if cb := records[0].CircuitBreaker; cb == nil || !cb.Tripped || len(records[0].Decisions) != 2 {
+		t.Errorf("决策记录应包含熔断状态和平仓操作: %+v", records[0])
+	}
+	if status := pm.GetStatus(); !status["circuit_breaker"].(*logger.CircuitBreakerSnapshot).Tripped {
+		t.Errorf("状态接口应显示熔断: %+v", status["circuit_breaker"])
+	}
+}
@@ -0,0 +1,161 @@
+package trader
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ClientOrderRef 下单所属的交易器、周期和决策，用于生成客户端订单ID
+// 订单和成交可以据此追溯到产生它的决策（决策日志的周期编号和决策序号）
+type ClientOrderRef struct {
+	TraderID string
+	RunID    int64 // 进程启动时间（Unix秒），避免重启后周期编号重复导致ID冲突
+	Cycle    int   // 周期编号（0表示不属于任何决策周期，如手动平仓）
+	Decision int   // 周期内的决策序号（从1开始，0表示不属于任何决策）
+}
+
+// clientOrderID 一个客户端订单ID（同一次下单的重试使用同一个ID）
+type clientOrderID struct {
+	ref ClientOrderRef
+	seq uint32 // 同一交易器内的下单序号，区分同一决策下的多个订单
+}
+
+// String 币安/Aster/OKX使用的ID：只含小写字母和数字，不超过32个字符
+// 格式: <交易器标识><启动时间(36进制)>c<周期>d<决策>s<序号>，例如 okxdst4x9k0c12d2s7
+func (c *clientOrderID) String() string {
+	if c == nil {
+		return ""
+	}
+	return fmt.Sprintf("%s%sc%dd%ds%d", clientOrderTag(c.ref.TraderID),
+		strconv.FormatInt(c.ref.RunID, 36), c.ref.Cycle, c.ref.Decision, c.seq)
+}
+
+// Cloid Hyperliquid使用的ID：0x加16字节
+// [0:4]交易器ID哈希 [4:8]启动时间 [8:12]周期 [12:14]决策 [14:16]序号
+func (c *clientOrderID) Cloid() string {
+	if c == nil {
+		return ""
+	}
+	var b [16]byte
+	h := fnv.New32a()
+	h.Write([]byte(c.ref.TraderID))
+	binary.BigEndian.PutUint32(b[0:4], h.Sum32())
+	binary.BigEndian.PutUint32(b[4:8], uint32(c.ref.RunID))
+	binary.BigEndian.PutUint32(b[8:12], uint32(c.ref.Cycle))
+	binary.BigEndian.PutUint16(b[12:14], uint16(c.ref.Decision))
+	binary.BigEndian.PutUint16(b[14:16], uint16(c.seq))
+	return "0x" + hex.EncodeToString(b[:])
+}
+
+// clientOrderTag 交易器ID的简写：去掉非字母数字字符后不超过10个字符时原样使用，否则取前4个字符加哈希
+func clientOrderTag(traderID string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(traderID) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		}
+	}
+	tag := b.String()
+	if len(tag) <= 10 {
+		return tag
+	}
+	h := fnv.New32a()
+	h.Write([]byte(traderID))
+	return fmt.Sprintf("%s%06x", tag[:4], h.Sum32()&0xffffff)
+}
+
+// clientOrderIDs 生成客户端订单ID（交易器内嵌使用，通过SetClientOrderRef实现ClientOrderIDTrader）
+type clientOrderIDs struct {
+	clientOrderMu  sync.Mutex
+	clientOrderRef *ClientOrderRef
+	clientOrderSeq uint32
+}
+
+// SetClientOrderRef 设置之后下单所属的交易器、周期和决策
+func (c *clientOrderIDs) SetClientOrderRef(ref ClientOrderRef) {
+	c.clientOrderMu.Lock()
+	defer c.clientOrderMu.Unlock()
+	c.clientOrderRef = &ref
+}
+
+// nextClientOrderID 为一次下单生成客户端订单ID（未设置ClientOrderRef时返回nil，不附带ID）
+func (c *clientOrderIDs) nextClientOrderID() *clientOrderID {
+	c.clientOrderMu.Lock()
+	defer c.clientOrderMu.Unlock()
+	if c.clientOrderRef == nil {
+		return nil
+	}
+	c.clientOrderSeq++
+	return &clientOrderID{ref: *c.clientOrderRef, seq: c.clientOrderSeq}
+}
+
+// setClientOrderRef 设置交易器的下单归属（交易器不支持客户端订单ID时忽略）
+func setClientOrderRef(t Trader, ref ClientOrderRef) {
+	if ct, ok := t.(ClientOrderIDTrader); ok {
+		ct.SetClientOrderRef(ref)
+	}
+}
+
+// orderRetryDelay 下单结果不确定时，按ID查询订单前的等待时间（按尝试次数递增）
+var orderRetryDelay = time.Second
+
+// maxOrderAttempts 下单最多发送的次数
+const maxOrderAttempts = 3
+
+// submitOrder 发送下单请求；超时、连接中断等无法确定订单是否送达的错误，先按客户端订单ID查询，
+// 交易所没有该订单时才重新发送，避免重复开仓。
+// lookup返回(nil, nil)表示交易所没有该订单；clientOrderID为空时无法确认，只发送一次
+func submitOrder(clientOrderID string, submit func() (*OrderResult, error), lookup func() (*OrderResult, error)) (*OrderResult, error) {
+	var lastErr error
+	for attempt := 1; attempt <= maxOrderAttempts; attempt++ {
+		result, err := submit()
+		if err == nil {
+			if clientOrderID != "" {
+				result.ClientOrderID = clientOrderID
+			}
+			return result, nil
+		}
+		if clientOrderID == "" || !isAmbiguousOrderError(err) {
+			return nil, err
+		}
+		lastErr = err
+
+		log.Printf("  ⚠ 下单结果不确定 (客户端订单ID: %s): %v，查询订单后再决定是否重试", clientOrderID, err)
+		time.Sleep(time.Duration(attempt) * orderRetryDelay)
+		existing, lookupErr := lookup()
+		if lookupErr != nil {
+			// 无法确认订单是否送达时不能重发
+			return nil, fmt.Errorf("下单结果不确定且查询订单失败（未重试，避免重复下单）: %w (查询: %v)", err, lookupErr)
+		}
+		if existing != nil {
+			log.Printf("  ✓ 订单已送达交易所 (客户端订单ID: %s 订单ID: %d)，不再重复下单", clientOrderID, existing.OrderID)
+			existing.ClientOrderID = clientOrderID
+			return existing, nil
+		}
+	}
+	return nil, fmt.Errorf("下单失败（已重试%d次）: %w", maxOrderAttempts, lastErr)
+}
+
+// isAmbiguousOrderError 请求是否可能已被交易所处理但没有收到响应（超时、连接中断）
+func isAmbiguousOrderError(err error) bool {
+	var netErr net.Error
+	if (errors.As(err, &netErr) && netErr.Timeout()) || errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	msg := err.Error()
+	return strings.Contains(msg, "timeout") ||
+		strings.Contains(msg, "connection reset") ||
+		strings.Contains(msg, "EOF")
+}
@@ -0,0 +1,127 @@
+package trader
+
+import (
+	"nofx/trader/fakeexchange"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClientOrderIDFormat(t *testing.T) {
+	var ids clientOrderIDs
+	if ids.nextClientOrderID() != nil {
+		t.Fatal("未设置归属时不应生成客户端订单ID")
+	}
+
+	ids.SetClientOrderRef(ClientOrderRef{TraderID: "binance_qwen_main", RunID: 1760000000, Cycle: 12345, Decision: 3})
+	first, second := ids.nextClientOrderID(), ids.nextClientOrderID()
+
+	id := first.String()
+	if !regexp.MustCompile(`^[a-z0-9]{1,32}$`).MatchString(id) || !strings.HasSuffix(id, "c12345d3s1") {
+		t.Errorf("客户端订单ID格式错误: %q", id)
+	}
+	if id == second.String() || first.Cloid() == second.Cloid() {
+		t.Error("同一决策下的多个订单ID应不同")
+	}
+	if !regexp.MustCompile(`^0x[0-9a-f]{32}$`).MatchString(first.Cloid()) {
+		t.Errorf("cloid格式错误: %q", first.Cloid())
+	}
+	if got := clientOrderTag("okx_ds"); got != "okxds" {
+		t.Errorf("短交易器ID应原样保留: %q", got)
+	}
+}
+
+func TestBinanceOrderCarriesClientOrderID(t *testing.T) {
+	ledger, trader := newFakeBinance(t)
+	trader.SetClientOrderRef(ClientOrderRef{TraderID: "bn", RunID: 1760000000, Cycle: 7, Decision: 2})
+
+	result, err := trader.OpenLong("BTCUSDT", 0.1, 10)
+	if err != nil {
+		t.Fatalf("开多仓失败: %v", err)
+	}
+	if !strings.HasPrefix(result.ClientOrderID, "bn") || !strings.Contains(result.ClientOrderID, "c7d2") {
+		t.Errorf("下单结果应带有客户端订单ID: %+v", result)
+	}
+	if order, ok := ledger.Order(result.OrderID); !ok || order.ClientOrderID != result.ClientOrderID {
+		t.Errorf("交易所订单的客户端订单ID不一致: %+v", order)
+	}
+	if queried, err := trader.GetOrder("BTCUSDT", result.OrderID); err != nil || queried.ClientOrderID != result.ClientOrderID {
+		t.Errorf("查询订单应返回客户端订单ID: %+v, %v", queried, err)
+	}
+}
+
+func TestOrderRetryAfterTimeoutDoesNotDuplicate(t *testing.T) {
+	defer func(delay time.Duration) { orderRetryDelay = delay }(orderRetryDelay)
+	orderRetryDelay = 0
+
+	ledger := fakeexchange.NewLedger(10000, 0.0004)
+	ledger.AddSymbol(fakeexchange.SymbolSpec{Symbol: "BTCUSDT", StepSize: 0.001, TickSize: 0.1}, 60000)
+	apiKey := "binance-" + t.Name()
+	server := fakeexchange.NewBinance(ledger, apiKey, "binance-secret")
+	t.Cleanup(server.Close)
+	trader := NewFuturesTraderWithBaseURL(apiKey, "binance-secret", server.URL)
+	trader.cacheDuration, trader.leverageCooldown, trader.marginTypeCooldown = 0, 0, 0
+	trader.SetClientOrderRef(ClientOrderRef{TraderID: "bn", RunID: 1760000000, Cycle: 1, Decision: 1})
+
+	// 订单已成交但响应丢失：按客户端订单ID查到订单后不再重发
+	server.DropOrderResponses(1)
+	result, err := trader.OpenLong("BTCUSDT", 0.1, 10)
+	if err != nil {
+		t.Fatalf("响应丢失后应查询到已成交的订单: %v", err)
+	}
+	if pos, _ := ledger.Position("BTCUSDT", "LONG"); !floatEq(pos.Amount, 0.1) {
+		t.Errorf("不应重复开仓: %+v", pos)
+	}
+	if result.Status != "FILLED" || !floatEq(result.ExecutedQty, 0.1) || result.ClientOrderID == "" {
+		t.Errorf("应返回查询到的订单: %+v", result)
+	}
+}
+
+func TestAsterTimeoutDoesNotResendBlindly(t *testing.T) {
+	defer func(delay time.Duration) { orderRetryDelay = delay }(orderRetryDelay)
+	orderRetryDelay = 0
+
+	ledger := fakeexchange.NewLedger(5000, 0.0005)
+	ledger.AddSymbol(fakeexchange.SymbolSpec{Symbol: "BTCUSDT", StepSize: 0.001, TickSize: 0.1}, 60000)
+	signer := "aster-signer-" + t.Name()
+	server := fakeexchange.NewAster(ledger, "aster-user", signer)
+	t.Cleanup(server.Close)
+	trader, err := NewAsterTraderWithBaseURL("aster-user", signer, testPrivateKey, server.URL)
+	if err != nil {
+		t.Fatalf("创建Aster交易器失败: %v", err)
+	}
+	trader.SetClientOrderRef(ClientOrderRef{TraderID: "aster", RunID: 1760000000, Cycle: 3, Decision: 1})
+
+	server.DropOrderResponses(1)
+	result, err := trader.OpenShort("BTCUSDT", 0.05, 5)
+	if err != nil {
+		t.Fatalf("响应丢失后应查询到已成交的订单: %v", err)
+	}
+	if pos, _ := ledger.Position("BTCUSDT", "BOTH"); !floatEq(pos.Amount, -0.05) {
+		t.Errorf("请求层不应直接重发下单: %+v", pos)
+	}
+	if result.ClientOrderID == "" || !strings.Contains(result.ClientOrderID, "c3d1") {
+		t.Errorf("应返回客户端订单ID: %+v", result)
+	}
+}
+
+func TestHyperliquidOrderSendsCloid(t *testing.T) {
+	server, trader := newFakeHyperliquid(t)
+	trader.SetClientOrderRef(ClientOrderRef{TraderID: "hl", RunID: 1760000000, Cycle: 4, Decision: 1})
+
+	result, err := trader.OpenLong("ETHUSDT", 0.2, 5)
+	if err != nil {
+		t.Fatalf("开多仓失败: %v", err)
+	}
+	if !regexp.MustCompile(`^0x[0-9a-f]{32}$`).MatchString(result.ClientOrderID) {
+		t.Fatalf("下单结果应带有cloid: %+v", result)
+	}
+	order, ok := server.Ledger.OrderByClientID(result.ClientOrderID)
+	if !ok || order.OrderID != result.OrderID {
+		t.Fatalf("交易所应收到cloid: %+v", order)
+	}
+	if queried, err := trader.GetOrder("ETHUSDT", result.OrderID); err != nil || queried.ClientOrderID != result.ClientOrderID {
+		t.Errorf("查询订单应返回cloid: %+v, %v", queried, err)
+	}
+}
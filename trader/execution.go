@@ -0,0 +1,195 @@
+package trader
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"nofx/logger"
+	"time"
+)
+
+// 拆单执行算法（ExecutionConfig.Algo）
+const (
+	ExecutionMarket  = "market"  // 单笔市价单
+	ExecutionTWAP    = "twap"    // 按时间均匀拆成若干笔市价单
+	ExecutionIceberg = "iceberg" // 每次只下一小笔（默认不超过盘口一档的数量），成交后再下一笔
+)
+
+// maxChildOrders 单次拆单最多的子订单数（数量很大时增大每笔数量）
+const maxChildOrders = 50
+
+// ExecutionConfig 开仓、加仓和减仓的拆单执行配置（平仓始终单笔下单）
+type ExecutionConfig struct {
+	Algo         string        // "market"（默认）, "twap" 或 "iceberg"
+	ThresholdUSD float64       // 订单价值达到该值才拆单（0表示全部拆单）
+	Slices       int           // TWAP的子订单数（默认5，冰山单无法确定每笔数量时也使用）
+	Interval     time.Duration // 子订单的间隔（TWAP默认10秒，冰山单默认2秒）
+	SliceUSD     float64       // 冰山单每笔的价值（0表示按盘口一档的数量）
+}
+
+// childOrderFunc 下一笔子订单（开仓、加仓或减仓）
+type childOrderFunc func(quantity float64) (*OrderResult, error)
+
+// executor 拆单执行器：按配置把大单拆成多笔子订单依次下单，汇总成交
+type executor struct {
+	trader  Trader
+	name    string
+	config  ExecutionConfig
+	sleep   func(time.Duration) // 子订单之间等待（测试中替换）
+	stopped func() bool         // 触发一键清仓后不再下剩余的子订单
+}
+
+// newExecutor 创建拆单执行器（补全默认配置）
+func newExecutor(t Trader, name string, config ExecutionConfig) *executor {
+	if config.Algo == "" {
+		config.Algo = ExecutionMarket
+	}
+	if config.Slices <= 0 {
+		config.Slices = 5
+	}
+	if config.Interval <= 0 {
+		config.Interval = 10 * time.Second
+		if config.Algo == ExecutionIceberg {
+			config.Interval = 2 * time.Second
+		}
+	}
+	return &executor{trader: t, name: name, config: config, sleep: time.Sleep}
+}
+
+// logConfig 启动时输出拆单配置，TWAP总时长超过扫描间隔时提醒（拆单期间决策周期会被推迟）
+func (e *executor) logConfig(scanInterval time.Duration) {
+	c := e.config
+	switch c.Algo {
+	case ExecutionTWAP:
+		log.Printf("🧩 [%s] 订单价值≥%.0f USDT时按TWAP拆单 (%d笔，间隔%v)", e.name, c.ThresholdUSD, c.Slices, c.Interval)
+		if duration := time.Duration(c.Slices-1) * c.Interval; duration >= scanInterval {
+			log.Printf("⚠️ [%s] TWAP拆单需要%v，超过扫描间隔%v，拆单期间的决策周期会被推迟", e.name, duration, scanInterval)
+		}
+	case ExecutionIceberg:
+		size := "盘口一档的数量"
+		if c.SliceUSD > 0 {
+			size = fmt.Sprintf("%.0f USDT", c.SliceUSD)
+		}
+		log.Printf("🧩 [%s] 订单价值≥%.0f USDT时按冰山单拆单 (每笔%s，间隔%v)", e.name, c.ThresholdUSD, size, c.Interval)
+	}
+}
+
+// plan 拆分后每笔子订单的数量（只有一笔时不拆单）
+// 每笔价值不低于交易所最小下单额，子订单数不超过maxChildOrders
+func (e *executor) plan(symbol string, buy bool, quantity, price float64) []float64 {
+	notional := quantity * price
+	if e.config.Algo == ExecutionMarket || quantity <= 0 || price <= 0 || notional < e.config.ThresholdUSD {
+		return []float64{quantity}
+	}
+
+	slices := e.config.Slices
+	if e.config.Algo == ExecutionIceberg {
+		if sliceQuantity := e.icebergSliceQuantity(symbol, buy, price); sliceQuantity > 0 {
+			slices = int(math.Ceil(quantity / sliceQuantity))
+		}
+	}
+	if slices > maxChildOrders {
+		slices = maxChildOrders
+	}
+	if minNotional := effectiveCapabilities(e.trader).MinNotional; minNotional > 0 {
+		if maxSlices := int(notional / minNotional); slices > maxSlices {
+			slices = maxSlices
+		}
+	}
+	if slices <= 1 {
+		return []float64{quantity}
+	}
+
+	quantities := make([]float64, slices)
+	for i := range quantities {
+		quantities[i] = quantity / float64(slices)
+	}
+	return quantities
+}
+
+// icebergSliceQuantity 冰山单每笔的数量：配置了每笔价值时按价值计算，否则取盘口一档的数量（无法获取时返回0）
+func (e *executor) icebergSliceQuantity(symbol string, buy bool, price float64) float64 {
+	if e.config.SliceUSD > 0 {
+		return e.config.SliceUSD / price
+	}
+	bookTrader, ok := e.trader.(OrderBookTrader)
+	if !ok {
+		return 0
+	}
+	book, err := bookTrader.GetOrderBook(symbol, 1)
+	if err != nil {
+		log.Printf("  ⚠ 获取 %s 订单簿失败，冰山单按%d笔拆分: %v", symbol, e.config.Slices, err)
+		return 0
+	}
+	if levels := book.levels(buy); len(levels) > 0 {
+		return levels[0].Quantity
+	}
+	return 0
+}
+
+// execute 下单quantity（price为当前价格，用于计算订单价值和缺少成交信息时的均价）
+// 需要拆单时依次下子订单并把进度和累计成交记录到actionRecord；返回汇总的成交结果，
+// 中途某笔失败时停止拆单，已有成交则返回部分成交的结果（状态为PARTIALLY_FILLED），否则返回错误
+func (e *executor) execute(symbol string, buy bool, quantity, price float64, place childOrderFunc, actionRecord *logger.DecisionAction) (*OrderResult, error) {
+	quantities := e.plan(symbol, buy, quantity, price)
+	if len(quantities) == 1 {
+		return place(quantity)
+	}
+
+	algo := e.config.Algo
+	actionRecord.ExecAlgo = algo
+	actionRecord.ExecSlices = len(quantities)
+	actionRecord.RequestedQuantity = quantity
+	log.Printf("  🧩 [%s] %s 拆单执行(%s): %.4f 拆成 %d 笔，间隔 %v", e.name, symbol, algo, quantity, len(quantities), e.config.Interval)
+
+	result := &OrderResult{Symbol: symbol, Status: OrderStatusFilled}
+	var notional float64
+	for i, sliceQuantity := range quantities {
+		remaining := quantity - result.ExecutedQty
+		if remaining < sliceQuantity*0.01 {
+			actionRecord.ExecSlices = i // 前面的子订单按精度取整后已成交全部数量，剩下的零头不再下单
+			break
+		}
+		if i == len(quantities)-1 || sliceQuantity > remaining {
+			sliceQuantity = remaining // 最后一笔下剩余的全部数量
+		}
+		if i > 0 {
+			e.sleep(e.config.Interval)
+			if e.stopped != nil && e.stopped() {
+				log.Printf("  🛑 [%s] %s 已触发一键清仓，停止拆单 (已成交 %.4f / %.4f)", e.name, symbol, result.ExecutedQty, quantity)
+				result.Status = OrderStatusPartiallyFilled
+				break
+			}
+		}
+
+		order, err := place(sliceQuantity)
+		if err != nil {
+			if result.ExecutedQty == 0 {
+				return nil, fmt.Errorf("拆单第1笔下单失败: %w", err)
+			}
+			log.Printf("  ⚠ [%s] %s 拆单第%d/%d笔下单失败，停止拆单 (已成交 %.4f / %.4f): %v",
+				e.name, symbol, i+1, len(quantities), result.ExecutedQty, quantity, err)
+			result.Status = OrderStatusPartiallyFilled
+			break
+		}
+
+		filled := filledQuantity(order, sliceQuantity)
+		notional += filled * fillPrice(order, price)
+		result.ExecutedQty += filled
+		result.addFee(order.Fee, order.FeeAsset)
+		for asset, fee := range order.OtherFees {
+			result.addFee(fee, asset)
+		}
+		result.OrderID = order.OrderID
+		if result.ClientOrderID == "" {
+			result.ClientOrderID = order.ClientOrderID
+		}
+		actionRecord.ExecFilledSlices++
+		actionRecord.ChildOrderIDs = append(actionRecord.ChildOrderIDs, order.OrderID)
+		log.Printf("  🧩 [%s] %s %d/%d: 成交 %.4f @ %.4f (累计 %.4f / %.4f)",
+			e.name, symbol, i+1, len(quantities), filled, fillPrice(order, price), result.ExecutedQty, quantity)
+	}
+
+	result.AvgPrice = notional / result.ExecutedQty
+	return result, nil
+}
@@ -0,0 +1,117 @@
+package trader
+
+import (
+	"errors"
+	"nofx/logger"
+	"nofx/trader/fakeexchange"
+	"testing"
+	"time"
+)
+
+func TestExecutorTWAPSplitsLargeOrders(t *testing.T) {
+	ledger, trader := newFakeBinance(t)
+	e := newExecutor(trader, "test", ExecutionConfig{Algo: ExecutionTWAP, ThresholdUSD: 10000, Slices: 4, Interval: 30 * time.Second})
+	var sleeps []time.Duration
+	e.sleep = func(d time.Duration) { sleeps = append(sleeps, d) }
+	openLong := func(q float64) (*OrderResult, error) { return trader.OpenLong("BTCUSDT", q, 10) }
+
+	// 0.4 BTC ≈ 24000 USDT，超过阈值，拆成4笔
+	var record logger.DecisionAction
+	order, err := e.execute("BTCUSDT", true, 0.4, 60000, openLong, &record)
+	if err != nil {
+		t.Fatalf("拆单执行失败: %v", err)
+	}
+	if !floatEq(order.ExecutedQty, 0.4) || !floatEq(order.AvgPrice, 60000) || order.Status != OrderStatusFilled {
+		t.Errorf("汇总成交错误: %+v", order)
+	}
+	if record.ExecAlgo != ExecutionTWAP || record.ExecSlices != 4 || record.ExecFilledSlices != 4 ||
+		len(record.ChildOrderIDs) != 4 || !floatEq(record.RequestedQuantity, 0.4) {
+		t.Errorf("拆单进度记录错误: %+v", record)
+	}
+	if record.ChildOrderIDs[3] != order.OrderID {
+		t.Errorf("OrderID应为最后一笔子订单: %d %v", order.OrderID, record.ChildOrderIDs)
+	}
+	if len(sleeps) != 3 || sleeps[0] != 30*time.Second {
+		t.Errorf("子订单之间应按间隔等待: %v", sleeps)
+	}
+	if pos, ok := ledger.Position("BTCUSDT", "LONG"); !ok || !floatEq(pos.Amount, 0.4) {
+		t.Errorf("持仓应为0.4: %+v", pos)
+	}
+
+	// 低于阈值时单笔下单
+	record = logger.DecisionAction{}
+	if _, err := e.execute("BTCUSDT", true, 0.1, 60000, openLong, &record); err != nil {
+		t.Fatalf("下单失败: %v", err)
+	}
+	if record.ExecAlgo != "" || record.ExecSlices != 0 || len(ledger.Fills("BTCUSDT")) != 5 {
+		t.Errorf("低于阈值时不应拆单: %+v", record)
+	}
+}
+
+func TestExecutorStopsOnChildFailure(t *testing.T) {
+	_, trader := newFakeBinance(t)
+	e := newExecutor(trader, "test", ExecutionConfig{Algo: ExecutionTWAP, Slices: 4})
+	e.sleep = func(time.Duration) {}
+
+	// 第3笔失败：返回前两笔的部分成交
+	calls := 0
+	failThird := func(q float64) (*OrderResult, error) {
+		calls++
+		if calls == 3 {
+			return nil, errors.New("rate limited")
+		}
+		return trader.OpenLong("BTCUSDT", q, 10)
+	}
+	var record logger.DecisionAction
+	order, err := e.execute("BTCUSDT", true, 0.4, 60000, failThird, &record)
+	if err != nil {
+		t.Fatalf("已有成交时不应返回错误: %v", err)
+	}
+	if order.Status != OrderStatusPartiallyFilled || !floatEq(order.ExecutedQty, 0.2) || calls != 3 {
+		t.Errorf("应停止拆单并返回部分成交: %+v (调用%d次)", order, calls)
+	}
+	if record.ExecSlices != 4 || record.ExecFilledSlices != 2 {
+		t.Errorf("拆单进度记录错误: %+v", record)
+	}
+
+	// 第1笔就失败时返回错误
+	failAll := func(float64) (*OrderResult, error) { return nil, errors.New("insufficient margin") }
+	if _, err := e.execute("BTCUSDT", true, 0.4, 60000, failAll, &logger.DecisionAction{}); err == nil {
+		t.Error("没有任何成交时应返回错误")
+	}
+}
+
+func TestExecutorIcebergUsesTopOfBook(t *testing.T) {
+	ledger, trader := newFakeBinance(t)
+	ledger.SetOrderBook("BTCUSDT", []fakeexchange.BookLevel{{Price: 59990, Quantity: 0.15}}, []fakeexchange.BookLevel{{Price: 60010, Quantity: 0.15}})
+	if _, err := trader.OpenLong("BTCUSDT", 0.5, 10); err != nil {
+		t.Fatalf("开多仓失败: %v", err)
+	}
+
+	e := newExecutor(trader, "test", ExecutionConfig{Algo: ExecutionIceberg})
+	if e.config.Interval != 2*time.Second {
+		t.Errorf("冰山单默认间隔应为2秒: %v", e.config.Interval)
+	}
+	e.sleep = func(time.Duration) {}
+
+	// 减仓0.4：买一只有0.15，拆成3笔
+	var record logger.DecisionAction
+	order, err := e.execute("BTCUSDT", false, 0.4, 60000, func(q float64) (*OrderResult, error) {
+		return trader.CloseLong("BTCUSDT", q)
+	}, &record)
+	if err != nil {
+		t.Fatalf("冰山单减仓失败: %v", err)
+	}
+	if record.ExecAlgo != ExecutionIceberg || record.ExecSlices != 3 || record.ExecFilledSlices != 3 || !floatEq(order.ExecutedQty, 0.4) {
+		t.Errorf("冰山单拆分错误: %+v %+v", order, record)
+	}
+	if pos, ok := ledger.Position("BTCUSDT", "LONG"); !ok || !floatEq(pos.Amount, 0.1) {
+		t.Errorf("减仓后持仓应为0.1: %+v", pos)
+	}
+
+	// 每笔价值不低于最小下单额（币安5 USDT）：12 USDT最多拆成2笔
+	e.config.SliceUSD = 1
+	if quantities := e.plan("BTCUSDT", true, 0.0002, 60000); len(quantities) != 2 {
+		t.Errorf("子订单数应受最小下单额限制: %v", quantities)
+	}
+}
@@ -0,0 +1,428 @@
+package fakeexchange
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// FuturesServer 币安U本位合约风格的REST服务（Binance的/fapi与Aster的/fapi/v3共用同一套接口格式）
+type FuturesServer struct {
+	*httptest.Server
+	Ledger *Ledger
+
+	// authenticate 校验签名请求，返回false时拒绝
+	authenticate func(r *http.Request, rawQuery, body string, params url.Values) bool
+
+	mu            sync.Mutex
+	requests      []string // 收到的请求（"METHOD /path"）
+	dropResponses int      // 之后几次下单处理后不返回响应（断开连接）
+}
+
+// NewBinance 启动模拟的币安合约服务（按apiKey/secretKey校验HMAC签名）
+func NewBinance(ledger *Ledger, apiKey, secretKey string) *FuturesServer {
+	s := &FuturesServer{Ledger: ledger}
+	s.authenticate = func(r *http.Request, rawQuery, body string, params url.Values) bool {
+		if r.Header.Get("X-MBX-APIKEY") != apiKey || params.Get("timestamp") == "" {
+			return false
+		}
+		i := strings.LastIndex(rawQuery, "signature=")
+		if i < 0 {
+			return false
+		}
+		signed := strings.TrimSuffix(rawQuery[:i], "&")
+		mac := hmac.New(sha256.New, []byte(secretKey))
+		mac.Write([]byte(signed + body))
+		return hmac.Equal([]byte(rawQuery[i+len("signature="):]), []byte(hex.EncodeToString(mac.Sum(nil))))
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// NewAster 启动模拟的Aster合约服务（只校验签名参数齐全，不验证以太坊签名）
+func NewAster(ledger *Ledger, user, signer string) *FuturesServer {
+	s := &FuturesServer{Ledger: ledger}
+	s.authenticate = func(r *http.Request, rawQuery, body string, params url.Values) bool {
+		return params.Get("user") == user && params.Get("signer") == signer &&
+			params.Get("nonce") != "" && strings.HasPrefix(params.Get("signature"), "0x")
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// DropOrderResponses 之后的n次下单照常处理，但断开连接不返回响应（模拟下单超时）
+func (s *FuturesServer) DropOrderResponses(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dropResponses = n
+}
+
+// Requests 收到的请求列表
+func (s *FuturesServer) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+var fapiPath = regexp.MustCompile(`^/fapi/v\d+/`)
+
+// publicEndpoints 无需签名的接口
+var publicEndpoints = map[string]bool{"exchangeInfo": true, "ticker/price": true, "depth": true}
+
+func (s *FuturesServer) handle(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+	s.mu.Unlock()
+
+	// 签名参数可能在querystring或表单body中（DELETE也可能带body）
+	data, _ := io.ReadAll(r.Body)
+	body := string(data)
+	params, _ := url.ParseQuery(r.URL.RawQuery)
+	if form, err := url.ParseQuery(body); err == nil {
+		for k, v := range form {
+			params[k] = v
+		}
+	}
+
+	if !fapiPath.MatchString(r.URL.Path) {
+		writeFuturesError(w, http.StatusNotFound, &Error{Code: -5000, Msg: "Path not found"})
+		return
+	}
+	endpoint := fapiPath.ReplaceAllString(r.URL.Path, "")
+	if !publicEndpoints[endpoint] && !s.authenticate(r, r.URL.RawQuery, body, params) {
+		writeFuturesError(w, http.StatusUnauthorized, &Error{Code: -1022, Msg: "Signature for this request is not valid."})
+		return
+	}
+
+	result, err := s.route(r.Method, endpoint, params)
+	if r.Method == http.MethodPost && endpoint == "order" && s.dropResponse() {
+		if conn, _, hijackErr := w.(http.Hijacker).Hijack(); hijackErr == nil {
+			conn.Close()
+		}
+		return
+	}
+	if err != nil {
+		var apiErr *Error
+		if !errors.As(err, &apiErr) {
+			apiErr = &Error{Code: -1000, Msg: err.Error()}
+		}
+		writeFuturesError(w, http.StatusBadRequest, apiErr)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// dropResponse 本次下单是否不返回响应
+func (s *FuturesServer) dropResponse() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.dropResponses <= 0 {
+		return false
+	}
+	s.dropResponses--
+	return true
+}
+
+func (s *FuturesServer) route(method, endpoint string, params url.Values) (interface{}, error) {
+	l := s.Ledger
+	symbol := params.Get("symbol")
+
+	switch method + " " + endpoint {
+	case "GET exchangeInfo":
+		var symbols []map[string]interface{}
+		for _, spec := range l.Symbols() {
+			symbols = append(symbols, map[string]interface{}{
+				"symbol":            spec.Symbol,
+				"status":            "TRADING",
+				"pricePrecision":    spec.PricePrecision(),
+				"quantityPrecision": spec.QuantityPrecision(),
+				"filters": []map[string]interface{}{
+					{"filterType": "PRICE_FILTER", "tickSize": formatFloat(spec.TickSize)},
+					{"filterType": "LOT_SIZE", "stepSize": formatFloat(spec.StepSize)},
+				},
+			})
+		}
+		return map[string]interface{}{"timezone": "UTC", "symbols": symbols}, nil
+
+	case "GET ticker/price":
+		if symbol == "" {
+			var prices []map[string]interface{}
+			for _, spec := range l.Symbols() {
+				price, _ := l.Price(spec.Symbol)
+				prices = append(prices, map[string]interface{}{"symbol": spec.Symbol, "price": formatFloat(price)})
+			}
+			return prices, nil
+		}
+		price, ok := l.Price(symbol)
+		if !ok {
+			return nil, errInvalidSymbol
+		}
+		return map[string]interface{}{"symbol": symbol, "price": formatFloat(price)}, nil
+
+	case "GET depth":
+		bids, asks, ok := l.OrderBook(symbol)
+		if !ok {
+			return nil, errInvalidSymbol
+		}
+		limit, _ := strconv.Atoi(params.Get("limit"))
+		return map[string]interface{}{
+			"lastUpdateId": 1,
+			"E":            l.now().UnixMilli(),
+			"T":            l.now().UnixMilli(),
+			"bids":         bookLevels(bids, limit),
+			"asks":         bookLevels(asks, limit),
+		}, nil
+
+	case "GET account":
+		wallet, available, unrealized, _ := l.Account()
+		return map[string]interface{}{
+			"totalWalletBalance":    formatFloat(wallet),
+			"availableBalance":      formatFloat(available),
+			"totalUnrealizedProfit": formatFloat(unrealized),
+			"totalMarginBalance":    formatFloat(wallet + unrealized),
+			"assets":                []interface{}{},
+			"positions":             []interface{}{},
+		}, nil
+
+	case "GET balance":
+		wallet, available, unrealized, _ := l.Account()
+		return []map[string]interface{}{{
+			"asset":            "USDT",
+			"balance":          formatFloat(wallet),
+			"availableBalance": formatFloat(available),
+			"crossUnPnl":       formatFloat(unrealized),
+		}}, nil
+
+	case "GET positionRisk":
+		var result []map[string]interface{}
+		for _, p := range l.Positions() {
+			if symbol != "" && p.Symbol != symbol {
+				continue
+			}
+			result = append(result, map[string]interface{}{
+				"symbol":           p.Symbol,
+				"positionSide":     p.PositionSide,
+				"positionAmt":      formatFloat(p.Amount),
+				"entryPrice":       formatFloat(p.EntryPrice),
+				"markPrice":        formatFloat(p.MarkPrice),
+				"unRealizedProfit": formatFloat(p.UnrealizedPnl()),
+				"leverage":         strconv.Itoa(p.Leverage),
+				"marginType":       strings.ToLower(p.MarginType),
+				"isolatedMargin":   formatFloat(p.IsolatedMargin),
+				"liquidationPrice": "0",
+			})
+		}
+		if result == nil {
+			result = []map[string]interface{}{}
+		}
+		return result, nil
+
+	case "POST leverage":
+		leverage, _ := strconv.Atoi(params.Get("leverage"))
+		if err := l.SetLeverage(symbol, leverage); err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"symbol": symbol, "leverage": leverage, "maxNotionalValue": "1000000"}, nil
+
+	case "POST marginType":
+		marginType := strings.ToUpper(params.Get("marginType"))
+		if marginType == "CROSS" {
+			marginType = MarginTypeCrossed
+		}
+		if err := l.ChangeMarginType(symbol, marginType); err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"code": 200, "msg": "success"}, nil
+
+	case "GET positionSide/dual":
+		return map[string]interface{}{"dualSidePosition": l.DualSide()}, nil
+
+	case "POST positionSide/dual":
+		if err := l.ChangeDualSide(params.Get("dualSidePosition") == "true"); err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"code": 200, "msg": "success"}, nil
+
+	case "POST positionMargin":
+		amount, _ := strconv.ParseFloat(params.Get("amount"), 64)
+		if params.Get("type") == "2" {
+			amount = -amount
+		}
+		if err := l.AdjustMargin(symbol, params.Get("positionSide"), amount); err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"amount": params.Get("amount"), "code": 200, "msg": "Successfully modify position margin.", "type": params.Get("type")}, nil
+
+	case "POST order":
+		req, err := s.orderRequest(params)
+		if err != nil {
+			return nil, err
+		}
+		order, err := l.PlaceOrder(req)
+		if err != nil {
+			return nil, err
+		}
+		return futuresOrder(order), nil
+
+	case "GET order":
+		orderID, _ := strconv.ParseInt(params.Get("orderId"), 10, 64)
+		order, ok := l.Order(orderID)
+		if clientOrderID := params.Get("origClientOrderId"); clientOrderID != "" {
+			order, ok = l.OrderByClientID(clientOrderID)
+		}
+		if !ok || order.Symbol != symbol {
+			return nil, &Error{Code: -2013, Msg: "Order does not exist."}
+		}
+		return futuresOrder(order), nil
+
+	case "DELETE order":
+		orderID, _ := strconv.ParseInt(params.Get("orderId"), 10, 64)
+		order, err := l.CancelOrder(symbol, orderID)
+		if err != nil {
+			return nil, err
+		}
+		return futuresOrder(order), nil
+
+	case "DELETE allOpenOrders":
+		l.CancelAll(symbol)
+		return map[string]interface{}{"code": 200, "msg": "The operation of cancel all open order is done."}, nil
+
+	case "GET openOrders":
+		result := []map[string]interface{}{}
+		for _, o := range l.OpenOrders(symbol) {
+			o := o
+			result = append(result, futuresOrder(&o))
+		}
+		return result, nil
+
+	case "GET userTrades":
+		orderID, _ := strconv.ParseInt(params.Get("orderId"), 10, 64)
+		result := []map[string]interface{}{}
+		for _, f := range l.Fills(symbol) {
+			if orderID != 0 && f.OrderID != orderID {
+				continue
+			}
+			result = append(result, map[string]interface{}{
+				"id":              f.TradeID,
+				"orderId":         f.OrderID,
+				"symbol":          f.Symbol,
+				"side":            f.Side,
+				"positionSide":    f.PositionSide,
+				"buyer":           f.Side == SideBuy,
+				"maker":           false,
+				"price":           formatFloat(f.Price),
+				"qty":             formatFloat(f.Quantity),
+				"quoteQty":        formatFloat(f.Price * f.Quantity),
+				"realizedPnl":     formatFloat(f.RealizedPnl),
+				"commission":      formatFloat(f.Fee),
+				"commissionAsset": "USDT",
+				"time":            f.Time,
+			})
+		}
+		return result, nil
+
+	case "GET income":
+		result := []map[string]interface{}{}
+		for _, f := range l.Fills(symbol) {
+			if f.RealizedPnl != 0 {
+				result = append(result, map[string]interface{}{"symbol": f.Symbol, "incomeType": "REALIZED_PNL",
+					"income": formatFloat(f.RealizedPnl), "asset": "USDT", "time": f.Time, "tranId": f.TradeID})
+			}
+			result = append(result, map[string]interface{}{"symbol": f.Symbol, "incomeType": "COMMISSION",
+				"income": formatFloat(-f.Fee), "asset": "USDT", "time": f.Time, "tranId": f.TradeID})
+		}
+		return result, nil
+	}
+
+	return nil, &Error{Code: -5000, Msg: "Path not found"}
+}
+
+// orderRequest 解析下单参数，价格和触发价必须是tickSize的整数倍
+func (s *FuturesServer) orderRequest(params url.Values) (OrderRequest, error) {
+	req := OrderRequest{
+		Symbol:        params.Get("symbol"),
+		Side:          params.Get("side"),
+		PositionSide:  params.Get("positionSide"),
+		Type:          params.Get("type"),
+		TimeInForce:   params.Get("timeInForce"),
+		ReduceOnly:    params.Get("reduceOnly") == "true",
+		ClosePosition: params.Get("closePosition") == "true",
+		ClientOrderID: params.Get("newClientOrderId"),
+	}
+	req.Quantity, _ = strconv.ParseFloat(params.Get("quantity"), 64)
+	req.Price, _ = strconv.ParseFloat(params.Get("price"), 64)
+	req.StopPrice, _ = strconv.ParseFloat(params.Get("stopPrice"), 64)
+	req.ActivationPrice, _ = strconv.ParseFloat(params.Get("activationPrice"), 64)
+	req.CallbackRate, _ = strconv.ParseFloat(params.Get("callbackRate"), 64)
+
+	spec, ok := s.Ledger.Spec(req.Symbol)
+	if !ok {
+		return req, errInvalidSymbol
+	}
+	if !onStep(req.Price, spec.TickSize) || !onStep(req.StopPrice, spec.TickSize) || !onStep(req.ActivationPrice, spec.TickSize) {
+		return req, &Error{Code: -4014, Msg: "Price not increased by tick size."}
+	}
+	return req, nil
+}
+
+// futuresOrder 订单的接口格式（未指定客户端订单ID时与交易所一样自动生成）
+func futuresOrder(o *Order) map[string]interface{} {
+	clientOrderID := o.ClientOrderID
+	if clientOrderID == "" {
+		clientOrderID = "fake-" + strconv.FormatInt(o.OrderID, 10)
+	}
+	return map[string]interface{}{
+		"orderId":       o.OrderID,
+		"symbol":        o.Symbol,
+		"status":        o.Status,
+		"clientOrderId": clientOrderID,
+		"price":         formatFloat(o.Price),
+		"avgPrice":      formatFloat(o.AvgPrice),
+		"origQty":       formatFloat(o.Quantity),
+		"executedQty":   formatFloat(o.ExecutedQty),
+		"cumQty":        formatFloat(o.ExecutedQty),
+		"cumQuote":      formatFloat(o.ExecutedQty * o.AvgPrice),
+		"timeInForce":   o.TimeInForce,
+		"type":          o.Type,
+		"origType":      o.Type,
+		"side":          o.Side,
+		"positionSide":  o.PositionSide,
+		"stopPrice":     formatFloat(o.StopPrice),
+		"activatePrice": formatFloat(o.ActivationPrice),
+		"priceRate":     formatFloat(o.CallbackRate),
+		"reduceOnly":    o.ReduceOnly,
+		"closePosition": o.ClosePosition,
+		"workingType":   "CONTRACT_PRICE",
+		"time":          o.Time,
+		"updateTime":    o.UpdateTime,
+	}
+}
+
+func writeFuturesError(w http.ResponseWriter, status int, err *Error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{"code": err.Code, "msg": err.Msg})
+}
+
+// bookLevels 订单簿档位的接口格式 [["价格", "数量"], ...]（limit大于0时最多返回limit档）
+func bookLevels(levels []BookLevel, limit int) [][]string {
+	if limit > 0 && len(levels) > limit {
+		levels = levels[:limit]
+	}
+	result := make([][]string, 0, len(levels))
+	for _, level := range levels {
+		result = append(result, []string{formatFloat(level.Price), formatFloat(level.Quantity)})
+	}
+	return result
+}
@@ -0,0 +1,563 @@
+package fakeexchange
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// HyperliquidServer Hyperliquid风格的/info和/exchange服务
+// 币种为交易对去掉USDT后缀（BTCUSDT -> BTC），资产编号为交易对的添加顺序；只支持单向持仓
+type HyperliquidServer struct {
+	*httptest.Server
+	Ledger *Ledger
+
+	mu        sync.Mutex
+	actions   []string        // 收到的/exchange操作类型
+	groupings []string        // 收到的order操作的分组方式
+	crossMode map[string]bool // 币种 -> 是否全仓
+	tpsl      map[int64]bool  // positionTpsl分组的订单ID（持仓平掉后自动撤销）
+}
+
+// NewHyperliquid 启动模拟的Hyperliquid服务（不验证签名）
+func NewHyperliquid(ledger *Ledger) *HyperliquidServer {
+	ledger.SetDualSide(false)
+	s := &HyperliquidServer{Ledger: ledger, crossMode: make(map[string]bool), tpsl: make(map[int64]bool)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/info", s.handleInfo)
+	mux.HandleFunc("/exchange", s.handleExchange)
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// Actions 收到的/exchange操作类型
+func (s *HyperliquidServer) Actions() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.actions...)
+}
+
+// Groupings 收到的order操作的分组方式（na/normalTpsl/positionTpsl）
+func (s *HyperliquidServer) Groupings() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.groupings...)
+}
+
+// IsCross 最近一次updateLeverage设置的是否为全仓
+func (s *HyperliquidServer) IsCross(coin string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.crossMode[coin]
+}
+
+// szDecimals 币种的数量精度
+func szDecimals(spec SymbolSpec) int {
+	return spec.QuantityPrecision()
+}
+
+func hyperliquidCoin(symbol string) string {
+	return strings.TrimSuffix(symbol, "USDT")
+}
+
+func (s *HyperliquidServer) handleInfo(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Type      string          `json:"type"`
+		User      string          `json:"user"`
+		Coin      string          `json:"coin"`
+		Oid       json.RawMessage `json:"oid"` // 订单ID或cloid字符串
+		StartTime int64           `json:"startTime"`
+		EndTime   *int64          `json:"endTime"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Failed to deserialize the JSON body", http.StatusUnprocessableEntity)
+		return
+	}
+
+	s.expirePositionTpsl()
+
+	l := s.Ledger
+	var result interface{}
+	switch req.Type {
+	case "meta":
+		universe := []map[string]interface{}{}
+		for _, spec := range l.Symbols() {
+			universe = append(universe, map[string]interface{}{
+				"name": hyperliquidCoin(spec.Symbol), "szDecimals": szDecimals(spec), "maxLeverage": 50,
+			})
+		}
+		result = map[string]interface{}{"universe": universe, "marginTables": []interface{}{}}
+
+	case "spotMeta":
+		result = map[string]interface{}{"universe": []interface{}{}, "tokens": []interface{}{}}
+
+	case "allMids":
+		mids := map[string]string{}
+		for _, spec := range l.Symbols() {
+			price, _ := l.Price(spec.Symbol)
+			mids[hyperliquidCoin(spec.Symbol)] = formatFloat(price)
+		}
+		result = mids
+
+	case "clearinghouseState":
+		result = s.clearinghouseState()
+
+	case "openOrders", "frontendOpenOrders":
+		orders := []map[string]interface{}{}
+		for _, o := range l.OpenOrders("") {
+			o := o
+			orders = append(orders, s.wireOrder(&o))
+		}
+		result = orders
+
+	case "orderStatus":
+		var order *Order
+		var ok bool
+		var cloid string
+		if json.Unmarshal(req.Oid, &cloid) == nil {
+			order, ok = l.OrderByClientID(cloid)
+		} else {
+			oid, _ := strconv.ParseInt(string(req.Oid), 10, 64)
+			order, ok = l.Order(oid)
+		}
+		if !ok {
+			result = map[string]interface{}{"status": "unknownOid"}
+			break
+		}
+		result = map[string]interface{}{
+			"status": "order",
+			"order": map[string]interface{}{
+				"order":           s.wireOrder(order),
+				"status":          hyperliquidStatus(order.Status),
+				"statusTimestamp": order.UpdateTime,
+			},
+		}
+
+	case "userFills", "userFillsByTime":
+		fills := []map[string]interface{}{}
+		for _, f := range l.Fills("") {
+			if f.Time < req.StartTime || (req.EndTime != nil && f.Time > *req.EndTime) {
+				continue
+			}
+			side := "B"
+			if f.Side == SideSell {
+				side = "A"
+			}
+			fills = append(fills, map[string]interface{}{
+				"coin":          hyperliquidCoin(f.Symbol),
+				"px":            formatFloat(f.Price),
+				"sz":            formatFloat(f.Quantity),
+				"side":          side,
+				"time":          f.Time,
+				"startPosition": formatFloat(f.StartPosition),
+				"dir":           fillDirection(f),
+				"closedPnl":     formatFloat(f.RealizedPnl),
+				"hash":          fmt.Sprintf("0x%064x", f.TradeID),
+				"oid":           f.OrderID,
+				"crossed":       true,
+				"fee":           formatFloat(f.Fee),
+				"tid":           f.TradeID,
+				"feeToken":      "USDC",
+			})
+		}
+		result = fills
+
+	case "userFunding":
+		result = []interface{}{}
+
+	case "l2Book":
+		bids, asks, ok := l.OrderBook(req.Coin + "USDT")
+		if !ok {
+			result = nil
+			break
+		}
+		result = map[string]interface{}{
+			"coin":   req.Coin,
+			"time":   l.now().UnixMilli(),
+			"levels": [][]map[string]interface{}{hyperliquidLevels(bids), hyperliquidLevels(asks)},
+		}
+
+	default:
+		http.Error(w, "Failed to deserialize the JSON body", http.StatusUnprocessableEntity)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// clearinghouseState 账户状态（accountValue包含未实现盈亏）
+func (s *HyperliquidServer) clearinghouseState() map[string]interface{} {
+	wallet, available, unrealized, marginUsed := s.Ledger.Account()
+	positions := []map[string]interface{}{}
+	totalNtl := 0.0
+	for _, p := range s.Ledger.Positions() {
+		marginType := "isolated"
+		if s.IsCross(hyperliquidCoin(p.Symbol)) {
+			marginType = "cross"
+		}
+		value := math.Abs(p.Amount) * p.MarkPrice
+		totalNtl += value
+		entry := formatFloat(p.EntryPrice)
+		positions = append(positions, map[string]interface{}{
+			"type": "oneWay",
+			"position": map[string]interface{}{
+				"coin":           hyperliquidCoin(p.Symbol),
+				"szi":            formatFloat(p.Amount),
+				"entryPx":        entry,
+				"leverage":       map[string]interface{}{"type": marginType, "value": p.Leverage},
+				"liquidationPx":  nil,
+				"marginUsed":     formatFloat(p.InitialMargin()),
+				"positionValue":  formatFloat(value),
+				"returnOnEquity": "0",
+				"unrealizedPnl":  formatFloat(p.UnrealizedPnl()),
+			},
+		})
+	}
+	summary := map[string]interface{}{
+		"accountValue":    formatFloat(wallet + unrealized),
+		"totalMarginUsed": formatFloat(marginUsed),
+		"totalNtlPos":     formatFloat(totalNtl),
+		"totalRawUsd":     formatFloat(wallet),
+	}
+	return map[string]interface{}{
+		"assetPositions":     positions,
+		"marginSummary":      summary,
+		"crossMarginSummary": summary,
+		"withdrawable":       formatFloat(math.Max(available, 0)),
+	}
+}
+
+// expirePositionTpsl 撤销持仓已平的positionTpsl订单（交易所在持仓归零时自动撤销）
+func (s *HyperliquidServer) expirePositionTpsl() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for oid := range s.tpsl {
+		o, ok := s.Ledger.Order(oid)
+		if !ok || o.Status != StatusNew {
+			delete(s.tpsl, oid)
+			continue
+		}
+		if _, open := s.Ledger.Position(o.Symbol, "BOTH"); !open {
+			s.Ledger.CancelOrder(o.Symbol, oid)
+			delete(s.tpsl, oid)
+		}
+	}
+}
+
+// wireOrder 订单的接口格式（openOrders/frontendOpenOrders/orderStatus共用）
+func (s *HyperliquidServer) wireOrder(o *Order) map[string]interface{} {
+	side := "B"
+	if o.Side == SideSell {
+		side = "A"
+	}
+	remaining := o.Quantity - o.ExecutedQty
+	order := map[string]interface{}{
+		"coin":             hyperliquidCoin(o.Symbol),
+		"side":             side,
+		"limitPx":          formatFloat(o.Price),
+		"sz":               formatFloat(remaining),
+		"origSz":           formatFloat(o.Quantity),
+		"oid":              o.OrderID,
+		"timestamp":        o.Time,
+		"reduceOnly":       o.ReduceOnly,
+		"isTrigger":        false,
+		"triggerPx":        "0.0",
+		"triggerCondition": "N/A",
+		"isPositionTpsl":   s.isPositionTpsl(o.OrderID),
+		"orderType":        "Limit",
+		"tif":              o.TimeInForce,
+		"children":         []interface{}{},
+		"cloid":            nil,
+	}
+	if o.ClientOrderID != "" {
+		order["cloid"] = o.ClientOrderID
+	}
+	if o.Type == OrderTypeStopMarket || o.Type == OrderTypeTakeProfit {
+		order["isTrigger"] = true
+		order["triggerPx"] = formatFloat(o.StopPrice)
+		order["orderType"] = "Stop Market"
+		if o.Type == OrderTypeTakeProfit {
+			order["orderType"] = "Take Profit Market"
+		}
+	}
+	return order
+}
+
+func (s *HyperliquidServer) isPositionTpsl(oid int64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tpsl[oid]
+}
+
+func hyperliquidStatus(status string) string {
+	switch status {
+	case StatusNew:
+		return "open"
+	case StatusFilled:
+		return "filled"
+	default:
+		return "canceled"
+	}
+}
+
+// fillDirection 成交方向描述（Open Long / Close Short / Long > Short 等）
+func fillDirection(f Fill) string {
+	after := f.StartPosition + f.Quantity
+	if f.Side == SideSell {
+		after = f.StartPosition - f.Quantity
+	}
+	switch {
+	case f.StartPosition > 0 && after < 0:
+		return "Long > Short"
+	case f.StartPosition < 0 && after > 0:
+		return "Short > Long"
+	case f.StartPosition > 0 || (f.StartPosition == 0 && f.Side == SideBuy):
+		if f.Side == SideBuy {
+			return "Open Long"
+		}
+		return "Close Long"
+	default:
+		if f.Side == SideSell {
+			return "Open Short"
+		}
+		return "Close Short"
+	}
+}
+
+// hyperliquidAction /exchange请求中的操作
+type hyperliquidAction struct {
+	Type   string `json:"type"`
+	Orders []struct {
+		Asset      int    `json:"a"`
+		IsBuy      bool   `json:"b"`
+		LimitPx    string `json:"p"`
+		Size       string `json:"s"`
+		ReduceOnly bool   `json:"r"`
+		Cloid      string `json:"c"`
+		OrderType  struct {
+			Limit *struct {
+				Tif string `json:"tif"`
+			} `json:"limit"`
+			Trigger *struct {
+				IsMarket  bool   `json:"isMarket"`
+				TriggerPx string `json:"triggerPx"`
+				Tpsl      string `json:"tpsl"`
+			} `json:"trigger"`
+		} `json:"t"`
+	} `json:"orders"`
+	Grouping string `json:"grouping"`
+	Cancels  []struct {
+		Asset   int   `json:"a"`
+		OrderID int64 `json:"o"`
+	} `json:"cancels"`
+	Asset    int  `json:"asset"`
+	IsCross  bool `json:"isCross"`
+	Leverage int  `json:"leverage"`
+}
+
+func (s *HyperliquidServer) handleExchange(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Action    hyperliquidAction `json:"action"`
+		Nonce     int64             `json:"nonce"`
+		Signature json.RawMessage   `json:"signature"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Nonce == 0 || len(req.Signature) == 0 {
+		http.Error(w, "Failed to deserialize the JSON body", http.StatusUnprocessableEntity)
+		return
+	}
+
+	s.mu.Lock()
+	s.actions = append(s.actions, req.Action.Type)
+	s.mu.Unlock()
+
+	var resp interface{}
+	switch req.Action.Type {
+	case "order":
+		s.mu.Lock()
+		s.groupings = append(s.groupings, req.Action.Grouping)
+		s.mu.Unlock()
+		statuses := make([]interface{}, 0, len(req.Action.Orders))
+		for i := range req.Action.Orders {
+			status := s.placeOrder(&req.Action, i)
+			if req.Action.Grouping == "positionTpsl" {
+				if m, ok := status.(map[string]interface{}); ok && m["resting"] != nil {
+					s.mu.Lock()
+					s.tpsl[m["resting"].(map[string]interface{})["oid"].(int64)] = true
+					s.mu.Unlock()
+				}
+			}
+			statuses = append(statuses, status)
+		}
+		resp = okResponse("order", map[string]interface{}{"statuses": statuses})
+
+	case "cancel":
+		statuses := make([]interface{}, 0, len(req.Action.Cancels))
+		for _, c := range req.Action.Cancels {
+			symbol, ok := s.assetSymbol(c.Asset)
+			if _, err := s.Ledger.CancelOrder(symbol, c.OrderID); !ok || err != nil {
+				statuses = append(statuses, map[string]string{"error": fmt.Sprintf("Order was never placed, already canceled, or filled. asset=%d", c.Asset)})
+				continue
+			}
+			statuses = append(statuses, "success")
+		}
+		resp = okResponse("cancel", map[string]interface{}{"statuses": statuses})
+
+	case "updateLeverage":
+		symbol, ok := s.assetSymbol(req.Action.Asset)
+		if !ok {
+			resp = map[string]interface{}{"status": "err", "response": "Invalid asset"}
+			break
+		}
+		if err := s.Ledger.SetLeverage(symbol, req.Action.Leverage); err != nil {
+			resp = map[string]interface{}{"status": "err", "response": err.Error()}
+			break
+		}
+		s.mu.Lock()
+		s.crossMode[hyperliquidCoin(symbol)] = req.Action.IsCross
+		s.mu.Unlock()
+		resp = map[string]interface{}{"status": "ok", "response": map[string]interface{}{"type": "default"}}
+
+	default:
+		resp = map[string]interface{}{"status": "err", "response": "Unknown action type: " + req.Action.Type}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// placeOrder 下单并返回该订单的状态（resting/filled/error）
+func (s *HyperliquidServer) placeOrder(action *hyperliquidAction, i int) interface{} {
+	wire := action.Orders[i]
+	symbol, ok := s.assetSymbol(wire.Asset)
+	if !ok {
+		return map[string]string{"error": "Invalid asset."}
+	}
+	spec, _ := s.Ledger.Spec(symbol)
+
+	size, _ := strconv.ParseFloat(wire.Size, 64)
+	price, _ := strconv.ParseFloat(wire.LimitPx, 64)
+	if !validHyperliquidSize(wire.Size, szDecimals(spec)) || size <= 0 {
+		return map[string]string{"error": "Order has invalid size."}
+	}
+	if !validHyperliquidPrice(wire.LimitPx, szDecimals(spec)) || price <= 0 {
+		return map[string]string{"error": "Order has invalid price."}
+	}
+
+	req := OrderRequest{Symbol: symbol, Side: SideSell, Quantity: size, Price: price, ReduceOnly: wire.ReduceOnly, ClientOrderID: wire.Cloid}
+	if wire.IsBuy {
+		req.Side = SideBuy
+	}
+	switch {
+	case wire.OrderType.Trigger != nil:
+		trigger := wire.OrderType.Trigger
+		if !validHyperliquidPrice(trigger.TriggerPx, szDecimals(spec)) {
+			return map[string]string{"error": "Order has invalid price."}
+		}
+		req.StopPrice, _ = strconv.ParseFloat(trigger.TriggerPx, 64)
+		req.Type = OrderTypeStopMarket
+		if trigger.Tpsl == "tp" {
+			req.Type = OrderTypeTakeProfit
+		}
+	case wire.OrderType.Limit != nil:
+		req.Type = OrderTypeLimit
+		// SDK把tif当作JSON字符串再编码了一次（"\"Ioc\""）
+		switch strings.Trim(wire.OrderType.Limit.Tif, `"`) {
+		case "Ioc":
+			req.TimeInForce = TimeInForceIOC
+		case "Alo":
+			req.TimeInForce = TimeInForceGTX
+		default:
+			req.TimeInForce = TimeInForceGTC
+		}
+	default:
+		return map[string]string{"error": "Invalid order type."}
+	}
+
+	order, err := s.Ledger.PlaceOrder(req)
+	if err != nil {
+		return map[string]string{"error": hyperliquidError(err)}
+	}
+	switch order.Status {
+	case StatusFilled:
+		return map[string]interface{}{"filled": map[string]interface{}{
+			"totalSz": formatFloat(order.ExecutedQty), "avgPx": formatFloat(order.AvgPrice), "oid": order.OrderID,
+		}}
+	case StatusExpired:
+		return map[string]string{"error": "Order could not immediately match against any resting orders. asset=" + strconv.Itoa(wire.Asset)}
+	default:
+		return map[string]interface{}{"resting": map[string]interface{}{"oid": order.OrderID}}
+	}
+}
+
+// hyperliquidError 将账本的拒绝原因转换为Hyperliquid的错误信息
+func hyperliquidError(err error) string {
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "ReduceOnly"):
+		return "Reduce only order would increase position."
+	case strings.Contains(msg, "Margin is insufficient"):
+		return "Insufficient margin to place order."
+	case strings.Contains(msg, "Post Only"):
+		return "Post only order would have immediately matched, bbo was 0@0."
+	case strings.Contains(msg, "immediately trigger"):
+		return "Trigger order would immediately trigger."
+	}
+	return msg
+}
+
+func (s *HyperliquidServer) assetSymbol(asset int) (string, bool) {
+	specs := s.Ledger.Symbols()
+	if asset < 0 || asset >= len(specs) {
+		return "", false
+	}
+	return specs[asset].Symbol, true
+}
+
+// validHyperliquidSize 数量小数位不超过szDecimals
+func validHyperliquidSize(wire string, szDecimals int) bool {
+	return wireDecimals(wire) <= szDecimals
+}
+
+// validHyperliquidPrice 价格最多5位有效数字（整数价格不限），小数位不超过6-szDecimals
+func validHyperliquidPrice(wire string, szDecimals int) bool {
+	if wireDecimals(wire) > 6-szDecimals {
+		return false
+	}
+	if !strings.Contains(wire, ".") {
+		return true
+	}
+	trimmed := strings.TrimRight(strings.TrimRight(wire, "0"), ".")
+	digits := strings.TrimLeft(strings.Replace(trimmed, ".", "", 1), "0")
+	return len(digits) <= 5
+}
+
+// wireDecimals 数值字符串的小数位数（忽略末尾的0）
+func wireDecimals(wire string) int {
+	i := strings.IndexByte(wire, '.')
+	if i < 0 {
+		return 0
+	}
+	return len(strings.TrimRight(wire[i+1:], "0"))
+}
+
+func okResponse(responseType string, data interface{}) map[string]interface{} {
+	return map[string]interface{}{"status": "ok", "response": map[string]interface{}{"type": responseType, "data": data}}
+}
+
+// hyperliquidLevels 订单簿档位的接口格式（Hyperliquid每侧最多20档）
+func hyperliquidLevels(levels []BookLevel) []map[string]interface{} {
+	if len(levels) > 20 {
+		levels = levels[:20]
+	}
+	result := make([]map[string]interface{}, 0, len(levels))
+	for _, level := range levels {
+		result = append(result, map[string]interface{}{"px": formatFloat(level.Price), "sz": formatFloat(level.Quantity), "n": 1})
+	}
+	return result
+}
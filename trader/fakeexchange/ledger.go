@@ -0,0 +1,831 @@
+// Package fakeexchange 本地模拟的交易所（httptest服务），用于离线测试交易器实现
+// Ledger保存余额、持仓、挂单和成交，Binance/Aster/Hyperliquid服务把各自的接口格式映射到同一账本上
+package fakeexchange
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 订单方向、类型和状态（与币安一致）
+const (
+	SideBuy  = "BUY"
+	SideSell = "SELL"
+
+	PositionSideBoth  = "BOTH"
+	PositionSideLong  = "LONG"
+	PositionSideShort = "SHORT"
+
+	OrderTypeMarket     = "MARKET"
+	OrderTypeLimit      = "LIMIT"
+	OrderTypeStopMarket = "STOP_MARKET"
+	OrderTypeTakeProfit = "TAKE_PROFIT_MARKET"
+	OrderTypeTrailing   = "TRAILING_STOP_MARKET"
+
+	TimeInForceGTC = "GTC"
+	TimeInForceIOC = "IOC"
+	TimeInForceGTX = "GTX" // 只做Maker
+
+	StatusNew      = "NEW"
+	StatusFilled   = "FILLED"
+	StatusCanceled = "CANCELED"
+	StatusExpired  = "EXPIRED"
+
+	MarginTypeIsolated = "ISOLATED"
+	MarginTypeCrossed  = "CROSSED"
+)
+
+// Error 交易所拒绝请求（Code为币安错误码，各服务按自己的格式返回）
+type Error struct {
+	Code int
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("code=%d, msg=%s", e.Code, e.Msg)
+}
+
+// SymbolSpec 交易对规则
+type SymbolSpec struct {
+	Symbol   string
+	StepSize float64 // 数量步进
+	TickSize float64 // 价格步进（0表示不校验，如Hyperliquid按有效数字校验）
+}
+
+// QuantityPrecision 数量小数位数
+func (s SymbolSpec) QuantityPrecision() int {
+	return decimals(s.StepSize)
+}
+
+// PricePrecision 价格小数位数
+func (s SymbolSpec) PricePrecision() int {
+	return decimals(s.TickSize)
+}
+
+// OrderRequest 下单请求
+type OrderRequest struct {
+	Symbol        string
+	Side          string // BUY/SELL
+	PositionSide  string // LONG/SHORT/BOTH，为空时按BOTH
+	Type          string
+	TimeInForce   string
+	Quantity      float64
+	Price         float64
+	StopPrice     float64
+	ReduceOnly    bool
+	ClosePosition bool // 条件单触发时平掉整个仓位
+
+	ActivationPrice float64 // 追踪止损激活价（0表示立即激活）
+	CallbackRate    float64 // 追踪止损回调比例（%）
+
+	ClientOrderID string // 客户端订单ID（可选，同一ID只能下单一次）
+}
+
+// Order 订单
+type Order struct {
+	OrderRequest
+	OrderID     int64
+	Status      string
+	ExecutedQty float64
+	AvgPrice    float64
+	Time        int64
+	UpdateTime  int64
+
+	activated bool    // 追踪止损是否已激活
+	extreme   float64 // 追踪止损激活后的最高价（卖出）或最低价（买入）
+}
+
+// Fill 成交
+type Fill struct {
+	TradeID       int64
+	OrderID       int64
+	Symbol        string
+	Side          string
+	PositionSide  string
+	Price         float64
+	Quantity      float64
+	RealizedPnl   float64
+	Fee           float64
+	StartPosition float64 // 成交前的持仓数量（带方向）
+	Time          int64
+}
+
+// Position 持仓（Amount带方向：多仓为正，空仓为负）
+type Position struct {
+	Symbol         string
+	PositionSide   string
+	Amount         float64
+	EntryPrice     float64
+	MarkPrice      float64
+	Leverage       int
+	MarginType     string
+	IsolatedMargin float64 // 手动调整的逐仓保证金
+}
+
+// UnrealizedPnl 未实现盈亏
+func (p Position) UnrealizedPnl() float64 {
+	return p.Amount * (p.MarkPrice - p.EntryPrice)
+}
+
+// InitialMargin 占用的保证金
+func (p Position) InitialMargin() float64 {
+	return math.Abs(p.Amount)*p.EntryPrice/float64(p.Leverage) + p.IsolatedMargin
+}
+
+// Ledger 模拟交易所账本（并发安全）
+// 市价单按当前标记价格成交；可成交的限价单立即成交，否则挂单；
+// 止损/止盈条件单和挂单中的限价单在SetPrice时检查触发
+type Ledger struct {
+	mu sync.Mutex
+
+	balance    float64 // 钱包余额（已实现盈亏和手续费计入）
+	feeRate    float64
+	dualSide   bool
+	symbols    map[string]SymbolSpec
+	symbolList []string // 添加顺序（Hyperliquid的资产编号）
+	prices     map[string]float64
+	leverage   map[string]int
+	marginType map[string]string
+	positions  map[string]*Position // symbol|positionSide -> 持仓
+	orders     map[int64]*Order
+	clientIDs  map[string]int64 // 客户端订单ID -> 订单ID
+	fills      []Fill
+	books      map[string]orderBook // 手动设置的订单簿
+	nextID     int64
+	now        func() time.Time
+}
+
+// BookLevel 订单簿的一档
+type BookLevel struct {
+	Price    float64
+	Quantity float64
+}
+
+// orderBook 订单簿（买盘价格从高到低，卖盘价格从低到高）
+type orderBook struct {
+	bids, asks []BookLevel
+}
+
+// NewLedger 创建账本（初始余额USDT，手续费率如0.0004）
+func NewLedger(balance, feeRate float64) *Ledger {
+	return &Ledger{
+		balance:    balance,
+		feeRate:    feeRate,
+		symbols:    make(map[string]SymbolSpec),
+		prices:     make(map[string]float64),
+		leverage:   make(map[string]int),
+		marginType: make(map[string]string),
+		positions:  make(map[string]*Position),
+		orders:     make(map[int64]*Order),
+		clientIDs:  make(map[string]int64),
+		books:      make(map[string]orderBook),
+		nextID:     1000,
+		now:        time.Now,
+	}
+}
+
+// SetOrderBook 设置币种的订单簿（只用于订单簿查询，不影响成交价格）
+func (l *Ledger) SetOrderBook(symbol string, bids, asks []BookLevel) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.books[symbol] = orderBook{bids: bids, asks: asks}
+}
+
+// OrderBook 币种的订单簿，未设置时为当前价格上下各一个最小价格单位、深度很大的一档
+func (l *Ledger) OrderBook(symbol string) (bids, asks []BookLevel, ok bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if book, exists := l.books[symbol]; exists {
+		return book.bids, book.asks, true
+	}
+	spec, exists := l.symbols[symbol]
+	if !exists {
+		return nil, nil, false
+	}
+	price := l.prices[symbol]
+	return []BookLevel{{Price: price - spec.TickSize, Quantity: 1e6}}, []BookLevel{{Price: price + spec.TickSize, Quantity: 1e6}}, true
+}
+
+// AddSymbol 添加交易对及其初始价格
+func (l *Ledger) AddSymbol(spec SymbolSpec, price float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, ok := l.symbols[spec.Symbol]; !ok {
+		l.symbolList = append(l.symbolList, spec.Symbol)
+	}
+	l.symbols[spec.Symbol] = spec
+	l.prices[spec.Symbol] = price
+}
+
+// Symbols 所有交易对规则（按添加顺序）
+func (l *Ledger) Symbols() []SymbolSpec {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	specs := make([]SymbolSpec, 0, len(l.symbolList))
+	for _, s := range l.symbolList {
+		specs = append(specs, l.symbols[s])
+	}
+	return specs
+}
+
+// Spec 交易对规则
+func (l *Ledger) Spec(symbol string) (SymbolSpec, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	spec, ok := l.symbols[symbol]
+	return spec, ok
+}
+
+// Price 当前标记价格
+func (l *Ledger) Price(symbol string) (float64, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	price, ok := l.prices[symbol]
+	return price, ok
+}
+
+// SetPrice 更新标记价格，并触发满足条件的条件单和限价挂单
+func (l *Ledger) SetPrice(symbol string, price float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.prices[symbol] = price
+	for _, p := range l.positions {
+		if p.Symbol == symbol {
+			p.MarkPrice = price
+		}
+	}
+
+	for _, o := range l.sortedOrders(symbol) {
+		if o.Status != StatusNew {
+			continue
+		}
+		if o.Type == OrderTypeTrailing {
+			o.trail(price)
+		}
+		if !l.triggered(o, price) {
+			continue
+		}
+		req := o.OrderRequest
+		if o.Type != OrderTypeMarket && o.Type != OrderTypeLimit {
+			req.ReduceOnly = true
+			if o.ClosePosition {
+				req.Quantity = math.Abs(l.positionAmount(symbol, l.positionSide(req)))
+			}
+		}
+		if req.Quantity <= 0 {
+			o.Status = StatusExpired
+			continue
+		}
+		if err := l.execute(o, req, price); err != nil {
+			o.Status = StatusExpired
+		}
+	}
+}
+
+// SetDualSide 直接设置持仓模式（true为双向持仓）
+func (l *Ledger) SetDualSide(dualSide bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.dualSide = dualSide
+}
+
+// DualSide 当前是否双向持仓
+func (l *Ledger) DualSide() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.dualSide
+}
+
+// ChangeDualSide 切换持仓模式（有持仓或挂单时拒绝）
+func (l *Ledger) ChangeDualSide(dualSide bool) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.dualSide == dualSide {
+		return &Error{Code: -4059, Msg: "No need to change position side."}
+	}
+	if len(l.positions) > 0 || len(l.openOrders("")) > 0 {
+		return &Error{Code: -4068, Msg: "Position side cannot be changed if there exists position."}
+	}
+	l.dualSide = dualSide
+	return nil
+}
+
+// Leverage 币种杠杆（默认20倍）
+func (l *Ledger) Leverage(symbol string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.leverageFor(symbol)
+}
+
+// SetLeverage 设置币种杠杆
+func (l *Ledger) SetLeverage(symbol string, leverage int) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, ok := l.symbols[symbol]; !ok {
+		return errInvalidSymbol
+	}
+	if leverage < 1 || leverage > 125 {
+		return &Error{Code: -4028, Msg: "Leverage is not valid"}
+	}
+	l.leverage[symbol] = leverage
+	for _, p := range l.positions {
+		if p.Symbol == symbol {
+			p.Leverage = leverage
+		}
+	}
+	return nil
+}
+
+// MarginType 币种保证金模式（默认全仓）
+func (l *Ledger) MarginType(symbol string) string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.marginTypeFor(symbol)
+}
+
+// ChangeMarginType 切换币种保证金模式
+func (l *Ledger) ChangeMarginType(symbol, marginType string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, ok := l.symbols[symbol]; !ok {
+		return errInvalidSymbol
+	}
+	if l.marginTypeFor(symbol) == marginType {
+		return &Error{Code: -4046, Msg: "No need to change margin type."}
+	}
+	for _, p := range l.positions {
+		if p.Symbol == symbol {
+			return &Error{Code: -4048, Msg: "Margin type cannot be changed if there exists position."}
+		}
+	}
+	l.marginType[symbol] = marginType
+	return nil
+}
+
+// AdjustMargin 调整逐仓保证金（amount>0追加，<0减少）
+func (l *Ledger) AdjustMargin(symbol, positionSide string, amount float64) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.marginTypeFor(symbol) != MarginTypeIsolated {
+		return &Error{Code: -4047, Msg: "Margin type cannot be changed if there exists open orders."}
+	}
+	p, ok := l.positions[positionKey(symbol, l.normalizeSide(positionSide))]
+	if !ok {
+		return &Error{Code: -2022, Msg: "Position does not exist."}
+	}
+	if p.IsolatedMargin+amount < 0 {
+		return &Error{Code: -4051, Msg: "Isolated balance insufficient."}
+	}
+	p.IsolatedMargin += amount
+	return nil
+}
+
+// PlaceOrder 下单
+func (l *Ledger) PlaceOrder(req OrderRequest) (*Order, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	spec, ok := l.symbols[req.Symbol]
+	if !ok {
+		return nil, errInvalidSymbol
+	}
+	if req.Side != SideBuy && req.Side != SideSell {
+		return nil, &Error{Code: -1117, Msg: "Invalid side."}
+	}
+	if req.PositionSide == "" {
+		req.PositionSide = PositionSideBoth
+	}
+	if l.dualSide == (req.PositionSide == PositionSideBoth) {
+		return nil, &Error{Code: -4061, Msg: "Order's position side does not match user's setting."}
+	}
+	if _, ok := l.clientIDs[req.ClientOrderID]; ok && req.ClientOrderID != "" {
+		return nil, &Error{Code: -4116, Msg: "ClientOrderId is duplicated."}
+	}
+	if l.dualSide && req.ReduceOnly {
+		return nil, &Error{Code: -1106, Msg: "Parameter 'reduceonly' sent when not required."}
+	}
+	if !req.ClosePosition || req.Quantity > 0 {
+		if req.Quantity <= 0 {
+			return nil, &Error{Code: -4003, Msg: "Quantity less than or equal to zero."}
+		}
+		if !onStep(req.Quantity, spec.StepSize) {
+			return nil, &Error{Code: -1111, Msg: "Precision is over the maximum defined for this asset."}
+		}
+	}
+
+	now := l.now().UnixMilli()
+	l.nextID++
+	order := &Order{OrderRequest: req, OrderID: l.nextID, Status: StatusNew, Time: now, UpdateTime: now}
+	price := l.prices[req.Symbol]
+
+	switch req.Type {
+	case OrderTypeMarket:
+		if err := l.execute(order, req, price); err != nil {
+			return nil, err
+		}
+
+	case OrderTypeLimit:
+		if req.Price <= 0 {
+			return nil, &Error{Code: -4014, Msg: "Price not increased by tick size."}
+		}
+		if l.triggered(order, price) {
+			if req.TimeInForce == TimeInForceGTX {
+				return nil, &Error{Code: -5022, Msg: "Due to the order could not be executed as maker, the Post Only order will be rejected."}
+			}
+			if err := l.execute(order, req, price); err != nil {
+				return nil, err
+			}
+		} else if req.TimeInForce == TimeInForceIOC {
+			order.Status = StatusExpired
+		} else if err := l.checkReduce(req); err != nil {
+			return nil, err
+		}
+
+	case OrderTypeStopMarket, OrderTypeTakeProfit:
+		if req.StopPrice <= 0 {
+			return nil, &Error{Code: -1102, Msg: "Mandatory parameter 'stopprice' was not sent, was empty/null, or malformed."}
+		}
+		if l.triggered(order, price) {
+			return nil, &Error{Code: -2021, Msg: "Order would immediately trigger."}
+		}
+
+	case OrderTypeTrailing:
+		if req.CallbackRate < 0.1 || req.CallbackRate > 10 {
+			return nil, &Error{Code: -2007, Msg: "Invalid callBackRate."}
+		}
+		// 卖出的激活价必须高于当前价，买入的必须低于当前价
+		buy := req.Side == SideBuy
+		if req.ActivationPrice > 0 && ((buy && req.ActivationPrice >= price) || (!buy && req.ActivationPrice <= price)) {
+			return nil, &Error{Code: -2021, Msg: "Order would immediately trigger."}
+		}
+		order.trail(price)
+
+	default:
+		return nil, &Error{Code: -1116, Msg: "Invalid orderType."}
+	}
+
+	l.orders[order.OrderID] = order
+	if req.ClientOrderID != "" {
+		l.clientIDs[req.ClientOrderID] = order.OrderID
+	}
+	snapshot := *order
+	return &snapshot, nil
+}
+
+// CancelOrder 撤销挂单
+func (l *Ledger) CancelOrder(symbol string, orderID int64) (*Order, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	o, ok := l.orders[orderID]
+	if !ok || (symbol != "" && o.Symbol != symbol) || o.Status != StatusNew {
+		return nil, &Error{Code: -2011, Msg: "Unknown order sent."}
+	}
+	o.Status = StatusCanceled
+	o.UpdateTime = l.now().UnixMilli()
+	snapshot := *o
+	return &snapshot, nil
+}
+
+// CancelAll 撤销币种的全部挂单（symbol为空时撤销所有币种）
+func (l *Ledger) CancelAll(symbol string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	orders := l.openOrders(symbol)
+	for _, o := range orders {
+		o.Status = StatusCanceled
+		o.UpdateTime = l.now().UnixMilli()
+	}
+	return len(orders)
+}
+
+// Order 查询订单
+func (l *Ledger) Order(orderID int64) (*Order, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	o, ok := l.orders[orderID]
+	if !ok {
+		return nil, false
+	}
+	snapshot := *o
+	return &snapshot, true
+}
+
+// OrderByClientID 按客户端订单ID查询订单
+func (l *Ledger) OrderByClientID(clientOrderID string) (*Order, bool) {
+	l.mu.Lock()
+	id, ok := l.clientIDs[clientOrderID]
+	l.mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+	return l.Order(id)
+}
+
+// OpenOrders 未完成订单（symbol为空时返回所有币种，按下单顺序）
+func (l *Ledger) OpenOrders(symbol string) []Order {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var result []Order
+	for _, o := range l.openOrders(symbol) {
+		result = append(result, *o)
+	}
+	return result
+}
+
+// Positions 当前持仓（按币种、方向排序）
+func (l *Ledger) Positions() []Position {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	result := make([]Position, 0, len(l.positions))
+	for _, p := range l.positions {
+		result = append(result, *p)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Symbol != result[j].Symbol {
+			return result[i].Symbol < result[j].Symbol
+		}
+		return result[i].PositionSide < result[j].PositionSide
+	})
+	return result
+}
+
+// Position 查询持仓（positionSide为LONG/SHORT/BOTH）
+func (l *Ledger) Position(symbol, positionSide string) (Position, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	p, ok := l.positions[positionKey(symbol, positionSide)]
+	if !ok {
+		return Position{}, false
+	}
+	return *p, true
+}
+
+// Fills 成交记录（symbol为空时返回所有币种）
+func (l *Ledger) Fills(symbol string) []Fill {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var result []Fill
+	for _, f := range l.fills {
+		if symbol == "" || f.Symbol == symbol {
+			result = append(result, f)
+		}
+	}
+	return result
+}
+
+// Account 账户汇总：钱包余额、可用余额、未实现盈亏、占用保证金
+func (l *Ledger) Account() (wallet, available, unrealized, marginUsed float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.account()
+}
+
+func (l *Ledger) account() (wallet, available, unrealized, marginUsed float64) {
+	for _, p := range l.positions {
+		unrealized += p.UnrealizedPnl()
+		marginUsed += p.InitialMargin()
+	}
+	return l.balance, l.balance + unrealized - marginUsed, unrealized, marginUsed
+}
+
+// execute 按价格成交订单（已持有锁）
+func (l *Ledger) execute(order *Order, req OrderRequest, price float64) error {
+	if err := l.checkReduce(req); err != nil {
+		return err
+	}
+
+	side := l.positionSide(req)
+	key := positionKey(req.Symbol, side)
+	p, ok := l.positions[key]
+	if !ok {
+		p = &Position{Symbol: req.Symbol, PositionSide: side, Leverage: l.leverageFor(req.Symbol), MarginType: l.marginTypeFor(req.Symbol)}
+	}
+
+	delta := req.Quantity
+	if req.Side == SideSell {
+		delta = -delta
+	}
+	start := p.Amount
+
+	// 开仓/加仓部分需要足够的可用保证金
+	opening := math.Abs(start+delta) - math.Abs(start)
+	if opening > 1e-12 {
+		_, available, _, _ := l.account()
+		if opening*price/float64(p.Leverage) > available {
+			return &Error{Code: -2019, Msg: "Margin is insufficient."}
+		}
+	}
+
+	realized := 0.0
+	if start != 0 && (start > 0) != (delta > 0) {
+		closing := math.Min(math.Abs(delta), math.Abs(start))
+		realized = closing * (price - p.EntryPrice)
+		if start < 0 {
+			realized = -realized
+		}
+		p.Amount = start + delta
+		if math.Abs(delta) > math.Abs(start) {
+			p.EntryPrice = price // 反向开仓
+			p.IsolatedMargin = 0
+		}
+	} else {
+		p.EntryPrice = (math.Abs(start)*p.EntryPrice + math.Abs(delta)*price) / math.Abs(start+delta)
+		p.Amount = start + delta
+	}
+	p.MarkPrice = price
+	if math.Abs(p.Amount) < 1e-12 {
+		delete(l.positions, key)
+	} else {
+		l.positions[key] = p
+	}
+
+	fee := req.Quantity * price * l.feeRate
+	l.balance += realized - fee
+
+	now := l.now().UnixMilli()
+	l.nextID++
+	l.fills = append(l.fills, Fill{
+		TradeID:       l.nextID,
+		OrderID:       order.OrderID,
+		Symbol:        req.Symbol,
+		Side:          req.Side,
+		PositionSide:  req.PositionSide,
+		Price:         price,
+		Quantity:      req.Quantity,
+		RealizedPnl:   realized,
+		Fee:           fee,
+		StartPosition: start,
+		Time:          now,
+	})
+
+	order.Status = StatusFilled
+	order.ExecutedQty = req.Quantity
+	order.AvgPrice = price
+	order.UpdateTime = now
+	return nil
+}
+
+// checkReduce 只减仓订单不能增加持仓，双向持仓的平仓单不能超过持仓
+func (l *Ledger) checkReduce(req OrderRequest) error {
+	side := l.positionSide(req)
+	amount := l.positionAmount(req.Symbol, side)
+	closing := (side == PositionSideLong && req.Side == SideSell) ||
+		(side == PositionSideShort && req.Side == SideBuy) ||
+		(side == PositionSideBoth && ((amount > 0 && req.Side == SideSell) || (amount < 0 && req.Side == SideBuy)))
+
+	if (req.ReduceOnly || side != PositionSideBoth) && closing && req.Quantity > math.Abs(amount)+1e-12 {
+		return &Error{Code: -2022, Msg: "ReduceOnly Order is rejected."}
+	}
+	if req.ReduceOnly && !closing {
+		return &Error{Code: -2022, Msg: "ReduceOnly Order is rejected."}
+	}
+	return nil
+}
+
+// triggered 限价单是否可成交 / 条件单是否触发
+func (l *Ledger) triggered(o *Order, price float64) bool {
+	buy := o.Side == SideBuy
+	switch o.Type {
+	case OrderTypeLimit:
+		return (buy && o.Price >= price) || (!buy && o.Price <= price)
+	case OrderTypeStopMarket:
+		return (buy && price >= o.StopPrice) || (!buy && price <= o.StopPrice)
+	case OrderTypeTakeProfit:
+		return (buy && price <= o.StopPrice) || (!buy && price >= o.StopPrice)
+	case OrderTypeTrailing:
+		return o.activated && ((buy && price >= o.StopPrice) || (!buy && price <= o.StopPrice))
+	}
+	return false
+}
+
+// trail 按最新价格更新追踪止损：到达激活价后记录最有利价格，触发价为其回调CallbackRate%
+func (o *Order) trail(price float64) {
+	buy := o.Side == SideBuy
+	if !o.activated {
+		if o.ActivationPrice > 0 && ((buy && price > o.ActivationPrice) || (!buy && price < o.ActivationPrice)) {
+			return
+		}
+		o.activated = true
+		o.extreme = price
+	}
+	if buy {
+		o.extreme = math.Min(o.extreme, price)
+		o.StopPrice = o.extreme * (1 + o.CallbackRate/100)
+	} else {
+		o.extreme = math.Max(o.extreme, price)
+		o.StopPrice = o.extreme * (1 - o.CallbackRate/100)
+	}
+}
+
+// positionSide 订单对应的持仓方向（单向持仓为BOTH）
+func (l *Ledger) positionSide(req OrderRequest) string {
+	if !l.dualSide {
+		return PositionSideBoth
+	}
+	return req.PositionSide
+}
+
+// normalizeSide 按持仓模式转换查询用的方向
+func (l *Ledger) normalizeSide(positionSide string) string {
+	if !l.dualSide {
+		return PositionSideBoth
+	}
+	return strings.ToUpper(positionSide)
+}
+
+func (l *Ledger) positionAmount(symbol, positionSide string) float64 {
+	if p, ok := l.positions[positionKey(symbol, positionSide)]; ok {
+		return p.Amount
+	}
+	return 0
+}
+
+func (l *Ledger) leverageFor(symbol string) int {
+	if lev, ok := l.leverage[symbol]; ok {
+		return lev
+	}
+	return 20
+}
+
+func (l *Ledger) marginTypeFor(symbol string) string {
+	if mt, ok := l.marginType[symbol]; ok {
+		return mt
+	}
+	return MarginTypeCrossed
+}
+
+// openOrders 未完成订单（已持有锁）
+func (l *Ledger) openOrders(symbol string) []*Order {
+	var result []*Order
+	for _, o := range l.sortedOrders(symbol) {
+		if o.Status == StatusNew {
+			result = append(result, o)
+		}
+	}
+	return result
+}
+
+// sortedOrders 按下单顺序排列的订单
+func (l *Ledger) sortedOrders(symbol string) []*Order {
+	var result []*Order
+	for _, o := range l.orders {
+		if symbol == "" || o.Symbol == symbol {
+			result = append(result, o)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].OrderID < result[j].OrderID })
+	return result
+}
+
+var errInvalidSymbol = &Error{Code: -1121, Msg: "Invalid symbol."}
+
+func positionKey(symbol, positionSide string) string {
+	return symbol + "|" + positionSide
+}
+
+// onStep 数值是否为步进的整数倍
+func onStep(value, step float64) bool {
+	if step <= 0 {
+		return true
+	}
+	n := value / step
+	return math.Abs(n-math.Round(n)) < 1e-6
+}
+
+// decimals 步进值的小数位数（如0.001 -> 3）
+func decimals(step float64) int {
+	if step <= 0 {
+		return 0
+	}
+	s := strconv.FormatFloat(step, 'f', -1, 64)
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		return len(s) - i - 1
+	}
+	return 0
+}
+
+// formatFloat 接口返回的数值字符串
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
@@ -0,0 +1,180 @@
+package trader
+
+import (
+	"log"
+	"nofx/market"
+	"sync"
+	"time"
+)
+
+const (
+	// 行情源（Hyperliquid）的资金费率是每小时费率，估算时按整点结算
+	fundingEstimateInterval = time.Hour
+	// 资金费结算后交易所流水入账需要一点时间，结算后等待这么久再同步
+	fundingSyncDelay = 2 * time.Minute
+)
+
+// fundingTracker 按持仓（symbol_side）累计实际支付/收到的资金费
+// 优先使用交易所资金流水；流水获取失败，或同一币种多空同时持仓无法区分时，
+// 按 资金费率 × 名义价值 在每个结算时刻估算
+type fundingTracker struct {
+	mu        sync.Mutex
+	positions map[string]*positionFunding
+	syncedAt  time.Time // 最近一次同步交易所流水的时间
+
+	income      func(symbol string, start, end time.Time) ([]IncomeRecord, error)
+	fundingRate func(symbol string) (float64, error)
+	now         func() time.Time
+}
+
+// positionFunding 单个持仓的资金费
+type positionFunding struct {
+	openTime  time.Time
+	amount    float64   // 累计资金费（正数为收到，负数为支付）
+	estimated bool      // 是否为估算值
+	settledAt time.Time // 估算已计入的最近一个结算时刻
+}
+
+// newFundingTracker 创建资金费跟踪器
+func newFundingTracker(t Trader) *fundingTracker {
+	return &fundingTracker{
+		positions:   make(map[string]*positionFunding),
+		income:      t.GetIncomeHistory,
+		fundingRate: market.GetFundingRate,
+		now:         time.Now,
+	}
+}
+
+// update 用当前持仓刷新资金费，返回 symbol_side -> 累计资金费
+// openTimes为持仓首次出现时间（毫秒），只统计此后的资金费
+func (f *fundingTracker) update(positions []Position, openTimes map[string]int64) map[string]float64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := f.now()
+	current := make(map[string]bool)
+	needSync := false
+	for _, pos := range positions {
+		key := pos.Key()
+		current[key] = true
+		if _, ok := f.positions[key]; ok {
+			continue
+		}
+		openTime := now
+		if ms, ok := openTimes[key]; ok && ms > 0 {
+			openTime = time.UnixMilli(ms)
+		}
+		f.positions[key] = &positionFunding{openTime: openTime, settledAt: openTime}
+		needSync = true
+	}
+	for key := range f.positions {
+		if !current[key] {
+			delete(f.positions, key)
+		}
+	}
+	if len(f.positions) == 0 {
+		return map[string]float64{}
+	}
+
+	// 每个结算时刻之后同步一次交易所流水
+	if settled := now.Add(-fundingSyncDelay).Truncate(fundingEstimateInterval); f.syncedAt.Before(settled) {
+		needSync = true
+	}
+	if needSync {
+		f.syncLocked(positions, now)
+	}
+	f.estimateLocked(positions, now)
+
+	result := make(map[string]float64, len(f.positions))
+	for key, pf := range f.positions {
+		result[key] = pf.amount
+	}
+	return result
+}
+
+// syncLocked 从交易所资金流水汇总各持仓的资金费（调用方需持有锁）
+func (f *fundingTracker) syncLocked(positions []Position, now time.Time) {
+	earliest := now
+	sides := make(map[string]int) // symbol -> 持仓方向数
+	for _, pos := range positions {
+		sides[pos.Symbol]++
+		if pf := f.positions[pos.Key()]; pf.openTime.Before(earliest) {
+			earliest = pf.openTime
+		}
+	}
+
+	// 失败时也记录同步时间，避免每个周期重复请求
+	f.syncedAt = now
+	records, err := f.income("", earliest, now)
+	if err != nil {
+		log.Printf("⚠️ 获取资金费流水失败，按资金费率估算: %v", err)
+		for _, pf := range f.positions {
+			pf.estimated = true
+		}
+		return
+	}
+
+	for _, pos := range positions {
+		pf := f.positions[pos.Key()]
+		if sides[pos.Symbol] > 1 {
+			// 资金流水不区分多空，双向持仓时只能估算
+			pf.estimated = true
+			continue
+		}
+		pf.amount = 0
+		for _, r := range records {
+			if r.Type == IncomeFunding && r.Symbol == pos.Symbol && !r.Time.Before(pf.openTime) {
+				pf.amount += r.Amount
+			}
+		}
+		pf.estimated = false
+		pf.settledAt = now.Truncate(fundingEstimateInterval)
+	}
+}
+
+// estimateLocked 为估算中的持仓累加已过结算时刻的资金费（调用方需持有锁）
+// 多头在费率为正时支付，空头收取
+func (f *fundingTracker) estimateLocked(positions []Position, now time.Time) {
+	rates := make(map[string]float64)
+	for _, pos := range positions {
+		pf := f.positions[pos.Key()]
+		if !pf.estimated {
+			continue
+		}
+		last := now.Truncate(fundingEstimateInterval)
+		periods := int(last.Sub(pf.settledAt.Truncate(fundingEstimateInterval)) / fundingEstimateInterval)
+		if periods <= 0 {
+			continue
+		}
+
+		rate, ok := rates[pos.Symbol]
+		if !ok {
+			var err error
+			if rate, err = f.fundingRate(pos.Symbol); err != nil {
+				log.Printf("⚠️ 获取%s资金费率失败，暂不估算资金费: %v", pos.Symbol, err)
+				continue
+			}
+			rates[pos.Symbol] = rate
+		}
+
+		payment := pos.PositionAmt * pos.MarkPrice * rate * float64(periods)
+		if pos.Side == "long" {
+			payment = -payment
+		}
+		pf.amount += payment
+		pf.settledAt = last
+	}
+}
+
+// get 最近一次刷新时持仓的累计资金费（不触发交易所请求）
+func (f *fundingTracker) get(key string) float64 {
+	if f == nil {
+		return 0
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if pf, ok := f.positions[key]; ok {
+		return pf.amount
+	}
+	return 0
+}
@@ -0,0 +1,107 @@
+package trader
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestFundingTrackerUsesExchangeIncome(t *testing.T) {
+	now := time.Date(2024, 1, 2, 9, 5, 0, 0, time.UTC)
+	openTime := now.Add(-10 * time.Hour)
+	incomeCalls := 0
+	tracker := &fundingTracker{
+		positions: make(map[string]*positionFunding),
+		income: func(symbol string, start, end time.Time) ([]IncomeRecord, error) {
+			incomeCalls++
+			if !start.Equal(openTime) {
+				t.Errorf("应从开仓时间查询流水: %v", start)
+			}
+			return []IncomeRecord{
+				{Symbol: "BTCUSDT", Type: IncomeFunding, Amount: -1.5, Time: openTime.Add(-time.Hour)}, // 开仓前的资金费不计入
+				{Symbol: "BTCUSDT", Type: IncomeFunding, Amount: -2, Time: openTime.Add(time.Hour)},
+				{Symbol: "BTCUSDT", Type: IncomeCommission, Amount: -0.5, Time: openTime.Add(time.Hour)},
+				{Symbol: "BTCUSDT", Type: IncomeFunding, Amount: 0.5, Time: openTime.Add(9 * time.Hour)},
+				{Symbol: "ETHUSDT", Type: IncomeFunding, Amount: 3, Time: openTime.Add(9 * time.Hour)},
+			}, nil
+		},
+		fundingRate: func(symbol string) (float64, error) {
+			t.Errorf("有交易所流水时不应估算")
+			return 0, nil
+		},
+		now: func() time.Time { return now },
+	}
+	positions := []Position{{Symbol: "BTCUSDT", Side: "long", PositionAmt: 1, MarkPrice: 60000}}
+	openTimes := map[string]int64{"BTCUSDT_long": openTime.UnixMilli()}
+
+	fundings := tracker.update(positions, openTimes)
+	if !floatEq(fundings["BTCUSDT_long"], -1.5) {
+		t.Errorf("资金费应为-1.5，实际 %v", fundings)
+	}
+
+	// 同一结算周期内不重复请求
+	now = now.Add(30 * time.Minute)
+	tracker.update(positions, openTimes)
+	if incomeCalls != 1 {
+		t.Errorf("同一结算周期内应只同步一次，实际 %d", incomeCalls)
+	}
+	// 过了下一个结算时刻后重新同步
+	now = now.Add(time.Hour)
+	tracker.update(positions, openTimes)
+	if incomeCalls != 2 {
+		t.Errorf("新的结算时刻后应重新同步，实际 %d", incomeCalls)
+	}
+	if got := tracker.get("BTCUSDT_long"); !floatEq(got, -1.5) {
+		t.Errorf("get应返回最近一次结果: %v", got)
+	}
+
+	// 平仓后清理
+	tracker.update(nil, nil)
+	if got := tracker.get("BTCUSDT_long"); got != 0 {
+		t.Errorf("平仓后应清理资金费: %v", got)
+	}
+}
+
+func TestFundingTrackerEstimatesWhenIncomeUnavailable(t *testing.T) {
+	now := time.Date(2024, 1, 2, 9, 30, 0, 0, time.UTC)
+	tracker := &fundingTracker{
+		positions: make(map[string]*positionFunding),
+		income: func(symbol string, start, end time.Time) ([]IncomeRecord, error) {
+			// 双向持仓时流水不区分多空
+			return []IncomeRecord{{Symbol: "ETHUSDT", Type: IncomeFunding, Amount: 99, Time: start}}, nil
+		},
+		fundingRate: func(symbol string) (float64, error) { return 0.0001, nil },
+		now:         func() time.Time { return now },
+	}
+	positions := []Position{
+		{Symbol: "ETHUSDT", Side: "long", PositionAmt: 2, MarkPrice: 3000},
+		{Symbol: "ETHUSDT", Side: "short", PositionAmt: 1, MarkPrice: 3000},
+	}
+	openTimes := map[string]int64{
+		"ETHUSDT_long":  now.UnixMilli(),
+		"ETHUSDT_short": now.UnixMilli(),
+	}
+
+	fundings := tracker.update(positions, openTimes)
+	if fundings["ETHUSDT_long"] != 0 || fundings["ETHUSDT_short"] != 0 {
+		t.Fatalf("开仓后尚未经过结算时刻: %v", fundings)
+	}
+
+	// 经过3个整点结算：多头支付 2×3000×0.0001×3，空头收取 1×3000×0.0001×3
+	now = now.Add(3 * time.Hour)
+	fundings = tracker.update(positions, openTimes)
+	if !floatEq(fundings["ETHUSDT_long"], -1.8) || !floatEq(fundings["ETHUSDT_short"], 0.9) {
+		t.Errorf("估算资金费错误: %v", fundings)
+	}
+
+	// 流水获取失败时继续估算
+	tracker.income = func(symbol string, start, end time.Time) ([]IncomeRecord, error) {
+		return nil, errors.New("unavailable")
+	}
+	positions = positions[:1]
+	now = now.Add(time.Hour)
+	fundings = tracker.update(positions, openTimes)
+	if !floatEq(fundings["ETHUSDT_long"], -2.4) {
+		t.Errorf("流水不可用时应继续估算: %v", fundings)
+	}
+}
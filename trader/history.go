@@ -0,0 +1,99 @@
+package trader
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// TradeHistory 交易所返回的成交与资金流水（绩效统计以此为准，而不是根据决策日志推算）
+type TradeHistory struct {
+	Start       time.Time      `json:"start"`
+	End         time.Time      `json:"end"`
+	Trades      []TradeFill    `json:"trades"`
+	Income      []IncomeRecord `json:"income"`
+	RealizedPnL float64        `json:"realized_pnl"` // 已实现盈亏（不含手续费和资金费）
+	Commission  float64        `json:"commission"`   // 手续费（负数为支出）
+	Funding     float64        `json:"funding"`      // 资金费（正数为收入）
+	NetPnL      float64        `json:"net_pnl"`      // 净盈亏 = 已实现盈亏 + 手续费 + 资金费
+	TradeCount  int            `json:"trade_count"`  // 成交笔数
+}
+
+// GetTradeHistory 从交易所获取时间范围内的成交和资金流水，并汇总盈亏
+func (at *AutoTrader) GetTradeHistory(symbol string, start, end time.Time) (*TradeHistory, error) {
+	trades, err := at.trader.GetTradeHistory(symbol, start, end)
+	if err != nil {
+		return nil, fmt.Errorf("获取成交记录失败: %w", err)
+	}
+	income, err := at.trader.GetIncomeHistory(symbol, start, end)
+	if err != nil {
+		return nil, fmt.Errorf("获取资金流水失败: %w", err)
+	}
+	return newTradeHistory(start, end, trades, income), nil
+}
+
+// newTradeHistory 汇总资金流水
+func newTradeHistory(start, end time.Time, trades []TradeFill, income []IncomeRecord) *TradeHistory {
+	if trades == nil {
+		trades = []TradeFill{}
+	}
+	if income == nil {
+		income = []IncomeRecord{}
+	}
+	h := &TradeHistory{
+		Start:      start,
+		End:        end,
+		Trades:     trades,
+		Income:     income,
+		TradeCount: len(trades),
+	}
+	for _, r := range income {
+		switch r.Type {
+		case IncomeRealizedPnL:
+			h.RealizedPnL += r.Amount
+		case IncomeCommission:
+			h.Commission += r.Amount
+		case IncomeFunding:
+			h.Funding += r.Amount
+		}
+	}
+	h.NetPnL = h.RealizedPnL + h.Commission + h.Funding
+	return h
+}
+
+// historyWindows 把时间范围切分为不超过maxSpan的查询窗口（交易所限制单次查询的时间跨度）
+func historyWindows(start, end time.Time, maxSpan time.Duration) [][2]time.Time {
+	var windows [][2]time.Time
+	for from := start; from.Before(end); from = from.Add(maxSpan) {
+		to := from.Add(maxSpan)
+		if to.After(end) {
+			to = end
+		}
+		windows = append(windows, [2]time.Time{from, to})
+	}
+	return windows
+}
+
+// incomeSymbols 资金流水中出现过的币种（用于只能按币种查询成交的接口）
+func incomeSymbols(income []IncomeRecord) []string {
+	seen := make(map[string]bool)
+	var symbols []string
+	for _, r := range income {
+		if r.Symbol != "" && !seen[r.Symbol] {
+			seen[r.Symbol] = true
+			symbols = append(symbols, r.Symbol)
+		}
+	}
+	sort.Strings(symbols)
+	return symbols
+}
+
+// sortTradeFills 成交按时间正序排列
+func sortTradeFills(fills []TradeFill) {
+	sort.SliceStable(fills, func(i, j int) bool { return fills[i].Time.Before(fills[j].Time) })
+}
+
+// sortIncome 资金流水按时间正序排列
+func sortIncome(income []IncomeRecord) {
+	sort.SliceStable(income, func(i, j int) bool { return income[i].Time.Before(income[j].Time) })
+}
@@ -0,0 +1,198 @@
+package trader
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHistoryWindowsSplitsRange(t *testing.T) {
+	start := time.UnixMilli(0)
+	end := start.Add(17 * 24 * time.Hour)
+	windows := historyWindows(start, end, 7*24*time.Hour)
+	if len(windows) != 3 {
+		t.Fatalf("应切分为3个窗口，实际 %d", len(windows))
+	}
+	if !windows[0][0].Equal(start) || !windows[2][1].Equal(end) || !windows[1][0].Equal(windows[0][1]) {
+		t.Errorf("窗口边界错误: %v", windows)
+	}
+}
+
+// fakeBinanceHistory 本地模拟的币安成交记录和资金流水接口
+type fakeBinanceHistory struct {
+	mu         sync.Mutex
+	tradeCalls []string // 请求的userTrades币种
+}
+
+func (f *fakeBinanceHistory) handle(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	q := r.URL.Query()
+	switch r.URL.Path {
+	case "/fapi/v1/income":
+		fmt.Fprint(w, `[
+			{"symbol":"BTCUSDT","incomeType":"REALIZED_PNL","income":"-40","asset":"USDT","time":2000},
+			{"symbol":"BTCUSDT","incomeType":"COMMISSION","income":"-0.46","asset":"USDT","time":2000},
+			{"symbol":"ETHUSDT","incomeType":"FUNDING_FEE","income":"0.12","asset":"USDT","time":3000},
+			{"symbol":"","incomeType":"TRANSFER","income":"100","asset":"USDT","time":1000}
+		]`)
+
+	case "/fapi/v1/userTrades":
+		symbol := q.Get("symbol")
+		f.tradeCalls = append(f.tradeCalls, symbol)
+		if symbol != "BTCUSDT" {
+			fmt.Fprint(w, `[]`)
+			return
+		}
+		// 第一页返回满limit条，第二页从最后一条时间+1继续
+		limit, _ := strconv.Atoi(q.Get("limit"))
+		from, _ := strconv.ParseInt(q.Get("startTime"), 10, 64)
+		var trades []map[string]interface{}
+		if from == 0 {
+			for i := 0; i < limit; i++ {
+				trades = append(trades, map[string]interface{}{
+					"symbol": "BTCUSDT", "id": i + 1, "orderId": 1, "side": "BUY", "positionSide": "BOTH",
+					"price": "60000", "qty": "0.00002", "realizedPnl": "0", "commission": "0.0005",
+					"commissionAsset": "USDT", "time": 1000 + i%10,
+				})
+			}
+		} else {
+			trades = append(trades, map[string]interface{}{
+				"symbol": "BTCUSDT", "id": 5000, "orderId": 2, "side": "SELL", "positionSide": "BOTH",
+				"price": "58000", "qty": "0.02", "realizedPnl": "-40", "commission": "0.46",
+				"commissionAsset": "USDT", "time": 2000,
+			})
+		}
+		json.NewEncoder(w).Encode(trades)
+
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestBinanceTradeHistoryPaginatesAndSummarizes(t *testing.T) {
+	fake := &fakeBinanceHistory{}
+	server := httptest.NewServer(http.HandlerFunc(fake.handle))
+	defer server.Close()
+
+	trader := NewFuturesTrader("history-key", "history-secret")
+	trader.client.BaseURL = server.URL
+	at := &AutoTrader{trader: trader}
+
+	history, err := at.GetTradeHistory("", time.UnixMilli(0), time.UnixMilli(24*3600*1000))
+	if err != nil {
+		t.Fatalf("GetTradeHistory失败: %v", err)
+	}
+
+	// 未指定币种时按资金流水中出现的币种查询成交
+	fake.mu.Lock()
+	calls := fmt.Sprint(fake.tradeCalls)
+	fake.mu.Unlock()
+	if calls != "[BTCUSDT BTCUSDT ETHUSDT]" {
+		t.Errorf("成交查询顺序错误: %s", calls)
+	}
+
+	if history.TradeCount != 1001 || len(history.Trades) != 1001 {
+		t.Fatalf("应返回两页共1001笔成交，实际 %d", history.TradeCount)
+	}
+	last := history.Trades[len(history.Trades)-1]
+	if last.OrderID != 2 || last.Side != "SELL" || last.PositionSide != "long" || last.RealizedPnL != -40 || last.Fee != 0.46 {
+		t.Errorf("平仓成交解析错误: %+v", last)
+	}
+	if history.Trades[0].PositionSide != "long" {
+		t.Errorf("单向持仓的买入开仓应为多仓: %+v", history.Trades[0])
+	}
+
+	// 转账等其他流水不计入
+	if len(history.Income) != 3 || history.RealizedPnL != -40 || history.Commission != -0.46 || history.Funding != 0.12 {
+		t.Errorf("资金流水汇总错误: %+v", history)
+	}
+	if !floatEq(history.NetPnL, -40.34) {
+		t.Errorf("净盈亏应为-40.34，实际 %.4f", history.NetPnL)
+	}
+}
+
+func TestHyperliquidIncomeHistoryIncludesFunding(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&req)
+		if req["user"] != "0xabc" {
+			t.Errorf("请求用户错误: %v", req)
+		}
+		switch req["type"] {
+		case "userFillsByTime":
+			json.NewEncoder(w).Encode([]interface{}{
+				hyperliquidFill(1, 400, 1000, "B", "0", "0.02", "60000", "0"),
+				hyperliquidFill(2, 501, 2000, "A", "0.02", "0.02", "58000", "-40"),
+				map[string]interface{}{"coin": "ETH", "px": "3000", "sz": "1", "side": "A", "time": 2500,
+					"startPosition": "0", "closedPnl": "0", "oid": 700, "tid": 3, "fee": "0.3", "feeToken": "USDC"},
+			})
+		case "userFunding":
+			fmt.Fprint(w, `[{"time":3000,"hash":"0x0","delta":{"type":"funding","coin":"BTC","usdc":"-1.25","szi":"0.02","fundingRate":"0.0001"}},
+				{"time":3600,"hash":"0x0","delta":{"type":"funding","coin":"ETH","usdc":"0.5","szi":"-1","fundingRate":"0.0001"}}]`)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	trader := &HyperliquidTrader{walletAddr: "0xabc", apiURL: server.URL}
+
+	fills, err := trader.GetTradeHistory("ETHUSDT", time.UnixMilli(0), time.UnixMilli(10000))
+	if err != nil {
+		t.Fatalf("GetTradeHistory失败: %v", err)
+	}
+	if len(fills) != 1 || fills[0].Side != "SELL" || fills[0].PositionSide != "short" || fills[0].TradeID != 3 {
+		t.Errorf("按币种过滤的成交错误: %+v", fills)
+	}
+
+	income, err := trader.GetIncomeHistory("BTCUSDT", time.UnixMilli(0), time.UnixMilli(10000))
+	if err != nil {
+		t.Fatalf("GetIncomeHistory失败: %v", err)
+	}
+	h := newTradeHistory(time.UnixMilli(0), time.UnixMilli(10000), nil, income)
+	// 两笔成交手续费各0.5，平仓盈亏-40，资金费-1.25
+	if h.RealizedPnL != -40 || h.Commission != -1 || h.Funding != -1.25 || len(income) != 4 {
+		t.Errorf("资金流水错误: %+v", income)
+	}
+}
+
+func TestPaperTraderRecordsTradeHistory(t *testing.T) {
+	price := 60000.0
+	paper := NewPaperTrader(10000, 0.0001, 0.0005)
+	paper.fetchQuote = func(symbol string) (float64, float64, error) { return price, 0, nil }
+	paper.cacheDuration = 0
+
+	start := time.Now().Add(-time.Minute)
+	if _, err := paper.OpenLong("BTCUSDT", 0.1, 5); err != nil {
+		t.Fatalf("开仓失败: %v", err)
+	}
+	price = 61000
+	if _, err := paper.CloseLong("BTCUSDT", 0); err != nil {
+		t.Fatalf("平仓失败: %v", err)
+	}
+
+	fills, _ := paper.GetTradeHistory("", start, time.Now().Add(time.Minute))
+	if len(fills) != 2 || fills[0].Side != "BUY" || fills[1].Side != "SELL" || fills[1].PositionSide != "long" {
+		t.Fatalf("成交记录错误: %+v", fills)
+	}
+	income, _ := paper.GetIncomeHistory("BTCUSDT", start, time.Now().Add(time.Minute))
+	h := newTradeHistory(start, time.Now(), fills, income)
+	if math.Abs(h.RealizedPnL-100) > 0.01 || !floatEq(h.RealizedPnL, fills[1].RealizedPnL) ||
+		!floatEq(h.Commission, -(fills[0].Fee+fills[1].Fee)) {
+		t.Errorf("模拟盘盈亏汇总错误: %+v", h)
+	}
+
+	// 账户余额变化应与流水净值一致
+	balance, _ := paper.GetBalance()
+	if math.Abs(balance.TotalWalletBalance-10000-h.NetPnL) > 1e-6 {
+		t.Errorf("流水净值与余额变化不一致: %.4f vs %.4f", balance.TotalWalletBalance-10000, h.NetPnL)
+	}
+}
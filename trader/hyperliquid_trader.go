@@ -1,12 +1,18 @@
 package trader
 
 import (
+	"bytes"
 	"context"
+	"crypto/ecdsa"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
+	"net/http"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/sonirico/go-hyperliquid"
@@ -17,21 +23,53 @@ type HyperliquidTrader struct {
 	exchange   *hyperliquid.Exchange
 	ctx        context.Context
 	walletAddr string
+	apiURL     string
 	meta       *hyperliquid.Meta // 缓存meta信息（包含精度等）
+	privateKey *ecdsa.PrivateKey // 签名SDK不支持的操作（带分组的下单）
+
+	// websocket推送
+	tradeEventHub
+	wsURL         string
+	stream        *hyperliquidStream
+	streamMu      sync.Mutex
+	triggerOrders map[int64]string // 条件单ID -> 类型（CloseOrderStopMarket/CloseOrderTakeProfitMarket）
+	triggerMu     sync.Mutex
+
+	// 直接提交的操作使用的nonce（同时同步给SDK）
+	lastNonce int64
+	nonceMu   sync.Mutex
+
+	// 保证金模式（Hyperliquid只支持单向持仓）
+	tradingModes
+
+	// 客户端模拟的追踪止损
+	trailing *trailingStopEmulator
+
+	// positionTpsl联动单的状态跟踪
+	brackets *bracketMonitor
+
+	// 开平仓订单的cloid
+	clientOrderIDs
 }
 
 // NewHyperliquidTrader 创建Hyperliquid交易器
 func NewHyperliquidTrader(privateKeyHex string, walletAddr string, testnet bool) (*HyperliquidTrader, error) {
-	// 解析私钥
-	privateKey, err := crypto.HexToECDSA(privateKeyHex)
-	if err != nil {
-		return nil, fmt.Errorf("解析私钥失败: %w", err)
-	}
-
 	// 选择API URL
 	apiURL := hyperliquid.MainnetAPIURL
+	wsURL := hyperliquidMainnetWsURL
 	if testnet {
 		apiURL = hyperliquid.TestnetAPIURL
+		wsURL = hyperliquidTestnetWsURL
+	}
+	return NewHyperliquidTraderWithURL(privateKeyHex, walletAddr, apiURL, wsURL)
+}
+
+// NewHyperliquidTraderWithURL 创建连接指定API/websocket地址的Hyperliquid交易器（用于本地模拟服务）
+func NewHyperliquidTraderWithURL(privateKeyHex, walletAddr, apiURL, wsURL string) (*HyperliquidTrader, error) {
+	// 解析私钥
+	privateKey, err := crypto.HexToECDSA(privateKeyHex)
+	if err != nil {
+		return nil, fmt.Errorf("解析私钥失败: %w", err)
 	}
 
 	// // 从私钥生成钱包地址
@@ -55,7 +93,7 @@ func NewHyperliquidTrader(privateKeyHex string, walletAddr string, testnet bool)
 		nil,        // SpotMeta will be fetched automatically
 	)
 
-	log.Printf("✓ Hyperliquid交易器初始化成功 (testnet=%v, wallet=%s)", testnet, walletAddr)
+	log.Printf("✓ Hyperliquid交易器初始化成功 (api=%s, wallet=%s)", apiURL, walletAddr)
 
 	// 获取meta信息（包含精度等配置）
 	meta, err := exchange.Info().Meta(ctx)
@@ -63,16 +101,25 @@ func NewHyperliquidTrader(privateKeyHex string, walletAddr string, testnet bool)
 		return nil, fmt.Errorf("获取meta信息失败: %w", err)
 	}
 
-	return &HyperliquidTrader{
-		exchange:   exchange,
-		ctx:        ctx,
-		walletAddr: walletAddr,
-		meta:       meta,
-	}, nil
+	t := &HyperliquidTrader{
+		exchange:      exchange,
+		ctx:           ctx,
+		walletAddr:    walletAddr,
+		apiURL:        apiURL,
+		meta:          meta,
+		privateKey:    privateKey,
+		wsURL:         wsURL,
+		triggerOrders: make(map[int64]string),
+		// 默认逐仓
+		tradingModes: tradingModes{marginMode: MarginModeIsolated, positionMode: PositionModeOneWay, positionReady: true},
+	}
+	t.trailing = newTrailingStopEmulator(t.GetMarketPrice, closePositionFunc(t))
+	t.brackets = newBracketMonitor(t)
+	return t, nil
 }
 
 // GetBalance 获取账户余额
-func (t *HyperliquidTrader) GetBalance() (map[string]interface{}, error) {
+func (t *HyperliquidTrader) GetBalance() (*Balance, error) {
 	log.Printf("🔄 正在调用Hyperliquid API获取账户余额...")
 
 	// 获取账户状态
@@ -83,8 +130,6 @@ func (t *HyperliquidTrader) GetBalance() (map[string]interface{}, error) {
 	}
 
 	// 解析余额信息（MarginSummary字段都是string）
-	result := make(map[string]interface{})
-
 	// 🔍 调试：打印API返回的完整CrossMarginSummary结构
 	summaryJSON, _ := json.MarshalIndent(accountState.MarginSummary, "  ", "  ")
 	log.Printf("🔍 [DEBUG] Hyperliquid API CrossMarginSummary完整数据:")
@@ -108,29 +153,31 @@ func (t *HyperliquidTrader) GetBalance() (map[string]interface{}, error) {
 	// 需要返回"不包含未实现盈亏的钱包余额"
 	walletBalanceWithoutUnrealized := accountValue - totalUnrealizedPnl
 
-	result["totalWalletBalance"] = walletBalanceWithoutUnrealized // 钱包余额（不含未实现盈亏）
-	result["availableBalance"] = accountValue - totalMarginUsed   // 可用余额（总净值 - 占用保证金）
-	result["totalUnrealizedProfit"] = totalUnrealizedPnl          // 未实现盈亏
+	result := &Balance{
+		TotalWalletBalance:    walletBalanceWithoutUnrealized, // 钱包余额（不含未实现盈亏）
+		AvailableBalance:      accountValue - totalMarginUsed, // 可用余额（总净值 - 占用保证金）
+		TotalUnrealizedProfit: totalUnrealizedPnl,             // 未实现盈亏
+	}
 
 	log.Printf("✓ Hyperliquid 账户: 总净值=%.2f (钱包%.2f+未实现%.2f), 可用=%.2f, 保证金占用=%.2f",
 		accountValue,
 		walletBalanceWithoutUnrealized,
 		totalUnrealizedPnl,
-		result["availableBalance"],
+		result.AvailableBalance,
 		totalMarginUsed)
 
 	return result, nil
 }
 
 // GetPositions 获取所有持仓
-func (t *HyperliquidTrader) GetPositions() ([]map[string]interface{}, error) {
+func (t *HyperliquidTrader) GetPositions() ([]Position, error) {
 	// 获取账户状态
 	accountState, err := t.exchange.Info().UserState(t.ctx, t.walletAddr)
 	if err != nil {
 		return nil, fmt.Errorf("获取持仓失败: %w", err)
 	}
 
-	var result []map[string]interface{}
+	var result []Position
 
 	// 遍历所有持仓
 	for _, assetPos := range accountState.AssetPositions {
@@ -143,19 +190,16 @@ func (t *HyperliquidTrader) GetPositions() ([]map[string]interface{}, error) {
 			continue // 跳过无持仓的
 		}
 
-		posMap := make(map[string]interface{})
-
 		// 标准化symbol格式（Hyperliquid使用如"BTC"，我们转换为"BTCUSDT"）
-		symbol := position.Coin + "USDT"
-		posMap["symbol"] = symbol
+		pos := Position{Symbol: position.Coin + "USDT"}
 
 		// 持仓数量和方向
 		if posAmt > 0 {
-			posMap["side"] = "long"
-			posMap["positionAmt"] = posAmt
+			pos.Side = "long"
+			pos.PositionAmt = posAmt
 		} else {
-			posMap["side"] = "short"
-			posMap["positionAmt"] = -posAmt // 转为正数
+			pos.Side = "short"
+			pos.PositionAmt = -posAmt // 转为正数
 		}
 
 		// 价格信息（EntryPx和LiquidationPx是指针类型）
@@ -176,13 +220,13 @@ func (t *HyperliquidTrader) GetPositions() ([]map[string]interface{}, error) {
 			markPrice = positionValue / absFloat(posAmt)
 		}
 
-		posMap["entryPrice"] = entryPrice
-		posMap["markPrice"] = markPrice
-		posMap["unRealizedProfit"] = unrealizedPnl
-		posMap["leverage"] = float64(position.Leverage.Value)
-		posMap["liquidationPrice"] = liquidationPx
+		pos.EntryPrice = entryPrice
+		pos.MarkPrice = markPrice
+		pos.UnRealizedProfit = unrealizedPnl
+		pos.Leverage = position.Leverage.Value
+		pos.LiquidationPrice = liquidationPx
 
-		result = append(result, posMap)
+		result = append(result, pos)
 	}
 
 	return result, nil
@@ -193,18 +237,51 @@ func (t *HyperliquidTrader) SetLeverage(symbol string, leverage int) error {
 	// Hyperliquid symbol格式（去掉USDT后缀）
 	coin := convertSymbolToHyperliquid(symbol)
 
+	// Hyperliquid的保证金模式随杠杆一起设置（每次开仓前都会设置杠杆）
+	isCross := t.marginModeFor(symbol) == MarginModeCross
+
 	// 调用UpdateLeverage (leverage int, name string, isCross bool)
-	_, err := t.exchange.UpdateLeverage(t.ctx, leverage, coin, false) // false = 逐仓模式
+	_, err := t.exchange.UpdateLeverage(t.ctx, leverage, coin, isCross)
 	if err != nil {
 		return fmt.Errorf("设置杠杆失败: %w", err)
 	}
 
-	log.Printf("  ✓ %s 杠杆已切换为 %dx", symbol, leverage)
+	log.Printf("  ✓ %s 杠杆已切换为 %dx (全仓=%v)", symbol, leverage, isCross)
 	return nil
 }
 
+// SetMarginMode 设置保证金模式（随下次开仓设置杠杆时生效）
+func (t *HyperliquidTrader) SetMarginMode(symbol string, mode MarginMode) error {
+	return t.setMarginMode(symbol, mode)
+}
+
+// SetPositionMode 设置持仓模式（Hyperliquid只支持单向持仓）
+func (t *HyperliquidTrader) SetPositionMode(mode PositionMode) error {
+	if mode == PositionModeHedge {
+		return fmt.Errorf("Hyperliquid不支持双向持仓")
+	}
+	return t.setPositionMode(mode)
+}
+
+// Capabilities Hyperliquid支持的功能
+// 没有原生追踪止损（由客户端模拟）和双向持仓；SDK的挂单不区分止损止盈，逐仓保证金调整暂不可用
+func (t *HyperliquidTrader) Capabilities() Capabilities {
+	return Capabilities{
+		TrailingStop: true,
+		ReduceOnly:   true,
+		LimitOrders:  true,
+		MinNotional:  10,
+	}
+}
+
+// AdjustIsolatedMargin 调整逐仓保证金
+// SDK的updateIsolatedMargin把金额方向当作仓位方向、金额未按1e6放大，发出的请求不正确，暂不支持
+func (t *HyperliquidTrader) AdjustIsolatedMargin(symbol string, positionSide string, amount float64) error {
+	return fmt.Errorf("Hyperliquid暂不支持调整逐仓保证金")
+}
+
 // OpenLong 开多仓
-func (t *HyperliquidTrader) OpenLong(symbol string, quantity float64, leverage int) (map[string]interface{}, error) {
+func (t *HyperliquidTrader) OpenLong(symbol string, quantity float64, leverage int) (*OrderResult, error) {
 	// 先取消该币种的所有委托单
 	if err := t.CancelAllOrders(symbol); err != nil {
 		log.Printf("  ⚠ 取消旧委托单失败: %v", err)
@@ -246,23 +323,18 @@ func (t *HyperliquidTrader) OpenLong(symbol string, quantity float64, leverage i
 		ReduceOnly: false,
 	}
 
-	_, err = t.exchange.Order(t.ctx, order, nil)
+	result, err := t.placeMarketOrder(symbol, order)
 	if err != nil {
 		return nil, fmt.Errorf("开多仓失败: %w", err)
 	}
 
 	log.Printf("✓ 开多仓成功: %s 数量: %.4f", symbol, roundedQuantity)
 
-	result := make(map[string]interface{})
-	result["orderId"] = 0 // Hyperliquid没有返回order ID
-	result["symbol"] = symbol
-	result["status"] = "FILLED"
-
 	return result, nil
 }
 
 // OpenShort 开空仓
-func (t *HyperliquidTrader) OpenShort(symbol string, quantity float64, leverage int) (map[string]interface{}, error) {
+func (t *HyperliquidTrader) OpenShort(symbol string, quantity float64, leverage int) (*OrderResult, error) {
 	// 先取消该币种的所有委托单
 	if err := t.CancelAllOrders(symbol); err != nil {
 		log.Printf("  ⚠ 取消旧委托单失败: %v", err)
@@ -304,23 +376,18 @@ func (t *HyperliquidTrader) OpenShort(symbol string, quantity float64, leverage
 		ReduceOnly: false,
 	}
 
-	_, err = t.exchange.Order(t.ctx, order, nil)
+	result, err := t.placeMarketOrder(symbol, order)
 	if err != nil {
 		return nil, fmt.Errorf("开空仓失败: %w", err)
 	}
 
 	log.Printf("✓ 开空仓成功: %s 数量: %.4f", symbol, roundedQuantity)
 
-	result := make(map[string]interface{})
-	result["orderId"] = 0
-	result["symbol"] = symbol
-	result["status"] = "FILLED"
-
 	return result, nil
 }
 
 // CloseLong 平多仓
-func (t *HyperliquidTrader) CloseLong(symbol string, quantity float64) (map[string]interface{}, error) {
+func (t *HyperliquidTrader) CloseLong(symbol string, quantity float64) (*OrderResult, error) {
 	// 如果数量为0，获取当前持仓数量
 	if quantity == 0 {
 		positions, err := t.GetPositions()
@@ -329,8 +396,8 @@ func (t *HyperliquidTrader) CloseLong(symbol string, quantity float64) (map[stri
 		}
 
 		for _, pos := range positions {
-			if pos["symbol"] == symbol && pos["side"] == "long" {
-				quantity = pos["positionAmt"].(float64)
+			if pos.Symbol == symbol && pos.Side == "long" {
+				quantity = pos.PositionAmt
 				break
 			}
 		}
@@ -371,7 +438,7 @@ func (t *HyperliquidTrader) CloseLong(symbol string, quantity float64) (map[stri
 		ReduceOnly: true, // 只平仓，不开新仓
 	}
 
-	_, err = t.exchange.Order(t.ctx, order, nil)
+	result, err := t.placeMarketOrder(symbol, order)
 	if err != nil {
 		return nil, fmt.Errorf("平多仓失败: %w", err)
 	}
@@ -383,16 +450,11 @@ func (t *HyperliquidTrader) CloseLong(symbol string, quantity float64) (map[stri
 		log.Printf("  ⚠ 取消挂单失败: %v", err)
 	}
 
-	result := make(map[string]interface{})
-	result["orderId"] = 0
-	result["symbol"] = symbol
-	result["status"] = "FILLED"
-
 	return result, nil
 }
 
 // CloseShort 平空仓
-func (t *HyperliquidTrader) CloseShort(symbol string, quantity float64) (map[string]interface{}, error) {
+func (t *HyperliquidTrader) CloseShort(symbol string, quantity float64) (*OrderResult, error) {
 	// 如果数量为0，获取当前持仓数量
 	if quantity == 0 {
 		positions, err := t.GetPositions()
@@ -401,8 +463,8 @@ func (t *HyperliquidTrader) CloseShort(symbol string, quantity float64) (map[str
 		}
 
 		for _, pos := range positions {
-			if pos["symbol"] == symbol && pos["side"] == "short" {
-				quantity = pos["positionAmt"].(float64)
+			if pos.Symbol == symbol && pos.Side == "short" {
+				quantity = pos.PositionAmt
 				break
 			}
 		}
@@ -443,7 +505,7 @@ func (t *HyperliquidTrader) CloseShort(symbol string, quantity float64) (map[str
 		ReduceOnly: true,
 	}
 
-	_, err = t.exchange.Order(t.ctx, order, nil)
+	result, err := t.placeMarketOrder(symbol, order)
 	if err != nil {
 		return nil, fmt.Errorf("平空仓失败: %w", err)
 	}
@@ -455,16 +517,248 @@ func (t *HyperliquidTrader) CloseShort(symbol string, quantity float64) (map[str
 		log.Printf("  ⚠ 取消挂单失败: %v", err)
 	}
 
-	result := make(map[string]interface{})
-	result["orderId"] = 0
-	result["symbol"] = symbol
-	result["status"] = "FILLED"
+	return result, nil
+}
+
+// OpenLongLimit 限价开多
+func (t *HyperliquidTrader) OpenLongLimit(symbol string, quantity, price float64, leverage int, tif TimeInForce) (*OrderResult, error) {
+	return t.openLimit(symbol, true, quantity, price, leverage, tif)
+}
+
+// OpenShortLimit 限价开空
+func (t *HyperliquidTrader) OpenShortLimit(symbol string, quantity, price float64, leverage int, tif TimeInForce) (*OrderResult, error) {
+	return t.openLimit(symbol, false, quantity, price, leverage, tif)
+}
+
+// openLimit 下限价开仓单
+func (t *HyperliquidTrader) openLimit(symbol string, isBuy bool, quantity, price float64, leverage int, tif TimeInForce) (*OrderResult, error) {
+	// 先取消该币种的所有委托单
+	if err := t.CancelAllOrders(symbol); err != nil {
+		log.Printf("  ⚠ 取消旧委托单失败: %v", err)
+	}
+
+	// 设置杠杆
+	if err := t.SetLeverage(symbol, leverage); err != nil {
+		return nil, err
+	}
+
+	coin := convertSymbolToHyperliquid(symbol)
+	roundedQuantity := t.roundToSzDecimals(coin, quantity)
+	roundedPrice := t.roundPriceToSigfigs(price)
+
+	order := hyperliquid.CreateOrderRequest{
+		Coin:  coin,
+		IsBuy: isBuy,
+		Size:  roundedQuantity,
+		Price: roundedPrice,
+		OrderType: hyperliquid.OrderType{
+			Limit: &hyperliquid.LimitOrderType{
+				Tif: hyperliquidTif(tif),
+			},
+		},
+		ReduceOnly: false,
+	}
+
+	result, err := t.placeOrder(symbol, order, t.limitOrderResult)
+	if err != nil {
+		return nil, fmt.Errorf("限价开仓失败: %w", err)
+	}
+
+	log.Printf("✓ 限价开仓单已提交: %s 价格: %.8f 数量: %.4f (%s) 状态: %s", symbol, roundedPrice, roundedQuantity, tif, result.Status)
+
+	return result, nil
+}
+
+// placeOrder 发送开平仓订单（附带cloid，结果不确定时先按cloid查询再决定是否重新下单）
+// parse解析下单返回的订单状态
+func (t *HyperliquidTrader) placeOrder(symbol string, order hyperliquid.CreateOrderRequest,
+	parse func(symbol string, status hyperliquid.OrderStatus) (*OrderResult, error)) (*OrderResult, error) {
+	cloid := t.nextClientOrderID().Cloid()
+	if cloid != "" {
+		order.ClientOrderID = &cloid
+	}
+	return submitOrder(cloid, func() (*OrderResult, error) {
+		status, err := t.exchange.Order(t.ctx, order, nil)
+		if err != nil {
+			return nil, err
+		}
+		return parse(symbol, status)
+	}, func() (*OrderResult, error) {
+		res, err := t.exchange.Info().QueryOrderByCloid(t.ctx, t.walletAddr, cloid)
+		if err != nil {
+			return nil, fmt.Errorf("查询订单失败: %w", err)
+		}
+		if res.Status != hyperliquid.OrderQueryStatusSuccess {
+			return nil, nil // 订单不存在
+		}
+		return t.orderQueryResult(symbol, res), nil
+	})
+}
+
+// placeMarketOrder 发送IOC市价单（按cloid查到的订单没有成交时同样视为未成交）
+func (t *HyperliquidTrader) placeMarketOrder(symbol string, order hyperliquid.CreateOrderRequest) (*OrderResult, error) {
+	result, err := t.placeOrder(symbol, order, t.marketOrderResult)
+	if err != nil {
+		return nil, err
+	}
+	if result.ExecutedQty <= 0 {
+		return nil, fmt.Errorf("订单未成交: %s", result.Status)
+	}
+	return result, nil
+}
+
+// limitOrderResult 解析限价单的下单结果（已成交时查询成交明细）
+func (t *HyperliquidTrader) limitOrderResult(symbol string, status hyperliquid.OrderStatus) (*OrderResult, error) {
+	// IOC无法成交、只做Maker单会立即成交等情况以error状态返回
+	if status.Error != nil {
+		return nil, fmt.Errorf("订单被拒绝: %s", *status.Error)
+	}
+
+	result := &OrderResult{Symbol: symbol, Status: OrderStatusNew}
+	if status.Filled != nil {
+		result.OrderID = int64(status.Filled.Oid)
+		result.Status = OrderStatusFilled
+		result.AvgPrice, _ = strconv.ParseFloat(status.Filled.AvgPx, 64)
+		result.ExecutedQty, _ = strconv.ParseFloat(status.Filled.TotalSz, 64)
+		t.withFills(result, time.Now().Add(-time.Minute))
+	} else if status.Resting != nil {
+		result.OrderID = status.Resting.Oid
+	}
+	return result, nil
+}
+
+// marketOrderResult 解析IOC市价单的下单结果，并查询成交明细补充成交均价和手续费
+func (t *HyperliquidTrader) marketOrderResult(symbol string, status hyperliquid.OrderStatus) (*OrderResult, error) {
+	if status.Error != nil {
+		return nil, fmt.Errorf("订单未成交: %s", *status.Error)
+	}
+	if status.Filled == nil {
+		return nil, fmt.Errorf("订单未成交: %s", status.String())
+	}
+
+	result := &OrderResult{
+		OrderID: int64(status.Filled.Oid),
+		Symbol:  symbol,
+		Status:  OrderStatusFilled,
+	}
+	result.AvgPrice, _ = strconv.ParseFloat(status.Filled.AvgPx, 64)
+	result.ExecutedQty, _ = strconv.ParseFloat(status.Filled.TotalSz, 64)
 
+	t.withFills(result, time.Now().Add(-time.Minute))
 	return result, nil
 }
 
-// CancelAllOrders 取消该币种的所有挂单
+// withFills 查询订单的成交明细，补充成交均价、成交数量和手续费（查询失败时保持不变）
+// since: 成交明细的查询起始时间（不早于下单时间即可）
+func (t *HyperliquidTrader) withFills(result *OrderResult, since time.Time) {
+	fills, err := t.exchange.Info().UserFillsByTime(t.ctx, t.walletAddr, since.UnixMilli(), nil)
+	if err != nil {
+		log.Printf("  ⚠ 查询订单成交明细失败: %v", err)
+		return
+	}
+
+	var orderFills []orderFill
+	for _, f := range fills {
+		if f.Oid != result.OrderID {
+			continue
+		}
+		price, _ := strconv.ParseFloat(f.Price, 64)
+		size, _ := strconv.ParseFloat(f.Size, 64)
+		fee, _ := strconv.ParseFloat(f.Fee, 64)
+		orderFills = append(orderFills, orderFill{Price: price, Quantity: size, Fee: fee, FeeAsset: f.FeeToken})
+	}
+	result.applyFills(orderFills)
+}
+
+// hyperliquidTif 转换为Hyperliquid的有效方式（只做Maker对应Alo）
+func hyperliquidTif(tif TimeInForce) hyperliquid.Tif {
+	switch tif {
+	case TimeInForceIOC:
+		return hyperliquid.TifIoc
+	case TimeInForcePostOnly:
+		return hyperliquid.TifAlo
+	default:
+		return hyperliquid.TifGtc
+	}
+}
+
+// GetOrder 查询订单状态
+// 订单查询不返回成交均价，有成交时再查询成交明细（查询失败时以限价近似）
+func (t *HyperliquidTrader) GetOrder(symbol string, orderID int64) (*OrderResult, error) {
+	res, err := t.exchange.Info().QueryOrderByOid(t.ctx, t.walletAddr, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("查询订单失败: %w", err)
+	}
+	if res.Status != hyperliquid.OrderQueryStatusSuccess {
+		return nil, fmt.Errorf("订单不存在: %d", orderID)
+	}
+	return t.orderQueryResult(symbol, res), nil
+}
+
+// orderQueryResult 将订单查询结果转换为OrderResult
+func (t *HyperliquidTrader) orderQueryResult(symbol string, res *hyperliquid.OrderQueryResult) *OrderResult {
+	order := res.Order.Order
+	origSz, _ := strconv.ParseFloat(order.OrigSz, 64)
+	remainingSz, _ := strconv.ParseFloat(order.Sz, 64)
+	limitPx, _ := strconv.ParseFloat(order.LimitPx, 64)
+
+	result := &OrderResult{
+		OrderID:     order.Oid,
+		Symbol:      symbol,
+		ExecutedQty: origSz - remainingSz,
+	}
+	if result.ExecutedQty > 0 {
+		result.AvgPrice = limitPx
+	}
+	if order.Cloid != nil {
+		result.ClientOrderID = *order.Cloid
+	}
+
+	result.Status = hyperliquidOrderStatus(string(res.Order.Status), result.ExecutedQty)
+	if result.Status == OrderStatusFilled {
+		result.ExecutedQty = origSz
+		result.AvgPrice = limitPx
+	}
+
+	if result.ExecutedQty > 0 {
+		t.withFills(result, time.UnixMilli(order.Timestamp))
+	}
+
+	return result
+}
+
+// hyperliquidOrderStatus 转换为统一的订单状态（已触发的条件单视为挂单中）
+func hyperliquidOrderStatus(status string, executedQty float64) string {
+	switch {
+	case status == string(hyperliquid.OrderStatusValueOpen) || status == string(hyperliquid.OrderStatusValueTriggered):
+		if executedQty > 0 {
+			return OrderStatusPartiallyFilled
+		}
+		return OrderStatusNew
+	case status == string(hyperliquid.OrderStatusValueFilled):
+		return OrderStatusFilled
+	case strings.HasSuffix(status, "Rejected") || status == string(hyperliquid.OrderStatusValueRejected):
+		return OrderStatusRejected
+	default:
+		// canceled、marginCanceled等各类撤销
+		return OrderStatusCanceled
+	}
+}
+
+// CancelOrder 取消指定订单
+func (t *HyperliquidTrader) CancelOrder(symbol string, orderID int64) error {
+	coin := convertSymbolToHyperliquid(symbol)
+	if _, err := t.exchange.Cancel(t.ctx, coin, orderID); err != nil {
+		return fmt.Errorf("取消订单失败: %w", err)
+	}
+
+	log.Printf("  ✓ 已取消 %s 订单 %d", symbol, orderID)
+	return nil
+}
+
+// CancelAllOrders 取消该币种的所有挂单（包括客户端模拟的追踪止损）
 func (t *HyperliquidTrader) CancelAllOrders(symbol string) error {
+	t.trailing.cancel(symbol)
 	coin := convertSymbolToHyperliquid(symbol)
 
 	// 获取所有挂单
@@ -593,6 +887,30 @@ func (t *HyperliquidTrader) GetMarketPrice(symbol string) (float64, error) {
 	return 0, fmt.Errorf("未找到 %s 的价格", symbol)
 }
 
+// GetOrderBook 获取L2订单簿（Hyperliquid固定返回每侧最多20档，忽略depth）
+func (t *HyperliquidTrader) GetOrderBook(symbol string, depth int) (*OrderBook, error) {
+	res, err := t.exchange.Info().L2Snapshot(t.ctx, convertSymbolToHyperliquid(symbol))
+	if err != nil {
+		return nil, fmt.Errorf("获取订单簿失败: %w", err)
+	}
+
+	book := &OrderBook{Symbol: symbol, Time: time.UnixMilli(res.Time)}
+	for i, levels := range res.Levels {
+		if depth > 0 && len(levels) > depth {
+			levels = levels[:depth] // 接口固定返回每侧最多20档
+		}
+		for _, level := range levels {
+			l := OrderBookLevel{Price: level.Px, Quantity: level.Sz}
+			if i == 0 {
+				book.Bids = append(book.Bids, l)
+			} else {
+				book.Asks = append(book.Asks, l)
+			}
+		}
+	}
+	return book, nil
+}
+
 // SetStopLoss 设置止损单
 func (t *HyperliquidTrader) SetStopLoss(symbol string, positionSide string, quantity, stopPrice float64) error {
 	coin := convertSymbolToHyperliquid(symbol)
@@ -621,10 +939,13 @@ func (t *HyperliquidTrader) SetStopLoss(symbol string, positionSide string, quan
 		ReduceOnly: true,
 	}
 
-	_, err := t.exchange.Order(t.ctx, order, nil)
+	status, err := t.exchange.Order(t.ctx, order, nil)
 	if err != nil {
 		return fmt.Errorf("设置止损失败: %w", err)
 	}
+	if status.Resting != nil {
+		t.rememberTriggerOrder(status.Resting.Oid, CloseOrderStopMarket)
+	}
 
 	log.Printf("  止损价设置: %.4f", roundedStopPrice)
 	return nil
@@ -658,15 +979,84 @@ func (t *HyperliquidTrader) SetTakeProfit(symbol string, positionSide string, qu
 		ReduceOnly: true,
 	}
 
-	_, err := t.exchange.Order(t.ctx, order, nil)
+	status, err := t.exchange.Order(t.ctx, order, nil)
 	if err != nil {
 		return fmt.Errorf("设置止盈失败: %w", err)
 	}
+	if status.Resting != nil {
+		t.rememberTriggerOrder(status.Resting.Oid, CloseOrderTakeProfitMarket)
+	}
 
 	log.Printf("  止盈价设置: %.4f", roundedTakeProfitPrice)
 	return nil
 }
 
+// PlaceBracket 以positionTpsl分组下止损止盈单（交易所把两者绑定到持仓，持仓平掉后自动撤销剩余的一侧）
+func (t *HyperliquidTrader) PlaceBracket(symbol, positionSide string, quantity, stopLoss, takeProfit float64) (*Bracket, error) {
+	coin := convertSymbolToHyperliquid(symbol)
+	asset := t.exchange.Info().NameToAsset(coin)
+
+	isBuy := positionSide == "SHORT" // 空仓止损止盈=买入，多仓=卖出
+	roundedQuantity := t.roundToSzDecimals(coin, quantity)
+	roundedStopLoss := t.roundPriceToSigfigs(stopLoss)
+	roundedTakeProfit := t.roundPriceToSigfigs(takeProfit)
+
+	action := hyperliquidGroupedOrderAction{
+		Type: "order",
+		Orders: []hyperliquidTriggerOrderWire{
+			newHyperliquidTriggerWire(asset, isBuy, roundedQuantity, roundedStopLoss, "sl"),
+			newHyperliquidTriggerWire(asset, isBuy, roundedQuantity, roundedTakeProfit, "tp"),
+		},
+		Grouping: string(hyperliquid.GroupingPositionTpls),
+	}
+	statuses, err := t.postOrderAction(action)
+	if err != nil {
+		return nil, fmt.Errorf("设置止损止盈联动单失败: %w", err)
+	}
+	if len(statuses) != 2 {
+		return nil, fmt.Errorf("设置止损止盈联动单失败: 返回%d个订单状态", len(statuses))
+	}
+	for i, status := range statuses {
+		if status.Error != nil {
+			return nil, fmt.Errorf("设置止损止盈联动单失败: %s", *status.Error)
+		}
+		if status.Resting != nil {
+			orderType := CloseOrderStopMarket
+			if i == 1 {
+				orderType = CloseOrderTakeProfitMarket
+			}
+			t.rememberTriggerOrder(status.Resting.Oid, orderType)
+		}
+	}
+
+	log.Printf("  止损止盈联动单设置: 止损%.4f 止盈%.4f (positionTpsl)", roundedStopLoss, roundedTakeProfit)
+	b := t.brackets.track(&Bracket{
+		Symbol:       symbol,
+		PositionSide: positionSide,
+		Quantity:     roundedQuantity,
+		StopLoss:     roundedStopLoss,
+		TakeProfit:   roundedTakeProfit,
+		Linkage:      BracketLinkageNative,
+	})
+	return &b, nil
+}
+
+// GetBrackets 跟踪中的联动单状态
+func (t *HyperliquidTrader) GetBrackets() []Bracket {
+	return t.brackets.list()
+}
+
+// SetTrailingStop 设置追踪止损（Hyperliquid没有原生追踪止损单，由客户端轮询价格模拟，回调达到比例时市价平仓）
+func (t *HyperliquidTrader) SetTrailingStop(symbol string, positionSide string, quantity, activationPrice, callbackRate float64) error {
+	coin := convertSymbolToHyperliquid(symbol)
+	if err := t.trailing.set(symbol, positionSide, t.roundToSzDecimals(coin, quantity), activationPrice, callbackRate); err != nil {
+		return fmt.Errorf("设置追踪止损失败: %w", err)
+	}
+
+	log.Printf("  追踪止损设置（客户端模拟）: 回调%.2f%% 激活价%.4f", callbackRate, activationPrice)
+	return nil
+}
+
 // FormatQuantity 格式化数量到正确的精度
 func (t *HyperliquidTrader) FormatQuantity(symbol string, quantity float64) (string, error) {
 	coin := convertSymbolToHyperliquid(symbol)
@@ -765,37 +1155,331 @@ func absFloat(x float64) float64 {
 	return x
 }
 
-// GetOpenOrders 获取指定币种的所有未完成订单
-func (t *HyperliquidTrader) GetOpenOrders(symbol string) ([]map[string]interface{}, error) {
+// GetOpenOrders 获取指定币种的所有未完成订单（frontendOpenOrders包含条件单的类型和触发价）
+func (t *HyperliquidTrader) GetOpenOrders(symbol string) ([]Order, error) {
 	coin := convertSymbolToHyperliquid(symbol)
 
 	// 获取所有未完成订单
-	allOrders, err := t.exchange.Info().OpenOrders(t.ctx, t.walletAddr)
+	allOrders, err := t.exchange.Info().FrontendOpenOrders(t.ctx, t.walletAddr)
 	if err != nil {
 		return nil, fmt.Errorf("获取未完成订单失败: %w", err)
 	}
 
 	// 过滤出指定币种的订单
-	result := make([]map[string]interface{}, 0)
+	result := make([]Order, 0)
 	for _, order := range allOrders {
 		if order.Coin != coin {
 			continue
 		}
 
-		orderMap := map[string]interface{}{
-			"orderId": order.Oid,
-			"symbol":  symbol,
-			"coin":    order.Coin,
-			"side":    order.Side,
-			"limitPx": order.LimitPx,
+		// Hyperliquid的side: "B"=买入, "A"=卖出
+		side := "SELL"
+		if order.Side == hyperliquid.OrderSideBid {
+			side = "BUY"
 		}
 
-		// Hyperliquid的触发单信息可能在Order.Trigger中
-		// 由于SDK结构不明确，我们先返回基本信息
-		// 触发价格需要通过其他方式获取或从订单详情中解析
-
-		result = append(result, orderMap)
+		result = append(result, Order{
+			OrderID:    order.Oid,
+			Symbol:     symbol,
+			Type:       hyperliquidOrderType(order.OrderType),
+			Side:       side,
+			Price:      order.LimitPx,
+			StopPrice:  order.TriggerPx,
+			Quantity:   order.Sz,
+			Status:     "NEW",
+			ReduceOnly: order.ReduceOnly,
+		})
 	}
 
 	return result, nil
 }
+
+// hyperliquidOrderType 转换为币安风格的订单类型
+func hyperliquidOrderType(orderType string) string {
+	switch orderType {
+	case "Stop Market":
+		return CloseOrderStopMarket
+	case "Stop Limit":
+		return CloseOrderStop
+	case "Take Profit Market":
+		return CloseOrderTakeProfitMarket
+	case "Take Profit Limit":
+		return CloseOrderTakeProfit
+	}
+	return "LIMIT"
+}
+
+// GetTradeHistory 获取成交记录（userFillsByTime，单次最多返回2000条）
+func (t *HyperliquidTrader) GetTradeHistory(symbol string, start, end time.Time) ([]TradeFill, error) {
+	raw, err := t.userFillsByTime(start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	fills := make([]TradeFill, 0, len(raw))
+	for _, f := range raw {
+		fill := parseHyperliquidTradeFill(f)
+		if symbol != "" && fill.Symbol != symbol {
+			continue
+		}
+		fills = append(fills, fill)
+	}
+	sortTradeFills(fills)
+	return fills, nil
+}
+
+// GetIncomeHistory 获取已实现盈亏、手续费和资金费流水
+// Hyperliquid没有统一的资金流水接口：已实现盈亏和手续费来自成交记录，资金费来自userFunding
+func (t *HyperliquidTrader) GetIncomeHistory(symbol string, start, end time.Time) ([]IncomeRecord, error) {
+	fills, err := t.GetTradeHistory(symbol, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]IncomeRecord, 0)
+	for _, fill := range fills {
+		if fill.RealizedPnL != 0 {
+			records = append(records, IncomeRecord{
+				Symbol: fill.Symbol, Type: IncomeRealizedPnL, Amount: fill.RealizedPnL, Asset: "USDC", Time: fill.Time,
+			})
+		}
+		if fill.Fee != 0 {
+			records = append(records, IncomeRecord{
+				Symbol: fill.Symbol, Type: IncomeCommission, Amount: -fill.Fee, Asset: fill.FeeAsset, Time: fill.Time,
+			})
+		}
+	}
+
+	fundings, err := t.userFunding(start, end)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range fundings {
+		if symbol != "" && f.Coin+"USDT" != symbol {
+			continue
+		}
+		amount, _ := strconv.ParseFloat(f.Usdc, 64)
+		records = append(records, IncomeRecord{
+			Symbol: f.Coin + "USDT", Type: IncomeFunding, Amount: amount, Asset: "USDC", Time: time.UnixMilli(f.Time),
+		})
+	}
+
+	sortIncome(records)
+	return records, nil
+}
+
+// userFillsByTime 分页获取时间范围内的全部成交
+func (t *HyperliquidTrader) userFillsByTime(start, end time.Time) ([]hyperliquidWsFill, error) {
+	const limit = 2000
+	var all []hyperliquidWsFill
+	from := start.UnixMilli()
+	for {
+		var page []hyperliquidWsFill
+		err := t.postInfo(map[string]interface{}{
+			"type":      "userFillsByTime",
+			"user":      t.walletAddr,
+			"startTime": from,
+			"endTime":   end.UnixMilli(),
+		}, &page)
+		if err != nil {
+			return nil, fmt.Errorf("获取成交记录失败: %w", err)
+		}
+		all = append(all, page...)
+		if len(page) < limit {
+			return all, nil
+		}
+		from = page[len(page)-1].Time + 1
+	}
+}
+
+// userFunding 分页获取时间范围内的资金费（单次最多返回500条）
+func (t *HyperliquidTrader) userFunding(start, end time.Time) ([]hyperliquidWsFunding, error) {
+	const limit = 500
+	var all []hyperliquidWsFunding
+	from := start.UnixMilli()
+	for {
+		var page []struct {
+			Time  int64                `json:"time"`
+			Delta hyperliquidWsFunding `json:"delta"`
+		}
+		err := t.postInfo(map[string]interface{}{
+			"type":      "userFunding",
+			"user":      t.walletAddr,
+			"startTime": from,
+			"endTime":   end.UnixMilli(),
+		}, &page)
+		if err != nil {
+			return nil, fmt.Errorf("获取资金费记录失败: %w", err)
+		}
+		for _, item := range page {
+			funding := item.Delta
+			funding.Time = item.Time
+			all = append(all, funding)
+		}
+		if len(page) < limit {
+			return all, nil
+		}
+		from = page[len(page)-1].Time + 1
+	}
+}
+
+// hyperliquidGroupedOrderAction 带分组的下单操作（SDK的BulkOrders固定使用grouping=na）
+// 字段顺序与SDK的OrderAction一致，签名按msgpack编码计算哈希
+type hyperliquidGroupedOrderAction struct {
+	Type     string                        `json:"type"     msgpack:"type"`
+	Orders   []hyperliquidTriggerOrderWire `json:"orders"   msgpack:"orders"`
+	Grouping string                        `json:"grouping" msgpack:"grouping"`
+}
+
+// hyperliquidTriggerOrderWire 条件单的接口格式（字段顺序与SDK的OrderWire一致）
+type hyperliquidTriggerOrderWire struct {
+	Asset      int    `json:"a" msgpack:"a"`
+	IsBuy      bool   `json:"b" msgpack:"b"`
+	LimitPx    string `json:"p" msgpack:"p"`
+	Size       string `json:"s" msgpack:"s"`
+	ReduceOnly bool   `json:"r" msgpack:"r"`
+	OrderType  struct {
+		Trigger struct {
+			IsMarket  bool   `json:"isMarket"  msgpack:"isMarket"`
+			TriggerPx string `json:"triggerPx" msgpack:"triggerPx"`
+			Tpsl      string `json:"tpsl"      msgpack:"tpsl"`
+		} `json:"trigger" msgpack:"trigger"`
+	} `json:"t" msgpack:"t"`
+}
+
+// newHyperliquidTriggerWire 只减仓的市价触发单
+func newHyperliquidTriggerWire(asset int, isBuy bool, size, triggerPx float64, tpsl string) hyperliquidTriggerOrderWire {
+	wire := hyperliquidTriggerOrderWire{
+		Asset:      asset,
+		IsBuy:      isBuy,
+		LimitPx:    hyperliquidFloatWire(triggerPx),
+		Size:       hyperliquidFloatWire(size),
+		ReduceOnly: true,
+	}
+	wire.OrderType.Trigger.IsMarket = true
+	wire.OrderType.Trigger.TriggerPx = hyperliquidFloatWire(triggerPx)
+	wire.OrderType.Trigger.Tpsl = tpsl
+	return wire
+}
+
+// hyperliquidFloatWire 数值的接口格式（最多8位小数，去掉末尾的0，与SDK一致）
+func hyperliquidFloatWire(x float64) string {
+	s := strconv.FormatFloat(x, 'f', 8, 64)
+	s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	if s == "-0" {
+		return "0"
+	}
+	return s
+}
+
+// postOrderAction 签名并提交下单操作，返回每个订单的状态
+func (t *HyperliquidTrader) postOrderAction(action hyperliquidGroupedOrderAction) ([]hyperliquid.OrderStatus, error) {
+	// nonce按毫秒递增，并同步给SDK使其之后的nonce大于本次
+	nonce := time.Now().UnixMilli()
+	t.nonceMu.Lock()
+	if nonce <= t.lastNonce {
+		nonce = t.lastNonce + 1
+	}
+	t.lastNonce = nonce
+	t.nonceMu.Unlock()
+	t.exchange.SetLastNonce(nonce)
+
+	signature, err := hyperliquid.SignL1Action(t.privateKey, action, "", nonce, nil, t.apiURL == hyperliquid.MainnetAPIURL)
+	if err != nil {
+		return nil, fmt.Errorf("签名失败: %w", err)
+	}
+	payload, err := json.Marshal(map[string]interface{}{
+		"action":    action,
+		"nonce":     nonce,
+		"signature": signature,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Post(t.apiURL+"/exchange", "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(body))
+	}
+
+	var result hyperliquid.APIResponse[hyperliquid.OrderResponse]
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, err
+	}
+	if !result.Ok {
+		return nil, fmt.Errorf("%s", result.Err)
+	}
+	return result.Data.Statuses, nil
+}
+
+// postInfo 直接调用/info接口（SDK的部分返回结构缺少字段）
+func (t *HyperliquidTrader) postInfo(request interface{}, result interface{}) error {
+	payload, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Post(t.apiURL+"/info", "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(body))
+	}
+	return json.Unmarshal(body, result)
+}
+
+// parseHyperliquidTradeFill 转换Hyperliquid成交记录
+func parseHyperliquidTradeFill(f hyperliquidWsFill) TradeFill {
+	price, _ := strconv.ParseFloat(f.Px, 64)
+	size, _ := strconv.ParseFloat(f.Sz, 64)
+	pnl, _ := strconv.ParseFloat(f.ClosedPnl, 64)
+	fee, _ := strconv.ParseFloat(f.Fee, 64)
+	start, _ := strconv.ParseFloat(f.StartPosition, 64)
+
+	fill := TradeFill{
+		Symbol:      f.Coin + "USDT",
+		TradeID:     f.Tid,
+		OrderID:     f.Oid,
+		Side:        "BUY",
+		Price:       price,
+		Quantity:    size,
+		RealizedPnL: pnl,
+		Fee:         fee,
+		FeeAsset:    f.FeeToken,
+		Time:        time.UnixMilli(f.Time),
+	}
+	if f.Side == "A" {
+		fill.Side = "SELL"
+	}
+
+	// 仓位方向：减仓成交属于原仓位方向，否则按买卖方向
+	switch {
+	case start > 0 && f.Side == "A":
+		fill.PositionSide = "long"
+	case start < 0 && f.Side == "B":
+		fill.PositionSide = "short"
+	case f.Side == "A":
+		fill.PositionSide = "short"
+	default:
+		fill.PositionSide = "long"
+	}
+	return fill
+}
@@ -0,0 +1,76 @@
+package trader
+
+import (
+	"nofx/trader/fakeexchange"
+	"testing"
+)
+
+// newFakeHyperliquid 连接本地模拟Hyperliquid服务的交易器（BTC szDecimals=5，ETH szDecimals=4 价格3000）
+func newFakeHyperliquid(t *testing.T) (*fakeexchange.HyperliquidServer, *HyperliquidTrader) {
+	ledger := fakeexchange.NewLedger(2000, 0.00035)
+	ledger.AddSymbol(fakeexchange.SymbolSpec{Symbol: "BTCUSDT", StepSize: 0.00001, TickSize: 1}, 60000)
+	ledger.AddSymbol(fakeexchange.SymbolSpec{Symbol: "ETHUSDT", StepSize: 0.0001, TickSize: 0.1}, 3000)
+
+	server := fakeexchange.NewHyperliquid(ledger)
+	t.Cleanup(server.Close)
+
+	trader, err := NewHyperliquidTraderWithURL(testPrivateKey, "0x2c7536E3605D9C16a7a3D7b1898e529396a65c23", server.URL, "ws://127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("创建Hyperliquid交易器失败: %v", err)
+	}
+	return server, trader
+}
+
+func TestHyperliquidShortWithTakeProfit(t *testing.T) {
+	server, trader := newFakeHyperliquid(t)
+	ledger := server.Ledger
+
+	// 数量按szDecimals四舍五入，IOC限价单按市价成交
+	result, err := trader.OpenShort("ETHUSDT", 0.123456, 5)
+	if err != nil {
+		t.Fatalf("开空仓失败: %v", err)
+	}
+	if !floatEq(result.ExecutedQty, 0.1235) || !floatEq(result.AvgPrice, 3000) || !floatEq(result.Fee, 0.1235*3000*0.00035) {
+		t.Errorf("成交结果错误: %+v", result)
+	}
+	// 默认逐仓，杠杆随开仓设置
+	if server.IsCross("ETH") {
+		t.Error("默认应为逐仓")
+	}
+	positions, err := trader.GetPositions()
+	if err != nil || len(positions) != 1 {
+		t.Fatalf("持仓错误: %+v, %v", positions, err)
+	}
+	if pos := positions[0]; pos.Symbol != "ETHUSDT" || pos.Side != "short" || !floatEq(pos.PositionAmt, 0.1235) || pos.Leverage != 5 {
+		t.Errorf("持仓内容错误: %+v", pos)
+	}
+
+	// 触发价按5位有效数字处理
+	if err := trader.SetStopLoss("ETHUSDT", "SHORT", 0.1235, 3123.456); err != nil {
+		t.Fatalf("设置止损失败: %v", err)
+	}
+	if err := trader.SetTakeProfit("ETHUSDT", "SHORT", 0.1235, 2800); err != nil {
+		t.Fatalf("设置止盈失败: %v", err)
+	}
+	orders := ledger.OpenOrders("ETHUSDT")
+	if len(orders) != 2 || !floatEq(orders[0].StopPrice, 3123.5) || orders[1].Type != fakeexchange.OrderTypeTakeProfit {
+		t.Fatalf("止损止盈挂单错误: %+v", orders)
+	}
+	if open, err := trader.GetOpenOrders("ETHUSDT"); err != nil || len(open) != 2 {
+		t.Fatalf("GetOpenOrders应返回2个挂单: %+v, %v", open, err)
+	}
+
+	// 价格跌破止盈价，空仓平掉
+	ledger.SetPrice("ETHUSDT", 2790)
+	if positions, _ := trader.GetPositions(); len(positions) != 0 {
+		t.Fatalf("止盈触发后应无持仓: %+v", positions)
+	}
+	balance, err := trader.GetBalance()
+	if err != nil {
+		t.Fatalf("GetBalance失败: %v", err)
+	}
+	want := 2000 - 0.1235*3000*0.00035 - 0.1235*2790*0.00035 + 0.1235*(3000-2790)
+	if !floatEq(balance.TotalWalletBalance, want) {
+		t.Errorf("钱包余额 %.6f, 期望 %.6f", balance.TotalWalletBalance, want)
+	}
+}
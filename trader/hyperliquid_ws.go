@@ -0,0 +1,517 @@
+package trader
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	hyperliquidMainnetWsURL = "wss://api.hyperliquid.xyz/ws"
+	hyperliquidTestnetWsURL = "wss://api.hyperliquid-testnet.xyz/ws"
+
+	// 服务端60秒无消息会断开连接，定时发送ping
+	hyperliquidPingInterval = 30 * time.Second
+	// 断线后重连间隔
+	hyperliquidReconnectDelay = 5 * time.Second
+)
+
+// hyperliquidSubscriptions 订阅的用户频道
+var hyperliquidSubscriptions = []string{"userFills", "orderUpdates", "userFundings"}
+
+// hyperliquidStream Hyperliquid用户数据websocket（成交、订单状态、资金费）
+// 断线后自动重连并重新订阅；重新订阅返回的快照中，断线期间的成交会补发
+type hyperliquidStream struct {
+	url            string
+	user           string
+	pingInterval   time.Duration
+	reconnectDelay time.Duration
+	publish        func(TradeEvent)
+	triggerType    func(oid int64) string // 条件单ID对应的平仓订单类型，未知返回""
+
+	mu           sync.Mutex
+	closeFills   []CloseFill     // 待取走的平仓成交
+	seenFills    map[int64]int64 // 已处理的成交ID -> 成交时间（毫秒），用于快照去重
+	lastFillTime int64           // 已处理的最新成交时间（毫秒）
+	fillsSynced  bool            // 是否已收到过首个成交快照
+
+	writeMu sync.Mutex
+	stopC   chan struct{}
+	doneC   chan struct{}
+}
+
+// hyperliquidWsMessage 推送消息
+type hyperliquidWsMessage struct {
+	Channel string          `json:"channel"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// hyperliquidWsFill userFills频道中的成交
+type hyperliquidWsFill struct {
+	Coin          string          `json:"coin"`
+	Px            string          `json:"px"`
+	Sz            string          `json:"sz"`
+	Side          string          `json:"side"` // "B"=买入, "A"=卖出
+	Time          int64           `json:"time"`
+	StartPosition string          `json:"startPosition"`
+	Dir           string          `json:"dir"` // Open Long, Close Long, Open Short, Close Short, Long > Short ...
+	ClosedPnl     string          `json:"closedPnl"`
+	Oid           int64           `json:"oid"`
+	Tid           int64           `json:"tid"`
+	Fee           string          `json:"fee"`
+	FeeToken      string          `json:"feeToken"`
+	Liquidation   json.RawMessage `json:"liquidation,omitempty"`
+}
+
+// hyperliquidWsOrder orderUpdates频道中的订单
+type hyperliquidWsOrder struct {
+	Order struct {
+		Coin      string `json:"coin"`
+		Side      string `json:"side"`
+		LimitPx   string `json:"limitPx"`
+		Sz        string `json:"sz"`
+		Oid       int64  `json:"oid"`
+		Timestamp int64  `json:"timestamp"`
+		OrigSz    string `json:"origSz"`
+	} `json:"order"`
+	Status          string `json:"status"`
+	StatusTimestamp int64  `json:"statusTimestamp"`
+}
+
+// hyperliquidWsFunding userFundings频道中的资金费
+type hyperliquidWsFunding struct {
+	Time        int64  `json:"time"`
+	Coin        string `json:"coin"`
+	Usdc        string `json:"usdc"`
+	Szi         string `json:"szi"`
+	FundingRate string `json:"fundingRate"`
+}
+
+// StartUserDataStream 启动websocket推送（实现CloseFillStreamer）
+func (t *HyperliquidTrader) StartUserDataStream() error {
+	t.streamMu.Lock()
+	defer t.streamMu.Unlock()
+
+	if t.stream != nil {
+		return nil
+	}
+
+	// 加载已有的条件单，识别重启前设置的止损止盈
+	t.loadTriggerOrders()
+
+	stream := &hyperliquidStream{
+		url:            t.wsURL,
+		user:           strings.ToLower(t.walletAddr),
+		pingInterval:   hyperliquidPingInterval,
+		reconnectDelay: hyperliquidReconnectDelay,
+		publish:        t.publish,
+		triggerType:    t.triggerOrderType,
+		seenFills:      make(map[int64]int64),
+	}
+	if err := stream.start(); err != nil {
+		return err
+	}
+	t.stream = stream
+	return nil
+}
+
+// StopUserDataStream 停止websocket推送
+func (t *HyperliquidTrader) StopUserDataStream() {
+	t.streamMu.Lock()
+	stream := t.stream
+	t.stream = nil
+	t.streamMu.Unlock()
+
+	if stream != nil {
+		stream.stop()
+	}
+}
+
+// DrainCloseFills 取出上次调用以来收到的平仓成交
+func (t *HyperliquidTrader) DrainCloseFills() []CloseFill {
+	t.streamMu.Lock()
+	stream := t.stream
+	t.streamMu.Unlock()
+
+	if stream == nil {
+		return nil
+	}
+	return stream.drain()
+}
+
+// rememberTriggerOrder 记录条件单类型（成交推送中据此区分止损和止盈）
+func (t *HyperliquidTrader) rememberTriggerOrder(oid int64, orderType string) {
+	t.triggerMu.Lock()
+	defer t.triggerMu.Unlock()
+
+	if t.triggerOrders == nil {
+		t.triggerOrders = make(map[int64]string)
+	}
+	t.triggerOrders[oid] = orderType
+}
+
+// triggerOrderType 条件单ID对应的平仓订单类型，非条件单返回""
+func (t *HyperliquidTrader) triggerOrderType(oid int64) string {
+	t.triggerMu.Lock()
+	defer t.triggerMu.Unlock()
+	return t.triggerOrders[oid]
+}
+
+// loadTriggerOrders 从当前挂单中加载条件单类型
+func (t *HyperliquidTrader) loadTriggerOrders() {
+	if t.exchange == nil {
+		return
+	}
+	orders, err := t.exchange.Info().FrontendOpenOrders(t.ctx, t.walletAddr)
+	if err != nil {
+		log.Printf("⚠️ 获取Hyperliquid条件单失败: %v", err)
+		return
+	}
+	for _, order := range orders {
+		if !order.IsTrigger {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(order.OrderType, "Stop"):
+			t.rememberTriggerOrder(order.Oid, CloseOrderStopMarket)
+		case strings.HasPrefix(order.OrderType, "Take Profit"):
+			t.rememberTriggerOrder(order.Oid, CloseOrderTakeProfitMarket)
+		}
+	}
+}
+
+// start 建立首个连接（失败直接返回错误），之后在后台维持连接
+func (s *hyperliquidStream) start() error {
+	conn, err := s.connect()
+	if err != nil {
+		return err
+	}
+
+	s.stopC = make(chan struct{})
+	s.doneC = make(chan struct{})
+	go s.run(conn)
+
+	log.Printf("📡 Hyperliquid用户数据流已连接")
+	return nil
+}
+
+// stop 关闭连接并等待后台goroutine退出
+func (s *hyperliquidStream) stop() {
+	close(s.stopC)
+	<-s.doneC
+	log.Printf("📡 Hyperliquid用户数据流已关闭")
+}
+
+// connect 建立连接并订阅用户频道
+func (s *hyperliquidStream) connect() (*websocket.Conn, error) {
+	conn, _, err := websocket.DefaultDialer.Dial(s.url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("连接Hyperliquid websocket失败: %w", err)
+	}
+
+	for _, channel := range hyperliquidSubscriptions {
+		sub := map[string]interface{}{
+			"method":       "subscribe",
+			"subscription": map[string]string{"type": channel, "user": s.user},
+		}
+		if err := s.write(conn, sub); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("订阅%s失败: %w", channel, err)
+		}
+	}
+	return conn, nil
+}
+
+// write 发送JSON消息（gorilla/websocket不支持并发写）
+func (s *hyperliquidStream) write(conn *websocket.Conn, v interface{}) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	return conn.WriteJSON(v)
+}
+
+// run 读取推送，断线后自动重连并重新订阅
+func (s *hyperliquidStream) run(conn *websocket.Conn) {
+	defer close(s.doneC)
+
+	for {
+		err := s.serve(conn)
+
+		select {
+		case <-s.stopC:
+			return
+		default:
+		}
+		log.Printf("⚠️ Hyperliquid用户数据流断开: %v，%v后重连", err, s.reconnectDelay)
+
+		for {
+			select {
+			case <-s.stopC:
+				return
+			case <-time.After(s.reconnectDelay):
+			}
+
+			conn, err = s.connect()
+			if err == nil {
+				log.Printf("📡 Hyperliquid用户数据流已重连并重新订阅")
+				break
+			}
+			log.Printf("⚠️ Hyperliquid用户数据流重连失败: %v", err)
+		}
+	}
+}
+
+// serve 处理单个连接直到断开，期间定时发送ping
+func (s *hyperliquidStream) serve(conn *websocket.Conn) error {
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		ticker := time.NewTicker(s.pingInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-s.stopC:
+				// 关闭连接以中断ReadMessage
+				conn.Close()
+				return
+			case <-ticker.C:
+				if err := s.write(conn, map[string]string{"method": "ping"}); err != nil {
+					conn.Close()
+					return
+				}
+			}
+		}
+	}()
+	defer conn.Close()
+
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+		s.handleMessage(message)
+	}
+}
+
+// handleMessage 分发一条推送
+func (s *hyperliquidStream) handleMessage(message []byte) {
+	var msg hyperliquidWsMessage
+	if err := json.Unmarshal(message, &msg); err != nil {
+		log.Printf("⚠️ 解析Hyperliquid推送失败: %v", err)
+		return
+	}
+
+	switch msg.Channel {
+	case "userFills":
+		var data struct {
+			IsSnapshot bool                `json:"isSnapshot"`
+			Fills      []hyperliquidWsFill `json:"fills"`
+		}
+		if err := json.Unmarshal(msg.Data, &data); err == nil {
+			s.handleFills(data.Fills, data.IsSnapshot)
+		}
+	case "orderUpdates":
+		var orders []hyperliquidWsOrder
+		if err := json.Unmarshal(msg.Data, &orders); err == nil {
+			for _, o := range orders {
+				s.publish(TradeEvent{Type: TradeEventOrderUpdate, Order: parseHyperliquidWsOrder(o)})
+			}
+		}
+	case "userFundings":
+		var data struct {
+			IsSnapshot bool                   `json:"isSnapshot"`
+			Fundings   []hyperliquidWsFunding `json:"fundings"`
+		}
+		if err := json.Unmarshal(msg.Data, &data); err == nil {
+			s.handleFundings(data.Fundings, data.IsSnapshot)
+		}
+	case "error":
+		log.Printf("⚠️ Hyperliquid推送错误: %s", string(msg.Data))
+	}
+}
+
+// handleFills 处理成交推送
+// 首个快照是历史成交，只用于记录位置；重连后的快照只补发断线期间（晚于已处理成交）的部分
+func (s *hyperliquidStream) handleFills(fills []hyperliquidWsFill, isSnapshot bool) {
+	s.mu.Lock()
+	initial := isSnapshot && !s.fillsSynced
+	if isSnapshot {
+		s.fillsSynced = true
+	}
+
+	var events []*FillEvent
+	for _, f := range fills {
+		if _, seen := s.seenFills[f.Tid]; seen {
+			continue
+		}
+		if isSnapshot && (initial || f.Time < s.lastFillTime) {
+			s.markSeenLocked(f)
+			continue
+		}
+		s.markSeenLocked(f)
+
+		event := s.parseFill(f)
+		if event.IsClose {
+			s.closeFills = append(s.closeFills, CloseFill{
+				Symbol:      event.Symbol,
+				Side:        event.Side,
+				OrderID:     event.OrderID,
+				OrderType:   event.OrderType,
+				Quantity:    event.Quantity,
+				Price:       event.Price,
+				RealizedPnL: event.ClosedPnL,
+				Fee:         event.Fee,
+				FeeAsset:    event.FeeAsset,
+				Time:        event.Time,
+			})
+		}
+		events = append(events, event)
+	}
+	s.pruneSeenLocked()
+	s.mu.Unlock()
+
+	for _, event := range events {
+		s.publish(TradeEvent{Type: TradeEventFill, Fill: event})
+	}
+}
+
+// markSeenLocked 记录已处理的成交（调用方需持有锁）
+func (s *hyperliquidStream) markSeenLocked(f hyperliquidWsFill) {
+	s.seenFills[f.Tid] = f.Time
+	if f.Time > s.lastFillTime {
+		s.lastFillTime = f.Time
+	}
+}
+
+// pruneSeenLocked 清理一小时前的成交ID（调用方需持有锁）
+func (s *hyperliquidStream) pruneSeenLocked() {
+	cutoff := s.lastFillTime - time.Hour.Milliseconds()
+	for tid, ts := range s.seenFills {
+		if ts < cutoff {
+			delete(s.seenFills, tid)
+		}
+	}
+}
+
+// handleFundings 处理资金费推送（快照为历史记录，不发布）
+func (s *hyperliquidStream) handleFundings(fundings []hyperliquidWsFunding, isSnapshot bool) {
+	if isSnapshot {
+		return
+	}
+	for _, f := range fundings {
+		amount, _ := strconv.ParseFloat(f.Usdc, 64)
+		szi, _ := strconv.ParseFloat(f.Szi, 64)
+		rate, _ := strconv.ParseFloat(f.FundingRate, 64)
+		side := "long"
+		if szi < 0 {
+			side = "short"
+		}
+		s.publish(TradeEvent{Type: TradeEventFunding, Funding: &FundingEvent{
+			Symbol:       f.Coin + "USDT",
+			Side:         side,
+			Amount:       amount,
+			PositionSize: math.Abs(szi),
+			FundingRate:  rate,
+			Time:         time.UnixMilli(f.Time),
+		}})
+	}
+}
+
+// parseFill 转换为统一的成交事件
+func (s *hyperliquidStream) parseFill(f hyperliquidWsFill) *FillEvent {
+	price, _ := strconv.ParseFloat(f.Px, 64)
+	size, _ := strconv.ParseFloat(f.Sz, 64)
+	pnl, _ := strconv.ParseFloat(f.ClosedPnl, 64)
+	fee, _ := strconv.ParseFloat(f.Fee, 64)
+	start, _ := strconv.ParseFloat(f.StartPosition, 64)
+
+	event := &FillEvent{
+		Symbol:    f.Coin + "USDT",
+		OrderID:   f.Oid,
+		Quantity:  size,
+		Price:     price,
+		ClosedPnL: pnl,
+		Fee:       fee,
+		FeeAsset:  f.FeeToken,
+		Time:      time.UnixMilli(f.Time),
+	}
+
+	// 成交后的带符号仓位（多为正，空为负）
+	after := start + size
+	if f.Side == "A" {
+		after = start - size
+	}
+
+	// 仓位方向：反手（Long > Short）时视为平掉原方向的仓位
+	switch {
+	case start > 0 && f.Side == "A", start < 0 && f.Side == "B":
+		event.IsClose = true
+		event.Side = "long"
+		if start < 0 {
+			event.Side = "short"
+		}
+		if after*start > 0 {
+			event.PositionAfter = math.Abs(after)
+		}
+	default:
+		event.Side = "long"
+		if f.Side == "A" {
+			event.Side = "short"
+		}
+		event.PositionAfter = math.Abs(after)
+	}
+
+	if event.IsClose {
+		switch {
+		case len(f.Liquidation) > 0 && string(f.Liquidation) != "null":
+			event.OrderType = CloseOrderLiquidation
+		case s.triggerType != nil && s.triggerType(f.Oid) != "":
+			event.OrderType = s.triggerType(f.Oid)
+		default:
+			event.OrderType = "MARKET"
+		}
+	}
+	return event
+}
+
+// parseHyperliquidWsOrder 转换为统一的订单状态事件
+func parseHyperliquidWsOrder(o hyperliquidWsOrder) *OrderUpdateEvent {
+	price, _ := strconv.ParseFloat(o.Order.LimitPx, 64)
+	remaining, _ := strconv.ParseFloat(o.Order.Sz, 64)
+	orig, _ := strconv.ParseFloat(o.Order.OrigSz, 64)
+
+	side := "SELL"
+	if o.Order.Side == "B" {
+		side = "BUY"
+	}
+	return &OrderUpdateEvent{
+		Symbol:       o.Order.Coin + "USDT",
+		OrderID:      o.Order.Oid,
+		Side:         side,
+		Price:        price,
+		Quantity:     remaining,
+		OrigQuantity: orig,
+		Status:       hyperliquidOrderStatus(o.Status, orig-remaining),
+		RawStatus:    o.Status,
+		Time:         time.UnixMilli(o.StatusTimestamp),
+	}
+}
+
+// drain 取出待处理的平仓成交
+func (s *hyperliquidStream) drain() []CloseFill {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fills := s.closeFills
+	s.closeFills = nil
+	return fills
+}
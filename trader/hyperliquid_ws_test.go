@@ -0,0 +1,231 @@
+package trader
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"nofx/logger"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// fakeHyperliquidWs 本地模拟的Hyperliquid websocket
+type fakeHyperliquidWs struct {
+	t *testing.T
+
+	mu            sync.Mutex
+	subscriptions []string // 收到的订阅频道（按顺序）
+	conns         []*websocket.Conn
+	connected     chan *websocket.Conn
+}
+
+func newFakeHyperliquidWs(t *testing.T) (*fakeHyperliquidWs, string) {
+	f := &fakeHyperliquidWs{t: t, connected: make(chan *websocket.Conn, 4)}
+	server := httptest.NewServer(http.HandlerFunc(f.handle))
+	t.Cleanup(server.Close)
+	return f, "ws" + strings.TrimPrefix(server.URL, "http")
+}
+
+func (f *fakeHyperliquidWs) handle(w http.ResponseWriter, r *http.Request) {
+	upgrader := websocket.Upgrader{}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		f.t.Errorf("websocket升级失败: %v", err)
+		return
+	}
+	f.mu.Lock()
+	f.conns = append(f.conns, conn)
+	f.mu.Unlock()
+
+	// 读取三个订阅请求后通知测试
+	for i := 0; i < len(hyperliquidSubscriptions); i++ {
+		var req struct {
+			Method       string            `json:"method"`
+			Subscription map[string]string `json:"subscription"`
+		}
+		if err := conn.ReadJSON(&req); err != nil {
+			return
+		}
+		if req.Method != "subscribe" || req.Subscription["user"] != "0xabc" {
+			f.t.Errorf("订阅请求错误: %+v", req)
+		}
+		f.mu.Lock()
+		f.subscriptions = append(f.subscriptions, req.Subscription["type"])
+		f.mu.Unlock()
+	}
+	f.connected <- conn
+}
+
+func (f *fakeHyperliquidWs) waitConnected() *websocket.Conn {
+	select {
+	case conn := <-f.connected:
+		return conn
+	case <-time.After(5 * time.Second):
+		f.t.Fatal("等待websocket订阅超时")
+		return nil
+	}
+}
+
+func pushHyperliquid(t *testing.T, conn *websocket.Conn, channel string, data interface{}) {
+	raw, _ := json.Marshal(data)
+	if err := conn.WriteJSON(map[string]interface{}{"channel": channel, "data": json.RawMessage(raw)}); err != nil {
+		t.Fatalf("推送失败: %v", err)
+	}
+}
+
+func hyperliquidFill(tid, oid, ts int64, side, start, sz, px, pnl string) map[string]interface{} {
+	return map[string]interface{}{
+		"coin": "BTC", "px": px, "sz": sz, "side": side, "time": ts, "startPosition": start,
+		"closedPnl": pnl, "oid": oid, "tid": tid, "fee": "0.5", "feeToken": "USDC",
+	}
+}
+
+// eventRecorder 收集发布的事件
+type eventRecorder struct {
+	mu     sync.Mutex
+	events []TradeEvent
+}
+
+func (r *eventRecorder) handle(event TradeEvent) {
+	r.mu.Lock()
+	r.events = append(r.events, event)
+	r.mu.Unlock()
+}
+
+func (r *eventRecorder) waitFor(t *testing.T, n int) []TradeEvent {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		r.mu.Lock()
+		if len(r.events) >= n {
+			events := append([]TradeEvent(nil), r.events...)
+			r.mu.Unlock()
+			return events
+		}
+		r.mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t.Fatalf("应收到%d个事件，实际 %d: %+v", n, len(r.events), r.events)
+	return nil
+}
+
+func TestHyperliquidStreamPublishesEventsAndResubscribes(t *testing.T) {
+	fake, wsURL := newFakeHyperliquidWs(t)
+
+	trader := &HyperliquidTrader{walletAddr: "0xABC", wsURL: wsURL}
+	trader.rememberTriggerOrder(501, CloseOrderStopMarket)
+	recorder := &eventRecorder{}
+	unsubscribe := trader.SubscribeTradeEvents(recorder.handle)
+	defer unsubscribe()
+
+	if err := trader.StartUserDataStream(); err != nil {
+		t.Fatalf("StartUserDataStream失败: %v", err)
+	}
+	defer trader.StopUserDataStream()
+	trader.stream.reconnectDelay = 10 * time.Millisecond
+	conn := fake.waitConnected()
+
+	// 首个快照是历史成交，不应发布
+	pushHyperliquid(t, conn, "userFills", map[string]interface{}{
+		"isSnapshot": true,
+		"fills":      []interface{}{hyperliquidFill(1, 400, 1000, "B", "0", "0.02", "60000", "0")},
+	})
+	// 止损单触发：多仓0.02全部卖出
+	pushHyperliquid(t, conn, "userFills", map[string]interface{}{
+		"fills": []interface{}{hyperliquidFill(2, 501, 2000, "A", "0.02", "0.02", "58000", "-40")},
+	})
+	pushHyperliquid(t, conn, "orderUpdates", []interface{}{map[string]interface{}{
+		"order":  map[string]interface{}{"coin": "BTC", "side": "A", "limitPx": "58000", "sz": "0", "oid": 501, "origSz": "0.02"},
+		"status": "filled", "statusTimestamp": 2000,
+	}})
+	pushHyperliquid(t, conn, "userFundings", map[string]interface{}{
+		"fundings": []interface{}{map[string]interface{}{"time": 3000, "coin": "ETH", "usdc": "-1.25", "szi": "-2", "fundingRate": "0.0001"}},
+	})
+
+	events := recorder.waitFor(t, 3)
+	fill := events[0].Fill
+	if events[0].Type != TradeEventFill || fill == nil {
+		t.Fatalf("第一个事件应为成交: %+v", events[0])
+	}
+	if fill.Symbol != "BTCUSDT" || fill.Side != "long" || !fill.IsClose || fill.OrderType != CloseOrderStopMarket ||
+		fill.PositionAfter != 0 || fill.ClosedPnL != -40 || fill.Price != 58000 || fill.FeeAsset != "USDC" {
+		t.Errorf("止损成交解析错误: %+v", fill)
+	}
+	if order := events[1].Order; order == nil || order.OrderID != 501 || order.Status != OrderStatusFilled || order.Side != "SELL" {
+		t.Errorf("订单状态解析错误: %+v", events[1])
+	}
+	if funding := events[2].Funding; funding == nil || funding.Symbol != "ETHUSDT" || funding.Side != "short" ||
+		funding.Amount != -1.25 || funding.PositionSize != 2 {
+		t.Errorf("资金费解析错误: %+v", events[2])
+	}
+
+	closeFills := trader.DrainCloseFills()
+	if len(closeFills) != 1 || closeFills[0].Key() != "BTCUSDT_long" || closeFills[0].OrderType != CloseOrderStopMarket {
+		t.Errorf("平仓成交错误: %+v", closeFills)
+	}
+
+	// 断线后应重连并重新订阅；快照中只补发断线期间的新成交
+	conn.Close()
+	conn = fake.waitConnected()
+	pushHyperliquid(t, conn, "userFills", map[string]interface{}{
+		"isSnapshot": true,
+		"fills": []interface{}{
+			hyperliquidFill(1, 400, 1000, "B", "0", "0.02", "60000", "0"),
+			hyperliquidFill(2, 501, 2000, "A", "0.02", "0.02", "58000", "-40"),
+			hyperliquidFill(3, 600, 4000, "B", "0", "0.01", "59000", "0"),
+		},
+	})
+
+	events = recorder.waitFor(t, 4)
+	if fill := events[3].Fill; fill == nil || fill.OrderID != 600 || fill.IsClose || fill.Side != "long" || fill.PositionAfter != 0.01 {
+		t.Errorf("应补发断线期间的开仓成交: %+v", events[3])
+	}
+
+	fake.mu.Lock()
+	subs := strings.Join(fake.subscriptions, ",")
+	fake.mu.Unlock()
+	if subs != "userFills,orderUpdates,userFundings,userFills,orderUpdates,userFundings" {
+		t.Errorf("重连后应重新订阅全部频道: %s", subs)
+	}
+}
+
+func TestAutoTraderRecordsRealtimeCloseOnce(t *testing.T) {
+	dir := t.TempDir()
+	st := &streamingTrader{price: 60000}
+	at := &AutoTrader{
+		trader:                st,
+		decisionLogger:        logger.NewDecisionLogger(dir),
+		lastPositionSnapshot:  make(map[string]*PositionSnapshot),
+		positionFirstSeenTime: make(map[string]int64),
+		positionPnLTracking:   make(map[string]*PnLTracking),
+		realtimeClosed:        make(map[string]bool),
+	}
+	at.lastPositionSnapshot["BTCUSDT_long"] = &PositionSnapshot{Symbol: "BTCUSDT", Side: "long", Quantity: 0.02, EntryPrice: 60000}
+
+	at.handleTradeEvent(TradeEvent{Type: TradeEventFill, Fill: &FillEvent{
+		Symbol: "BTCUSDT", Side: "long", OrderID: 501, OrderType: CloseOrderTakeProfitMarket, IsClose: true,
+		Quantity: 0.02, Price: 66000, ClosedPnL: 120, Time: time.Now(),
+	}})
+
+	records, err := at.decisionLogger.GetLatestRecords(10)
+	if err != nil || len(records) != 1 {
+		t.Fatalf("应立即写入1条实时记录: %v, %d", err, len(records))
+	}
+	if !records[0].Realtime || len(records[0].Decisions) != 1 || records[0].Decisions[0].Action != "close_long_tp" ||
+		records[0].Decisions[0].Price != 66000 {
+		t.Errorf("实时平仓记录错误: %+v", records[0])
+	}
+
+	// 下个周期检测到仓位消失时不应重复记录
+	if closed := at.detectClosedPositions(); len(closed) != 0 {
+		t.Errorf("已实时记录的平仓不应重复记录: %+v", closed)
+	}
+	if len(at.lastPositionSnapshot) != 0 {
+		t.Errorf("平仓后应清理快照: %v", at.lastPositionSnapshot)
+	}
+}
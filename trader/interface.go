@@ -1,25 +1,40 @@
 package trader
 
+import "time"
+
 // Trader 交易器统一接口
 // 支持多个交易平台（币安、Hyperliquid等）
 type Trader interface {
 	// GetBalance 获取账户余额
-	GetBalance() (map[string]interface{}, error)
+	GetBalance() (*Balance, error)
 
 	// GetPositions 获取所有持仓
-	GetPositions() ([]map[string]interface{}, error)
+	GetPositions() ([]Position, error)
 
 	// OpenLong 开多仓
-	OpenLong(symbol string, quantity float64, leverage int) (map[string]interface{}, error)
+	OpenLong(symbol string, quantity float64, leverage int) (*OrderResult, error)
 
 	// OpenShort 开空仓
-	OpenShort(symbol string, quantity float64, leverage int) (map[string]interface{}, error)
+	OpenShort(symbol string, quantity float64, leverage int) (*OrderResult, error)
+
+	// OpenLongLimit 限价开多（price为限价，tif为有效方式）
+	// 返回的订单可能仍在挂单中，需通过GetOrder查询成交情况
+	OpenLongLimit(symbol string, quantity, price float64, leverage int, tif TimeInForce) (*OrderResult, error)
+
+	// OpenShortLimit 限价开空（price为限价，tif为有效方式）
+	OpenShortLimit(symbol string, quantity, price float64, leverage int, tif TimeInForce) (*OrderResult, error)
+
+	// GetOrder 查询订单状态和成交情况
+	GetOrder(symbol string, orderID int64) (*OrderResult, error)
+
+	// CancelOrder 取消指定订单
+	CancelOrder(symbol string, orderID int64) error
 
 	// CloseLong 平多仓（quantity=0表示全部平仓）
-	CloseLong(symbol string, quantity float64) (map[string]interface{}, error)
+	CloseLong(symbol string, quantity float64) (*OrderResult, error)
 
 	// CloseShort 平空仓（quantity=0表示全部平仓）
-	CloseShort(symbol string, quantity float64) (map[string]interface{}, error)
+	CloseShort(symbol string, quantity float64) (*OrderResult, error)
 
 	// SetLeverage 设置杠杆
 	SetLeverage(symbol string, leverage int) error
@@ -33,6 +48,10 @@ type Trader interface {
 	// SetTakeProfit 设置止盈单
 	SetTakeProfit(symbol string, positionSide string, quantity, takeProfitPrice float64) error
 
+	// SetTrailingStop 设置追踪止损（替换该方向原有的追踪止损，不影响止损止盈单）
+	// activationPrice为开始追踪的价格（0表示立即开始），callbackRate为从最有利价格回调的比例（%）
+	SetTrailingStop(symbol string, positionSide string, quantity, activationPrice, callbackRate float64) error
+
 	// CancelAllOrders 取消该币种的所有挂单
 	CancelAllOrders(symbol string) error
 
@@ -43,8 +62,74 @@ type Trader interface {
 	CancelTakeProfitOrders(symbol string) error
 
 	// GetOpenOrders 获取指定币种的所有未完成订单
-	GetOpenOrders(symbol string) ([]map[string]interface{}, error)
+	GetOpenOrders(symbol string) ([]Order, error)
 
 	// FormatQuantity 格式化数量到正确的精度
 	FormatQuantity(symbol string, quantity float64) (string, error)
+
+	// GetTradeHistory 获取时间范围内的成交记录（symbol为空表示全部币种）
+	GetTradeHistory(symbol string, start, end time.Time) ([]TradeFill, error)
+
+	// GetIncomeHistory 获取时间范围内的已实现盈亏、手续费和资金费流水（symbol为空表示全部币种）
+	GetIncomeHistory(symbol string, start, end time.Time) ([]IncomeRecord, error)
+
+	// SetMarginMode 设置保证金模式（symbol为空表示设置之后所有开仓使用的默认模式）
+	// 按币种设置的交易所在每次开仓前生效，账户级设置的交易所立即生效
+	SetMarginMode(symbol string, mode MarginMode) error
+
+	// SetPositionMode 设置账户的持仓模式（单向/双向），之后每次开仓前确认仍然生效
+	SetPositionMode(mode PositionMode) error
+
+	// GetTradingModes 当前使用的保证金模式（默认）和持仓模式
+	GetTradingModes() (MarginMode, PositionMode)
+
+	// AdjustIsolatedMargin 调整逐仓仓位的保证金（amount>0追加，amount<0减少）
+	AdjustIsolatedMargin(symbol string, positionSide string, amount float64) error
+
+	// Capabilities 交易所支持的功能（不随持仓模式变化）
+	Capabilities() Capabilities
+}
+
+// CloseFillStreamer 能通过交易所推送获知平仓成交的交易器（可选接口）
+// AutoTrader据此记录止损止盈触发的准确订单类型、成交价和已实现盈亏，而不是按市价推断
+type CloseFillStreamer interface {
+	// StartUserDataStream 启动用户数据推送（断线自动重连）
+	StartUserDataStream() error
+
+	// StopUserDataStream 停止用户数据推送
+	StopUserDataStream()
+
+	// DrainCloseFills 取出上次调用以来收到的平仓成交
+	DrainCloseFills() []CloseFill
+}
+
+// TradeEventPublisher 能实时推送成交、订单状态和资金费事件的交易器（可选接口）
+// 推送连接由CloseFillStreamer.StartUserDataStream启动
+type TradeEventPublisher interface {
+	// SubscribeTradeEvents 注册事件回调（在推送goroutine中调用，不应长时间阻塞），返回取消订阅函数
+	SubscribeTradeEvents(handler func(TradeEvent)) (unsubscribe func())
+}
+
+// BracketTrader 能以联动方式下止损止盈单的交易器（可选接口）
+// 止损止盈作为一对下单，一侧成交后另一侧撤销（交易所原生分组或客户端监控），避免残留的保护单之后反向开仓
+type BracketTrader interface {
+	// PlaceBracket 为持仓下联动的止损止盈单（调用方负责先撤销原有的止损止盈单）
+	PlaceBracket(symbol, positionSide string, quantity, stopLoss, takeProfit float64) (*Bracket, error)
+
+	// GetBrackets 跟踪中的联动单状态（包括已结束的，每个持仓只保留最近一个）
+	GetBrackets() []Bracket
+}
+
+// ClientOrderIDTrader 下单时附带客户端订单ID的交易器（可选接口）
+// 开平仓订单的ID编码交易器、周期和决策序号，结果不确定时按ID查询后再决定是否重发；止损止盈等保护单不附带
+type ClientOrderIDTrader interface {
+	// SetClientOrderRef 设置之后下单所属的交易器、周期和决策
+	SetClientOrderRef(ref ClientOrderRef)
+}
+
+// OrderBookTrader 能获取L2订单簿的交易器（可选接口）
+// AutoTrader在市价开仓和加仓前据此估算成交均价，滑点超过上限时缩小数量或拒绝下单
+type OrderBookTrader interface {
+	// GetOrderBook 获取订单簿快照（depth为每侧档数，交易所可能返回更少）
+	GetOrderBook(symbol string, depth int) (*OrderBook, error)
 }
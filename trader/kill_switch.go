@@ -0,0 +1,182 @@
+package trader
+
+import (
+	"fmt"
+	"log"
+	"nofx/logger"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// FlattenResult 一键清仓中一个币种的一项操作（撤单或平仓）的结果
+type FlattenResult struct {
+	TraderID string  `json:"trader_id"`
+	Exchange string  `json:"exchange"`
+	Symbol   string  `json:"symbol"`
+	Action   string  `json:"action"`             // "cancel_all_orders", "close_long" 或 "close_short"
+	Quantity float64 `json:"quantity,omitempty"` // 平仓数量
+	Price    float64 `json:"price,omitempty"`    // 平仓成交均价
+	OrderID  int64   `json:"order_id,omitempty"` // 平仓订单ID
+	Success  bool    `json:"success"`
+	Error    string  `json:"error,omitempty"`
+}
+
+// killSwitch 一键清仓的停机标记（AutoTrader和PositionManager内嵌）
+// 决策周期执行期间持有cycleMu，清仓时等待进行中的周期结束，避免清仓后又有新的开仓
+type killSwitch struct {
+	killed  atomic.Bool
+	cycleMu sync.Mutex
+}
+
+// Killed 是否已触发一键清仓（触发后不再执行决策，重启进程后恢复）
+func (k *killSwitch) Killed() bool {
+	return k.killed.Load()
+}
+
+// flattenAccount 撤销symbols和所有持仓币种的挂单，再市价平掉全部持仓，
+// 返回每个币种每项操作的结果和写入决策日志的审计记录
+func flattenAccount(t Trader, traderID, exchange, name, reason string, symbols []string) ([]FlattenResult, *logger.DecisionRecord) {
+	record := &logger.DecisionRecord{
+		ExecutionLog: []string{fmt.Sprintf("🛑 一键清仓: %s", reason)},
+		Success:      true,
+		Realtime:     true,
+	}
+	var results []FlattenResult
+	add := func(result FlattenResult, action logger.DecisionAction) {
+		result.TraderID, result.Exchange = traderID, exchange
+		action.Action, action.Symbol, action.Success, action.Error = result.Action, result.Symbol, result.Success, result.Error
+		action.Timestamp = time.Now()
+		results = append(results, result)
+		record.Decisions = append(record.Decisions, action)
+		if result.Success {
+			record.ExecutionLog = append(record.ExecutionLog, fmt.Sprintf("✓ %s %s", result.Symbol, result.Action))
+			log.Printf("  ✓ [%s] 一键清仓 %s %s", name, result.Symbol, result.Action)
+		} else {
+			record.Success = false
+			record.ExecutionLog = append(record.ExecutionLog, fmt.Sprintf("❌ %s %s: %s", result.Symbol, result.Action, result.Error))
+			log.Printf("  ❌ [%s] 一键清仓 %s %s 失败: %s", name, result.Symbol, result.Action, result.Error)
+		}
+	}
+
+	positions, err := t.GetPositions()
+	if err != nil {
+		// 仍然撤销已知币种的挂单，持仓需要人工处理
+		record.Success = false
+		record.ErrorMessage = fmt.Sprintf("获取持仓失败，无法平仓: %v", err)
+		log.Printf("  ❌ [%s] 一键清仓获取持仓失败: %v", name, err)
+	}
+
+	all := make(map[string]bool, len(symbols)+len(positions))
+	for _, symbol := range symbols {
+		all[symbol] = true
+	}
+	for _, pos := range positions {
+		all[pos.Symbol] = true
+	}
+	sorted := make([]string, 0, len(all))
+	for symbol := range all {
+		sorted = append(sorted, symbol)
+	}
+	sort.Strings(sorted)
+
+	// 先撤单（包括止损止盈和未成交的限价开仓单），避免平仓后挂单再开出新仓位
+	for _, symbol := range sorted {
+		result := FlattenResult{Symbol: symbol, Action: "cancel_all_orders", Success: true}
+		if err := t.CancelAllOrders(symbol); err != nil {
+			result.Success, result.Error = false, err.Error()
+		}
+		add(result, logger.DecisionAction{})
+	}
+
+	for _, pos := range positions {
+		result := FlattenResult{Symbol: pos.Symbol, Action: "close_" + pos.Side, Quantity: pos.PositionAmt}
+		var order *OrderResult
+		if pos.Side == "long" {
+			order, err = t.CloseLong(pos.Symbol, 0) // 0 = 全部平仓
+		} else {
+			order, err = t.CloseShort(pos.Symbol, 0)
+		}
+		action := logger.DecisionAction{Quantity: pos.PositionAmt, Price: pos.MarkPrice}
+		if err != nil {
+			result.Error = err.Error()
+		} else {
+			result.Success = true
+			recordOrderFill(&action, order)
+			result.Quantity, result.Price, result.OrderID = action.Quantity, action.Price, action.OrderID
+		}
+		add(result, action)
+	}
+
+	// 核对平仓结果：交易所返回成功但仍有持仓时标记为失败
+	if len(positions) > 0 {
+		remaining, err := t.GetPositions()
+		if err != nil {
+			log.Printf("  ⚠ [%s] 一键清仓后核对持仓失败: %v", name, err)
+		}
+		for _, pos := range remaining {
+			for i := range results {
+				if results[i].Symbol == pos.Symbol && results[i].Action == "close_"+pos.Side && results[i].Success {
+					results[i].Success = false
+					results[i].Error = fmt.Sprintf("平仓后仍有持仓 %.4f", pos.PositionAmt)
+					record.Success = false
+					record.ExecutionLog = append(record.ExecutionLog, fmt.Sprintf("❌ %s %s: %s", pos.Symbol, results[i].Action, results[i].Error))
+				}
+			}
+		}
+	}
+
+	failed := 0
+	for _, result := range results {
+		if !result.Success {
+			failed++
+		}
+	}
+	if failed > 0 && record.ErrorMessage == "" {
+		record.ErrorMessage = fmt.Sprintf("一键清仓有%d项操作失败", failed)
+	}
+	log.Printf("🛑 [%s] 一键清仓完成: %d个持仓，%d项操作，%d项失败", name, len(positions), len(results), failed)
+	return results, record
+}
+
+// Kill 一键清仓：停止决策循环（等待进行中的周期结束），撤销所有挂单并市价平掉全部持仓
+// 结果写入决策日志，触发后不再执行决策
+func (at *AutoTrader) Kill(reason string) []FlattenResult {
+	at.killed.Store(true)
+	log.Printf("🛑 [%s] 触发一键清仓: %s", at.name, reason)
+	at.Stop()
+	at.cycleMu.Lock()
+	defer at.cycleMu.Unlock()
+
+	symbols := at.orphans.trackedSymbols()
+	for _, entry := range at.restingEntries {
+		symbols = append(symbols, entry.Decision.Symbol)
+	}
+	results, record := flattenAccount(at.trader, at.id, at.exchange, at.name, reason, symbols)
+	if err := at.decisionLogger.LogDecision(record); err != nil {
+		log.Printf("⚠ [%s] 保存一键清仓记录失败: %v", at.name, err)
+	}
+
+	// 限价开仓单已撤销
+	at.restingEntries = make(map[string]*RestingEntry)
+	at.saveState()
+	return results
+}
+
+// Kill 一键清仓：停止管理循环（等待进行中的周期结束），撤销所有挂单并市价平掉全部持仓
+// 结果写入决策日志，触发后不再执行决策
+func (pm *PositionManager) Kill(reason string) []FlattenResult {
+	pm.killed.Store(true)
+	log.Printf("🛑 [%s] 触发一键清仓: %s", pm.name, reason)
+	pm.Stop()
+	pm.cycleMu.Lock()
+	defer pm.cycleMu.Unlock()
+
+	results, record := flattenAccount(pm.trader, pm.id, pm.exchange, pm.name, reason, pm.orphans.trackedSymbols())
+	if err := pm.decisionLogger.LogDecision(record); err != nil {
+		log.Printf("⚠ [%s] 保存一键清仓记录失败: %v", pm.name, err)
+	}
+	pm.saveState()
+	return results
+}
@@ -0,0 +1,145 @@
+package trader
+
+import (
+	"errors"
+	"nofx/decision"
+	"nofx/logger"
+	"nofx/trader/fakeexchange"
+	"testing"
+	"time"
+)
+
+// newKillTestTrader 有多空持仓、止损单和未成交限价开仓单的交易机器人
+func newKillTestTrader(t *testing.T, tr Trader) *AutoTrader {
+	dir := t.TempDir()
+	decisionLogger := logger.NewDecisionLogger(dir)
+	return &AutoTrader{
+		id:             "kill",
+		name:           "Kill",
+		exchange:       "binance",
+		trader:         tr,
+		decisionLogger: decisionLogger,
+		orphans:        newOrphanSweeper(tr, "Kill", decisionLogger),
+		state:          newStateStore(dir),
+		restingEntries: make(map[string]*RestingEntry),
+	}
+}
+
+func TestAutoTraderKillFlattensEverything(t *testing.T) {
+	ledger, trader := newFakeBinance(t)
+	ledger.AddSymbol(fakeexchange.SymbolSpec{Symbol: "ETHUSDT", StepSize: 0.001, TickSize: 0.01}, 3000)
+
+	if _, err := trader.OpenLong("BTCUSDT", 0.1, 10); err != nil {
+		t.Fatalf("开多仓失败: %v", err)
+	}
+	if _, err := trader.OpenShort("BTCUSDT", 0.05, 10); err != nil {
+		t.Fatalf("开空仓失败: %v", err)
+	}
+	if err := trader.SetStopLoss("BTCUSDT", "LONG", 0.1, 58000); err != nil {
+		t.Fatalf("设置止损失败: %v", err)
+	}
+	// ETH只有未成交的限价开仓单，没有持仓
+	order, err := trader.OpenLongLimit("ETHUSDT", 1, 2900, 5, TimeInForceGTC)
+	if err != nil {
+		t.Fatalf("挂限价单失败: %v", err)
+	}
+
+	at := newKillTestTrader(t, trader)
+	at.restingEntries["ETHUSDT_long"] = &RestingEntry{Decision: decision.Decision{Symbol: "ETHUSDT"}, Side: "long", OrderID: order.OrderID}
+
+	results := at.Kill("测试")
+	if !at.Killed() {
+		t.Error("应标记为已触发一键清仓")
+	}
+	if positions := ledger.Positions(); len(positions) != 0 {
+		t.Errorf("应平掉全部持仓: %+v", positions)
+	}
+	if orders := append(ledger.OpenOrders("BTCUSDT"), ledger.OpenOrders("ETHUSDT")...); len(orders) != 0 {
+		t.Errorf("应撤销全部挂单: %+v", orders)
+	}
+	if len(at.restingEntries) != 0 {
+		t.Errorf("未成交的限价开仓单应清除: %+v", at.restingEntries)
+	}
+
+	actions := make(map[string]FlattenResult)
+	for _, r := range results {
+		if !r.Success || r.TraderID != "kill" || r.Exchange != "binance" {
+			t.Errorf("操作结果错误: %+v", r)
+		}
+		actions[r.Symbol+" "+r.Action] = r
+	}
+	if len(results) != 4 {
+		t.Errorf("应有4项操作: %+v", results)
+	}
+	for _, key := range []string{"BTCUSDT cancel_all_orders", "ETHUSDT cancel_all_orders", "BTCUSDT close_long", "BTCUSDT close_short"} {
+		if _, ok := actions[key]; !ok {
+			t.Errorf("缺少操作 %s: %+v", key, results)
+		}
+	}
+	if r := actions["BTCUSDT close_long"]; !floatEq(r.Quantity, 0.1) || r.OrderID == 0 {
+		t.Errorf("平多仓结果错误: %+v", r)
+	}
+
+	// 审计记录写入决策日志
+	records, err := at.decisionLogger.GetLatestRecords(1)
+	if err != nil || len(records) != 1 {
+		t.Fatalf("读取决策记录失败: %v", err)
+	}
+	if !records[0].Realtime || !records[0].Success || len(records[0].Decisions) != 4 {
+		t.Errorf("一键清仓记录错误: %+v", records[0])
+	}
+
+	// 触发后不再执行决策周期
+	if err := at.runCycle(); err != nil || at.callCount != 0 {
+		t.Errorf("触发一键清仓后不应执行周期: %v (周期 %d)", err, at.callCount)
+	}
+}
+
+func TestKillWithPositionCache(t *testing.T) {
+	ledger, trader := newFakeBinance(t)
+	trader.cacheDuration = 15 * time.Second // 默认缓存时长
+	if _, err := trader.OpenLong("BTCUSDT", 0.1, 10); err != nil {
+		t.Fatalf("开多仓失败: %v", err)
+	}
+	// 清仓前持仓已在缓存中
+	if positions, err := trader.GetPositions(); err != nil || len(positions) != 1 {
+		t.Fatalf("查询持仓失败: %v %+v", err, positions)
+	}
+
+	results := newKillTestTrader(t, trader).Kill("测试")
+	if positions := ledger.Positions(); len(positions) != 0 {
+		t.Errorf("应平掉全部持仓: %+v", positions)
+	}
+	for _, r := range results {
+		if !r.Success {
+			t.Errorf("平仓后核对持仓不应读到缓存: %+v", r)
+		}
+	}
+}
+
+// closeFailingTrader 平多仓总是失败的交易器
+type closeFailingTrader struct {
+	*FuturesTrader
+}
+
+func (t closeFailingTrader) CloseLong(symbol string, quantity float64) (*OrderResult, error) {
+	return nil, errors.New("reduce only rejected")
+}
+
+func TestFlattenAccountReportsFailures(t *testing.T) {
+	ledger, trader := newFakeBinance(t)
+	if _, err := trader.OpenLong("BTCUSDT", 0.1, 10); err != nil {
+		t.Fatalf("开多仓失败: %v", err)
+	}
+
+	results, record := flattenAccount(closeFailingTrader{trader}, "kill", "binance", "Kill", "测试", nil)
+	if len(results) != 2 || !results[0].Success || results[1].Success || results[1].Error == "" {
+		t.Errorf("平仓失败应单独报告: %+v", results)
+	}
+	if record.Success || record.ErrorMessage == "" || record.Decisions[1].Error == "" {
+		t.Errorf("审计记录应标记失败: %+v", record)
+	}
+	if _, ok := ledger.Position("BTCUSDT", "LONG"); !ok {
+		t.Error("持仓应仍然存在")
+	}
+}
@@ -0,0 +1,144 @@
+package trader
+
+import (
+	"fmt"
+	"log"
+	"sync"
+)
+
+// tradingModes 交易器的保证金模式和持仓模式设置（交易器内嵌使用）
+// 记录已在交易所生效的设置，开仓前只对尚未生效的部分发起请求
+type tradingModes struct {
+	modesMu       sync.Mutex
+	marginMode    MarginMode            // 默认保证金模式（为空表示沿用交易所当前设置）
+	symbolMargin  map[string]MarginMode // 单独指定保证金模式的币种
+	appliedMargin map[string]MarginMode // 已在交易所生效的保证金模式（账户级设置的key为""）
+	positionMode  PositionMode
+	positionReady bool // 持仓模式是否已在交易所生效
+}
+
+// GetTradingModes 当前默认保证金模式和持仓模式
+func (m *tradingModes) GetTradingModes() (MarginMode, PositionMode) {
+	m.modesMu.Lock()
+	defer m.modesMu.Unlock()
+	return m.marginMode, m.positionMode
+}
+
+// marginModeFor 币种应使用的保证金模式（symbol为空返回默认模式）
+func (m *tradingModes) marginModeFor(symbol string) MarginMode {
+	m.modesMu.Lock()
+	defer m.modesMu.Unlock()
+	return m.marginModeForLocked(symbol)
+}
+
+func (m *tradingModes) marginModeForLocked(symbol string) MarginMode {
+	if mode, ok := m.symbolMargin[symbol]; ok && symbol != "" {
+		return mode
+	}
+	return m.marginMode
+}
+
+// hedgeMode 是否为双向持仓模式
+func (m *tradingModes) hedgeMode() bool {
+	m.modesMu.Lock()
+	defer m.modesMu.Unlock()
+	return m.positionMode == PositionModeHedge
+}
+
+// setMarginMode 记录保证金模式（symbol为空表示默认模式），在下次ensureMarginMode时生效
+func (m *tradingModes) setMarginMode(symbol string, mode MarginMode) error {
+	if mode != MarginModeCross && mode != MarginModeIsolated {
+		return fmt.Errorf("不支持的保证金模式: %q（可选 cross/isolated）", mode)
+	}
+	m.modesMu.Lock()
+	defer m.modesMu.Unlock()
+	if symbol == "" {
+		m.marginMode = mode
+		return nil
+	}
+	if m.symbolMargin == nil {
+		m.symbolMargin = make(map[string]MarginMode)
+	}
+	m.symbolMargin[symbol] = mode
+	return nil
+}
+
+// setPositionMode 记录持仓模式，在下次ensurePositionMode时生效
+func (m *tradingModes) setPositionMode(mode PositionMode) error {
+	if mode != PositionModeOneWay && mode != PositionModeHedge {
+		return fmt.Errorf("不支持的持仓模式: %q（可选 one-way/hedge）", mode)
+	}
+	m.modesMu.Lock()
+	defer m.modesMu.Unlock()
+	if m.positionMode != mode {
+		m.positionMode = mode
+		m.positionReady = false
+	}
+	return nil
+}
+
+// ensurePositionMode 确保持仓模式已在交易所生效（apply为切换持仓模式的交易所请求）
+func (m *tradingModes) ensurePositionMode(apply func(PositionMode) error) error {
+	m.modesMu.Lock()
+	mode, ready := m.positionMode, m.positionReady
+	m.modesMu.Unlock()
+	if ready || mode == "" {
+		return nil
+	}
+
+	if err := apply(mode); err != nil {
+		return err
+	}
+
+	m.modesMu.Lock()
+	if m.positionMode == mode {
+		m.positionReady = true
+	}
+	m.modesMu.Unlock()
+	return nil
+}
+
+// ensureMarginMode 确保币种的保证金模式已在交易所生效（账户级设置传symbol为""）
+// apply为切换保证金模式的交易所请求
+func (m *tradingModes) ensureMarginMode(symbol string, apply func(symbol string, mode MarginMode) error) error {
+	m.modesMu.Lock()
+	mode := m.marginModeForLocked(symbol)
+	ready := mode == "" || m.appliedMargin[symbol] == mode
+	m.modesMu.Unlock()
+	if ready {
+		return nil
+	}
+
+	if err := apply(symbol, mode); err != nil {
+		return err
+	}
+
+	m.modesMu.Lock()
+	if m.appliedMargin == nil {
+		m.appliedMargin = make(map[string]MarginMode)
+	}
+	m.appliedMargin[symbol] = mode
+	m.modesMu.Unlock()
+	return nil
+}
+
+// applyTradingModes 启动时把配置的保证金模式和持仓模式应用到交易器（为空表示沿用交易器默认设置）
+// 应用失败只记录日志：设置已记录在交易器中，开仓前会再次尝试，失败时拒绝开仓
+func applyTradingModes(t Trader, name, marginMode, positionMode string) {
+	if positionMode != "" {
+		if err := t.SetPositionMode(PositionMode(positionMode)); err != nil {
+			log.Printf("⚠️ [%s] 设置持仓模式失败: %v", name, err)
+		}
+	}
+	if marginMode != "" {
+		if err := t.SetMarginMode("", MarginMode(marginMode)); err != nil {
+			log.Printf("⚠️ [%s] 设置保证金模式失败: %v", name, err)
+		}
+	}
+
+	margin, position := t.GetTradingModes()
+	if margin == "" {
+		margin = "交易所当前设置"
+	}
+	log.Printf("📐 [%s] 保证金模式: %s, 持仓模式: %s", name, margin, position)
+}
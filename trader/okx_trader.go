@@ -0,0 +1,1324 @@
+package trader
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OKXTrader OKX USDT本位永续合约交易器
+// OKX以合约张数下单，内部按ctVal（每张合约面值）在币数量与张数之间换算，对外统一使用币数量
+type OKXTrader struct {
+	apiKey     string
+	secretKey  string
+	passphrase string
+	client     *http.Client
+	baseURL    string
+
+	// 缓存合约信息
+	instruments map[string]okxInstrument
+	mu          sync.RWMutex
+
+	// 保证金模式和持仓模式
+	tradingModes
+
+	// 开平仓订单的客户端订单ID（clOrdId）
+	clientOrderIDs
+}
+
+// okxInstrument OKX合约信息
+type okxInstrument struct {
+	CtVal          float64 // 每张合约面值（币数量）
+	LotSz          float64 // 下单张数步进
+	TickSz         float64 // 价格步进
+	LotPrecision   int
+	PricePrecision int
+}
+
+// okxAPIError OKX接口返回的业务错误（code != "0"）
+type okxAPIError struct {
+	Code string
+	Msg  string
+}
+
+func (e *okxAPIError) Error() string {
+	return fmt.Sprintf("OKX API错误 %s: %s", e.Code, e.Msg)
+}
+
+// NewOKXTrader 创建OKX交易器
+// apiKey/secretKey/passphrase: 在OKX API管理页面创建（passphrase为创建API时设置的密码）
+func NewOKXTrader(apiKey, secretKey, passphrase string) *OKXTrader {
+	log.Printf("✓ OKX交易器初始化成功")
+
+	return &OKXTrader{
+		apiKey:      apiKey,
+		secretKey:   secretKey,
+		passphrase:  passphrase,
+		instruments: make(map[string]okxInstrument),
+		client: &http.Client{
+			Timeout: 30 * time.Second,
+			Transport: &http.Transport{
+				TLSHandshakeTimeout:   10 * time.Second,
+				ResponseHeaderTimeout: 10 * time.Second,
+				IdleConnTimeout:       90 * time.Second,
+			},
+		},
+		baseURL: "https://www.okx.com",
+		// 默认全仓+双向持仓
+		tradingModes: tradingModes{marginMode: MarginModeCross, positionMode: PositionModeHedge},
+	}
+}
+
+// okxInstID 将交易对转换为OKX合约ID，如 BTCUSDT -> BTC-USDT-SWAP
+func okxInstID(symbol string) string {
+	return strings.TrimSuffix(symbol, "USDT") + "-USDT-SWAP"
+}
+
+// okxSymbol 将OKX合约ID转换为交易对，如 BTC-USDT-SWAP -> BTCUSDT
+func okxSymbol(instID string) string {
+	return strings.ReplaceAll(strings.TrimSuffix(instID, "-SWAP"), "-", "")
+}
+
+// sign 生成签名: Base64(HMAC_SHA256(timestamp + method + requestPath + body))
+func (t *OKXTrader) sign(timestamp, method, requestPath, body string) string {
+	mac := hmac.New(sha256.New, []byte(t.secretKey))
+	mac.Write([]byte(timestamp + method + requestPath + body))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// get 发送GET请求（参数放在querystring中）
+func (t *OKXTrader) get(endpoint string, params map[string]string, signed bool) (json.RawMessage, error) {
+	q := url.Values{}
+	for k, v := range params {
+		q.Set(k, v)
+	}
+	requestPath := endpoint
+	if len(q) > 0 {
+		requestPath += "?" + q.Encode()
+	}
+	return t.request("GET", requestPath, nil, signed)
+}
+
+// post 发送POST请求（参数以JSON放在body中，body可以是对象或数组）
+func (t *OKXTrader) post(endpoint string, body interface{}) (json.RawMessage, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("序列化请求参数失败: %w", err)
+	}
+	return t.request("POST", endpoint, data, true)
+}
+
+// request 发送HTTP请求（带重试机制）
+func (t *OKXTrader) request(method, requestPath string, body []byte, signed bool) (json.RawMessage, error) {
+	const maxRetries = 3
+	var lastErr error
+
+	for attempt := 1; attempt <= maxRetries; attempt++ {
+		data, err := t.doRequest(method, requestPath, body, signed)
+		if err == nil {
+			return data, nil
+		}
+
+		lastErr = err
+
+		// 如果是网络超时或临时错误，重试
+		if strings.Contains(err.Error(), "timeout") ||
+			strings.Contains(err.Error(), "connection reset") ||
+			strings.Contains(err.Error(), "EOF") {
+			if attempt < maxRetries {
+				time.Sleep(time.Duration(attempt) * time.Second)
+				continue
+			}
+		}
+
+		// 其他错误（业务错误、4xx等）不重试
+		return nil, err
+	}
+
+	return nil, fmt.Errorf("请求失败（已重试%d次）: %w", maxRetries, lastErr)
+}
+
+// doRequest 执行实际的HTTP请求，返回data字段
+func (t *OKXTrader) doRequest(method, requestPath string, body []byte, signed bool) (json.RawMessage, error) {
+	req, err := http.NewRequest(method, t.baseURL+requestPath, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	if signed {
+		timestamp := time.Now().UTC().Format("2006-01-02T15:04:05.000Z")
+		req.Header.Set("OK-ACCESS-KEY", t.apiKey)
+		req.Header.Set("OK-ACCESS-SIGN", t.sign(timestamp, method, requestPath, string(body)))
+		req.Header.Set("OK-ACCESS-TIMESTAMP", timestamp)
+		req.Header.Set("OK-ACCESS-PASSPHRASE", t.passphrase)
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(respBody))
+	}
+
+	var envelope struct {
+		Code string          `json:"code"`
+		Msg  string          `json:"msg"`
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(respBody, &envelope); err != nil {
+		return nil, fmt.Errorf("解析响应失败: %w", err)
+	}
+	if envelope.Code != "0" {
+		// 批量/下单类接口的具体错误在data[].sMsg中
+		var items []struct {
+			SCode string `json:"sCode"`
+			SMsg  string `json:"sMsg"`
+		}
+		if json.Unmarshal(envelope.Data, &items) == nil && len(items) > 0 && items[0].SCode != "" && items[0].SCode != "0" {
+			return nil, &okxAPIError{Code: items[0].SCode, Msg: items[0].SMsg}
+		}
+		return nil, &okxAPIError{Code: envelope.Code, Msg: envelope.Msg}
+	}
+
+	return envelope.Data, nil
+}
+
+// getInstrument 获取合约信息（面值、张数步进、价格步进）
+func (t *OKXTrader) getInstrument(symbol string) (okxInstrument, error) {
+	t.mu.RLock()
+	if inst, ok := t.instruments[symbol]; ok {
+		t.mu.RUnlock()
+		return inst, nil
+	}
+	t.mu.RUnlock()
+
+	data, err := t.get("/api/v5/public/instruments", map[string]string{
+		"instType": "SWAP",
+		"instId":   okxInstID(symbol),
+	}, false)
+	if err != nil {
+		return okxInstrument{}, fmt.Errorf("获取合约信息失败: %w", err)
+	}
+
+	var list []struct {
+		InstID string `json:"instId"`
+		CtVal  string `json:"ctVal"`
+		LotSz  string `json:"lotSz"`
+		TickSz string `json:"tickSz"`
+	}
+	if err := json.Unmarshal(data, &list); err != nil {
+		return okxInstrument{}, err
+	}
+	if len(list) == 0 {
+		return okxInstrument{}, fmt.Errorf("未找到交易对 %s 的合约信息", symbol)
+	}
+
+	inst := okxInstrument{
+		LotPrecision:   calculatePrecision(list[0].LotSz),
+		PricePrecision: calculatePrecision(list[0].TickSz),
+	}
+	inst.CtVal, _ = strconv.ParseFloat(list[0].CtVal, 64)
+	inst.LotSz, _ = strconv.ParseFloat(list[0].LotSz, 64)
+	inst.TickSz, _ = strconv.ParseFloat(list[0].TickSz, 64)
+	if inst.CtVal <= 0 {
+		return okxInstrument{}, fmt.Errorf("%s 合约面值无效: %s", symbol, list[0].CtVal)
+	}
+
+	t.mu.Lock()
+	t.instruments[symbol] = inst
+	t.mu.Unlock()
+	return inst, nil
+}
+
+// toContracts 将币数量换算为合约张数（按lotSz向下取整），返回张数字符串
+func (t *OKXTrader) toContracts(symbol string, quantity float64) (string, error) {
+	inst, err := t.getInstrument(symbol)
+	if err != nil {
+		return "", err
+	}
+
+	contracts := quantity / inst.CtVal
+	if inst.LotSz > 0 {
+		contracts = math.Floor(contracts/inst.LotSz+1e-9) * inst.LotSz
+	}
+	if contracts <= 0 {
+		return "", fmt.Errorf("数量 %.8f 不足 %s 的最小下单张数（每张 %v）", quantity, symbol, inst.CtVal)
+	}
+	return strconv.FormatFloat(contracts, 'f', inst.LotPrecision, 64), nil
+}
+
+// fromContracts 将合约张数换算为币数量
+func (t *OKXTrader) fromContracts(symbol string, contracts float64) float64 {
+	inst, err := t.getInstrument(symbol)
+	if err != nil {
+		log.Printf("  ⚠ 获取 %s 合约面值失败，按1张=1币换算: %v", symbol, err)
+		return contracts
+	}
+	return contracts * inst.CtVal
+}
+
+// formatPrice 按tickSz格式化价格
+func (t *OKXTrader) formatPrice(symbol string, price float64) (string, error) {
+	inst, err := t.getInstrument(symbol)
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatFloat(roundToTickSize(price, inst.TickSz), 'f', inst.PricePrecision, 64), nil
+}
+
+// SetMarginMode 设置保证金模式（OKX按订单指定tdMode，在之后的开仓、止盈止损单中生效）
+func (t *OKXTrader) SetMarginMode(symbol string, mode MarginMode) error {
+	return t.setMarginMode(symbol, mode)
+}
+
+// SetPositionMode 设置持仓模式（有持仓或挂单时交易所会拒绝切换）
+func (t *OKXTrader) SetPositionMode(mode PositionMode) error {
+	if err := t.setPositionMode(mode); err != nil {
+		return err
+	}
+	return t.ensurePositionMode(t.applyPositionMode)
+}
+
+// applyPositionMode 切换持仓模式（long_short_mode=双向, net_mode=单向），已是目标模式时不发起切换
+func (t *OKXTrader) applyPositionMode(mode PositionMode) error {
+	posMode := "net_mode"
+	if mode == PositionModeHedge {
+		posMode = "long_short_mode"
+	}
+
+	data, err := t.get("/api/v5/account/config", nil, true)
+	if err != nil {
+		return fmt.Errorf("获取账户配置失败: %w", err)
+	}
+
+	var configs []struct {
+		PosMode string `json:"posMode"`
+	}
+	if err := json.Unmarshal(data, &configs); err == nil && len(configs) > 0 && configs[0].PosMode == posMode {
+		return nil
+	}
+
+	if _, err := t.post("/api/v5/account/set-position-mode", map[string]string{"posMode": posMode}); err != nil {
+		return fmt.Errorf("切换持仓模式失败: %w", err)
+	}
+
+	log.Printf("  ✓ OKX账户已切换为%s持仓模式", mode)
+	return nil
+}
+
+// orderPosSide 下单使用的posSide（单向持仓模式下为net）
+func (t *OKXTrader) orderPosSide(posSide string) string {
+	if t.hedgeMode() {
+		return posSide
+	}
+	return "net"
+}
+
+// Capabilities OKX支持的功能（最小下单量按合约张数限制，由FormatQuantity校验）
+func (t *OKXTrader) Capabilities() Capabilities {
+	return Capabilities{
+		TrailingStop:       true,
+		ReduceOnly:         true,
+		SeparateSLTPCancel: true,
+		HedgeMode:          true,
+		LimitOrders:        true,
+		AdjustMargin:       true,
+	}
+}
+
+// AdjustIsolatedMargin 调整逐仓仓位保证金（amount>0追加，amount<0减少）
+func (t *OKXTrader) AdjustIsolatedMargin(symbol string, positionSide string, amount float64) error {
+	if amount == 0 {
+		return fmt.Errorf("保证金调整金额不能为0")
+	}
+	adjustType := "add"
+	if amount < 0 {
+		adjustType = "reduce"
+	}
+
+	_, err := t.post("/api/v5/account/position/margin-balance", map[string]string{
+		"instId":  okxInstID(symbol),
+		"posSide": t.orderPosSide(strings.ToLower(positionSide)),
+		"type":    adjustType,
+		"amt":     strconv.FormatFloat(math.Abs(amount), 'f', 4, 64),
+	})
+	if err != nil {
+		return fmt.Errorf("调整逐仓保证金失败: %w", err)
+	}
+
+	log.Printf("  ✓ %s %s 逐仓保证金调整 %+.4f USDT", symbol, strings.ToUpper(positionSide), amount)
+	return nil
+}
+
+// GetBalance 获取账户余额（USDT）
+func (t *OKXTrader) GetBalance() (*Balance, error) {
+	data, err := t.get("/api/v5/account/balance", map[string]string{"ccy": "USDT"}, true)
+	if err != nil {
+		return nil, fmt.Errorf("获取账户信息失败: %w", err)
+	}
+
+	var accounts []struct {
+		Details []struct {
+			Ccy      string `json:"ccy"`
+			CashBal  string `json:"cashBal"`
+			AvailEq  string `json:"availEq"`
+			AvailBal string `json:"availBal"`
+			Upl      string `json:"upl"`
+		} `json:"details"`
+	}
+	if err := json.Unmarshal(data, &accounts); err != nil {
+		return nil, fmt.Errorf("解析账户信息失败: %w", err)
+	}
+
+	balance := &Balance{}
+	for _, account := range accounts {
+		for _, d := range account.Details {
+			if d.Ccy != "USDT" {
+				continue
+			}
+			balance.TotalWalletBalance, _ = strconv.ParseFloat(d.CashBal, 64)
+			balance.TotalUnrealizedProfit, _ = strconv.ParseFloat(d.Upl, 64)
+			// 保证金模式账户使用availEq，简单交易模式只有availBal
+			available := d.AvailEq
+			if available == "" {
+				available = d.AvailBal
+			}
+			balance.AvailableBalance, _ = strconv.ParseFloat(available, 64)
+		}
+	}
+
+	return balance, nil
+}
+
+// GetPositions 获取所有持仓（数量已换算为币数量）
+func (t *OKXTrader) GetPositions() ([]Position, error) {
+	data, err := t.get("/api/v5/account/positions", map[string]string{"instType": "SWAP"}, true)
+	if err != nil {
+		return nil, fmt.Errorf("获取持仓失败: %w", err)
+	}
+
+	var list []struct {
+		InstID  string `json:"instId"`
+		PosSide string `json:"posSide"` // "long", "short" 或 "net"
+		Pos     string `json:"pos"`     // 持仓张数（net模式下带符号）
+		AvgPx   string `json:"avgPx"`
+		MarkPx  string `json:"markPx"`
+		Upl     string `json:"upl"`
+		Lever   string `json:"lever"`
+		LiqPx   string `json:"liqPx"`
+	}
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("解析持仓失败: %w", err)
+	}
+
+	positions := []Position{}
+	for _, pos := range list {
+		if !strings.HasSuffix(pos.InstID, "-USDT-SWAP") {
+			continue
+		}
+
+		contracts, _ := strconv.ParseFloat(pos.Pos, 64)
+		if contracts == 0 {
+			continue // 跳过空仓位
+		}
+
+		side := pos.PosSide
+		if side == "net" {
+			side = "long"
+			if contracts < 0 {
+				side = "short"
+			}
+		}
+
+		symbol := okxSymbol(pos.InstID)
+		entryPrice, _ := strconv.ParseFloat(pos.AvgPx, 64)
+		markPrice, _ := strconv.ParseFloat(pos.MarkPx, 64)
+		upl, _ := strconv.ParseFloat(pos.Upl, 64)
+		leverage, _ := strconv.ParseFloat(pos.Lever, 64)
+		liqPrice, _ := strconv.ParseFloat(pos.LiqPx, 64)
+
+		positions = append(positions, Position{
+			Symbol:           symbol,
+			Side:             side,
+			PositionAmt:      t.fromContracts(symbol, math.Abs(contracts)),
+			EntryPrice:       entryPrice,
+			MarkPrice:        markPrice,
+			UnRealizedProfit: upl,
+			Leverage:         int(leverage),
+			LiquidationPrice: liqPrice,
+		})
+	}
+
+	return positions, nil
+}
+
+// SetLeverage 设置杠杆（全仓模式下多空共用，双向持仓的逐仓模式需分别设置多空）
+func (t *OKXTrader) SetLeverage(symbol string, leverage int) error {
+	mgnMode := t.marginModeFor(symbol)
+	posSides := []string{""}
+	if mgnMode == MarginModeIsolated && t.hedgeMode() {
+		posSides = []string{"long", "short"}
+	}
+
+	for _, posSide := range posSides {
+		body := map[string]string{
+			"instId":  okxInstID(symbol),
+			"lever":   strconv.Itoa(leverage),
+			"mgnMode": string(mgnMode),
+		}
+		if posSide != "" {
+			body["posSide"] = posSide
+		}
+		if _, err := t.post("/api/v5/account/set-leverage", body); err != nil {
+			return fmt.Errorf("设置杠杆失败: %w", err)
+		}
+	}
+
+	log.Printf("  ✓ %s 杠杆已切换为 %dx", symbol, leverage)
+	return nil
+}
+
+// placeOrder 下单并查询成交结果
+// ordType: market/limit/ioc/post_only，非市价单需传入price；reduceOnly用于单向持仓模式下的平仓
+func (t *OKXTrader) placeOrder(symbol, side, posSide, ordType, contracts, price string, reduceOnly bool) (*OrderResult, error) {
+	body := map[string]string{
+		"instId":  okxInstID(symbol),
+		"tdMode":  string(t.marginModeFor(symbol)),
+		"side":    side,
+		"posSide": t.orderPosSide(posSide),
+		"ordType": ordType,
+		"sz":      contracts,
+	}
+	if price != "" {
+		body["px"] = price
+	}
+	if reduceOnly && !t.hedgeMode() {
+		body["reduceOnly"] = "true"
+	}
+	clientOrderID := t.nextClientOrderID().String()
+	if clientOrderID != "" {
+		body["clOrdId"] = clientOrderID
+	}
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("序列化请求参数失败: %w", err)
+	}
+
+	// 带客户端订单ID时只发送一次，由submitOrder按ID查询后决定是否重发
+	send := t.request
+	if clientOrderID != "" {
+		send = t.doRequest
+	}
+
+	return submitOrder(clientOrderID, func() (*OrderResult, error) {
+		data, err := send("POST", "/api/v5/trade/order", payload, true)
+		if err != nil {
+			return nil, err
+		}
+
+		var created []struct {
+			OrdID string `json:"ordId"`
+		}
+		if err := json.Unmarshal(data, &created); err != nil || len(created) == 0 {
+			return nil, fmt.Errorf("解析下单响应失败: %s", string(data))
+		}
+
+		orderID, _ := strconv.ParseInt(created[0].OrdID, 10, 64)
+
+		// 下单接口不返回成交信息，查询一次订单获取成交均价（失败不影响下单结果）
+		result, err := t.GetOrder(symbol, orderID)
+		if err != nil {
+			log.Printf("  ⚠ 查询订单成交信息失败: %v", err)
+			return &OrderResult{OrderID: orderID, Symbol: symbol, Status: OrderStatusNew}, nil
+		}
+		return result, nil
+	}, func() (*OrderResult, error) {
+		result, err := t.queryOrder(symbol, map[string]string{"instId": okxInstID(symbol), "clOrdId": clientOrderID})
+		var apiErr *okxAPIError
+		if errors.As(err, &apiErr) && apiErr.Code == "51603" {
+			return nil, nil // 订单不存在
+		}
+		return result, err
+	})
+}
+
+// okxOrderStatus 将OKX订单状态转换为统一状态
+func okxOrderStatus(state string) string {
+	switch state {
+	case "live":
+		return OrderStatusNew
+	case "partially_filled":
+		return OrderStatusPartiallyFilled
+	case "filled":
+		return OrderStatusFilled
+	default:
+		// canceled、mmp_canceled（IOC未成交、只做Maker被撤销也在此列）
+		return OrderStatusCanceled
+	}
+}
+
+// GetOrder 查询订单状态（成交数量已换算为币数量）
+func (t *OKXTrader) GetOrder(symbol string, orderID int64) (*OrderResult, error) {
+	result, err := t.queryOrder(symbol, map[string]string{
+		"instId": okxInstID(symbol),
+		"ordId":  strconv.FormatInt(orderID, 10),
+	})
+	if err == nil && result == nil {
+		return nil, fmt.Errorf("订单不存在: %d", orderID)
+	}
+	return result, err
+}
+
+// queryOrder 按ordId或clOrdId查询订单（没有返回订单时为nil）
+func (t *OKXTrader) queryOrder(symbol string, params map[string]string) (*OrderResult, error) {
+	data, err := t.get("/api/v5/trade/order", params, true)
+	if err != nil {
+		return nil, fmt.Errorf("查询订单失败: %w", err)
+	}
+
+	var orders []struct {
+		OrdID     string `json:"ordId"`
+		ClOrdID   string `json:"clOrdId"`
+		State     string `json:"state"`
+		AvgPx     string `json:"avgPx"`
+		AccFillSz string `json:"accFillSz"`
+		Fee       string `json:"fee"`
+		FeeCcy    string `json:"feeCcy"`
+	}
+	if err := json.Unmarshal(data, &orders); err != nil {
+		return nil, fmt.Errorf("解析订单失败: %w", err)
+	}
+	if len(orders) == 0 {
+		return nil, nil
+	}
+
+	orderID, _ := strconv.ParseInt(orders[0].OrdID, 10, 64)
+	filledContracts, _ := strconv.ParseFloat(orders[0].AccFillSz, 64)
+	avgPrice, _ := strconv.ParseFloat(orders[0].AvgPx, 64)
+	fee, _ := strconv.ParseFloat(orders[0].Fee, 64)
+	return &OrderResult{
+		OrderID:       orderID,
+		Symbol:        symbol,
+		Status:        okxOrderStatus(orders[0].State),
+		AvgPrice:      avgPrice,
+		ExecutedQty:   t.fromContracts(symbol, filledContracts),
+		Fee:           -fee, // OKX手续费为负数表示扣除，统一为正数表示支付
+		FeeAsset:      orders[0].FeeCcy,
+		ClientOrderID: orders[0].ClOrdID,
+	}, nil
+}
+
+// CancelOrder 取消指定订单
+func (t *OKXTrader) CancelOrder(symbol string, orderID int64) error {
+	_, err := t.post("/api/v5/trade/cancel-order", map[string]string{
+		"instId": okxInstID(symbol),
+		"ordId":  strconv.FormatInt(orderID, 10),
+	})
+	if err != nil {
+		return fmt.Errorf("取消订单失败: %w", err)
+	}
+
+	log.Printf("  ✓ 已取消 %s 订单 %d", symbol, orderID)
+	return nil
+}
+
+// okxOrdType 将时间有效性转换为OKX订单类型
+func okxOrdType(tif TimeInForce) string {
+	switch tif {
+	case TimeInForceIOC:
+		return "ioc"
+	case TimeInForcePostOnly:
+		return "post_only"
+	default:
+		return "limit"
+	}
+}
+
+// openPosition 开仓（limitPrice为0时下市价单）
+func (t *OKXTrader) openPosition(symbol string, quantity float64, leverage int, posSide string, limitPrice float64, tif TimeInForce) (*OrderResult, error) {
+	// 开仓前先取消所有挂单,防止残留挂单导致仓位叠加
+	if err := t.CancelAllOrders(symbol); err != nil {
+		log.Printf("  ⚠ 取消挂单失败(继续开仓): %v", err)
+	}
+
+	if err := t.ensurePositionMode(t.applyPositionMode); err != nil {
+		return nil, err
+	}
+
+	if err := t.SetLeverage(symbol, leverage); err != nil {
+		return nil, err
+	}
+
+	contracts, err := t.toContracts(symbol, quantity)
+	if err != nil {
+		return nil, err
+	}
+
+	side := "buy"
+	if posSide == "short" {
+		side = "sell"
+	}
+
+	ordType, price := "market", ""
+	if limitPrice > 0 {
+		ordType = okxOrdType(tif)
+		price, err = t.formatPrice(symbol, limitPrice)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	result, err := t.placeOrder(symbol, side, posSide, ordType, contracts, price, false)
+	if err != nil {
+		return nil, fmt.Errorf("开仓失败: %w", err)
+	}
+
+	if limitPrice > 0 {
+		log.Printf("✓ 限价开仓单已提交: %s %s 价格: %s 数量: %.8f (%s张, %s) 状态: %s",
+			symbol, posSide, price, quantity, contracts, ordType, result.Status)
+	} else if posSide == "short" {
+		log.Printf("✓ 开空仓成功: %s 数量: %.8f (%s张)", symbol, quantity, contracts)
+	} else {
+		log.Printf("✓ 开多仓成功: %s 数量: %.8f (%s张)", symbol, quantity, contracts)
+	}
+	log.Printf("  订单ID: %d", result.OrderID)
+
+	return result, nil
+}
+
+// closePosition 平仓（quantity为0时平掉全部持仓）
+func (t *OKXTrader) closePosition(symbol string, quantity float64, posSide string) (*OrderResult, error) {
+	// 如果数量为0，获取当前持仓数量
+	if quantity == 0 {
+		positions, err := t.GetPositions()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, pos := range positions {
+			if pos.Symbol == symbol && pos.Side == posSide {
+				quantity = pos.PositionAmt
+				break
+			}
+		}
+
+		if quantity == 0 {
+			if posSide == "short" {
+				return nil, fmt.Errorf("没有找到 %s 的空仓", symbol)
+			}
+			return nil, fmt.Errorf("没有找到 %s 的多仓", symbol)
+		}
+	}
+
+	contracts, err := t.toContracts(symbol, quantity)
+	if err != nil {
+		return nil, err
+	}
+
+	side := "sell"
+	if posSide == "short" {
+		side = "buy"
+	}
+
+	result, err := t.placeOrder(symbol, side, posSide, "market", contracts, "", true)
+	if err != nil {
+		return nil, fmt.Errorf("平仓失败: %w", err)
+	}
+
+	if posSide == "short" {
+		log.Printf("✓ 平空仓成功: %s 数量: %.8f (%s张)", symbol, quantity, contracts)
+	} else {
+		log.Printf("✓ 平多仓成功: %s 数量: %.8f (%s张)", symbol, quantity, contracts)
+	}
+
+	// 平仓后取消该币种的所有挂单(止损止盈单)
+	if err := t.CancelAllOrders(symbol); err != nil {
+		log.Printf("  ⚠ 取消挂单失败: %v", err)
+	}
+
+	return result, nil
+}
+
+// OpenLong 开多仓
+func (t *OKXTrader) OpenLong(symbol string, quantity float64, leverage int) (*OrderResult, error) {
+	return t.openPosition(symbol, quantity, leverage, "long", 0, "")
+}
+
+// OpenShort 开空仓
+func (t *OKXTrader) OpenShort(symbol string, quantity float64, leverage int) (*OrderResult, error) {
+	return t.openPosition(symbol, quantity, leverage, "short", 0, "")
+}
+
+// OpenLongLimit 限价开多
+func (t *OKXTrader) OpenLongLimit(symbol string, quantity, price float64, leverage int, tif TimeInForce) (*OrderResult, error) {
+	return t.openPosition(symbol, quantity, leverage, "long", price, tif)
+}
+
+// OpenShortLimit 限价开空
+func (t *OKXTrader) OpenShortLimit(symbol string, quantity, price float64, leverage int, tif TimeInForce) (*OrderResult, error) {
+	return t.openPosition(symbol, quantity, leverage, "short", price, tif)
+}
+
+// CloseLong 平多仓（quantity=0表示全部平仓）
+func (t *OKXTrader) CloseLong(symbol string, quantity float64) (*OrderResult, error) {
+	return t.closePosition(symbol, quantity, "long")
+}
+
+// CloseShort 平空仓（quantity=0表示全部平仓）
+func (t *OKXTrader) CloseShort(symbol string, quantity float64) (*OrderResult, error) {
+	return t.closePosition(symbol, quantity, "short")
+}
+
+// GetMarketPrice 获取市场价格
+func (t *OKXTrader) GetMarketPrice(symbol string) (float64, error) {
+	data, err := t.get("/api/v5/market/ticker", map[string]string{"instId": okxInstID(symbol)}, false)
+	if err != nil {
+		return 0, fmt.Errorf("获取价格失败: %w", err)
+	}
+
+	var tickers []struct {
+		Last string `json:"last"`
+	}
+	if err := json.Unmarshal(data, &tickers); err != nil {
+		return 0, err
+	}
+	if len(tickers) == 0 {
+		return 0, fmt.Errorf("未找到 %s 的价格", symbol)
+	}
+
+	return strconv.ParseFloat(tickers[0].Last, 64)
+}
+
+// GetOrderBook 获取L2订单簿（OKX按张报价，换算为币数量；单次最多400档）
+func (t *OKXTrader) GetOrderBook(symbol string, depth int) (*OrderBook, error) {
+	if depth > 400 {
+		depth = 400
+	}
+	data, err := t.get("/api/v5/market/books", map[string]string{
+		"instId": okxInstID(symbol),
+		"sz":     strconv.Itoa(depth),
+	}, false)
+	if err != nil {
+		return nil, fmt.Errorf("获取订单簿失败: %w", err)
+	}
+
+	var books []struct {
+		Asks [][]string `json:"asks"`
+		Bids [][]string `json:"bids"`
+		Ts   string     `json:"ts"`
+	}
+	if err := json.Unmarshal(data, &books); err != nil {
+		return nil, fmt.Errorf("解析订单簿失败: %w", err)
+	}
+	if len(books) == 0 {
+		return nil, fmt.Errorf("未找到 %s 的订单簿", symbol)
+	}
+
+	contractSize := t.fromContracts(symbol, 1)
+	ts, _ := strconv.ParseInt(books[0].Ts, 10, 64)
+	return &OrderBook{
+		Symbol: symbol,
+		Bids:   parseBookLevels(books[0].Bids, contractSize),
+		Asks:   parseBookLevels(books[0].Asks, contractSize),
+		Time:   time.UnixMilli(ts),
+	}, nil
+}
+
+// placeAlgoOrder 下条件单（止损/止盈），触发后按市价平仓
+func (t *OKXTrader) placeAlgoOrder(symbol, positionSide string, quantity, triggerPrice float64, stopLoss bool) error {
+	posSide := strings.ToLower(positionSide)
+	side := "sell"
+	if posSide == "short" {
+		side = "buy"
+	}
+
+	priceStr, err := t.formatPrice(symbol, triggerPrice)
+	if err != nil {
+		return err
+	}
+	contracts, err := t.toContracts(symbol, quantity)
+	if err != nil {
+		return err
+	}
+
+	params := map[string]string{
+		"instId":  okxInstID(symbol),
+		"tdMode":  string(t.marginModeFor(symbol)),
+		"side":    side,
+		"posSide": t.orderPosSide(posSide),
+		"ordType": "conditional",
+		"sz":      contracts,
+	}
+	if !t.hedgeMode() {
+		params["reduceOnly"] = "true"
+	}
+	// 委托价格为-1表示触发后市价成交
+	if stopLoss {
+		params["slTriggerPx"] = priceStr
+		params["slOrdPx"] = "-1"
+		params["slTriggerPxType"] = "last"
+	} else {
+		params["tpTriggerPx"] = priceStr
+		params["tpOrdPx"] = "-1"
+		params["tpTriggerPxType"] = "last"
+	}
+
+	_, err = t.post("/api/v5/trade/order-algo", params)
+	return err
+}
+
+// SetStopLoss 设置止损单
+func (t *OKXTrader) SetStopLoss(symbol string, positionSide string, quantity, stopPrice float64) error {
+	if err := t.placeAlgoOrder(symbol, positionSide, quantity, stopPrice, true); err != nil {
+		return fmt.Errorf("设置止损失败: %w", err)
+	}
+
+	log.Printf("  止损价设置: %.4f", stopPrice)
+	return nil
+}
+
+// SetTakeProfit 设置止盈单
+func (t *OKXTrader) SetTakeProfit(symbol string, positionSide string, quantity, takeProfitPrice float64) error {
+	if err := t.placeAlgoOrder(symbol, positionSide, quantity, takeProfitPrice, false); err != nil {
+		return fmt.Errorf("设置止盈失败: %w", err)
+	}
+
+	log.Printf("  止盈价设置: %.4f", takeProfitPrice)
+	return nil
+}
+
+// SetTrailingStop 设置追踪止损（move_order_stop策略委托，先取消该方向原有的追踪止损）
+func (t *OKXTrader) SetTrailingStop(symbol string, positionSide string, quantity, activationPrice, callbackRate float64) error {
+	price, err := t.GetMarketPrice(symbol)
+	if err != nil {
+		return err
+	}
+	if err := validateTrailingStop(positionSide, price, activationPrice, callbackRate); err != nil {
+		return err
+	}
+
+	posSide := strings.ToLower(positionSide)
+	side := "sell"
+	if posSide == "short" {
+		side = "buy"
+	}
+	contracts, err := t.toContracts(symbol, quantity)
+	if err != nil {
+		return err
+	}
+
+	params := map[string]string{
+		"instId":        okxInstID(symbol),
+		"tdMode":        string(t.marginModeFor(symbol)),
+		"side":          side,
+		"posSide":       t.orderPosSide(posSide),
+		"ordType":       "move_order_stop",
+		"sz":            contracts,
+		"callbackRatio": strconv.FormatFloat(callbackRate/100, 'f', -1, 64), // 比例，0.01表示1%
+	}
+	if !t.hedgeMode() {
+		params["reduceOnly"] = "true"
+	}
+	if activationPrice > 0 {
+		priceStr, err := t.formatPrice(symbol, activationPrice)
+		if err != nil {
+			return err
+		}
+		params["activePx"] = priceStr
+	}
+
+	existing, err := t.getAlgoOrdersByType(symbol, "move_order_stop")
+	if err != nil {
+		return err
+	}
+	toCancel := []okxAlgoOrder{}
+	for _, o := range existing {
+		if o.Side == side && o.PosSide == params["posSide"] {
+			toCancel = append(toCancel, o)
+		}
+	}
+	if err := t.cancelAlgoOrders(toCancel); err != nil {
+		return fmt.Errorf("取消原追踪止损失败: %w", err)
+	}
+
+	if _, err := t.post("/api/v5/trade/order-algo", params); err != nil {
+		return fmt.Errorf("设置追踪止损失败: %w", err)
+	}
+
+	log.Printf("  追踪止损设置: 回调%.2f%% 激活价%.4f", callbackRate, activationPrice)
+	return nil
+}
+
+// okxAlgoOrder OKX条件单信息
+type okxAlgoOrder struct {
+	AlgoID        string `json:"algoId"`
+	InstID        string `json:"instId"`
+	Side          string `json:"side"`
+	PosSide       string `json:"posSide"`
+	Sz            string `json:"sz"`
+	SlTriggerPx   string `json:"slTriggerPx"`
+	TpTriggerPx   string `json:"tpTriggerPx"`
+	CallbackRatio string `json:"callbackRatio"` // 追踪止损回调比例
+	ActivePx      string `json:"activePx"`      // 追踪止损激活价
+	State         string `json:"state"`
+}
+
+// getAlgoOrders 获取未触发的止损止盈条件单
+func (t *OKXTrader) getAlgoOrders(symbol string) ([]okxAlgoOrder, error) {
+	return t.getAlgoOrdersByType(symbol, "conditional")
+}
+
+// getAlgoOrdersByType 获取未触发的策略委托（ordType: conditional=止损止盈, move_order_stop=追踪止损）
+func (t *OKXTrader) getAlgoOrdersByType(symbol, ordType string) ([]okxAlgoOrder, error) {
+	data, err := t.get("/api/v5/trade/orders-algo-pending", map[string]string{
+		"ordType": ordType,
+		"instId":  okxInstID(symbol),
+	}, true)
+	if err != nil {
+		return nil, fmt.Errorf("获取条件单失败: %w", err)
+	}
+
+	var orders []okxAlgoOrder
+	if err := json.Unmarshal(data, &orders); err != nil {
+		return nil, fmt.Errorf("解析条件单失败: %w", err)
+	}
+	return orders, nil
+}
+
+// cancelAlgoOrders 批量取消条件单
+func (t *OKXTrader) cancelAlgoOrders(orders []okxAlgoOrder) error {
+	if len(orders) == 0 {
+		return nil
+	}
+
+	req := make([]map[string]string, 0, len(orders))
+	for _, o := range orders {
+		req = append(req, map[string]string{"algoId": o.AlgoID, "instId": o.InstID})
+	}
+
+	_, err := t.post("/api/v5/trade/cancel-algos", req)
+	return err
+}
+
+// CancelAllOrders 取消该币种的所有挂单（普通委托和条件单）
+func (t *OKXTrader) CancelAllOrders(symbol string) error {
+	instID := okxInstID(symbol)
+
+	data, err := t.get("/api/v5/trade/orders-pending", map[string]string{
+		"instType": "SWAP",
+		"instId":   instID,
+	}, true)
+	if err != nil {
+		return fmt.Errorf("获取未完成订单失败: %w", err)
+	}
+
+	var pending []struct {
+		OrdID string `json:"ordId"`
+	}
+	if err := json.Unmarshal(data, &pending); err != nil {
+		return fmt.Errorf("解析未完成订单失败: %w", err)
+	}
+	if len(pending) > 0 {
+		req := make([]map[string]string, 0, len(pending))
+		for _, o := range pending {
+			req = append(req, map[string]string{"instId": instID, "ordId": o.OrdID})
+		}
+		if _, err := t.post("/api/v5/trade/cancel-batch-orders", req); err != nil {
+			return fmt.Errorf("取消挂单失败: %w", err)
+		}
+	}
+
+	algoOrders, err := t.getAlgoOrders(symbol)
+	if err != nil {
+		return err
+	}
+	trailingOrders, err := t.getAlgoOrdersByType(symbol, "move_order_stop")
+	if err != nil {
+		return err
+	}
+	algoOrders = append(algoOrders, trailingOrders...)
+	if err := t.cancelAlgoOrders(algoOrders); err != nil {
+		return fmt.Errorf("取消条件单失败: %w", err)
+	}
+
+	if len(pending)+len(algoOrders) > 0 {
+		log.Printf("  ✓ 已取消 %s 的所有挂单", symbol)
+	}
+	return nil
+}
+
+// cancelAlgoOrdersByType 取消止损或止盈条件单
+func (t *OKXTrader) cancelAlgoOrdersByType(symbol string, stopLoss bool) error {
+	orders, err := t.getAlgoOrders(symbol)
+	if err != nil {
+		return err
+	}
+
+	label := "止盈"
+	if stopLoss {
+		label = "止损"
+	}
+
+	toCancel := []okxAlgoOrder{}
+	for _, o := range orders {
+		if (stopLoss && o.SlTriggerPx != "") || (!stopLoss && o.TpTriggerPx != "") {
+			toCancel = append(toCancel, o)
+		}
+	}
+
+	if len(toCancel) == 0 {
+		log.Printf("  ℹ %s 没有%s单需要取消", symbol, label)
+		return nil
+	}
+
+	if err := t.cancelAlgoOrders(toCancel); err != nil {
+		return fmt.Errorf("取消%s单失败: %w", label, err)
+	}
+
+	log.Printf("  ✓ 已取消 %s 的 %d 个%s单", symbol, len(toCancel), label)
+	return nil
+}
+
+// CancelStopLossOrders 仅取消止损单（不影响止盈单）
+func (t *OKXTrader) CancelStopLossOrders(symbol string) error {
+	return t.cancelAlgoOrdersByType(symbol, true)
+}
+
+// CancelTakeProfitOrders 仅取消止盈单（不影响止损单）
+func (t *OKXTrader) CancelTakeProfitOrders(symbol string) error {
+	return t.cancelAlgoOrdersByType(symbol, false)
+}
+
+// GetOpenOrders 获取指定币种的未触发条件单（止损/止盈/追踪止损）
+func (t *OKXTrader) GetOpenOrders(symbol string) ([]Order, error) {
+	algoOrders, err := t.getAlgoOrders(symbol)
+	if err != nil {
+		return nil, err
+	}
+	trailingOrders, err := t.getAlgoOrdersByType(symbol, "move_order_stop")
+	if err != nil {
+		return nil, err
+	}
+	algoOrders = append(algoOrders, trailingOrders...)
+
+	orders := make([]Order, 0, len(algoOrders))
+	for _, o := range algoOrders {
+		algoID, _ := strconv.ParseInt(o.AlgoID, 10, 64)
+		contracts, _ := strconv.ParseFloat(o.Sz, 64)
+
+		orderType := "TAKE_PROFIT_MARKET"
+		trigger := o.TpTriggerPx
+		if o.SlTriggerPx != "" {
+			orderType = "STOP_MARKET"
+			trigger = o.SlTriggerPx
+		}
+		stopPrice, _ := strconv.ParseFloat(trigger, 64)
+
+		var activationPrice, callbackRate float64
+		if o.CallbackRatio != "" {
+			orderType = CloseOrderTrailingStop
+			activationPrice, _ = strconv.ParseFloat(o.ActivePx, 64)
+			ratio, _ := strconv.ParseFloat(o.CallbackRatio, 64)
+			callbackRate = ratio * 100
+		}
+
+		orders = append(orders, Order{
+			OrderID:      algoID,
+			Symbol:       symbol,
+			Type:         orderType,
+			Side:         strings.ToUpper(o.Side),
+			PositionSide: strings.ToUpper(o.PosSide),
+			StopPrice:    stopPrice,
+			Quantity:     t.fromContracts(symbol, contracts),
+			Status:       o.State,
+
+			ActivationPrice: activationPrice,
+			CallbackRate:    callbackRate,
+		})
+	}
+
+	return orders, nil
+}
+
+// FormatQuantity 格式化数量（按合约张数步进取整后换算回币数量）
+func (t *OKXTrader) FormatQuantity(symbol string, quantity float64) (string, error) {
+	contracts, err := t.toContracts(symbol, quantity)
+	if err != nil {
+		return "", err
+	}
+
+	inst, err := t.getInstrument(symbol)
+	if err != nil {
+		return "", err
+	}
+
+	n, _ := strconv.ParseFloat(contracts, 64)
+	precision := inst.LotPrecision + calculatePrecision(strconv.FormatFloat(inst.CtVal, 'f', -1, 64))
+	return strconv.FormatFloat(n*inst.CtVal, 'f', precision, 64), nil
+}
+
+// GetTradeHistory 获取成交记录（/api/v5/trade/fills-history，最近3个月，按billId向前翻页）
+func (t *OKXTrader) GetTradeHistory(symbol string, start, end time.Time) ([]TradeFill, error) {
+	const limit = 100
+	fills := make([]TradeFill, 0)
+	after := ""
+	for {
+		params := map[string]string{
+			"instType": "SWAP",
+			"begin":    strconv.FormatInt(start.UnixMilli(), 10),
+			"end":      strconv.FormatInt(end.UnixMilli(), 10),
+			"limit":    strconv.Itoa(limit),
+		}
+		if symbol != "" {
+			params["instId"] = okxInstID(symbol)
+		}
+		if after != "" {
+			params["after"] = after
+		}
+		data, err := t.get("/api/v5/trade/fills-history", params, true)
+		if err != nil {
+			return nil, fmt.Errorf("获取成交记录失败: %w", err)
+		}
+
+		var list []struct {
+			InstID  string `json:"instId"`
+			TradeID string `json:"tradeId"`
+			OrdID   string `json:"ordId"`
+			BillID  string `json:"billId"`
+			Side    string `json:"side"`    // buy 或 sell
+			PosSide string `json:"posSide"` // long 或 short
+			FillPx  string `json:"fillPx"`
+			FillSz  string `json:"fillSz"` // 合约张数
+			FillPnl string `json:"fillPnl"`
+			Fee     string `json:"fee"` // 负数为扣除
+			FeeCcy  string `json:"feeCcy"`
+			Ts      string `json:"ts"`
+		}
+		if err := json.Unmarshal(data, &list); err != nil {
+			return nil, fmt.Errorf("解析成交记录失败: %w", err)
+		}
+
+		for _, f := range list {
+			sym := okxSymbol(f.InstID)
+			price, _ := strconv.ParseFloat(f.FillPx, 64)
+			contracts, _ := strconv.ParseFloat(f.FillSz, 64)
+			pnl, _ := strconv.ParseFloat(f.FillPnl, 64)
+			fee, _ := strconv.ParseFloat(f.Fee, 64)
+			tradeID, _ := strconv.ParseInt(f.TradeID, 10, 64)
+			orderID, _ := strconv.ParseInt(f.OrdID, 10, 64)
+			ts, _ := strconv.ParseInt(f.Ts, 10, 64)
+			side := strings.ToUpper(f.Side)
+			posSide := f.PosSide
+			if posSide != "long" && posSide != "short" {
+				posSide = binanceTradePositionSide("", side, pnl != 0)
+			}
+			fills = append(fills, TradeFill{
+				Symbol:       sym,
+				TradeID:      tradeID,
+				OrderID:      orderID,
+				Side:         side,
+				PositionSide: posSide,
+				Price:        price,
+				Quantity:     t.fromContracts(sym, contracts),
+				RealizedPnL:  pnl,
+				Fee:          -fee,
+				FeeAsset:     f.FeeCcy,
+				Time:         time.UnixMilli(ts),
+			})
+		}
+		if len(list) < limit {
+			break
+		}
+		after = list[len(list)-1].BillID
+	}
+
+	sortTradeFills(fills)
+	return fills, nil
+}
+
+// GetIncomeHistory 获取已实现盈亏、手续费和资金费流水（/api/v5/account/bills-archive）
+// 账单类型2为交易（pnl为已实现盈亏，fee为手续费），类型8为资金费
+func (t *OKXTrader) GetIncomeHistory(symbol string, start, end time.Time) ([]IncomeRecord, error) {
+	const limit = 100
+	records := make([]IncomeRecord, 0)
+	after := ""
+	for {
+		params := map[string]string{
+			"instType": "SWAP",
+			"begin":    strconv.FormatInt(start.UnixMilli(), 10),
+			"end":      strconv.FormatInt(end.UnixMilli(), 10),
+			"limit":    strconv.Itoa(limit),
+		}
+		if after != "" {
+			params["after"] = after
+		}
+		data, err := t.get("/api/v5/account/bills-archive", params, true)
+		if err != nil {
+			return nil, fmt.Errorf("获取资金流水失败: %w", err)
+		}
+
+		var list []struct {
+			BillID string `json:"billId"`
+			InstID string `json:"instId"`
+			Type   string `json:"type"`
+			Pnl    string `json:"pnl"`
+			Fee    string `json:"fee"`
+			BalChg string `json:"balChg"`
+			Ccy    string `json:"ccy"`
+			Ts     string `json:"ts"`
+		}
+		if err := json.Unmarshal(data, &list); err != nil {
+			return nil, fmt.Errorf("解析资金流水失败: %w", err)
+		}
+
+		for _, b := range list {
+			sym := okxSymbol(b.InstID)
+			if symbol != "" && sym != symbol {
+				continue
+			}
+			ts, _ := strconv.ParseInt(b.Ts, 10, 64)
+			record := IncomeRecord{Symbol: sym, Asset: b.Ccy, Time: time.UnixMilli(ts)}
+			switch b.Type {
+			case "2":
+				if pnl, _ := strconv.ParseFloat(b.Pnl, 64); pnl != 0 {
+					record.Type, record.Amount = IncomeRealizedPnL, pnl
+					records = append(records, record)
+				}
+				if fee, _ := strconv.ParseFloat(b.Fee, 64); fee != 0 {
+					record.Type, record.Amount = IncomeCommission, fee
+					records = append(records, record)
+				}
+			case "8":
+				if funding, _ := strconv.ParseFloat(b.BalChg, 64); funding != 0 {
+					record.Type, record.Amount = IncomeFunding, funding
+					records = append(records, record)
+				}
+			}
+		}
+		if len(list) < limit {
+			break
+		}
+		after = list[len(list)-1].BillID
+	}
+
+	sortIncome(records)
+	return records, nil
+}
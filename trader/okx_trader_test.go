@@ -0,0 +1,384 @@
+package trader
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// fakeOKX 本地模拟的OKX V5接口
+type fakeOKX struct {
+	t          *testing.T
+	apiKey     string
+	secretKey  string
+	passphrase string
+
+	mu         sync.Mutex
+	posMode    string
+	posts      map[string][]json.RawMessage // endpoint -> 请求body
+	algoOrders []map[string]string          // 未触发的条件单
+}
+
+func newFakeOKX(t *testing.T) (*fakeOKX, *OKXTrader) {
+	f := &fakeOKX{
+		t:          t,
+		apiKey:     "okx-key",
+		secretKey:  "okx-secret",
+		passphrase: "okx-pass",
+		posMode:    "net_mode",
+		posts:      make(map[string][]json.RawMessage),
+	}
+	server := httptest.NewServer(http.HandlerFunc(f.handle))
+	t.Cleanup(server.Close)
+
+	trader := NewOKXTrader(f.apiKey, f.secretKey, f.passphrase)
+	trader.baseURL = server.URL
+	return f, trader
+}
+
+func (f *fakeOKX) reply(w http.ResponseWriter, data interface{}) {
+	json.NewEncoder(w).Encode(map[string]interface{}{"code": "0", "msg": "", "data": data})
+}
+
+// verifySign 按OKX规则校验签名头
+func (f *fakeOKX) verifySign(r *http.Request, body string) bool {
+	ts := r.Header.Get("OK-ACCESS-TIMESTAMP")
+	if r.Header.Get("OK-ACCESS-KEY") != f.apiKey || r.Header.Get("OK-ACCESS-PASSPHRASE") != f.passphrase || ts == "" {
+		return false
+	}
+	requestPath := r.URL.Path
+	if r.URL.RawQuery != "" {
+		requestPath += "?" + r.URL.RawQuery
+	}
+	mac := hmac.New(sha256.New, []byte(f.secretKey))
+	mac.Write([]byte(ts + r.Method + requestPath + body))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil)) == r.Header.Get("OK-ACCESS-SIGN")
+}
+
+func (f *fakeOKX) handle(w http.ResponseWriter, r *http.Request) {
+	endpoint := r.URL.Path
+
+	// 公共接口无需签名
+	switch endpoint {
+	case "/api/v5/public/instruments":
+		ctVal := "0.01"
+		if r.URL.Query().Get("instId") == "ETH-USDT-SWAP" {
+			ctVal = "0.1"
+		}
+		f.reply(w, []map[string]string{{"instId": r.URL.Query().Get("instId"), "ctVal": ctVal, "lotSz": "1", "tickSz": "0.1"}})
+		return
+	case "/api/v5/market/ticker":
+		f.reply(w, []map[string]string{{"instId": "BTC-USDT-SWAP", "last": "65000.5"}})
+		return
+	}
+
+	raw, _ := io.ReadAll(r.Body)
+	if !f.verifySign(r, string(raw)) {
+		f.t.Errorf("%s %s 签名校验失败", r.Method, endpoint)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if r.Method == http.MethodPost {
+		f.mu.Lock()
+		f.posts[endpoint] = append(f.posts[endpoint], raw)
+		f.mu.Unlock()
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch endpoint {
+	case "/api/v5/account/config":
+		f.reply(w, []map[string]string{{"posMode": f.posMode}})
+	case "/api/v5/account/set-position-mode":
+		var body map[string]string
+		json.Unmarshal(raw, &body)
+		f.posMode = body["posMode"]
+		f.reply(w, []map[string]string{{"posMode": f.posMode}})
+	case "/api/v5/account/balance":
+		f.reply(w, []map[string]interface{}{{
+			"totalEq": "1020",
+			"details": []map[string]string{
+				{"ccy": "BTC", "cashBal": "1", "availEq": "1", "upl": "0"},
+				{"ccy": "USDT", "cashBal": "1000", "availEq": "750.5", "upl": "20"},
+			},
+		}})
+	case "/api/v5/account/positions":
+		f.reply(w, []map[string]string{
+			{"instId": "BTC-USDT-SWAP", "posSide": "long", "pos": "5", "avgPx": "60000", "markPx": "61000", "upl": "50", "lever": "10", "liqPx": "55000"},
+			{"instId": "ETH-USDT-SWAP", "posSide": "short", "pos": "3", "avgPx": "3000", "markPx": "2990", "upl": "3", "lever": "5", "liqPx": "3500"},
+			{"instId": "BTC-USD-SWAP", "posSide": "long", "pos": "1", "avgPx": "60000", "markPx": "61000", "upl": "0", "lever": "3", "liqPx": ""},
+		})
+	case "/api/v5/trade/order":
+		if r.Method == http.MethodGet {
+			f.reply(w, []map[string]string{{"ordId": "12345", "state": "filled", "avgPx": "65001", "accFillSz": "5"}})
+			return
+		}
+		f.reply(w, []map[string]string{{"ordId": "12345", "sCode": "0", "sMsg": ""}})
+	case "/api/v5/trade/order-algo":
+		f.reply(w, []map[string]string{{"algoId": "777", "sCode": "0", "sMsg": ""}})
+	case "/api/v5/trade/orders-pending":
+		f.reply(w, []map[string]string{})
+	case "/api/v5/trade/orders-algo-pending":
+		// 按ordType过滤（未指定ordType的条件单为conditional）
+		orders := []map[string]string{}
+		for _, o := range f.algoOrders {
+			ordType := o["ordType"]
+			if ordType == "" {
+				ordType = "conditional"
+			}
+			if ordType == r.URL.Query().Get("ordType") {
+				orders = append(orders, o)
+			}
+		}
+		f.reply(w, orders)
+	case "/api/v5/account/set-leverage":
+		f.reply(w, []map[string]string{{"lever": "10", "mgnMode": "cross"}})
+	case "/api/v5/trade/cancel-algos":
+		f.reply(w, []map[string]string{{"sCode": "0"}})
+	case "/api/v5/account/position/margin-balance":
+		f.reply(w, []map[string]string{{"instId": "BTC-USDT-SWAP", "type": "reduce"}})
+	default:
+		json.NewEncoder(w).Encode(map[string]interface{}{"code": "51000", "msg": "unexpected " + endpoint, "data": []interface{}{}})
+	}
+}
+
+func (f *fakeOKX) postsTo(endpoint string) []map[string]interface{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var bodies []map[string]interface{}
+	for _, raw := range f.posts[endpoint] {
+		var body map[string]interface{}
+		json.Unmarshal(raw, &body)
+		bodies = append(bodies, body)
+	}
+	return bodies
+}
+
+func TestOKXBalanceAndPositionsInCoins(t *testing.T) {
+	_, trader := newFakeOKX(t)
+
+	balance, err := trader.GetBalance()
+	if err != nil {
+		t.Fatalf("GetBalance失败: %v", err)
+	}
+	if balance.TotalWalletBalance != 1000 || balance.AvailableBalance != 750.5 || balance.TotalEquity() != 1020 {
+		t.Errorf("余额解析错误: %+v", balance)
+	}
+
+	positions, err := trader.GetPositions()
+	if err != nil {
+		t.Fatalf("GetPositions失败: %v", err)
+	}
+	if len(positions) != 2 {
+		t.Fatalf("应只返回USDT本位持仓，得到 %d 个", len(positions))
+	}
+	// 5张 * 0.01 = 0.05 BTC, 3张 * 0.1 = 0.3 ETH
+	if positions[0].Key() != "BTCUSDT_long" || !floatEq(positions[0].PositionAmt, 0.05) || positions[0].Leverage != 10 {
+		t.Errorf("BTC持仓换算错误: %+v", positions[0])
+	}
+	if positions[1].Key() != "ETHUSDT_short" || !floatEq(positions[1].PositionAmt, 0.3) {
+		t.Errorf("ETH持仓换算错误: %+v", positions[1])
+	}
+}
+
+func TestOKXOpenLongConvertsToContracts(t *testing.T) {
+	fake, trader := newFakeOKX(t)
+
+	result, err := trader.OpenLong("BTCUSDT", 0.0567, 10)
+	if err != nil {
+		t.Fatalf("OpenLong失败: %v", err)
+	}
+	if result.OrderID != 12345 || result.AvgPrice != 65001 || !floatEq(result.ExecutedQty, 0.05) {
+		t.Errorf("下单结果错误: %+v", result)
+	}
+
+	if n := len(fake.postsTo("/api/v5/account/set-position-mode")); n != 1 {
+		t.Errorf("应切换一次双向持仓模式，实际 %d 次", n)
+	}
+
+	orders := fake.postsTo("/api/v5/trade/order")
+	if len(orders) != 1 {
+		t.Fatalf("应下1个订单，实际 %d", len(orders))
+	}
+	// 0.0567 BTC / 0.01 = 5.67张 -> 向下取整为5张
+	order := orders[0]
+	if order["sz"] != "5" || order["side"] != "buy" || order["posSide"] != "long" || order["ordType"] != "market" {
+		t.Errorf("开多订单参数错误: %v", order)
+	}
+
+	if _, err := trader.OpenShort("BTCUSDT", 0.005, 10); err == nil {
+		t.Error("不足1张时应返回错误")
+	}
+}
+
+func TestOKXOneWayIsolatedModes(t *testing.T) {
+	fake, trader := newFakeOKX(t)
+
+	if err := trader.SetPositionMode(PositionModeOneWay); err != nil {
+		t.Fatalf("SetPositionMode失败: %v", err)
+	}
+	if err := trader.SetMarginMode("", MarginModeIsolated); err != nil {
+		t.Fatalf("SetMarginMode失败: %v", err)
+	}
+	// 账户已是net_mode，不应发起切换
+	if n := len(fake.postsTo("/api/v5/account/set-position-mode")); n != 0 {
+		t.Errorf("已是单向持仓时不应切换，实际 %d 次", n)
+	}
+
+	if _, err := trader.OpenLong("BTCUSDT", 0.05, 10); err != nil {
+		t.Fatalf("OpenLong失败: %v", err)
+	}
+	if _, err := trader.CloseLong("BTCUSDT", 0.05); err != nil {
+		t.Fatalf("CloseLong失败: %v", err)
+	}
+	if err := trader.SetStopLoss("BTCUSDT", "LONG", 0.05, 60000); err != nil {
+		t.Fatalf("SetStopLoss失败: %v", err)
+	}
+
+	lever := fake.postsTo("/api/v5/account/set-leverage")
+	if len(lever) != 1 || lever[0]["mgnMode"] != "isolated" || lever[0]["posSide"] != nil {
+		t.Errorf("单向持仓的逐仓杠杆参数错误: %v", lever)
+	}
+	orders := fake.postsTo("/api/v5/trade/order")
+	if len(orders) != 2 {
+		t.Fatalf("应下2个订单，实际 %d", len(orders))
+	}
+	if open := orders[0]; open["tdMode"] != "isolated" || open["posSide"] != "net" || open["reduceOnly"] != nil {
+		t.Errorf("开仓订单参数错误: %v", open)
+	}
+	if closeOrder := orders[1]; closeOrder["side"] != "sell" || closeOrder["posSide"] != "net" || closeOrder["reduceOnly"] != "true" {
+		t.Errorf("单向持仓平仓应为reduceOnly: %v", closeOrder)
+	}
+	if sl := fake.postsTo("/api/v5/trade/order-algo")[0]; sl["tdMode"] != "isolated" || sl["posSide"] != "net" || sl["reduceOnly"] != "true" {
+		t.Errorf("止损单参数错误: %v", sl)
+	}
+
+	if err := trader.AdjustIsolatedMargin("BTCUSDT", "LONG", -12.5); err != nil {
+		t.Fatalf("AdjustIsolatedMargin失败: %v", err)
+	}
+	margin := fake.postsTo("/api/v5/account/position/margin-balance")
+	if len(margin) != 1 || margin[0]["type"] != "reduce" || margin[0]["amt"] != "12.5000" || margin[0]["posSide"] != "net" {
+		t.Errorf("调整保证金参数错误: %v", margin)
+	}
+}
+
+func TestOKXStopLossAlgoOrder(t *testing.T) {
+	fake, trader := newFakeOKX(t)
+
+	if err := trader.SetStopLoss("ETHUSDT", "SHORT", 0.3, 3123.456); err != nil {
+		t.Fatalf("SetStopLoss失败: %v", err)
+	}
+	if err := trader.SetTakeProfit("ETHUSDT", "SHORT", 0.3, 2800); err != nil {
+		t.Fatalf("SetTakeProfit失败: %v", err)
+	}
+
+	algos := fake.postsTo("/api/v5/trade/order-algo")
+	if len(algos) != 2 {
+		t.Fatalf("应下2个条件单，实际 %d", len(algos))
+	}
+	sl, tp := algos[0], algos[1]
+	if sl["side"] != "buy" || sl["posSide"] != "short" || sl["sz"] != "3" || sl["slTriggerPx"] != "3123.5" || sl["slOrdPx"] != "-1" || sl["tpTriggerPx"] != nil {
+		t.Errorf("止损条件单参数错误: %v", sl)
+	}
+	if tp["tpTriggerPx"] != "2800.0" || tp["tpOrdPx"] != "-1" || tp["slTriggerPx"] != nil {
+		t.Errorf("止盈条件单参数错误: %v", tp)
+	}
+}
+
+func TestOKXOpenOrdersAndCancelStopLoss(t *testing.T) {
+	fake, trader := newFakeOKX(t)
+	fake.algoOrders = []map[string]string{
+		{"algoId": "101", "instId": "BTC-USDT-SWAP", "side": "sell", "posSide": "long", "sz": "5", "slTriggerPx": "58000", "tpTriggerPx": "", "state": "live"},
+		{"algoId": "102", "instId": "BTC-USDT-SWAP", "side": "sell", "posSide": "long", "sz": "5", "slTriggerPx": "", "tpTriggerPx": "70000", "state": "live"},
+	}
+
+	orders, err := trader.GetOpenOrders("BTCUSDT")
+	if err != nil {
+		t.Fatalf("GetOpenOrders失败: %v", err)
+	}
+	if len(orders) != 2 {
+		t.Fatalf("应返回2个条件单，实际 %d", len(orders))
+	}
+	if orders[0].OrderID != 101 || orders[0].Type != "STOP_MARKET" || orders[0].StopPrice != 58000 ||
+		orders[0].PositionSide != "LONG" || !floatEq(orders[0].Quantity, 0.05) {
+		t.Errorf("止损单解析错误: %+v", orders[0])
+	}
+	if orders[1].Type != "TAKE_PROFIT_MARKET" || orders[1].StopPrice != 70000 {
+		t.Errorf("止盈单解析错误: %+v", orders[1])
+	}
+
+	if err := trader.CancelStopLossOrders("BTCUSDT"); err != nil {
+		t.Fatalf("CancelStopLossOrders失败: %v", err)
+	}
+	fake.mu.Lock()
+	canceled := fake.posts["/api/v5/trade/cancel-algos"]
+	fake.mu.Unlock()
+	if len(canceled) != 1 || string(canceled[0]) != `[{"algoId":"101","instId":"BTC-USDT-SWAP"}]` {
+		t.Errorf("应只取消止损单: %s", canceled)
+	}
+}
+
+func TestOKXTrailingStopReplacesExisting(t *testing.T) {
+	fake, trader := newFakeOKX(t)
+	if err := trader.SetPositionMode(PositionModeOneWay); err != nil {
+		t.Fatalf("SetPositionMode失败: %v", err)
+	}
+	fake.algoOrders = []map[string]string{
+		{"algoId": "201", "instId": "BTC-USDT-SWAP", "ordType": "move_order_stop", "side": "sell", "posSide": "net", "sz": "5", "callbackRatio": "0.02", "state": "live"},
+	}
+
+	orders, err := trader.GetOpenOrders("BTCUSDT")
+	if err != nil || len(orders) != 1 {
+		t.Fatalf("应返回1个追踪止损单: %+v, %v", orders, err)
+	}
+	if orders[0].Type != CloseOrderTrailingStop || !floatEq(orders[0].CallbackRate, 2) {
+		t.Errorf("追踪止损单解析错误: %+v", orders[0])
+	}
+
+	if err := trader.SetTrailingStop("BTCUSDT", "LONG", 0.05, 66000, 1.5); err != nil {
+		t.Fatalf("SetTrailingStop失败: %v", err)
+	}
+	fake.mu.Lock()
+	canceled := fake.posts["/api/v5/trade/cancel-algos"]
+	fake.mu.Unlock()
+	if len(canceled) != 1 || string(canceled[0]) != `[{"algoId":"201","instId":"BTC-USDT-SWAP"}]` {
+		t.Errorf("应先取消原追踪止损: %s", canceled)
+	}
+	algos := fake.postsTo("/api/v5/trade/order-algo")
+	if len(algos) != 1 {
+		t.Fatalf("应下1个追踪止损单，实际 %d", len(algos))
+	}
+	if ts := algos[0]; ts["ordType"] != "move_order_stop" || ts["callbackRatio"] != "0.015" || ts["activePx"] != "66000.0" ||
+		ts["sz"] != "5" || ts["posSide"] != "net" || ts["reduceOnly"] != "true" {
+		t.Errorf("追踪止损参数错误: %v", ts)
+	}
+
+	// 多头激活价低于当前价会立即激活，直接拒绝
+	if err := trader.SetTrailingStop("BTCUSDT", "LONG", 0.05, 64000, 1); err == nil {
+		t.Error("多头激活价低于当前价应被拒绝")
+	}
+}
+
+func TestOKXFormatQuantity(t *testing.T) {
+	_, trader := newFakeOKX(t)
+
+	qty, err := trader.FormatQuantity("ETHUSDT", 0.3456)
+	if err != nil {
+		t.Fatalf("FormatQuantity失败: %v", err)
+	}
+	if qty != "0.3" {
+		t.Errorf("期望按整张取整为0.3，实际 %s", qty)
+	}
+}
+
+func floatEq(a, b float64) bool {
+	d := a - b
+	return d < 1e-9 && d > -1e-9
+}
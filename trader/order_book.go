@@ -0,0 +1,169 @@
+package trader
+
+import (
+	"fmt"
+	"log"
+	"nofx/logger"
+	"strconv"
+)
+
+// orderBookDepth 滑点检查获取的订单簿档数
+const orderBookDepth = 100
+
+// 滑点超限时的处理方式（AutoTraderConfig.SlippageAction）
+const (
+	SlippageDownsize = "downsize" // 缩小到滑点上限内能成交的数量
+	SlippageReject   = "reject"   // 拒绝下单
+)
+
+// Mid 买一和卖一的中间价（一侧为空时返回另一侧的最优价）
+func (b *OrderBook) Mid() float64 {
+	switch {
+	case len(b.Bids) > 0 && len(b.Asks) > 0:
+		return (b.Bids[0].Price + b.Asks[0].Price) / 2
+	case len(b.Bids) > 0:
+		return b.Bids[0].Price
+	case len(b.Asks) > 0:
+		return b.Asks[0].Price
+	}
+	return 0
+}
+
+// levels 市价单吃掉的一侧（买单吃卖盘，卖单吃买盘）
+func (b *OrderBook) levels(buy bool) []OrderBookLevel {
+	if buy {
+		return b.Asks
+	}
+	return b.Bids
+}
+
+// EstimateFill 估算市价单成交quantity的成交均价，返回均价和订单簿能成交的数量（深度不足时小于quantity）
+func (b *OrderBook) EstimateFill(buy bool, quantity float64) (avgPrice, filled float64) {
+	var notional float64
+	for _, level := range b.levels(buy) {
+		if filled >= quantity {
+			break
+		}
+		take := level.Quantity
+		if filled+take > quantity {
+			take = quantity - filled
+		}
+		notional += take * level.Price
+		filled += take
+	}
+	if filled > 0 {
+		avgPrice = notional / filled
+	}
+	return avgPrice, filled
+}
+
+// SlippageBps 成交均价相对中间价的滑点（基点，不利方向为正）
+func (b *OrderBook) SlippageBps(buy bool, avgPrice float64) float64 {
+	mid := b.Mid()
+	if mid <= 0 || avgPrice <= 0 {
+		return 0
+	}
+	if buy {
+		return (avgPrice - mid) / mid * 10000
+	}
+	return (mid - avgPrice) / mid * 10000
+}
+
+// MaxQuantityWithin 成交均价相对中间价的滑点不超过maxBps时，最多能成交的数量
+func (b *OrderBook) MaxQuantityWithin(buy bool, maxBps float64) float64 {
+	mid := b.Mid()
+	if mid <= 0 {
+		return 0
+	}
+	limit := mid * (1 + maxBps/10000) // 成交均价的上限（卖单为下限）
+	if !buy {
+		limit = mid * (1 - maxBps/10000)
+	}
+
+	var filled, notional float64
+	for _, level := range b.levels(buy) {
+		within := level.Price <= limit
+		if !buy {
+			within = level.Price >= limit
+		}
+		if within {
+			filled += level.Quantity
+			notional += level.Quantity * level.Price
+			continue
+		}
+		// 这一档会把均价推过上限：只取均价正好等于上限的部分 (notional + p*q) / (filled + q) = limit
+		if take := (limit*filled - notional) / (level.Price - limit); take > 0 {
+			if take > level.Quantity {
+				take = level.Quantity
+			}
+			filled += take
+		}
+		break
+	}
+	return filled
+}
+
+// parseBookLevels 解析 [价格, 数量, ...] 字符串数组格式的订单簿档位（币安、Aster、OKX、Bybit通用）
+// contractSize为每张合约的币数量（按币数量报价的交易所为1）
+func parseBookLevels(raw [][]string, contractSize float64) []OrderBookLevel {
+	levels := make([]OrderBookLevel, 0, len(raw))
+	for _, level := range raw {
+		if len(level) < 2 {
+			continue
+		}
+		price, err1 := strconv.ParseFloat(level[0], 64)
+		quantity, err2 := strconv.ParseFloat(level[1], 64)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		levels = append(levels, OrderBookLevel{Price: price, Quantity: quantity * contractSize})
+	}
+	return levels
+}
+
+// checkSlippage 按订单簿估算市价单的滑点，超过配置的上限时缩小数量或拒绝，返回实际下单数量
+// 未配置上限或交易所不支持订单簿时不检查；获取订单簿失败时只记录日志，按原数量下单
+func (at *AutoTrader) checkSlippage(symbol string, buy bool, quantity float64, actionRecord *logger.DecisionAction) (float64, error) {
+	maxBps := at.config.MaxSlippageBps
+	bookTrader, ok := at.trader.(OrderBookTrader)
+	if maxBps <= 0 || !ok {
+		return quantity, nil
+	}
+
+	book, err := bookTrader.GetOrderBook(symbol, orderBookDepth)
+	if err != nil {
+		log.Printf("  ⚠ 获取 %s 订单簿失败，跳过滑点检查: %v", symbol, err)
+		return quantity, nil
+	}
+	avgPrice, filled := book.EstimateFill(buy, quantity)
+	slippage := book.SlippageBps(buy, avgPrice)
+	actionRecord.SlippageBps = slippage
+	if filled >= quantity && slippage <= maxBps {
+		log.Printf("  📖 预计成交均价 %.4f，滑点 %.1f bps (上限 %.0f bps)", avgPrice, slippage, maxBps)
+		return quantity, nil
+	}
+
+	reason := fmt.Sprintf("预计滑点 %.1f bps 超过上限 %.0f bps", slippage, maxBps)
+	if filled < quantity {
+		reason = fmt.Sprintf("订单簿深度不足（%d档只能成交 %.4f / %.4f）", len(book.levels(buy)), filled, quantity)
+	}
+	if at.config.SlippageAction == SlippageReject {
+		return 0, fmt.Errorf("❌ %s %s，拒绝下单", symbol, reason)
+	}
+
+	downsized := book.MaxQuantityWithin(buy, maxBps)
+	if downsized > quantity {
+		downsized = quantity
+	}
+	mid := book.Mid()
+	if minNotional := effectiveCapabilities(at.trader).MinNotional; downsized <= 0 || downsized*mid < minNotional {
+		return 0, fmt.Errorf("❌ %s %s，缩小后的仓位(%.2f USDT)低于最小下单额，拒绝下单", symbol, reason, downsized*mid)
+	}
+
+	avgPrice, _ = book.EstimateFill(buy, downsized)
+	actionRecord.SlippageBps = book.SlippageBps(buy, avgPrice)
+	actionRecord.Quantity = downsized
+	actionRecord.SizeUSD = downsized * mid
+	log.Printf("  📖 %s %s，数量从 %.4f 缩小到 %.4f (预计滑点 %.1f bps)", symbol, reason, quantity, downsized, actionRecord.SlippageBps)
+	return downsized, nil
+}
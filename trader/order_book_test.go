@@ -0,0 +1,121 @@
+package trader
+
+import (
+	"nofx/logger"
+	"nofx/trader/fakeexchange"
+	"strings"
+	"testing"
+)
+
+// testBook 中间价60000的订单簿：卖盘 60010×0.5、60030×0.5、60100×5
+func testBook() []fakeexchange.BookLevel {
+	return []fakeexchange.BookLevel{{Price: 60010, Quantity: 0.5}, {Price: 60030, Quantity: 0.5}, {Price: 60100, Quantity: 5}}
+}
+
+func TestOrderBookEstimates(t *testing.T) {
+	book := &OrderBook{
+		Bids: []OrderBookLevel{{Price: 59990, Quantity: 1}, {Price: 59980, Quantity: 2}},
+		Asks: []OrderBookLevel{{Price: 60010, Quantity: 0.5}, {Price: 60030, Quantity: 0.5}, {Price: 60100, Quantity: 5}},
+	}
+	if !floatEq(book.Mid(), 60000) {
+		t.Fatalf("中间价错误: %f", book.Mid())
+	}
+
+	// 买2个：(0.5×60010 + 0.5×60030 + 1×60100) / 2 = 60060，滑点10bps
+	avg, filled := book.EstimateFill(true, 2)
+	if !floatEq(avg, 60060) || !floatEq(filled, 2) {
+		t.Errorf("买单成交估算错误: avg=%f filled=%f", avg, filled)
+	}
+	if bps := book.SlippageBps(true, avg); bps < 9.99 || bps > 10.01 {
+		t.Errorf("买单滑点错误: %f", bps)
+	}
+
+	// 卖单吃买盘，深度不足时只能成交3个
+	avg, filled = book.EstimateFill(false, 5)
+	if !floatEq(filled, 3) || avg < 59983.3 || avg > 59983.4 {
+		t.Errorf("卖单成交估算错误: avg=%f filled=%f", avg, filled)
+	}
+
+	// 5bps上限对应均价60030：前两档全部成交，第三档取 (60030×1 - 60020) / (60100 - 60030) = 1/7
+	if q := book.MaxQuantityWithin(true, 5); q < 1.1428 || q > 1.1429 {
+		t.Errorf("滑点上限内的数量错误: %f", q)
+	}
+	if q := book.MaxQuantityWithin(true, 1); q != 0 {
+		t.Errorf("卖一已超过滑点上限时应为0: %f", q)
+	}
+}
+
+func TestCheckSlippageDownsizesOrRejects(t *testing.T) {
+	ledger, trader := newFakeBinance(t)
+	ledger.SetOrderBook("BTCUSDT", []fakeexchange.BookLevel{{Price: 59990, Quantity: 1}}, testBook())
+
+	book, err := trader.GetOrderBook("BTCUSDT", orderBookDepth)
+	if err != nil {
+		t.Fatalf("获取订单簿失败: %v", err)
+	}
+	if len(book.Asks) != 3 || len(book.Bids) != 1 || !floatEq(book.Asks[0].Price, 60010) || !floatEq(book.Bids[0].Quantity, 1) {
+		t.Fatalf("订单簿解析错误: %+v", book)
+	}
+
+	at := &AutoTrader{trader: trader, config: AutoTraderConfig{MaxSlippageBps: 5, SlippageAction: SlippageDownsize}}
+
+	// 滑点在上限内，数量不变
+	var record logger.DecisionAction
+	quantity, err := at.checkSlippage("BTCUSDT", true, 0.5, &record)
+	if err != nil || !floatEq(quantity, 0.5) {
+		t.Errorf("滑点在上限内不应调整: %f %v", quantity, err)
+	}
+	if record.SlippageBps < 1.66 || record.SlippageBps > 1.67 {
+		t.Errorf("应记录预计滑点: %f", record.SlippageBps)
+	}
+
+	// 超过上限时缩小到上限内能成交的数量
+	record = logger.DecisionAction{}
+	quantity, err = at.checkSlippage("BTCUSDT", true, 2, &record)
+	if err != nil {
+		t.Fatalf("缩小数量失败: %v", err)
+	}
+	if quantity < 1.1428 || quantity > 1.1429 || !floatEq(record.Quantity, quantity) || record.SlippageBps > 5.0001 {
+		t.Errorf("缩小后的数量错误: %f %+v", quantity, record)
+	}
+
+	// 缩小后低于最小下单额时拒绝
+	at.config.MaxSlippageBps = 1
+	if _, err := at.checkSlippage("BTCUSDT", true, 2, &logger.DecisionAction{}); err == nil || !strings.Contains(err.Error(), "最小下单额") {
+		t.Errorf("缩小后低于最小下单额时应拒绝: %v", err)
+	}
+
+	// 拒绝模式
+	at.config = AutoTraderConfig{MaxSlippageBps: 5, SlippageAction: SlippageReject}
+	if _, err := at.checkSlippage("BTCUSDT", true, 2, &logger.DecisionAction{}); err == nil || !strings.Contains(err.Error(), "拒绝下单") {
+		t.Errorf("拒绝模式下应拒绝: %v", err)
+	}
+
+	// 未配置上限时不检查
+	at.config = AutoTraderConfig{}
+	if quantity, err := at.checkSlippage("BTCUSDT", true, 100, &logger.DecisionAction{}); err != nil || quantity != 100 {
+		t.Errorf("未配置上限时不应检查: %f %v", quantity, err)
+	}
+}
+
+func TestHyperliquidGetOrderBook(t *testing.T) {
+	server, trader := newFakeHyperliquid(t)
+	server.Ledger.SetOrderBook("BTCUSDT", []fakeexchange.BookLevel{{Price: 59990, Quantity: 1}}, testBook())
+
+	book, err := trader.GetOrderBook("BTCUSDT", 2)
+	if err != nil {
+		t.Fatalf("获取订单簿失败: %v", err)
+	}
+	if len(book.Asks) != 2 || len(book.Bids) != 1 || !floatEq(book.Asks[1].Price, 60030) || !floatEq(book.Mid(), 60000) {
+		t.Errorf("订单簿解析错误: %+v", book)
+	}
+
+	// 未设置订单簿的币种默认在当前价格上下各一档
+	book, err = trader.GetOrderBook("ETHUSDT", orderBookDepth)
+	if err != nil {
+		t.Fatalf("获取订单簿失败: %v", err)
+	}
+	if len(book.Bids) != 1 || len(book.Asks) != 1 || !floatEq(book.Mid(), 3000) {
+		t.Errorf("默认订单簿错误: %+v", book)
+	}
+}
@@ -0,0 +1,215 @@
+package trader
+
+import (
+	"fmt"
+	"log"
+	"nofx/logger"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// orphanSweeper 孤儿挂单清理：持仓被手动平仓、强平或止损止盈一侧触发后，另一侧保护单仍挂在交易所，
+// 后台定期对比每个交易过的币种的挂单和持仓，撤销已没有持仓的只减仓单和条件单（止损、止盈、追踪止损），
+// 每次撤单写入决策日志。限价开仓单不会被撤销
+type orphanSweeper struct {
+	mu       sync.Mutex
+	symbols  map[string]bool // 交易过的币种（出现过持仓或决策）
+	suspects map[string]bool // 上次检查已没有持仓的挂单 (symbol_orderID)
+	interval time.Duration
+	stop     chan struct{}
+
+	trader         Trader
+	name           string
+	decisionLogger *logger.DecisionLogger
+}
+
+// newOrphanSweeper 创建孤儿挂单清理（撤单记录写入decisionLogger）
+func newOrphanSweeper(t Trader, name string, decisionLogger *logger.DecisionLogger) *orphanSweeper {
+	return &orphanSweeper{
+		symbols:        make(map[string]bool),
+		suspects:       make(map[string]bool),
+		interval:       time.Minute,
+		trader:         t,
+		name:           name,
+		decisionLogger: decisionLogger,
+	}
+}
+
+// track 记录交易过的币种，之后每次清理都会检查它的挂单
+func (s *orphanSweeper) track(symbol string) {
+	if symbol == "" {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.symbols[symbol] = true
+}
+
+// trackedSymbols 交易过的币种（按字母排序）
+func (s *orphanSweeper) trackedSymbols() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	symbols := make([]string, 0, len(s.symbols))
+	for symbol := range s.symbols {
+		symbols = append(symbols, symbol)
+	}
+	sort.Strings(symbols)
+	return symbols
+}
+
+// start 启动后台清理（已启动时什么也不做）
+func (s *orphanSweeper) start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stop != nil {
+		return
+	}
+	s.stop = make(chan struct{})
+	go s.run(s.stop, s.interval)
+}
+
+// shutdown 停止后台清理
+func (s *orphanSweeper) shutdown() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+	}
+}
+
+// run 按interval轮询直到stop关闭
+func (s *orphanSweeper) run(stop <-chan struct{}, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			s.sweep()
+		}
+	}
+}
+
+// sweep 检查一次所有交易过的币种，撤销连续两次检查都没有持仓的保护单，返回撤单数量
+// 只在第二次确认后撤销：持仓接口可能有缓存，刚开仓时新挂的止损止盈单不能被误撤
+func (s *orphanSweeper) sweep() int {
+	positions, err := s.trader.GetPositions()
+	if err != nil {
+		log.Printf("  ⚠ [%s] 孤儿挂单清理获取持仓失败: %v", s.name, err)
+		return 0
+	}
+	open := make(map[string]bool, len(positions))
+	for _, pos := range positions {
+		open[pos.Key()] = true
+		s.track(pos.Symbol)
+	}
+
+	var orphans []Order
+	for _, symbol := range s.trackedSymbols() {
+		orders, err := s.trader.GetOpenOrders(symbol)
+		if err != nil {
+			log.Printf("  ⚠ [%s] 孤儿挂单清理获取 %s 挂单失败: %v", s.name, symbol, err)
+			continue
+		}
+		orphans = append(orphans, orphanedOrders(orders, open)...)
+	}
+
+	// 本次的孤儿挂单替换上次的，已恢复持仓或已消失的挂单不再跟踪
+	suspects := make(map[string]bool, len(orphans))
+	var confirmed []Order
+	s.mu.Lock()
+	for _, o := range orphans {
+		key := fmt.Sprintf("%s_%d", o.Symbol, o.OrderID)
+		if s.suspects[key] {
+			confirmed = append(confirmed, o)
+		} else {
+			suspects[key] = true
+		}
+	}
+	s.suspects = suspects
+	s.mu.Unlock()
+
+	if len(confirmed) == 0 {
+		return 0
+	}
+
+	record := &logger.DecisionRecord{
+		ExecutionLog: []string{},
+		Success:      true,
+		Realtime:     true,
+	}
+	cancelled := 0
+	for _, o := range confirmed {
+		action := logger.DecisionAction{
+			Action:    "cancel_orphan_order",
+			Symbol:    o.Symbol,
+			Quantity:  o.Quantity,
+			Price:     o.StopPrice,
+			OrderID:   o.OrderID,
+			Timestamp: time.Now(),
+		}
+		desc := fmt.Sprintf("%s %s %s (订单%d, 触发价%.4f, 数量%.4f)", o.Symbol, o.Type, o.Side, o.OrderID, o.StopPrice, o.Quantity)
+		if err := s.trader.CancelOrder(o.Symbol, o.OrderID); err != nil {
+			action.Error = err.Error()
+			record.Success = false
+			record.ExecutionLog = append(record.ExecutionLog, fmt.Sprintf("❌ 撤销孤儿挂单失败: %s: %v", desc, err))
+			log.Printf("  ⚠ [%s] 撤销孤儿挂单失败: %s: %v", s.name, desc, err)
+		} else {
+			action.Success = true
+			cancelled++
+			record.ExecutionLog = append(record.ExecutionLog, fmt.Sprintf("🧹 持仓已不存在，撤销孤儿挂单: %s", desc))
+			log.Printf("  🧹 [%s] 持仓已不存在，撤销孤儿挂单: %s", s.name, desc)
+		}
+		record.Decisions = append(record.Decisions, action)
+	}
+	if cancelled < len(confirmed) {
+		record.ErrorMessage = fmt.Sprintf("%d个孤儿挂单撤销失败", len(confirmed)-cancelled)
+	}
+
+	if err := s.decisionLogger.LogDecision(record); err != nil {
+		log.Printf("  ⚠ [%s] 保存孤儿挂单清理记录失败: %v", s.name, err)
+	}
+	return cancelled
+}
+
+// orphanedOrders 挂单中已没有对应持仓的保护单（open为持仓的symbol_side集合）
+func orphanedOrders(orders []Order, open map[string]bool) []Order {
+	var result []Order
+	for _, o := range orders {
+		if !isProtectiveOrder(o) {
+			continue
+		}
+		if !open[o.Symbol+"_"+protectedSide(o)] {
+			result = append(result, o)
+		}
+	}
+	return result
+}
+
+// isProtectiveOrder 是否为只能减仓的保护单（条件单或只减仓单），限价开仓单不算
+func isProtectiveOrder(o Order) bool {
+	if o.ReduceOnly {
+		return true
+	}
+	switch o.Type {
+	case CloseOrderStopMarket, CloseOrderStop, CloseOrderTakeProfitMarket, CloseOrderTakeProfit, CloseOrderTrailingStop:
+		return true
+	}
+	return false
+}
+
+// protectedSide 保护单对应的持仓方向（"long"/"short"），单向持仓的订单按平仓方向判断
+func protectedSide(o Order) string {
+	if o.PositionSide == "LONG" || o.PositionSide == "SHORT" {
+		return strings.ToLower(o.PositionSide)
+	}
+	if o.Side == "BUY" {
+		return "short"
+	}
+	return "long"
+}
@@ -0,0 +1,107 @@
+package trader
+
+import (
+	"nofx/logger"
+	"nofx/trader/fakeexchange"
+	"testing"
+)
+
+func TestOrphanSweeperCancelsProtectionAfterManualClose(t *testing.T) {
+	ledger, trader := newFakeBinance(t)
+	decisionLogger := logger.NewDecisionLogger(t.TempDir())
+	sweeper := newOrphanSweeper(trader, "test", decisionLogger)
+
+	if _, err := trader.OpenLong("BTCUSDT", 0.1, 10); err != nil {
+		t.Fatalf("开多仓失败: %v", err)
+	}
+	if err := trader.SetStopLoss("BTCUSDT", "LONG", 0.1, 58000); err != nil {
+		t.Fatalf("设置止损失败: %v", err)
+	}
+	if err := trader.SetTakeProfit("BTCUSDT", "LONG", 0.1, 63000); err != nil {
+		t.Fatalf("设置止盈失败: %v", err)
+	}
+	// 未成交的限价开仓单不属于保护单
+	entry, err := ledger.PlaceOrder(fakeexchange.OrderRequest{Symbol: "BTCUSDT", Side: "BUY", PositionSide: "LONG", Type: "LIMIT", TimeInForce: "GTC", Quantity: 0.1, Price: 55000})
+	if err != nil {
+		t.Fatalf("挂限价单失败: %v", err)
+	}
+
+	// 持仓仍在时不撤销
+	sweeper.sweep()
+	if n := sweeper.sweep(); n != 0 || len(ledger.OpenOrders("BTCUSDT")) != 3 {
+		t.Fatalf("持仓仍在，不应撤销挂单: %d %+v", n, ledger.OpenOrders("BTCUSDT"))
+	}
+
+	// 在交易所手动平仓，止损止盈单仍挂着
+	if _, err := ledger.PlaceOrder(fakeexchange.OrderRequest{Symbol: "BTCUSDT", Side: "SELL", PositionSide: "LONG", Type: "MARKET", Quantity: 0.1}); err != nil {
+		t.Fatalf("手动平仓失败: %v", err)
+	}
+	if n := sweeper.sweep(); n != 0 {
+		t.Fatalf("第一次发现孤儿挂单时不应立即撤销: %d", n)
+	}
+	if n := sweeper.sweep(); n != 2 {
+		t.Fatalf("应撤销止损止盈两个孤儿挂单: %d", n)
+	}
+	if orders := ledger.OpenOrders("BTCUSDT"); len(orders) != 1 || orders[0].OrderID != entry.OrderID {
+		t.Errorf("只应保留限价开仓单: %+v", orders)
+	}
+
+	records, err := decisionLogger.GetLatestRecords(10)
+	if err != nil || len(records) != 1 {
+		t.Fatalf("应写入一条撤单记录: %+v, %v", records, err)
+	}
+	record := records[0]
+	if !record.Realtime || !record.Success || len(record.Decisions) != 2 || len(record.ExecutionLog) != 2 {
+		t.Fatalf("撤单记录错误: %+v", record)
+	}
+	for _, d := range record.Decisions {
+		if d.Action != "cancel_orphan_order" || d.Symbol != "BTCUSDT" || d.OrderID == 0 || !d.Success {
+			t.Errorf("撤单动作错误: %+v", d)
+		}
+	}
+}
+
+func TestOrphanSweeperOneWayAfterTakeProfit(t *testing.T) {
+	ledger, trader := newFakeAster(t)
+	decisionLogger := logger.NewDecisionLogger(t.TempDir())
+	sweeper := newOrphanSweeper(trader, "test", decisionLogger)
+	sweeper.track("BTCUSDT")
+
+	if _, err := trader.OpenShort("BTCUSDT", 0.05, 5); err != nil {
+		t.Fatalf("开空仓失败: %v", err)
+	}
+	if err := trader.SetStopLoss("BTCUSDT", "SHORT", 0.05, 62000); err != nil {
+		t.Fatalf("设置止损失败: %v", err)
+	}
+	if err := trader.SetTakeProfit("BTCUSDT", "SHORT", 0.05, 57000); err != nil {
+		t.Fatalf("设置止盈失败: %v", err)
+	}
+
+	// 止盈触发，止损单仍挂着（单向持仓的订单按平仓方向对应空仓）
+	ledger.SetPrice("BTCUSDT", 56500)
+	orders := ledger.OpenOrders("BTCUSDT")
+	if len(orders) != 1 {
+		t.Fatalf("止盈触发后应剩下止损单: %+v", orders)
+	}
+	sweeper.sweep()
+	if n := sweeper.sweep(); n != 1 || len(ledger.OpenOrders("BTCUSDT")) != 0 {
+		t.Errorf("剩余的止损单应被撤销: %d %+v", n, ledger.OpenOrders("BTCUSDT"))
+	}
+	if records, _ := decisionLogger.GetLatestRecords(10); len(records) != 1 || records[0].Decisions[0].OrderID != orders[0].OrderID {
+		t.Errorf("撤单记录错误: %+v", records)
+	}
+}
+
+func TestOrphanedOrdersMatchesPositionSide(t *testing.T) {
+	orders := []Order{
+		{OrderID: 1, Symbol: "ETHUSDT", Type: CloseOrderStopMarket, Side: "SELL", PositionSide: "LONG"},
+		{OrderID: 2, Symbol: "ETHUSDT", Type: CloseOrderStopMarket, Side: "BUY", PositionSide: "SHORT"},
+		{OrderID: 3, Symbol: "ETHUSDT", Type: CloseOrderTrailingStop, Side: "BUY"},
+		{OrderID: 4, Symbol: "ETHUSDT", Type: "LIMIT", Side: "SELL", ReduceOnly: true},
+		{OrderID: 5, Symbol: "ETHUSDT", Type: "LIMIT", Side: "BUY"},
+	}
+	orphans := orphanedOrders(orders, map[string]bool{"ETHUSDT_long": true})
+	if len(orphans) != 2 || orphans[0].OrderID != 2 || orphans[1].OrderID != 3 {
+		t.Errorf("孤儿挂单错误: %+v", orphans)
+	}
+}
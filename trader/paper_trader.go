@@ -0,0 +1,1119 @@
+package trader
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"nofx/market"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PaperTrader 模拟盘交易器（虚拟资金，不连接任何交易所）
+// 使用 market.Get 的实时价格成交，支持滑点、手续费、资金费率、止盈止损触发和强平
+type PaperTrader struct {
+	mu sync.Mutex
+
+	walletBalance float64                   // 钱包余额（已实现盈亏、手续费、资金费都计入这里）
+	positions     map[string]*paperPosition // symbol_side -> 持仓
+	orders        []*paperOrder             // 挂着的止盈止损单和限价开仓单
+	orderResults  map[int64]*OrderResult    // 订单ID -> 订单状态（供GetOrder查询）
+	leverages     map[string]int            // symbol -> 杠杆
+	nextOrderID   int64
+	fills         []TradeFill    // 成交记录（供GetTradeHistory查询）
+	income        []IncomeRecord // 已实现盈亏、手续费、资金费流水（供GetIncomeHistory查询）
+
+	slippage              float64       // 滑点（比例，如0.0005表示5bps）
+	feeRate               float64       // 吃单手续费率
+	maintenanceMarginRate float64       // 维持保证金率
+	fundingInterval       time.Duration // 资金费结算周期（行情源为Hyperliquid，按小时结算）
+
+	// 行情缓存（market.Get 需要多次请求，避免同一周期内重复拉取）
+	quoteCache      map[string]paperQuote
+	quoteCacheMutex sync.Mutex
+	cacheDuration   time.Duration
+
+	// fetchQuote 获取最新价格和资金费率（默认使用 market.Get）
+	fetchQuote func(symbol string) (price float64, fundingRate float64, err error)
+
+	// 保证金模式和持仓模式（强平始终按逐仓计算）
+	tradingModes
+
+	// 开平仓订单的客户端订单ID（与实盘一致地记录，便于追溯决策）
+	clientOrderIDs
+}
+
+// paperPosition 模拟持仓
+type paperPosition struct {
+	Symbol          string
+	Side            string // "long" 或 "short"
+	Quantity        float64
+	EntryPrice      float64
+	MarkPrice       float64
+	Leverage        int
+	ExtraMargin     float64 // 通过AdjustIsolatedMargin追加的保证金
+	FundingPaid     float64 // 累计支付的资金费（负数表示收到）
+	LastFundingTime time.Time
+}
+
+// paperOrder 模拟挂单（止盈止损单或限价开仓单）
+type paperOrder struct {
+	OrderID      int64
+	Symbol       string
+	PositionSide string // "LONG" 或 "SHORT"
+	Type         string // "STOP_MARKET"、"TAKE_PROFIT_MARKET"、"TRAILING_STOP_MARKET" 或 "LIMIT"
+	StopPrice    float64
+	Price        float64 // 限价单价格
+	Quantity     float64
+	Leverage     int           // 限价开仓单成交时使用的杠杆
+	trailing     *trailingStop // 追踪止损状态（仅TRAILING_STOP_MARKET）
+}
+
+// paperQuote 行情缓存
+type paperQuote struct {
+	price       float64
+	fundingRate float64
+	time        time.Time
+}
+
+// NewPaperTrader 创建模拟盘交易器
+// initialBalance: 虚拟初始资金
+// slippageBps: 市价成交滑点（基点，1bp=0.01%，<=0时使用默认5bps）
+// feeRate: 手续费率（如0.0005表示0.05%，<=0时使用默认0.05%）
+func NewPaperTrader(initialBalance, slippageBps, feeRate float64) *PaperTrader {
+	if slippageBps <= 0 {
+		slippageBps = 5
+	}
+	if feeRate <= 0 {
+		feeRate = 0.0005
+	}
+
+	t := &PaperTrader{
+		walletBalance:         initialBalance,
+		positions:             make(map[string]*paperPosition),
+		orderResults:          make(map[int64]*OrderResult),
+		leverages:             make(map[string]int),
+		nextOrderID:           1,
+		slippage:              slippageBps / 10000,
+		feeRate:               feeRate,
+		maintenanceMarginRate: 0.005,     // 0.5% 维持保证金率
+		fundingInterval:       time.Hour, // Hyperliquid 每小时结算资金费
+		quoteCache:            make(map[string]paperQuote),
+		cacheDuration:         10 * time.Second,
+		tradingModes:          tradingModes{marginMode: MarginModeIsolated, positionMode: PositionModeHedge, positionReady: true},
+	}
+	t.fetchQuote = func(symbol string) (float64, float64, error) {
+		data, err := market.Get(symbol, 0)
+		if err != nil {
+			return 0, 0, err
+		}
+		return data.CurrentPrice, data.FundingRate, nil
+	}
+
+	log.Printf("✓ 模拟盘交易器初始化成功 (初始资金=%.2f, 滑点=%.1fbps, 手续费率=%.4f%%)",
+		initialBalance, slippageBps, feeRate*100)
+	return t
+}
+
+// getQuote 获取行情（带缓存）
+func (t *PaperTrader) getQuote(symbol string) (paperQuote, error) {
+	t.quoteCacheMutex.Lock()
+	if q, ok := t.quoteCache[symbol]; ok && time.Since(q.time) < t.cacheDuration {
+		t.quoteCacheMutex.Unlock()
+		return q, nil
+	}
+	t.quoteCacheMutex.Unlock()
+
+	price, fundingRate, err := t.fetchQuote(symbol)
+	if err != nil {
+		return paperQuote{}, fmt.Errorf("获取 %s 行情失败: %w", symbol, err)
+	}
+	if price <= 0 {
+		return paperQuote{}, fmt.Errorf("%s 价格无效: %.8f", symbol, price)
+	}
+
+	q := paperQuote{price: price, fundingRate: fundingRate, time: time.Now()}
+	t.quoteCacheMutex.Lock()
+	t.quoteCache[symbol] = q
+	t.quoteCacheMutex.Unlock()
+	return q, nil
+}
+
+// refresh 刷新所有持仓的标记价格，并依次处理止盈止损触发、强平和资金费
+func (t *PaperTrader) refresh() error {
+	t.mu.Lock()
+	symbols := make(map[string]bool)
+	for _, pos := range t.positions {
+		symbols[pos.Symbol] = true
+	}
+	for _, order := range t.orders {
+		symbols[order.Symbol] = true
+	}
+	t.mu.Unlock()
+
+	quotes := make(map[string]paperQuote, len(symbols))
+	for symbol := range symbols {
+		q, err := t.getQuote(symbol)
+		if err != nil {
+			return err
+		}
+		quotes[symbol] = q
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for symbol, q := range quotes {
+		t.settleLocked(symbol, q)
+	}
+	return nil
+}
+
+// settleLocked 用最新行情结算单个币种（调用方需持有锁）
+func (t *PaperTrader) settleLocked(symbol string, q paperQuote) {
+	now := time.Now()
+
+	for _, side := range []string{"long", "short"} {
+		pos, ok := t.positions[symbol+"_"+side]
+		if !ok {
+			continue
+		}
+		pos.MarkPrice = q.price
+	}
+
+	// 1. 限价开仓单成交、止盈止损触发
+	t.fillLimitOrdersLocked(symbol, q.price)
+	t.triggerOrdersLocked(symbol, q.price)
+
+	for _, side := range []string{"long", "short"} {
+		key := symbol + "_" + side
+		pos, ok := t.positions[key]
+		if !ok {
+			continue
+		}
+
+		// 2. 强平检查
+		liqPrice := t.liquidationPrice(pos)
+		if (side == "long" && q.price <= liqPrice) || (side == "short" && q.price >= liqPrice) {
+			margin := paperMargin(pos)
+			t.walletBalance -= margin
+			t.recordIncomeLocked(symbol, IncomeRealizedPnL, -margin, now)
+			delete(t.positions, key)
+			t.removeStopOrdersLocked(symbol, sideToPositionSide(side))
+			log.Printf("💥 [模拟盘] %s %s 触发强平: 标记价=%.4f 强平价=%.4f, 损失保证金 %.2f USDT",
+				symbol, side, q.price, liqPrice, margin)
+			continue
+		}
+
+		// 3. 资金费结算（多头在费率为正时支付，空头收取）
+		if q.fundingRate != 0 && now.Sub(pos.LastFundingTime) >= t.fundingInterval {
+			periods := math.Floor(now.Sub(pos.LastFundingTime).Hours() / t.fundingInterval.Hours())
+			payment := pos.Quantity * q.price * q.fundingRate * periods
+			if side == "short" {
+				payment = -payment
+			}
+			t.walletBalance -= payment
+			t.recordIncomeLocked(symbol, IncomeFunding, -payment, now)
+			pos.FundingPaid += payment
+			pos.LastFundingTime = pos.LastFundingTime.Add(time.Duration(periods) * t.fundingInterval)
+			log.Printf("  💸 [模拟盘] %s %s 资金费结算: %.4f USDT (费率=%.6f, %d期)",
+				symbol, side, -payment, q.fundingRate, int(periods))
+		}
+	}
+}
+
+// triggerOrdersLocked 检查并执行触发的止盈止损单（调用方需持有锁）
+func (t *PaperTrader) triggerOrdersLocked(symbol string, price float64) {
+	remaining := t.orders[:0]
+	var triggered []*paperOrder
+	for _, order := range t.orders {
+		if order.Symbol == symbol && order.Type != "LIMIT" && isPaperOrderTriggered(order, price) {
+			triggered = append(triggered, order)
+			continue
+		}
+		remaining = append(remaining, order)
+	}
+	t.orders = remaining
+
+	for _, order := range triggered {
+		side := "long"
+		if order.PositionSide == "SHORT" {
+			side = "short"
+		}
+		pos, ok := t.positions[symbol+"_"+side]
+		if !ok {
+			continue
+		}
+
+		quantity := order.Quantity
+		if quantity <= 0 || quantity > pos.Quantity {
+			quantity = pos.Quantity
+		}
+
+		fillPrice := t.closeFillPrice(side, price)
+		pnl := t.reduceLocked(order.OrderID, pos, quantity, fillPrice)
+		orderName := "止损"
+		switch order.Type {
+		case "TAKE_PROFIT_MARKET":
+			orderName = "止盈"
+		case CloseOrderTrailingStop:
+			orderName = "追踪止损"
+		}
+		log.Printf("  🎯 [模拟盘] %s %s %s单触发: 触发价=%.4f 成交价=%.4f 数量=%.4f 盈亏=%.2f USDT",
+			symbol, side, orderName, order.StopPrice, fillPrice, quantity, pnl)
+	}
+}
+
+// fillLimitOrdersLocked 检查并成交价格到达的限价开仓单（按限价成交）（调用方需持有锁）
+func (t *PaperTrader) fillLimitOrdersLocked(symbol string, price float64) {
+	remaining := t.orders[:0]
+	var filled []*paperOrder
+	for _, order := range t.orders {
+		if order.Symbol == symbol && order.Type == "LIMIT" && isPaperLimitMarketable(order.PositionSide, order.Price, price) {
+			filled = append(filled, order)
+			continue
+		}
+		remaining = append(remaining, order)
+	}
+	t.orders = remaining
+
+	for _, order := range filled {
+		side := "long"
+		if order.PositionSide == "SHORT" {
+			side = "short"
+		}
+		result := t.orderResults[order.OrderID]
+		if err := t.addPositionLocked(order.OrderID, symbol, side, order.Quantity, order.Price, price, order.Leverage); err != nil {
+			result.Status = OrderStatusCanceled
+			log.Printf("  ⚠ [模拟盘] %s %s 限价单 %d 无法成交，已取消: %v", symbol, side, order.OrderID, err)
+			continue
+		}
+		result.Status = OrderStatusFilled
+		result.AvgPrice = order.Price
+		result.ExecutedQty = order.Quantity
+		result.Fee = order.Price * order.Quantity * t.feeRate
+		result.FeeAsset = "USDT"
+		log.Printf("  🎯 [模拟盘] %s %s 限价开仓单成交: 限价=%.4f 市价=%.4f 数量=%.4f",
+			symbol, side, order.Price, price, order.Quantity)
+	}
+}
+
+// isPaperLimitMarketable 判断限价开仓单在当前价格下能否成交（买入价不低于市价、卖出价不高于市价）
+func isPaperLimitMarketable(positionSide string, limitPrice, price float64) bool {
+	if positionSide == "LONG" {
+		return price <= limitPrice
+	}
+	return price >= limitPrice
+}
+
+// isPaperOrderTriggered 判断止盈止损单是否触发（追踪止损单同时按最新价格移动触发价）
+func isPaperOrderTriggered(order *paperOrder, price float64) bool {
+	if order.trailing != nil {
+		triggered := order.trailing.update(price)
+		order.StopPrice = order.trailing.stopPrice()
+		return triggered
+	}
+	isLong := order.PositionSide == "LONG"
+	if order.Type == "STOP_MARKET" {
+		if isLong {
+			return price <= order.StopPrice
+		}
+		return price >= order.StopPrice
+	}
+	if isLong {
+		return price >= order.StopPrice
+	}
+	return price <= order.StopPrice
+}
+
+// liquidationPrice 计算强平价格（逐仓，追加的保证金使强平价远离开仓价）
+func (t *PaperTrader) liquidationPrice(pos *paperPosition) float64 {
+	if pos.Leverage <= 0 {
+		return 0
+	}
+	extra := 0.0
+	if pos.Quantity > 0 {
+		extra = pos.ExtraMargin / pos.Quantity
+	}
+	if pos.Side == "long" {
+		return math.Max(0, pos.EntryPrice*(1-1/float64(pos.Leverage)+t.maintenanceMarginRate)-extra)
+	}
+	return pos.EntryPrice*(1+1/float64(pos.Leverage)-t.maintenanceMarginRate) + extra
+}
+
+// paperMargin 持仓占用的保证金（开仓保证金 + 追加保证金）
+func paperMargin(pos *paperPosition) float64 {
+	return pos.EntryPrice*pos.Quantity/float64(pos.Leverage) + pos.ExtraMargin
+}
+
+// openFillPrice 开仓成交价（多头买入价格上滑，空头卖出价格下滑）
+func (t *PaperTrader) openFillPrice(side string, price float64) float64 {
+	if side == "long" {
+		return price * (1 + t.slippage)
+	}
+	return price * (1 - t.slippage)
+}
+
+// closeFillPrice 平仓成交价（平多卖出价格下滑，平空买入价格上滑）
+func (t *PaperTrader) closeFillPrice(side string, price float64) float64 {
+	if side == "long" {
+		return price * (1 - t.slippage)
+	}
+	return price * (1 + t.slippage)
+}
+
+// reduceLocked 减少持仓并结算盈亏和手续费，返回本次已实现盈亏（调用方需持有锁）
+func (t *PaperTrader) reduceLocked(orderID int64, pos *paperPosition, quantity, fillPrice float64) float64 {
+	pnl := (fillPrice - pos.EntryPrice) * quantity
+	if pos.Side == "short" {
+		pnl = -pnl
+	}
+	fee := fillPrice * quantity * t.feeRate
+	t.walletBalance += pnl - fee
+	t.recordFillLocked(orderID, pos.Symbol, pos.Side, true, quantity, fillPrice, pnl, fee)
+
+	// 追加的保证金按剩余仓位比例保留
+	pos.ExtraMargin *= math.Max(0, pos.Quantity-quantity) / pos.Quantity
+	pos.Quantity -= quantity
+	if pos.Quantity <= 1e-12 {
+		delete(t.positions, pos.Symbol+"_"+pos.Side)
+		// 仓位已全部平掉，清理该方向的止盈止损单
+		t.removeStopOrdersLocked(pos.Symbol, sideToPositionSide(pos.Side))
+	}
+	return pnl - fee
+}
+
+// recordFillLocked 记录成交及对应的已实现盈亏和手续费流水（调用方需持有锁）
+func (t *PaperTrader) recordFillLocked(orderID int64, symbol, side string, isClose bool, quantity, price, pnl, fee float64) {
+	now := time.Now()
+	tradeSide := "BUY"
+	if (side == "long") == isClose {
+		tradeSide = "SELL"
+	}
+	t.fills = append(t.fills, TradeFill{
+		Symbol:       symbol,
+		TradeID:      int64(len(t.fills) + 1),
+		OrderID:      orderID,
+		Side:         tradeSide,
+		PositionSide: side,
+		Price:        price,
+		Quantity:     quantity,
+		RealizedPnL:  pnl,
+		Fee:          fee,
+		FeeAsset:     "USDT",
+		Time:         now,
+	})
+	if isClose {
+		t.recordIncomeLocked(symbol, IncomeRealizedPnL, pnl, now)
+	}
+	t.recordIncomeLocked(symbol, IncomeCommission, -fee, now)
+}
+
+// recordIncomeLocked 记录一条资金流水（调用方需持有锁）
+func (t *PaperTrader) recordIncomeLocked(symbol string, incomeType IncomeType, amount float64, ts time.Time) {
+	if amount == 0 {
+		return
+	}
+	t.income = append(t.income, IncomeRecord{Symbol: symbol, Type: incomeType, Amount: amount, Asset: "USDT", Time: ts})
+}
+
+// removeOrdersLocked 删除符合条件的挂单（positionSide/orderType为空表示不限）（调用方需持有锁）
+// 被删除的限价开仓单记为已取消
+func (t *PaperTrader) removeOrdersLocked(symbol, positionSide, orderType string) int {
+	remaining := t.orders[:0]
+	removed := 0
+	for _, order := range t.orders {
+		if order.Symbol == symbol &&
+			(positionSide == "" || order.PositionSide == positionSide) &&
+			(orderType == "" || order.Type == orderType) {
+			if result, ok := t.orderResults[order.OrderID]; ok && result.IsOpen() {
+				result.Status = OrderStatusCanceled
+			}
+			removed++
+			continue
+		}
+		remaining = append(remaining, order)
+	}
+	t.orders = remaining
+	return removed
+}
+
+// removeStopOrdersLocked 删除某方向的止盈止损单（不影响限价开仓单）（调用方需持有锁）
+func (t *PaperTrader) removeStopOrdersLocked(symbol, positionSide string) {
+	t.removeOrdersLocked(symbol, positionSide, "STOP_MARKET")
+	t.removeOrdersLocked(symbol, positionSide, "TAKE_PROFIT_MARKET")
+	t.removeOrdersLocked(symbol, positionSide, CloseOrderTrailingStop)
+}
+
+// sideToPositionSide "long" -> "LONG", "short" -> "SHORT"
+func sideToPositionSide(side string) string {
+	if side == "long" {
+		return "LONG"
+	}
+	return "SHORT"
+}
+
+// GetBalance 获取账户余额
+func (t *PaperTrader) GetBalance() (*Balance, error) {
+	if err := t.refresh(); err != nil {
+		return nil, err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	totalUnrealized := 0.0
+	totalMarginUsed := 0.0
+	for _, pos := range t.positions {
+		totalUnrealized += paperUnrealizedPnL(pos)
+		totalMarginUsed += paperMargin(pos)
+	}
+
+	available := t.walletBalance + totalUnrealized - totalMarginUsed
+	if available < 0 {
+		available = 0
+	}
+
+	result := &Balance{
+		TotalWalletBalance:    t.walletBalance,
+		AvailableBalance:      available,
+		TotalUnrealizedProfit: totalUnrealized,
+	}
+
+	log.Printf("✓ 模拟盘账户: 钱包=%.2f, 可用=%.2f, 未实现盈亏=%.2f, 保证金占用=%.2f",
+		t.walletBalance, available, totalUnrealized, totalMarginUsed)
+
+	return result, nil
+}
+
+// paperUnrealizedPnL 计算持仓未实现盈亏
+func paperUnrealizedPnL(pos *paperPosition) float64 {
+	pnl := (pos.MarkPrice - pos.EntryPrice) * pos.Quantity
+	if pos.Side == "short" {
+		return -pnl
+	}
+	return pnl
+}
+
+// GetPositions 获取所有持仓
+func (t *PaperTrader) GetPositions() ([]Position, error) {
+	if err := t.refresh(); err != nil {
+		return nil, err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	keys := make([]string, 0, len(t.positions))
+	for key := range t.positions {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var result []Position
+	for _, key := range keys {
+		pos := t.positions[key]
+		result = append(result, Position{
+			Symbol:           pos.Symbol,
+			Side:             pos.Side,
+			PositionAmt:      pos.Quantity,
+			EntryPrice:       pos.EntryPrice,
+			MarkPrice:        pos.MarkPrice,
+			UnRealizedProfit: paperUnrealizedPnL(pos),
+			Leverage:         pos.Leverage,
+			LiquidationPrice: t.liquidationPrice(pos),
+		})
+	}
+
+	return result, nil
+}
+
+// SetLeverage 设置杠杆
+func (t *PaperTrader) SetLeverage(symbol string, leverage int) error {
+	if leverage <= 0 {
+		return fmt.Errorf("杠杆必须大于0: %d", leverage)
+	}
+
+	t.mu.Lock()
+	t.leverages[symbol] = leverage
+	t.mu.Unlock()
+
+	log.Printf("  ✓ [模拟盘] %s 杠杆已切换为 %dx", symbol, leverage)
+	return nil
+}
+
+// OpenLong 开多仓
+func (t *PaperTrader) OpenLong(symbol string, quantity float64, leverage int) (*OrderResult, error) {
+	return t.withClientOrderID(t.open(symbol, "long", quantity, leverage))
+}
+
+// OpenShort 开空仓
+func (t *PaperTrader) OpenShort(symbol string, quantity float64, leverage int) (*OrderResult, error) {
+	return t.withClientOrderID(t.open(symbol, "short", quantity, leverage))
+}
+
+// open 市价开仓（同方向已有持仓时加仓并重新计算均价）
+func (t *PaperTrader) open(symbol, side string, quantity float64, leverage int) (*OrderResult, error) {
+	if quantity <= 0 {
+		return nil, fmt.Errorf("开仓数量必须大于0: %.8f", quantity)
+	}
+
+	// 先取消该币种的所有委托单（与实盘交易器行为一致）
+	if err := t.CancelAllOrders(symbol); err != nil {
+		log.Printf("  ⚠ 取消旧委托单失败: %v", err)
+	}
+
+	if err := t.SetLeverage(symbol, leverage); err != nil {
+		return nil, err
+	}
+
+	q, err := t.getQuote(symbol)
+	if err != nil {
+		return nil, err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.settleLocked(symbol, q)
+
+	orderID := t.nextOrderID
+	fillPrice := t.openFillPrice(side, q.price)
+	if err := t.addPositionLocked(orderID, symbol, side, quantity, fillPrice, q.price, leverage); err != nil {
+		return nil, err
+	}
+	fee := fillPrice * quantity * t.feeRate
+	t.nextOrderID++
+
+	sideName := "多"
+	if side == "short" {
+		sideName = "空"
+	}
+	log.Printf("✓ [模拟盘] 开%s仓成功: %s 数量: %.4f 成交价: %.4f 手续费: %.4f", sideName, symbol, quantity, fillPrice, fee)
+
+	return t.recordResultLocked(&OrderResult{
+		OrderID:     orderID,
+		Symbol:      symbol,
+		Status:      OrderStatusFilled,
+		AvgPrice:    fillPrice,
+		ExecutedQty: quantity,
+		Fee:         fee,
+		FeeAsset:    "USDT",
+	}), nil
+}
+
+// addPositionLocked 按成交价增加持仓并扣除手续费（同方向已有持仓时重新计算均价）（调用方需持有锁）
+// 加仓必须使用与现有持仓相同的杠杆（保证金和强平价按整个持仓的杠杆计算）
+func (t *PaperTrader) addPositionLocked(orderID int64, symbol, side string, quantity, fillPrice, markPrice float64, leverage int) error {
+	margin := fillPrice * quantity / float64(leverage)
+	fee := fillPrice * quantity * t.feeRate
+
+	// 单向持仓模式下不能同时持有反向仓位
+	opposite := "short"
+	if side == "short" {
+		opposite = "long"
+	}
+	if _, ok := t.positions[symbol+"_"+opposite]; ok && !t.hedgeMode() {
+		return fmt.Errorf("单向持仓模式下 %s 已有%s仓，不能开反向仓位", symbol, opposite)
+	}
+
+	key := symbol + "_" + side
+	pos, exists := t.positions[key]
+	if exists && pos.Leverage != leverage {
+		return fmt.Errorf("%s 已有%dx杠杆的%s仓，不能以%dx杠杆加仓", symbol, pos.Leverage, side, leverage)
+	}
+
+	// 可用余额检查
+	available := t.availableLocked()
+	if margin+fee > available {
+		return fmt.Errorf("模拟盘可用余额不足: 需要 %.2f USDT (保证金 %.2f + 手续费 %.2f)，可用 %.2f USDT",
+			margin+fee, margin, fee, available)
+	}
+
+	t.walletBalance -= fee
+	t.recordFillLocked(orderID, symbol, side, false, quantity, fillPrice, 0, fee)
+
+	if exists {
+		totalQuantity := pos.Quantity + quantity
+		pos.EntryPrice = (pos.EntryPrice*pos.Quantity + fillPrice*quantity) / totalQuantity
+		pos.Quantity = totalQuantity
+		pos.MarkPrice = markPrice
+	} else {
+		t.positions[key] = &paperPosition{
+			Symbol:          symbol,
+			Side:            side,
+			Quantity:        quantity,
+			EntryPrice:      fillPrice,
+			MarkPrice:       markPrice,
+			Leverage:        leverage,
+			LastFundingTime: time.Now(),
+		}
+	}
+	return nil
+}
+
+// availableLocked 可用余额 = 钱包余额 + 未实现盈亏 - 保证金占用（调用方需持有锁）
+func (t *PaperTrader) availableLocked() float64 {
+	available := t.walletBalance
+	for _, pos := range t.positions {
+		available += paperUnrealizedPnL(pos) - paperMargin(pos)
+	}
+	return available
+}
+
+// SetMarginMode 设置保证金模式（模拟盘只记录设置，强平始终按逐仓计算）
+func (t *PaperTrader) SetMarginMode(symbol string, mode MarginMode) error {
+	return t.setMarginMode(symbol, mode)
+}
+
+// SetPositionMode 设置持仓模式（与交易所一致，有持仓时不能切换）
+func (t *PaperTrader) SetPositionMode(mode PositionMode) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, current := t.GetTradingModes(); current != mode && len(t.positions) > 0 {
+		return fmt.Errorf("模拟盘有持仓时不能切换持仓模式")
+	}
+	return t.setPositionMode(mode)
+}
+
+// Capabilities 模拟盘支持的功能
+func (t *PaperTrader) Capabilities() Capabilities {
+	return Capabilities{
+		TrailingStop:       true,
+		ReduceOnly:         true,
+		SeparateSLTPCancel: true,
+		HedgeMode:          true,
+		LimitOrders:        true,
+		AdjustMargin:       true,
+	}
+}
+
+// accountResetsOnRestart 模拟盘账户只在内存中，重启后从初始资金重新开始
+func (t *PaperTrader) accountResetsOnRestart() bool {
+	return true
+}
+
+// AdjustIsolatedMargin 调整逐仓仓位保证金（amount>0追加，amount<0减少，最多减到开仓时的保证金）
+func (t *PaperTrader) AdjustIsolatedMargin(symbol string, positionSide string, amount float64) error {
+	if t.marginModeFor(symbol) != MarginModeIsolated {
+		return fmt.Errorf("%s 不是逐仓模式，不能调整仓位保证金", symbol)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	pos, ok := t.positions[symbol+"_"+strings.ToLower(positionSide)]
+	if !ok {
+		return fmt.Errorf("没有找到 %s 的%s仓", symbol, strings.ToLower(positionSide))
+	}
+	if amount > 0 && amount > t.availableLocked() {
+		return fmt.Errorf("模拟盘可用余额不足: 追加 %.2f USDT，可用 %.2f USDT", amount, t.availableLocked())
+	}
+	if amount < 0 && -amount > pos.ExtraMargin+1e-9 {
+		return fmt.Errorf("最多可减少 %.2f USDT 保证金", pos.ExtraMargin)
+	}
+
+	pos.ExtraMargin = math.Max(0, pos.ExtraMargin+amount)
+	log.Printf("  ✓ [模拟盘] %s %s 逐仓保证金调整 %+.2f USDT，强平价 %.4f",
+		symbol, pos.Side, amount, t.liquidationPrice(pos))
+	return nil
+}
+
+// withClientOrderID 为开平仓订单记录客户端订单ID（GetOrder查询到的结果同样带有该ID）
+func (t *PaperTrader) withClientOrderID(result *OrderResult, err error) (*OrderResult, error) {
+	if err != nil {
+		return nil, err
+	}
+	result.ClientOrderID = t.nextClientOrderID().String()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if recorded, ok := t.orderResults[result.OrderID]; ok {
+		recorded.ClientOrderID = result.ClientOrderID
+	}
+	return result, nil
+}
+
+// recordResultLocked 记录订单结果供GetOrder查询，返回副本（调用方需持有锁）
+func (t *PaperTrader) recordResultLocked(result *OrderResult) *OrderResult {
+	t.orderResults[result.OrderID] = result
+	copied := *result
+	return &copied
+}
+
+// OpenLongLimit 限价开多
+func (t *PaperTrader) OpenLongLimit(symbol string, quantity, price float64, leverage int, tif TimeInForce) (*OrderResult, error) {
+	return t.withClientOrderID(t.openLimit(symbol, "long", quantity, price, leverage, tif))
+}
+
+// OpenShortLimit 限价开空
+func (t *PaperTrader) OpenShortLimit(symbol string, quantity, price float64, leverage int, tif TimeInForce) (*OrderResult, error) {
+	return t.withClientOrderID(t.openLimit(symbol, "short", quantity, price, leverage, tif))
+}
+
+// openLimit 限价开仓
+// 下单时可立即成交: GTC/IOC按不劣于限价的市价成交，只做Maker单直接过期
+// 下单时不可成交: IOC直接过期，其余挂单等待价格到达后按限价成交
+func (t *PaperTrader) openLimit(symbol, side string, quantity, price float64, leverage int, tif TimeInForce) (*OrderResult, error) {
+	if quantity <= 0 {
+		return nil, fmt.Errorf("开仓数量必须大于0: %.8f", quantity)
+	}
+	if price <= 0 {
+		return nil, fmt.Errorf("限价必须大于0: %.8f", price)
+	}
+
+	// 先取消该币种的所有委托单（与实盘交易器行为一致）
+	if err := t.CancelAllOrders(symbol); err != nil {
+		log.Printf("  ⚠ 取消旧委托单失败: %v", err)
+	}
+
+	if err := t.SetLeverage(symbol, leverage); err != nil {
+		return nil, err
+	}
+
+	q, err := t.getQuote(symbol)
+	if err != nil {
+		return nil, err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.settleLocked(symbol, q)
+
+	positionSide := sideToPositionSide(side)
+	result := &OrderResult{OrderID: t.nextOrderID, Symbol: symbol, Status: OrderStatusNew}
+	t.nextOrderID++
+
+	marketable := isPaperLimitMarketable(positionSide, price, q.price)
+	switch {
+	case marketable && tif == TimeInForcePostOnly:
+		result.Status = OrderStatusExpired
+		log.Printf("  ⚠ [模拟盘] %s 只做Maker限价单会立即成交，已拒绝: 限价=%.4f 市价=%.4f", symbol, price, q.price)
+
+	case marketable:
+		// 吃单成交：成交价不劣于限价
+		fillPrice := t.openFillPrice(side, q.price)
+		if (side == "long" && fillPrice > price) || (side == "short" && fillPrice < price) {
+			fillPrice = price
+		}
+		if err := t.addPositionLocked(result.OrderID, symbol, side, quantity, fillPrice, q.price, leverage); err != nil {
+			return nil, err
+		}
+		result.Status = OrderStatusFilled
+		result.AvgPrice = fillPrice
+		result.ExecutedQty = quantity
+		result.Fee = fillPrice * quantity * t.feeRate
+		result.FeeAsset = "USDT"
+		log.Printf("✓ [模拟盘] 限价开仓立即成交: %s %s 数量: %.4f 成交价: %.4f", symbol, side, quantity, fillPrice)
+
+	case tif == TimeInForceIOC:
+		result.Status = OrderStatusExpired
+		log.Printf("  ⚠ [模拟盘] %s IOC限价单未能立即成交，已过期: 限价=%.4f 市价=%.4f", symbol, price, q.price)
+
+	default:
+		t.orders = append(t.orders, &paperOrder{
+			OrderID:      result.OrderID,
+			Symbol:       symbol,
+			PositionSide: positionSide,
+			Type:         "LIMIT",
+			Price:        price,
+			Quantity:     quantity,
+			Leverage:     leverage,
+		})
+		log.Printf("✓ [模拟盘] 限价开仓单已挂出: %s %s 数量: %.4f 限价: %.4f (%s)", symbol, side, quantity, price, tif)
+	}
+
+	return t.recordResultLocked(result), nil
+}
+
+// GetOrder 查询订单状态
+func (t *PaperTrader) GetOrder(symbol string, orderID int64) (*OrderResult, error) {
+	// 先用最新行情结算，使到价的限价单成交
+	if _, err := t.GetMarketPrice(symbol); err != nil {
+		return nil, err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	result, ok := t.orderResults[orderID]
+	if !ok || result.Symbol != symbol {
+		return nil, fmt.Errorf("订单不存在: %s %d", symbol, orderID)
+	}
+	copied := *result
+	return &copied, nil
+}
+
+// CancelOrder 取消指定订单
+func (t *PaperTrader) CancelOrder(symbol string, orderID int64) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for i, order := range t.orders {
+		if order.Symbol != symbol || order.OrderID != orderID {
+			continue
+		}
+		t.orders = append(t.orders[:i], t.orders[i+1:]...)
+		if result, ok := t.orderResults[orderID]; ok {
+			result.Status = OrderStatusCanceled
+		}
+		log.Printf("  ✓ [模拟盘] 已取消 %s 订单 %d", symbol, orderID)
+		return nil
+	}
+
+	return fmt.Errorf("订单不存在或已完成: %s %d", symbol, orderID)
+}
+
+// CloseLong 平多仓（quantity=0表示全部平仓）
+func (t *PaperTrader) CloseLong(symbol string, quantity float64) (*OrderResult, error) {
+	return t.withClientOrderID(t.close(symbol, "long", quantity))
+}
+
+// CloseShort 平空仓（quantity=0表示全部平仓）
+func (t *PaperTrader) CloseShort(symbol string, quantity float64) (*OrderResult, error) {
+	return t.withClientOrderID(t.close(symbol, "short", quantity))
+}
+
+// close 市价平仓
+func (t *PaperTrader) close(symbol, side string, quantity float64) (*OrderResult, error) {
+	q, err := t.getQuote(symbol)
+	if err != nil {
+		return nil, err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.settleLocked(symbol, q)
+
+	sideName := "多"
+	if side == "short" {
+		sideName = "空"
+	}
+
+	pos, ok := t.positions[symbol+"_"+side]
+	if !ok {
+		return nil, fmt.Errorf("没有找到 %s 的%s仓", symbol, sideName)
+	}
+	if quantity <= 0 || quantity > pos.Quantity {
+		quantity = pos.Quantity
+	}
+
+	orderID := t.nextOrderID
+	t.nextOrderID++
+	fillPrice := t.closeFillPrice(side, q.price)
+	pnl := t.reduceLocked(orderID, pos, quantity, fillPrice)
+	fee := fillPrice * quantity * t.feeRate
+
+	log.Printf("✓ [模拟盘] 平%s仓成功: %s 数量: %.4f 成交价: %.4f 已实现盈亏: %.2f USDT", sideName, symbol, quantity, fillPrice, pnl)
+
+	return t.recordResultLocked(&OrderResult{
+		OrderID:     orderID,
+		Symbol:      symbol,
+		Status:      OrderStatusFilled,
+		AvgPrice:    fillPrice,
+		ExecutedQty: quantity,
+		Fee:         fee,
+		FeeAsset:    "USDT",
+	}), nil
+}
+
+// GetMarketPrice 获取市场价格
+func (t *PaperTrader) GetMarketPrice(symbol string) (float64, error) {
+	q, err := t.getQuote(symbol)
+	if err != nil {
+		return 0, err
+	}
+
+	// 顺便结算该币种（触发止盈止损/强平/资金费）
+	t.mu.Lock()
+	t.settleLocked(symbol, q)
+	t.mu.Unlock()
+
+	return q.price, nil
+}
+
+// SetStopLoss 设置止损单
+func (t *PaperTrader) SetStopLoss(symbol string, positionSide string, quantity, stopPrice float64) error {
+	return t.addOrder(symbol, positionSide, "STOP_MARKET", quantity, stopPrice)
+}
+
+// SetTakeProfit 设置止盈单
+func (t *PaperTrader) SetTakeProfit(symbol string, positionSide string, quantity, takeProfitPrice float64) error {
+	return t.addOrder(symbol, positionSide, "TAKE_PROFIT_MARKET", quantity, takeProfitPrice)
+}
+
+// addOrder 添加止盈止损挂单
+func (t *PaperTrader) addOrder(symbol, positionSide, orderType string, quantity, stopPrice float64) error {
+	if stopPrice <= 0 {
+		return fmt.Errorf("触发价格必须大于0: %.8f", stopPrice)
+	}
+	if positionSide != "LONG" && positionSide != "SHORT" {
+		return fmt.Errorf("无效的持仓方向: %s", positionSide)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.orders = append(t.orders, &paperOrder{
+		OrderID:      t.nextOrderID,
+		Symbol:       symbol,
+		PositionSide: positionSide,
+		Type:         orderType,
+		StopPrice:    stopPrice,
+		Quantity:     quantity,
+	})
+	t.nextOrderID++
+
+	if orderType == "STOP_MARKET" {
+		log.Printf("  止损价设置: %.4f", stopPrice)
+	} else {
+		log.Printf("  止盈价设置: %.4f", stopPrice)
+	}
+	return nil
+}
+
+// SetTrailingStop 设置追踪止损单（替换该方向原有的追踪止损单，每次结算时按最新价格移动触发价）
+func (t *PaperTrader) SetTrailingStop(symbol string, positionSide string, quantity, activationPrice, callbackRate float64) error {
+	price, err := t.GetMarketPrice(symbol)
+	if err != nil {
+		return err
+	}
+	if err := validateTrailingStop(positionSide, price, activationPrice, callbackRate); err != nil {
+		return err
+	}
+
+	trailing := &trailingStop{
+		Symbol:          symbol,
+		PositionSide:    positionSide,
+		Quantity:        quantity,
+		ActivationPrice: activationPrice,
+		CallbackRate:    callbackRate,
+	}
+	trailing.update(price)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.removeOrdersLocked(symbol, positionSide, CloseOrderTrailingStop)
+	t.orders = append(t.orders, &paperOrder{
+		OrderID:      t.nextOrderID,
+		Symbol:       symbol,
+		PositionSide: positionSide,
+		Type:         CloseOrderTrailingStop,
+		StopPrice:    trailing.stopPrice(),
+		Quantity:     quantity,
+		trailing:     trailing,
+	})
+	t.nextOrderID++
+
+	log.Printf("  追踪止损设置: 回调%.2f%% 激活价%.4f", callbackRate, activationPrice)
+	return nil
+}
+
+// CancelAllOrders 取消该币种的所有挂单
+func (t *PaperTrader) CancelAllOrders(symbol string) error {
+	t.mu.Lock()
+	removed := t.removeOrdersLocked(symbol, "", "")
+	t.mu.Unlock()
+
+	if removed > 0 {
+		log.Printf("  ✓ 已取消 %s 的所有挂单", symbol)
+	}
+	return nil
+}
+
+// CancelStopLossOrders 仅取消止损单（不影响止盈单）
+func (t *PaperTrader) CancelStopLossOrders(symbol string) error {
+	t.mu.Lock()
+	removed := t.removeOrdersLocked(symbol, "", "STOP_MARKET")
+	t.mu.Unlock()
+
+	log.Printf("  ✓ 已取消 %s 的 %d 个止损单", symbol, removed)
+	return nil
+}
+
+// CancelTakeProfitOrders 仅取消止盈单（不影响止损单）
+func (t *PaperTrader) CancelTakeProfitOrders(symbol string) error {
+	t.mu.Lock()
+	removed := t.removeOrdersLocked(symbol, "", "TAKE_PROFIT_MARKET")
+	t.mu.Unlock()
+
+	log.Printf("  ✓ 已取消 %s 的 %d 个止盈单", symbol, removed)
+	return nil
+}
+
+// GetOpenOrders 获取指定币种的所有未完成订单
+func (t *PaperTrader) GetOpenOrders(symbol string) ([]Order, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	result := make([]Order, 0)
+	for _, order := range t.orders {
+		if order.Symbol != symbol {
+			continue
+		}
+
+		// 止盈止损单平仓方向与持仓相反，限价开仓单与持仓相同
+		side := "SELL"
+		if (order.PositionSide == "SHORT") != (order.Type == "LIMIT") {
+			side = "BUY"
+		}
+
+		o := Order{
+			OrderID:      order.OrderID,
+			Symbol:       order.Symbol,
+			Type:         order.Type,
+			Side:         side,
+			PositionSide: order.PositionSide,
+			Price:        order.Price,
+			StopPrice:    order.StopPrice,
+			Quantity:     order.Quantity,
+			Status:       "NEW",
+		}
+		if order.trailing != nil {
+			o.ActivationPrice = order.trailing.ActivationPrice
+			o.CallbackRate = order.trailing.CallbackRate
+		}
+		result = append(result, o)
+	}
+
+	return result, nil
+}
+
+// FormatQuantity 格式化数量到正确的精度（模拟盘没有交易所精度限制，统一保留4位小数）
+func (t *PaperTrader) FormatQuantity(symbol string, quantity float64) (string, error) {
+	return strconv.FormatFloat(quantity, 'f', 4, 64), nil
+}
+
+// GetTradeHistory 获取模拟盘成交记录
+func (t *PaperTrader) GetTradeHistory(symbol string, start, end time.Time) ([]TradeFill, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	fills := make([]TradeFill, 0)
+	for _, fill := range t.fills {
+		if (symbol == "" || fill.Symbol == symbol) && !fill.Time.Before(start) && fill.Time.Before(end) {
+			fills = append(fills, fill)
+		}
+	}
+	return fills, nil
+}
+
+// GetIncomeHistory 获取模拟盘资金流水
+func (t *PaperTrader) GetIncomeHistory(symbol string, start, end time.Time) ([]IncomeRecord, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	records := make([]IncomeRecord, 0)
+	for _, record := range t.income {
+		if (symbol == "" || record.Symbol == symbol) && !record.Time.Before(start) && record.Time.Before(end) {
+			records = append(records, record)
+		}
+	}
+	return records, nil
+}
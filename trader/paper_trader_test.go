@@ -0,0 +1,270 @@
+package trader
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// paperQuoteSource 测试用行情源（价格和资金费率可随时修改）
+type paperQuoteSource struct {
+	price       float64
+	fundingRate float64
+}
+
+// newTestPaper 使用注入行情源的模拟盘（滑点10bps，手续费0.05%，不缓存行情）
+func newTestPaper(balance float64, quotes *paperQuoteSource) *PaperTrader {
+	paper := NewPaperTrader(balance, 10, 0.0005)
+	paper.fetchQuote = func(symbol string) (float64, float64, error) { return quotes.price, quotes.fundingRate, nil }
+	paper.cacheDuration = 0
+	return paper
+}
+
+func TestPaperTraderFillPriceAndFee(t *testing.T) {
+	tests := []struct {
+		side      string
+		wantPrice float64 // 100 ± 10bps
+	}{
+		{"long", 100.1},
+		{"short", 99.9},
+	}
+	for _, tt := range tests {
+		t.Run(tt.side, func(t *testing.T) {
+			paper := newTestPaper(10000, &paperQuoteSource{price: 100})
+			open := paper.OpenLong
+			if tt.side == "short" {
+				open = paper.OpenShort
+			}
+			result, err := open("BTCUSDT", 2, 5)
+			if err != nil {
+				t.Fatalf("开仓失败: %v", err)
+			}
+			wantFee := tt.wantPrice * 2 * 0.0005
+			if !floatEq(result.AvgPrice, tt.wantPrice) || !floatEq(result.Fee, wantFee) || !floatEq(result.ExecutedQty, 2) {
+				t.Errorf("成交结果错误: %+v (期望价格 %.4f 手续费 %.6f)", result, tt.wantPrice, wantFee)
+			}
+			balance, _ := paper.GetBalance()
+			if !floatEq(balance.TotalWalletBalance, 10000-wantFee) {
+				t.Errorf("钱包余额应扣除手续费: %.6f", balance.TotalWalletBalance)
+			}
+		})
+	}
+}
+
+func TestPaperTraderFundingSettlement(t *testing.T) {
+	tests := []struct {
+		name        string
+		side        string
+		fundingRate float64
+		wantIncome  float64 // 2期 × 数量1 × 价格100 × 费率
+	}{
+		{"正费率多头支付", "long", 0.001, -0.2},
+		{"正费率空头收取", "short", 0.001, 0.2},
+		{"负费率多头收取", "long", -0.001, 0.2},
+		{"负费率空头支付", "short", -0.001, -0.2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			quotes := &paperQuoteSource{price: 100, fundingRate: tt.fundingRate}
+			paper := newTestPaper(10000, quotes)
+			paper.slippage = 0
+			open := paper.OpenLong
+			if tt.side == "short" {
+				open = paper.OpenShort
+			}
+			if _, err := open("BTCUSDT", 1, 5); err != nil {
+				t.Fatalf("开仓失败: %v", err)
+			}
+			before, _ := paper.GetBalance()
+
+			// 持仓已过去2.5个结算周期：结算2期，剩余的半期留到下次
+			pos := paper.positions["BTCUSDT_"+tt.side]
+			pos.LastFundingTime = time.Now().Add(-150 * time.Minute)
+			after, _ := paper.GetBalance()
+			if got := after.TotalWalletBalance - before.TotalWalletBalance; !floatEq(got, tt.wantIncome) {
+				t.Errorf("资金费结算错误: %.6f，期望 %.6f", got, tt.wantIncome)
+			}
+			if !floatEq(pos.FundingPaid, -tt.wantIncome) {
+				t.Errorf("累计资金费错误: %.6f", pos.FundingPaid)
+			}
+			if elapsed := time.Since(pos.LastFundingTime); elapsed < 25*time.Minute || elapsed > 35*time.Minute {
+				t.Errorf("结算时间应前移2期: 距今 %v", elapsed)
+			}
+
+			// 同一周期内不重复结算
+			again, _ := paper.GetBalance()
+			if !floatEq(again.TotalWalletBalance, after.TotalWalletBalance) {
+				t.Errorf("不应重复结算资金费: %.6f → %.6f", after.TotalWalletBalance, again.TotalWalletBalance)
+			}
+		})
+	}
+}
+
+func TestPaperTraderStopOrders(t *testing.T) {
+	tests := []struct {
+		name      string
+		side      string
+		stopLoss  bool
+		stopPrice float64
+		notYet    float64 // 未到触发价
+		through   float64 // 越过触发价
+	}{
+		{"多头止损", "long", true, 95, 96, 94},
+		{"多头止盈", "long", false, 110, 109, 111},
+		{"空头止损", "short", true, 105, 104, 106},
+		{"空头止盈", "short", false, 90, 91, 89},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			quotes := &paperQuoteSource{price: 100}
+			paper := newTestPaper(10000, quotes)
+			open, positionSide := paper.OpenLong, "LONG"
+			if tt.side == "short" {
+				open, positionSide = paper.OpenShort, "SHORT"
+			}
+			setOrder, cancelOrder := paper.SetStopLoss, paper.CancelStopLossOrders
+			if !tt.stopLoss {
+				setOrder, cancelOrder = paper.SetTakeProfit, paper.CancelTakeProfitOrders
+			}
+			if _, err := open("BTCUSDT", 1, 5); err != nil {
+				t.Fatalf("开仓失败: %v", err)
+			}
+
+			// 撤单后越过触发价不再平仓
+			if err := setOrder("BTCUSDT", positionSide, 1, tt.stopPrice); err != nil {
+				t.Fatalf("挂单失败: %v", err)
+			}
+			if err := cancelOrder("BTCUSDT"); err != nil {
+				t.Fatalf("撤单失败: %v", err)
+			}
+			quotes.price = tt.through
+			if positions, _ := paper.GetPositions(); len(positions) != 1 {
+				t.Fatalf("撤单后不应触发: %+v", positions)
+			}
+
+			quotes.price = 100
+			if err := setOrder("BTCUSDT", positionSide, 1, tt.stopPrice); err != nil {
+				t.Fatalf("挂单失败: %v", err)
+			}
+			quotes.price = tt.notYet
+			if positions, _ := paper.GetPositions(); len(positions) != 1 {
+				t.Fatalf("未到触发价不应平仓: %+v", positions)
+			}
+
+			quotes.price = tt.through
+			if positions, _ := paper.GetPositions(); len(positions) != 0 {
+				t.Fatalf("越过触发价应平仓: %+v", positions)
+			}
+			if orders, _ := paper.GetOpenOrders("BTCUSDT"); len(orders) != 0 {
+				t.Errorf("触发后不应留下挂单: %+v", orders)
+			}
+			// 平仓按触发时的市价加滑点成交
+			fills, _ := paper.GetTradeHistory("BTCUSDT", time.Now().Add(-time.Minute), time.Now().Add(time.Minute))
+			if len(fills) != 2 || !floatEq(fills[1].Price, paper.closeFillPrice(tt.side, tt.through)) {
+				t.Errorf("触发成交错误: %+v", fills)
+			}
+		})
+	}
+}
+
+func TestPaperTraderLiquidation(t *testing.T) {
+	tests := []struct {
+		side     string
+		liqPrice float64 // 10倍杠杆、0.5%维持保证金率：100 × (1 ∓ 10% ± 0.5%)
+		safe     float64
+		through  float64
+	}{
+		{"long", 90.5, 90.6, 90.4},
+		{"short", 109.5, 109.4, 109.6},
+	}
+	for _, tt := range tests {
+		t.Run(tt.side, func(t *testing.T) {
+			quotes := &paperQuoteSource{price: 100}
+			paper := newTestPaper(10000, quotes)
+			paper.slippage = 0
+			open := paper.OpenLong
+			if tt.side == "short" {
+				open = paper.OpenShort
+			}
+			if _, err := open("BTCUSDT", 1, 10); err != nil {
+				t.Fatalf("开仓失败: %v", err)
+			}
+			positions, _ := paper.GetPositions()
+			if len(positions) != 1 || math.Abs(positions[0].LiquidationPrice-tt.liqPrice) > 1e-9 {
+				t.Fatalf("强平价错误: %+v", positions)
+			}
+			before, _ := paper.GetBalance()
+
+			quotes.price = tt.safe
+			if positions, _ := paper.GetPositions(); len(positions) != 1 {
+				t.Fatalf("未到强平价不应强平: %+v", positions)
+			}
+			quotes.price = tt.through
+			if positions, _ := paper.GetPositions(); len(positions) != 0 {
+				t.Fatalf("越过强平价应强平: %+v", positions)
+			}
+			// 损失全部保证金（100 × 1 / 10）
+			after, _ := paper.GetBalance()
+			if !floatEq(before.TotalWalletBalance-after.TotalWalletBalance, 10) {
+				t.Errorf("强平应损失保证金10 USDT: %.6f → %.6f", before.TotalWalletBalance, after.TotalWalletBalance)
+			}
+		})
+	}
+}
+
+func TestPaperTraderRejectsInsufficientMargin(t *testing.T) {
+	tests := []struct {
+		name     string
+		quantity float64
+		leverage int
+		wantErr  bool
+	}{
+		{"保证金不足", 1, 5, true},          // 保证金 20000 > 1000
+		{"保证金加手续费不足", 0.99, 100, true}, // 保证金 990 + 手续费 49.5 > 1000
+		{"保证金充足", 0.04, 5, false},      // 保证金 800 + 手续费 2
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			paper := newTestPaper(1000, &paperQuoteSource{price: 100000})
+			paper.slippage = 0
+			_, err := paper.OpenLong("BTCUSDT", tt.quantity, tt.leverage)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("开仓结果错误: %v", err)
+			}
+			positions, _ := paper.GetPositions()
+			balance, _ := paper.GetBalance()
+			if tt.wantErr && (len(positions) != 0 || balance.TotalWalletBalance != 1000) {
+				t.Errorf("拒绝开仓时不应产生持仓或扣费: %+v %.4f", positions, balance.TotalWalletBalance)
+			}
+		})
+	}
+}
+
+func TestPaperTraderRejectsAddAtDifferentLeverage(t *testing.T) {
+	paper := newTestPaper(10000, &paperQuoteSource{price: 100})
+	paper.slippage = 0
+	if _, err := paper.OpenLong("BTCUSDT", 1, 10); err != nil {
+		t.Fatalf("开仓失败: %v", err)
+	}
+	before, _ := paper.GetBalance()
+
+	// 以不同杠杆加仓会改变整个持仓的保证金和强平价，应拒绝
+	if _, err := paper.OpenLong("BTCUSDT", 1, 2); err == nil {
+		t.Fatal("以不同杠杆加仓应被拒绝")
+	}
+	positions, _ := paper.GetPositions()
+	after, _ := paper.GetBalance()
+	if len(positions) != 1 || positions[0].PositionAmt != 1 || positions[0].Leverage != 10 || !floatEq(positions[0].LiquidationPrice, 90.5) {
+		t.Errorf("拒绝加仓后持仓不应变化: %+v", positions)
+	}
+	if after.TotalWalletBalance != before.TotalWalletBalance {
+		t.Errorf("拒绝加仓时不应扣费: %.4f → %.4f", before.TotalWalletBalance, after.TotalWalletBalance)
+	}
+
+	if _, err := paper.OpenLong("BTCUSDT", 1, 10); err != nil {
+		t.Fatalf("相同杠杆加仓失败: %v", err)
+	}
+	if positions, _ := paper.GetPositions(); len(positions) != 1 || positions[0].PositionAmt != 2 {
+		t.Errorf("相同杠杆应正常加仓: %+v", positions)
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"nofx/market"
 	"nofx/mcp"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -17,7 +18,7 @@ type PositionManagerConfig struct {
 	ID                  string        // 管理器唯一标识
 	Name                string        // 管理器显示名称
 	AIModel             string        // AI模型: "qwen", "deepseek", "gemini", "custom"
-	Exchange            string        // 交易平台: "binance", "hyperliquid", "aster"
+	Exchange            string        // 交易平台: "binance", "hyperliquid", "aster", "bybit", "okx", "paper"
 	EnableScreenshot    bool          // 是否启用图表截图
 	ScanInterval        time.Duration // 扫描间隔
 	ScanIntervalMinutes int           // 扫描间隔分钟数
@@ -34,6 +35,25 @@ type PositionManagerConfig struct {
 	AsterUser             string
 	AsterSigner           string
 	AsterPrivateKey       string
+	BybitAPIKey           string
+	BybitSecretKey        string
+	BybitTestnet          bool
+	OKXAPIKey             string
+	OKXSecretKey          string
+	OKXPassphrase         string
+	PaperSlippageBps      float64
+	PaperFeeRate          float64
+	MarginMode            string // "cross" 或 "isolated"（为空时使用交易所默认设置）
+	PositionMode          string // "one-way" 或 "hedge"（为空时使用交易所默认设置）
+
+	// 加仓和减仓的拆单执行（TWAP/冰山单）
+	Execution ExecutionConfig
+
+	// 熔断：日亏损或回撤超过限制后暂停加仓（百分比，0表示不限制）
+	MaxDailyLoss     float64
+	MaxDrawdown      float64
+	StopTradingTime  time.Duration // 触发熔断后暂停时长（默认60分钟）
+	FlattenOnBreaker bool          // 触发熔断时撤销所有挂单并平掉全部持仓
 
 	// AI配置
 	DeepSeekKey     string
@@ -63,6 +83,16 @@ type PositionManager struct {
 	positionInvalidationConditions map[string]string
 	positionReasonings             map[string]string
 	positionPnLTracking            map[string]*PnLTracking
+	stopTradeEvents                func()   // 停止交易所实时推送
+	realtimeClosed                 []string // 实时推送已平仓的持仓 (symbol_side)，下个周期清理跟踪数据
+	realtimeMu                     sync.Mutex
+	funding                        *fundingTracker // 持仓累计资金费
+	orphans                        *orphanSweeper  // 孤儿挂单清理（持仓已平但仍挂着的保护单）
+	state                          *stateStore     // 跨重启保留的状态（decision_logs/<id>/state）
+	exec                           *executor       // 拆单执行（TWAP/冰山单）
+	breaker                        breakerState    // 日亏损和回撤熔断状态
+
+	killSwitch // 一键清仓
 }
 
 // NewPositionManager 创建仓位管理器
@@ -115,15 +145,28 @@ func NewPositionManager(config PositionManagerConfig) (*PositionManager, error)
 			return nil, fmt.Errorf("初始化Aster交易器失败: %w", err)
 		}
 		log.Printf("🏦 [%s] 使用Aster交易", config.Name)
+	case "bybit":
+		trader = NewBybitTrader(config.BybitAPIKey, config.BybitSecretKey, config.BybitTestnet)
+		log.Printf("🏦 [%s] 使用Bybit合约交易", config.Name)
+	case "okx":
+		trader = NewOKXTrader(config.OKXAPIKey, config.OKXSecretKey, config.OKXPassphrase)
+		log.Printf("🏦 [%s] 使用OKX合约交易", config.Name)
+	case "paper":
+		trader = NewPaperTrader(config.InitialBalance, config.PaperSlippageBps, config.PaperFeeRate)
+		log.Printf("🏦 [%s] 使用模拟盘交易（虚拟资金）", config.Name)
 	default:
 		return nil, fmt.Errorf("不支持的交易平台: %s", config.Exchange)
 	}
 
+	limits := breakerLimits{MaxDailyLoss: config.MaxDailyLoss, MaxDrawdown: config.MaxDrawdown, StopTradingTime: config.StopTradingTime}
+	applyBreakerDefaults(config.Name, &limits, config.FlattenOnBreaker)
+	config.StopTradingTime = limits.StopTradingTime
+
 	// 初始化决策日志
 	logDir := fmt.Sprintf("decision_logs/%s", config.ID)
 	decisionLogger := logger.NewDecisionLogger(logDir)
 
-	return &PositionManager{
+	pm := &PositionManager{
 		id:                             config.ID,
 		name:                           config.Name,
 		aiModel:                        config.AIModel,
@@ -141,7 +184,24 @@ func NewPositionManager(config PositionManagerConfig) (*PositionManager, error)
 		positionInvalidationConditions: make(map[string]string),
 		positionReasonings:             make(map[string]string),
 		positionPnLTracking:            make(map[string]*PnLTracking),
-	}, nil
+		funding:                        newFundingTracker(trader),
+		orphans:                        newOrphanSweeper(trader, config.Name, decisionLogger),
+		state:                          newStateStore(logDir),
+		exec:                           newExecutor(trader, config.Name, config.Execution),
+	}
+	pm.exec.stopped = pm.Killed
+	pm.exec.logConfig(config.ScanInterval)
+	setClientOrderRef(trader, pm.clientOrderRef(0))
+	return pm, nil
+}
+
+// clientOrderRef 当前周期第decision个决策的下单归属（decision为0表示不属于决策周期）
+func (pm *PositionManager) clientOrderRef(decision int) ClientOrderRef {
+	ref := ClientOrderRef{TraderID: pm.id, RunID: pm.startTime.Unix()}
+	if decision > 0 {
+		ref.Cycle, ref.Decision = pm.callCount, decision
+	}
+	return ref
 }
 
 // Run 运行仓位管理主循环
@@ -152,6 +212,18 @@ func (pm *PositionManager) Run() error {
 	log.Printf("⚙️  扫描间隔: %v", pm.config.ScanInterval)
 	log.Println("📊 只管理现有仓位，不会开新仓")
 
+	// 恢复上次运行的持仓跟踪数据和周期编号（按交易所当前持仓和挂单校正）
+	pm.restoreState()
+
+	// 支持推送的交易所：止损止盈触发时立即记录
+	pm.stopTradeEvents = startTradeEvents(pm.trader, pm.name, pm.handleTradeEvent)
+
+	// 后台撤销持仓已不存在的止损止盈单（手动平仓、强平或一侧触发后剩下的另一侧）
+	pm.orphans.start()
+
+	// 应用配置的保证金模式和持仓模式
+	applyTradingModes(pm.trader, pm.name, pm.config.MarginMode, pm.config.PositionMode)
+
 	ticker := time.NewTicker(pm.config.ScanInterval)
 	defer ticker.Stop()
 
@@ -175,12 +247,24 @@ func (pm *PositionManager) Run() error {
 // Stop 停止仓位管理
 func (pm *PositionManager) Stop() {
 	pm.isRunning = false
+	if pm.stopTradeEvents != nil {
+		pm.stopTradeEvents()
+	}
+	pm.orphans.shutdown()
 	log.Printf("⏹ [%s] 仓位管理系统停止", pm.name)
 }
 
 // runCycle 运行一个管理周期
 func (pm *PositionManager) runCycle() error {
+	// 一键清仓等待进行中的周期结束，触发后不再执行新的周期
+	pm.cycleMu.Lock()
+	defer pm.cycleMu.Unlock()
+	if pm.Killed() {
+		return nil
+	}
+
 	pm.callCount++
+	defer pm.saveState()
 
 	log.Printf("%s", "\n"+strings.Repeat("=", 70))
 	log.Printf("⏰ %s - [%s] 仓位管理周期 #%d", time.Now().Format("2006-01-02 15:04:05"), pm.name, pm.callCount)
@@ -192,6 +276,14 @@ func (pm *PositionManager) runCycle() error {
 		Success:      true,
 	}
 
+	// 清理实时推送已平仓的持仓跟踪数据
+	pm.clearRealtimeClosed()
+
+	// 检查日亏损和回撤熔断（触发后暂停加仓，按配置平掉全部持仓）
+	if reason := pm.breaker.check(pm.trader, pm.name, pm.breakerLimits(), record); reason != "" && pm.config.FlattenOnBreaker {
+		flattenOnBreaker(pm.trader, pm.id, pm.exchange, pm.name, reason, pm.orphans.trackedSymbols(), record)
+	}
+
 	// 1. 获取当前持仓
 	positions, err := pm.trader.GetPositions()
 	if err != nil {
@@ -240,6 +332,7 @@ func (pm *PositionManager) runCycle() error {
 			UnrealizedProfit: pos.UnrealizedPnL,
 			Leverage:         float64(pos.Leverage),
 			LiquidationPrice: pos.LiquidationPrice,
+			Funding:          pos.Funding,
 		})
 	}
 
@@ -288,8 +381,15 @@ func (pm *PositionManager) runCycle() error {
 	}
 	log.Println()
 
-	// 6. 执行决策
-	for _, d := range fullDecision.Decisions {
+	// 6. 执行决策（订单的客户端订单ID编码周期和决策序号）
+	defer setClientOrderRef(pm.trader, pm.clientOrderRef(0))
+	for i, d := range fullDecision.Decisions {
+		if pm.Killed() {
+			record.ExecutionLog = append(record.ExecutionLog, "🛑 已触发一键清仓，跳过剩余决策")
+			break
+		}
+		setClientOrderRef(pm.trader, pm.clientOrderRef(i+1))
+		pm.orphans.track(d.Symbol)
 		actionRecord := logger.DecisionAction{
 			Action:    d.Action,
 			Symbol:    d.Symbol,
@@ -329,9 +429,9 @@ func (pm *PositionManager) buildTradingContext() (*decision.Context, error) {
 		return nil, fmt.Errorf("获取账户余额失败: %w", err)
 	}
 
-	totalWalletBalance := balance["totalWalletBalance"].(float64)
-	totalUnrealizedProfit := balance["totalUnrealizedProfit"].(float64)
-	availableBalance := balance["availableBalance"].(float64)
+	totalWalletBalance := balance.TotalWalletBalance
+	totalUnrealizedProfit := balance.TotalUnrealizedProfit
+	availableBalance := balance.AvailableBalance
 	totalEquity := totalWalletBalance + totalUnrealizedProfit
 
 	// 2. 获取持仓信息
@@ -345,20 +445,17 @@ func (pm *PositionManager) buildTradingContext() (*decision.Context, error) {
 	currentPositionKeys := make(map[string]bool)
 
 	for _, pos := range positions {
-		symbol := pos["symbol"].(string)
-		side := pos["side"].(string)
-		entryPrice := pos["entryPrice"].(float64)
-		markPrice := pos["markPrice"].(float64)
-		quantity := pos["positionAmt"].(float64)
-		if quantity < 0 {
-			quantity = -quantity
-		}
-		unrealizedPnl := pos["unRealizedProfit"].(float64)
-		liquidationPrice := pos["liquidationPrice"].(float64)
+		symbol := pos.Symbol
+		side := pos.Side
+		entryPrice := pos.EntryPrice
+		markPrice := pos.MarkPrice
+		quantity := pos.PositionAmt
+		unrealizedPnl := pos.UnRealizedProfit
+		liquidationPrice := pos.LiquidationPrice
 
 		leverage := 10
-		if lev, ok := pos["leverage"].(float64); ok {
-			leverage = int(lev)
+		if pos.Leverage > 0 {
+			leverage = pos.Leverage
 		}
 		marginUsed := (quantity * markPrice) / float64(leverage)
 		totalMarginUsed += marginUsed
@@ -396,14 +493,8 @@ func (pm *PositionManager) buildTradingContext() (*decision.Context, error) {
 			} else {
 				// 解析止盈止损价格
 				for _, order := range orders {
-					orderType, _ := order["type"].(string)
-					stopPrice, _ := order["stopPrice"].(float64)
-					triggerPx, _ := order["triggerPx"].(float64) // Hyperliquid使用triggerPx
-
-					// 币安使用stopPrice，Hyperliquid使用triggerPx
-					if stopPrice == 0 && triggerPx > 0 {
-						stopPrice = triggerPx
-					}
+					orderType := order.Type
+					stopPrice := order.StopPrice
 
 					if stopPrice > 0 {
 						// 判断是止损还是止盈
@@ -489,6 +580,23 @@ func (pm *PositionManager) buildTradingContext() (*decision.Context, error) {
 		})
 	}
 
+	// 累计资金费
+	if pm.funding != nil {
+		fundings := pm.funding.update(positions, pm.positionFirstSeenTime)
+		for i := range positionInfos {
+			positionInfos[i].Funding = fundings[positionInfos[i].Symbol+"_"+positionInfos[i].Side]
+		}
+	}
+
+	// 止损止盈联动单状态
+	if brackets := positionBrackets(pm.trader); brackets != nil {
+		for i := range positionInfos {
+			if b, ok := brackets[positionInfos[i].Symbol+"_"+positionInfos[i].Side]; ok {
+				positionInfos[i].BracketState = string(b.State)
+			}
+		}
+	}
+
 	// 清理已平仓的持仓记录
 	for key := range pm.positionFirstSeenTime {
 		if !currentPositionKeys[key] {
@@ -499,8 +607,7 @@ func (pm *PositionManager) buildTradingContext() (*decision.Context, error) {
 
 	currentSymbols := make(map[string]bool)
 	for _, pos := range positions {
-		symbol := pos["symbol"].(string)
-		currentSymbols[symbol] = true
+		currentSymbols[pos.Symbol] = true
 	}
 	for symbol := range pm.positionInvalidationConditions {
 		if !currentSymbols[symbol] {
@@ -639,8 +746,22 @@ func (pm *PositionManager) buildPositionManagementSystemPrompt(accountEquity flo
 	sb.WriteString("1. **increase_long/short**: 加仓（趋势延续时）\n")
 	sb.WriteString("2. **decrease_long/short**: 减仓（部分止盈或风险增加）\n")
 	sb.WriteString("3. **close_long/short**: 平仓（趋势反转或达到目标）\n")
-	sb.WriteString("4. **update_loss_profit**: 移动止损/止盈（保护利润）\n")
-	sb.WriteString("5. **hold**: 继续持有（趋势未变）\n\n")
+	caps := pm.trader.Capabilities()
+	if caps.SeparateSLTPCancel {
+		sb.WriteString("4. **update_loss_profit**: 移动止损/止盈（保护利润），可以只更新其中一项，不更新的填0\n")
+	} else {
+		sb.WriteString("4. **update_loss_profit**: 移动止损/止盈（保护利润），必须同时给出 stop_loss 和 take_profit\n")
+	}
+	sb.WriteString("5. **hold**: 继续持有（趋势未变）\n")
+	if caps.TrailingStop {
+		sb.WriteString(fmt.Sprintf("6. **set_trailing_stop**: 第二阶段移动止盈交给追踪止损单（callback_rate为回撤比例%%，%.1f-%.0f；activation_price为开始追踪的价格，填0立即开始），之后不必每个周期update_loss_profit\n",
+			decision.MinTrailingCallbackRate, decision.MaxTrailingCallbackRate))
+	}
+	if marginMode, _ := pm.trader.GetTradingModes(); marginMode == MarginModeIsolated && caps.AdjustMargin {
+		sb.WriteString("7. **add_margin_long/short**: 追加逐仓保证金（margin_usd为追加金额），降低强平价。\n")
+		sb.WriteString("   适用于看好方向但价格逼近强平价的仓位，用追加保证金代替减仓；判断失效时应止损而不是追加\n")
+	}
+	sb.WriteString("\n")
 
 	sb.WriteString("# 📤 输出格式\n")
 	sb.WriteString("**第一步: 思维链分析**\n")
@@ -712,9 +833,12 @@ func (pm *PositionManager) buildPositionManagementUserPrompt(ctx *decision.Conte
 			pos.EntryPrice, pos.MarkPrice, pos.UnrealizedPnLPct,
 			pos.Leverage, stageInfo, holdingDuration))
 
-		sb.WriteString(fmt.Sprintf("   止损价%.4f | 止盈价%.4f | 最高盈利%+.2f%% | 峰值回撤%+.2f%%\n",
-			pos.StopLossPrice, pos.TakeProfitPrice, pos.MaxProfitPct, pos.DrawdownFromPeakPct))
+		sb.WriteString(fmt.Sprintf("   止损价%.4f | 止盈价%.4f | 强平价%.4f | 最高盈利%+.2f%% | 峰值回撤%+.2f%%\n",
+			pos.StopLossPrice, pos.TakeProfitPrice, pos.LiquidationPrice, pos.MaxProfitPct, pos.DrawdownFromPeakPct))
 
+		if pos.BracketState == string(BracketBroken) {
+			sb.WriteString("   **⚠️ 止损止盈不完整**: 只剩一侧保护单，请用update_loss_profit同时重新设置止损和止盈\n")
+		}
 		if pos.InvalidationCondition != "" {
 			sb.WriteString(fmt.Sprintf("   **离场条件**: %s\n", pos.InvalidationCondition))
 		}
@@ -758,7 +882,8 @@ func (pm *PositionManager) parsePositionManagementResponse(aiResponse string, ac
 		}, fmt.Errorf("提取决策失败: %w\n\n=== AI思维链分析 ===\n%s", err, cotTrace)
 	}
 
-	// 验证决策（仓位管理模式：不允许开仓）
+	// 验证决策（仓位管理模式：不允许开仓，不允许交易所不支持的操作）
+	caps := pm.trader.Capabilities()
 	for i, d := range decisions {
 		if d.Action == "open_long" || d.Action == "open_short" {
 			return &decision.FullDecision{
@@ -766,6 +891,12 @@ func (pm *PositionManager) parsePositionManagementResponse(aiResponse string, ac
 				Decisions: decisions,
 			}, fmt.Errorf("决策 #%d 错误: 仓位管理模式不允许开仓操作 (%s)", i+1, d.Action)
 		}
+		if err := validateCapabilities(&d, caps); err != nil {
+			return &decision.FullDecision{
+				CoTTrace:  cotTrace,
+				Decisions: decisions,
+			}, fmt.Errorf("决策 #%d 错误: %w", i+1, err)
+		}
 	}
 
 	return &decision.FullDecision{
@@ -776,6 +907,9 @@ func (pm *PositionManager) parsePositionManagementResponse(aiResponse string, ac
 
 // executeDecisionWithRecord 执行决策并记录
 func (pm *PositionManager) executeDecisionWithRecord(d *decision.Decision, actionRecord *logger.DecisionAction) error {
+	if isOpeningAction(d.Action) && pm.breaker.active() {
+		return pm.breaker.blockedError()
+	}
 	switch d.Action {
 	case "increase_long":
 		return pm.executeIncreaseLong(d, actionRecord)
@@ -791,6 +925,12 @@ func (pm *PositionManager) executeDecisionWithRecord(d *decision.Decision, actio
 		return pm.executeCloseShort(d, actionRecord)
 	case "update_loss_profit":
 		return pm.executeUpdateLossProfit(d, actionRecord)
+	case "set_trailing_stop":
+		return pm.executeSetTrailingStop(d, actionRecord)
+	case "add_margin_long":
+		return pm.executeAddMargin(d, "long", actionRecord)
+	case "add_margin_short":
+		return pm.executeAddMargin(d, "short", actionRecord)
 	case "hold":
 		return nil
 	default:
@@ -809,7 +949,7 @@ func (pm *PositionManager) executeIncreaseLong(d *decision.Decision, actionRecor
 
 	hasPosition := false
 	for _, pos := range positions {
-		if pos["symbol"] == d.Symbol && pos["side"] == "long" {
+		if pos.Symbol == d.Symbol && pos.Side == "long" {
 			hasPosition = true
 			break
 		}
@@ -828,16 +968,17 @@ func (pm *PositionManager) executeIncreaseLong(d *decision.Decision, actionRecor
 	actionRecord.Quantity = quantity
 	actionRecord.Price = marketData.CurrentPrice
 
-	order, err := pm.trader.OpenLong(d.Symbol, quantity, d.Leverage)
+	// 订单较大时按配置拆单执行
+	order, err := pm.exec.execute(d.Symbol, true, quantity, marketData.CurrentPrice, func(q float64) (*OrderResult, error) {
+		return pm.trader.OpenLong(d.Symbol, q, d.Leverage)
+	}, actionRecord)
 	if err != nil {
 		return err
 	}
 
-	if orderID, ok := order["orderId"].(int64); ok {
-		actionRecord.OrderID = orderID
-	}
+	recordOrderFill(actionRecord, order)
 
-	log.Printf("  ✓ 加仓成功，数量: %.4f", quantity)
+	log.Printf("  ✓ 加仓成功，数量: %.4f", filledQuantity(order, quantity))
 
 	// 更新止损止盈
 	posKey := d.Symbol + "_long"
@@ -859,18 +1000,13 @@ func (pm *PositionManager) executeIncreaseLong(d *decision.Decision, actionRecor
 
 	var totalQuantity float64
 	for _, pos := range positions {
-		if pos["symbol"] == d.Symbol && pos["side"] == "long" {
-			totalQuantity = pos["positionAmt"].(float64)
+		if pos.Symbol == d.Symbol && pos.Side == "long" {
+			totalQuantity = pos.PositionAmt
 			break
 		}
 	}
 
-	if err := pm.trader.SetStopLoss(d.Symbol, "LONG", totalQuantity, d.StopLoss); err != nil {
-		log.Printf("  ⚠ 设置止损失败: %v", err)
-	}
-	if err := pm.trader.SetTakeProfit(d.Symbol, "LONG", totalQuantity, d.TakeProfit); err != nil {
-		log.Printf("  ⚠ 设置止盈失败: %v", err)
-	}
+	placeProtectiveOrders(pm.trader, d.Symbol, "LONG", totalQuantity, d.StopLoss, d.TakeProfit)
 
 	return nil
 }
@@ -886,7 +1022,7 @@ func (pm *PositionManager) executeIncreaseShort(d *decision.Decision, actionReco
 
 	hasPosition := false
 	for _, pos := range positions {
-		if pos["symbol"] == d.Symbol && pos["side"] == "short" {
+		if pos.Symbol == d.Symbol && pos.Side == "short" {
 			hasPosition = true
 			break
 		}
@@ -905,16 +1041,17 @@ func (pm *PositionManager) executeIncreaseShort(d *decision.Decision, actionReco
 	actionRecord.Quantity = quantity
 	actionRecord.Price = marketData.CurrentPrice
 
-	order, err := pm.trader.OpenShort(d.Symbol, quantity, d.Leverage)
+	// 订单较大时按配置拆单执行
+	order, err := pm.exec.execute(d.Symbol, false, quantity, marketData.CurrentPrice, func(q float64) (*OrderResult, error) {
+		return pm.trader.OpenShort(d.Symbol, q, d.Leverage)
+	}, actionRecord)
 	if err != nil {
 		return err
 	}
 
-	if orderID, ok := order["orderId"].(int64); ok {
-		actionRecord.OrderID = orderID
-	}
+	recordOrderFill(actionRecord, order)
 
-	log.Printf("  ✓ 加仓成功，数量: %.4f", quantity)
+	log.Printf("  ✓ 加仓成功，数量: %.4f", filledQuantity(order, quantity))
 
 	posKey := d.Symbol + "_short"
 	if tracking, exists := pm.positionPnLTracking[posKey]; exists {
@@ -935,21 +1072,13 @@ func (pm *PositionManager) executeIncreaseShort(d *decision.Decision, actionReco
 
 	var totalQuantity float64
 	for _, pos := range positions {
-		if pos["symbol"] == d.Symbol && pos["side"] == "short" {
-			totalQuantity = pos["positionAmt"].(float64)
-			if totalQuantity < 0 {
-				totalQuantity = -totalQuantity
-			}
+		if pos.Symbol == d.Symbol && pos.Side == "short" {
+			totalQuantity = pos.PositionAmt
 			break
 		}
 	}
 
-	if err := pm.trader.SetStopLoss(d.Symbol, "SHORT", totalQuantity, d.StopLoss); err != nil {
-		log.Printf("  ⚠ 设置止损失败: %v", err)
-	}
-	if err := pm.trader.SetTakeProfit(d.Symbol, "SHORT", totalQuantity, d.TakeProfit); err != nil {
-		log.Printf("  ⚠ 设置止盈失败: %v", err)
-	}
+	placeProtectiveOrders(pm.trader, d.Symbol, "SHORT", totalQuantity, d.StopLoss, d.TakeProfit)
 
 	return nil
 }
@@ -966,8 +1095,8 @@ func (pm *PositionManager) executeDecreaseLong(d *decision.Decision, actionRecor
 	var currentQuantity float64
 	hasPosition := false
 	for _, pos := range positions {
-		if pos["symbol"] == d.Symbol && pos["side"] == "long" {
-			currentQuantity = pos["positionAmt"].(float64)
+		if pos.Symbol == d.Symbol && pos.Side == "long" {
+			currentQuantity = pos.PositionAmt
 			hasPosition = true
 			break
 		}
@@ -991,14 +1120,16 @@ func (pm *PositionManager) executeDecreaseLong(d *decision.Decision, actionRecor
 	actionRecord.Quantity = decreaseQuantity
 	actionRecord.Price = marketData.CurrentPrice
 
-	order, err := pm.trader.CloseLong(d.Symbol, decreaseQuantity)
+	// 订单较大时按配置拆单执行
+	order, err := pm.exec.execute(d.Symbol, false, decreaseQuantity, marketData.CurrentPrice, func(q float64) (*OrderResult, error) {
+		return pm.trader.CloseLong(d.Symbol, q)
+	}, actionRecord)
 	if err != nil {
 		return err
 	}
 
-	if orderID, ok := order["orderId"].(int64); ok {
-		actionRecord.OrderID = orderID
-	}
+	recordOrderFill(actionRecord, order)
+	decreaseQuantity = filledQuantity(order, decreaseQuantity) // 拆单中途失败时只减了一部分
 
 	log.Printf("  ✓ 减仓成功，数量: %.4f (剩余: %.4f)", decreaseQuantity, currentQuantity-decreaseQuantity)
 
@@ -1032,11 +1163,8 @@ func (pm *PositionManager) executeDecreaseShort(d *decision.Decision, actionReco
 	var currentQuantity float64
 	hasPosition := false
 	for _, pos := range positions {
-		if pos["symbol"] == d.Symbol && pos["side"] == "short" {
-			currentQuantity = pos["positionAmt"].(float64)
-			if currentQuantity < 0 {
-				currentQuantity = -currentQuantity
-			}
+		if pos.Symbol == d.Symbol && pos.Side == "short" {
+			currentQuantity = pos.PositionAmt
 			hasPosition = true
 			break
 		}
@@ -1060,14 +1188,16 @@ func (pm *PositionManager) executeDecreaseShort(d *decision.Decision, actionReco
 	actionRecord.Quantity = decreaseQuantity
 	actionRecord.Price = marketData.CurrentPrice
 
-	order, err := pm.trader.CloseShort(d.Symbol, decreaseQuantity)
+	// 订单较大时按配置拆单执行
+	order, err := pm.exec.execute(d.Symbol, true, decreaseQuantity, marketData.CurrentPrice, func(q float64) (*OrderResult, error) {
+		return pm.trader.CloseShort(d.Symbol, q)
+	}, actionRecord)
 	if err != nil {
 		return err
 	}
 
-	if orderID, ok := order["orderId"].(int64); ok {
-		actionRecord.OrderID = orderID
-	}
+	recordOrderFill(actionRecord, order)
+	decreaseQuantity = filledQuantity(order, decreaseQuantity) // 拆单中途失败时只减了一部分
 
 	log.Printf("  ✓ 减仓成功，数量: %.4f (剩余: %.4f)", decreaseQuantity, currentQuantity-decreaseQuantity)
 
@@ -1104,9 +1234,7 @@ func (pm *PositionManager) executeCloseLong(d *decision.Decision, actionRecord *
 		return err
 	}
 
-	if orderID, ok := order["orderId"].(int64); ok {
-		actionRecord.OrderID = orderID
-	}
+	recordOrderFill(actionRecord, order)
 
 	log.Printf("  ✓ 平仓成功")
 	return nil
@@ -1127,9 +1255,7 @@ func (pm *PositionManager) executeCloseShort(d *decision.Decision, actionRecord
 		return err
 	}
 
-	if orderID, ok := order["orderId"].(int64); ok {
-		actionRecord.OrderID = orderID
-	}
+	recordOrderFill(actionRecord, order)
 
 	log.Printf("  ✓ 平仓成功")
 	return nil
@@ -1144,12 +1270,10 @@ func (pm *PositionManager) executeUpdateLossProfit(d *decision.Decision, actionR
 		return fmt.Errorf("获取持仓信息失败: %w", err)
 	}
 
-	var position map[string]interface{}
-	var positionSide string
-	for _, pos := range positions {
-		if pos["symbol"] == d.Symbol {
-			position = pos
-			positionSide = pos["side"].(string)
+	var position *Position
+	for i := range positions {
+		if positions[i].Symbol == d.Symbol {
+			position = &positions[i]
 			break
 		}
 	}
@@ -1158,10 +1282,8 @@ func (pm *PositionManager) executeUpdateLossProfit(d *decision.Decision, actionR
 		return fmt.Errorf("❌ %s 没有持仓，无法更新止盈止损", d.Symbol)
 	}
 
-	quantity, ok := position["positionAmt"].(float64)
-	if !ok {
-		return fmt.Errorf("无法获取持仓数量")
-	}
+	positionSide := position.Side
+	quantity := position.PositionAmt
 
 	marketData, err := market.Get(d.Symbol, pm.config.ScanIntervalMinutes)
 	if err != nil {
@@ -1172,47 +1294,119 @@ func (pm *PositionManager) executeUpdateLossProfit(d *decision.Decision, actionR
 	log.Printf("  📊 当前持仓: %s | 当前价格: %.4f | 新止损: %.4f | 新止盈: %.4f",
 		strings.ToUpper(positionSide), marketData.CurrentPrice, d.StopLoss, d.TakeProfit)
 
-	if positionSide == "long" {
-		if d.TakeProfit <= d.StopLoss {
-			return fmt.Errorf("❌ 多头持仓时，止盈价格(%.4f)必须大于止损价格(%.4f)", d.TakeProfit, d.StopLoss)
-		}
-		if d.StopLoss >= marketData.CurrentPrice {
-			return fmt.Errorf("❌ 多头持仓时，止损价格(%.4f)应该低于当前价格(%.4f)", d.StopLoss, marketData.CurrentPrice)
-		}
-	} else if positionSide == "short" {
-		if d.StopLoss <= d.TakeProfit {
-			return fmt.Errorf("❌ 空头持仓时，止损价格(%.4f)必须大于止盈价格(%.4f)", d.StopLoss, d.TakeProfit)
+	if err := validateProtectivePrices(positionSide, marketData.CurrentPrice, d.StopLoss, d.TakeProfit); err != nil {
+		return err
+	}
+
+	if err := replaceProtectiveOrders(pm.trader, d.Symbol, positionSide, quantity, d.StopLoss, d.TakeProfit); err != nil {
+		return err
+	}
+
+	posKey := d.Symbol + "_" + strings.ToLower(positionSide)
+	if tracking, exists := pm.positionPnLTracking[posKey]; exists {
+		if d.StopLoss > 0 {
+			tracking.StopLossPrice = d.StopLoss
 		}
-		if d.StopLoss <= marketData.CurrentPrice {
-			return fmt.Errorf("❌ 空头持仓时，止损价格(%.4f)应该高于当前价格(%.4f)", d.StopLoss, marketData.CurrentPrice)
+		if d.TakeProfit > 0 {
+			tracking.TakeProfitPrice = d.TakeProfit
 		}
+		log.Printf("  ✅ 止盈止损更新成功 - 新止损: %.4f, 新止盈: %.4f", tracking.StopLossPrice, tracking.TakeProfitPrice)
 	}
 
-	if err := pm.trader.CancelAllOrders(d.Symbol); err != nil {
-		log.Printf("  ⚠️  取消全部委托订单失败: %v", err)
+	pm.positionInvalidationConditions[d.Symbol] = d.InvalidationCondition
+
+	return nil
+}
+
+// executeSetTrailingStop 为持仓设置追踪止损（原有止损止盈单保持不变）
+func (pm *PositionManager) executeSetTrailingStop(d *decision.Decision, actionRecord *logger.DecisionAction) error {
+	log.Printf("  🔁 设置追踪止损: %s (回调%.2f%%, 激活价%.4f)", d.Symbol, d.CallbackRate, d.ActivationPrice)
+
+	marketData, err := market.Get(d.Symbol, pm.config.ScanIntervalMinutes)
+	if err != nil {
+		return err
 	}
+	return applyTrailingStop(pm.trader, d, marketData.CurrentPrice, actionRecord)
+}
+
+// executeAddMargin 为逐仓仓位追加保证金（拉远强平价，代替减仓）
+func (pm *PositionManager) executeAddMargin(d *decision.Decision, side string, actionRecord *logger.DecisionAction) error {
+	log.Printf("  🛟 追加保证金: %s %s %.2f USDT", d.Symbol, strings.ToUpper(side), d.MarginUSD)
 
-	positionSideUpper := strings.ToUpper(positionSide)
-	if err := pm.trader.SetStopLoss(d.Symbol, positionSideUpper, quantity, d.StopLoss); err != nil {
-		return fmt.Errorf("设置新止损失败: %w", err)
+	if d.MarginUSD <= 0 {
+		return fmt.Errorf("❌ 追加保证金金额必须大于0: %.2f", d.MarginUSD)
+	}
+	if marginMode, _ := pm.trader.GetTradingModes(); marginMode == MarginModeCross {
+		return fmt.Errorf("❌ 全仓模式下无法追加单个仓位的保证金")
+	}
+	if !pm.trader.Capabilities().AdjustMargin {
+		return fmt.Errorf("❌ %s 不支持调整逐仓保证金", pm.exchange)
 	}
 
-	if err := pm.trader.SetTakeProfit(d.Symbol, positionSideUpper, quantity, d.TakeProfit); err != nil {
-		return fmt.Errorf("设置新止盈失败: %w", err)
+	positions, err := pm.trader.GetPositions()
+	if err != nil {
+		return fmt.Errorf("获取持仓信息失败: %w", err)
+	}
+	var position *Position
+	for i := range positions {
+		if positions[i].Symbol == d.Symbol && positions[i].Side == side {
+			position = &positions[i]
+			break
+		}
+	}
+	if position == nil {
+		return fmt.Errorf("❌ %s 没有%s仓，无法追加保证金", d.Symbol, side)
 	}
 
-	posKey := d.Symbol + "_" + strings.ToLower(positionSide)
-	if tracking, exists := pm.positionPnLTracking[posKey]; exists {
-		tracking.StopLossPrice = d.StopLoss
-		tracking.TakeProfitPrice = d.TakeProfit
-		log.Printf("  ✅ 止盈止损更新成功 - 新止损: %.4f, 新止盈: %.4f", d.StopLoss, d.TakeProfit)
+	balance, err := pm.trader.GetBalance()
+	if err != nil {
+		return fmt.Errorf("获取账户余额失败: %w", err)
+	}
+	if d.MarginUSD > balance.AvailableBalance {
+		return fmt.Errorf("❌ 可用余额不足: 追加 %.2f USDT，可用 %.2f USDT", d.MarginUSD, balance.AvailableBalance)
 	}
 
-	pm.positionInvalidationConditions[d.Symbol] = d.InvalidationCondition
+	actionRecord.Quantity = position.PositionAmt
+	actionRecord.Price = position.MarkPrice
+	actionRecord.Margin = d.MarginUSD
+
+	if err := pm.trader.AdjustIsolatedMargin(d.Symbol, strings.ToUpper(side), d.MarginUSD); err != nil {
+		return err
+	}
 
+	log.Printf("  ✓ 追加保证金成功 (原强平价: %.4f)", position.LiquidationPrice)
 	return nil
 }
 
+// handleTradeEvent 处理交易所实时推送（在推送goroutine中调用）
+// 止损、止盈、强平成交立即写入决策日志
+func (pm *PositionManager) handleTradeEvent(event TradeEvent) {
+	if event.Fill == nil || !isProtectiveClose(event.Fill) {
+		return
+	}
+	if err := pm.decisionLogger.LogDecision(closeRecordForFill(event.Fill)); err != nil {
+		log.Printf("⚠ 保存实时平仓记录失败: %v", err)
+	}
+	if event.Fill.PositionAfter == 0 {
+		pm.realtimeMu.Lock()
+		pm.realtimeClosed = append(pm.realtimeClosed, event.Fill.Symbol+"_"+event.Fill.Side)
+		pm.realtimeMu.Unlock()
+	}
+}
+
+// clearRealtimeClosed 清理已平仓持仓的跟踪数据
+func (pm *PositionManager) clearRealtimeClosed() {
+	pm.realtimeMu.Lock()
+	closed := pm.realtimeClosed
+	pm.realtimeClosed = nil
+	pm.realtimeMu.Unlock()
+
+	for _, posKey := range closed {
+		delete(pm.positionFirstSeenTime, posKey)
+		delete(pm.positionPnLTracking, posKey)
+	}
+}
+
 // GetID 获取管理器ID
 func (pm *PositionManager) GetID() string {
 	return pm.id
@@ -1236,11 +1430,15 @@ func (pm *PositionManager) GetStatus() map[string]interface{} {
 		"ai_model":        pm.aiModel,
 		"exchange":        pm.exchange,
 		"is_running":      pm.isRunning,
+		"killed":          pm.Killed(),
 		"start_time":      pm.startTime.Format(time.RFC3339),
 		"runtime_minutes": int(time.Since(pm.startTime).Minutes()),
 		"call_count":      pm.callCount,
 		"initial_balance": pm.initialBalance,
 		"scan_interval":   pm.config.ScanInterval.String(),
+		"capabilities":    effectiveCapabilities(pm.trader),
+		"brackets":        bracketList(pm.trader),
+		"circuit_breaker": pm.breaker.snapshot(pm.breakerLimits()),
 	}
 }
 
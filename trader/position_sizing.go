@@ -0,0 +1,98 @@
+package trader
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"nofx/decision"
+	"nofx/logger"
+)
+
+// 仓位计算方式（AutoTraderConfig.PositionSizing）
+const (
+	PositionSizingAI   = "ai"   // 使用AI给出的position_size_usd
+	PositionSizingRisk = "risk" // 按单笔风险和止损距离计算
+)
+
+// marginHeadroom 按可用保证金截断仓位时预留的比例（手续费、滑点和价格波动）
+const marginHeadroom = 0.95
+
+// riskSizing 按风险计算的仓位
+type riskSizing struct {
+	SizeUSD float64 // 仓位价值
+	RiskUSD float64 // 止损时的亏损金额（截断后按实际仓位计算）
+	Limit   string  // 截断原因（为空表示未截断）
+}
+
+// computeRiskSize 按单笔风险计算仓位价值：
+// 风险金额 = 净值 × riskPct%（AI给出更小的risk_usd时以AI为准），
+// 数量 = 风险金额 / |入场价 - 止损价|，仓位价值 = 数量 × 入场价；
+// 再按单币种仓位上限和杠杆可用保证金截断
+func computeRiskSize(symbol string, equity, available, riskPct, aiRiskUSD, entryPrice, stopLoss float64, leverage int) (riskSizing, error) {
+	if equity <= 0 {
+		return riskSizing{}, fmt.Errorf("账户净值无效: %.2f", equity)
+	}
+	if entryPrice <= 0 || stopLoss <= 0 {
+		return riskSizing{}, fmt.Errorf("按风险计算仓位需要有效的入场价和止损价 (入场价: %.4f, 止损价: %.4f)", entryPrice, stopLoss)
+	}
+	stopDistance := math.Abs(entryPrice - stopLoss)
+	if stopDistance == 0 {
+		return riskSizing{}, fmt.Errorf("止损价不能等于入场价: %.4f", stopLoss)
+	}
+	if leverage <= 0 {
+		leverage = 1
+	}
+
+	riskUSD := equity * riskPct / 100
+	if aiRiskUSD > 0 && aiRiskUSD < riskUSD {
+		riskUSD = aiRiskUSD
+	}
+	sizing := riskSizing{SizeUSD: riskUSD / stopDistance * entryPrice}
+
+	if maxValue := decision.MaxPositionValue(symbol, equity); sizing.SizeUSD > maxValue {
+		sizing.SizeUSD, sizing.Limit = maxValue, fmt.Sprintf("单币种仓位上限%.2f USDT", maxValue)
+	}
+	if maxValue := available * float64(leverage) * marginHeadroom; sizing.SizeUSD > maxValue {
+		sizing.SizeUSD, sizing.Limit = maxValue, fmt.Sprintf("可用保证金%.2f USDT × %d倍杠杆", available, leverage)
+	}
+	if sizing.SizeUSD <= 0 {
+		return riskSizing{}, fmt.Errorf("可用保证金不足: %.2f USDT", available)
+	}
+	sizing.RiskUSD = sizing.SizeUSD / entryPrice * stopDistance
+	return sizing, nil
+}
+
+// applyPositionSizing 按配置的仓位计算方式确定开仓价值（entryPrice为预计成交价）
+// 按风险计算时替换d.PositionSizeUSD，AI给出的仓位和计算的仓位都记录到actionRecord
+func (at *AutoTrader) applyPositionSizing(d *decision.Decision, entryPrice float64, actionRecord *logger.DecisionAction) error {
+	actionRecord.ProposedSizeUSD = d.PositionSizeUSD
+	actionRecord.SizeUSD = d.PositionSizeUSD
+	if at.config.PositionSizing != PositionSizingRisk {
+		return nil
+	}
+
+	balance, err := at.trader.GetBalance()
+	if err != nil {
+		return fmt.Errorf("获取账户余额失败，无法按风险计算仓位: %w", err)
+	}
+	sizing, err := computeRiskSize(d.Symbol, balance.TotalEquity(), balance.AvailableBalance,
+		at.config.RiskPerTradePct, d.RiskUSD, entryPrice, d.StopLoss, d.Leverage)
+	if err != nil {
+		return err
+	}
+	if minNotional := effectiveCapabilities(at.trader).MinNotional; sizing.SizeUSD < minNotional {
+		return fmt.Errorf("按风险计算的仓位价值(%.2f)低于交易所最小下单名义价值(%.0f USDT)", sizing.SizeUSD, minNotional)
+	}
+
+	limit := ""
+	if sizing.Limit != "" {
+		limit = "，受" + sizing.Limit + "限制"
+	}
+	log.Printf("  📐 按风险计算仓位: AI建议 %.2f USDT → %.2f USDT (风险 %.2f USDT，止损距离 %.2f%%%s)",
+		d.PositionSizeUSD, sizing.SizeUSD, sizing.RiskUSD, math.Abs(entryPrice-d.StopLoss)/entryPrice*100, limit)
+
+	d.PositionSizeUSD = sizing.SizeUSD
+	actionRecord.SizeUSD = sizing.SizeUSD
+	actionRecord.RiskUSD = sizing.RiskUSD
+	return nil
+}
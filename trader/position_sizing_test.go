@@ -0,0 +1,69 @@
+package trader
+
+import (
+	"nofx/decision"
+	"nofx/logger"
+	"strings"
+	"testing"
+)
+
+func TestComputeRiskSize(t *testing.T) {
+	// 净值1000，单笔风险1%=10 USDT，止损距离2% → 仓位500 USDT
+	sizing, err := computeRiskSize("SOLUSDT", 1000, 1000, 1, 0, 150, 147, 5)
+	if err != nil {
+		t.Fatalf("计算仓位失败: %v", err)
+	}
+	if !floatEq(sizing.SizeUSD, 500) || !floatEq(sizing.RiskUSD, 10) || sizing.Limit != "" {
+		t.Errorf("仓位计算错误: %+v", sizing)
+	}
+
+	// AI给出更小的风险金额时以AI为准（做空：止损在入场价之上）
+	sizing, _ = computeRiskSize("SOLUSDT", 1000, 1000, 1, 6, 150, 153, 5)
+	if !floatEq(sizing.SizeUSD, 300) || !floatEq(sizing.RiskUSD, 6) {
+		t.Errorf("应使用AI给出的风险金额: %+v", sizing)
+	}
+
+	// 止损很近时按单币种仓位上限截断（山寨币5倍净值）
+	sizing, _ = computeRiskSize("SOLUSDT", 1000, 100000, 1, 0, 150, 149.9, 20)
+	if !floatEq(sizing.SizeUSD, 5000) || !strings.Contains(sizing.Limit, "单币种仓位上限") || sizing.RiskUSD < 3.33 || sizing.RiskUSD > 3.34 {
+		t.Errorf("应按单币种仓位上限截断: %+v", sizing)
+	}
+
+	// 可用保证金不足时按杠杆可下单的价值截断
+	sizing, _ = computeRiskSize("BTCUSDT", 1000, 100, 1, 0, 60000, 59400, 3)
+	if !floatEq(sizing.SizeUSD, 100*3*marginHeadroom) || !strings.Contains(sizing.Limit, "可用保证金") {
+		t.Errorf("应按可用保证金截断: %+v", sizing)
+	}
+
+	if _, err := computeRiskSize("BTCUSDT", 1000, 1000, 1, 0, 60000, 60000, 3); err == nil {
+		t.Error("止损价等于入场价时应报错")
+	}
+	if _, err := computeRiskSize("BTCUSDT", 1000, 0, 1, 0, 60000, 59000, 3); err == nil {
+		t.Error("没有可用保证金时应报错")
+	}
+}
+
+func TestApplyPositionSizingRecordsBothSizes(t *testing.T) {
+	_, trader := newFakeBinance(t)
+	d := &decision.Decision{Symbol: "BTCUSDT", Action: "open_long", Leverage: 10, PositionSizeUSD: 20000, EntryPrice: 60000, StopLoss: 58800}
+
+	// 默认使用AI给出的仓位
+	at := &AutoTrader{trader: trader, config: AutoTraderConfig{PositionSizing: PositionSizingAI}}
+	var record logger.DecisionAction
+	if err := at.applyPositionSizing(d, 60000, &record); err != nil {
+		t.Fatalf("计算仓位失败: %v", err)
+	}
+	if !floatEq(d.PositionSizeUSD, 20000) || !floatEq(record.ProposedSizeUSD, 20000) || !floatEq(record.SizeUSD, 20000) || record.RiskUSD != 0 {
+		t.Errorf("AI模式不应修改仓位: %+v %+v", d, record)
+	}
+
+	// 净值10000，单笔风险1%=100 USDT，止损距离2% → 5000 USDT
+	at.config = AutoTraderConfig{PositionSizing: PositionSizingRisk, RiskPerTradePct: 1}
+	record = logger.DecisionAction{}
+	if err := at.applyPositionSizing(d, 60000, &record); err != nil {
+		t.Fatalf("计算仓位失败: %v", err)
+	}
+	if !floatEq(d.PositionSizeUSD, 5000) || !floatEq(record.ProposedSizeUSD, 20000) || !floatEq(record.SizeUSD, 5000) || !floatEq(record.RiskUSD, 100) {
+		t.Errorf("按风险计算的仓位错误: %+v %+v", d, record)
+	}
+}
@@ -0,0 +1,375 @@
+package trader
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// 币安/Aster合约接口每分钟请求权重上限（REQUEST_WEIGHT）
+	binanceWeightLimit = 2400
+	// 实际只使用上限的80%，给行情模块等同IP请求留出余量
+	rateLimitUsageRatio = 0.8
+
+	// 被限流(429)时未返回Retry-After的默认等待时间
+	defaultRateLimitBackoff = 10 * time.Second
+	// 被封禁IP(418)时未返回Retry-After的默认等待时间
+	defaultBanBackoff = 2 * time.Minute
+)
+
+// RateLimiter 按请求权重计费的令牌桶限流器
+// 额度不足时排队等待而不是返回错误；同一交易所同一API Key的所有交易器共享一个实例
+type RateLimiter struct {
+	name string
+
+	mu           sync.Mutex
+	capacity     float64   // 每分钟可用权重
+	tokens       float64   // 当前剩余权重
+	refillPerSec float64   // 每秒恢复的权重
+	lastRefill   time.Time // 上次恢复时间
+	pausedUntil  time.Time // 被限流后暂停到该时间
+}
+
+var (
+	rateLimiters   = make(map[string]*RateLimiter)
+	rateLimitersMu sync.Mutex
+)
+
+// NewRateLimiter 创建限流器
+// weightPerMinute: 交易所每分钟权重上限（实际按rateLimitUsageRatio打折使用）
+func NewRateLimiter(name string, weightPerMinute int) *RateLimiter {
+	capacity := float64(weightPerMinute) * rateLimitUsageRatio
+	return &RateLimiter{
+		name:         name,
+		capacity:     capacity,
+		tokens:       capacity,
+		refillPerSec: capacity / 60,
+		lastRefill:   time.Now(),
+	}
+}
+
+// sharedRateLimiter 获取交易所+API Key对应的共享限流器（不存在时创建）
+func sharedRateLimiter(exchange, apiKey string, weightPerMinute int) *RateLimiter {
+	key := exchange + ":" + apiKey
+
+	rateLimitersMu.Lock()
+	defer rateLimitersMu.Unlock()
+
+	if limiter, ok := rateLimiters[key]; ok {
+		return limiter
+	}
+	limiter := NewRateLimiter(exchange, weightPerMinute)
+	rateLimiters[key] = limiter
+	return limiter
+}
+
+// refillLocked 按经过的时间恢复权重（调用方需持有锁）
+func (l *RateLimiter) refillLocked(now time.Time) {
+	elapsed := now.Sub(l.lastRefill).Seconds()
+	if elapsed > 0 {
+		l.tokens += elapsed * l.refillPerSec
+		if l.tokens > l.capacity {
+			l.tokens = l.capacity
+		}
+		l.lastRefill = now
+	}
+}
+
+// Wait 扣除一次请求的权重，额度不足或处于限流暂停期时阻塞等待
+func (l *RateLimiter) Wait(weight int) {
+	w := float64(weight)
+	if w > l.capacity {
+		w = l.capacity
+	}
+
+	for {
+		l.mu.Lock()
+		now := time.Now()
+		l.refillLocked(now)
+
+		var wait time.Duration
+		if now.Before(l.pausedUntil) {
+			wait = l.pausedUntil.Sub(now)
+		} else if l.tokens >= w {
+			l.tokens -= w
+			l.mu.Unlock()
+			return
+		} else {
+			wait = time.Duration((w - l.tokens) / l.refillPerSec * float64(time.Second))
+		}
+		l.mu.Unlock()
+
+		if wait >= time.Second {
+			log.Printf("  ⏳ [%s] 请求权重额度不足，等待 %.1f 秒", l.name, wait.Seconds())
+		}
+		time.Sleep(wait)
+	}
+}
+
+// SyncUsedWeight 按交易所返回的已用权重校正剩余额度（只会调低，不会调高）
+func (l *RateLimiter) SyncUsedWeight(used int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.refillLocked(time.Now())
+	if remaining := l.capacity - float64(used); remaining < l.tokens {
+		l.tokens = remaining
+	}
+}
+
+// Backoff 被交易所限流后暂停所有请求一段时间
+func (l *RateLimiter) Backoff(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	until := time.Now().Add(d)
+	if until.After(l.pausedUntil) {
+		l.pausedUntil = until
+	}
+	l.tokens = 0
+	l.lastRefill = until
+}
+
+// rateLimitedTransport 在HTTP层做限流的RoundTripper
+// 请求前按权重排队，响应后读取已用权重，被限流(429/418)时暂停并重试
+type rateLimitedTransport struct {
+	limiter *RateLimiter
+	weight  func(req *http.Request) int
+	// resign 重试前重新签名（签名中带时间戳的接口需要，为nil时签名请求不在此重试）
+	resign func(req *http.Request) error
+	base   http.RoundTripper
+}
+
+// newRateLimitedTransport 创建限流Transport（base为nil时使用http.DefaultTransport）
+func newRateLimitedTransport(limiter *RateLimiter, weight func(req *http.Request) int, resign func(req *http.Request) error, base http.RoundTripper) *rateLimitedTransport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &rateLimitedTransport{limiter: limiter, weight: weight, resign: resign, base: base}
+}
+
+// RoundTrip 实现http.RoundTripper
+func (rt *rateLimitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	const maxAttempts = 3
+
+	for attempt := 1; ; attempt++ {
+		rt.limiter.Wait(rt.weight(req))
+
+		resp, err := rt.base.RoundTrip(req)
+		if err != nil {
+			return nil, err
+		}
+
+		if used, ok := usedWeightFromHeader(resp.Header); ok {
+			rt.limiter.SyncUsedWeight(used)
+		}
+
+		if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusTeapot {
+			return resp, nil
+		}
+
+		backoff := retryAfter(resp.Header, resp.StatusCode)
+		rt.limiter.Backoff(backoff)
+		log.Printf("⚠️ [%s] 触发交易所限流 (HTTP %d)，暂停请求 %.0f 秒", rt.limiter.name, resp.StatusCode, backoff.Seconds())
+
+		if attempt >= maxAttempts || !rt.canRetry(req) {
+			return resp, nil
+		}
+
+		next, err := rt.replay(req)
+		if err != nil {
+			return resp, nil
+		}
+		resp.Body.Close()
+		req = next
+	}
+}
+
+// canRetry 请求能否在Transport层重放
+func (rt *rateLimitedTransport) canRetry(req *http.Request) bool {
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false
+	}
+	return rt.resign != nil || !isSignedRequest(req)
+}
+
+// replay 复制请求用于重试（必要时重新签名）
+func (rt *rateLimitedTransport) replay(req *http.Request) (*http.Request, error) {
+	next := req.Clone(req.Context())
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		next.Body = body
+	}
+	if rt.resign != nil && isSignedRequest(next) {
+		if err := rt.resign(next); err != nil {
+			return nil, err
+		}
+	}
+	return next, nil
+}
+
+// isSignedRequest 请求是否带签名（querystring或表单body中含signature参数）
+func isSignedRequest(req *http.Request) bool {
+	if req.URL.Query().Get("signature") != "" {
+		return true
+	}
+	if req.GetBody == nil {
+		return false
+	}
+	rc, err := req.GetBody()
+	if err != nil {
+		return false
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return false
+	}
+	form, err := url.ParseQuery(string(data))
+	return err == nil && form.Get("signature") != ""
+}
+
+// usedWeightFromHeader 读取响应头中的已用权重（X-MBX-USED-WEIGHT-1M）
+func usedWeightFromHeader(header http.Header) (int, bool) {
+	for _, key := range []string{"X-Mbx-Used-Weight-1m", "X-Mbx-Used-Weight"} {
+		if v := header.Get(key); v != "" {
+			used, err := strconv.Atoi(v)
+			return used, err == nil
+		}
+	}
+	return 0, false
+}
+
+// retryAfter 读取Retry-After响应头（秒），未返回时使用默认值
+func retryAfter(header http.Header, statusCode int) time.Duration {
+	if v := header.Get("Retry-After"); v != "" {
+		if seconds, err := strconv.Atoi(v); err == nil && seconds > 0 {
+			return time.Duration(seconds) * time.Second
+		}
+	}
+	if statusCode == http.StatusTeapot {
+		return defaultBanBackoff
+	}
+	return defaultRateLimitBackoff
+}
+
+// binanceRequestWeight 币安合约接口的请求权重（Aster接口与币安一致）
+// 参考: https://developers.binance.com/docs/derivatives/usds-margined-futures
+func binanceRequestWeight(req *http.Request) int {
+	path := req.URL.Path
+	// 去掉 /fapi/v1/ 等版本前缀
+	if i := strings.Index(path, "/fapi/v"); i >= 0 {
+		if j := strings.Index(path[i+len("/fapi/v"):], "/"); j >= 0 {
+			path = path[i+len("/fapi/v")+j:]
+		}
+	}
+	query := req.URL.Query()
+	hasSymbol := query.Get("symbol") != ""
+
+	switch path {
+	case "/account", "/balance", "/positionRisk", "/userTrades", "/income":
+		return 5
+	case "/ticker/price", "/ticker/bookTicker":
+		if hasSymbol {
+			return 1
+		}
+		return 2
+	case "/ticker/24hr":
+		if hasSymbol {
+			return 1
+		}
+		return 40
+	case "/openOrders":
+		if hasSymbol {
+			return 1
+		}
+		return 40
+	case "/premiumIndex":
+		if hasSymbol {
+			return 1
+		}
+		return 10
+	case "/klines", "/markPriceKlines", "/indexPriceKlines":
+		limit := queryLimit(query, 500)
+		switch {
+		case limit < 100:
+			return 1
+		case limit < 500:
+			return 2
+		case limit <= 1000:
+			return 5
+		default:
+			return 10
+		}
+	case "/depth":
+		limit := queryLimit(query, 500)
+		switch {
+		case limit <= 50:
+			return 2
+		case limit <= 100:
+			return 5
+		case limit <= 500:
+			return 10
+		default:
+			return 20
+		}
+	case "/allOrders":
+		return 5
+	default:
+		// 下单、撤单、设置杠杆、exchangeInfo等
+		return 1
+	}
+}
+
+// queryLimit 读取limit参数，未传时返回交易所默认值
+func queryLimit(query url.Values, defaultLimit int) int {
+	if limit, err := strconv.Atoi(query.Get("limit")); err == nil && limit > 0 {
+		return limit
+	}
+	return defaultLimit
+}
+
+// binanceResigner 重试前用当前时间戳重新生成HMAC签名（币安签名请求带timestamp，过期会被拒绝）
+func binanceResigner(secretKey string) func(req *http.Request) error {
+	return func(req *http.Request) error {
+		var body string
+		if req.GetBody != nil {
+			rc, err := req.GetBody()
+			if err != nil {
+				return err
+			}
+			data, err := io.ReadAll(rc)
+			rc.Close()
+			if err != nil {
+				return err
+			}
+			body = string(data)
+			req.Body, _ = req.GetBody()
+		}
+
+		query, err := url.ParseQuery(req.URL.RawQuery)
+		if err != nil {
+			return err
+		}
+		query.Del("signature")
+		query.Set("timestamp", strconv.FormatInt(time.Now().UnixMilli(), 10))
+		raw := query.Encode()
+
+		mac := hmac.New(sha256.New, []byte(secretKey))
+		mac.Write([]byte(raw + body))
+		req.URL.RawQuery = raw + "&signature=" + hex.EncodeToString(mac.Sum(nil))
+		return nil
+	}
+}
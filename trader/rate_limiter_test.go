@@ -0,0 +1,94 @@
+package trader
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBinanceRequestWeight(t *testing.T) {
+	cases := []struct {
+		url    string
+		weight int
+	}{
+		{"/fapi/v2/account", 5},
+		{"/fapi/v3/positionRisk?symbol=BTCUSDT", 5},
+		{"/fapi/v1/openOrders?symbol=BTCUSDT", 1},
+		{"/fapi/v1/openOrders", 40},
+		{"/fapi/v1/ticker/price", 2},
+		{"/fapi/v1/klines?symbol=BTCUSDT&limit=50", 1},
+		{"/fapi/v1/klines?symbol=BTCUSDT", 5},
+		{"/fapi/v1/depth?symbol=BTCUSDT&limit=1000", 20},
+		{"/fapi/v1/order", 1},
+	}
+	for _, c := range cases {
+		u, _ := url.Parse("https://fapi.binance.com" + c.url)
+		if got := binanceRequestWeight(&http.Request{URL: u}); got != c.weight {
+			t.Errorf("%s 权重应为 %d，实际 %d", c.url, c.weight, got)
+		}
+	}
+}
+
+func TestRateLimitedTransportBacksOffAndRetries(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Header().Set("X-MBX-USED-WEIGHT-1M", "1900")
+		w.Write([]byte("{}"))
+	}))
+	defer server.Close()
+
+	limiter := NewRateLimiter("test", binanceWeightLimit)
+	client := &http.Client{Transport: newRateLimitedTransport(limiter, binanceRequestWeight, nil, nil)}
+
+	start := time.Now()
+	resp, err := client.Get(server.URL + "/fapi/v1/ticker/price?symbol=BTCUSDT")
+	if err != nil {
+		t.Fatalf("请求失败: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || atomic.LoadInt32(&calls) != 2 {
+		t.Fatalf("429后应重试成功，状态 %d，请求 %d 次", resp.StatusCode, calls)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("应按Retry-After等待1秒后重试，实际 %v", elapsed)
+	}
+
+	// 已用1900，可用额度为 2400*0.8-1900 = 20（加上少量恢复）
+	limiter.mu.Lock()
+	tokens := limiter.tokens
+	limiter.mu.Unlock()
+	if tokens > 25 {
+		t.Errorf("应按X-MBX-USED-WEIGHT-1M校正剩余额度，实际剩余 %.1f", tokens)
+	}
+}
+
+func TestRateLimitedTransportDoesNotReplaySignedRequestWithoutResign(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Header().Set("Retry-After", "1")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	limiter := NewRateLimiter("test", binanceWeightLimit)
+	client := &http.Client{Transport: newRateLimitedTransport(limiter, binanceRequestWeight, nil, nil)}
+
+	resp, err := client.Get(server.URL + "/fapi/v1/order?symbol=BTCUSDT&timestamp=1&signature=abc")
+	if err != nil {
+		t.Fatalf("请求失败: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusTooManyRequests || atomic.LoadInt32(&calls) != 1 {
+		t.Errorf("签名请求无重签名函数时不应重放，状态 %d，请求 %d 次", resp.StatusCode, calls)
+	}
+}
@@ -0,0 +1,203 @@
+package trader
+
+import (
+	"fmt"
+	"log"
+	"nofx/decision"
+	"nofx/logger"
+	"strings"
+	"time"
+)
+
+// RestingEntry 未成交的限价开仓单（成交后才设置止损止盈）
+type RestingEntry struct {
+	Decision     decision.Decision // 下单时的AI决策（止损止盈、离场条件、开仓理由）
+	Side         string            // "long" 或 "short"
+	OrderID      int64
+	Quantity     float64
+	Price        float64 // 限价
+	PlacedAt     time.Time
+	CyclesWaited int // 已等待的周期数
+}
+
+// openWithLimitOrder 按AI给出的入场价挂限价开仓单
+// 立即成交则直接设置止损止盈，否则登记为未成交订单，由checkRestingEntries跟踪
+func (at *AutoTrader) openWithLimitOrder(d *decision.Decision, side string, actionRecord *logger.DecisionAction) error {
+	if d.EntryPrice <= 0 {
+		return fmt.Errorf("限价开仓需要有效的入场价格: %.4f", d.EntryPrice)
+	}
+
+	quantity := d.PositionSizeUSD / d.EntryPrice
+	actionRecord.Quantity = quantity
+	actionRecord.Price = d.EntryPrice
+
+	tif := TimeInForce(at.config.EntryTimeInForce)
+	var order *OrderResult
+	var err error
+	if side == "long" {
+		order, err = at.trader.OpenLongLimit(d.Symbol, quantity, d.EntryPrice, d.Leverage, tif)
+	} else {
+		order, err = at.trader.OpenShortLimit(d.Symbol, quantity, d.EntryPrice, d.Leverage, tif)
+	}
+	if err != nil {
+		return err
+	}
+
+	actionRecord.OrderID = order.OrderID
+
+	switch {
+	case order.Status == OrderStatusFilled:
+		recordOrderFill(actionRecord, order)
+		log.Printf("  ✓ 限价开仓立即成交，订单ID: %d, 数量: %.4f", order.OrderID, quantity)
+		at.activatePosition(d, side, filledQuantity(order, quantity), fillPrice(order, d.EntryPrice))
+
+	case order.IsOpen():
+		// 挂单中不计入持仓统计，成交后由checkRestingEntries另行记录
+		actionRecord.Pending = true
+		at.restingEntries[d.Symbol+"_"+side] = &RestingEntry{
+			Decision: *d,
+			Side:     side,
+			OrderID:  order.OrderID,
+			Quantity: quantity,
+			Price:    d.EntryPrice,
+			PlacedAt: time.Now(),
+		}
+		log.Printf("  📌 限价开仓单已挂出，订单ID: %d, 价格: %.4f, 数量: %.4f（最多等待%d个周期）",
+			order.OrderID, d.EntryPrice, quantity, at.config.EntryOrderMaxCycles)
+
+	case order.ExecutedQty > 0:
+		// IOC部分成交后剩余部分已撤销
+		recordOrderFill(actionRecord, order)
+		log.Printf("  ✓ 限价开仓部分成交，订单ID: %d, 成交数量: %.4f/%.4f", order.OrderID, order.ExecutedQty, quantity)
+		at.activatePosition(d, side, order.ExecutedQty, fillPrice(order, d.EntryPrice))
+
+	default:
+		return fmt.Errorf("限价开仓单未成交: %s (订单ID: %d)", order.Status, order.OrderID)
+	}
+
+	return nil
+}
+
+// checkRestingEntries 检查未成交的限价开仓单，成交和撤单结果写入决策记录
+// 成交后设置止损止盈；等待超过EntryOrderMaxCycles个周期仍未成交则撤单（已部分成交的部分照常设置止损止盈）
+func (at *AutoTrader) checkRestingEntries(record *logger.DecisionRecord) {
+	logf := func(format string, args ...interface{}) {
+		msg := fmt.Sprintf(format, args...)
+		log.Println(msg)
+		record.ExecutionLog = append(record.ExecutionLog, msg)
+	}
+
+	for posKey, entry := range at.restingEntries {
+		symbol := entry.Decision.Symbol
+		entry.CyclesWaited++
+
+		order, err := at.trader.GetOrder(symbol, entry.OrderID)
+		if err != nil && entry.CyclesWaited < at.config.EntryOrderMaxCycles {
+			log.Printf("  ⚠ 查询限价开仓单失败 (%s 订单ID: %d): %v", posKey, entry.OrderID, err)
+			continue
+		}
+		if err != nil {
+			// 已超时：查询失败也尽力撤单，撤单后仍查询不到时停止跟踪，避免挂单一直留在交易所
+			if err := at.trader.CancelOrder(symbol, entry.OrderID); err != nil {
+				log.Printf("  ⚠ 撤销限价开仓单失败 (%s 订单ID: %d): %v", posKey, entry.OrderID, err)
+			}
+			final, err := at.trader.GetOrder(symbol, entry.OrderID)
+			if err != nil {
+				delete(at.restingEntries, posKey)
+				logf("⚠ %s 限价开仓单等待%d个周期后查询失败，已尝试撤单并停止跟踪 (订单ID: %d): %v",
+					posKey, entry.CyclesWaited, entry.OrderID, err)
+				continue
+			}
+			order = final
+		}
+
+		if order.IsOpen() && entry.CyclesWaited >= at.config.EntryOrderMaxCycles {
+			if err := at.trader.CancelOrder(symbol, entry.OrderID); err != nil {
+				log.Printf("  ⚠ 撤销限价开仓单失败 (%s 订单ID: %d): %v", posKey, entry.OrderID, err)
+				continue
+			}
+			// 撤单后重新查询，获取撤单前的最终成交数量
+			if final, err := at.trader.GetOrder(symbol, entry.OrderID); err == nil {
+				order = final
+			}
+			if order.IsOpen() {
+				order.Status = OrderStatusCanceled
+			}
+			logf("⏱ %s 限价开仓单等待%d个周期未成交，已撤单 (订单ID: %d, 已成交 %.4f/%.4f)",
+				posKey, entry.CyclesWaited, entry.OrderID, order.ExecutedQty, entry.Quantity)
+		}
+
+		if order.IsOpen() {
+			log.Printf("  ⏳ %s 限价开仓单等待成交中 (订单ID: %d, 价格: %.4f, 第%d/%d个周期)",
+				posKey, entry.OrderID, entry.Price, entry.CyclesWaited, at.config.EntryOrderMaxCycles)
+			continue
+		}
+
+		delete(at.restingEntries, posKey)
+
+		if order.ExecutedQty > 0 || order.Status == OrderStatusFilled {
+			// 记录实际成交（开仓时的挂单记录不计入持仓统计）
+			fill := logger.DecisionAction{
+				Action:    "open_" + entry.Side,
+				Symbol:    symbol,
+				Quantity:  entry.Quantity,
+				Leverage:  entry.Decision.Leverage,
+				Price:     entry.Price,
+				Timestamp: time.Now(),
+				Success:   true,
+			}
+			recordOrderFill(&fill, order)
+			record.Decisions = append(record.Decisions, fill)
+		}
+
+		switch {
+		case order.Status == OrderStatusFilled:
+			logf("✓ %s 限价开仓单已成交 (订单ID: %d, 成交价: %.4f, 数量: %.4f)，设置止损止盈",
+				posKey, entry.OrderID, fillPrice(order, entry.Price), filledQuantity(order, entry.Quantity))
+			at.activatePosition(&entry.Decision, entry.Side, filledQuantity(order, entry.Quantity), fillPrice(order, entry.Price))
+		case order.ExecutedQty > 0:
+			logf("✓ %s 限价开仓单部分成交 (订单ID: %d, 数量: %.4f)，按成交数量设置止损止盈",
+				posKey, entry.OrderID, order.ExecutedQty)
+			at.activatePosition(&entry.Decision, entry.Side, order.ExecutedQty, fillPrice(order, entry.Price))
+		default:
+			logf("⚠ %s 限价开仓单未成交即结束: %s (订单ID: %d)", posKey, order.Status, entry.OrderID)
+		}
+	}
+}
+
+// activatePosition 开仓成交后记录持仓信息并设置止损止盈
+func (at *AutoTrader) activatePosition(d *decision.Decision, side string, quantity, entryPrice float64) {
+	// 记录开仓时间和离场条件
+	posKey := d.Symbol + "_" + side
+	at.positionFirstSeenTime[posKey] = time.Now().UnixMilli()
+
+	// 设置该币种的离场条件和开仓理由（开仓时清空旧条件，设置新条件）
+	at.positionInvalidationConditions[d.Symbol] = d.InvalidationCondition
+	at.positionReasonings[d.Symbol] = d.Reasoning
+
+	// 初始化盈亏跟踪（保存止盈价格和止损价格）
+	at.positionPnLTracking[posKey] = &PnLTracking{
+		TakeProfitPrice: d.TakeProfit,
+		StopLossPrice:   d.StopLoss,
+		EntryPrice:      entryPrice,
+	}
+
+	// 设置止损和止盈
+	placeProtectiveOrders(at.trader, d.Symbol, strings.ToUpper(side), quantity, d.StopLoss, d.TakeProfit)
+}
+
+// filledQuantity 订单成交数量（交易所未返回时使用下单数量）
+func filledQuantity(order *OrderResult, fallback float64) float64 {
+	if order.ExecutedQty > 0 {
+		return order.ExecutedQty
+	}
+	return fallback
+}
+
+// fillPrice 订单成交均价（交易所未返回时使用下单价格）
+func fillPrice(order *OrderResult, fallback float64) float64 {
+	if order.AvgPrice > 0 {
+		return order.AvgPrice
+	}
+	return fallback
+}
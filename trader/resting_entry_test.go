@@ -0,0 +1,177 @@
+package trader
+
+import (
+	"errors"
+	"nofx/decision"
+	"nofx/logger"
+	"testing"
+	"time"
+)
+
+// newRestingTestTrader 使用GTC限价开仓、最多等待2个周期的交易机器人
+func newRestingTestTrader(t *testing.T, tr Trader) *AutoTrader {
+	at := newKillTestTrader(t, tr)
+	at.config = AutoTraderConfig{EntryOrderType: "limit", EntryTimeInForce: string(TimeInForceGTC), EntryOrderMaxCycles: 2}
+	at.positionFirstSeenTime = make(map[string]int64)
+	at.positionInvalidationConditions = make(map[string]string)
+	at.positionReasonings = make(map[string]string)
+	at.positionPnLTracking = make(map[string]*PnLTracking)
+	return at
+}
+
+// restingLongDecision 在59000挂0.1 BTC的限价多单
+func restingLongDecision() *decision.Decision {
+	return &decision.Decision{
+		Symbol:          "BTCUSDT",
+		Action:          "open_long",
+		Leverage:        5,
+		PositionSizeUSD: 5900,
+		EntryPrice:      59000,
+		StopLoss:        57000,
+		TakeProfit:      62000,
+	}
+}
+
+// restingOrderTrader 可以模拟限价开仓单部分成交和订单查询失败的交易器
+type restingOrderTrader struct {
+	*FuturesTrader
+	partialQty float64 // 大于0时订单按该数量部分成交
+	queryErr   error   // 非nil时查询订单失败
+	cancelled  []int64
+}
+
+func (t *restingOrderTrader) GetOrder(symbol string, orderID int64) (*OrderResult, error) {
+	if t.queryErr != nil {
+		return nil, t.queryErr
+	}
+	order, err := t.FuturesTrader.GetOrder(symbol, orderID)
+	if err != nil || t.partialQty <= 0 {
+		return order, err
+	}
+	if order.IsOpen() {
+		order.Status = OrderStatusPartiallyFilled
+	}
+	order.ExecutedQty, order.AvgPrice = t.partialQty, 59000
+	return order, nil
+}
+
+func (t *restingOrderTrader) CancelOrder(symbol string, orderID int64) error {
+	t.cancelled = append(t.cancelled, orderID)
+	return t.FuturesTrader.CancelOrder(symbol, orderID)
+}
+
+func TestLimitEntrySetsProtectionAfterFill(t *testing.T) {
+	ledger, trader := newFakeBinance(t)
+	trader.brackets.interval = time.Hour
+	at := newRestingTestTrader(t, trader)
+
+	action := &logger.DecisionAction{}
+	if err := at.openWithLimitOrder(restingLongDecision(), "long", action); err != nil {
+		t.Fatalf("限价开仓失败: %v", err)
+	}
+	// 挂单期间只有限价单，没有止损止盈
+	if !action.Pending || len(at.restingEntries) != 1 {
+		t.Fatalf("限价单应登记为未成交: %+v", action)
+	}
+	if orders := ledger.OpenOrders("BTCUSDT"); len(orders) != 1 || orders[0].Type != "LIMIT" {
+		t.Fatalf("成交前不应设置止损止盈: %+v", orders)
+	}
+	record := &logger.DecisionRecord{}
+	at.checkRestingEntries(record)
+	if len(at.restingEntries) != 1 || len(ledger.OpenOrders("BTCUSDT")) != 1 || len(record.Decisions) != 0 {
+		t.Fatalf("未成交时应继续等待: %+v", record)
+	}
+
+	ledger.SetPrice("BTCUSDT", 59000)
+	record = &logger.DecisionRecord{}
+	at.checkRestingEntries(record)
+	if len(at.restingEntries) != 0 {
+		t.Fatalf("成交后应停止跟踪: %+v", at.restingEntries)
+	}
+	if len(record.Decisions) != 1 || record.Decisions[0].Action != "open_long" || !floatEq(record.Decisions[0].Quantity, 0.1) || !floatEq(record.Decisions[0].Price, 59000) {
+		t.Errorf("决策记录应包含实际成交: %+v", record.Decisions)
+	}
+	orders := ledger.OpenOrders("BTCUSDT")
+	if len(orders) != 2 || orders[0].StopPrice != 57000 || orders[1].StopPrice != 62000 {
+		t.Errorf("成交后应设置止损止盈: %+v", orders)
+	}
+}
+
+func TestLimitEntryCancelledAfterMaxCycles(t *testing.T) {
+	ledger, trader := newFakeBinance(t)
+	at := newRestingTestTrader(t, trader)
+
+	if err := at.openWithLimitOrder(restingLongDecision(), "long", &logger.DecisionAction{}); err != nil {
+		t.Fatalf("限价开仓失败: %v", err)
+	}
+	at.checkRestingEntries(&logger.DecisionRecord{})
+	if len(at.restingEntries) != 1 {
+		t.Fatal("第1个周期不应撤单")
+	}
+
+	record := &logger.DecisionRecord{}
+	at.checkRestingEntries(record)
+	if len(at.restingEntries) != 0 || len(record.ExecutionLog) != 2 {
+		t.Fatalf("等待2个周期后应撤单: %+v", record.ExecutionLog)
+	}
+	if orders := ledger.OpenOrders("BTCUSDT"); len(orders) != 0 {
+		t.Errorf("撤单后不应有挂单: %+v", orders)
+	}
+	if positions := ledger.Positions(); len(positions) != 0 || len(record.Decisions) != 0 {
+		t.Errorf("未成交不应产生持仓或成交记录: %+v %+v", positions, record.Decisions)
+	}
+}
+
+func TestLimitEntryPartialFillProtectedOnCancel(t *testing.T) {
+	ledger, trader := newFakeBinance(t)
+	trader.brackets.interval = time.Hour
+	partial := &restingOrderTrader{FuturesTrader: trader, partialQty: 0.04}
+	at := newRestingTestTrader(t, partial)
+
+	if err := at.openWithLimitOrder(restingLongDecision(), "long", &logger.DecisionAction{}); err != nil {
+		t.Fatalf("限价开仓失败: %v", err)
+	}
+	at.checkRestingEntries(&logger.DecisionRecord{})
+	if len(at.restingEntries) != 1 || len(ledger.OpenOrders("BTCUSDT")) != 1 {
+		t.Fatal("部分成交期间应继续等待")
+	}
+
+	// 超时撤单后按已成交的0.04设置止损止盈
+	record := &logger.DecisionRecord{}
+	at.checkRestingEntries(record)
+	if len(at.restingEntries) != 0 || len(partial.cancelled) != 1 {
+		t.Fatalf("超时后应撤单并停止跟踪: %+v", record.ExecutionLog)
+	}
+	if len(record.Decisions) != 1 || !floatEq(record.Decisions[0].Quantity, 0.04) {
+		t.Errorf("决策记录应包含部分成交: %+v", record.Decisions)
+	}
+	orders := ledger.OpenOrders("BTCUSDT")
+	if len(orders) != 2 || !floatEq(orders[0].Quantity, 0.04) || !floatEq(orders[1].Quantity, 0.04) {
+		t.Errorf("应按成交数量设置止损止盈: %+v", orders)
+	}
+}
+
+func TestRestingEntryDroppedWhenQueryFailsAfterMaxCycles(t *testing.T) {
+	ledger, trader := newFakeBinance(t)
+	failing := &restingOrderTrader{FuturesTrader: trader}
+	at := newRestingTestTrader(t, failing)
+
+	if err := at.openWithLimitOrder(restingLongDecision(), "long", &logger.DecisionAction{}); err != nil {
+		t.Fatalf("限价开仓失败: %v", err)
+	}
+	failing.queryErr = errors.New("timeout")
+	at.checkRestingEntries(&logger.DecisionRecord{})
+	if len(at.restingEntries) != 1 || len(failing.cancelled) != 0 {
+		t.Fatal("未超时时查询失败应下个周期重试")
+	}
+
+	// 超时后查询仍失败：尽力撤单并停止跟踪
+	record := &logger.DecisionRecord{}
+	at.checkRestingEntries(record)
+	if len(at.restingEntries) != 0 || len(failing.cancelled) != 1 || len(record.ExecutionLog) != 1 {
+		t.Fatalf("超时后应撤单并停止跟踪: %+v", record.ExecutionLog)
+	}
+	if orders := ledger.OpenOrders("BTCUSDT"); len(orders) != 0 {
+		t.Errorf("限价单应已撤销: %+v", orders)
+	}
+}
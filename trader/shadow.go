@@ -0,0 +1,215 @@
+package trader
+
+import (
+	"fmt"
+	"log"
+	"nofx/decision"
+	"nofx/logger"
+	"sync"
+)
+
+// ShadowConfig 影子交易器配置（只需AI配置，虚拟资金、滑点和手续费沿用实盘交易器）
+type ShadowConfig struct {
+	Name    string // 影子名称（同一交易器内唯一）
+	AIModel string // "qwen", "deepseek", "gemini" 或 "custom"
+
+	DeepSeekKey string
+	QwenKey     string
+	GeminiKey   string
+
+	CustomAPIURL    string
+	CustomAPIKey    string
+	CustomModelName string
+}
+
+// ShadowTrader 影子交易器：每个周期与实盘交易器使用同一份上下文和市场数据请求另一个AI，
+// 决策在虚拟账本（模拟盘）上执行，决策日志单独保存，用于在不动用资金的情况下对比模型或提示词
+type ShadowTrader struct {
+	name    string
+	aiModel string
+	at      *AutoTrader // 模拟盘上的交易器，复用开平仓、止损止盈和决策日志逻辑
+	running sync.Mutex  // AI调用较慢，上一周期未结束时跳过本周期
+}
+
+// AttachShadow 为交易器添加一个影子交易器（日志目录为 decision_logs/<id>_shadow_<name>）
+func (at *AutoTrader) AttachShadow(cfg ShadowConfig) error {
+	shadowConfig := at.config
+	shadowConfig.ID = at.id + "_shadow_" + cfg.Name
+	shadowConfig.Name = fmt.Sprintf("%s [影子:%s]", at.name, cfg.Name)
+	shadowConfig.Exchange = "paper"
+	shadowConfig.CoinPoolAPIURL = "" // 候选币种来自实盘上下文
+	shadowConfig.AIModel = cfg.AIModel
+	shadowConfig.UseQwen = cfg.AIModel == "qwen"
+	shadowConfig.DeepSeekKey = cfg.DeepSeekKey
+	shadowConfig.QwenKey = cfg.QwenKey
+	shadowConfig.GeminiKey = cfg.GeminiKey
+	shadowConfig.CustomAPIURL = cfg.CustomAPIURL
+	shadowConfig.CustomAPIKey = cfg.CustomAPIKey
+	shadowConfig.CustomModelName = cfg.CustomModelName
+
+	shadowAT, err := NewAutoTrader(shadowConfig)
+	if err != nil {
+		return fmt.Errorf("创建影子交易器 '%s' 失败: %w", cfg.Name, err)
+	}
+	// 影子交易器不单独运行主循环，在这里应用保证金模式和持仓模式
+	applyTradingModes(shadowAT.trader, shadowAT.name, shadowConfig.MarginMode, shadowConfig.PositionMode)
+
+	at.shadows = append(at.shadows, &ShadowTrader{
+		name:    cfg.Name,
+		aiModel: shadowAT.aiModel,
+		at:      shadowAT,
+	})
+	log.Printf("👥 [%s] 已添加影子交易器 '%s' (%s)，在虚拟账本上执行", at.name, cfg.Name, shadowAT.aiModel)
+	return nil
+}
+
+// runShadows 在后台运行所有影子交易器的本周期（实盘已获取的市场数据直接复用）
+func (at *AutoTrader) runShadows(ctx *decision.Context) {
+	for _, s := range at.shadows {
+		go s.runCycle(ctx)
+	}
+}
+
+// runCycle 用实盘上下文运行一个影子周期
+func (s *ShadowTrader) runCycle(live *decision.Context) {
+	if !s.running.TryLock() {
+		log.Printf("⏭ [%s] 上一周期尚未结束，跳过本周期", s.at.name)
+		return
+	}
+	defer s.running.Unlock()
+
+	at := s.at
+	at.callCount++
+	record := &logger.DecisionRecord{
+		ExecutionLog: []string{},
+		Success:      true,
+	}
+
+	at.checkRestingEntries(record)
+	at.recordClosedPositions(record)
+
+	ctx, err := s.buildContext(live)
+	if err != nil {
+		record.Success = false
+		record.ErrorMessage = fmt.Sprintf("构建交易上下文失败: %v", err)
+		at.decisionLogger.LogDecision(record)
+		log.Printf("❌ [%s] 构建交易上下文失败: %v", at.name, err)
+		return
+	}
+
+	if err := at.decideAndExecute(ctx, record); err != nil {
+		log.Printf("❌ [%s] 执行失败: %v", at.name, err)
+	}
+}
+
+// buildContext 复制实盘上下文（时间、候选币种、市场数据、杠杆和交易所功能保持一致），
+// 账户、持仓和历史表现换成影子自己的虚拟账本，这样决策才能在虚拟账本上执行
+func (s *ShadowTrader) buildContext(live *decision.Context) (*decision.Context, error) {
+	own, err := s.at.buildAccountContext()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := *live
+	ctx.CallCount = own.CallCount
+	ctx.Account = own.Account
+	ctx.Positions = own.Positions
+	ctx.Performance = own.Performance
+	return &ctx, nil
+}
+
+// shadowStatus 影子交易器概况（用于状态接口）
+func (at *AutoTrader) shadowStatus() []map[string]interface{} {
+	result := make([]map[string]interface{}, 0, len(at.shadows))
+	for _, s := range at.shadows {
+		result = append(result, map[string]interface{}{
+			"trader_id":  s.at.id,
+			"name":       s.name,
+			"ai_model":   s.aiModel,
+			"call_count": s.at.callCount,
+		})
+	}
+	return result
+}
+
+// PnLPoint 盈亏曲线上的一个点（来自决策日志中的账户快照）
+type PnLPoint struct {
+	Timestamp   string  `json:"timestamp"`
+	CycleNumber int     `json:"cycle_number"`
+	TotalEquity float64 `json:"total_equity"`
+	TotalPnL    float64 `json:"total_pnl"`
+	TotalPnLPct float64 `json:"total_pnl_pct"`
+}
+
+// PnLSeries 一个交易器（实盘或影子）的盈亏曲线
+type PnLSeries struct {
+	TraderID       string     `json:"trader_id"`
+	Name           string     `json:"name"`
+	AIModel        string     `json:"ai_model"`
+	InitialBalance float64    `json:"initial_balance"`
+	TotalEquity    float64    `json:"total_equity"`       // 最近一个周期的净值
+	TotalPnL       float64    `json:"total_pnl"`          // 最近一个周期的总盈亏
+	TotalPnLPct    float64    `json:"total_pnl_pct"`      // 最近一个周期的总盈亏百分比
+	PnLDiff        float64    `json:"pnl_diff,omitempty"` // 影子相对实盘的盈亏差（USDT，正数表示影子更好）
+	History        []PnLPoint `json:"history"`
+}
+
+// ShadowComparison 实盘与影子交易器的盈亏对比
+type ShadowComparison struct {
+	Live    PnLSeries   `json:"live"`
+	Shadows []PnLSeries `json:"shadows"`
+}
+
+// GetShadowComparison 从决策日志生成实盘与各影子交易器的盈亏曲线（每条最多limit个周期）
+func (at *AutoTrader) GetShadowComparison(limit int) (*ShadowComparison, error) {
+	live, err := pnlSeries(at, at.name, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	comparison := &ShadowComparison{Live: live, Shadows: make([]PnLSeries, 0, len(at.shadows))}
+	for _, s := range at.shadows {
+		series, err := pnlSeries(s.at, s.name, limit)
+		if err != nil {
+			return nil, fmt.Errorf("影子交易器 '%s': %w", s.name, err)
+		}
+		series.PnLDiff = series.TotalPnL - live.TotalPnL
+		comparison.Shadows = append(comparison.Shadows, series)
+	}
+	return comparison, nil
+}
+
+// pnlSeries 读取交易器的决策日志生成盈亏曲线
+func pnlSeries(at *AutoTrader, name string, limit int) (PnLSeries, error) {
+	records, err := at.decisionLogger.GetLatestRecords(limit)
+	if err != nil {
+		return PnLSeries{}, fmt.Errorf("读取决策日志失败: %w", err)
+	}
+
+	series := PnLSeries{
+		TraderID:       at.id,
+		Name:           name,
+		AIModel:        at.aiModel,
+		InitialBalance: at.initialBalance,
+		TotalEquity:    at.initialBalance,
+		History:        make([]PnLPoint, 0, len(records)),
+	}
+	for _, record := range records {
+		// 构建上下文失败的周期没有账户快照
+		if record.AccountState.TotalBalance <= 0 {
+			continue
+		}
+		point := PnLPoint{
+			Timestamp:   record.Timestamp.Format("2006-01-02 15:04:05"),
+			CycleNumber: record.CycleNumber,
+			TotalEquity: record.AccountState.TotalBalance,
+			TotalPnL:    record.AccountState.TotalBalance - at.initialBalance,
+		}
+		if at.initialBalance > 0 {
+			point.TotalPnLPct = point.TotalPnL / at.initialBalance * 100
+		}
+		series.History = append(series.History, point)
+		series.TotalEquity, series.TotalPnL, series.TotalPnLPct = point.TotalEquity, point.TotalPnL, point.TotalPnLPct
+	}
+	return series, nil
+}
@@ -0,0 +1,141 @@
+package trader
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"nofx/decision"
+	"nofx/market"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeAI OpenAI兼容的AI接口，记录收到的user prompt并返回固定的决策
+type fakeAI struct {
+	*httptest.Server
+	mu      sync.Mutex
+	prompts []string
+}
+
+func newFakeAI(t *testing.T, response string) *fakeAI {
+	f := &fakeAI{}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Messages []struct {
+				Role    string `json:"role"`
+				Content string `json:"content"`
+			} `json:"messages"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		f.mu.Lock()
+		for _, m := range req.Messages {
+			if m.Role == "user" {
+				f.prompts = append(f.prompts, m.Content)
+			}
+		}
+		f.mu.Unlock()
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []map[string]interface{}{{"message": map[string]string{"content": response}}},
+		})
+	}))
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeAI) lastPrompt() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.prompts) == 0 {
+		return ""
+	}
+	return f.prompts[len(f.prompts)-1]
+}
+
+func TestShadowUsesLiveContextWithOwnLedger(t *testing.T) {
+	t.Chdir(t.TempDir()) // 决策日志写在临时目录
+
+	liveAI := newFakeAI(t, "观望\n[]")
+	shadowAI := newFakeAI(t, `先观望
+[{"symbol": "BTCUSDT", "action": "wait", "reasoning": "等待回调"}]`)
+
+	live, err := NewAutoTrader(AutoTraderConfig{
+		ID:              "live",
+		Name:            "Live",
+		AIModel:         "custom",
+		Exchange:        "paper",
+		CustomAPIURL:    liveAI.URL,
+		CustomAPIKey:    "key",
+		CustomModelName: "live-model",
+		InitialBalance:  1000,
+		BTCETHLeverage:  5,
+		AltcoinLeverage: 5,
+	})
+	if err != nil {
+		t.Fatalf("创建交易器失败: %v", err)
+	}
+	if err := live.AttachShadow(ShadowConfig{
+		Name:            "candidate",
+		AIModel:         "custom",
+		CustomAPIURL:    shadowAI.URL,
+		CustomAPIKey:    "key",
+		CustomModelName: "candidate-model",
+	}); err != nil {
+		t.Fatalf("添加影子交易器失败: %v", err)
+	}
+
+	// 实盘上下文：已获取的市场数据和实盘持仓
+	liveCtx := &decision.Context{
+		CurrentTime:     "2025-01-01 00:00:00",
+		CandidateCoins:  []decision.CandidateCoin{{Symbol: "BTCUSDT", Sources: []string{"ai500"}}},
+		MarketDataMap:   map[string]*market.Data{"BTCUSDT": {Symbol: "BTCUSDT", CurrentPrice: 61234.5}},
+		OITopDataMap:    map[string]*decision.OITopData{},
+		BTCETHLeverage:  5,
+		AltcoinLeverage: 5,
+		Account:         decision.AccountInfo{TotalEquity: 4321, AvailableBalance: 4000, PositionCount: 1},
+		Positions:       []decision.PositionInfo{{Symbol: "ETHUSDT", Side: "long", Quantity: 1, EntryPrice: 3000, MarkPrice: 3000, Leverage: 5}},
+	}
+
+	shadow := live.shadows[0]
+	shadow.runCycle(liveCtx)
+
+	prompt := shadowAI.lastPrompt()
+	if !strings.Contains(prompt, "Current Price: 61234.50") {
+		t.Errorf("影子应使用实盘已获取的市场数据:\n%s", prompt)
+	}
+	if strings.Contains(prompt, "ETHUSDT") || !strings.Contains(prompt, "**当前持仓**: 无") {
+		t.Errorf("影子应看到自己虚拟账本的持仓而不是实盘持仓:\n%s", prompt)
+	}
+	if liveAI.lastPrompt() != "" {
+		t.Error("影子周期不应调用实盘的AI")
+	}
+	if len(liveCtx.Positions) != 1 || liveCtx.Account.TotalEquity != 4321 {
+		t.Errorf("实盘上下文不应被修改: %+v", liveCtx)
+	}
+
+	records, err := shadow.at.GetDecisionLogger().GetLatestRecords(10)
+	if err != nil || len(records) != 1 {
+		t.Fatalf("影子决策日志错误: %v, %v", records, err)
+	}
+	if !records[0].Success || !floatEq(records[0].AccountState.TotalBalance, 1000) || len(records[0].Decisions) != 1 {
+		t.Errorf("影子决策记录错误: %+v", records[0])
+	}
+	if live.GetDecisionLogger() == shadow.at.GetDecisionLogger() {
+		t.Error("影子决策日志应单独保存")
+	}
+
+	comparison, err := live.GetShadowComparison(100)
+	if err != nil {
+		t.Fatalf("获取对比失败: %v", err)
+	}
+	if comparison.Live.TraderID != "live" || len(comparison.Live.History) != 0 {
+		t.Errorf("实盘曲线错误: %+v", comparison.Live)
+	}
+	if len(comparison.Shadows) != 1 {
+		t.Fatalf("应有1个影子: %+v", comparison.Shadows)
+	}
+	if s := comparison.Shadows[0]; s.TraderID != "live_shadow_candidate" || s.Name != "candidate" || len(s.History) != 1 || !floatEq(s.TotalEquity, 1000) {
+		t.Errorf("影子曲线错误: %+v", s)
+	}
+}
@@ -0,0 +1,285 @@
+package trader
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// traderState 交易器跨重启保留的状态：持仓的开仓理由、离场条件、止损止盈和盈亏跟踪，
+// 以及周期编号（AI调用次数和决策日志编号）。重启后由reconcile按交易所的持仓和挂单校正
+type traderState struct {
+	SavedAt     time.Time `json:"saved_at"`
+	CallCount   int       `json:"call_count"`   // AI调用次数
+	CycleNumber int       `json:"cycle_number"` // 决策日志周期编号
+
+	PositionFirstSeenTime          map[string]int64        `json:"position_first_seen_time"`         // symbol_side -> 毫秒时间戳
+	PositionInvalidationConditions map[string]string       `json:"position_invalidation_conditions"` // symbol -> 离场条件
+	PositionReasonings             map[string]string       `json:"position_reasonings"`              // symbol -> 开仓理由
+	PositionPnLTracking            map[string]*PnLTracking `json:"position_pnl_tracking"`            // symbol_side -> 盈亏跟踪
+	CircuitBreaker                 *breakerState           `json:"circuit_breaker,omitempty"`        // 熔断状态（重启不解除熔断）
+
+	// 以下只有AutoTrader使用
+	LastPositionSnapshot map[string]*PositionSnapshot `json:"last_position_snapshot,omitempty"` // 停机期间平掉的持仓在重启后照常记录
+	RestingEntries       map[string]*RestingEntry     `json:"resting_entries,omitempty"`        // 未成交的限价开仓单
+}
+
+// stateStore 交易器状态文件（decision_logs/<id>/state/trader_state.json）
+// 放在子目录中，决策日志读取记录时会跳过
+type stateStore struct {
+	path string
+}
+
+// newStateStore 创建决策日志目录下的状态文件
+func newStateStore(logDir string) *stateStore {
+	return &stateStore{path: filepath.Join(logDir, "state", "trader_state.json")}
+}
+
+// load 读取保存的状态，文件不存在时返回(nil, nil)
+func (s *stateStore) load() (*traderState, error) {
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取交易器状态失败: %w", err)
+	}
+
+	var state traderState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("解析交易器状态失败: %w", err)
+	}
+	return &state, nil
+}
+
+// save 保存状态：先写临时文件再替换，崩溃时不会留下写了一半的文件
+func (s *stateStore) save(state *traderState) error {
+	state.SavedAt = time.Now()
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("序列化交易器状态失败: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("创建状态目录失败: %w", err)
+	}
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("写入交易器状态失败: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("替换交易器状态文件失败: %w", err)
+	}
+	return nil
+}
+
+// reconcile 用交易所当前的持仓和挂单校正恢复的状态：停机期间已平掉的持仓丢弃跟踪数据，
+// 止损止盈价以交易所实际挂着的保护单为准（停机期间可能被手动修改），找不到保护单时保留保存的价格
+// orders为各持仓币种的未完成订单，获取失败的币种不在其中
+func (s *traderState) reconcile(positions []Position, orders map[string][]Order) {
+	open := make(map[string]Position, len(positions))
+	symbols := make(map[string]bool, len(positions))
+	for _, pos := range positions {
+		open[pos.Key()] = pos
+		symbols[pos.Symbol] = true
+	}
+	// 未成交的限价开仓单保留开仓理由和离场条件，成交后仍要使用
+	for _, entry := range s.RestingEntries {
+		symbols[entry.Decision.Symbol] = true
+	}
+
+	for key := range s.PositionFirstSeenTime {
+		if _, ok := open[key]; !ok {
+			delete(s.PositionFirstSeenTime, key)
+		}
+	}
+	for key := range s.PositionPnLTracking {
+		if _, ok := open[key]; !ok {
+			delete(s.PositionPnLTracking, key)
+		}
+	}
+	for symbol := range s.PositionInvalidationConditions {
+		if !symbols[symbol] {
+			delete(s.PositionInvalidationConditions, symbol)
+		}
+	}
+	for symbol := range s.PositionReasonings {
+		if !symbols[symbol] {
+			delete(s.PositionReasonings, symbol)
+		}
+	}
+
+	for key, pos := range open {
+		symbolOrders, ok := orders[pos.Symbol]
+		if !ok {
+			continue
+		}
+		tracking, exists := s.PositionPnLTracking[key]
+		if !exists {
+			tracking = &PnLTracking{EntryPrice: pos.EntryPrice, Stage: 1, RemainingQuantity: 1}
+		}
+
+		stopLoss, takeProfit := bracketLegs(symbolOrders, strings.ToUpper(pos.Side))
+		if stopLoss != nil {
+			tracking.StopLossPrice = stopLoss.StopPrice
+		}
+		if takeProfit != nil {
+			tracking.TakeProfitPrice = takeProfit.StopPrice
+		}
+		if exists || stopLoss != nil || takeProfit != nil {
+			s.PositionPnLTracking[key] = tracking
+		}
+	}
+}
+
+// ephemeralAccount 账户只保存在进程内存中的交易器（模拟盘），重启后账户重置
+type ephemeralAccount interface {
+	accountResetsOnRestart() bool
+}
+
+// accountResetsOnRestart 交易器的账户（持仓、挂单、余额）是否在重启后重置
+func accountResetsOnRestart(t Trader) bool {
+	e, ok := t.(ephemeralAccount)
+	return ok && e.accountResetsOnRestart()
+}
+
+// restoreTraderState 读取保存的状态并按交易所的持仓和挂单校正，没有保存的状态时返回nil
+func restoreTraderState(store *stateStore, t Trader, name string) *traderState {
+	state, err := store.load()
+	if err != nil {
+		log.Printf("⚠️ [%s] %v，从空状态开始", name, err)
+		return nil
+	}
+	if state == nil {
+		return nil
+	}
+	if accountResetsOnRestart(t) {
+		// 账户已重置：上次的持仓快照、限价开仓单和按旧账户净值计算的熔断状态都已失效，
+		// 保留它们会把快照中的持仓记录为止损止盈平仓，并用旧的净值峰值触发回撤熔断
+		state.LastPositionSnapshot = nil
+		state.RestingEntries = nil
+		state.CircuitBreaker = nil
+		log.Printf("♻️ [%s] 模拟盘账户已重置，不恢复上次的持仓快照、限价开仓单和熔断状态", name)
+	}
+	if state.PositionFirstSeenTime == nil {
+		state.PositionFirstSeenTime = make(map[string]int64)
+	}
+	if state.PositionInvalidationConditions == nil {
+		state.PositionInvalidationConditions = make(map[string]string)
+	}
+	if state.PositionReasonings == nil {
+		state.PositionReasonings = make(map[string]string)
+	}
+	if state.PositionPnLTracking == nil {
+		state.PositionPnLTracking = make(map[string]*PnLTracking)
+	}
+
+	positions, err := t.GetPositions()
+	if err != nil {
+		// 无法校正时原样恢复，过期的数据会在下个周期构建上下文时清理
+		log.Printf("⚠️ [%s] 获取持仓失败，恢复的状态未经校正: %v", name, err)
+		return state
+	}
+	orders := make(map[string][]Order)
+	for _, pos := range positions {
+		if _, ok := orders[pos.Symbol]; ok {
+			continue
+		}
+		symbolOrders, err := t.GetOpenOrders(pos.Symbol)
+		if err != nil {
+			log.Printf("⚠️ [%s] 获取 %s 挂单失败，保留保存的止损止盈价: %v", name, pos.Symbol, err)
+			continue
+		}
+		orders[pos.Symbol] = symbolOrders
+	}
+
+	state.reconcile(positions, orders)
+	log.Printf("♻️ [%s] 已恢复上次运行的状态 (保存于 %s): 周期 #%d，%d个持仓的跟踪数据",
+		name, state.SavedAt.Format("2006-01-02 15:04:05"), state.CallCount, len(state.PositionPnLTracking))
+	return state
+}
+
+// restoreBreaker 恢复保存的熔断状态（熔断中重启后继续暂停开仓和加仓）
+func restoreBreaker(b *breakerState, state *traderState, name string) {
+	if state.CircuitBreaker == nil {
+		return
+	}
+	*b = *state.CircuitBreaker
+	if b.active() {
+		log.Printf("⏸ [%s] 恢复熔断状态: %s，暂停开仓和加仓至 %s", name, b.Reason, b.StopUntil.Format("2006-01-02 15:04:05"))
+	}
+}
+
+// restoreState 启动时恢复上次运行保存的状态（在首个周期和实时推送之前调用）
+func (at *AutoTrader) restoreState() {
+	state := restoreTraderState(at.state, at.trader, at.name)
+	if state == nil {
+		return
+	}
+	at.callCount = state.CallCount
+	at.decisionLogger.ResumeCycleNumber(state.CycleNumber)
+	at.positionFirstSeenTime = state.PositionFirstSeenTime
+	at.positionInvalidationConditions = state.PositionInvalidationConditions
+	at.positionReasonings = state.PositionReasonings
+	at.positionPnLTracking = state.PositionPnLTracking
+	if state.LastPositionSnapshot != nil {
+		at.lastPositionSnapshot = state.LastPositionSnapshot
+	}
+	if state.RestingEntries != nil {
+		at.restingEntries = state.RestingEntries
+	}
+	restoreBreaker(&at.breaker, state, at.name)
+}
+
+// saveState 保存当前状态（每个周期结束时调用）
+func (at *AutoTrader) saveState() {
+	state := &traderState{
+		CallCount:                      at.callCount,
+		CycleNumber:                    at.decisionLogger.CycleNumber(),
+		PositionFirstSeenTime:          at.positionFirstSeenTime,
+		PositionInvalidationConditions: at.positionInvalidationConditions,
+		PositionReasonings:             at.positionReasonings,
+		PositionPnLTracking:            at.positionPnLTracking,
+		LastPositionSnapshot:           at.lastPositionSnapshot,
+		RestingEntries:                 at.restingEntries,
+		CircuitBreaker:                 &at.breaker,
+	}
+	if err := at.state.save(state); err != nil {
+		log.Printf("⚠️ [%s] %v", at.name, err)
+	}
+}
+
+// restoreState 启动时恢复上次运行保存的状态（在首个周期和实时推送之前调用）
+func (pm *PositionManager) restoreState() {
+	state := restoreTraderState(pm.state, pm.trader, pm.name)
+	if state == nil {
+		return
+	}
+	pm.callCount = state.CallCount
+	pm.decisionLogger.ResumeCycleNumber(state.CycleNumber)
+	pm.positionFirstSeenTime = state.PositionFirstSeenTime
+	pm.positionInvalidationConditions = state.PositionInvalidationConditions
+	pm.positionReasonings = state.PositionReasonings
+	pm.positionPnLTracking = state.PositionPnLTracking
+	restoreBreaker(&pm.breaker, state, pm.name)
+}
+
+// saveState 保存当前状态（每个周期结束时调用）
+func (pm *PositionManager) saveState() {
+	state := &traderState{
+		CallCount:                      pm.callCount,
+		CycleNumber:                    pm.decisionLogger.CycleNumber(),
+		PositionFirstSeenTime:          pm.positionFirstSeenTime,
+		PositionInvalidationConditions: pm.positionInvalidationConditions,
+		PositionReasonings:             pm.positionReasonings,
+		PositionPnLTracking:            pm.positionPnLTracking,
+		CircuitBreaker:                 &pm.breaker,
+	}
+	if err := pm.state.save(state); err != nil {
+		log.Printf("⚠️ [%s] %v", pm.name, err)
+	}
+}
@@ -0,0 +1,139 @@
+package trader
+
+import (
+	"nofx/logger"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRestoreTraderStateReconcilesWithExchange(t *testing.T) {
+	ledger, trader := newFakeBinance(t)
+	store := newStateStore(t.TempDir())
+
+	if _, err := trader.OpenLong("BTCUSDT", 0.1, 10); err != nil {
+		t.Fatalf("开多仓失败: %v", err)
+	}
+	// 停机期间止损被手动上移到58500
+	if err := trader.SetStopLoss("BTCUSDT", "LONG", 0.1, 58500); err != nil {
+		t.Fatalf("设置止损失败: %v", err)
+	}
+	if err := trader.SetTakeProfit("BTCUSDT", "LONG", 0.1, 63000); err != nil {
+		t.Fatalf("设置止盈失败: %v", err)
+	}
+
+	// 上次运行保存的状态：ETH持仓已在停机期间平掉
+	saved := &traderState{
+		CallCount:                      42,
+		CycleNumber:                    57,
+		PositionFirstSeenTime:          map[string]int64{"BTCUSDT_long": 1700000000000, "ETHUSDT_short": 1700000001000},
+		PositionInvalidationConditions: map[string]string{"BTCUSDT": "跌破57000", "ETHUSDT": "突破3500"},
+		PositionReasonings:             map[string]string{"BTCUSDT": "突破回踩", "ETHUSDT": "顶背离"},
+		PositionPnLTracking: map[string]*PnLTracking{
+			"BTCUSDT_long":  {MaxProfitPct: 12, StopLossPrice: 58000, TakeProfitPrice: 63000, EntryPrice: 60000, Stage: 1, RemainingQuantity: 1},
+			"ETHUSDT_short": {MaxProfitPct: 3, StopLossPrice: 3500},
+		},
+		LastPositionSnapshot: map[string]*PositionSnapshot{
+			"ETHUSDT_short": {Symbol: "ETHUSDT", Side: "short", Quantity: 1, EntryPrice: 3300},
+		},
+	}
+	if err := store.save(saved); err != nil {
+		t.Fatalf("保存状态失败: %v", err)
+	}
+
+	state := restoreTraderState(store, trader, "test")
+	if state == nil {
+		t.Fatal("应恢复保存的状态")
+	}
+	if state.CallCount != 42 || state.CycleNumber != 57 {
+		t.Errorf("周期编号错误: %+v", state)
+	}
+	if _, ok := state.PositionFirstSeenTime["ETHUSDT_short"]; ok || state.PositionFirstSeenTime["BTCUSDT_long"] != 1700000000000 {
+		t.Errorf("持仓首次出现时间错误: %+v", state.PositionFirstSeenTime)
+	}
+	if state.PositionReasonings["BTCUSDT"] != "突破回踩" || state.PositionInvalidationConditions["BTCUSDT"] != "跌破57000" ||
+		len(state.PositionReasonings) != 1 || len(state.PositionInvalidationConditions) != 1 {
+		t.Errorf("开仓理由和离场条件错误: %+v %+v", state.PositionReasonings, state.PositionInvalidationConditions)
+	}
+	tracking := state.PositionPnLTracking["BTCUSDT_long"]
+	if len(state.PositionPnLTracking) != 1 || tracking == nil || !floatEq(tracking.StopLossPrice, 58500) ||
+		!floatEq(tracking.TakeProfitPrice, 63000) || !floatEq(tracking.MaxProfitPct, 12) {
+		t.Errorf("止损止盈应以交易所挂单为准: %+v", state.PositionPnLTracking)
+	}
+	// 上次的持仓快照保留，首个周期据此记录停机期间的平仓
+	if _, ok := state.LastPositionSnapshot["ETHUSDT_short"]; !ok {
+		t.Errorf("持仓快照应原样保留: %+v", state.LastPositionSnapshot)
+	}
+	if orders := ledger.OpenOrders("BTCUSDT"); len(orders) != 2 {
+		t.Errorf("恢复状态不应修改挂单: %+v", orders)
+	}
+}
+
+func TestAutoTraderStateSurvivesRestart(t *testing.T) {
+	t.Chdir(t.TempDir()) // 决策日志写在临时目录
+
+	config := AutoTraderConfig{
+		ID:              "restart",
+		Name:            "Restart",
+		AIModel:         "custom",
+		Exchange:        "paper",
+		CustomAPIURL:    "http://127.0.0.1:0",
+		CustomAPIKey:    "key",
+		CustomModelName: "model",
+		InitialBalance:  1000,
+		BTCETHLeverage:  5,
+		AltcoinLeverage: 5,
+	}
+	first, err := NewAutoTrader(config)
+	if err != nil {
+		t.Fatalf("创建交易器失败: %v", err)
+	}
+	first.callCount = 9
+	first.positionReasonings["BTCUSDT"] = "突破回踩"
+	first.positionPnLTracking["BTCUSDT_long"] = &PnLTracking{StopLossPrice: 58000}
+	first.lastPositionSnapshot["BTCUSDT_long"] = &PositionSnapshot{Symbol: "BTCUSDT", Side: "long", Quantity: 0.1}
+	first.restingEntries["ETHUSDT_long"] = &RestingEntry{OrderID: 7, Side: "long"}
+	first.breaker = breakerState{PeakEquity: 1500, Equity: 1400, StopUntil: time.Now().Add(time.Hour), Reason: "回撤"}
+	for i := 0; i < 3; i++ {
+		first.decisionLogger.LogDecision(&logger.DecisionRecord{Success: true})
+	}
+	first.saveState()
+
+	second, err := NewAutoTrader(config)
+	if err != nil {
+		t.Fatalf("创建交易器失败: %v", err)
+	}
+	if n := second.decisionLogger.CycleNumber(); n != 3 {
+		t.Errorf("决策日志周期编号应从已有记录继续: %d", n)
+	}
+	second.restoreState()
+
+	if second.callCount != 9 {
+		t.Errorf("AI调用次数应恢复: %d", second.callCount)
+	}
+	// 模拟盘重启后账户重置：持仓跟踪数据、持仓快照、限价开仓单和熔断状态都不恢复
+	if len(second.positionReasonings) != 0 || len(second.positionPnLTracking) != 0 {
+		t.Errorf("已不存在的持仓不应恢复跟踪数据: %+v %+v", second.positionReasonings, second.positionPnLTracking)
+	}
+	if len(second.lastPositionSnapshot) != 0 || len(second.restingEntries) != 0 {
+		t.Errorf("模拟盘不应恢复持仓快照和限价开仓单: %+v %+v", second.lastPositionSnapshot, second.restingEntries)
+	}
+	if second.breakerActive() || second.breaker.PeakEquity != 0 {
+		t.Errorf("模拟盘不应恢复熔断状态: %+v", second.breaker)
+	}
+	// 不会把快照中的持仓记录为止损止盈平仓
+	if closed := second.detectClosedPositions(); len(closed) != 0 {
+		t.Errorf("模拟盘重启后不应检测到平仓: %+v", closed)
+	}
+
+	// 旧的决策记录被清理后，周期编号从保存的状态恢复
+	second.decisionLogger.ResumeCycleNumber(2)
+	if n := second.decisionLogger.CycleNumber(); n != 3 {
+		t.Errorf("周期编号不应回退: %d", n)
+	}
+	fresh := logger.NewDecisionLogger(filepath.Join(t.TempDir(), "empty"))
+	fresh.ResumeCycleNumber(57)
+	if n := fresh.CycleNumber(); n != 57 {
+		t.Errorf("周期编号应从保存的状态恢复: %d", n)
+	}
+}
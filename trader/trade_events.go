@@ -0,0 +1,117 @@
+package trader
+
+import (
+	"fmt"
+	"log"
+	"nofx/logger"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tradeEventHub 实时推送事件的订阅表（交易器内嵌使用即实现TradeEventPublisher）
+type tradeEventHub struct {
+	hubMu    sync.RWMutex
+	nextID   int
+	handlers map[int]func(TradeEvent)
+}
+
+// SubscribeTradeEvents 注册事件回调，返回取消订阅函数
+func (h *tradeEventHub) SubscribeTradeEvents(handler func(TradeEvent)) func() {
+	h.hubMu.Lock()
+	defer h.hubMu.Unlock()
+
+	if h.handlers == nil {
+		h.handlers = make(map[int]func(TradeEvent))
+	}
+	id := h.nextID
+	h.nextID++
+	h.handlers[id] = handler
+
+	return func() {
+		h.hubMu.Lock()
+		delete(h.handlers, id)
+		h.hubMu.Unlock()
+	}
+}
+
+// publish 把事件分发给所有订阅者
+func (h *tradeEventHub) publish(event TradeEvent) {
+	h.hubMu.RLock()
+	handlers := make([]func(TradeEvent), 0, len(h.handlers))
+	for _, handler := range h.handlers {
+		handlers = append(handlers, handler)
+	}
+	h.hubMu.RUnlock()
+
+	for _, handler := range handlers {
+		handler(event)
+	}
+}
+
+// startTradeEvents 订阅交易器的实时推送并启动推送连接，返回停止函数
+// 交易器不支持推送时什么也不做；推送启动失败时只记录日志（仍可按周期轮询）
+func startTradeEvents(t Trader, name string, handler func(TradeEvent)) (stop func()) {
+	var unsubscribe func()
+	if publisher, ok := t.(TradeEventPublisher); ok && handler != nil {
+		unsubscribe = publisher.SubscribeTradeEvents(handler)
+	}
+
+	streamer, ok := t.(CloseFillStreamer)
+	if ok {
+		if err := streamer.StartUserDataStream(); err != nil {
+			log.Printf("⚠️ [%s] 用户数据流启动失败，将按周期轮询检测平仓: %v", name, err)
+		}
+	}
+
+	return func() {
+		if unsubscribe != nil {
+			unsubscribe()
+		}
+		if streamer != nil {
+			streamer.StopUserDataStream()
+		}
+	}
+}
+
+// isProtectiveClose 是否为止损、止盈或强平等非AI主动发起的平仓
+func isProtectiveClose(fill *FillEvent) bool {
+	if !fill.IsClose {
+		return false
+	}
+	switch fill.OrderType {
+	case CloseOrderStopMarket, CloseOrderStop, CloseOrderTakeProfitMarket, CloseOrderTakeProfit,
+		CloseOrderTrailingStop, CloseOrderLiquidation:
+		return true
+	}
+	return false
+}
+
+// closeRecordForFill 为推送的止损/止盈/强平成交生成一条独立的决策记录
+func closeRecordForFill(fill *FillEvent) *logger.DecisionRecord {
+	action, triggerType := closeActionForOrderType(fill.Side, fill.OrderType)
+	msg := fmt.Sprintf("🎯 实时推送: %s %s触发: %s (成交价%.4f, 数量%.4f, 剩余%.4f, 盈亏%.2f USDT)",
+		fill.Symbol, triggerType, strings.ToUpper(fill.Side), fill.Price, fill.Quantity, fill.PositionAfter, fill.ClosedPnL)
+	log.Println(msg)
+
+	timestamp := fill.Time
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+	return &logger.DecisionRecord{
+		ExecutionLog: []string{msg},
+		Success:      true,
+		Realtime:     true,
+		Decisions: []logger.DecisionAction{{
+			Action:    action,
+			Symbol:    fill.Symbol,
+			Quantity:  fill.Quantity,
+			Price:     fill.Price,
+			OrderID:   fill.OrderID,
+			Fee:       fill.Fee,
+			FeeAsset:  fill.FeeAsset,
+			Timestamp: timestamp,
+			Success:   true,
+		}},
+	}
+}
@@ -0,0 +1,265 @@
+package trader
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"nofx/decision"
+	"nofx/logger"
+	"strings"
+	"sync"
+	"time"
+)
+
+// trailingStop 追踪止损状态（模拟盘和客户端模拟共用）
+// 到达激活价后记录最有利价格，价格从该价格回调CallbackRate%时触发
+type trailingStop struct {
+	Symbol          string
+	PositionSide    string  // "LONG" 或 "SHORT"
+	Quantity        float64 // 触发时平仓的数量
+	ActivationPrice float64 // 激活价（0表示立即激活）
+	CallbackRate    float64 // 回调比例（%）
+
+	activated bool
+	extreme   float64 // 激活后的最高价（多）或最低价（空）
+}
+
+// update 按最新价格更新追踪状态，返回是否触发
+func (s *trailingStop) update(price float64) bool {
+	long := s.PositionSide == "LONG"
+	if !s.activated {
+		if s.ActivationPrice > 0 && ((long && price < s.ActivationPrice) || (!long && price > s.ActivationPrice)) {
+			return false
+		}
+		s.activated = true
+		s.extreme = price
+	}
+	if long {
+		s.extreme = math.Max(s.extreme, price)
+		return price <= s.stopPrice()
+	}
+	s.extreme = math.Min(s.extreme, price)
+	return price >= s.stopPrice()
+}
+
+// stopPrice 当前的触发价（未激活时为0）
+func (s *trailingStop) stopPrice() float64 {
+	if !s.activated {
+		return 0
+	}
+	if s.PositionSide == "LONG" {
+		return s.extreme * (1 - s.CallbackRate/100)
+	}
+	return s.extreme * (1 + s.CallbackRate/100)
+}
+
+// validateTrailingStop 校验追踪止损参数（激活价必须在有利方向，否则交易所会拒绝或立即触发）
+func validateTrailingStop(positionSide string, currentPrice, activationPrice, callbackRate float64) error {
+	if positionSide != "LONG" && positionSide != "SHORT" {
+		return fmt.Errorf("无效的持仓方向: %s", positionSide)
+	}
+	if callbackRate < decision.MinTrailingCallbackRate || callbackRate > decision.MaxTrailingCallbackRate {
+		return fmt.Errorf("追踪止损回调比例必须在%.1f%%-%.0f%%之间: %.2f",
+			decision.MinTrailingCallbackRate, decision.MaxTrailingCallbackRate, callbackRate)
+	}
+	if activationPrice < 0 {
+		return fmt.Errorf("追踪止损激活价不能为负数: %.4f", activationPrice)
+	}
+	if activationPrice > 0 && currentPrice > 0 {
+		if positionSide == "LONG" && activationPrice <= currentPrice {
+			return fmt.Errorf("多头追踪止损激活价(%.4f)必须高于当前价格(%.4f)", activationPrice, currentPrice)
+		}
+		if positionSide == "SHORT" && activationPrice >= currentPrice {
+			return fmt.Errorf("空头追踪止损激活价(%.4f)必须低于当前价格(%.4f)", activationPrice, currentPrice)
+		}
+	}
+	return nil
+}
+
+// applyTrailingStop 为决策币种的持仓设置追踪止损（AutoTrader和仓位管理共用，原有止损止盈单保持不变）
+func applyTrailingStop(t Trader, d *decision.Decision, currentPrice float64, actionRecord *logger.DecisionAction) error {
+	if !t.Capabilities().TrailingStop {
+		return fmt.Errorf("该交易所不支持追踪止损")
+	}
+
+	positions, err := t.GetPositions()
+	if err != nil {
+		return fmt.Errorf("获取持仓信息失败: %w", err)
+	}
+	var position *Position
+	for i := range positions {
+		if positions[i].Symbol == d.Symbol {
+			position = &positions[i]
+			break
+		}
+	}
+	if position == nil {
+		return fmt.Errorf("❌ %s 没有持仓，无法设置追踪止损", d.Symbol)
+	}
+
+	actionRecord.Price = currentPrice
+	actionRecord.Quantity = position.PositionAmt
+
+	positionSide := strings.ToUpper(position.Side)
+	if err := validateTrailingStop(positionSide, currentPrice, d.ActivationPrice, d.CallbackRate); err != nil {
+		return err
+	}
+	if err := t.SetTrailingStop(d.Symbol, positionSide, position.PositionAmt, d.ActivationPrice, d.CallbackRate); err != nil {
+		return err
+	}
+
+	log.Printf("  ✅ %s %s 追踪止损已设置: 回调%.2f%% 激活价%.4f", d.Symbol, positionSide, d.CallbackRate, d.ActivationPrice)
+	return nil
+}
+
+// trailingStopEmulator 客户端模拟的追踪止损（交易所没有可用的原生追踪止损单时使用）
+// 后台按固定间隔轮询价格，回调达到比例时以市价平仓；只存在于进程内，重启后需要重新设置
+type trailingStopEmulator struct {
+	mu       sync.Mutex
+	stops    map[string]*trailingStop // symbol_side -> 追踪止损
+	running  bool
+	interval time.Duration
+
+	price         func(symbol string) (float64, error)
+	closePosition func(symbol, positionSide string, quantity float64) error
+}
+
+// newTrailingStopEmulator 创建客户端追踪止损（price获取最新价格，closePosition市价平仓）
+func newTrailingStopEmulator(price func(symbol string) (float64, error), closePosition func(symbol, positionSide string, quantity float64) error) *trailingStopEmulator {
+	return &trailingStopEmulator{
+		stops:         make(map[string]*trailingStop),
+		interval:      5 * time.Second,
+		price:         price,
+		closePosition: closePosition,
+	}
+}
+
+// set 设置（替换）某方向持仓的追踪止损，并在需要时启动后台轮询
+func (e *trailingStopEmulator) set(symbol, positionSide string, quantity, activationPrice, callbackRate float64) error {
+	if quantity <= 0 {
+		return fmt.Errorf("追踪止损数量必须大于0: %.8f", quantity)
+	}
+	price, err := e.price(symbol)
+	if err != nil {
+		return fmt.Errorf("获取价格失败: %w", err)
+	}
+	if err := validateTrailingStop(positionSide, price, activationPrice, callbackRate); err != nil {
+		return err
+	}
+
+	stop := &trailingStop{
+		Symbol:          symbol,
+		PositionSide:    positionSide,
+		Quantity:        quantity,
+		ActivationPrice: activationPrice,
+		CallbackRate:    callbackRate,
+	}
+	stop.update(price)
+
+	e.mu.Lock()
+	e.stops[symbol+"_"+positionSide] = stop
+	start := !e.running
+	e.running = true
+	e.mu.Unlock()
+
+	if start {
+		go e.run()
+	}
+	return nil
+}
+
+// cancel 取消该币种的追踪止损，返回取消的数量
+func (e *trailingStopEmulator) cancel(symbol string) int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	removed := 0
+	for key, stop := range e.stops {
+		if stop.Symbol == symbol {
+			delete(e.stops, key)
+			removed++
+		}
+	}
+	return removed
+}
+
+// closePositionFunc 市价平掉某方向持仓（客户端追踪止损触发时使用）
+func closePositionFunc(t Trader) func(symbol, positionSide string, quantity float64) error {
+	return func(symbol, positionSide string, quantity float64) error {
+		var err error
+		if positionSide == "LONG" {
+			_, err = t.CloseLong(symbol, quantity)
+		} else {
+			_, err = t.CloseShort(symbol, quantity)
+		}
+		return err
+	}
+}
+
+// run 轮询价格直到没有追踪止损
+func (e *trailingStopEmulator) run() {
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if !e.check() {
+			return
+		}
+	}
+}
+
+// check 用最新价格更新所有追踪止损并平掉触发的持仓，返回是否还有追踪止损
+// 平仓失败的追踪止损重新挂上，下次轮询时再次尝试
+func (e *trailingStopEmulator) check() bool {
+	e.mu.Lock()
+	symbols := make(map[string]bool)
+	for _, stop := range e.stops {
+		symbols[stop.Symbol] = true
+	}
+	e.mu.Unlock()
+
+	prices := make(map[string]float64, len(symbols))
+	for symbol := range symbols {
+		price, err := e.price(symbol)
+		if err != nil {
+			log.Printf("  ⚠ 追踪止损获取 %s 价格失败: %v", symbol, err)
+			continue
+		}
+		prices[symbol] = price
+	}
+
+	e.mu.Lock()
+	var triggered []*trailingStop
+	for key, stop := range e.stops {
+		price, ok := prices[stop.Symbol]
+		if ok && stop.update(price) {
+			triggered = append(triggered, stop)
+			delete(e.stops, key)
+		}
+	}
+	e.mu.Unlock()
+
+	var failed []*trailingStop
+	for _, stop := range triggered {
+		log.Printf("  🎯 追踪止损触发: %s %s 最有利价=%.4f 触发价=%.4f 回调=%.2f%% 数量=%.4f",
+			stop.Symbol, stop.PositionSide, stop.extreme, stop.stopPrice(), stop.CallbackRate, stop.Quantity)
+		if err := e.closePosition(stop.Symbol, stop.PositionSide, stop.Quantity); err != nil {
+			log.Printf("  ❌ 追踪止损平仓失败，下次轮询时重试: %s %s: %v", stop.Symbol, stop.PositionSide, err)
+			failed = append(failed, stop)
+		}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, stop := range failed {
+		// 平仓期间重新设置过的追踪止损优先
+		if key := stop.Symbol + "_" + stop.PositionSide; e.stops[key] == nil {
+			e.stops[key] = stop
+		}
+	}
+	remaining := len(e.stops) > 0
+	if !remaining {
+		e.running = false
+	}
+	return remaining
+}
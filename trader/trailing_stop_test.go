@@ -0,0 +1,185 @@
+package trader
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTrailingStopFollowsFavorablePrice(t *testing.T) {
+	long := &trailingStop{PositionSide: "LONG", ActivationPrice: 61000, CallbackRate: 1}
+	for _, price := range []float64{60000, 60900} {
+		if long.update(price) || long.stopPrice() != 0 {
+			t.Fatalf("未到激活价(%.0f)不应开始追踪", price)
+		}
+	}
+	// 激活后触发价跟随最高价上移，不随回落下移
+	for _, price := range []float64{61000, 62000, 61500} {
+		if long.update(price) {
+			t.Fatalf("价格%.0f不应触发", price)
+		}
+	}
+	if !floatEq(long.stopPrice(), 62000*0.99) {
+		t.Errorf("触发价应为最高价回调1%%: %.4f", long.stopPrice())
+	}
+	if !long.update(61380) {
+		t.Error("从最高价回调1%应触发")
+	}
+
+	// 空头立即激活，跟随最低价
+	short := &trailingStop{PositionSide: "SHORT", CallbackRate: 2}
+	if short.update(3000) || short.update(2900) {
+		t.Fatal("价格下跌时空头追踪止损不应触发")
+	}
+	if !floatEq(short.stopPrice(), 2958) || short.update(2957) || !short.update(2958) {
+		t.Errorf("空头应在最低价反弹2%%时触发: %.4f", short.stopPrice())
+	}
+}
+
+func TestValidateTrailingStop(t *testing.T) {
+	cases := []struct {
+		side             string
+		activation, rate float64
+		ok               bool
+	}{
+		{"LONG", 0, 1, true},
+		{"LONG", 61000, 0.5, true},
+		{"LONG", 59000, 1, false}, // 多头激活价必须高于当前价
+		{"SHORT", 59000, 5, true},
+		{"SHORT", 61000, 1, false}, // 空头激活价必须低于当前价
+		{"LONG", 0, 0.05, false},   // 回调比例过小
+		{"SHORT", 0, 8, false},     // 回调比例过大
+		{"long", 0, 1, false},
+	}
+	for _, c := range cases {
+		err := validateTrailingStop(c.side, 60000, c.activation, c.rate)
+		if (err == nil) != c.ok {
+			t.Errorf("%s 激活价%.0f 回调%.2f%%: %v", c.side, c.activation, c.rate, err)
+		}
+	}
+}
+
+func TestTrailingStopEmulatorClosesPosition(t *testing.T) {
+	var mu sync.Mutex
+	price := 3000.0
+	var closed []string
+	emulator := newTrailingStopEmulator(
+		func(symbol string) (float64, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			return price, nil
+		},
+		func(symbol, positionSide string, quantity float64) error {
+			mu.Lock()
+			defer mu.Unlock()
+			closed = append(closed, symbol+"_"+positionSide)
+			return nil
+		},
+	)
+	emulator.interval = time.Hour // 由测试手动调用check
+
+	if err := emulator.set("ETHUSDT", "SHORT", 0.5, 2950, 1); err != nil {
+		t.Fatalf("设置追踪止损失败: %v", err)
+	}
+	if err := emulator.set("ETHUSDT", "SHORT", 0.5, 3100, 1); err == nil {
+		t.Fatal("空头激活价高于当前价应被拒绝")
+	}
+
+	setPrice := func(p float64) {
+		mu.Lock()
+		price = p
+		mu.Unlock()
+	}
+	setPrice(2940)
+	if !emulator.check() {
+		t.Fatal("未触发时应继续轮询")
+	}
+	setPrice(2969) // 最低价2940反弹1%为2969.4
+	emulator.check()
+	setPrice(2970)
+	if emulator.check() {
+		t.Error("触发后没有追踪止损，应停止轮询")
+	}
+	if len(closed) != 1 || closed[0] != "ETHUSDT_SHORT" {
+		t.Fatalf("应平掉空仓: %v", closed)
+	}
+
+	// 撤销挂单时一并取消
+	emulator.set("ETHUSDT", "SHORT", 0.5, 0, 1)
+	if n := emulator.cancel("ETHUSDT"); n != 1 {
+		t.Errorf("应取消1个追踪止损，实际 %d", n)
+	}
+}
+
+func TestTrailingStopEmulatorRetriesFailedClose(t *testing.T) {
+	price := 60000.0
+	closeErr := errors.New("交易所繁忙")
+	var attempts int
+	emulator := newTrailingStopEmulator(
+		func(symbol string) (float64, error) { return price, nil },
+		func(symbol, positionSide string, quantity float64) error {
+			attempts++
+			return closeErr
+		},
+	)
+	emulator.interval = time.Hour // 由测试手动调用check
+
+	if err := emulator.set("BTCUSDT", "LONG", 0.1, 0, 1); err != nil {
+		t.Fatalf("设置追踪止损失败: %v", err)
+	}
+	price = 59400 // 回调1%触发
+	if !emulator.check() || attempts != 1 {
+		t.Fatalf("平仓失败后应继续轮询: 尝试%d次", attempts)
+	}
+	stop := emulator.stops["BTCUSDT_LONG"]
+	if stop == nil || !floatEq(stop.stopPrice(), 59400) {
+		t.Fatalf("平仓失败后追踪止损应保持挂单: %+v", stop)
+	}
+
+	// 下次轮询时重试，成功后移除
+	closeErr = nil
+	if emulator.check() || attempts != 2 {
+		t.Errorf("重试平仓成功后应停止轮询: 尝试%d次", attempts)
+	}
+	if len(emulator.stops) != 0 {
+		t.Errorf("平仓成功后不应保留追踪止损: %+v", emulator.stops)
+	}
+}
+
+func TestPaperTrailingStop(t *testing.T) {
+	price := 60000.0
+	paper := NewPaperTrader(10000, 0, 0)
+	paper.fetchQuote = func(symbol string) (float64, float64, error) { return price, 0, nil }
+	paper.cacheDuration = 0
+
+	if _, err := paper.OpenLong("BTCUSDT", 0.1, 5); err != nil {
+		t.Fatalf("开仓失败: %v", err)
+	}
+	paper.SetStopLoss("BTCUSDT", "LONG", 0.1, 58000)
+	if err := paper.SetTrailingStop("BTCUSDT", "LONG", 0.1, 61000, 1); err != nil {
+		t.Fatalf("设置追踪止损失败: %v", err)
+	}
+	// 再次设置替换原有的追踪止损，止损单保持不变
+	if err := paper.SetTrailingStop("BTCUSDT", "LONG", 0.1, 61000, 2); err != nil {
+		t.Fatalf("替换追踪止损失败: %v", err)
+	}
+	orders, _ := paper.GetOpenOrders("BTCUSDT")
+	if len(orders) != 2 || orders[1].Type != CloseOrderTrailingStop || orders[1].CallbackRate != 2 || orders[1].ActivationPrice != 61000 {
+		t.Fatalf("挂单错误: %+v", orders)
+	}
+
+	for _, p := range []float64{62000, 63000, 61800} {
+		price = p
+		if positions, _ := paper.GetPositions(); len(positions) != 1 {
+			t.Fatalf("价格%.0f不应触发追踪止损", p)
+		}
+	}
+	price = 61740 // 最高价63000回调2%
+	if positions, _ := paper.GetPositions(); len(positions) != 0 {
+		t.Fatalf("追踪止损应已平仓: %+v", positions)
+	}
+	if orders, _ := paper.GetOpenOrders("BTCUSDT"); len(orders) != 0 {
+		t.Errorf("平仓后应删除剩余的止损单: %+v", orders)
+	}
+}
@@ -0,0 +1,279 @@
+package trader
+
+import "time"
+
+// Balance 账户余额
+type Balance struct {
+	TotalWalletBalance    float64 `json:"totalWalletBalance"`    // 钱包余额（不含未实现盈亏）
+	AvailableBalance      float64 `json:"availableBalance"`      // 可用余额
+	TotalUnrealizedProfit float64 `json:"totalUnrealizedProfit"` // 未实现盈亏
+}
+
+// TotalEquity 账户净值 = 钱包余额 + 未实现盈亏
+func (b *Balance) TotalEquity() float64 {
+	return b.TotalWalletBalance + b.TotalUnrealizedProfit
+}
+
+// Position 持仓信息
+type Position struct {
+	Symbol           string  `json:"symbol"`           // 交易对，如 "BTCUSDT"
+	Side             string  `json:"side"`             // "long" 或 "short"
+	PositionAmt      float64 `json:"positionAmt"`      // 持仓数量（统一为正数，方向见Side）
+	EntryPrice       float64 `json:"entryPrice"`       // 开仓均价
+	MarkPrice        float64 `json:"markPrice"`        // 标记价格
+	UnRealizedProfit float64 `json:"unRealizedProfit"` // 未实现盈亏
+	Leverage         int     `json:"leverage"`         // 杠杆倍数
+	LiquidationPrice float64 `json:"liquidationPrice"` // 强平价格
+}
+
+// Key 持仓唯一标识（symbol_side）
+func (p *Position) Key() string {
+	return p.Symbol + "_" + p.Side
+}
+
+// Order 未完成订单
+type Order struct {
+	OrderID      int64   `json:"orderId"`
+	Symbol       string  `json:"symbol"`
+	Type         string  `json:"type"`         // "LIMIT", "STOP_MARKET", "TAKE_PROFIT_MARKET", "TRAILING_STOP_MARKET" 等
+	Side         string  `json:"side"`         // "BUY" 或 "SELL"
+	PositionSide string  `json:"positionSide"` // "LONG", "SHORT" 或 "BOTH"
+	Price        float64 `json:"price"`        // 限价
+	StopPrice    float64 `json:"stopPrice"`    // 触发价（止盈止损单）
+	Quantity     float64 `json:"origQty"`      // 委托数量
+	Status       string  `json:"status"`
+	ReduceOnly   bool    `json:"reduceOnly,omitempty"` // 只减仓单（单向持仓模式下的平仓单）
+
+	ActivationPrice float64 `json:"activatePrice,omitempty"` // 追踪止损激活价
+	CallbackRate    float64 `json:"priceRate,omitempty"`     // 追踪止损回调比例（%）
+}
+
+// OrderBookLevel 订单簿的一档
+type OrderBookLevel struct {
+	Price    float64 `json:"price"`
+	Quantity float64 `json:"quantity"` // 币数量（按张报价的交易所已换算）
+}
+
+// OrderBook L2订单簿快照（买盘价格从高到低，卖盘价格从低到高）
+type OrderBook struct {
+	Symbol string           `json:"symbol"`
+	Bids   []OrderBookLevel `json:"bids"`
+	Asks   []OrderBookLevel `json:"asks"`
+	Time   time.Time        `json:"time"`
+}
+
+// OrderResult 下单结果
+type OrderResult struct {
+	OrderID     int64   `json:"orderId"`     // 交易所订单ID（0表示交易所未返回）
+	Symbol      string  `json:"symbol"`      // 交易对
+	Status      string  `json:"status"`      // 订单状态（见OrderStatus常量）
+	AvgPrice    float64 `json:"avgPrice"`    // 成交均价（0表示未知）
+	ExecutedQty float64 `json:"executedQty"` // 成交数量（0表示未知）
+	Fee         float64 `json:"fee"`         // 手续费（正数表示支付，负数表示返佣）
+	FeeAsset    string  `json:"feeAsset"`    // 手续费币种（空表示未知）
+
+	OtherFees map[string]float64 `json:"otherFees,omitempty"` // 以FeeAsset以外的币种支付的手续费（币种 -> 金额，如部分成交用BNB抵扣）
+
+	ClientOrderID string `json:"clientOrderId,omitempty"` // 下单时附带的客户端订单ID（见ClientOrderRef）
+}
+
+// IsOpen 订单是否仍在挂单中（未成交或部分成交）
+func (r *OrderResult) IsOpen() bool {
+	return r.Status == OrderStatusNew || r.Status == OrderStatusPartiallyFilled
+}
+
+// orderFill 单笔成交明细
+type orderFill struct {
+	Price    float64
+	Quantity float64
+	Fee      float64 // 正数表示支付
+	FeeAsset string
+}
+
+// addFee 累加一笔手续费：与FeeAsset相同币种的计入Fee，其他币种的计入OtherFees（FeeAsset为空时以该笔的币种为准）
+func (r *OrderResult) addFee(fee float64, asset string) {
+	if r.FeeAsset == "" {
+		r.FeeAsset = asset
+	}
+	if asset == "" || asset == r.FeeAsset {
+		r.Fee += fee
+		return
+	}
+	if r.OtherFees == nil {
+		r.OtherFees = make(map[string]float64)
+	}
+	r.OtherFees[asset] += fee
+}
+
+// applyFills 用成交明细汇总订单的成交均价、成交数量和手续费（无成交明细时保持不变）
+// 手续费以第一笔成交的币种为准，其他币种的手续费单独记入OtherFees（如部分成交用BNB抵扣）
+func (r *OrderResult) applyFills(fills []orderFill) {
+	var quantity, notional float64
+	for _, f := range fills {
+		quantity += f.Quantity
+		notional += f.Price * f.Quantity
+	}
+	if quantity <= 0 {
+		return
+	}
+
+	r.AvgPrice = notional / quantity
+	r.ExecutedQty = quantity
+	r.Fee, r.FeeAsset, r.OtherFees = 0, "", nil
+	for _, f := range fills {
+		r.addFee(f.Fee, f.FeeAsset)
+	}
+}
+
+// 订单状态（各交易器统一为币安风格）
+const (
+	OrderStatusNew             = "NEW"
+	OrderStatusPartiallyFilled = "PARTIALLY_FILLED"
+	OrderStatusFilled          = "FILLED"
+	OrderStatusCanceled        = "CANCELED"
+	OrderStatusExpired         = "EXPIRED"  // IOC未成交部分、只做Maker单会立即成交时被交易所撤销
+	OrderStatusRejected        = "REJECTED" // 下单被拒绝
+)
+
+// TimeInForce 限价单有效方式
+type TimeInForce string
+
+const (
+	TimeInForceGTC      TimeInForce = "GTC"       // 一直有效直到成交或取消
+	TimeInForceIOC      TimeInForce = "IOC"       // 立即成交，未成交部分取消
+	TimeInForcePostOnly TimeInForce = "POST_ONLY" // 只做Maker，会立即成交时撤销
+)
+
+// CloseFill 交易所推送的平仓成交（同一订单的多笔成交合并为一条）
+type CloseFill struct {
+	Symbol      string    `json:"symbol"`
+	Side        string    `json:"side"` // 被平仓位方向: "long" 或 "short"
+	OrderID     int64     `json:"orderId"`
+	OrderType   string    `json:"orderType"` // 原始订单类型: STOP_MARKET, TAKE_PROFIT_MARKET, MARKET, LIQUIDATION 等
+	Quantity    float64   `json:"quantity"`
+	Price       float64   `json:"price"`       // 成交均价
+	RealizedPnL float64   `json:"realizedPnl"` // 交易所计算的已实现盈亏（不含手续费）
+	Fee         float64   `json:"fee"`
+	FeeAsset    string    `json:"feeAsset"`
+	Time        time.Time `json:"time"`
+}
+
+// Key 仓位唯一标识，与Position.Key()一致
+func (f CloseFill) Key() string {
+	return f.Symbol + "_" + f.Side
+}
+
+// 平仓订单类型（CloseFill.OrderType）
+const (
+	CloseOrderStopMarket       = "STOP_MARKET"
+	CloseOrderStop             = "STOP"
+	CloseOrderTakeProfitMarket = "TAKE_PROFIT_MARKET"
+	CloseOrderTakeProfit       = "TAKE_PROFIT"
+	CloseOrderTrailingStop     = "TRAILING_STOP_MARKET"
+	CloseOrderLiquidation      = "LIQUIDATION" // 强平/自动减仓
+)
+
+// TradeEventType 交易所实时推送事件类型
+type TradeEventType string
+
+const (
+	TradeEventFill        TradeEventType = "fill"         // 成交
+	TradeEventOrderUpdate TradeEventType = "order_update" // 订单状态变化
+	TradeEventFunding     TradeEventType = "funding"      // 资金费结算
+)
+
+// TradeEvent 交易所实时推送事件（按Type只有一个字段非空）
+type TradeEvent struct {
+	Type    TradeEventType    `json:"type"`
+	Fill    *FillEvent        `json:"fill,omitempty"`
+	Order   *OrderUpdateEvent `json:"order,omitempty"`
+	Funding *FundingEvent     `json:"funding,omitempty"`
+}
+
+// FillEvent 成交推送
+type FillEvent struct {
+	Symbol        string    `json:"symbol"`
+	Side          string    `json:"side"` // 成交所属仓位方向: "long" 或 "short"
+	OrderID       int64     `json:"orderId"`
+	OrderType     string    `json:"orderType"` // 平仓成交的订单类型（同CloseFill.OrderType），开仓成交为空
+	IsClose       bool      `json:"isClose"`
+	Quantity      float64   `json:"quantity"`
+	Price         float64   `json:"price"`
+	ClosedPnL     float64   `json:"closedPnl"` // 平仓已实现盈亏（不含手续费）
+	Fee           float64   `json:"fee"`
+	FeeAsset      string    `json:"feeAsset"`
+	PositionAfter float64   `json:"positionAfter"` // 成交后该方向剩余仓位数量
+	Time          time.Time `json:"time"`
+}
+
+// OrderUpdateEvent 订单状态推送
+type OrderUpdateEvent struct {
+	Symbol       string    `json:"symbol"`
+	OrderID      int64     `json:"orderId"`
+	Side         string    `json:"side"` // BUY 或 SELL
+	Price        float64   `json:"price"`
+	Quantity     float64   `json:"quantity"`     // 剩余未成交数量
+	OrigQuantity float64   `json:"origQuantity"` // 原始下单数量
+	Status       string    `json:"status"`       // 统一后的订单状态（OrderStatus*）
+	RawStatus    string    `json:"rawStatus"`    // 交易所原始状态（如triggered、marginCanceled）
+	Time         time.Time `json:"time"`
+}
+
+// FundingEvent 资金费推送
+type FundingEvent struct {
+	Symbol       string    `json:"symbol"`
+	Side         string    `json:"side"`         // 仓位方向: "long" 或 "short"
+	Amount       float64   `json:"amount"`       // 资金费金额（正数为收入，负数为支出）
+	PositionSize float64   `json:"positionSize"` // 结算时的仓位数量
+	FundingRate  float64   `json:"fundingRate"`
+	Time         time.Time `json:"time"`
+}
+
+// TradeFill 交易所返回的历史成交
+type TradeFill struct {
+	Symbol       string    `json:"symbol"`
+	TradeID      int64     `json:"tradeId"`
+	OrderID      int64     `json:"orderId"`
+	Side         string    `json:"side"`         // BUY 或 SELL
+	PositionSide string    `json:"positionSide"` // 成交所属仓位方向: "long" 或 "short"
+	Price        float64   `json:"price"`
+	Quantity     float64   `json:"quantity"`
+	RealizedPnL  float64   `json:"realizedPnl"` // 平仓成交的已实现盈亏（不含手续费）
+	Fee          float64   `json:"fee"`         // 手续费（正数为支付）
+	FeeAsset     string    `json:"feeAsset"`
+	Time         time.Time `json:"time"`
+}
+
+// IncomeType 资金流水类型
+type IncomeType string
+
+const (
+	IncomeRealizedPnL IncomeType = "REALIZED_PNL" // 已实现盈亏
+	IncomeCommission  IncomeType = "COMMISSION"   // 手续费
+	IncomeFunding     IncomeType = "FUNDING_FEE"  // 资金费
+)
+
+// IncomeRecord 交易所返回的资金流水（金额正数为收入，负数为支出）
+type IncomeRecord struct {
+	Symbol string     `json:"symbol"`
+	Type   IncomeType `json:"type"`
+	Amount float64    `json:"amount"`
+	Asset  string     `json:"asset"`
+	Time   time.Time  `json:"time"`
+}
+
+// MarginMode 保证金模式
+type MarginMode string
+
+const (
+	MarginModeCross    MarginMode = "cross"    // 全仓
+	MarginModeIsolated MarginMode = "isolated" // 逐仓
+)
+
+// PositionMode 持仓模式
+type PositionMode string
+
+const (
+	PositionModeOneWay PositionMode = "one-way" // 单向持仓（同一币种只能持有一个方向）
+	PositionModeHedge  PositionMode = "hedge"   // 双向持仓（同一币种可同时持有多空）
+)
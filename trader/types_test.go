@@ -0,0 +1,28 @@
+package trader
+
+import "testing"
+
+func TestApplyFillsRecordsOtherFeeAssets(t *testing.T) {
+	result := &OrderResult{OrderID: 1}
+	result.applyFills([]orderFill{
+		{Price: 100, Quantity: 1, Fee: 0.04, FeeAsset: "USDT"},
+		{Price: 102, Quantity: 1, Fee: 0.0001, FeeAsset: "BNB"},
+		{Price: 104, Quantity: 2, Fee: 0.08, FeeAsset: "USDT"},
+	})
+	if !floatEq(result.AvgPrice, 102.5) || !floatEq(result.ExecutedQty, 4) {
+		t.Errorf("成交均价或数量错误: %+v", result)
+	}
+	// 以第一笔成交的币种为准，BNB抵扣的手续费单独记录
+	if result.FeeAsset != "USDT" || !floatEq(result.Fee, 0.12) {
+		t.Errorf("手续费错误: %+v", result)
+	}
+	if len(result.OtherFees) != 1 || !floatEq(result.OtherFees["BNB"], 0.0001) {
+		t.Errorf("其他币种的手续费应单独记录: %+v", result.OtherFees)
+	}
+
+	// 重新汇总时替换之前的结果
+	result.applyFills([]orderFill{{Price: 100, Quantity: 1, Fee: 0.04, FeeAsset: "USDT"}})
+	if !floatEq(result.Fee, 0.04) || result.OtherFees != nil {
+		t.Errorf("重新汇总应替换之前的手续费: %+v", result)
+	}
+}
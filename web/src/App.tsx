@@ -462,6 +462,7 @@ function TraderDetailsPage({
                   <th className="pb-3 font-semibold text-gray-400">{t('positionValue', language)}</th>
                   <th className="pb-3 font-semibold text-gray-400">{t('leverage', language)}</th>
                   <th className="pb-3 font-semibold text-gray-400">{t('unrealizedPnL', language)}</th>
+                  <th className="pb-3 font-semibold text-gray-400">{t('funding', language)}</th>
                   <th className="pb-3 font-semibold text-gray-400">{t('liqPrice', language)}</th>
                 </tr>
               </thead>
@@ -495,6 +496,10 @@ function TraderDetailsPage({
                         {pos.unrealized_pnl.toFixed(2)} ({pos.unrealized_pnl_pct.toFixed(2)}%)
                       </span>
                     </td>
+                    <td className="py-3 font-mono" style={{ color: (pos.funding || 0) >= 0 ? '#0ECB81' : '#F6465D' }}>
+                      {(pos.funding || 0) >= 0 ? '+' : ''}
+                      {(pos.funding || 0).toFixed(2)}
+                    </td>
                     <td className="py-3 font-mono" style={{ color: '#848E9C' }}>
                       {pos.liquidation_price.toFixed(4)}
                     </td>
@@ -33,6 +33,7 @@ export const translations = {
     positionValue: 'Position Value',
     leverage: 'Leverage',
     unrealizedPnL: 'Unrealized P&L',
+    funding: 'Funding',
     liqPrice: 'Liq. Price',
     long: 'LONG',
     short: 'SHORT',
@@ -151,6 +152,7 @@ export const translations = {
     positionValue: '仓位价值',
     leverage: '杠杆',
     unrealizedPnL: '未实现盈亏',
+    funding: '资金费',
     liqPrice: '强平价',
     long: '多头',
     short: '空头',
@@ -37,6 +37,7 @@ export interface Position {
   unrealized_pnl_pct: number;
   liquidation_price: number;
   margin_used: number;
+  funding: number; // 持仓期间累计资金费（正数为收到）
 }
 
 // 决策动作